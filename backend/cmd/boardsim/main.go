@@ -0,0 +1,133 @@
+// Command boardsim runs a fleet of virtual boards, each exposing the board
+// HTTP protocols on its own loopback address, registers them with a backend
+// and drives report/command traffic to measure latency and error rates.
+//
+// The backend dials boards on port 80, so boardsim needs permission to bind
+// it (root or CAP_NET_BIND_SERVICE). Linux routes all of 127.0.0.0/8 to lo.
+// The process exits non-zero if any board fails to register.
+//
+//	sudo go run ./cmd/boardsim -backend http://localhost:8080 -username admin -password admin \
+//	    -count 1000 -rate 500 -duration 2m
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"backend/internal/simulator"
+)
+
+func main() {
+	var (
+		backendURL  = flag.String("backend", "http://localhost:8080", "backend base URL")
+		token       = flag.String("token", "", "bearer token (skips login)")
+		username    = flag.String("username", "", "backend username used to obtain a token")
+		password    = flag.String("password", "", "backend password used to obtain a token")
+		host        = flag.String("host", "127.0.1.1", "address of the first board; board i listens on host+i")
+		port        = flag.Int("port", 80, "port every board listens on (the backend dials port 80)")
+		count       = flag.Int("count", 10, "number of virtual boards")
+		boardType   = flag.String("board-type", "board_2.0_mesh", "board type reported to the backend")
+		prefix      = flag.String("prefix", "sim", "node id prefix")
+		register    = flag.Bool("register", true, "register boards with the backend")
+		rate        = flag.Float64("rate", 50, "total requests per second sent to the backend")
+		duration    = flag.Duration("duration", time.Minute, "traffic duration (0 = until interrupted)")
+		concurrency = flag.Int("concurrency", 64, "max in-flight backend requests")
+		atRatio     = flag.Float64("at-ratio", 0.1, "share of traffic sent as AT queries through the backend")
+		rebootTime  = flag.Duration("reboot-time", 10*time.Second, "how long a board stays down after a reboot")
+		serveOnly   = flag.Bool("serve-only", false, "only run the boards, generate no traffic")
+		jsonOut     = flag.Bool("json", false, "print the final report as JSON")
+	)
+	flag.Parse()
+
+	if *count <= 0 {
+		log.Fatalf("count must be positive")
+	}
+	if *atRatio < 0 || *atRatio > 1 {
+		log.Fatalf("at-ratio must be within 0..1")
+	}
+
+	authToken := *token
+	if authToken == "" && *username != "" && *register {
+		t, err := login(*backendURL, *username, *password)
+		if err != nil {
+			log.Fatalf("Login failed: %v", err)
+		}
+		authToken = t
+	}
+
+	fleet := simulator.NewFleet(simulator.FleetConfig{
+		BackendURL:  *backendURL,
+		AuthToken:   authToken,
+		Host:        *host,
+		Port:        *port,
+		Count:       *count,
+		BoardType:   *boardType,
+		NodePrefix:  *prefix,
+		Register:    *register,
+		Rate:        *rate,
+		Duration:    *duration,
+		Concurrency: *concurrency,
+		ATRatio:     *atRatio,
+		RebootTime:  *rebootTime,
+	})
+	if err := fleet.Start(); err != nil {
+		log.Fatalf("Failed to start fleet: %v", err)
+	}
+	defer fleet.Stop()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	if *serveOnly || !*register {
+		log.Println("Boards running; press Ctrl+C to stop")
+		<-sigCh
+		return
+	}
+
+	go func() {
+		<-sigCh
+		log.Println("Interrupted, stopping traffic...")
+		fleet.Stop()
+	}()
+
+	log.Printf("Sending %.1f req/s to %s for %s", *rate, *backendURL, *duration)
+	fleet.Run()
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(fleet.Stats().Report())
+		return
+	}
+	fmt.Print(fleet.Stats().Table())
+}
+
+// login obtains a JWT from the backend's auth endpoint.
+func login(backendURL, username, password string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	resp, err := http.Post(backendURL+"/api/auth/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Token string `json:"token"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK || result.Token == "" {
+		return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, result.Error)
+	}
+	return result.Token, nil
+}
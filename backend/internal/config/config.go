@@ -0,0 +1,311 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is where the backend looks for its configuration file.
+const DefaultPath = "config/config.yaml"
+
+// DefaultSecretKey is the placeholder security.secret_key shipped in config.yaml.
+const DefaultSecretKey = "change-me"
+
+// DefaultJWTSecret is the placeholder jwt.secret shipped in config.yaml.
+// Anyone who knows it can sign their own login tokens.
+const DefaultJWTSecret = "your-secret-key"
+
+// legacyJWTSecret is the placeholder shipped by earlier config files.
+const legacyJWTSecret = "your-secret-key-here"
+
+// Config 是后端的全部配置，对应 config/config.yaml。
+// Board、Logging、Vendors以及Device.Timeout/RetryCount只为兼容旧配置文件而解析，目前没有组件读取
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	JWT       JWTConfig       `yaml:"jwt"`
+	Security  SecurityConfig  `yaml:"security"`
+	Board     BoardConfig     `yaml:"board"`
+	Logging   LoggingConfig   `yaml:"logging"`
+	Vendors   []VendorConfig  `yaml:"vendors"`
+	Device    DeviceConfig    `yaml:"device"`
+	Simulator SimulatorConfig `yaml:"simulator"`
+	Firmware  FirmwareConfig  `yaml:"firmware"`
+}
+
+type ServerConfig struct {
+	Host    string `yaml:"host"`
+	Port    int    `yaml:"port"`
+	Timeout int    `yaml:"timeout"` // seconds
+	// ShutdownTimeout bounds the graceful shutdown on SIGTERM (HTTP drain,
+	// background workers and in-flight device commands).
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type DatabaseConfig struct {
+	Type     string `yaml:"type"`
+	Path     string `yaml:"path"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type JWTConfig struct {
+	Secret    string        `yaml:"secret"`
+	ExpiresIn time.Duration `yaml:"expires_in"`
+}
+
+// SecurityConfig holds the key that seals stored secrets such as device access passwords.
+type SecurityConfig struct {
+	SecretKey string `yaml:"secret_key"`
+}
+
+type BoardConfig struct {
+	URL           string `yaml:"url"`
+	Timeout       int    `yaml:"timeout"` // seconds
+	RetryCount    int    `yaml:"retry_count"`
+	RetryInterval int    `yaml:"retry_interval"` // seconds
+}
+
+type LoggingConfig struct {
+	Level      string `yaml:"level"`
+	File       string `yaml:"file"`
+	MaxSize    int    `yaml:"max_size"`
+	MaxBackups int    `yaml:"max_backups"`
+	MaxAge     int    `yaml:"max_age"`
+	Compress   bool   `yaml:"compress"`
+}
+
+type VendorConfig struct {
+	Name     string `yaml:"name"`
+	BoardURL string `yaml:"board_url"`
+	ATPrefix string `yaml:"at_prefix"`
+	ATSuffix string `yaml:"at_suffix"`
+}
+
+type DeviceConfig struct {
+	ScanInterval int `yaml:"scan_interval"` // seconds between status checks
+	DRPRInterval int `yaml:"drpr_interval"` // seconds between DRPR polls
+	Timeout      int `yaml:"timeout"`       // seconds
+	RetryCount   int `yaml:"retry_count"`
+	// ReconcileInterval is the number of seconds between desired-state drift checks
+	ReconcileInterval int `yaml:"reconcile_interval"`
+	// SnapshotInterval is the number of seconds between scheduled config snapshots; 0 disables them
+	SnapshotInterval int `yaml:"snapshot_interval"`
+	// SnapshotRetention is the number of scheduled snapshots kept per device
+	SnapshotRetention int `yaml:"snapshot_retention"`
+	// InventoryInterval is the number of seconds between firmware inventory scans; 0 disables them
+	InventoryInterval int `yaml:"inventory_interval"`
+}
+
+type FirmwareConfig struct {
+	Dir       string `yaml:"dir"`         // where uploaded firmware images are stored
+	MaxSizeMB int    `yaml:"max_size_mb"` // largest accepted image
+}
+
+type SimulatorConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Scenario string `yaml:"scenario"` // optional YAML scenario; empty uses the static topology
+}
+
+// Addr returns the listen address for the HTTP server.
+func (c *Config) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Server.Host, c.Server.Port)
+}
+
+// BaseURL returns the URL in-process clients (the simulator) use to reach the API.
+func (c *Config) BaseURL() string {
+	return fmt.Sprintf("http://localhost:%d", c.Server.Port)
+}
+
+// MonitorInterval is the device status check interval.
+func (c *Config) MonitorInterval() time.Duration {
+	return time.Duration(c.Device.ScanInterval) * time.Second
+}
+
+// DRPRPollInterval is the interval between DRPR polls of a monitored device.
+func (c *Config) DRPRPollInterval() time.Duration {
+	return time.Duration(c.Device.DRPRInterval) * time.Second
+}
+
+// ReconcileInterval is the interval between desired-state drift checks.
+func (c *Config) ReconcileInterval() time.Duration {
+	return time.Duration(c.Device.ReconcileInterval) * time.Second
+}
+
+// SnapshotInterval is the interval between scheduled config snapshots; 0 disables them.
+func (c *Config) SnapshotInterval() time.Duration {
+	return time.Duration(c.Device.SnapshotInterval) * time.Second
+}
+
+// InventoryInterval is the interval between firmware inventory scans; 0 disables them.
+func (c *Config) InventoryInterval() time.Duration {
+	return time.Duration(c.Device.InventoryInterval) * time.Second
+}
+
+// FirmwareMaxSize is the largest accepted firmware image in bytes.
+func (c *Config) FirmwareMaxSize() int64 {
+	return int64(c.Firmware.MaxSizeMB) << 20
+}
+
+// Default 返回内置默认配置
+func Default() *Config {
+	return &Config{
+		Server:   ServerConfig{Host: "0.0.0.0", Port: 8080, Timeout: 30, ShutdownTimeout: 15 * time.Second},
+		Database: DatabaseConfig{Type: "sqlite", Path: "netmanager.db"},
+		JWT:      JWTConfig{Secret: DefaultJWTSecret, ExpiresIn: 24 * time.Hour},
+		Security: SecurityConfig{SecretKey: DefaultSecretKey},
+		Board:    BoardConfig{Timeout: 5, RetryCount: 3, RetryInterval: 1},
+		Logging:  LoggingConfig{Level: "info"},
+		Device:   DeviceConfig{ScanInterval: 30, DRPRInterval: 5, Timeout: 10, RetryCount: 3, ReconcileInterval: 300, SnapshotInterval: 86400, SnapshotRetention: 30, InventoryInterval: 3600},
+		Simulator: SimulatorConfig{
+			Enabled: true,
+		},
+		Firmware: FirmwareConfig{Dir: "firmware", MaxSizeMB: 64},
+	}
+}
+
+// loadFile reads path on top of the defaults. A missing file is not an error.
+func loadFile(path string) (*Config, error) {
+	cfg := Default()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// envOverrides maps environment variables onto config fields.
+var envOverrides = map[string]func(*Config, string) error{
+	"SERVER_HOST":          func(c *Config, v string) error { c.Server.Host = v; return nil },
+	"SERVER_PORT":          func(c *Config, v string) error { return setInt(&c.Server.Port, v) },
+	"DB_PATH":              func(c *Config, v string) error { c.Database.Path = v; return nil },
+	"JWT_SECRET":           func(c *Config, v string) error { c.JWT.Secret = v; return nil },
+	"JWT_EXPIRES_IN":       func(c *Config, v string) error { return setDuration(&c.JWT.ExpiresIn, v) },
+	"SECURITY_SECRET_KEY":  func(c *Config, v string) error { c.Security.SecretKey = v; return nil },
+	"DEVICE_SCAN_INTERVAL": func(c *Config, v string) error { return setInt(&c.Device.ScanInterval, v) },
+	"DRPR_INTERVAL":        func(c *Config, v string) error { return setInt(&c.Device.DRPRInterval, v) },
+	"RECONCILE_INTERVAL":   func(c *Config, v string) error { return setInt(&c.Device.ReconcileInterval, v) },
+	"SNAPSHOT_INTERVAL":    func(c *Config, v string) error { return setInt(&c.Device.SnapshotInterval, v) },
+	"SNAPSHOT_RETENTION":   func(c *Config, v string) error { return setInt(&c.Device.SnapshotRetention, v) },
+	"INVENTORY_INTERVAL":   func(c *Config, v string) error { return setInt(&c.Device.InventoryInterval, v) },
+	"FIRMWARE_DIR":         func(c *Config, v string) error { c.Firmware.Dir = v; return nil },
+	"FIRMWARE_MAX_SIZE_MB": func(c *Config, v string) error { return setInt(&c.Firmware.MaxSizeMB, v) },
+	"SIMULATOR_ENABLED":    func(c *Config, v string) error { return setBool(&c.Simulator.Enabled, v) },
+	"SIMULATOR_SCENARIO":   func(c *Config, v string) error { c.Simulator.Scenario = v; return nil },
+}
+
+// applyEnv overrides fields from NETMANAGER_* (or unprefixed) environment variables.
+func applyEnv(cfg *Config) error {
+	for name, set := range envOverrides {
+		value, ok := os.LookupEnv("NETMANAGER_" + name)
+		if !ok {
+			value, ok = os.LookupEnv(name)
+		}
+		if !ok {
+			continue
+		}
+		if err := set(cfg, value); err != nil {
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// UsesDefaultJWTSecret reports whether jwt.secret is still a shipped placeholder.
+func (c *Config) UsesDefaultJWTSecret() bool {
+	return c.JWT.Secret == DefaultJWTSecret || c.JWT.Secret == legacyJWTSecret
+}
+
+// Validate 校验配置
+func (c *Config) Validate() error {
+	var errs []string
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("server.port %d out of range", c.Server.Port))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, "server.shutdown_timeout must be positive")
+	}
+	if c.Database.Type != "sqlite" {
+		errs = append(errs, fmt.Sprintf("database.type %q is not supported", c.Database.Type))
+	}
+	if c.Database.Path == "" {
+		errs = append(errs, "database.path is required")
+	}
+	if c.JWT.Secret == "" {
+		errs = append(errs, "jwt.secret is required")
+	}
+	if c.JWT.ExpiresIn < time.Minute {
+		errs = append(errs, "jwt.expires_in must be at least 1m")
+	}
+	if c.Device.ScanInterval < 1 {
+		errs = append(errs, "device.scan_interval must be at least 1 second")
+	}
+	if c.Device.DRPRInterval < 1 {
+		errs = append(errs, "device.drpr_interval must be at least 1 second")
+	}
+	if c.Device.ReconcileInterval < 1 {
+		errs = append(errs, "device.reconcile_interval must be at least 1 second")
+	}
+	if c.Device.SnapshotInterval < 0 {
+		errs = append(errs, "device.snapshot_interval must not be negative")
+	}
+	if c.Device.SnapshotRetention < 1 {
+		errs = append(errs, "device.snapshot_retention must be at least 1")
+	}
+	if c.Device.InventoryInterval < 0 {
+		errs = append(errs, "device.inventory_interval must not be negative")
+	}
+	if c.Firmware.Dir == "" {
+		errs = append(errs, "firmware.dir is required")
+	}
+	if c.Firmware.MaxSizeMB < 1 {
+		errs = append(errs, "firmware.max_size_mb must be at least 1")
+	}
+	if c.Simulator.Scenario != "" {
+		if _, err := os.Stat(c.Simulator.Scenario); err != nil {
+			errs = append(errs, fmt.Sprintf("simulator.scenario: %v", err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func setInt(dst *int, v string) error {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+func setBool(dst *bool, v string) error {
+	b, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		return err
+	}
+	*dst = b
+	return nil
+}
+
+func setDuration(dst *time.Duration, v string) error {
+	d, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
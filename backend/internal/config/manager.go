@@ -0,0 +1,162 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Manager holds the active configuration and re-applies runtime-safe
+// settings on Reload. Precedence: flags > environment > file > defaults.
+type Manager struct {
+	path  string
+	flags []func(*Config)
+
+	mu      sync.RWMutex
+	current *Config
+	hooks   []func(*Config)
+}
+
+// Load 从命令行参数加载配置（文件 -> 环境变量 -> 命令行）
+func Load(args []string) (*Manager, error) {
+	fs := flag.NewFlagSet("backend", flag.ContinueOnError)
+	path := fs.String("config", DefaultPath, "path to config.yaml")
+	port := fs.Int("port", 0, "HTTP listen port")
+	dbPath := fs.String("db", "", "SQLite database path")
+	jwtSecret := fs.String("jwt-secret", "", "JWT signing secret")
+	jwtExpiry := fs.Duration("jwt-expires-in", 0, "JWT token lifetime")
+	scanInterval := fs.Int("monitor-interval", 0, "device status check interval in seconds")
+	scenario := fs.String("simulator-scenario", "", "simulator scenario YAML")
+	noSimulator := fs.Bool("no-simulator", false, "disable the integrated simulator")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{path: *path}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			m.flags = append(m.flags, func(c *Config) { c.Server.Port = *port })
+		case "db":
+			m.flags = append(m.flags, func(c *Config) { c.Database.Path = *dbPath })
+		case "jwt-secret":
+			m.flags = append(m.flags, func(c *Config) { c.JWT.Secret = *jwtSecret })
+		case "jwt-expires-in":
+			m.flags = append(m.flags, func(c *Config) { c.JWT.ExpiresIn = *jwtExpiry })
+		case "monitor-interval":
+			m.flags = append(m.flags, func(c *Config) { c.Device.ScanInterval = *scanInterval })
+		case "simulator-scenario":
+			m.flags = append(m.flags, func(c *Config) { c.Simulator.Scenario = *scenario })
+		case "no-simulator":
+			m.flags = append(m.flags, func(c *Config) { c.Simulator.Enabled = !*noSimulator })
+		}
+	})
+
+	cfg, err := m.build()
+	if err != nil {
+		return nil, err
+	}
+	m.current = cfg
+	return m, nil
+}
+
+// NewManager wraps an already built configuration (used by tools and tests).
+func NewManager(cfg *Config) *Manager {
+	return &Manager{current: cfg}
+}
+
+func (m *Manager) build() (*Config, error) {
+	cfg := Default()
+	if m.path != "" {
+		var err error
+		if cfg, err = loadFile(m.path); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+	for _, apply := range m.flags {
+		apply(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Get returns the active configuration. Callers must not modify it.
+func (m *Manager) Get() *Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.current
+}
+
+// OnReload registers fn to run with the new configuration after each reload.
+func (m *Manager) OnReload(fn func(*Config)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, fn)
+}
+
+// Reload re-reads the file and environment. Only settings that are safe to
+// change at runtime are taken over; the rest keep their startup values and
+// are reported as requiring a restart.
+func (m *Manager) Reload() error {
+	next, err := m.build()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	prev := m.current
+	applied := *prev
+	applied.JWT.ExpiresIn = next.JWT.ExpiresIn
+	applied.Device.ScanInterval = next.Device.ScanInterval
+	applied.Device.DRPRInterval = next.Device.DRPRInterval
+	applied.Device.ReconcileInterval = next.Device.ReconcileInterval
+	applied.Device.SnapshotInterval = next.Device.SnapshotInterval
+	applied.Device.SnapshotRetention = next.Device.SnapshotRetention
+	applied.Device.InventoryInterval = next.Device.InventoryInterval
+	m.current = &applied
+	hooks := append([]func(*Config){}, m.hooks...)
+	m.mu.Unlock()
+
+	for _, field := range restartRequired(prev, next) {
+		log.Printf("Config reload: %s changed, restart required to apply", field)
+	}
+	for _, fn := range hooks {
+		fn(&applied)
+	}
+	log.Printf("Configuration reloaded (monitor interval %v, DRPR interval %v, JWT expiry %v)",
+		applied.MonitorInterval(), applied.DRPRPollInterval(), applied.JWT.ExpiresIn)
+	return nil
+}
+
+func restartRequired(prev, next *Config) []string {
+	var fields []string
+	if prev.Server != next.Server {
+		fields = append(fields, "server")
+	}
+	if prev.Database != next.Database {
+		fields = append(fields, "database")
+	}
+	if prev.JWT.Secret != next.JWT.Secret {
+		fields = append(fields, "jwt.secret")
+	}
+	if prev.Security != next.Security {
+		fields = append(fields, "security.secret_key")
+	}
+	if prev.Simulator != next.Simulator {
+		fields = append(fields, "simulator")
+	}
+	return fields
+}
+
+// String summarises the settings worth logging at startup (no secrets).
+func (c *Config) String() string {
+	return fmt.Sprintf("addr=%s db=%s jwt_expiry=%v monitor_interval=%v drpr_interval=%v simulator=%v scenario=%q",
+		c.Addr(), c.Database.Path, c.JWT.ExpiresIn, c.MonitorInterval(), c.DRPRPollInterval(),
+		c.Simulator.Enabled, c.Simulator.Scenario)
+}
@@ -10,11 +10,13 @@ import (
 
 var db *gorm.DB
 
-// Init initializes the database connection and performs auto-migration.
+// Init initializes the database connection at path and performs auto-migration.
 // It returns the database instance or an error.
-func Init() (*gorm.DB, error) {
+func Init(path string) (*gorm.DB, error) {
 	var err error
-	db, err = gorm.Open(sqlite.Open("netmanager.db"), &gorm.Config{})
+	// WAL + busy timeout keep concurrent device reports from failing with
+	// "database is locked" under load.
+	db, err = gorm.Open(sqlite.Open(path+"?_journal_mode=WAL&_busy_timeout=5000"), &gorm.Config{})
 	if err != nil {
 		return nil, err
 	}
@@ -35,9 +37,16 @@ func Init() (*gorm.DB, error) {
 		&model.ConfigTemplateChange{}, &model.ConfigTemplateApproval{}, &model.ConfigTemplateReview{},
 		&model.ConfigTemplatePublish{}, &model.ConfigTemplateArchive{}, &model.ConfigTemplateRestore{},
 		&model.ConfigTemplateDelete{}, &model.Topology{}, &model.MonitorData{},
+		&model.MonitorConfig{}, &model.MonitorAlert{},
 		&model.SecurityConfig{}, &model.NetworkConfig{}, &model.WirelessConfig{},
 		&model.SystemConfig{}, &model.UpDownConfig{}, &model.DebugConfig{},
 		&model.DRPRMessage{},
+		&model.DesiredConfig{}, &model.ConfigDrift{}, &model.DriftPolicy{},
+		&model.ConfigPreview{}, &model.Rollout{}, &model.KeyRotation{},
+		&model.MasterSlaveConfig{}, &model.StarHandover{},
+		&model.IPSubnet{}, &model.IPAllocation{}, &model.DeviceOperation{}, &model.RebootJob{},
+		&model.DeviceInventory{}, &model.DeviceInventoryHistory{}, &model.FirmwareBaseline{},
+		&model.FirmwareImage{}, &model.FirmwareUpgrade{},
 	)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	auditService *service.AuditService
+}
+
+func NewAuditHandler(auditService *service.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// ListAudit handles GET /api/config/audit
+// Filters: device_id, user_id, username, category, action, outcome, from, to, limit, offset.
+func (h *AuditHandler) ListAudit(c *gin.Context) {
+	filter, err := auditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if v := c.Query("device_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device_id"})
+			return
+		}
+		filter.DeviceID = uint(id)
+	}
+	h.list(c, filter)
+}
+
+// ListDeviceAudit handles GET /api/devices/:id/audit
+func (h *AuditHandler) ListDeviceAudit(c *gin.Context) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	filter, err := auditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.DeviceID = uint(deviceID)
+	h.list(c, filter)
+}
+
+// ListConfigHistory handles GET /api/devices/:id/config-history
+// Filters: category, key, user_id, from, to, limit, offset.
+func (h *AuditHandler) ListConfigHistory(c *gin.Context) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	base, err := auditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	history, total, err := h.auditService.History(service.HistoryFilter{
+		DeviceID: uint(deviceID),
+		Category: c.Query("category"),
+		Key:      c.Query("key"),
+		UserID:   base.UserID,
+		From:     base.From,
+		To:       base.To,
+		Limit:    base.Limit,
+		Offset:   base.Offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"history": history, "total": total})
+}
+
+func (h *AuditHandler) list(c *gin.Context, filter service.AuditFilter) {
+	entries, total, err := h.auditService.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "total": total})
+}
+
+// auditFilter parses the query parameters shared by the audit endpoints.
+func auditFilter(c *gin.Context) (service.AuditFilter, error) {
+	filter := service.AuditFilter{
+		Username: c.Query("username"),
+		Category: c.Query("category"),
+		Action:   c.Query("action"),
+		Outcome:  c.Query("outcome"),
+	}
+	var err error
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return filter, fmt.Errorf("invalid user_id: %s", v)
+		}
+		filter.UserID = uint(id)
+	}
+	if filter.From, err = parseTimeParam(c.Query("from"), false); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTimeParam(c.Query("to"), true); err != nil {
+		return filter, err
+	}
+	if filter.Limit, err = intParam(c, "limit"); err != nil {
+		return filter, err
+	}
+	if filter.Offset, err = intParam(c, "offset"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parseTimeParam accepts RFC3339 or a date; a date used as the upper bound
+// covers the whole day.
+func parseTimeParam(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use RFC3339 or YYYY-MM-DD", value)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+func intParam(c *gin.Context, name string) (int, error) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: %s", name, v)
+	}
+	return n, nil
+}
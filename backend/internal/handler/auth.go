@@ -1,18 +1,17 @@
 package handler
 
 import (
-	"backend/internal/middleware"
 	"backend/internal/model"
 	"backend/internal/service"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
@@ -74,15 +73,8 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Generate token directly
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
-
-	// Sign token with secret key
-	tokenString, err := token.SignedString([]byte(middleware.JWTSecret))
+	// Generate token with the configured secret and lifetime
+	tokenString, err := h.authService.IssueUserToken(user.ID, user.Username)
 	if err != nil {
 		log.Printf("Token generation error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Registration successful but failed to generate token"})
@@ -95,6 +87,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
+			"role":     user.Role,
 		},
 	})
 }
@@ -134,11 +127,18 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
+			"role":     user.Role,
 		},
 	})
 }
 
+// DeleteUser handles DELETE /api/auth/users/:username; only admins may delete
+// users and the last admin cannot be deleted.
 func (h *AuthHandler) DeleteUser(c *gin.Context) {
+	if userRole(c) != model.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can delete users"})
+		return
+	}
 	username := c.Param("username")
 	if username == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Username is required"})
@@ -146,13 +146,56 @@ func (h *AuthHandler) DeleteUser(c *gin.Context) {
 	}
 
 	if err := h.authService.DeleteUser(username); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, service.ErrLastAdmin):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		}
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
+// SetUserRole handles PUT /api/auth/users/:username/role
+// Body: {"role": "admin"}; only admins may change roles.
+func (h *AuthHandler) SetUserRole(c *gin.Context) {
+	if userRole(c) != model.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change user roles"})
+		return
+	}
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := h.authService.SetRole(c.Param("username"), req.Role)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": gin.H{"id": user.ID, "username": user.Username, "role": user.Role}})
+}
+
+// userRole 当前请求用户的角色
+func userRole(c *gin.Context) string {
+	if user, ok := c.Get("user"); ok {
+		if u, ok := user.(model.User); ok {
+			return u.Role
+		}
+	}
+	return ""
+}
+
 // ValidateToken 验证token有效性
 func (h *AuthHandler) ValidateToken(c *gin.Context) {
 	// 如果请求能到达这里，说明token已经通过了AuthMiddleware的验证
@@ -169,6 +212,7 @@ func (h *AuthHandler) ValidateToken(c *gin.Context) {
 		"user": gin.H{
 			"id":       userModel.ID,
 			"username": userModel.Username,
+			"role":     userModel.Role,
 		},
 	})
 }
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ComplianceHandler struct {
+	complianceService *service.MeshComplianceService
+}
+
+func NewComplianceHandler(complianceService *service.MeshComplianceService) *ComplianceHandler {
+	return &ComplianceHandler{
+		complianceService: complianceService,
+	}
+}
+
+// CheckMesh handles GET /api/compliance/mesh?device_ids=1,2,3
+// Reads the access password, ciphering, TDD, band and sub-band configuration
+// from every device (all mesh boards when device_ids is omitted), groups the
+// devices by value and lists the outliers.
+func (h *ComplianceHandler) CheckMesh(c *gin.Context) {
+	deviceIDs, err := parseIDList(c.Query("device_ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	report, err := h.complianceService.Check(deviceIDs)
+	if err != nil {
+		writeComplianceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// AlignMesh handles POST /api/compliance/mesh/align
+// Body: {"device_ids": [1,2,3], "params": ["ciphering"], "reference_device_id": 1, "reboot": true}.
+// Without reference_device_id every device is aligned to the majority value;
+// without params every inconsistent parameter is aligned. dry_run=true only
+// returns the commands each device would receive. "reboot": true needs the admin role.
+func (h *ComplianceHandler) AlignMesh(c *gin.Context) {
+	var req service.AlignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.DryRun = req.DryRun || isDryRun(c)
+	if req.Reboot && !req.DryRun && !requireRebootRole(c) {
+		return
+	}
+	result, err := h.complianceService.Align(req, auditActor(c))
+	if err != nil {
+		writeComplianceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// parseIDList 解析以逗号分隔的ID列表，空字符串返回nil
+func parseIDList(value string) ([]uint, error) {
+	var ids []uint
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, errors.New("Invalid device ID: " + part)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+func writeComplianceError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrComplianceInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
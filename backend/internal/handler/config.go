@@ -4,6 +4,7 @@ import (
 	"backend/internal/model"
 	"backend/internal/service"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,15 +12,20 @@ import (
 	"log"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type ConfigHandler struct {
-	configService *service.ConfigService
+	configService  *service.ConfigService
+	previewService *service.ConfigPreviewService
+	ipamService    *service.IPAMService
 }
 
-func NewConfigHandler(configService *service.ConfigService) *ConfigHandler {
+func NewConfigHandler(configService *service.ConfigService, previewService *service.ConfigPreviewService, ipamService *service.IPAMService) *ConfigHandler {
 	return &ConfigHandler{
-		configService: configService,
+		configService:  configService,
+		previewService: previewService,
+		ipamService:    ipamService,
 	}
 }
 
@@ -75,7 +81,11 @@ func (h *ConfigHandler) SaveDeviceConfigs(c *gin.Context) {
 		return
 	}
 
-	if err := h.configService.SaveDeviceConfigs(uint(deviceID), category, configs); err != nil {
+	if h.previewOrValidate(c, uint(deviceID), category, configs) {
+		return
+	}
+
+	if err := h.configService.SaveDeviceConfigs(auditActor(c), uint(deviceID), category, configs); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -91,6 +101,9 @@ func (h *ConfigHandler) ValidateConfig(c *gin.Context) {
 	}
 
 	if err := h.configService.ValidateConfig(config); err != nil {
+		if respondValidationError(c, err) {
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -157,10 +170,20 @@ func (h *ConfigHandler) UpdateNetworkConfig(c *gin.Context) {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IP address format"})
 				return
 			}
+			// 检查与其他设备的地址冲突及所属子网
+			mask, _ := config["subnet_mask"].(string)
+			if err := h.ipamService.ValidateAddress(uint(deviceID), ipStr, mask); err != nil {
+				writeIPAMError(c, err)
+				return
+			}
 		}
 	}
 
-	if err := h.configService.SaveDeviceConfigs(uint(deviceID), "net_setting", config); err != nil {
+	if h.previewOrValidate(c, uint(deviceID), "net_setting", config) {
+		return
+	}
+
+	if err := h.configService.SaveDeviceConfigs(auditActor(c), uint(deviceID), "net_setting", config); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -216,7 +239,11 @@ func (h *ConfigHandler) UpdateSecurityConfig(c *gin.Context) {
 		return
 	}
 
-	if err := h.configService.SaveDeviceConfigs(uint(deviceID), "security", configs); err != nil {
+	if h.previewOrValidate(c, uint(deviceID), "security", configs) {
+		return
+	}
+
+	if err := h.configService.SaveDeviceConfigs(auditActor(c), uint(deviceID), "security", configs); err != nil {
 		log.Printf("Error updating security config: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -330,7 +357,11 @@ func (h *ConfigHandler) UpdateWirelessConfig(c *gin.Context) {
 		return
 	}
 
-	if err := h.configService.SaveDeviceConfigs(uint(deviceID), "wireless", config); err != nil {
+	if h.previewOrValidate(c, uint(deviceID), "wireless", config) {
+		return
+	}
+
+	if err := h.configService.SaveDeviceConfigs(auditActor(c), uint(deviceID), "wireless", config); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -368,7 +399,11 @@ func (h *ConfigHandler) UpdateSystemConfig(c *gin.Context) {
 		return
 	}
 
-	if err := h.configService.SaveDeviceConfigs(uint(deviceID), "system", config); err != nil {
+	if h.previewOrValidate(c, uint(deviceID), "system", config) {
+		return
+	}
+
+	if err := h.configService.SaveDeviceConfigs(auditActor(c), uint(deviceID), "system", config); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -409,7 +444,11 @@ func (h *ConfigHandler) UpdateUpDownConfig(c *gin.Context) {
 
 	log.Printf("Updating UP-DOWN config for device %d: %+v", deviceID, config)
 
-	if err := h.configService.SaveDeviceConfigs(uint(deviceID), "up_down", config); err != nil {
+	if h.previewOrValidate(c, uint(deviceID), "up_down", config) {
+		return
+	}
+
+	if err := h.configService.SaveDeviceConfigs(auditActor(c), uint(deviceID), "up_down", config); err != nil {
 		log.Printf("Error updating UP-DOWN config: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -452,7 +491,11 @@ func (h *ConfigHandler) UpdateDebugConfig(c *gin.Context) {
 		return
 	}
 
-	if err := h.configService.SaveDeviceConfigs(uint(deviceID), "debug", config); err != nil {
+	if h.previewOrValidate(c, uint(deviceID), "debug", config) {
+		return
+	}
+
+	if err := h.configService.SaveDeviceConfigs(auditActor(c), uint(deviceID), "debug", config); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -517,10 +560,106 @@ func (h *ConfigHandler) UpdateDeviceTypeConfig(c *gin.Context) {
 
 	log.Printf("Updating device type config for device %d: %+v", deviceID, config)
 
-	if err := h.configService.SaveDeviceConfigs(uint(deviceID), "device_type", config); err != nil {
+	if h.previewOrValidate(c, uint(deviceID), "device_type", config) {
+		return
+	}
+
+	if err := h.configService.SaveDeviceConfigs(auditActor(c), uint(deviceID), "device_type", config); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Device type configuration updated successfully"})
 }
+
+// previewOrValidate handles ?dry_run=true by returning a preview of the
+// change, and rejects changes whose commands fail board validation. It
+// reports whether a response has been written.
+func (h *ConfigHandler) previewOrValidate(c *gin.Context, deviceID uint, category string, configs map[string]interface{}) bool {
+	plan, err := h.previewService.PlanConfig(deviceID, category, configs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return true
+	}
+	if isDryRun(c) {
+		respondPreview(c, h.previewService, plan)
+		return true
+	}
+	if !plan.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Configuration failed board validation", "errors": plan.Errors, "field_errors": plan.FieldErrors})
+		return true
+	}
+	return false
+}
+
+// GetPreview handles GET /api/config/previews/:id
+func (h *ConfigHandler) GetPreview(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid preview ID"})
+		return
+	}
+	preview, err := h.previewService.GetPreview(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Preview not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, preview)
+}
+
+// ApplyPreview handles POST /api/config/previews/:id/apply
+// It sends exactly the commands that were previewed.
+func (h *ConfigHandler) ApplyPreview(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid preview ID"})
+		return
+	}
+	result, err := h.previewService.ApplyPreview(uint(id), auditActor(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Preview not found"})
+		case errors.Is(err, service.ErrPreviewUnavailable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if !result.Success {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error, "result": result})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Preview applied successfully", "result": result})
+}
+
+// isDryRun reports whether the request asks for a preview only (?dry_run=true).
+func isDryRun(c *gin.Context) bool {
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	return dryRun
+}
+
+// respondValidationError 参数校验失败时返回400和逐字段的错误，其他错误返回false由调用方处理
+func respondValidationError(c *gin.Context, err error) bool {
+	fieldErrs, ok := service.AsValidationErrors(err)
+	if !ok {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field_errors": fieldErrs})
+	return true
+}
+
+// respondPreview 保存预览并返回，之后可以通过预览ID执行
+func respondPreview(c *gin.Context, previewService *service.ConfigPreviewService, plan *service.ConfigPlan) {
+	preview, err := previewService.CreatePreview(plan, currentUsername(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dry_run": true, "preview": preview})
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DesiredConfigHandler struct {
+	reconciler *service.ConfigReconciler
+}
+
+func NewDesiredConfigHandler(reconciler *service.ConfigReconciler) *DesiredConfigHandler {
+	return &DesiredConfigHandler{
+		reconciler: reconciler,
+	}
+}
+
+// GetDesiredConfig handles GET /api/devices/:id/desired-config
+func (h *DesiredConfigHandler) GetDesiredConfig(c *gin.Context) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	doc, err := h.reconciler.GetDesiredConfig(uint(deviceID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"device_id": deviceID, "desired": doc})
+}
+
+// SetDesiredConfig handles PUT /api/devices/:id/desired-config/:category
+// The body is a key/value object that replaces the category's desired values.
+func (h *DesiredConfigHandler) SetDesiredConfig(c *gin.Context) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	var values map[string]interface{}
+	if err := c.ShouldBindJSON(&values); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.reconciler.SetDesiredConfig(uint(deviceID), c.Param("category"), values, currentUsername(c)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Desired configuration saved successfully"})
+}
+
+// DeleteDesiredConfig handles DELETE /api/devices/:id/desired-config/:category
+func (h *DesiredConfigHandler) DeleteDesiredConfig(c *gin.Context) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	if err := h.reconciler.DeleteDesiredConfig(uint(deviceID), c.Param("category")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Desired configuration deleted successfully"})
+}
+
+// GetDrift handles GET /api/devices/:id/drift?status=drifted
+func (h *DesiredConfigHandler) GetDrift(c *gin.Context) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	drifts, err := h.reconciler.GetDrift(uint(deviceID), c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"device_id": deviceID, "drifts": drifts})
+}
+
+// ReconcileDevice handles POST /api/devices/:id/reconcile
+func (h *DesiredConfigHandler) ReconcileDevice(c *gin.Context) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	result, err := h.reconciler.ReconcileDevice(uint(deviceID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// ListDrift handles GET /api/config/drift
+func (h *DesiredConfigHandler) ListDrift(c *gin.Context) {
+	drifts, err := h.reconciler.ListDrift()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"drifts": drifts, "total": len(drifts)})
+}
+
+// GetDriftPolicies handles GET /api/config/drift-policies
+func (h *DesiredConfigHandler) GetDriftPolicies(c *gin.Context) {
+	policies, err := h.reconciler.GetPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policies": policies})
+}
+
+// SetDriftPolicy handles PUT /api/config/drift-policies/:category
+func (h *DesiredConfigHandler) SetDriftPolicy(c *gin.Context) {
+	var req struct {
+		Mode string `json:"mode" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.reconciler.SetPolicy(c.Param("category"), req.Mode); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Drift policy updated successfully"})
+}
+
+// currentUsername returns the authenticated user's name, or "" if unknown.
+func currentUsername(c *gin.Context) string {
+	if user, ok := c.Get("user"); ok {
+		if u, ok := user.(model.User); ok {
+			return u.Username
+		}
+	}
+	return ""
+}
+
+// auditActor returns the authenticated user and client IP for the audit trail.
+func auditActor(c *gin.Context) service.AuditActor {
+	actor := service.AuditActor{SourceIP: c.ClientIP()}
+	if user, ok := c.Get("user"); ok {
+		if u, ok := user.(model.User); ok {
+			actor.UserID = u.ID
+			actor.Username = u.Username
+		}
+	}
+	return actor
+}
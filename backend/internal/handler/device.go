@@ -5,6 +5,7 @@ import (
 	"backend/internal/service"
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -25,6 +26,13 @@ type DeviceHandler struct {
 	configService      *service.ConfigService
 	topologyService    *service.TopologyService    // Add TopologyService
 	drprMonitorService *service.DRPRMonitorService // Add DRPRMonitorService
+	changeSetExecutor  *service.ChangeSetExecutor
+	previewService     *service.ConfigPreviewService
+	auditService       *service.AuditService
+	ipamService        *service.IPAMService
+	operationService   *service.DeviceOperationService
+	rebootJobService   *service.RebootJobService
+	inventoryService   *service.InventoryService
 }
 
 func NewDeviceHandler(
@@ -33,6 +41,13 @@ func NewDeviceHandler(
 	configService *service.ConfigService,
 	topologyService *service.TopologyService, // Add TopologyService to parameters
 	drprMonitorService *service.DRPRMonitorService, // Add DRPRMonitorService to parameters
+	changeSetExecutor *service.ChangeSetExecutor,
+	previewService *service.ConfigPreviewService,
+	auditService *service.AuditService,
+	ipamService *service.IPAMService,
+	operationService *service.DeviceOperationService,
+	rebootJobService *service.RebootJobService,
+	inventoryService *service.InventoryService,
 ) *DeviceHandler {
 	return &DeviceHandler{
 		deviceService:      deviceService,
@@ -40,6 +55,13 @@ func NewDeviceHandler(
 		configService:      configService,
 		topologyService:    topologyService,    // Initialize TopologyService
 		drprMonitorService: drprMonitorService, // Initialize DRPRMonitorService
+		changeSetExecutor:  changeSetExecutor,
+		previewService:     previewService,
+		auditService:       auditService,
+		ipamService:        ipamService,
+		operationService:   operationService,
+		rebootJobService:   rebootJobService,
+		inventoryService:   inventoryService,
 	}
 }
 
@@ -52,6 +74,7 @@ type CreateDeviceRequest struct {
 	IP          string `json:"ip"`
 	Location    string `json:"location"`
 	Description string `json:"description"`
+	SubnetID    uint   `json:"subnet_id"` // 从该子网自动分配节点地址
 }
 
 // UpdateDeviceRequest 更新设备请求
@@ -79,6 +102,14 @@ func (h *DeviceHandler) CreateDevice(c *gin.Context) {
 		return
 	}
 
+	// 先确认子网还有空闲地址，避免创建设备后分配失败
+	if req.SubnetID != 0 {
+		if _, err := h.ipamService.NextAddress(req.SubnetID); err != nil {
+			writeIPAMError(c, err)
+			return
+		}
+	}
+
 	// Create new device
 	device := &model.Device{
 		NodeID:      req.NodeID,
@@ -107,6 +138,19 @@ func (h *DeviceHandler) CreateDevice(c *gin.Context) {
 	}
 	h.deviceService.CreateDeviceLog(log)
 
+	if req.SubnetID != 0 {
+		assignment, err := h.ipamService.Onboard(auditActor(c), device.ID, req.SubnetID)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"message": "Device created, address allocation failed", "device": device, "address_error": err.Error()})
+			return
+		}
+		if updated, err := h.deviceService.GetDeviceByID(device.ID); err == nil {
+			device = updated
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Device created successfully", "device": device, "address": assignment})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Device created successfully", "device": device})
 }
 
@@ -302,8 +346,20 @@ func (h *DeviceHandler) SendATCommand(c *gin.Context) {
 		return
 	}
 
+	// 重启、恢复出厂设置、关机等危险命令需要确认
+	destructive, err := h.operationService.Classify(device.ID, "", req.Command)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if destructive != nil {
+		runDestructive(c, h.operationService, destructive)
+		return
+	}
+
 	// 发送AT命令
 	response, err := h.deviceCommService.SendATCommand(uint(id), req.Command)
+	h.auditService.RecordCommand(auditActor(c), device.ID, "", req.Command, response, err)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -346,9 +402,26 @@ func (h *DeviceHandler) SendATCommandByName(c *gin.Context) {
 		return
 	}
 
+	command, _ := h.deviceCommService.FormatCommandByName(device.ID, req.CommandName, req.Params)
+	if command != "" {
+		destructive, err := h.operationService.Classify(device.ID, req.CommandName, command)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if destructive != nil {
+			runDestructive(c, h.operationService, destructive)
+			return
+		}
+	}
+
 	// 发送AT命令
 	response, err := h.deviceCommService.SendATCommandByName(uint(id), req.CommandName, req.Params)
+	h.auditService.RecordCommand(auditActor(c), device.ID, req.CommandName, command, response, err)
 	if err != nil {
+		if respondValidationError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -406,6 +479,10 @@ func (h *DeviceHandler) SyncDeviceConfig(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// 同步时一并更新设备清单（版本信息）
+	if _, err := h.inventoryService.Collect(device.ID, model.InventorySourceSync); err != nil {
+		fmt.Printf("[SyncDeviceConfig] Inventory collection failed for device %d: %v\n", device.ID, err)
+	}
 
 	// 记录操作日志
 	log := &model.DeviceLog{
@@ -466,7 +543,8 @@ func (h *DeviceHandler) SyncDeviceConfigByType(c *gin.Context) {
 	})
 }
 
-// RebootDevice 重启设备
+// RebootDevice 重启设备：作为重启作业执行，等待设备重新应答AT并检查版本、接入状态、邻居和无线参数
+// 可选请求体: {"post_checks": ["firmware"], "timeout": 300, "check_timeout": 120}
 func (h *DeviceHandler) RebootDevice(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
@@ -482,26 +560,19 @@ func (h *DeviceHandler) RebootDevice(c *gin.Context) {
 		return
 	}
 
-	// 发送重启命令
-	response, err := h.deviceCommService.SendATCommandByName(uint(id), "reboot_device", nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to reboot device: %v", err)})
-		return
+	var req service.RebootJobRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 	}
-
-	// 记录操作日志
-	log := &model.DeviceLog{
-		DeviceID:  device.ID,
-		Type:      "reboot",
-		Message:   "Device reboot command sent successfully",
-		CreatedAt: time.Now(),
+	if timeout, err := strconv.Atoi(c.Query("timeout")); err == nil {
+		req.Timeout = timeout
 	}
-	h.deviceService.CreateDeviceLog(log)
-
-	c.JSON(http.StatusOK, gin.H{
-		"message":  "Device reboot command sent successfully",
-		"response": response,
-	})
+	req.RootDeviceID, req.DeviceIDs, req.MaxDown = 0, []uint{device.ID}, 0
+	req.DryRun = req.DryRun || isDryRun(c)
+	startRebootJob(c, h.rebootJobService, h.operationService, req)
 }
 
 // LoginDevice 登录设备
@@ -583,7 +654,8 @@ func (h *DeviceHandler) SetKey(c *gin.Context) {
 	}
 	// 发送AT指令
 	atCmd := "AT^KEY=" + key
-	_, err = h.deviceCommService.SendATCommand(device.ID, atCmd)
+	response, err := h.deviceCommService.SendATCommand(device.ID, atCmd)
+	h.auditService.RecordCommand(auditActor(c), device.ID, "set_key", atCmd, response, err)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send AT command: " + err.Error()})
 		return
@@ -654,50 +726,13 @@ func (h *DeviceHandler) SetFrequencyBand(c *gin.Context) {
 		return
 	}
 
-	// 根据AT^DAOCNDI指令文档，将频段转换为十六进制位图
-	// Bit0: 800M频段, Bit2: 1.4G频段, Bit3: 2.4G频段
-	var bandBitmap int = 0
-	for _, band := range req.Bands {
-		switch band {
-		case "800M":
-			bandBitmap |= 1 << 0 // Bit0 = 1
-		case "1.4G":
-			bandBitmap |= 1 << 2 // Bit2 = 4
-		case "2.4G":
-			bandBitmap |= 1 << 3 // Bit3 = 8
-		}
-	}
-
-	// 验证位图值是否在合理范围内 (0-15，因为只有4个bit位)
-	if bandBitmap < 0 || bandBitmap > 15 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid band bitmap value: %d (0x%X). Must be between 0-15.", bandBitmap, bandBitmap)})
-		return
-	}
-
-	// 发送AT指令设置频段 - 使用十六进制字符串格式（不带引号），符合AT指令文档要求
-	atCmd := fmt.Sprintf("AT^DAOCNDI=%02X", bandBitmap)
-	response, err := h.deviceCommService.SendATCommand(device.ID, atCmd)
+	command, err := service.FrequencyBandCommand(req.Bands)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send AT command"})
-		return
-	}
-
-	// 检查AT指令响应
-	if strings.Contains(response, "ERROR") {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set frequency band"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// 保存配置到数据库
-	wirelessConfigs := map[string]interface{}{
-		"frequency_band": req.Bands,
-	}
-
-	err = h.configService.SaveDeviceConfigs(uint(id), "wireless", wirelessConfigs)
-	if err != nil {
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Frequency band set successfully"})
+	h.runWirelessPlan(c, device.ID, "frequency_band", []service.PlannedCommand{command},
+		map[string]interface{}{"frequency_band": req.Bands}, "Frequency band set successfully")
 }
 
 // SetBandwidth 设置带宽
@@ -721,73 +756,36 @@ func (h *DeviceHandler) SetBandwidth(c *gin.Context) {
 		return
 	}
 
-	// 将带宽字符串转换为AT指令中的数值
-	var bandwidthValue int
-	switch req.Bandwidth {
-	case "1.4M":
-		bandwidthValue = 0
-	case "3M":
-		bandwidthValue = 1
-	case "5M":
-		bandwidthValue = 2
-	case "10M":
-		bandwidthValue = 3
-	case "20M":
-		bandwidthValue = 5
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bandwidth value"})
+	bandwidthValue, err := service.BandwidthValue(req.Bandwidth)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 先读取当前频点和功率
-	getParamsResp, err := h.deviceCommService.SendATCommand(device.ID, "AT^DRPC?")
+	// 先读取当前频点和功率；预览时不访问设备，使用数据库中保存的值
 	var currentFreq, currentPower string
-	if err == nil && strings.Contains(getParamsResp, "^DRPC:") {
-		parts := strings.Split(getParamsResp, "^DRPC:")
-		if len(parts) > 1 {
-			value := strings.TrimSpace(parts[1])
-			value = strings.Split(value, "\r")[0]
-			value = strings.Split(value, "\n")[0]
-			values := strings.Split(value, ",")
-			if len(values) >= 3 {
-				currentFreq = strings.TrimSpace(values[0])
-				currentPower = strings.Trim(strings.TrimSpace(values[2]), "\"")
-			}
-		}
+	var notes []string
+	if isDryRun(c) {
+		currentFreq, currentPower = h.configService.StoredRadioParams(device.ID)
+		notes = append(notes, "frequency and power are taken from the stored configuration, the device was not queried")
+	} else {
+		currentFreq, _, currentPower = h.deviceCommService.ReadRadioParams(device.ID)
 	}
 	if currentFreq == "" {
-		currentFreq = "24020" // 默认频点
+		currentFreq = service.DefaultRadioFrequency
 	}
 	if currentPower == "" {
-		currentPower = "27" // 默认功率
-	}
-
-	// 发送AT指令设置带宽 (使用AT^DRPS存储到NVRAM)
-	atCmdStore := fmt.Sprintf("AT^DRPS=%s,%d,\"%s\"", currentFreq, bandwidthValue, currentPower)
-	_, err = h.deviceCommService.SendATCommand(device.ID, atCmdStore)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send AT^DRPS command"})
-		return
+		currentPower = service.DefaultRadioPower
 	}
-
-	// 同时发送AT^DRPC实时生效
-	atCmdActive := fmt.Sprintf("AT^DRPC=%s,%d,\"%s\"", currentFreq, bandwidthValue, currentPower)
-	_, err = h.deviceCommService.SendATCommand(device.ID, atCmdActive)
+	freq, err := strconv.Atoi(currentFreq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send AT^DRPC command"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Invalid current frequency: %s", currentFreq)})
 		return
 	}
 
-	// 保存配置到数据库
-	wirelessConfigs := map[string]interface{}{
-		"bandwidth": req.Bandwidth,
-	}
-
-	err = h.configService.SaveDeviceConfigs(uint(id), "wireless", wirelessConfigs)
-	if err != nil {
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Bandwidth set successfully"})
+	// 任一步失败都恢复AT^DRPS和AT^DRPC的原值
+	h.runWirelessPlan(c, device.ID, "bandwidth", service.RadioParamsCommands(freq, bandwidthValue, currentPower),
+		map[string]interface{}{"bandwidth": req.Bandwidth}, "Bandwidth set successfully", notes...)
 }
 
 // SetBuildingChain 设置建链频率点
@@ -812,87 +810,13 @@ func (h *DeviceHandler) SetBuildingChain(c *gin.Context) {
 		return
 	}
 
-	if req.FrequencyPoint == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Frequency point cannot be empty"})
-		return
-	}
-
-	// 解析用户输入的频点范围，格式如 "24015-24814,8060-8259,14279-14478"
-	// 根据AT^DSONSBR指令文档，需要为每个频段设置对应的band编号
-	frequencyRanges := strings.Split(req.FrequencyPoint, ",")
-	var atCmdParts []string
-
-	for _, rangeStr := range frequencyRanges {
-		rangeStr = strings.TrimSpace(rangeStr)
-		if rangeStr == "" {
-			continue
-		}
-
-		// 解析频点范围，格式如 "24015-24814"
-		parts := strings.Split(rangeStr, "-")
-		if len(parts) != 2 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid frequency range format. Expected format: start-end"})
-			return
-		}
-
-		startFreq, err := strconv.Atoi(strings.TrimSpace(parts[0]))
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start frequency"})
-			return
-		}
-
-		endFreq, err := strconv.Atoi(strings.TrimSpace(parts[1]))
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end frequency"})
-			return
-		}
-
-		// 根据频点范围确定band编号
-		var band int
-		switch {
-		case startFreq >= 24015 && endFreq <= 24814:
-			band = 64 // BAND64
-		case startFreq >= 8060 && endFreq <= 8259:
-			band = 65 // BAND65
-		case startFreq >= 14279 && endFreq <= 14478:
-			band = 66 // BAND66
-		case startFreq >= 17850 && endFreq <= 18049:
-			band = 67 // BAND67
-		case startFreq >= 51500 && endFreq <= 58499:
-			band = 69 // BAND69
-		case startFreq >= 5000 && endFreq <= 6999:
-			band = 71 // BAND71
-		default:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Frequency range not supported"})
-			return
-		}
-
-		atCmdParts = append(atCmdParts, fmt.Sprintf("%d,%d,%d", band, startFreq, endFreq))
-	}
-
-	if len(atCmdParts) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid frequency ranges provided"})
-		return
-	}
-
-	// 发送AT指令设置建链频率点
-	atCmd := fmt.Sprintf("AT^DSONSBR=%s", strings.Join(atCmdParts, ","))
-	_, err = h.deviceCommService.SendATCommand(device.ID, atCmd)
+	command, err := service.BuildingChainCommand(req.FrequencyPoint)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send AT command"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// 保存配置到数据库
-	wirelessConfigs := map[string]interface{}{
-		"building_chain": req.FrequencyPoint,
-	}
-
-	err = h.configService.SaveDeviceConfigs(uint(id), "wireless", wirelessConfigs)
-	if err != nil {
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Building chain set successfully"})
+	h.runWirelessPlan(c, device.ID, "building_chain", []service.PlannedCommand{command},
+		map[string]interface{}{"building_chain": req.FrequencyPoint}, "Building chain set successfully")
 }
 
 // SetFrequencyHopping 设置跳频
@@ -916,29 +840,56 @@ func (h *DeviceHandler) SetFrequencyHopping(c *gin.Context) {
 		return
 	}
 
-	// 发送AT指令设置跳频 (使用AT^DFHC)
-	var atCmd string
-	if req.Enabled {
-		atCmd = "AT^DFHC=1"
-	} else {
-		atCmd = "AT^DFHC=0"
-	}
-	_, err = h.deviceCommService.SendATCommand(device.ID, atCmd)
+	h.runWirelessPlan(c, device.ID, "frequency_hopping", []service.PlannedCommand{service.FrequencyHoppingCommand(req.Enabled)},
+		map[string]interface{}{"frequency_hopping": req.Enabled}, "Frequency hopping set successfully")
+}
+
+// runWirelessPlan 渲染无线设置命令；dry_run时只返回预览，否则以变更集方式下发并保存配置。
+// notes are extra warnings shown with the plan.
+func (h *DeviceHandler) runWirelessPlan(c *gin.Context, deviceID uint, target string, planned []service.PlannedCommand, values map[string]interface{}, message string, notes ...string) {
+	plan, err := h.previewService.PlanWireless(deviceID, target, planned, values)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send AT command"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	plan.Warnings = append(plan.Warnings, notes...)
+	if isDryRun(c) {
+		respondPreview(c, h.previewService, plan)
+		return
+	}
+	if !plan.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Command failed board validation", "errors": plan.Errors, "field_errors": plan.FieldErrors})
+		return
+	}
+
+	details := "wireless setter " + target
+	result, ok := h.applyChangeSet(c, deviceID, plan.Steps(), values, details)
+	if !ok {
 		return
 	}
 
 	// 保存配置到数据库
-	wirelessConfigs := map[string]interface{}{
-		"frequency_hopping": req.Enabled,
+	if err := h.configService.SaveAppliedConfigs(auditActor(c), deviceID, "wireless", values, service.ChangeSetCommands(result), details); err != nil {
+		log.Printf("Failed to save %s for device %d: %v", target, deviceID, err)
 	}
 
-	err = h.configService.SaveDeviceConfigs(uint(id), "wireless", wirelessConfigs)
+	c.JSON(http.StatusOK, gin.H{"message": message, "result": result, "warnings": plan.Warnings})
+}
+
+// applyChangeSet 以变更集方式下发设置命令，失败时记入审计并写出包含每一步结果的错误响应
+func (h *DeviceHandler) applyChangeSet(c *gin.Context, deviceID uint, steps []service.ChangeStep, values map[string]interface{}, details string) (*service.ChangeSetResult, bool) {
+	result, err := h.changeSetExecutor.Apply(deviceID, steps)
 	if err != nil {
+		h.configService.RecordFailedChange(auditActor(c), deviceID, "wireless", values, nil, err, details)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
 	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Frequency hopping set successfully"})
+	if !result.Success {
+		h.configService.RecordFailedChange(auditActor(c), deviceID, "wireless", values, service.ChangeSetCommands(result), errors.New(result.Error), details)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error, "result": result})
+		return nil, false
+	}
+	return result, true
 }
 
 // SetDrprReporting 设置DRPR Reporting状态
@@ -1058,7 +1009,7 @@ func (h *DeviceHandler) SetDrprReporting(c *gin.Context) {
 		"drpr_reporting": status,
 	}
 
-	err = h.configService.SaveDeviceConfigs(uint(deviceID), "debug", debugConfigs)
+	err = h.configService.SaveDeviceConfigs(auditActor(c), uint(deviceID), "debug", debugConfigs)
 	if err != nil {
 		// 记录错误但不影响主流程
 		fmt.Printf("Failed to save debug configs: %v\n", err)
@@ -1227,26 +1178,29 @@ func (h *DeviceHandler) SetDebugSwitch(c *gin.Context) {
 		atCommand = "AT^DEBUG=0" // 停止Debug Switch
 	}
 
-	// 发送AT命令到设备
-	result, err := h.deviceCommService.SendATCommand(uint(deviceID), atCommand)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to send AT command: %v", err)})
-		return
-	}
-
-	// 更新数据库中的DebugConfig
+	// 更新DebugConfig表中的debug_switch字段
 	status := "inactive"
 	if req.Enabled {
 		status = "active"
 	}
-
-	// 更新DebugConfig表中的debug_switch字段
 	debugConfigs := map[string]interface{}{
 		"debug_switch": status,
 	}
 
-	err = h.configService.SaveDeviceConfigs(uint(deviceID), "debug", debugConfigs)
+	// 发送AT命令到设备
+	result, err := h.deviceCommService.SendATCommand(uint(deviceID), atCommand)
 	if err != nil {
+		failed := []model.AuditCommand{{Name: "debug_switch", Command: atCommand, Status: service.StepFailed, Error: err.Error()}}
+		h.configService.RecordFailedChange(auditActor(c), uint(deviceID), "debug", debugConfigs, failed, err, "")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to send AT command: %v", err)})
+		return
+	}
+
+	// 更新数据库中的DebugConfig
+
+	applied := []model.AuditCommand{{Name: "debug_switch", Command: atCommand, Status: service.StepApplied, Response: result}}
+	if err := h.configService.SaveAppliedConfigs(auditActor(c), uint(deviceID), "debug", debugConfigs, applied, ""); err != nil {
+		log.Printf("Failed to save debug configs: %v", err)
 	}
 
 	// 记录日志
@@ -1433,6 +1387,42 @@ func (h *DeviceHandler) GetDRPRMessages(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"messages": messages})
 }
 
+// ReportDRPR 接收外部推送的DRPR上报（仿真器/代理），按行解析并入库
+func (h *DeviceHandler) ReportDRPR(c *gin.Context) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	processed := 0
+	var failures []string
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "^DRPR:") && !strings.HasPrefix(line, "^DRPRI:") && !strings.HasPrefix(line, "^DAPRI:") {
+			continue
+		}
+		if err := h.drprMonitorService.ProcessDRPRMessage(uint(deviceID), line); err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		processed++
+	}
+
+	if processed == 0 && len(failures) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid DRPR messages", "failures": failures})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"processed": processed, "failures": failures})
+}
+
 // GetDRPRMonitoringStatus 获取DRPR监控状态
 func (h *DeviceHandler) GetDRPRMonitoringStatus(c *gin.Context) {
 	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type DeviceOperationHandler struct {
+	operationService *service.DeviceOperationService
+}
+
+func NewDeviceOperationHandler(operationService *service.DeviceOperationService) *DeviceOperationHandler {
+	return &DeviceOperationHandler{
+		operationService: operationService,
+	}
+}
+
+// requireRebootRole 会重启设备的流程（带重启的分批变更、主从切换、密钥切换等）只允许管理员发起
+func requireRebootRole(c *gin.Context) bool {
+	if userRole(c) == model.RoleAdmin {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": service.ErrDestructiveForbidden.Error(), "kind": service.DestructiveReboot})
+	return false
+}
+
+// ListDeviceOperations handles GET /api/devices/:id/operations
+func (h *DeviceOperationHandler) ListDeviceOperations(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	ops, err := h.operationService.List(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"operations": ops, "total": len(ops)})
+}
+
+// GetDeviceOperation handles GET /api/device-operations/:id
+func (h *DeviceOperationHandler) GetDeviceOperation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid operation ID"})
+		return
+	}
+	op, err := h.operationService.Get(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Operation not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, op)
+}
+
+// runDestructive sends a destructive command through the confirmation flow.
+// The first request returns 428 with a one-time token; repeating the request
+// with the token in the X-Confirmation-Token header runs it. ?timeout= sets
+// how many seconds to wait for the device to come back.
+func runDestructive(c *gin.Context, operationService *service.DeviceOperationService, cmd *service.DestructiveCommand) {
+	timeout, _ := strconv.Atoi(c.Query("timeout"))
+	op, err := operationService.Run(auditActor(c), userRole(c), cmd, c.GetHeader(service.ConfirmationHeader), timeout)
+	switch {
+	case errors.Is(err, service.ErrDestructiveForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "kind": cmd.Kind, "command": cmd.Command})
+	case errors.Is(err, service.ErrConfirmationRequired):
+		c.JSON(http.StatusPreconditionRequired, gin.H{
+			"error":        err.Error(),
+			"confirmation": cmd,
+			"message":      "Repeat the request with the token in the " + service.ConfirmationHeader + " header to confirm",
+		})
+	case errors.Is(err, service.ErrDeviceOperationFailed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "operation": op})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	case cmd.Kind == service.DestructiveShutdown:
+		c.JSON(http.StatusOK, gin.H{"message": "shutdown command sent", "operation": op})
+	default:
+		c.JSON(http.StatusAccepted, gin.H{"message": cmd.Kind + " command sent, tracking the device", "operation": op})
+	}
+}
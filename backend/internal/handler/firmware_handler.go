@@ -0,0 +1,270 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type FirmwareHandler struct {
+	firmwareService  *service.FirmwareService
+	upgradeService   *service.FirmwareUpgradeService
+	operationService *service.DeviceOperationService
+}
+
+func NewFirmwareHandler(firmwareService *service.FirmwareService, upgradeService *service.FirmwareUpgradeService, operationService *service.DeviceOperationService) *FirmwareHandler {
+	return &FirmwareHandler{
+		firmwareService:  firmwareService,
+		upgradeService:   upgradeService,
+		operationService: operationService,
+	}
+}
+
+// UploadFirmware handles POST /api/firmware
+// Multipart form: file=<image>, board_type, version, checksum (SHA-256 hex), notes.
+func (h *FirmwareHandler) UploadFirmware(c *gin.Context) {
+	// 表单字段和multipart开销留出1MB余量，超出部分由服务按镜像大小拒绝
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.firmwareService.MaxSize()+1<<20)
+	file, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "the image is larger than the configured firmware.max_size_mb"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "firmware file is required"})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	image, err := h.firmwareService.Upload(service.FirmwareUpload{
+		BoardType: c.PostForm("board_type"),
+		Version:   c.PostForm("version"),
+		Checksum:  c.PostForm("checksum"),
+		Notes:     c.PostForm("notes"),
+		FileName:  file.Filename,
+	}, f, currentUsername(c))
+	if err != nil {
+		writeFirmwareError(c, err, "Firmware image not found")
+		return
+	}
+	c.JSON(http.StatusCreated, image)
+}
+
+// ListFirmware handles GET /api/firmware?board_type=
+func (h *FirmwareHandler) ListFirmware(c *gin.Context) {
+	images, err := h.firmwareService.List(c.Query("board_type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"images": images, "total": len(images)})
+}
+
+// GetFirmware handles GET /api/firmware/:id
+func (h *FirmwareHandler) GetFirmware(c *gin.Context) {
+	id, ok := firmwareID(c, "Invalid firmware image ID")
+	if !ok {
+		return
+	}
+	image, err := h.firmwareService.Get(id)
+	if err != nil {
+		writeFirmwareError(c, err, "Firmware image not found")
+		return
+	}
+	c.JSON(http.StatusOK, image)
+}
+
+// DeleteFirmware handles DELETE /api/firmware/:id
+func (h *FirmwareHandler) DeleteFirmware(c *gin.Context) {
+	id, ok := firmwareID(c, "Invalid firmware image ID")
+	if !ok {
+		return
+	}
+	if err := h.firmwareService.Delete(id); err != nil {
+		writeFirmwareError(c, err, "Firmware image not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Firmware image deleted"})
+}
+
+// CreateFirmwareUpgrade handles POST /api/firmware-upgrades
+// Body: {"image_id": 1, "groups": [[2], [3,4,5]], "failure_threshold": 1, "upload_timeout": 600, "timeout": 300}
+// or {"image_id": 1, "device_ids": [2,3,4,5], "group_size": 2}. dry_run=true returns the planned groups.
+// Like any reboot it needs the admin role and a confirmation token (X-Confirmation-Token).
+func (h *FirmwareHandler) CreateFirmwareUpgrade(c *gin.Context) {
+	var req service.FirmwareUpgradeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.DryRun = req.DryRun || isDryRun(c)
+	h.startUpgrade(c, req)
+}
+
+// ListFirmwareUpgrades handles GET /api/firmware-upgrades?device_id=
+func (h *FirmwareHandler) ListFirmwareUpgrades(c *gin.Context) {
+	var deviceID uint64
+	if v := c.Query("device_id"); v != "" {
+		var err error
+		if deviceID, err = strconv.ParseUint(v, 10, 32); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+			return
+		}
+	}
+	jobs, err := h.upgradeService.List(uint(deviceID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"upgrades": jobs, "total": len(jobs)})
+}
+
+// GetFirmwareUpgrade handles GET /api/firmware-upgrades/:id
+func (h *FirmwareHandler) GetFirmwareUpgrade(c *gin.Context) {
+	id, ok := firmwareID(c, "Invalid firmware upgrade ID")
+	if !ok {
+		return
+	}
+	job, err := h.upgradeService.Get(id)
+	if err != nil {
+		writeFirmwareError(c, err, "Firmware upgrade not found")
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// AbortFirmwareUpgrade handles POST /api/firmware-upgrades/:id/abort
+// Uploads in progress are cancelled; later groups are not upgraded.
+func (h *FirmwareHandler) AbortFirmwareUpgrade(c *gin.Context) {
+	id, ok := firmwareID(c, "Invalid firmware upgrade ID")
+	if !ok {
+		return
+	}
+	if err := h.upgradeService.Abort(id); err != nil {
+		writeFirmwareError(c, err, "Firmware upgrade not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Firmware upgrade aborted"})
+}
+
+// CheckFirmwareUpdate handles GET /api/devices/:id/firmware/update
+func (h *FirmwareHandler) CheckFirmwareUpdate(c *gin.Context) {
+	id, ok := firmwareID(c, "Invalid device ID")
+	if !ok {
+		return
+	}
+	info, err := h.upgradeService.CheckUpdate(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// UpgradeDeviceFirmware handles POST /api/devices/:id/firmware/upgrade
+// Optional body: {"image_id": 3, "timeout": 300}; without image_id the image
+// offered by CheckFirmwareUpdate is used.
+func (h *FirmwareHandler) UpgradeDeviceFirmware(c *gin.Context) {
+	id, ok := firmwareID(c, "Invalid device ID")
+	if !ok {
+		return
+	}
+	var req service.FirmwareUpgradeRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.ImageID == 0 {
+		info, err := h.upgradeService.CheckUpdate(id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+				return
+			}
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		if !info.Available {
+			c.JSON(http.StatusConflict, gin.H{"error": "No firmware update available", "update": info})
+			return
+		}
+		req.ImageID = info.ImageID
+	}
+	req.DeviceIDs, req.Groups = []uint{id}, nil
+	req.DryRun = req.DryRun || isDryRun(c)
+	h.startUpgrade(c, req)
+}
+
+// startUpgrade plans the upgrade, asks for confirmation and starts it.
+func (h *FirmwareHandler) startUpgrade(c *gin.Context, req service.FirmwareUpgradeRequest) {
+	job, err := h.upgradeService.Plan(req)
+	if err != nil {
+		writeFirmwareError(c, err, "Firmware upgrade not found")
+		return
+	}
+	if req.DryRun {
+		c.JSON(http.StatusOK, gin.H{"dry_run": true, "upgrade": job})
+		return
+	}
+
+	cmd := h.upgradeService.Confirmation(job)
+	err = h.operationService.Authorize(auditActor(c), userRole(c), cmd, c.GetHeader(service.ConfirmationHeader))
+	switch {
+	case errors.Is(err, service.ErrDestructiveForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "kind": cmd.Kind, "command": cmd.Command})
+		return
+	case errors.Is(err, service.ErrConfirmationRequired):
+		c.JSON(http.StatusPreconditionRequired, gin.H{
+			"error":        err.Error(),
+			"confirmation": cmd,
+			"upgrade":      job,
+			"message":      "Repeat the request with the token in the " + service.ConfirmationHeader + " header to confirm",
+		})
+		return
+	}
+
+	job, err = h.upgradeService.Run(job, auditActor(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+func firmwareID(c *gin.Context, invalid string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalid})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func writeFirmwareError(c *gin.Context, err error, notFound string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	case errors.Is(err, service.ErrFirmwareInvalid), errors.Is(err, service.ErrFirmwareUpgradeInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrFirmwareExists), errors.Is(err, service.ErrFirmwareInUse), errors.Is(err, service.ErrFirmwareUpgradeNotRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
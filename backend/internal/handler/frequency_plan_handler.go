@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FrequencyPlanHandler struct {
+	planService *service.FrequencyPlanService
+}
+
+func NewFrequencyPlanHandler(planService *service.FrequencyPlanService) *FrequencyPlanHandler {
+	return &FrequencyPlanHandler{
+		planService: planService,
+	}
+}
+
+// PlanFrequencies handles POST /api/frequency-plans
+// Body: {"networks": [{"name": "north", "device_ids": [1,2], "bandwidth": "10M"}, {"name": "south", "device_ids": [3]}],
+// "exclusions": [{"start": 14300, "end": 14320, "label": "neighbor"}], "guard": 5, "set_sub_bands": true,
+// "avoid_interference": true}.
+// Returns the current conflicts and the proposed channels without changing any device.
+func (h *FrequencyPlanHandler) PlanFrequencies(c *gin.Context) {
+	var req service.FrequencyPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	plan, err := h.planService.Plan(req)
+	if err != nil {
+		writeFrequencyPlanError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+// ApplyFrequencyPlan handles POST /api/frequency-plans/apply
+// Same body as PlanFrequencies. Every network that changes is moved by a staged
+// rollout; networks whose new channel is still occupied are deferred.
+func (h *FrequencyPlanHandler) ApplyFrequencyPlan(c *gin.Context) {
+	var req service.FrequencyPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := h.planService.Apply(req, auditActor(c))
+	if err != nil {
+		if errors.Is(err, service.ErrFrequencyPlanInfeasible) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "plan": result.Plan})
+			return
+		}
+		writeFrequencyPlanError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, result)
+}
+
+func writeFrequencyPlanError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrFrequencyPlanInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type InventoryHandler struct {
+	inventoryService *service.InventoryService
+}
+
+func NewInventoryHandler(inventoryService *service.InventoryService) *InventoryHandler {
+	return &InventoryHandler{
+		inventoryService: inventoryService,
+	}
+}
+
+// ListInventory handles GET /api/inventory?board_type=&hardware_model=&firmware_version=&serial_number=
+// e.g. firmware_version=2.0.3 lists every device running that version.
+func (h *InventoryHandler) ListInventory(c *gin.Context) {
+	entries, err := h.inventoryService.List(service.InventoryFilter{
+		BoardType:       c.Query("board_type"),
+		HardwareModel:   c.Query("hardware_model"),
+		FirmwareVersion: c.Query("firmware_version"),
+		SerialNumber:    c.Query("serial_number"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"devices": entries, "total": len(entries)})
+}
+
+// GetVersionDistribution handles GET /api/inventory/versions?board_type=
+func (h *InventoryHandler) GetVersionDistribution(c *gin.Context) {
+	dist, err := h.inventoryService.Distribution(c.Query("board_type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, dist)
+}
+
+// ScanInventory handles POST /api/inventory/scan
+// Collects the version information of every online device.
+func (h *InventoryHandler) ScanInventory(c *gin.Context) {
+	collected, err := h.inventoryService.Scan(model.InventorySourceCollect)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"collected": collected, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"collected": collected})
+}
+
+// GetDeviceInventory handles GET /api/devices/:id/inventory
+func (h *InventoryHandler) GetDeviceInventory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	inv, err := h.inventoryService.Get(uint(id))
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	history, err := h.inventoryService.History(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"inventory": inv, "history": history})
+}
+
+// CollectDeviceInventory handles POST /api/devices/:id/inventory/collect
+func (h *InventoryHandler) CollectDeviceInventory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	inv, err := h.inventoryService.Collect(uint(id), model.InventorySourceCollect)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, inv)
+}
+
+// ListFirmwareAlerts handles GET /api/inventory/alerts?status=active
+func (h *InventoryHandler) ListFirmwareAlerts(c *gin.Context) {
+	alerts, err := h.inventoryService.Alerts(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"alerts": alerts, "total": len(alerts)})
+}
+
+// ListBaselines handles GET /api/inventory/baselines
+func (h *InventoryHandler) ListBaselines(c *gin.Context) {
+	baselines, err := h.inventoryService.ListBaselines()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"baselines": baselines, "total": len(baselines)})
+}
+
+// SetBaseline handles PUT /api/inventory/baselines/:board_type
+// Body: {"firmware_version": "2.0.3", "notes": "approved 2026-10"}
+func (h *InventoryHandler) SetBaseline(c *gin.Context) {
+	var req service.BaselineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	baseline, err := h.inventoryService.SetBaseline(c.Param("board_type"), req, auditActor(c).Username)
+	if err != nil {
+		if errors.Is(err, service.ErrInventoryInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, baseline)
+}
+
+// DeleteBaseline handles DELETE /api/inventory/baselines/:board_type
+func (h *InventoryHandler) DeleteBaseline(c *gin.Context) {
+	if err := h.inventoryService.DeleteBaseline(c.Param("board_type")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Baseline not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Baseline deleted"})
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type IPAMHandler struct {
+	ipamService *service.IPAMService
+}
+
+func NewIPAMHandler(ipamService *service.IPAMService) *IPAMHandler {
+	return &IPAMHandler{
+		ipamService: ipamService,
+	}
+}
+
+// ListSubnets handles GET /api/ipam/subnets
+func (h *IPAMHandler) ListSubnets(c *gin.Context) {
+	subnets, err := h.ipamService.ListSubnets()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"subnets": subnets, "total": len(subnets)})
+}
+
+// GetSubnet handles GET /api/ipam/subnets/:id
+func (h *IPAMHandler) GetSubnet(c *gin.Context) {
+	id, ok := ipamID(c, "Invalid subnet ID")
+	if !ok {
+		return
+	}
+	subnet, err := h.ipamService.GetSubnet(id)
+	if err != nil {
+		writeIPAMError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, subnet)
+}
+
+// CreateSubnet handles POST /api/ipam/subnets
+// Body: {"name": "mesh-a", "cidr": "10.10.0.0/24", "gateway": "10.10.0.1",
+// "range_start": "10.10.0.10", "range_end": "10.10.0.200", "reserved": ["10.10.0.100"], "device_ids": [1,2,3]}
+func (h *IPAMHandler) CreateSubnet(c *gin.Context) {
+	var req service.IPSubnetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	subnet, err := h.ipamService.CreateSubnet(req)
+	if err != nil {
+		writeIPAMError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, subnet)
+}
+
+// UpdateSubnet handles PUT /api/ipam/subnets/:id
+func (h *IPAMHandler) UpdateSubnet(c *gin.Context) {
+	id, ok := ipamID(c, "Invalid subnet ID")
+	if !ok {
+		return
+	}
+	var req service.IPSubnetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	subnet, err := h.ipamService.UpdateSubnet(id, req)
+	if err != nil {
+		writeIPAMError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, subnet)
+}
+
+// DeleteSubnet handles DELETE /api/ipam/subnets/:id
+func (h *IPAMHandler) DeleteSubnet(c *gin.Context) {
+	id, ok := ipamID(c, "Invalid subnet ID")
+	if !ok {
+		return
+	}
+	if err := h.ipamService.DeleteSubnet(id); err != nil {
+		writeIPAMError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Subnet deleted"})
+}
+
+// AssignAddress handles POST /api/ipam/devices/:id/assign
+// Body: {"subnet_id": 1, "ip": "10.10.0.20"}; both are optional. Writes the address
+// with AT^NETIFCFG, keeps the device's management address in sync and confirms it
+// with AT^DUIP?. dry_run=true returns the address and commands without sending them.
+func (h *IPAMHandler) AssignAddress(c *gin.Context) {
+	id, ok := ipamID(c, "Invalid device ID")
+	if !ok {
+		return
+	}
+	var req service.IPAssignRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	req.DryRun = req.DryRun || isDryRun(c)
+	result, err := h.ipamService.Assign(auditActor(c), id, req)
+	if err != nil {
+		writeIPAMError(c, err)
+		return
+	}
+	if result.Error != "" {
+		c.JSON(http.StatusBadGateway, result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetConflicts handles GET /api/ipam/conflicts?live=true
+// live=true also reads AT^DUIP? from every device.
+func (h *IPAMHandler) GetConflicts(c *gin.Context) {
+	report, err := h.ipamService.Scan(c.Query("live") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func ipamID(c *gin.Context, message string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func writeIPAMError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	case errors.Is(err, service.ErrIPAMInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrIPAMConflict), errors.Is(err, service.ErrIPAMExhausted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
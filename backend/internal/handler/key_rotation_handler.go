@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type KeyRotationHandler struct {
+	keyRotationService *service.KeyRotationService
+}
+
+func NewKeyRotationHandler(keyRotationService *service.KeyRotationService) *KeyRotationHandler {
+	return &KeyRotationHandler{
+		keyRotationService: keyRotationService,
+	}
+}
+
+// CreateKeyRotation handles POST /api/key-rotations
+// Body: {"root_device_id": 1, "device_ids": [1,2,3], "key_bytes": 16, "algorithm": 2,
+// "switch_at": "2026-01-01T02:00:00Z", "window_minutes": 60, "rejoin_timeout": 180}.
+// A generated password is returned only in this response; dry_run=true checks that
+// the devices share one password and returns the reboot order. The switchover
+// reboots every device, so rotations, switchovers and rollbacks need the admin role.
+func (h *KeyRotationHandler) CreateKeyRotation(c *gin.Context) {
+	var req service.KeyRotationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.DryRun = req.DryRun || isDryRun(c)
+	if !req.DryRun && !requireRebootRole(c) {
+		return
+	}
+	created, err := h.keyRotationService.Create(req, auditActor(c))
+	if err != nil {
+		writeKeyRotationError(c, err)
+		return
+	}
+	if req.DryRun {
+		c.JSON(http.StatusOK, gin.H{"dry_run": true, "rotation": created.Rotation})
+		return
+	}
+	c.JSON(http.StatusAccepted, created)
+}
+
+// ListKeyRotations handles GET /api/key-rotations
+func (h *KeyRotationHandler) ListKeyRotations(c *gin.Context) {
+	rotations, err := h.keyRotationService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rotations": rotations, "total": len(rotations)})
+}
+
+// GetKeyRotation handles GET /api/key-rotations/:id
+func (h *KeyRotationHandler) GetKeyRotation(c *gin.Context) {
+	id, ok := keyRotationID(c)
+	if !ok {
+		return
+	}
+	rotation, err := h.keyRotationService.Get(id)
+	if err != nil {
+		writeKeyRotationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rotation)
+}
+
+// SwitchKeyRotation handles POST /api/key-rotations/:id/switch
+// Starts the switchover of a staged rotation without waiting for switch_at.
+func (h *KeyRotationHandler) SwitchKeyRotation(c *gin.Context) {
+	id, ok := keyRotationID(c)
+	if !ok || !requireRebootRole(c) {
+		return
+	}
+	if err := h.keyRotationService.SwitchNow(id); err != nil {
+		writeKeyRotationError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Switchover requested"})
+}
+
+// CancelKeyRotation handles POST /api/key-rotations/:id/cancel
+// Only a staged rotation can be cancelled; the previous value is restored on every device.
+func (h *KeyRotationHandler) CancelKeyRotation(c *gin.Context) {
+	id, ok := keyRotationID(c)
+	if !ok {
+		return
+	}
+	if err := h.keyRotationService.Cancel(id); err != nil {
+		writeKeyRotationError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Cancel requested; the previous value will be restored"})
+}
+
+// RollbackKeyRotation handles POST /api/key-rotations/:id/rollback
+// Restores the previous value of a completed or interrupted rotation and reboots the devices.
+func (h *KeyRotationHandler) RollbackKeyRotation(c *gin.Context) {
+	id, ok := keyRotationID(c)
+	if !ok || !requireRebootRole(c) {
+		return
+	}
+	rotation, err := h.keyRotationService.Rollback(id, auditActor(c))
+	if err != nil {
+		writeKeyRotationError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, rotation)
+}
+
+func keyRotationID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key rotation ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func writeKeyRotationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Key rotation not found"})
+	case errors.Is(err, service.ErrKeyRotationInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrKeyRotationState), errors.Is(err, service.ErrSecretKeyUnset):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
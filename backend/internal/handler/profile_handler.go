@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ProfileHandler struct {
+	profileService *service.ConfigProfileService
+}
+
+func NewProfileHandler(profileService *service.ConfigProfileService) *ProfileHandler {
+	return &ProfileHandler{
+		profileService: profileService,
+	}
+}
+
+// CreateProfile handles POST /api/config/profiles
+func (h *ProfileHandler) CreateProfile(c *gin.Context) {
+	var def service.ProfileDefinition
+	if err := c.ShouldBindJSON(&def); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	profile, err := h.profileService.CreateProfile(def, currentUsername(c))
+	if err != nil {
+		writeProfileError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, profile)
+}
+
+// ListProfiles handles GET /api/config/profiles
+func (h *ProfileHandler) ListProfiles(c *gin.Context) {
+	profiles, err := h.profileService.ListProfiles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"profiles": profiles, "total": len(profiles)})
+}
+
+// GetProfile handles GET /api/config/profiles/:id
+func (h *ProfileHandler) GetProfile(c *gin.Context) {
+	id, ok := profileID(c)
+	if !ok {
+		return
+	}
+	profile, versions, err := h.profileService.GetProfile(id)
+	if err != nil {
+		writeProfileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"profile": profile, "versions": versions})
+}
+
+// DeleteProfile handles DELETE /api/config/profiles/:id
+func (h *ProfileHandler) DeleteProfile(c *gin.Context) {
+	id, ok := profileID(c)
+	if !ok {
+		return
+	}
+	if err := h.profileService.DeleteProfile(id); err != nil {
+		writeProfileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Profile deleted successfully"})
+}
+
+// CreateVersion handles POST /api/config/profiles/:id/versions
+func (h *ProfileHandler) CreateVersion(c *gin.Context) {
+	id, ok := profileID(c)
+	if !ok {
+		return
+	}
+	var def service.ProfileDefinition
+	if err := c.ShouldBindJSON(&def); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	version, err := h.profileService.CreateVersion(id, def, currentUsername(c))
+	if err != nil {
+		writeProfileError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, version)
+}
+
+// GetVersion handles GET /api/config/profiles/:id/versions/:version
+func (h *ProfileHandler) GetVersion(c *gin.Context) {
+	id, ok := profileID(c)
+	if !ok {
+		return
+	}
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil || number <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+	version, err := h.profileService.GetVersion(id, number)
+	if err != nil {
+		writeProfileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, version)
+}
+
+// ApplyProfile handles POST /api/config/profiles/:id/apply
+// Body: {"version": 2, "device_ids": [1,2], "variables": {...}, "device_variables": {"1": {...}}}.
+// version 0 applies the latest version; dry_run=true renders the commands
+// without sending them.
+func (h *ProfileHandler) ApplyProfile(c *gin.Context) {
+	id, ok := profileID(c)
+	if !ok {
+		return
+	}
+	var req service.ProfileApplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.DryRun = req.DryRun || isDryRun(c)
+	result, err := h.profileService.Apply(id, req, auditActor(c))
+	if err != nil {
+		writeProfileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// ListProfileDevices handles GET /api/config/profiles/:id/devices?lagging=true
+func (h *ProfileHandler) ListProfileDevices(c *gin.Context) {
+	id, ok := profileID(c)
+	if !ok {
+		return
+	}
+	laggingOnly, _ := strconv.ParseBool(c.Query("lagging"))
+	devices, err := h.profileService.DeviceStatus(id, laggingOnly)
+	if err != nil {
+		writeProfileError(c, err)
+		return
+	}
+	lagging := 0
+	for _, d := range devices {
+		if d.Lagging {
+			lagging++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"devices": devices, "total": len(devices), "lagging": lagging})
+}
+
+// ListProfileUsages handles GET /api/config/profiles/:id/usages?limit=50
+func (h *ProfileHandler) ListProfileUsages(c *gin.Context) {
+	id, ok := profileID(c)
+	if !ok {
+		return
+	}
+	limit, err := intParam(c, "limit")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	usages, err := h.profileService.ListUsages(id, limit)
+	if err != nil {
+		writeProfileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"usages": usages, "total": len(usages)})
+}
+
+// GetDeviceProfile handles GET /api/devices/:id/profile
+func (h *ProfileHandler) GetDeviceProfile(c *gin.Context) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	status, err := h.profileService.DeviceProfile(uint(deviceID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No profile has been applied to this device"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+func profileID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid profile ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func writeProfileError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+	case errors.Is(err, service.ErrProfileInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RebootJobHandler struct {
+	rebootJobService *service.RebootJobService
+	operationService *service.DeviceOperationService
+}
+
+func NewRebootJobHandler(rebootJobService *service.RebootJobService, operationService *service.DeviceOperationService) *RebootJobHandler {
+	return &RebootJobHandler{
+		rebootJobService: rebootJobService,
+		operationService: operationService,
+	}
+}
+
+// CreateRebootJob handles POST /api/reboot-jobs
+// Body: {"root_device_id": 1, "device_ids": [2,3,4], "max_down": 2, "post_checks": ["firmware","neighbors"],
+// "timeout": 300, "check_timeout": 120, "refresh_topology": true}. dry_run=true returns the planned waves.
+// Like any reboot it needs the admin role and a confirmation token (X-Confirmation-Token).
+func (h *RebootJobHandler) CreateRebootJob(c *gin.Context) {
+	var req service.RebootJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.DryRun = req.DryRun || isDryRun(c)
+	startRebootJob(c, h.rebootJobService, h.operationService, req)
+}
+
+// ListRebootJobs handles GET /api/reboot-jobs?device_id=
+func (h *RebootJobHandler) ListRebootJobs(c *gin.Context) {
+	var deviceID uint64
+	if v := c.Query("device_id"); v != "" {
+		var err error
+		if deviceID, err = strconv.ParseUint(v, 10, 32); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+			return
+		}
+	}
+	jobs, err := h.rebootJobService.List(uint(deviceID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs, "total": len(jobs)})
+}
+
+// GetRebootJob handles GET /api/reboot-jobs/:id
+func (h *RebootJobHandler) GetRebootJob(c *gin.Context) {
+	id, ok := rebootJobID(c)
+	if !ok {
+		return
+	}
+	job, err := h.rebootJobService.Get(id)
+	if err != nil {
+		writeRebootJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// AbortRebootJob handles POST /api/reboot-jobs/:id/abort
+// Devices already rebooting are not waited for; later waves are not rebooted.
+func (h *RebootJobHandler) AbortRebootJob(c *gin.Context) {
+	id, ok := rebootJobID(c)
+	if !ok {
+		return
+	}
+	if err := h.rebootJobService.Abort(id); err != nil {
+		writeRebootJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Reboot job aborted"})
+}
+
+// startRebootJob plans the job, asks for confirmation and starts it.
+func startRebootJob(c *gin.Context, rebootJobService *service.RebootJobService, operationService *service.DeviceOperationService, req service.RebootJobRequest) {
+	job, err := rebootJobService.Plan(req)
+	if err != nil {
+		writeRebootJobError(c, err)
+		return
+	}
+	if req.DryRun {
+		c.JSON(http.StatusOK, gin.H{"dry_run": true, "job": job})
+		return
+	}
+
+	cmd := rebootJobService.Confirmation(job)
+	err = operationService.Authorize(auditActor(c), userRole(c), cmd, c.GetHeader(service.ConfirmationHeader))
+	switch {
+	case errors.Is(err, service.ErrDestructiveForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "kind": cmd.Kind, "command": cmd.Command})
+		return
+	case errors.Is(err, service.ErrConfirmationRequired):
+		c.JSON(http.StatusPreconditionRequired, gin.H{
+			"error":        err.Error(),
+			"confirmation": cmd,
+			"job":          job,
+			"message":      "Repeat the request with the token in the " + service.ConfirmationHeader + " header to confirm",
+		})
+		return
+	}
+
+	job, err = rebootJobService.Run(job, auditActor(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+func rebootJobID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reboot job ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func writeRebootJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reboot job not found"})
+	case errors.Is(err, service.ErrRebootJobInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRebootJobNotRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
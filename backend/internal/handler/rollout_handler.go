@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RolloutHandler struct {
+	rolloutService *service.RolloutService
+}
+
+func NewRolloutHandler(rolloutService *service.RolloutService) *RolloutHandler {
+	return &RolloutHandler{
+		rolloutService: rolloutService,
+	}
+}
+
+// CreateRollout handles POST /api/rollouts
+// Body: {"root_device_id": 1, "device_ids": [1,2,3], "change": {"frequency": 24100, "bandwidth": "10M"},
+// "wave_size": 2, "rejoin_timeout": 180, "settle_time": 10, "refresh_topology": true}.
+// dry_run=true returns the planned waves without changing any device.
+// A rollout with "reboot": true reboots every device and needs the admin role.
+func (h *RolloutHandler) CreateRollout(c *gin.Context) {
+	var req service.RolloutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.DryRun = req.DryRun || isDryRun(c)
+	if req.Reboot && !req.DryRun && !requireRebootRole(c) {
+		return
+	}
+	rollout, err := h.rolloutService.Create(req, auditActor(c))
+	if err != nil {
+		writeRolloutError(c, err)
+		return
+	}
+	if req.DryRun {
+		c.JSON(http.StatusOK, gin.H{"dry_run": true, "rollout": rollout})
+		return
+	}
+	c.JSON(http.StatusAccepted, rollout)
+}
+
+// ListRollouts handles GET /api/rollouts
+func (h *RolloutHandler) ListRollouts(c *gin.Context) {
+	rollouts, err := h.rolloutService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rollouts": rollouts, "total": len(rollouts)})
+}
+
+// GetRollout handles GET /api/rollouts/:id
+func (h *RolloutHandler) GetRollout(c *gin.Context) {
+	id, ok := rolloutID(c)
+	if !ok {
+		return
+	}
+	rollout, err := h.rolloutService.Get(id)
+	if err != nil {
+		writeRolloutError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rollout)
+}
+
+// AbortRollout handles POST /api/rollouts/:id/abort
+// The rollout stops after the current device and every changed device is rolled back.
+func (h *RolloutHandler) AbortRollout(c *gin.Context) {
+	id, ok := rolloutID(c)
+	if !ok {
+		return
+	}
+	if err := h.rolloutService.Abort(id); err != nil {
+		writeRolloutError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Rollout abort requested; changed devices will be rolled back"})
+}
+
+func rolloutID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rollout ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func writeRolloutError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rollout not found"})
+	case errors.Is(err, service.ErrRolloutInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRolloutNotRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
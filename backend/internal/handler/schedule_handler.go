@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ScheduleHandler struct {
+	scheduler *service.ConfigScheduler
+}
+
+func NewScheduleHandler(scheduler *service.ConfigScheduler) *ScheduleHandler {
+	return &ScheduleHandler{
+		scheduler: scheduler,
+	}
+}
+
+// scheduleRequest is the writable part of a schedule.
+type scheduleRequest struct {
+	Name          string                  `json:"name" binding:"required"`
+	Description   string                  `json:"description"`
+	Cron          string                  `json:"cron" binding:"required"`
+	DeviceID      uint                    `json:"device_id"`
+	DeviceIDs     []uint                  `json:"device_ids"`
+	Kind          string                  `json:"kind"`
+	Category      string                  `json:"category"`
+	Configs       map[string]interface{}  `json:"configs"`
+	Commands      []model.ScheduleCommand `json:"commands"`
+	MisfirePolicy string                  `json:"misfire_policy"`
+	MisfireGrace  int                     `json:"misfire_grace"`
+	Paused        bool                    `json:"paused"`
+}
+
+func (r *scheduleRequest) schedule() *model.ConfigSchedule {
+	schedule := &model.ConfigSchedule{
+		Name:          r.Name,
+		Description:   r.Description,
+		Cron:          r.Cron,
+		DeviceID:      r.DeviceID,
+		DeviceIDs:     r.DeviceIDs,
+		Kind:          r.Kind,
+		Category:      r.Category,
+		Configs:       r.Configs,
+		Commands:      r.Commands,
+		MisfirePolicy: r.MisfirePolicy,
+		MisfireGrace:  r.MisfireGrace,
+	}
+	if r.Paused {
+		schedule.Status = model.ScheduleStatusPaused
+	}
+	return schedule
+}
+
+// CreateSchedule handles POST /api/config/schedules
+func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	schedule := req.schedule()
+	if err := h.scheduler.CreateSchedule(schedule, currentUsername(c)); err != nil {
+		writeScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// ListSchedules handles GET /api/config/schedules?device_id=1
+func (h *ScheduleHandler) ListSchedules(c *gin.Context) {
+	var deviceID uint64
+	if v := c.Query("device_id"); v != "" {
+		var err error
+		if deviceID, err = strconv.ParseUint(v, 10, 32); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device_id"})
+			return
+		}
+	}
+	schedules, err := h.scheduler.ListSchedules(uint(deviceID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules, "total": len(schedules)})
+}
+
+// GetSchedule handles GET /api/config/schedules/:id
+func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	schedule, err := h.scheduler.GetSchedule(id)
+	if err != nil {
+		writeScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+// UpdateSchedule handles PUT /api/config/schedules/:id
+func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	schedule, err := h.scheduler.UpdateSchedule(id, req.schedule())
+	if err != nil {
+		writeScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+// DeleteSchedule handles DELETE /api/config/schedules/:id
+func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	if err := h.scheduler.DeleteSchedule(id); err != nil {
+		writeScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted successfully"})
+}
+
+// PauseSchedule handles POST /api/config/schedules/:id/pause
+func (h *ScheduleHandler) PauseSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	schedule, err := h.scheduler.PauseSchedule(id)
+	if err != nil {
+		writeScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+// ResumeSchedule handles POST /api/config/schedules/:id/resume
+func (h *ScheduleHandler) ResumeSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	schedule, err := h.scheduler.ResumeSchedule(id)
+	if err != nil {
+		writeScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+// RunSchedule handles POST /api/config/schedules/:id/run
+func (h *ScheduleHandler) RunSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	runLog, err := h.scheduler.RunNow(id)
+	if err != nil {
+		writeScheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, runLog)
+}
+
+// ListScheduleLogs handles GET /api/config/schedules/:id/logs?limit=50
+func (h *ScheduleHandler) ListScheduleLogs(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	limit, err := intParam(c, "limit")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	logs, err := h.scheduler.ListLogs(id, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"logs": logs, "total": len(logs)})
+}
+
+func scheduleID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func writeScheduleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+	case errors.Is(err, service.ErrScheduleInvalid):
+		if !respondValidationError(c, err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+	case errors.Is(err, service.ErrScheduleRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SnapshotHandler struct {
+	snapshotService *service.ConfigSnapshotService
+}
+
+func NewSnapshotHandler(snapshotService *service.ConfigSnapshotService) *SnapshotHandler {
+	return &SnapshotHandler{
+		snapshotService: snapshotService,
+	}
+}
+
+// CreateSnapshot handles POST /api/devices/:id/snapshots
+func (h *SnapshotHandler) CreateSnapshot(c *gin.Context) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	var req struct {
+		Description string `json:"description"`
+	}
+	// 请求体可以为空
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	snapshot, err := h.snapshotService.TakeSnapshot(uint(deviceID), req.Description, model.SnapshotSourceManual, currentUsername(c))
+	if err != nil {
+		writeSnapshotError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, snapshot)
+}
+
+// ListSnapshots handles GET /api/devices/:id/snapshots
+func (h *SnapshotHandler) ListSnapshots(c *gin.Context) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	snapshots, err := h.snapshotService.ListSnapshots(uint(deviceID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"snapshots": snapshots, "total": len(snapshots)})
+}
+
+// GetSnapshot handles GET /api/snapshots/:id
+func (h *SnapshotHandler) GetSnapshot(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid snapshot ID"})
+		return
+	}
+	snapshot, err := h.snapshotService.GetSnapshot(uint(id))
+	if err != nil {
+		writeSnapshotError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// DeleteSnapshot handles DELETE /api/snapshots/:id
+func (h *SnapshotHandler) DeleteSnapshot(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid snapshot ID"})
+		return
+	}
+	if err := h.snapshotService.DeleteSnapshot(uint(id)); err != nil {
+		writeSnapshotError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Snapshot deleted successfully"})
+}
+
+// DiffSnapshots handles GET /api/snapshots/diff?from=1&to=2
+func (h *SnapshotHandler) DiffSnapshots(c *gin.Context) {
+	fromID, err1 := strconv.ParseUint(c.Query("from"), 10, 32)
+	toID, err2 := strconv.ParseUint(c.Query("to"), 10, 32)
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to snapshot IDs are required"})
+		return
+	}
+	diff, err := h.snapshotService.DiffSnapshots(uint(fromID), uint(toID))
+	if err != nil {
+		writeSnapshotError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+// RestoreSnapshot handles POST /api/snapshots/:id/restore
+// With ?dry_run=true only the ordered restore commands are returned.
+func (h *SnapshotHandler) RestoreSnapshot(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid snapshot ID"})
+		return
+	}
+	h.restore(c, uint(id))
+}
+
+// BackupConfig handles GET /api/devices/:id/config/backup
+// It takes a snapshot and returns it as a downloadable file.
+func (h *SnapshotHandler) BackupConfig(c *gin.Context) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	snapshot, err := h.snapshotService.TakeSnapshot(uint(deviceID), "backup download", model.SnapshotSourceManual, currentUsername(c))
+	if err != nil {
+		writeSnapshotError(c, err)
+		return
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	filename := fmt.Sprintf("device_%d_config_%s.json", deviceID, snapshot.CreatedAt.Format("20060102_150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "application/json", data)
+}
+
+// RestoreConfig handles POST /api/devices/:id/config/restore
+// The multipart field "config" holds a file produced by BackupConfig.
+func (h *SnapshotHandler) RestoreConfig(c *gin.Context) {
+	deviceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	file, err := c.FormFile("config")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "config file is required"})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	var backup model.ConfigBackup
+	if err := json.NewDecoder(io.LimitReader(f, 1<<20)).Decode(&backup); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid backup file: %v", err)})
+		return
+	}
+	if backup.Description == "" {
+		backup.Description = fmt.Sprintf("imported from %s on %s", file.Filename, time.Now().Format(time.RFC3339))
+	}
+	snapshot, err := h.snapshotService.ImportSnapshot(uint(deviceID), &backup, currentUsername(c))
+	if err != nil {
+		writeSnapshotError(c, err)
+		return
+	}
+	h.restore(c, snapshot.ID)
+}
+
+func (h *SnapshotHandler) restore(c *gin.Context, id uint) {
+	if isDryRun(c) {
+		plan, err := h.snapshotService.PlanRestore(id)
+		if err != nil {
+			writeSnapshotError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"dry_run": true, "plan": plan})
+		return
+	}
+
+	result, err := h.snapshotService.Restore(id, auditActor(c))
+	if err != nil {
+		writeSnapshotError(c, err)
+		return
+	}
+	if !result.Success {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error, "result": result})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Configuration restored successfully", "result": result})
+}
+
+func writeSnapshotError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot or device not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
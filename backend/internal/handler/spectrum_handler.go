@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SpectrumHandler struct {
+	surveyService *service.SpectrumSurveyService
+}
+
+func NewSpectrumHandler(surveyService *service.SpectrumSurveyService) *SpectrumHandler {
+	return &SpectrumHandler{
+		surveyService: surveyService,
+	}
+}
+
+// GetSurvey handles GET /api/spectrum/survey?device_ids=1,2&hours=24&margin=6&noise_floor=-100&persistence=0.5
+// Aggregates the collected DRPR/DAPR reports by frequency, hour of day and
+// device, ranks the frequencies by noise and lists the persistent interferers
+// together with the suggested AT^DFHC setting and planning exclusions.
+func (h *SpectrumHandler) GetSurvey(c *gin.Context) {
+	req, err := parseSurveyQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	survey, err := h.surveyService.Survey(req)
+	if err != nil {
+		writeSurveyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, survey)
+}
+
+// ApplyHopping handles POST /api/spectrum/hopping
+// Body: {"device_ids": [1,2], "hours": 24, "enabled": true, "interval": 10}.
+// enabled and interval default to the survey's recommendation; dry_run=true
+// only returns the commands each device would receive.
+func (h *SpectrumHandler) ApplyHopping(c *gin.Context) {
+	var req service.HoppingApplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.DryRun = req.DryRun || isDryRun(c)
+	result, err := h.surveyService.ApplyHopping(req, auditActor(c))
+	if err != nil {
+		writeSurveyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func parseSurveyQuery(c *gin.Context) (service.SpectrumSurveyRequest, error) {
+	var req service.SpectrumSurveyRequest
+	var err error
+	if req.DeviceIDs, err = parseIDList(c.Query("device_ids")); err != nil {
+		return req, err
+	}
+	if v := c.Query("hours"); v != "" {
+		if req.Hours, err = strconv.Atoi(v); err != nil {
+			return req, errors.New("Invalid hours: " + v)
+		}
+	}
+	for name, dst := range map[string]*float64{"margin": &req.Margin, "noise_floor": &req.NoiseFloor, "persistence": &req.Persistence} {
+		if v := c.Query(name); v != "" {
+			if *dst, err = strconv.ParseFloat(v, 64); err != nil {
+				return req, errors.New("Invalid " + name + ": " + v)
+			}
+		}
+	}
+	return req, nil
+}
+
+func writeSurveyError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrSurveyInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
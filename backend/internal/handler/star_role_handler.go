@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"backend/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type StarRoleHandler struct {
+	starRoleService *service.StarRoleService
+}
+
+func NewStarRoleHandler(starRoleService *service.StarRoleService) *StarRoleHandler {
+	return &StarRoleHandler{
+		starRoleService: starRoleService,
+	}
+}
+
+// GetRoles handles GET /api/star/roles?device_ids=1,2,3&refresh_topology=true
+// Reads the configured and active AT^DDTC role of every star board, groups the
+// boards into networks by their neighbor links and reports networks without a
+// master or with several masters.
+func (h *StarRoleHandler) GetRoles(c *gin.Context) {
+	deviceIDs, err := parseIDList(c.Query("device_ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	report, err := h.starRoleService.Roles(deviceIDs, c.Query("refresh_topology") == "true")
+	if err != nil {
+		writeStarRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// Handover handles POST /api/star/handover
+// Body: {"to_device_id": 5, "slave_max_tx_power": "23,20", "rejoin_timeout": 180, "settle_time": 10}.
+// The current master becomes a slave, the new master gets the slave max tx
+// power limits, both reboot and every slave must re-attach to the new master.
+// dry_run=true returns the planned commands without changing any device.
+// The handover reboots devices and needs the admin role.
+func (h *StarRoleHandler) Handover(c *gin.Context) {
+	var req service.StarHandoverRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.DryRun = req.DryRun || isDryRun(c)
+	if !req.DryRun && !requireRebootRole(c) {
+		return
+	}
+	handover, err := h.starRoleService.Handover(req, auditActor(c))
+	if err != nil {
+		writeStarRoleError(c, err)
+		return
+	}
+	if req.DryRun {
+		c.JSON(http.StatusOK, gin.H{"dry_run": true, "handover": handover})
+		return
+	}
+	c.JSON(http.StatusAccepted, handover)
+}
+
+// ListHandovers handles GET /api/star/handovers
+func (h *StarRoleHandler) ListHandovers(c *gin.Context) {
+	handovers, err := h.starRoleService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"handovers": handovers, "total": len(handovers)})
+}
+
+// GetHandover handles GET /api/star/handovers/:id
+func (h *StarRoleHandler) GetHandover(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid handover ID"})
+		return
+	}
+	handover, err := h.starRoleService.Get(uint(id))
+	if err != nil {
+		writeStarRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, handover)
+}
+
+func writeStarRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Handover not found"})
+	case errors.Is(err, service.ErrStarRoleInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrStarHandoverRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
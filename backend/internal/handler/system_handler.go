@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"backend/internal/model"
+	"backend/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SystemHandler struct {
+	supervisor *service.Supervisor
+	boards     *service.BoardConfigManager
+}
+
+func NewSystemHandler(supervisor *service.Supervisor, boards *service.BoardConfigManager) *SystemHandler {
+	return &SystemHandler{
+		supervisor: supervisor,
+		boards:     boards,
+	}
+}
+
+// GetWorkers handles GET /api/system/workers
+func (h *SystemHandler) GetWorkers(c *gin.Context) {
+	workers := h.supervisor.Statuses()
+	running := 0
+	for _, w := range workers {
+		if w.State == service.WorkerRunning {
+			running++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"workers": workers,
+		"running": running,
+		"total":   len(workers),
+	})
+}
+
+// GetBoards handles GET /api/system/boards
+// Returns the loaded board types and the report of the last load, including
+// malformed or duplicate commands that were skipped.
+func (h *SystemHandler) GetBoards(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"board_types": h.boards.BoardTypes(),
+		"report":      h.boards.Report(),
+	})
+}
+
+// ReloadBoards handles POST /api/system/boards/reload
+// Re-reads every board definition file. A file that no longer parses keeps its
+// previous definition and is reported with kept=true. Board files decide which
+// commands are destructive, so only admins may reload them.
+func (h *SystemHandler) ReloadBoards(c *gin.Context) {
+	if userRole(c) != model.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can reload board definitions"})
+		return
+	}
+	report := h.boards.Reload()
+	c.JSON(http.StatusOK, gin.H{
+		"board_types": h.boards.BoardTypes(),
+		"report":      report,
+	})
+}
@@ -12,16 +12,14 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 )
 
-// JWT 密钥，应该从配置文件加载
-const JWTSecret = "your-secret-key"
-
 type Claims struct {
 	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
 	jwt.RegisteredClaims
 }
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware 校验JWT，secret 来自配置 jwt.secret
+func AuthMiddleware(secret string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -36,7 +34,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		claims := &Claims{}
 
 		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(JWTSecret), nil
+			return []byte(secret), nil
 		})
 
 		if err != nil {
@@ -83,15 +81,15 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
-func GenerateToken(userID uint) (string, error) {
+func GenerateToken(secret string, userID uint, expiration time.Duration) (string, error) {
 	claims := &Claims{
 		UserID: userID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(JWTSecret))
+	return token.SignedString([]byte(secret))
 }
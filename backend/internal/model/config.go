@@ -36,14 +36,17 @@ type DeviceConfig struct {
 
 // ConfigTemplate represents a configuration template
 type ConfigTemplate struct {
-	ID          uint           `gorm:"primarykey" json:"id"`
-	Category    string         `gorm:"index" json:"category"`
-	Name        string         `json:"name"`
-	Description string         `json:"description"`
-	Fields      []ConfigField  `gorm:"-" json:"fields"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            uint           `gorm:"primarykey" json:"id"`
+	Category      string         `gorm:"index" json:"category"`
+	Kind          string         `gorm:"index" json:"kind,omitempty"` // "profile" for configuration profiles, empty for category field lists
+	Name          string         `json:"name"`
+	Description   string         `json:"description"`
+	Fields        []ConfigField  `gorm:"-" json:"fields"`
+	LatestVersion int            `json:"latest_version,omitempty"`
+	CreatedBy     string         `json:"created_by,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // ConfigField represents a configuration field definition
@@ -91,8 +94,10 @@ type ConfigValidation struct {
 
 // NetworkConfig represents network configuration for a device
 type NetworkConfig struct {
-	DeviceID uint   `json:"device_id" gorm:"primaryKey"`
-	IP       string `json:"ip"`
+	DeviceID   uint   `json:"device_id" gorm:"primaryKey"`
+	IP         string `json:"ip"`
+	SubnetMask string `json:"subnet_mask"`
+	Gateway    string `json:"gateway"`
 }
 
 // SecurityConfig represents security configuration for a device
@@ -100,6 +105,8 @@ type SecurityConfig struct {
 	DeviceID            uint   `json:"device_id" gorm:"primaryKey"`
 	EncryptionAlgorithm int    `json:"encryption_algorithm"`
 	EncryptionKey       string `json:"encryption_key"`
+	// AccessPassword is the sealed mesh access password (AT^DAPI) last set by a key rotation
+	AccessPassword string `json:"-"`
 }
 
 // WirelessConfig represents wireless configuration for a device
@@ -178,16 +185,38 @@ type SystemConfig struct {
 	FactoryReset     bool   `json:"factory_reset"`
 }
 
-// ConfigBackup represents a backup of device configuration
+// Snapshot sources
+const (
+	SnapshotSourceManual     = "manual"
+	SnapshotSourceScheduled  = "scheduled"
+	SnapshotSourcePreRestore = "pre_restore" // taken automatically before a restore
+	SnapshotSourceImport     = "import"      // uploaded backup file
+	SnapshotSourcePreReset   = "pre_reset"   // taken automatically before a factory reset
+)
+
+// SnapshotEntry is the reported value of one query command in a snapshot.
+type SnapshotEntry struct {
+	Command string `json:"command"`
+	Value   string `json:"value,omitempty"` // text after "^DRPS:" in the response
+	Error   string `json:"error,omitempty"`
+}
+
+// ConfigBackup represents a backup of device configuration.
+// A full-device snapshot has Category "all" and one entry per board query command.
 type ConfigBackup struct {
-	ID          uint           `gorm:"primarykey" json:"id"`
-	DeviceID    uint           `gorm:"index" json:"device_id"`
-	Category    string         `gorm:"index" json:"category"`
-	Configs     string         `json:"configs"`
-	Description string         `json:"description"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID              uint                     `gorm:"primarykey" json:"id"`
+	DeviceID        uint                     `gorm:"index" json:"device_id"`
+	Category        string                   `gorm:"index" json:"category"`
+	Configs         map[string]SnapshotEntry `gorm:"serializer:json" json:"configs"` // query command name -> entry
+	Description     string                   `json:"description"`
+	BoardType       string                   `json:"board_type"`
+	FirmwareVersion string                   `json:"firmware_version"`
+	Source          string                   `gorm:"index" json:"source"`
+	CreatedBy       string                   `json:"created_by"`
+	FailedCount     int                      `json:"failed_count"` // queries that returned an error
+	CreatedAt       time.Time                `json:"created_at"`
+	UpdatedAt       time.Time                `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt           `gorm:"index" json:"-"`
 }
 
 // ConfigOverview represents an overview of device configurations
@@ -214,10 +243,12 @@ type NetworkMonitor struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
-// MasterSlaveConfig represents master-slave configuration
+// MasterSlaveConfig represents master-slave configuration. NowType is the
+// configured AT^DDTC device type and ActiveType the one the device runs as;
+// they differ until the device reboots.
 type MasterSlaveConfig struct {
 	ID            uint      `json:"id" gorm:"primaryKey"`
-	DeviceID      uint      `json:"device_id" gorm:"not null"`
+	DeviceID      uint      `json:"device_id" gorm:"not null;uniqueIndex"`
 	NowType       string    `json:"now_type" gorm:"not null"`
 	ActiveType    string    `json:"active_type" gorm:"not null"`
 	Configuration string    `json:"configuration" gorm:"type:text"`
@@ -324,12 +355,19 @@ type ConfigCategory struct {
 }
 
 // ConfigHistory represents configuration history
+// 每条记录对应一次配置变更中的一个参数，AuditID关联所属的审计记录
 type ConfigHistory struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
 	ConfigID  uint           `gorm:"index" json:"config_id"`
+	AuditID   uint           `gorm:"index" json:"audit_id"`
+	DeviceID  uint           `gorm:"index" json:"device_id"`
+	Category  string         `gorm:"index" json:"category"`
+	Key       string         `gorm:"index" json:"key"`
+	OldValue  string         `json:"old_value"`
 	Value     string         `json:"value"`
 	UserID    uint           `gorm:"index" json:"user_id"`
-	CreatedAt time.Time      `json:"created_at"`
+	Username  string         `json:"username"`
+	CreatedAt time.Time      `gorm:"index" json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
@@ -360,43 +398,132 @@ type ConfigExport struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// Config audit actions
+const (
+	AuditActionConfigChange = "config_change" // 配置保存（含随之下发的AT命令）
+	AuditActionATCommand    = "at_command"    // 直接下发的AT命令
+	AuditActionRestore      = "restore"       // 快照恢复
+	AuditActionRemediate    = "remediate"     // 漂移自动修复
+	AuditActionAlign        = "align"         // 自组网参数一致性对齐
+	AuditActionRotate       = "rotate"        // 接入密码/密钥轮换
+	AuditActionHandover     = "handover"      // 星型网络主节点切换
+	AuditActionReaddress    = "readdress"     // 节点接口地址变更
+)
+
+// Config audit outcomes
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomePartial = "partial" // 配置已保存，但部分AT命令失败
+	AuditOutcomeFailed  = "failed"
+)
+
+// AuditCommand is one AT command sent as part of an audited change.
+type AuditCommand struct {
+	Name     string `json:"name,omitempty"`
+	Command  string `json:"command"`
+	Status   string `json:"status"` // applied, failed, rejected, rolled_back ...
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
 // ConfigAudit represents configuration audit record
 type ConfigAudit struct {
-	ID        uint           `gorm:"primarykey" json:"id"`
-	DeviceID  uint           `gorm:"index" json:"device_id"`
-	Category  string         `gorm:"index" json:"category"`
-	Action    string         `json:"action"`
-	UserID    uint           `gorm:"index" json:"user_id"`
-	Details   string         `json:"details"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID        uint            `gorm:"primarykey" json:"id"`
+	DeviceID  uint            `gorm:"index" json:"device_id"`
+	Category  string          `gorm:"index" json:"category"`
+	Action    string          `gorm:"index" json:"action"`
+	UserID    uint            `gorm:"index" json:"user_id"`
+	Username  string          `gorm:"index" json:"username"`
+	SourceIP  string          `json:"source_ip"`
+	Changes   []PreviewChange `gorm:"serializer:json" json:"changes"`
+	Commands  []AuditCommand  `gorm:"serializer:json" json:"commands"`
+	Outcome   string          `gorm:"index" json:"outcome"`
+	Error     string          `json:"error,omitempty"`
+	Details   string          `json:"details"`
+	CreatedAt time.Time       `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	DeletedAt gorm.DeletedAt  `gorm:"index" json:"-"`
+}
+
+// Config schedule kinds, statuses and misfire policies
+const (
+	ScheduleKindConfig   = "config"   // 保存Configs到Category，下发对应AT命令
+	ScheduleKindCommands = "commands" // 按顺序下发Commands
+
+	ScheduleStatusActive = "active"
+	ScheduleStatusPaused = "paused"
+
+	MisfireRunOnce = "run_once" // 停机错过的执行补跑一次
+	MisfireSkip    = "skip"     // 丢弃错过的执行，等待下一次
+)
+
+// ScheduleCommand is one step of a command schedule: a raw AT command or a
+// board command name with parameters.
+type ScheduleCommand struct {
+	Command string                 `json:"command,omitempty"`
+	Name    string                 `json:"name,omitempty"`
+	Params  map[string]interface{} `json:"params,omitempty"`
 }
 
 // ConfigSchedule represents configuration schedule
 type ConfigSchedule struct {
-	ID          uint           `gorm:"primarykey" json:"id"`
-	DeviceID    uint           `gorm:"index" json:"device_id"`
-	Category    string         `gorm:"index" json:"category"`
-	Name        string         `json:"name"`
-	Description string         `json:"description"`
-	Cron        string         `json:"cron"`
-	Configs     string         `json:"configs"`
-	Status      string         `json:"status"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            uint                   `gorm:"primarykey" json:"id"`
+	DeviceID      uint                   `gorm:"index" json:"device_id"`
+	DeviceIDs     []uint                 `gorm:"serializer:json" json:"device_ids"` // 设备组，DeviceID为0时使用
+	Category      string                 `gorm:"index" json:"category"`
+	Name          string                 `json:"name"`
+	Description   string                 `json:"description"`
+	Cron          string                 `json:"cron"`
+	Kind          string                 `json:"kind"`
+	Configs       map[string]interface{} `gorm:"serializer:json" json:"configs"`
+	Commands      []ScheduleCommand      `gorm:"serializer:json" json:"commands"`
+	Status        string                 `gorm:"index" json:"status"`
+	MisfirePolicy string                 `json:"misfire_policy"`
+	MisfireGrace  int                    `json:"misfire_grace"` // 秒，超过该延迟视为错过
+	NextRunAt     *time.Time             `gorm:"index" json:"next_run_at"`
+	LastRunAt     *time.Time             `json:"last_run_at"`
+	LastStatus    string                 `json:"last_status"`
+	RunningSince  *time.Time             `json:"running_since,omitempty"` // 执行锁，防止同一任务并发执行
+	CreatedBy     string                 `json:"created_by"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt         `gorm:"index" json:"-"`
+}
+
+// Config schedule run triggers and statuses
+const (
+	ScheduleTriggerCron    = "cron"
+	ScheduleTriggerMisfire = "misfire"
+	ScheduleTriggerManual  = "manual"
+
+	ScheduleRunSuccess = "success"
+	ScheduleRunPartial = "partial"
+	ScheduleRunFailed  = "failed"
+	ScheduleRunMissed  = "missed"
+)
+
+// ScheduleDeviceResult is the outcome of one schedule run on one device.
+type ScheduleDeviceResult struct {
+	DeviceID uint           `json:"device_id"`
+	Success  bool           `json:"success"`
+	Error    string         `json:"error,omitempty"`
+	Commands []AuditCommand `json:"commands,omitempty"`
 }
 
 // ConfigScheduleLog represents configuration schedule log
 type ConfigScheduleLog struct {
-	ID         uint           `gorm:"primarykey" json:"id"`
-	ScheduleID uint           `gorm:"index" json:"schedule_id"`
-	Status     string         `json:"status"`
-	Message    string         `json:"message"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	ID           uint                   `gorm:"primarykey" json:"id"`
+	ScheduleID   uint                   `gorm:"index" json:"schedule_id"`
+	Trigger      string                 `json:"trigger"`
+	ScheduledFor time.Time              `json:"scheduled_for"`
+	StartedAt    time.Time              `json:"started_at"`
+	FinishedAt   time.Time              `json:"finished_at"`
+	Status       string                 `json:"status"`
+	Message      string                 `json:"message"`
+	Results      []ScheduleDeviceResult `gorm:"serializer:json" json:"results"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt         `gorm:"index" json:"-"`
 }
 
 // ConfigTemplateGroup represents configuration template group
@@ -419,15 +546,36 @@ type ConfigTemplateGroupRelation struct {
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// Configuration profiles are ConfigTemplate rows of kind "profile"; each
+// version's values are stored in ConfigTemplateVersion and every apply to a
+// device in ConfigTemplateUsage.
+const (
+	TemplateKindProfile = "profile"
+
+	ProfileApplySuccess = "success"
+	ProfileApplyFailed  = "failed"
+)
+
+// ProfileVariable is a per-device placeholder used as ${name} in profile values.
+type ProfileVariable struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
 // ConfigTemplateVersion represents configuration template version
 type ConfigTemplateVersion struct {
-	ID         uint           `gorm:"primarykey" json:"id"`
-	TemplateID uint           `gorm:"index" json:"template_id"`
-	Version    string         `json:"version"`
-	Content    string         `json:"content"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	ID         uint                              `gorm:"primarykey" json:"id"`
+	TemplateID uint                              `gorm:"index" json:"template_id"`
+	Version    int                               `gorm:"index" json:"version"`
+	Content    string                            `json:"content"`                       // change note
+	Values     map[string]map[string]interface{} `gorm:"serializer:json" json:"values"` // category -> key -> value, may contain ${variable}
+	Variables  []ProfileVariable                 `gorm:"serializer:json" json:"variables"`
+	CreatedBy  string                            `json:"created_by"`
+	CreatedAt  time.Time                         `json:"created_at"`
+	UpdatedAt  time.Time                         `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt                    `gorm:"index" json:"-"`
 }
 
 // ConfigTemplateTag represents configuration template tag
@@ -476,13 +624,18 @@ type ConfigTemplateShare struct {
 
 // ConfigTemplateUsage represents configuration template usage
 type ConfigTemplateUsage struct {
-	ID         uint           `gorm:"primarykey" json:"id"`
-	TemplateID uint           `gorm:"index" json:"template_id"`
-	DeviceID   uint           `gorm:"index" json:"device_id"`
-	UserID     uint           `gorm:"index" json:"user_id"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	ID         uint              `gorm:"primarykey" json:"id"`
+	TemplateID uint              `gorm:"index" json:"template_id"`
+	DeviceID   uint              `gorm:"index" json:"device_id"`
+	UserID     uint              `gorm:"index" json:"user_id"`
+	Username   string            `json:"username"`
+	Version    int               `json:"version"`
+	Variables  map[string]string `gorm:"serializer:json" json:"variables"` // resolved variable values
+	Status     string            `gorm:"index" json:"status"`
+	Error      string            `json:"error,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt    `gorm:"index" json:"-"`
 }
 
 // ConfigTemplateRating represents configuration template rating
@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// Config preview kinds
+const (
+	PreviewKindConfig   = "config"   // PUT /devices/:id/configs/:category
+	PreviewKindWireless = "wireless" // POST /devices/:id/wireless/*
+)
+
+// PreviewCommand is one rendered AT command of a preview.
+type PreviewCommand struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+}
+
+// FieldError is one parameter that failed validation. Handlers return
+// these as "field_errors" so the UI can mark the offending input.
+type FieldError struct {
+	Command string      `json:"command,omitempty"` // board command name, e.g. set_radio_params
+	Field   string      `json:"field"`
+	Value   interface{} `json:"value,omitempty"`
+	Rule    string      `json:"rule"` // required, type, values, range, pattern, band, unknown
+	Message string      `json:"message"`
+}
+
+// PreviewChange is one parameter that differs from the stored configuration.
+type PreviewChange struct {
+	Key  string `json:"key"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ConfigPreview is a dry-run of a configuration change. Applying it sends
+// exactly the reviewed commands, so it is single use and expires.
+type ConfigPreview struct {
+	ID          uint                   `gorm:"primarykey" json:"id"`
+	DeviceID    uint                   `gorm:"index;not null" json:"device_id"`
+	BoardType   string                 `json:"board_type"`
+	Kind        string                 `gorm:"not null" json:"kind"`
+	Target      string                 `gorm:"not null" json:"target"` // category or wireless setter
+	Values      map[string]interface{} `gorm:"serializer:json" json:"values"`
+	Commands    []PreviewCommand       `gorm:"serializer:json" json:"commands"`
+	Changes     []PreviewChange        `gorm:"serializer:json" json:"changes"`
+	Warnings    []string               `gorm:"serializer:json" json:"warnings"`
+	Errors      []string               `gorm:"serializer:json" json:"errors"` // validation failures; the preview cannot be applied
+	FieldErrors []FieldError           `gorm:"serializer:json" json:"field_errors,omitempty"`
+	Valid       bool                   `json:"valid"`
+	CreatedBy   string                 `json:"created_by"`
+	ExpiresAt   time.Time              `json:"expires_at"`
+	AppliedAt   *time.Time             `json:"applied_at,omitempty"`
+	AppliedBy   string                 `json:"applied_by,omitempty"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+// Drift status values
+const (
+	DriftStatusInSync            = "in_sync"            // reported value matches the desired value
+	DriftStatusDrifted           = "drifted"            // reported value differs from the desired value
+	DriftStatusUnreported        = "unreported"         // the device has never reported this key
+	DriftStatusRemediationFailed = "remediation_failed" // pushing the desired value did not converge
+)
+
+// Drift policy modes
+const (
+	DriftModeAlert     = "alert"     // only raise a drift alert
+	DriftModeRemediate = "remediate" // push the desired value back to the device
+)
+
+// DesiredConfig is one key of a device's desired configuration document.
+// It is owned by operators; the last reported state stays in DeviceConfig.
+type DesiredConfig struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	DeviceID  uint      `gorm:"uniqueIndex:idx_desired_config_key;not null" json:"device_id"`
+	Category  string    `gorm:"uniqueIndex:idx_desired_config_key;not null" json:"category"`
+	Key       string    `gorm:"uniqueIndex:idx_desired_config_key;not null" json:"key"`
+	Value     string    `json:"value"`
+	UpdatedBy string    `json:"updated_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ConfigDrift is the latest comparison of one desired key against the device.
+type ConfigDrift struct {
+	ID               uint       `gorm:"primarykey" json:"id"`
+	DeviceID         uint       `gorm:"uniqueIndex:idx_config_drift_key;not null" json:"device_id"`
+	Category         string     `gorm:"uniqueIndex:idx_config_drift_key;not null" json:"category"`
+	Key              string     `gorm:"uniqueIndex:idx_config_drift_key;not null" json:"key"`
+	Desired          string     `json:"desired"` // secret keys hold "fingerprint:<hmac>" instead of the value
+	Actual           string     `json:"actual"`
+	Status           string     `gorm:"index" json:"status"`
+	DriftedSince     *time.Time `json:"drifted_since,omitempty"`
+	LastCheckedAt    time.Time  `json:"last_checked_at"`
+	LastRemediatedAt *time.Time `json:"last_remediated_at,omitempty"`
+	Error            string     `json:"error,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// DriftPolicy selects what the reconciler does when a category drifts.
+// Categories without a policy default to DriftModeAlert.
+type DriftPolicy struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Category  string    `gorm:"uniqueIndex;not null" json:"category"`
+	Mode      string    `gorm:"not null" json:"mode"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// Device operation states
+const (
+	DeviceOperationSent          = "sent"           // command sent, waiting for the device to go down
+	DeviceOperationWaiting       = "waiting"        // waiting for the device to be reachable again
+	DeviceOperationRestoring     = "restoring"      // back after a factory reset, replaying the pre-reset snapshot
+	DeviceOperationCompleted     = "completed"      // reachable again (and restored after a factory reset)
+	DeviceOperationRestoreFailed = "restore_failed" // reachable again, but the snapshot could not be replayed
+	DeviceOperationUnreachable   = "unreachable"    // did not come back within the timeout
+	DeviceOperationFailed        = "failed"         // the snapshot or the command failed; nothing was changed
+	DeviceOperationInterrupted   = "interrupted"    // the backend stopped while tracking the device
+)
+
+// DeviceOperation tracks one confirmed destructive command (reboot, factory
+// reset or shutdown) until the device is reachable again. A factory reset is
+// preceded by a snapshot that is replayed once the device is back.
+type DeviceOperation struct {
+	ID            uint           `gorm:"primarykey" json:"id"`
+	DeviceID      uint           `gorm:"index" json:"device_id"`
+	Kind          string         `json:"kind"` // reboot, factory_reset or shutdown
+	CommandName   string         `json:"command_name,omitempty"`
+	Command       string         `json:"command"`
+	Status        string         `gorm:"index" json:"status"`
+	SnapshotID    uint           `json:"snapshot_id,omitempty"`    // pre-reset snapshot
+	RestoreResult string         `json:"restore_result,omitempty"` // summary of the replayed snapshot
+	Commands      []AuditCommand `gorm:"serializer:json" json:"commands,omitempty"`
+	Error         string         `json:"error,omitempty"`
+	Timeout       int            `json:"timeout"` // seconds to wait for the device
+	RequestedBy   string         `json:"requested_by"`
+	ReachableAt   *time.Time     `json:"reachable_at,omitempty"`
+	FinishedAt    *time.Time     `json:"finished_at,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
@@ -0,0 +1,91 @@
+package model
+
+import "time"
+
+// FirmwareImage is a firmware image in the repository. The file is stored
+// under the firmware directory; Checksum is its SHA-256.
+type FirmwareImage struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	BoardType  string    `gorm:"uniqueIndex:idx_firmware_board_version" json:"board_type"`
+	Version    string    `gorm:"uniqueIndex:idx_firmware_board_version" json:"version"`
+	FileName   string    `json:"file_name"`
+	Size       int64     `json:"size"`
+	Checksum   string    `json:"checksum"`
+	Path       string    `json:"-"`
+	Notes      string    `json:"notes,omitempty"`
+	UploadedBy string    `json:"uploaded_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Firmware upgrade states
+const (
+	FirmwareUpgradeRunning     = "running"
+	FirmwareUpgradeCompleted   = "completed"   // every device runs the new version, or failures stayed within the threshold
+	FirmwareUpgradeHalted      = "halted"      // more devices failed than the threshold allows; later groups were not upgraded
+	FirmwareUpgradeAborted     = "aborted"     // stopped by a user; later groups were not upgraded
+	FirmwareUpgradeInterrupted = "interrupted" // the backend stopped during the upgrade
+)
+
+// Firmware upgrade device and group states
+const (
+	FirmwareDevicePending   = "pending"
+	FirmwareDeviceUploading = "uploading" // pushing the image over the board's upload interface
+	FirmwareDeviceRebooting = "rebooting" // image accepted, waiting for the device to come back
+	FirmwareDeviceVerifying = "verifying" // answering AT again, checking AT^DGMR?
+	FirmwareDeviceSucceeded = "succeeded" // reports the new version
+	FirmwareDeviceCurrent   = "current"   // already ran the version, nothing was pushed
+	FirmwareDeviceFailed    = "failed"
+	FirmwareDeviceSkipped   = "skipped" // not upgraded because the upgrade stopped first
+)
+
+// FirmwareUpgradeDevice is the progress of one device in an upgrade.
+type FirmwareUpgradeDevice struct {
+	DeviceID        uint       `json:"device_id"`
+	Name            string     `json:"name"`
+	NodeID          string     `json:"node_id"`
+	Status          string     `json:"status"`
+	Error           string     `json:"error,omitempty"`
+	FromVersion     string     `json:"from_version,omitempty"`
+	ToVersion       string     `json:"to_version,omitempty"` // AT^DGMR? version after the reboot
+	BytesSent       int64      `json:"bytes_sent"`
+	Progress        int        `json:"progress"` // upload progress in percent
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	UploadedAt      *time.Time `json:"uploaded_at,omitempty"`
+	UpAt            *time.Time `json:"up_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	DowntimeSeconds float64    `json:"downtime_seconds,omitempty"` // from the reboot until the device answered AT
+}
+
+// FirmwareUpgradeGroup is a stage of the rollout; its devices are upgraded
+// together and the next group starts once every device is done.
+type FirmwareUpgradeGroup struct {
+	Index      int                     `json:"index"`
+	Status     string                  `json:"status"`
+	StartedAt  *time.Time              `json:"started_at,omitempty"`
+	FinishedAt *time.Time              `json:"finished_at,omitempty"`
+	Devices    []FirmwareUpgradeDevice `json:"devices"`
+}
+
+// FirmwareUpgrade pushes one image to a set of devices in staged groups and
+// halts once more than FailureThreshold devices failed.
+type FirmwareUpgrade struct {
+	ID               uint                   `gorm:"primarykey" json:"id"`
+	Name             string                 `json:"name"`
+	ImageID          uint                   `gorm:"index" json:"image_id"`
+	BoardType        string                 `json:"board_type"`
+	Version          string                 `json:"version"`
+	DeviceIDs        []uint                 `gorm:"serializer:json" json:"device_ids"`
+	FailureThreshold int                    `json:"failure_threshold"` // failed devices tolerated
+	Failed           int                    `json:"failed"`
+	UploadTimeout    int                    `json:"upload_timeout"` // seconds an image push may take
+	Timeout          int                    `json:"timeout"`        // seconds a device may take to answer AT again
+	Status           string                 `gorm:"index" json:"status"`
+	CurrentGroup     int                    `json:"current_group"`
+	Groups           []FirmwareUpgradeGroup `gorm:"serializer:json" json:"groups"`
+	Error            string                 `json:"error,omitempty"`
+	CreatedBy        string                 `json:"created_by"`
+	StartedAt        *time.Time             `json:"started_at,omitempty"`
+	FinishedAt       *time.Time             `json:"finished_at,omitempty"`
+	CreatedAt        time.Time              `json:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at"`
+}
@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+// Inventory sources
+const (
+	InventorySourceScan    = "scan"    // scheduled inventory scan
+	InventorySourceCollect = "collect" // collected on request
+	InventorySourceSync    = "sync"    // config sync from the board
+	InventorySourceUpgrade = "upgrade" // verification after a firmware upgrade
+)
+
+// Firmware alert types, raised as MonitorAlert.Type
+const (
+	AlertFirmwareChanged          = "firmware_changed"           // the reported firmware changed between two collections
+	AlertFirmwareBaselineMismatch = "firmware_baseline_mismatch" // the firmware differs from the approved baseline of the board type
+)
+
+// DeviceInventory is the latest hardware and version information reported
+// by a device (AT^DGMR? and AT^DUIP?).
+type DeviceInventory struct {
+	ID              uint       `gorm:"primarykey" json:"id"`
+	DeviceID        uint       `gorm:"uniqueIndex" json:"device_id"`
+	BoardType       string     `gorm:"index" json:"board_type"`
+	HardwareModel   string     `gorm:"index" json:"hardware_model"`
+	FirmwareVersion string     `gorm:"index" json:"firmware_version"`
+	SoftwareVersion string     `json:"software_version,omitempty"`
+	SerialNumber    string     `gorm:"index" json:"serial_number,omitempty"`
+	MACAddress      string     `json:"mac_address,omitempty"`
+	RawVersion      string     `json:"raw_version"` // AT^DGMR? value as reported
+	Source          string     `json:"source"`
+	CollectedAt     time.Time  `json:"collected_at"`
+	LastError       string     `json:"last_error,omitempty"` // the last collection failed
+	LastErrorAt     *time.Time `json:"last_error_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// DeviceInventoryHistory records the first inventory of a device and every
+// collection that reported something different.
+type DeviceInventoryHistory struct {
+	ID               uint      `gorm:"primarykey" json:"id"`
+	DeviceID         uint      `gorm:"index" json:"device_id"`
+	BoardType        string    `json:"board_type"`
+	HardwareModel    string    `json:"hardware_model"`
+	FirmwareVersion  string    `json:"firmware_version"`
+	SoftwareVersion  string    `json:"software_version,omitempty"`
+	SerialNumber     string    `json:"serial_number,omitempty"`
+	MACAddress       string    `json:"mac_address,omitempty"`
+	RawVersion       string    `json:"raw_version"`
+	PreviousFirmware string    `json:"previous_firmware,omitempty"`
+	Changes          []string  `gorm:"serializer:json" json:"changes"` // changed fields; empty for the first record
+	Source           string    `json:"source"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// FirmwareBaseline is the approved firmware version of a board type.
+type FirmwareBaseline struct {
+	ID              uint      `gorm:"primarykey" json:"id"`
+	BoardType       string    `gorm:"uniqueIndex" json:"board_type"`
+	FirmwareVersion string    `json:"firmware_version"`
+	Notes           string    `json:"notes,omitempty"`
+	ApprovedBy      string    `json:"approved_by"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
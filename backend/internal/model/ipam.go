@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// IP allocation states
+const (
+	IPAllocationPending  = "pending"  // reserved, not yet written to the device (AT^NETIFCFG)
+	IPAllocationAssigned = "assigned" // written and confirmed by AT^DUIP?
+)
+
+// IPSubnet is the address plan of one mesh network. Node addresses are
+// allocated from [RangeStart, RangeEnd]; the network, broadcast and gateway
+// addresses and the Reserved list are never handed out.
+type IPSubnet struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	Name        string    `gorm:"uniqueIndex" json:"name"`
+	CIDR        string    `json:"cidr"` // e.g. 192.168.10.0/24
+	Gateway     string    `json:"gateway,omitempty"`
+	RangeStart  string    `json:"range_start,omitempty"` // defaults to the first host address
+	RangeEnd    string    `json:"range_end,omitempty"`   // defaults to the last host address
+	Reserved    []string  `gorm:"serializer:json" json:"reserved,omitempty"`
+	DeviceIDs   []uint    `gorm:"serializer:json" json:"device_ids"` // devices of the mesh network using this subnet
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// IPAllocation is the address handed to one device from a subnet.
+type IPAllocation struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	SubnetID  uint      `gorm:"index" json:"subnet_id"`
+	DeviceID  uint      `gorm:"uniqueIndex" json:"device_id"`
+	IP        string    `json:"ip"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"` // last failure writing the address
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,75 @@
+package model
+
+import "time"
+
+// Key rotation states
+const (
+	KeyRotationStaging        = "staging"         // writing the new value to every device
+	KeyRotationStaged         = "staged"          // every device holds the new value, waiting for the switchover window
+	KeyRotationSwitching      = "switching"       // rebooting the devices and verifying that they re-joined
+	KeyRotationCompleted      = "completed"       // every device re-joined with the new value
+	KeyRotationCancelled      = "cancelled"       // the staged value was removed before the switchover
+	KeyRotationFailed         = "failed"          // staging failed and the staged devices were restored
+	KeyRotationRolledBack     = "rolled_back"     // every device was restored to the previous value
+	KeyRotationRollbackFailed = "rollback_failed" // some devices could not be restored
+	KeyRotationInterrupted    = "interrupted"     // the backend stopped during the switchover
+)
+
+// Key rotation device states
+const (
+	KeyRotationDevicePending        = "pending"
+	KeyRotationDeviceStaged         = "staged"
+	KeyRotationDeviceSwitched       = "switched" // rebooted with the new value
+	KeyRotationDeviceRejoined       = "rejoined"
+	KeyRotationDeviceFailed         = "failed"
+	KeyRotationDeviceUnstaged       = "unstaged" // previous value restored before the switchover
+	KeyRotationDeviceRolledBack     = "rolled_back"
+	KeyRotationDeviceRollbackFailed = "rollback_failed"
+)
+
+// KeyRotationDevice is the progress of one device in a rotation.
+type KeyRotationDevice struct {
+	DeviceID        uint           `json:"device_id"`
+	Name            string         `json:"name"`
+	NodeID          string         `json:"node_id"`
+	Hop             int            `json:"hop"`
+	Status          string         `json:"status"`
+	Error           string         `json:"error,omitempty"`
+	NeighborsBefore []string       `json:"neighbors_before,omitempty"`
+	NeighborsAfter  []string       `json:"neighbors_after,omitempty"`
+	Commands        []AuditCommand `json:"commands,omitempty"`
+	Rollback        []AuditCommand `json:"rollback,omitempty"`
+}
+
+// KeyRotation replaces the mesh access password (AT^DAPI) and optionally the
+// ciphering algorithm (AT^DCIAC) on a set of devices. The AT+CONFIG encryption
+// key of the security config is not rotated here. Both take effect after a reboot, so the new value is staged on
+// every device first and the devices are rebooted together in the switchover
+// window. Only fingerprints are shown; the new and previous values are kept
+// sealed for the switchover and for rollback.
+type KeyRotation struct {
+	ID                  uint                `gorm:"primarykey" json:"id"`
+	Name                string              `json:"name"`
+	RootDeviceID        uint                `json:"root_device_id"`
+	DeviceIDs           []uint              `gorm:"serializer:json" json:"device_ids"`
+	Fingerprint         string              `gorm:"index" json:"fingerprint"`
+	PreviousFingerprint string              `json:"previous_fingerprint"`
+	Algorithm           *int                `json:"algorithm,omitempty"` // AT^DCIAC set with the key
+	PreviousAlgorithm   *int                `json:"previous_algorithm,omitempty"`
+	SealedValue         string              `json:"-"`
+	SealedPrevious      string              `json:"-"`
+	SwitchAt            *time.Time          `json:"switch_at,omitempty"` // start of the switchover window, nil = right after staging
+	WindowMinutes       int                 `json:"window_minutes"`      // the switchover must start within this many minutes of switch_at
+	RejoinTimeout       int                 `json:"rejoin_timeout"`      // seconds the devices may take to re-join
+	SettleTime          int                 `json:"settle_time"`         // seconds to wait after the reboots before checking
+	Status              string              `gorm:"index" json:"status"`
+	Devices             []KeyRotationDevice `gorm:"serializer:json" json:"devices"`
+	Notes               []string            `gorm:"serializer:json" json:"notes,omitempty"`
+	Error               string              `json:"error,omitempty"`
+	CreatedBy           string              `json:"created_by"`
+	StagedAt            *time.Time          `json:"staged_at,omitempty"`
+	SwitchedAt          *time.Time          `json:"switched_at,omitempty"`
+	FinishedAt          *time.Time          `json:"finished_at,omitempty"`
+	CreatedAt           time.Time           `json:"created_at"`
+	UpdatedAt           time.Time           `json:"updated_at"`
+}
@@ -0,0 +1,105 @@
+package model
+
+import "time"
+
+// Reboot job states
+const (
+	RebootJobRunning     = "running"
+	RebootJobCompleted   = "completed"   // every device came back and passed its post-checks
+	RebootJobFailed      = "failed"      // a device did not come back or failed a post-check; later waves were not rebooted
+	RebootJobAborted     = "aborted"     // stopped by a user; later waves were not rebooted
+	RebootJobInterrupted = "interrupted" // the backend stopped during the job
+)
+
+// Reboot device and wave states
+const (
+	RebootDevicePending     = "pending"
+	RebootDeviceRebooting   = "rebooting"   // command sent, waiting for the device to go down
+	RebootDeviceDown        = "down"        // unreachable, polling until it answers AT again
+	RebootDeviceChecking    = "checking"    // answering AT again, running the post-checks
+	RebootDevicePassed      = "passed"      // back and every post-check passed
+	RebootDeviceFailed      = "failed"      // the command or a post-check failed
+	RebootDeviceUnreachable = "unreachable" // did not answer AT within the timeout
+	RebootDeviceSkipped     = "skipped"     // not rebooted because the job stopped first
+)
+
+// Reboot post-checks
+const (
+	RebootCheckFirmware  = "firmware"  // AT^DGMR? reports the same version as before
+	RebootCheckAccess    = "access"    // AT^DACS? reports the same access state as before
+	RebootCheckNeighbors = "neighbors" // every neighbor seen before is discovered again
+	RebootCheckRadio     = "radio"     // AT^DRPC? reports the same radio parameters as before
+)
+
+// Reboot post-check results
+const (
+	RebootCheckPassed  = "passed"
+	RebootCheckFailed  = "failed"
+	RebootCheckSkipped = "skipped" // the board has no such query, or there was nothing to compare
+)
+
+// RebootCheck is the result of one post-check.
+type RebootCheck struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Before   string `json:"before,omitempty"`
+	After    string `json:"after,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+}
+
+// RebootDevice is the progress of one device in a reboot job.
+type RebootDevice struct {
+	DeviceID        uint          `json:"device_id"`
+	Name            string        `json:"name"`
+	NodeID          string        `json:"node_id"`
+	Hop             int           `json:"hop"`
+	Status          string        `json:"status"`
+	Error           string        `json:"error,omitempty"`
+	Command         string        `json:"command,omitempty"`
+	Response        string        `json:"response,omitempty"`
+	NeighborsBefore []string      `json:"neighbors_before,omitempty"`
+	NeighborsAfter  []string      `json:"neighbors_after,omitempty"`
+	Checks          []RebootCheck `json:"checks,omitempty"`
+	Polls           int           `json:"polls"`                      // AT probes sent while waiting for the device
+	SentAt          *time.Time    `json:"sent_at,omitempty"`          // reboot command accepted
+	DownAt          *time.Time    `json:"down_at,omitempty"`          // first seen unreachable
+	UpAt            *time.Time    `json:"up_at,omitempty"`            // answering AT again
+	DowntimeSeconds float64       `json:"downtime_seconds,omitempty"` // from sent_at to up_at
+}
+
+// RebootWave is a group of devices rebooted together. Lost lists every
+// node the network loses while the wave is down, including the nodes behind
+// the rebooted relays.
+type RebootWave struct {
+	Index           int            `json:"index"`
+	Status          string         `json:"status"`
+	Lost            []string       `json:"lost"`
+	StartedAt       *time.Time     `json:"started_at,omitempty"`
+	FinishedAt      *time.Time     `json:"finished_at,omitempty"`
+	DowntimeSeconds float64        `json:"downtime_seconds,omitempty"` // from the first reboot until every device is back
+	Devices         []RebootDevice `json:"devices"`
+}
+
+// RebootJob reboots one device, or a group in waves that never take down
+// more than MaxDown nodes at once, and verifies every device after it is back.
+type RebootJob struct {
+	ID              uint         `gorm:"primarykey" json:"id"`
+	Name            string       `json:"name"`
+	RootDeviceID    uint         `json:"root_device_id,omitempty"`
+	DeviceIDs       []uint       `gorm:"serializer:json" json:"device_ids"`
+	MaxDown         int          `json:"max_down"`
+	PostChecks      []string     `gorm:"serializer:json" json:"post_checks"`
+	Timeout         int          `json:"timeout"`       // seconds a device may take to answer AT again
+	CheckTimeout    int          `json:"check_timeout"` // seconds to wait for the neighbors to be re-discovered
+	Status          string       `gorm:"index" json:"status"`
+	CurrentWave     int          `json:"current_wave"`
+	Waves           []RebootWave `gorm:"serializer:json" json:"waves"`
+	DowntimeSeconds float64      `json:"downtime_seconds"` // total time some device of the job was down
+	Error           string       `json:"error,omitempty"`
+	CreatedBy       string       `json:"created_by"`
+	StartedAt       *time.Time   `json:"started_at,omitempty"`
+	FinishedAt      *time.Time   `json:"finished_at,omitempty"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+}
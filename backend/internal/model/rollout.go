@@ -0,0 +1,78 @@
+package model
+
+import "time"
+
+// Rollout states
+const (
+	RolloutRunning        = "running"
+	RolloutCompleted      = "completed"
+	RolloutRolledBack     = "rolled_back"     // halted and every applied device was restored
+	RolloutRollbackFailed = "rollback_failed" // halted but some devices could not be restored
+	RolloutInterrupted    = "interrupted"     // the backend stopped during the rollout
+)
+
+// Rollout device and wave states
+const (
+	RolloutDevicePending        = "pending"
+	RolloutDeviceApplied        = "applied"
+	RolloutDeviceRejoined       = "rejoined"
+	RolloutDeviceFailed         = "failed"
+	RolloutDeviceRolledBack     = "rolled_back"
+	RolloutDeviceRollbackFailed = "rollback_failed"
+)
+
+// RolloutChange is the radio change pushed to every device of a rollout.
+// Unset radio parameters keep each device's current value.
+type RolloutChange struct {
+	Frequency      *int   `json:"frequency,omitempty"` // EARFCN, AT^DRPC/AT^DRPS
+	Bandwidth      string `json:"bandwidth,omitempty"` // 1.4M, 3M, 5M, 10M or 20M
+	Power          *int   `json:"power,omitempty"`
+	BuildingChain  string `json:"building_chain,omitempty"`  // sub-band ranges, AT^DSONSBR
+	AccessPassword string `json:"access_password,omitempty"` // AT^DAPI, never stored in clear
+}
+
+// RolloutDevice is the progress of one device in a wave.
+type RolloutDevice struct {
+	DeviceID        uint           `json:"device_id"`
+	Name            string         `json:"name"`
+	NodeID          string         `json:"node_id"`
+	Hop             int            `json:"hop"`
+	Status          string         `json:"status"`
+	Error           string         `json:"error,omitempty"`
+	NeighborsBefore []string       `json:"neighbors_before,omitempty"`
+	NeighborsAfter  []string       `json:"neighbors_after,omitempty"`
+	Commands        []AuditCommand `json:"commands,omitempty"`
+	Rollback        []AuditCommand `json:"rollback,omitempty"`
+}
+
+// RolloutWave is a group of devices changed together.
+type RolloutWave struct {
+	Index      int             `json:"index"`
+	Hop        int             `json:"hop"`
+	Status     string          `json:"status"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	Devices    []RolloutDevice `json:"devices"`
+}
+
+// Rollout is a mesh-wide radio change applied from the farthest hop inward.
+type Rollout struct {
+	ID            uint          `gorm:"primarykey" json:"id"`
+	Name          string        `json:"name"`
+	RootDeviceID  uint          `json:"root_device_id"`
+	DeviceIDs     []uint        `gorm:"serializer:json" json:"device_ids"`
+	Change        RolloutChange `gorm:"serializer:json" json:"change"`
+	Reboot        bool          `json:"reboot"`         // reboot each device after the change, e.g. for AT^DAPI
+	WaveSize      int           `json:"wave_size"`      // max devices per wave, 0 = one wave per hop
+	RejoinTimeout int           `json:"rejoin_timeout"` // seconds a wave may take to re-join
+	SettleTime    int           `json:"settle_time"`    // seconds to wait before checking a wave
+	Status        string        `gorm:"index" json:"status"`
+	CurrentWave   int           `json:"current_wave"`
+	Waves         []RolloutWave `gorm:"serializer:json" json:"waves"`
+	Error         string        `json:"error,omitempty"`
+	CreatedBy     string        `json:"created_by"`
+	StartedAt     *time.Time    `json:"started_at,omitempty"`
+	FinishedAt    *time.Time    `json:"finished_at,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
@@ -0,0 +1,67 @@
+package model
+
+import "time"
+
+// Star device types reported and set by AT^DDTC
+const (
+	StarDeviceTypeMaster = "1" // 中心节点
+	StarDeviceTypeSlave  = "2" // 接入节点
+)
+
+// Star master handover states
+const (
+	StarHandoverRunning        = "running"
+	StarHandoverCompleted      = "completed"
+	StarHandoverRolledBack     = "rolled_back"
+	StarHandoverRollbackFailed = "rollback_failed"
+	StarHandoverInterrupted    = "interrupted" // the backend stopped during the handover
+)
+
+// Star handover device states
+const (
+	StarHandoverDevicePending        = "pending"
+	StarHandoverDeviceChanged        = "changed"  // new role written, effective after reboot
+	StarHandoverDeviceRebooted       = "rebooted" // rebooted into the new role
+	StarHandoverDeviceAttached       = "attached" // runs the expected role and sees the new center
+	StarHandoverDeviceFailed         = "failed"
+	StarHandoverDeviceRolledBack     = "rolled_back"
+	StarHandoverDeviceRollbackFailed = "rollback_failed"
+)
+
+// StarHandoverDevice is one device of the star network during a handover.
+type StarHandoverDevice struct {
+	DeviceID        uint           `json:"device_id"`
+	Name            string         `json:"name"`
+	NodeID          string         `json:"node_id"`
+	Role            string         `json:"role"`          // device type after the handover: 1 = center, 2 = terminal
+	PreviousRole    string         `json:"previous_role"` // configured device type before the handover
+	Status          string         `json:"status"`
+	Error           string         `json:"error,omitempty"`
+	NeighborsBefore []string       `json:"neighbors_before,omitempty"`
+	NeighborsAfter  []string       `json:"neighbors_after,omitempty"`
+	Commands        []AuditCommand `json:"commands,omitempty"`
+	Rollback        []AuditCommand `json:"rollback,omitempty"`
+}
+
+// StarHandover moves the center role of a star network from one device to
+// another. The old center is set to terminal and the new one to center
+// together with the slave max tx power limits (AT^DSSMTP); both reboot into
+// the new role and every terminal must re-attach to the new center.
+type StarHandover struct {
+	ID                      uint                 `gorm:"primarykey" json:"id"`
+	FromDeviceID            uint                 `json:"from_device_id"` // 0 when the network had no center
+	ToDeviceID              uint                 `json:"to_device_id"`
+	DeviceIDs               []uint               `gorm:"serializer:json" json:"device_ids"`
+	SlaveMaxTxPower         string               `json:"slave_max_tx_power,omitempty"` // limits applied on the new center
+	PreviousSlaveMaxTxPower string               `json:"previous_slave_max_tx_power,omitempty"`
+	RejoinTimeout           int                  `json:"rejoin_timeout"`
+	SettleTime              int                  `json:"settle_time"`
+	Status                  string               `gorm:"index" json:"status"`
+	Devices                 []StarHandoverDevice `gorm:"serializer:json" json:"devices"`
+	Notes                   []string             `gorm:"serializer:json" json:"notes,omitempty"`
+	Error                   string               `json:"error,omitempty"`
+	CreatedBy               string               `json:"created_by"`
+	FinishedAt              *time.Time           `json:"finished_at,omitempty"`
+	CreatedAt               time.Time            `json:"created_at"`
+	UpdatedAt               time.Time            `json:"updated_at"`
+}
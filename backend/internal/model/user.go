@@ -7,11 +7,18 @@ import (
 	"gorm.io/gorm"
 )
 
+// User roles
+const (
+	RoleAdmin    = "admin"    // 可下发重启、恢复出厂设置、关机等危险命令
+	RoleOperator = "operator" // 默认角色
+)
+
 // User 用户模型
 type User struct {
 	gorm.Model
 	Username    string    `gorm:"uniqueIndex;not null" json:"username"`
 	Password    string    `gorm:"not null" json:"-"`
+	Role        string    `gorm:"default:operator" json:"role"`
 	LastLoginAt time.Time `json:"last_login_at"`
 }
 
@@ -1,10 +1,12 @@
 package router
 
 import (
+	"backend/internal/config"
 	"backend/internal/handler"
 	"backend/internal/middleware"
 	"backend/internal/repository"
 	"backend/internal/service"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -13,7 +15,8 @@ import (
 	"gorm.io/gorm"
 )
 
-func SetupRouter(db *gorm.DB) *gin.Engine {
+func SetupRouter(db *gorm.DB, cfgMgr *config.Manager, supervisor *service.Supervisor) *gin.Engine {
+	cfg := cfgMgr.Get()
 	r := gin.Default()
 
 	// Add CORS middleware
@@ -34,38 +37,107 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 	})
 
 	// Create service instances, passing the DB connection
-	authService := service.NewAuthService(db)
+	if cfg.UsesDefaultJWTSecret() {
+		log.Printf("WARNING: jwt.secret is the shipped placeholder %q; anyone can sign admin tokens. Set JWT_SECRET or -jwt-secret before exposing this server", cfg.JWT.Secret)
+	}
+	authService := service.NewAuthService(db, cfg.JWT)
+	if err := authService.EnsureAdmin(); err != nil {
+		log.Printf("Failed to ensure an admin user exists: %v", err)
+	}
 	deviceService := service.NewDeviceService(db)
 	deviceCommService := service.NewDeviceCommService(db)
 	nodeService := service.NewNodeService(db)
 	deviceRepo := repository.NewDeviceRepository(db)
-	configService := service.NewConfigService(db, deviceRepo)
+	auditService := service.NewAuditService(db)
+	// 之前的版本用jwt.secret加密，保留它来解开旧的密文
+	secrets := service.NewSecretBox(cfg.Security.SecretKey, cfg.JWT.Secret)
+	if !secrets.Keyed() {
+		log.Printf("security.secret_key is not set; key rotations are disabled until SECURITY_SECRET_KEY is configured")
+	}
+	configService := service.NewConfigService(db, deviceRepo, auditService, secrets)
 	topologyService := service.NewTopologyService(db)
 	monitorService := service.NewMonitorService(db)
-	drprMonitorService := service.NewDRPRMonitorService(db, deviceService, deviceCommService)
+	drprMonitorService := service.NewDRPRMonitorService(db, deviceService, deviceCommService, supervisor)
+	drprMonitorService.SetPollInterval(cfg.DRPRPollInterval())
+	configReconciler := service.NewConfigReconciler(db, deviceCommService, auditService, supervisor, secrets, cfg.ReconcileInterval())
+	configReconciler.Start()
+	changeSetExecutor := service.NewChangeSetExecutor(deviceCommService)
+	configPreviewService := service.NewConfigPreviewService(db, deviceCommService, configService, changeSetExecutor)
+	configSnapshotService := service.NewConfigSnapshotService(db, deviceCommService, changeSetExecutor, auditService, supervisor, cfg.SnapshotInterval(), cfg.Device.SnapshotRetention)
+	configSnapshotService.Start()
+	deviceOperationService := service.NewDeviceOperationService(db, deviceCommService, configSnapshotService, auditService, supervisor)
+	deviceOperationService.Start()
+	configScheduler := service.NewConfigScheduler(db, deviceCommService, configService, deviceOperationService, auditService, supervisor)
+	configScheduler.Start()
+	configProfileService := service.NewConfigProfileService(db, deviceCommService, configService, configPreviewService, changeSetExecutor)
+	rolloutService := service.NewRolloutService(db, deviceCommService, changeSetExecutor, topologyService, configService, auditService, supervisor)
+	rolloutService.Start()
+	meshComplianceService := service.NewMeshComplianceService(db, deviceCommService, changeSetExecutor, auditService)
+	spectrumSurveyService := service.NewSpectrumSurveyService(db, deviceCommService, changeSetExecutor, configService, configPreviewService)
+	frequencyPlanService := service.NewFrequencyPlanService(db, deviceCommService, changeSetExecutor, rolloutService, spectrumSurveyService)
+	keyRotationService := service.NewKeyRotationService(db, deviceCommService, changeSetExecutor, rolloutService, auditService, secrets, supervisor)
+	keyRotationService.Start()
+	starRoleService := service.NewStarRoleService(db, deviceCommService, changeSetExecutor, rolloutService, auditService, supervisor)
+	starRoleService.Start()
+	ipamService := service.NewIPAMService(db, deviceCommService, auditService)
+	rebootJobService := service.NewRebootJobService(db, deviceCommService, rolloutService, auditService, supervisor)
+	rebootJobService.Start()
+	inventoryService := service.NewInventoryService(db, deviceCommService, supervisor, cfg.InventoryInterval())
+	inventoryService.Start()
+	firmwareService := service.NewFirmwareService(db, deviceCommService.BoardConfigs(), cfg.Firmware.Dir, cfg.FirmwareMaxSize())
+	firmwareUpgradeService := service.NewFirmwareUpgradeService(db, deviceCommService, firmwareService, rebootJobService, inventoryService, auditService, supervisor)
+	firmwareUpgradeService.Start()
+
+	// Re-apply runtime-safe settings on config reload
+	cfgMgr.OnReload(func(c *config.Config) {
+		authService.SetTokenExpiry(c.JWT.ExpiresIn)
+		drprMonitorService.SetPollInterval(c.DRPRPollInterval())
+		configReconciler.SetInterval(c.ReconcileInterval())
+		configSnapshotService.SetSchedule(c.SnapshotInterval(), c.Device.SnapshotRetention)
+		inventoryService.SetInterval(c.InventoryInterval())
+		deviceCommService.BoardConfigs().Reload()
+	})
 
 	// Create handler instances
 	authHandler := handler.NewAuthHandler(authService)
-	deviceHandler := handler.NewDeviceHandler(deviceService, deviceCommService, configService, topologyService, drprMonitorService) // Pass topologyService and drprMonitorService
+	deviceHandler := handler.NewDeviceHandler(deviceService, deviceCommService, configService, topologyService, drprMonitorService, changeSetExecutor, configPreviewService, auditService, ipamService, deviceOperationService, rebootJobService, inventoryService) // Pass topologyService and drprMonitorService
 	nodeHandler := handler.NewNodeHandler(nodeService)
-	configHandler := handler.NewConfigHandler(configService)
+	configHandler := handler.NewConfigHandler(configService, configPreviewService, ipamService)
 	topologyHandler := handler.NewTopologyHandler(topologyService)
 	monitorHandler := handler.NewMonitorHandler(monitorService)
+	systemHandler := handler.NewSystemHandler(supervisor, deviceCommService.BoardConfigs())
+	desiredConfigHandler := handler.NewDesiredConfigHandler(configReconciler)
+	snapshotHandler := handler.NewSnapshotHandler(configSnapshotService)
+	auditHandler := handler.NewAuditHandler(auditService)
+	scheduleHandler := handler.NewScheduleHandler(configScheduler)
+	profileHandler := handler.NewProfileHandler(configProfileService)
+	rolloutHandler := handler.NewRolloutHandler(rolloutService)
+	complianceHandler := handler.NewComplianceHandler(meshComplianceService)
+	frequencyPlanHandler := handler.NewFrequencyPlanHandler(frequencyPlanService)
+	spectrumHandler := handler.NewSpectrumHandler(spectrumSurveyService)
+	keyRotationHandler := handler.NewKeyRotationHandler(keyRotationService)
+	starRoleHandler := handler.NewStarRoleHandler(starRoleService)
+	ipamHandler := handler.NewIPAMHandler(ipamService)
+	deviceOperationHandler := handler.NewDeviceOperationHandler(deviceOperationService)
+	rebootJobHandler := handler.NewRebootJobHandler(rebootJobService, deviceOperationService)
+	inventoryHandler := handler.NewInventoryHandler(inventoryService)
+	firmwareHandler := handler.NewFirmwareHandler(firmwareService, firmwareUpgradeService, deviceOperationService)
 
 	// Public routes
 	auth := r.Group("/api/auth")
 	{
 		auth.POST("/register", authHandler.Register)
 		auth.POST("/login", authHandler.Login)
-		auth.DELETE("/users/:username", authHandler.DeleteUser)
 	}
 
 	// Token validation route (protected)
 	api := r.Group("/api")
-	api.Use(middleware.AuthMiddleware())
+	api.Use(middleware.AuthMiddleware(cfg.JWT.Secret))
 	{
 		// Token validation
 		api.GET("/auth/validate", authHandler.ValidateToken)
+		api.PUT("/auth/users/:username/role", authHandler.SetUserRole)
+		api.DELETE("/auth/users/:username", authHandler.DeleteUser)
 
 		// Device routes
 		api.POST("/devices", deviceHandler.CreateDevice)
@@ -82,6 +154,8 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 		api.POST("/devices/:id/sync-config", deviceHandler.SyncDeviceConfig)
 		api.POST("/devices/:id/sync-config/:type", deviceHandler.SyncDeviceConfigByType)
 		api.POST("/devices/:id/reboot", deviceHandler.RebootDevice)
+		api.GET("/devices/:id/operations", deviceOperationHandler.ListDeviceOperations)
+		api.GET("/device-operations/:id", deviceOperationHandler.GetDeviceOperation)
 		api.POST("/devices/:id/login", deviceHandler.LoginDevice)
 		api.GET("/devices/:id/key", deviceHandler.GetKey)
 		api.POST("/devices/:id/key", deviceHandler.SetKey)
@@ -114,6 +188,128 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 		api.POST("/config/validate", configHandler.ValidateConfig)
 		api.GET("/devices/:id/config/overview", configHandler.GetDeviceConfigOverview)
 
+		// Dry-run previews (?dry_run=true on config PUTs and wireless setters)
+		api.GET("/config/previews/:id", configHandler.GetPreview)
+		api.POST("/config/previews/:id/apply", configHandler.ApplyPreview)
+
+		// Config snapshot, backup and restore routes
+		api.POST("/devices/:id/snapshots", snapshotHandler.CreateSnapshot)
+		api.GET("/devices/:id/snapshots", snapshotHandler.ListSnapshots)
+		api.GET("/snapshots/diff", snapshotHandler.DiffSnapshots)
+		api.GET("/snapshots/:id", snapshotHandler.GetSnapshot)
+		api.DELETE("/snapshots/:id", snapshotHandler.DeleteSnapshot)
+		api.POST("/snapshots/:id/restore", snapshotHandler.RestoreSnapshot)
+		api.GET("/devices/:id/config/backup", snapshotHandler.BackupConfig)
+		api.POST("/devices/:id/config/restore", snapshotHandler.RestoreConfig)
+
+		// Desired-state config and drift routes
+		api.GET("/devices/:id/desired-config", desiredConfigHandler.GetDesiredConfig)
+		api.PUT("/devices/:id/desired-config/:category", desiredConfigHandler.SetDesiredConfig)
+		api.DELETE("/devices/:id/desired-config/:category", desiredConfigHandler.DeleteDesiredConfig)
+		api.GET("/devices/:id/drift", desiredConfigHandler.GetDrift)
+		api.POST("/devices/:id/reconcile", desiredConfigHandler.ReconcileDevice)
+		api.GET("/config/drift", desiredConfigHandler.ListDrift)
+		api.GET("/config/drift-policies", desiredConfigHandler.GetDriftPolicies)
+		api.PUT("/config/drift-policies/:category", desiredConfigHandler.SetDriftPolicy)
+
+		// Config audit trail routes
+		api.GET("/config/audit", auditHandler.ListAudit)
+		api.GET("/devices/:id/audit", auditHandler.ListDeviceAudit)
+		api.GET("/devices/:id/config-history", auditHandler.ListConfigHistory)
+
+		// Scheduled config job routes
+		api.POST("/config/schedules", scheduleHandler.CreateSchedule)
+		api.GET("/config/schedules", scheduleHandler.ListSchedules)
+		api.GET("/config/schedules/:id", scheduleHandler.GetSchedule)
+		api.PUT("/config/schedules/:id", scheduleHandler.UpdateSchedule)
+		api.DELETE("/config/schedules/:id", scheduleHandler.DeleteSchedule)
+		api.POST("/config/schedules/:id/pause", scheduleHandler.PauseSchedule)
+		api.POST("/config/schedules/:id/resume", scheduleHandler.ResumeSchedule)
+		api.POST("/config/schedules/:id/run", scheduleHandler.RunSchedule)
+		api.GET("/config/schedules/:id/logs", scheduleHandler.ListScheduleLogs)
+
+		// Configuration profile routes
+		api.POST("/config/profiles", profileHandler.CreateProfile)
+		api.GET("/config/profiles", profileHandler.ListProfiles)
+		api.GET("/config/profiles/:id", profileHandler.GetProfile)
+		api.DELETE("/config/profiles/:id", profileHandler.DeleteProfile)
+		api.POST("/config/profiles/:id/versions", profileHandler.CreateVersion)
+		api.GET("/config/profiles/:id/versions/:version", profileHandler.GetVersion)
+		api.POST("/config/profiles/:id/apply", profileHandler.ApplyProfile)
+		api.GET("/config/profiles/:id/devices", profileHandler.ListProfileDevices)
+		api.GET("/config/profiles/:id/usages", profileHandler.ListProfileUsages)
+		api.GET("/devices/:id/profile", profileHandler.GetDeviceProfile)
+
+		// Staged network-wide radio rollouts
+		api.POST("/rollouts", rolloutHandler.CreateRollout)
+		api.GET("/rollouts", rolloutHandler.ListRollouts)
+		api.GET("/rollouts/:id", rolloutHandler.GetRollout)
+		api.POST("/rollouts/:id/abort", rolloutHandler.AbortRollout)
+
+		// Reboot jobs
+		api.POST("/reboot-jobs", rebootJobHandler.CreateRebootJob)
+		api.GET("/reboot-jobs", rebootJobHandler.ListRebootJobs)
+		api.GET("/reboot-jobs/:id", rebootJobHandler.GetRebootJob)
+		api.POST("/reboot-jobs/:id/abort", rebootJobHandler.AbortRebootJob)
+
+		// Firmware inventory
+		api.GET("/inventory", inventoryHandler.ListInventory)
+		api.GET("/inventory/versions", inventoryHandler.GetVersionDistribution)
+		api.POST("/inventory/scan", inventoryHandler.ScanInventory)
+		api.GET("/inventory/alerts", inventoryHandler.ListFirmwareAlerts)
+		api.GET("/inventory/baselines", inventoryHandler.ListBaselines)
+		api.PUT("/inventory/baselines/:board_type", inventoryHandler.SetBaseline)
+		api.DELETE("/inventory/baselines/:board_type", inventoryHandler.DeleteBaseline)
+		api.GET("/devices/:id/inventory", inventoryHandler.GetDeviceInventory)
+		api.POST("/devices/:id/inventory/collect", inventoryHandler.CollectDeviceInventory)
+
+		// Firmware repository and upgrades
+		api.POST("/firmware", firmwareHandler.UploadFirmware)
+		api.GET("/firmware", firmwareHandler.ListFirmware)
+		api.GET("/firmware/:id", firmwareHandler.GetFirmware)
+		api.DELETE("/firmware/:id", firmwareHandler.DeleteFirmware)
+		api.POST("/firmware-upgrades", firmwareHandler.CreateFirmwareUpgrade)
+		api.GET("/firmware-upgrades", firmwareHandler.ListFirmwareUpgrades)
+		api.GET("/firmware-upgrades/:id", firmwareHandler.GetFirmwareUpgrade)
+		api.POST("/firmware-upgrades/:id/abort", firmwareHandler.AbortFirmwareUpgrade)
+		api.GET("/devices/:id/firmware/update", firmwareHandler.CheckFirmwareUpdate)
+		api.POST("/devices/:id/firmware/upgrade", firmwareHandler.UpgradeDeviceFirmware)
+
+		// Mesh membership consistency checks
+		api.GET("/compliance/mesh", complianceHandler.CheckMesh)
+		api.POST("/compliance/mesh/align", complianceHandler.AlignMesh)
+
+		// Frequency and sub-band planning
+		api.POST("/frequency-plans", frequencyPlanHandler.PlanFrequencies)
+		api.POST("/frequency-plans/apply", frequencyPlanHandler.ApplyFrequencyPlan)
+
+		// Interference and spectrum survey
+		api.GET("/spectrum/survey", spectrumHandler.GetSurvey)
+		api.POST("/spectrum/hopping", spectrumHandler.ApplyHopping)
+
+		// Access password / key rotation
+		api.POST("/key-rotations", keyRotationHandler.CreateKeyRotation)
+		api.GET("/key-rotations", keyRotationHandler.ListKeyRotations)
+		api.GET("/key-rotations/:id", keyRotationHandler.GetKeyRotation)
+		api.POST("/key-rotations/:id/switch", keyRotationHandler.SwitchKeyRotation)
+		api.POST("/key-rotations/:id/cancel", keyRotationHandler.CancelKeyRotation)
+		api.POST("/key-rotations/:id/rollback", keyRotationHandler.RollbackKeyRotation)
+
+		// Star network master/slave roles
+		api.GET("/star/roles", starRoleHandler.GetRoles)
+		api.POST("/star/handover", starRoleHandler.Handover)
+		api.GET("/star/handovers", starRoleHandler.ListHandovers)
+		api.GET("/star/handovers/:id", starRoleHandler.GetHandover)
+
+		// IP address management
+		api.GET("/ipam/subnets", ipamHandler.ListSubnets)
+		api.POST("/ipam/subnets", ipamHandler.CreateSubnet)
+		api.GET("/ipam/subnets/:id", ipamHandler.GetSubnet)
+		api.PUT("/ipam/subnets/:id", ipamHandler.UpdateSubnet)
+		api.DELETE("/ipam/subnets/:id", ipamHandler.DeleteSubnet)
+		api.POST("/ipam/devices/:id/assign", ipamHandler.AssignAddress)
+		api.GET("/ipam/conflicts", ipamHandler.GetConflicts)
+
 		// Network state config routes
 		api.GET("/devices/:id/configs/net_state", configHandler.GetNetworkConfig)
 		api.PUT("/devices/:id/configs/net_state", configHandler.UpdateNetworkConfig)
@@ -151,6 +347,7 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 		api.GET("/devices/:id/debug/drpr/messages", deviceHandler.GetDRPRMessages)
 		api.GET("/devices/:id/debug/drpr/status", deviceHandler.GetDRPRMonitoringStatus)
 		api.POST("/devices/:id/debug/drpr/test", deviceHandler.TestDRPRFetch) // Test endpoint for debugging
+		api.POST("/devices/:id/debug/drpr/report", deviceHandler.ReportDRPR)
 		api.POST("/devices/:id/debug/switch", deviceHandler.SetDebugSwitch)
 
 		// Topology routes
@@ -172,6 +369,11 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 		api.GET("/devices/:id/alerts", monitorHandler.GetAlerts)
 		api.PUT("/alerts/:id/status", monitorHandler.UpdateAlertStatus)
 		api.GET("/devices/monitor/all", monitorHandler.GetAllDevicesMonitorData)
+
+		// System routes
+		api.GET("/system/workers", systemHandler.GetWorkers)
+		api.GET("/system/boards", systemHandler.GetBoards)
+		api.POST("/system/boards/reload", systemHandler.ReloadBoards)
 	}
 
 	// Serve React app for all non-API routes (must be after API routes)
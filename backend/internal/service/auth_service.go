@@ -1,11 +1,12 @@
 package service
 
 import (
-	"backend/internal/middleware"
+	"backend/internal/config"
 	"backend/internal/model"
 	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -13,16 +14,39 @@ import (
 	"gorm.io/gorm"
 )
 
+// ErrLastAdmin is returned when a change would leave the system without an admin.
+var ErrLastAdmin = errors.New("cannot remove the last admin")
+
 type AuthService struct {
-	db *gorm.DB
+	db          *gorm.DB
+	jwtSecret   string
+	tokenExpiry time.Duration
+	mu          sync.RWMutex
 }
 
-func NewAuthService(db *gorm.DB) *AuthService {
+func NewAuthService(db *gorm.DB, jwtConfig config.JWTConfig) *AuthService {
 	return &AuthService{
-		db: db,
+		db:          db,
+		jwtSecret:   jwtConfig.Secret,
+		tokenExpiry: jwtConfig.ExpiresIn,
 	}
 }
 
+// SetTokenExpiry 更新用户令牌有效期（配置热加载时调用）
+func (s *AuthService) SetTokenExpiry(expiry time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenExpiry = expiry
+}
+
+// IssueUserToken creates a token for a user with the configured lifetime.
+func (s *AuthService) IssueUserToken(userID uint, username string) (string, error) {
+	s.mu.RLock()
+	expiry := s.tokenExpiry
+	s.mu.RUnlock()
+	return s.GenerateToken(userID, username, expiry)
+}
+
 func (s *AuthService) Register(user *model.User) error {
 	log.Printf("Attempting to register user: %s", user.Username)
 
@@ -49,11 +73,26 @@ func (s *AuthService) Register(user *model.User) error {
 	log.Printf("Hashed password: %s", user.Password)
 
 	log.Printf("Creating user in database: %s", user.Username)
-	// Create user
-	if err := s.db.Create(user).Error; err != nil {
+	// 还没有管理员时（新安装）注册的用户成为管理员，之后注册的都是操作员，由管理员修改角色；
+	// 在同一事务中检查和创建，两个同时注册的用户不会都成为管理员
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var admins int64
+		if err := tx.Model(&model.User{}).Where("role = ?", model.RoleAdmin).Count(&admins).Error; err != nil {
+			return err
+		}
+		user.Role = model.RoleOperator
+		if admins == 0 {
+			user.Role = model.RoleAdmin
+		}
+		return tx.Create(user).Error
+	})
+	if err != nil {
 		log.Printf("Failed to create user: %v", err)
 		return err
 	}
+	if user.Role == model.RoleAdmin {
+		log.Printf("No admin user found, granting admin role to %s", user.Username)
+	}
 
 	log.Printf("User created successfully, refreshing user data: %s", user.Username)
 	// Refresh user data to get the ID
@@ -101,7 +140,7 @@ func (s *AuthService) Login(username, password string) (string, *model.User, err
 	}
 
 	// Generate JWT token by calling the new dedicated method
-	tokenString, err := s.GenerateToken(user.ID, user.Username, time.Hour*24)
+	tokenString, err := s.IssueUserToken(user.ID, user.Username)
 	if err != nil {
 		log.Printf("Failed to generate token for user %s: %v", user.Username, err)
 		return "", nil, err
@@ -121,7 +160,7 @@ func (s *AuthService) GenerateToken(userID uint, username string, expiration tim
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	tokenString, err := token.SignedString([]byte(middleware.JWTSecret))
+	tokenString, err := token.SignedString([]byte(s.jwtSecret))
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -129,6 +168,94 @@ func (s *AuthService) GenerateToken(userID uint, username string, expiration tim
 	return tokenString, nil
 }
 
+// ServiceToken 为进程内组件（如集成仿真器）签发短期令牌，剩余有效期不足一半时重新签发
+type ServiceToken struct {
+	auth     *AuthService
+	username string
+	lifetime time.Duration
+
+	mu      sync.Mutex
+	token   string
+	renewAt time.Time
+}
+
+// NewServiceToken 创建进程内组件使用的令牌，令牌只在Token被调用时签发
+func (s *AuthService) NewServiceToken(username string, lifetime time.Duration) *ServiceToken {
+	return &ServiceToken{auth: s, username: username, lifetime: lifetime}
+}
+
+// Token 返回当前令牌，签发失败时返回空字符串（请求会被拒绝为401）
+func (t *ServiceToken) Token() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Before(t.renewAt) {
+		return t.token
+	}
+	token, err := t.auth.GenerateToken(0, t.username, t.lifetime)
+	if err != nil {
+		log.Printf("Failed to issue %s token: %v", t.username, err)
+		return ""
+	}
+	t.token, t.renewAt = token, time.Now().Add(t.lifetime/2)
+	return t.token
+}
+
+// EnsureAdmin 升级前创建的用户没有角色：系统中没有管理员时，将最早注册的用户设为管理员
+func (s *AuthService) EnsureAdmin() error {
+	var admins int64
+	if err := s.db.Model(&model.User{}).Where("role = ?", model.RoleAdmin).Count(&admins).Error; err != nil || admins > 0 {
+		return err
+	}
+	var first model.User
+	if err := s.db.Order("id").First(&first).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	log.Printf("No admin user found, granting admin role to %s", first.Username)
+	return s.db.Model(&first).Update("role", model.RoleAdmin).Error
+}
+
+// SetRole 修改用户角色；不能移除最后一个管理员
+func (s *AuthService) SetRole(username, role string) (*model.User, error) {
+	if role != model.RoleAdmin && role != model.RoleOperator {
+		return nil, fmt.Errorf("unknown role %q (expected %s or %s)", role, model.RoleAdmin, model.RoleOperator)
+	}
+	var user model.User
+	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, err
+	}
+	if user.Role == model.RoleAdmin && role != model.RoleAdmin {
+		var admins int64
+		if err := s.db.Model(&model.User{}).Where("role = ?", model.RoleAdmin).Count(&admins).Error; err != nil {
+			return nil, err
+		}
+		if admins <= 1 {
+			return nil, ErrLastAdmin
+		}
+	}
+	if err := s.db.Model(&user).Update("role", role).Error; err != nil {
+		return nil, err
+	}
+	user.Role = role
+	return &user, nil
+}
+
+// DeleteUser 删除用户；不能删除最后一个管理员
 func (s *AuthService) DeleteUser(username string) error {
-	return s.db.Where("username = ?", username).Delete(&model.User{}).Error
+	var user model.User
+	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
+		return err
+	}
+	if user.Role == model.RoleAdmin {
+		var admins int64
+		if err := s.db.Model(&model.User{}).Where("role = ?", model.RoleAdmin).Count(&admins).Error; err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return ErrLastAdmin
+		}
+	}
+	return s.db.Delete(&user).Error
 }
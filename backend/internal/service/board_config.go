@@ -2,11 +2,13 @@ package service
 
 import (
 	"fmt"
-	"os"
+	"log"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
-
-	"gopkg.in/yaml.v3"
+	"sync"
+	"unicode"
 )
 
 // BoardConfig 单板配置结构
@@ -15,6 +17,20 @@ type BoardConfig struct {
 	Description string                `yaml:"description"`
 	Version     string                `yaml:"version"`
 	Commands    map[string]CommandDef `yaml:"commands"`
+	Radio       *BoardRadio           `yaml:"radio,omitempty"`
+	Firmware    *BoardFirmware        `yaml:"firmware,omitempty"`
+}
+
+// BoardRadio 单板支持的频段和带宽，未声明时使用所有已知的频段和带宽
+type BoardRadio struct {
+	Bands      []string `yaml:"bands" json:"bands"`           // 800M, 1.4G, 2.4G
+	Bandwidths []string `yaml:"bandwidths" json:"bandwidths"` // 1.4M, 3M, 5M, 10M, 20M
+}
+
+// BoardFirmware 单板的HTTP固件升级接口
+type BoardFirmware struct {
+	UploadPath string `yaml:"upload_path" json:"upload_path"` // e.g. /boafrm/formUpload
+	FileField  string `yaml:"file_field" json:"file_field"`   // multipart field of the image
 }
 
 // CommandDef 命令定义结构
@@ -23,6 +39,7 @@ type CommandDef struct {
 	Description    string           `yaml:"description"`
 	ResponseFormat string           `yaml:"response_format,omitempty"`
 	Parameters     []BoardParameter `yaml:"parameters,omitempty"`
+	Destructive    string           `yaml:"destructive,omitempty"` // reboot, factory_reset or shutdown
 }
 
 // BoardParameter 参数定义结构
@@ -35,57 +52,181 @@ type BoardParameter struct {
 	Description string        `yaml:"description"`
 }
 
-// BoardConfigManager 单板配置管理器
+// BoardConfigManager 单板配置管理器。目录中的定义文件在创建时全部加载并校验，
+// Reload可在运行中重新加载；解析失败的文件保留上一次成功加载的定义
 type BoardConfigManager struct {
+	mu        sync.RWMutex
 	configs   map[string]*BoardConfig
+	report    *BoardLoadReport
 	configDir string
 }
 
-// NewBoardConfigManager 创建单板配置管理器
+var (
+	boardManagersMu sync.Mutex
+	boardManagers   = make(map[string]*BoardConfigManager)
+)
+
+// NewBoardConfigManager 创建单板配置管理器并加载目录中的所有定义文件
 func NewBoardConfigManager(configDir string) *BoardConfigManager {
-	return &BoardConfigManager{
+	m := &BoardConfigManager{
 		configs:   make(map[string]*BoardConfig),
 		configDir: configDir,
 	}
+	m.Reload()
+	return m
 }
 
-// LoadBoardConfig 加载指定单板类型的配置
-func (m *BoardConfigManager) LoadBoardConfig(boardType string) (*BoardConfig, error) {
-	// 检查是否已加载
-	if config, exists := m.configs[boardType]; exists {
-		return config, nil
+// SharedBoardConfigManager 返回目录对应的共享管理器，使各服务看到同一份定义，
+// 重新加载一次即对所有服务生效
+func SharedBoardConfigManager(configDir string) *BoardConfigManager {
+	boardManagersMu.Lock()
+	defer boardManagersMu.Unlock()
+	if m, ok := boardManagers[configDir]; ok {
+		return m
+	}
+	m := NewBoardConfigManager(configDir)
+	boardManagers[configDir] = m
+	return m
+}
+
+// Reload 重新加载目录中的所有单板定义文件，在日志中输出并返回加载报告。
+// 无法解析的文件保留原有定义，已删除的文件对应的单板类型被移除
+func (m *BoardConfigManager) Reload() *BoardLoadReport {
+	report := &BoardLoadReport{Dir: m.configDir, Files: []BoardFileReport{}}
+	files, err := boardFiles(m.configDir)
+	if err != nil {
+		report.Files = append(report.Files, BoardFileReport{File: m.configDir, Errors: []string{err.Error()}})
 	}
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	configs := make(map[string]*BoardConfig, len(files))
+	for _, file := range files {
+		boardType := boardTypeFromFile(file)
+		config, fileReport, err := parseBoardFile(file)
+		if err != nil {
+			fileReport.Errors = append(fileReport.Errors, err.Error())
+			if fileReport.BoardType == "" {
+				fileReport.BoardType = boardType
+			}
+			if previous, ok := m.configs[boardType]; ok {
+				configs[boardType] = previous
+				fileReport.Kept = true
+				fileReport.Commands = len(previous.Commands)
+			}
+		} else {
+			fileReport.Loaded = true
+			if config.BoardType != boardType {
+				fileReport.Warnings = append(fileReport.Warnings, fmt.Sprintf("%s: board_type %q does not match the file name; devices select this file as %q",
+					fileReport.File, config.BoardType, boardType))
+			}
+			configs[boardType] = config
+		}
+		report.Files = append(report.Files, fileReport)
+	}
+	for _, f := range report.Files {
+		report.Errors += len(f.Errors)
+		report.Warnings += len(f.Warnings)
+	}
+	m.configs = configs
+	m.report = report
+	logBoardReport(report)
+	return report
+}
+
+// Report 返回最近一次加载的报告
+func (m *BoardConfigManager) Report() *BoardLoadReport {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.report
+}
+
+// BoardTypes 已加载的单板类型
+func (m *BoardConfigManager) BoardTypes() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	types := make([]string, 0, len(m.configs))
+	for boardType := range m.configs {
+		types = append(types, boardType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// LoadBoardConfig 获取指定单板类型的配置，返回的配置不可修改
+func (m *BoardConfigManager) LoadBoardConfig(boardType string) (*BoardConfig, error) {
 	// 处理BoardType，移除可能的"board_"前缀
-	cleanBoardType := boardType
-	if strings.HasPrefix(boardType, "board_") {
-		cleanBoardType = strings.TrimPrefix(boardType, "board_")
+	cleanBoardType := strings.TrimPrefix(boardType, "board_")
+
+	m.mu.RLock()
+	config, exists := m.configs[cleanBoardType]
+	m.mu.RUnlock()
+	if exists {
+		return config, nil
 	}
 
-	// 构建配置文件路径
+	// 启动后新增的文件在Reload之前按需加载
 	configFile := filepath.Join(m.configDir, fmt.Sprintf("board_%s.yaml", cleanBoardType))
-
-	// 读取配置文件
-	data, err := os.ReadFile(configFile)
+	config, report, err := parseBoardFile(configFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read board config file %s: %v", configFile, err)
+		return nil, err
+	}
+	for _, e := range report.Errors {
+		log.Printf("Board config: %s", e)
 	}
 
-	// 解析YAML
-	var config BoardConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse board config file %s: %v", configFile, err)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.configs[cleanBoardType]; ok {
+		return existing, nil
 	}
+	m.configs[cleanBoardType] = config
+	return config, nil
+}
 
-	// 验证配置
-	if config.BoardType == "" {
-		return nil, fmt.Errorf("invalid board config: missing board_type")
+// RadioCapabilities 返回单板支持的频段和带宽
+func (m *BoardConfigManager) RadioCapabilities(boardType string) BoardRadio {
+	radio := BoardRadio{}
+	if config, err := m.LoadBoardConfig(boardType); err == nil && config.Radio != nil {
+		radio = *config.Radio
+	}
+	if len(radio.Bands) == 0 {
+		for _, fb := range frequencyBands {
+			radio.Bands = append(radio.Bands, fb.name)
+		}
+	}
+	if len(radio.Bandwidths) == 0 {
+		radio.Bandwidths = append(radio.Bandwidths, bandwidthOrder...)
 	}
+	return radio
+}
 
-	// 缓存配置
-	m.configs[boardType] = &config
+// FirmwareUpload 返回单板的固件升级接口，未声明时返回错误
+func (m *BoardConfigManager) FirmwareUpload(boardType string) (*BoardFirmware, error) {
+	config, err := m.LoadBoardConfig(boardType)
+	if err != nil {
+		return nil, err
+	}
+	if config.Firmware == nil {
+		return nil, fmt.Errorf("board type %s has no firmware upload interface", boardType)
+	}
+	return config.Firmware, nil
+}
 
-	return &config, nil
+// logBoardReport 在日志中输出加载报告，错误逐条列出
+func logBoardReport(report *BoardLoadReport) {
+	if report == nil {
+		return
+	}
+	for _, f := range report.Files {
+		log.Printf("Board config %s: board_type=%s commands=%d errors=%d warnings=%d", f.File, f.BoardType, f.Commands, len(f.Errors), len(f.Warnings))
+		for _, e := range f.Errors {
+			log.Printf("Board config error: %s", e)
+		}
+		for _, w := range f.Warnings {
+			log.Printf("Board config warning: %s", w)
+		}
+	}
 }
 
 // GetCommand 获取指定命令的定义
@@ -103,8 +244,17 @@ func (m *BoardConfigManager) GetCommand(boardType, commandName string) (*Command
 	return &command, nil
 }
 
-// FormatATCommand 格式化AT命令（替换参数）
+// FormatATCommand 格式化AT命令（替换参数），参数按单板配置校验
 func (m *BoardConfigManager) FormatATCommand(boardType, commandName string, params map[string]interface{}) (string, error) {
+	return m.FormatATCommandWithContext(boardType, commandName, params, nil)
+}
+
+// FormatATCommandWithContext 格式化AT命令，并按设备当前配置执行交叉校验
+func (m *BoardConfigManager) FormatATCommandWithContext(boardType, commandName string, params map[string]interface{}, vctx *ValidationContext) (string, error) {
+	normalized, err := m.ValidateCommand(boardType, commandName, params, vctx)
+	if err != nil {
+		return "", err
+	}
 	command, err := m.GetCommand(boardType, commandName)
 	if err != nil {
 		return "", err
@@ -118,17 +268,7 @@ func (m *BoardConfigManager) FormatATCommand(boardType, commandName string, para
 	// 构建参数列表
 	var args []interface{}
 	for _, param := range command.Parameters {
-		value, exists := params[param.Name]
-		if !exists {
-			return "", fmt.Errorf("missing required parameter: %s", param.Name)
-		}
-
-		// 验证参数值
-		if err := m.validateParameter(param, value); err != nil {
-			return "", fmt.Errorf("invalid parameter %s: %v", param.Name, err)
-		}
-
-		args = append(args, value)
+		args = append(args, normalized[param.Name])
 	}
 
 	// 格式化命令
@@ -136,82 +276,105 @@ func (m *BoardConfigManager) FormatATCommand(boardType, commandName string, para
 	return formatted, nil
 }
 
-// validateParameter 验证参数值
-func (m *BoardConfigManager) validateParameter(param BoardParameter, value interface{}) error {
-	switch param.Type {
-	case "int":
-		// 检查是否在指定范围内
-		if len(param.Range) == 2 {
-			intVal, ok := value.(int)
-			if !ok {
-				return fmt.Errorf("expected int, got %T", value)
-			}
-			if intVal < param.Range[0] || intVal > param.Range[1] {
-				return fmt.Errorf("value %d out of range [%d, %d]", intVal, param.Range[0], param.Range[1])
-			}
-		}
+// GetAvailableCommands 获取指定单板类型的所有可用命令
+func (m *BoardConfigManager) GetAvailableCommands(boardType string) (map[string]CommandDef, error) {
+	config, err := m.LoadBoardConfig(boardType)
+	if err != nil {
+		return nil, err
+	}
 
-		// 检查是否在指定值列表中
-		if len(param.Values) > 0 {
-			found := false
-			for _, allowedValue := range param.Values {
-				if value == allowedValue {
-					found = true
-					break
-				}
-			}
-			if !found {
-				return fmt.Errorf("value %v not in allowed values %v", value, param.Values)
-			}
-		}
+	return config.Commands, nil
+}
 
-	case "string":
-		strVal, ok := value.(string)
-		if !ok {
-			return fmt.Errorf("expected string, got %T", value)
+// DestructiveCommand 判断AT命令是否为单板定义中标记为destructive的命令，返回命令名称和类别。
+// 按命令名和参数比较而不是按原文匹配，AT+CFUN=00、at+cfun= 0,1都按AT+CFUN=0处理。
+// 先匹配设备所属单板的定义，再匹配其他已加载的单板，同一条命令在任何单板上都按危险命令处理
+func (m *BoardConfigManager) DestructiveCommand(boardType, command string) (string, string) {
+	name, args := splitATCommand(compactCommand(command))
+	if name == "" {
+		return "", ""
+	}
+	boardTypes := []string{strings.TrimPrefix(boardType, "board_")}
+	for _, t := range m.BoardTypes() {
+		if t != boardTypes[0] {
+			boardTypes = append(boardTypes, t)
 		}
-
-		// 检查正则表达式模式
-		if param.Pattern != "" {
-			// 这里可以添加正则表达式验证
-			// 简化处理：检查是否为十六进制字符串
-			if strings.Contains(param.Pattern, "[0-9A-Fa-f]+") {
-				for _, char := range strVal {
-					if !((char >= '0' && char <= '9') ||
-						(char >= 'A' && char <= 'F') ||
-						(char >= 'a' && char <= 'f')) {
-						return fmt.Errorf("value %s does not match hex pattern", strVal)
-					}
-				}
-			}
+	}
+	for _, t := range boardTypes {
+		config, err := m.LoadBoardConfig(t)
+		if err != nil {
+			continue
 		}
-
-		// 检查是否在指定值列表中
-		if len(param.Values) > 0 {
-			found := false
-			for _, allowedValue := range param.Values {
-				if value == allowedValue {
-					found = true
-					break
-				}
-			}
-			if !found {
-				return fmt.Errorf("value %v not in allowed values %v", value, param.Values)
+		names := make([]string, 0, len(config.Commands))
+		for name := range config.Commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, defName := range names {
+			def := config.Commands[defName]
+			if def.Destructive != "" && commandMatches(def.ATCommand, name, args) {
+				return defName, def.Destructive
 			}
 		}
 	}
+	return "", ""
+}
 
-	return nil
+// compactCommand 去掉引号外的空白并转为大写，使"at+cfun= 0"与"AT+CFUN=0"按同一条命令匹配
+func compactCommand(command string) string {
+	var b strings.Builder
+	quoted := false
+	for _, r := range strings.ToUpper(command) {
+		if r == '"' {
+			quoted = !quoted
+		}
+		if !quoted && unicode.IsSpace(r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
 }
 
-// GetAvailableCommands 获取指定单板类型的所有可用命令
-func (m *BoardConfigManager) GetAvailableCommands(boardType string) (map[string]CommandDef, error) {
-	config, err := m.LoadBoardConfig(boardType)
-	if err != nil {
-		return nil, err
+// splitATCommand 将已压缩的AT命令拆成命令名（如AT+CFUN）和参数；没有=时参数为空
+func splitATCommand(command string) (string, []string) {
+	eq := strings.Index(command, "=")
+	if eq < 0 {
+		return command, nil
 	}
+	return command[:eq], strings.Split(command[eq+1:], ",")
+}
 
-	return config.Commands, nil
+// commandMatches 判断命令是否为format定义的命令：命令名相同，format的每个参数都有对应值——
+// %d匹配任意整数，其他格式化参数匹配任意值，整数按数值比较，其余不区分大小写按原文比较。
+// 命令多出的参数（如AT+CFUN=0,1的复位参数）不影响判断
+func commandMatches(format, name string, args []string) bool {
+	wantName, wantArgs := splitATCommand(compactCommand(format))
+	if wantName == "" || wantName != name || len(args) < len(wantArgs) {
+		return false
+	}
+	for i, want := range wantArgs {
+		got := strings.Trim(args[i], `"`)
+		if verb := formatVerbPattern.FindString(want); verb == want && verb != "%%" {
+			if strings.EqualFold(verb[len(verb)-1:], "d") {
+				if _, err := strconv.Atoi(got); err != nil {
+					return false
+				}
+			}
+			continue
+		}
+		want = strings.Trim(want, `"`)
+		w, errW := strconv.Atoi(want)
+		g, errG := strconv.Atoi(got)
+		if errW == nil && errG == nil {
+			if w != g {
+				return false
+			}
+		} else if want != got {
+			return false
+		}
+	}
+	return true
 }
 
 // GetBoardConfig 获取完整的板级配置
@@ -0,0 +1,66 @@
+package service
+
+import "testing"
+
+func TestCompactCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{command: "AT+CFUN=0", want: "AT+CFUN=0"},
+		{command: "at+cfun= 0", want: "AT+CFUN=0"},
+		{command: " AT + CFUN =\t0\r\n", want: "AT+CFUN=0"},
+		{command: `AT^DAPI="ab cd"`, want: `AT^DAPI="AB CD"`},
+		{command: `AT^X="a b", 1`, want: `AT^X="A B",1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := compactCommand(tt.command); got != tt.want {
+				t.Errorf("compactCommand(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDestructiveCommand(t *testing.T) {
+	m := NewBoardConfigManager("../../config/boards")
+	tests := []struct {
+		name      string
+		boardType string
+		command   string
+		wantName  string
+		wantKind  string
+	}{
+		{name: "shutdown", boardType: "2.0_mesh", command: "AT+CFUN=0", wantName: "power_off_radio", wantKind: DestructiveShutdown},
+		{name: "lower case", boardType: "2.0_mesh", command: "at+cfun=0", wantName: "power_off_radio", wantKind: DestructiveShutdown},
+		{name: "space after equals", boardType: "2.0_mesh", command: "AT+CFUN= 0", wantName: "power_off_radio", wantKind: DestructiveShutdown},
+		{name: "space before equals", boardType: "2.0_mesh", command: "AT+CFUN =0", wantName: "power_off_radio", wantKind: DestructiveShutdown},
+		{name: "spaces and tabs everywhere", boardType: "2.0_mesh", command: " AT + CFUN =\t0 ", wantName: "power_off_radio", wantKind: DestructiveShutdown},
+		{name: "trailing line ending", boardType: "2.0_mesh", command: "AT+CFUN=0\r\n", wantName: "power_off_radio", wantKind: DestructiveShutdown},
+		{name: "board_ prefix", boardType: "board_2.0_mesh", command: "AT^POWERCTL=1", wantName: "reboot_device", wantKind: DestructiveReboot},
+		{name: "factory reset", boardType: "2.0_mesh", command: "AT^RECOVSET = 1", wantName: "restore_factory_settings", wantKind: DestructiveFactoryReset},
+		{name: "numeric parameter with spaces", boardType: "2.0_star", command: "AT^POWERCTL= 2", wantName: "set_powerctl", wantKind: DestructiveReboot},
+		{name: "matched on another board", boardType: "2.0_mesh", command: "AT^POWERCTL=2", wantName: "set_powerctl", wantKind: DestructiveReboot},
+		{name: "leading zeros", boardType: "2.0_mesh", command: "AT+CFUN=00", wantName: "power_off_radio", wantKind: DestructiveShutdown},
+		{name: "extra parameter", boardType: "2.0_mesh", command: "at+cfun=0,1", wantName: "power_off_radio", wantKind: DestructiveShutdown},
+		{name: "quoted numeric parameter", boardType: "2.0_mesh", command: `AT+CFUN="0"`, wantName: "power_off_radio", wantKind: DestructiveShutdown},
+		{name: "reboot with leading zeros", boardType: "2.0_mesh", command: "AT^POWERCTL=001", wantName: "reboot_device", wantKind: DestructiveReboot},
+		{name: "factory reset with extra parameter", boardType: "2.0_mesh", command: "AT^RECOVSET=+1,0", wantName: "restore_factory_settings", wantKind: DestructiveFactoryReset},
+		{name: "command without parameters", boardType: "1.0_mesh", command: "at+reboot", wantName: "reboot_device", wantKind: DestructiveReboot},
+		{name: "radio on", boardType: "2.0_mesh", command: "AT+CFUN=1"},
+		{name: "radio on with extra parameter", boardType: "2.0_mesh", command: "AT+CFUN=1,1"},
+		{name: "test command", boardType: "2.0_mesh", command: "AT+CFUN=?"},
+		{name: "query", boardType: "2.0_mesh", command: "AT+CFUN?"},
+		{name: "leading zero on another value", boardType: "2.0_mesh", command: "AT+CFUN=01"},
+		{name: "other command with the same prefix", boardType: "2.0_mesh", command: "AT+CFUNX=0"},
+		{name: "inside a quoted value", boardType: "2.0_mesh", command: `AT^DAPI="AT+CFUN=0"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, kind := m.DestructiveCommand(tt.boardType, tt.command)
+			if name != tt.wantName || kind != tt.wantKind {
+				t.Errorf("DestructiveCommand(%q, %q) = (%q, %q), want (%q, %q)", tt.boardType, tt.command, name, kind, tt.wantName, tt.wantKind)
+			}
+		})
+	}
+}
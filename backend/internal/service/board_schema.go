@@ -0,0 +1,398 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 单板定义文件(config/boards/board_<type>.yaml)的规范格式：
+//
+//	board_type: "2.0_mesh"
+//	description: "..."
+//	version: "2.0"
+//	commands:
+//	  set_radio_params:
+//	    at_command: "AT^DRPC=%d,%d,\"%s\""   # 每个参数一个%d(int)或%s(string)
+//	    description: "..."
+//	    response_format: "text"              # 可选
+//	    destructive: "reboot"                # 可选：reboot、factory_reset或shutdown，下发前需确认
+//	    parameters:                          # 按AT命令中的顺序排列
+//	      - name: "freq"
+//	        type: "int"                      # int 或 string
+//	        range: [8060, 24814]             # 可选，仅int
+//	        values: [0, 1, 2]                # 可选
+//	        pattern: "^[0-9A-F]+$"           # 可选，仅string
+//	        description: "..."
+//	radio:                                   # 可选，频率规划使用
+//	  bands: ["1.4G", "2.4G"]
+//	  bandwidths: ["1.4M", "3M", "5M", "10M", "20M"]
+//	firmware:                                # 可选，固件升级使用；未声明的单板不能升级
+//	  upload_path: "/boafrm/formUpload"      # 单板HTTP升级接口
+//	  file_field: "binary"                   # 可选，multipart中镜像文件的字段名，默认binary
+//
+// 旧格式（board_1.0_mesh.yaml）使用at_commands、command和参数名到类型的映射
+// （mode: "string", channel: "number"），加载时按参数顺序补全AT命令的格式化参数。
+
+// Parameter types of the board schema
+const (
+	BoardParamInt    = "int"
+	BoardParamString = "string"
+)
+
+// Destructive command kinds of the board schema
+const (
+	DestructiveReboot       = "reboot"
+	DestructiveFactoryReset = "factory_reset"
+	DestructiveShutdown     = "shutdown"
+)
+
+// legacyParamTypes 旧格式参数类型到规范类型的对应
+var legacyParamTypes = map[string]string{
+	"int":     BoardParamInt,
+	"integer": BoardParamInt,
+	"number":  BoardParamInt,
+	"string":  BoardParamString,
+}
+
+// formatVerbPattern AT命令中的格式化参数，%%不算
+var formatVerbPattern = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+// BoardFileReport is the load result of one board definition file.
+type BoardFileReport struct {
+	File      string   `json:"file"`
+	BoardType string   `json:"board_type"`
+	Legacy    bool     `json:"legacy,omitempty"` // at_commands format, normalized on load
+	Commands  int      `json:"commands"`
+	Loaded    bool     `json:"loaded"`         // false: the file was rejected
+	Kept      bool     `json:"kept,omitempty"` // rejected, the previously loaded definition is still used
+	Errors    []string `json:"errors,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+// BoardLoadReport is the result of loading every board definition file.
+type BoardLoadReport struct {
+	Dir      string            `json:"dir"`
+	Files    []BoardFileReport `json:"files"`
+	Errors   int               `json:"errors"`
+	Warnings int               `json:"warnings"`
+}
+
+// rawBoardFile accepts both the commands and the legacy at_commands layout.
+type rawBoardFile struct {
+	BoardType   string         `yaml:"board_type"`
+	BoardName   string         `yaml:"board_name"`
+	Description string         `yaml:"description"`
+	Version     string         `yaml:"version"`
+	Commands    yaml.Node      `yaml:"commands"`
+	ATCommands  yaml.Node      `yaml:"at_commands"`
+	Radio       *BoardRadio    `yaml:"radio"`
+	Firmware    *BoardFirmware `yaml:"firmware"`
+}
+
+type rawCommand struct {
+	ATCommand      string    `yaml:"at_command"`
+	Command        string    `yaml:"command"` // legacy
+	Description    string    `yaml:"description"`
+	ResponseFormat string    `yaml:"response_format"`
+	Parameters     yaml.Node `yaml:"parameters"`
+	Destructive    string    `yaml:"destructive"`
+}
+
+// parseBoardFile 解析并规范化单板定义文件。返回的错误表示整个文件无法使用；
+// 有问题的单条命令会被跳过并记录在report中
+func parseBoardFile(path string) (*BoardConfig, BoardFileReport, error) {
+	report := BoardFileReport{File: filepath.Base(path)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, report, fmt.Errorf("failed to read board config file %s: %v", path, err)
+	}
+	var raw rawBoardFile
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, report, fmt.Errorf("failed to parse board config file %s: %v", path, err)
+	}
+	if raw.BoardType == "" {
+		return nil, report, fmt.Errorf("invalid board config %s: missing board_type", report.File)
+	}
+	report.BoardType = raw.BoardType
+
+	commandsNode := &raw.Commands
+	switch {
+	case raw.Commands.Kind != 0 && raw.ATCommands.Kind != 0:
+		return nil, report, fmt.Errorf("invalid board config %s: both commands (line %d) and at_commands (line %d) are defined", report.File, raw.Commands.Line, raw.ATCommands.Line)
+	case raw.ATCommands.Kind != 0:
+		commandsNode = &raw.ATCommands
+		report.Legacy = true
+	case raw.Commands.Kind == 0:
+		return nil, report, fmt.Errorf("invalid board config %s: no commands defined", report.File)
+	}
+	if commandsNode.Kind != yaml.MappingNode {
+		return nil, report, fmt.Errorf("invalid board config %s:%d: commands must be a mapping of command name to definition", report.File, commandsNode.Line)
+	}
+
+	config := &BoardConfig{
+		BoardType:   raw.BoardType,
+		Description: raw.Description,
+		Version:     raw.Version,
+		Commands:    make(map[string]CommandDef),
+	}
+	if config.Description == "" {
+		config.Description = raw.BoardName
+	}
+	if raw.Radio != nil {
+		if errs := checkBoardRadio(raw.Radio); len(errs) > 0 {
+			for _, e := range errs {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s radio: %s", report.File, e))
+			}
+		} else {
+			config.Radio = raw.Radio
+		}
+	}
+
+	if raw.Firmware != nil {
+		if errs := checkBoardFirmware(raw.Firmware); len(errs) > 0 {
+			for _, e := range errs {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s firmware: %s", report.File, e))
+			}
+		} else {
+			config.Firmware = raw.Firmware
+		}
+	}
+
+	firstLine := make(map[string]int)
+	atCommands := make(map[string]string)
+	for i := 0; i+1 < len(commandsNode.Content); i += 2 {
+		keyNode, valueNode := commandsNode.Content[i], commandsNode.Content[i+1]
+		name := keyNode.Value
+		where := fmt.Sprintf("%s:%d %s", report.File, keyNode.Line, name)
+		if line, dup := firstLine[name]; dup {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: duplicate command, already defined at line %d; the later definition is ignored", where, line))
+			continue
+		}
+		firstLine[name] = keyNode.Line
+
+		command, errs, warnings := normalizeCommand(valueNode, report.Legacy)
+		for _, w := range warnings {
+			report.Warnings = append(report.Warnings, where+": "+w)
+		}
+		if len(errs) > 0 {
+			for _, e := range errs {
+				report.Errors = append(report.Errors, where+": "+e)
+			}
+			continue
+		}
+		// 不同名称映射到同一条AT命令通常是复制粘贴错误
+		if other, ok := atCommands[command.ATCommand]; ok {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s: same AT command %q as %s", where, command.ATCommand, other))
+		} else {
+			atCommands[command.ATCommand] = name
+		}
+		config.Commands[name] = command
+	}
+
+	report.Commands = len(config.Commands)
+	return config, report, nil
+}
+
+// normalizeCommand 将一条命令转换为规范格式并检查其结构
+func normalizeCommand(node *yaml.Node, legacy bool) (CommandDef, []string, []string) {
+	var errs, warnings []string
+	if node.Kind != yaml.MappingNode {
+		return CommandDef{}, []string{"definition must be a mapping"}, nil
+	}
+	var raw rawCommand
+	if err := node.Decode(&raw); err != nil {
+		return CommandDef{}, []string{err.Error()}, nil
+	}
+	command := CommandDef{
+		ATCommand:      raw.ATCommand,
+		Description:    raw.Description,
+		ResponseFormat: raw.ResponseFormat,
+		Destructive:    raw.Destructive,
+	}
+	switch command.Destructive {
+	case "", DestructiveReboot, DestructiveFactoryReset, DestructiveShutdown:
+	default:
+		errs = append(errs, fmt.Sprintf("unknown destructive kind %q (expected reboot, factory_reset or shutdown)", command.Destructive))
+	}
+	if command.ATCommand == "" {
+		command.ATCommand = raw.Command
+	} else if raw.Command != "" {
+		warnings = append(warnings, "both at_command and command are set; command is ignored")
+	}
+	if command.ATCommand == "" {
+		return command, append(errs, "missing at_command"), warnings
+	}
+	if !strings.HasPrefix(strings.ToUpper(command.ATCommand), "AT") {
+		errs = append(errs, fmt.Sprintf("at_command %q does not start with AT", command.ATCommand))
+	}
+
+	params, paramErrs := normalizeParameters(&raw.Parameters)
+	errs = append(errs, paramErrs...)
+	command.Parameters = params
+
+	verbs := formatVerbs(command.ATCommand)
+	// 旧格式的AT命令不带格式化参数，按参数顺序补全
+	if legacy && len(verbs) == 0 && len(params) > 0 {
+		for _, p := range params {
+			if p.Type == BoardParamInt {
+				verbs = append(verbs, "%d")
+			} else {
+				verbs = append(verbs, "%s")
+			}
+		}
+		command.ATCommand += "=" + strings.Join(verbs, ",")
+	}
+	if len(verbs) != len(params) {
+		errs = append(errs, fmt.Sprintf("at_command %q has %d format verbs but %d parameters", command.ATCommand, len(verbs), len(params)))
+	} else {
+		for i, p := range params {
+			if p.Type == BoardParamInt && verbs[i] != "%d" {
+				errs = append(errs, fmt.Sprintf("parameter %s is an int but is formatted with %s", p.Name, verbs[i]))
+			}
+			if p.Type == BoardParamString && verbs[i] != "%s" && verbs[i] != "%v" {
+				errs = append(errs, fmt.Sprintf("parameter %s is a string but is formatted with %s", p.Name, verbs[i]))
+			}
+		}
+	}
+	return command, errs, warnings
+}
+
+// normalizeParameters 接受参数列表，或旧格式的参数名到类型的映射（保持文件中的顺序）
+func normalizeParameters(node *yaml.Node) ([]BoardParameter, []string) {
+	var params []BoardParameter
+	var errs []string
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.SequenceNode:
+		if err := node.Decode(&params); err != nil {
+			return nil, []string{fmt.Sprintf("invalid parameters: %v", err)}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name, value := node.Content[i].Value, node.Content[i+1]
+			param := BoardParameter{Name: name}
+			if value.Kind == yaml.ScalarNode {
+				param.Type = value.Value
+			} else if err := value.Decode(&param); err != nil {
+				errs = append(errs, fmt.Sprintf("invalid parameter %s: %v", name, err))
+				continue
+			}
+			param.Name = name
+			if t, ok := legacyParamTypes[param.Type]; ok {
+				param.Type = t
+			}
+			params = append(params, param)
+		}
+	default:
+		return nil, []string{"parameters must be a list or a mapping"}
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range params {
+		errs = append(errs, checkBoardParameter(p, seen)...)
+	}
+	return params, errs
+}
+
+func checkBoardParameter(p BoardParameter, seen map[string]bool) []string {
+	var errs []string
+	if p.Name == "" {
+		return []string{"parameter without name"}
+	}
+	if seen[p.Name] {
+		errs = append(errs, fmt.Sprintf("duplicate parameter %s", p.Name))
+	}
+	seen[p.Name] = true
+
+	switch p.Type {
+	case BoardParamInt:
+		for _, v := range p.Values {
+			if _, ok := intValue(v); !ok {
+				errs = append(errs, fmt.Sprintf("parameter %s: value %v is not an integer", p.Name, v))
+			}
+		}
+		if p.Pattern != "" {
+			errs = append(errs, fmt.Sprintf("parameter %s: pattern only applies to string parameters", p.Name))
+		}
+	case BoardParamString:
+		if p.Pattern != "" {
+			if _, err := compilePattern(p.Pattern); err != nil {
+				errs = append(errs, fmt.Sprintf("parameter %s: invalid pattern %q: %v", p.Name, p.Pattern, err))
+			}
+		}
+		if len(p.Range) > 0 {
+			errs = append(errs, fmt.Sprintf("parameter %s: range only applies to int parameters", p.Name))
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("parameter %s: unknown type %q (expected int or string)", p.Name, p.Type))
+	}
+	if len(p.Range) > 0 && (len(p.Range) != 2 || p.Range[0] > p.Range[1]) {
+		errs = append(errs, fmt.Sprintf("parameter %s: range must be [min, max], got %v", p.Name, p.Range))
+	}
+	return errs
+}
+
+// checkBoardRadio 频段和带宽必须是已知的名称
+func checkBoardRadio(radio *BoardRadio) []string {
+	var errs []string
+	for _, band := range radio.Bands {
+		known := false
+		for _, fb := range frequencyBands {
+			known = known || fb.name == band
+		}
+		if !known {
+			errs = append(errs, fmt.Sprintf("unknown band %q", band))
+		}
+	}
+	for _, bw := range radio.Bandwidths {
+		if _, ok := bandwidthValues[bw]; !ok {
+			errs = append(errs, fmt.Sprintf("unknown bandwidth %q", bw))
+		}
+	}
+	return errs
+}
+
+// checkBoardFirmware 升级接口必须是绝对路径，文件字段名缺省为binary
+func checkBoardFirmware(firmware *BoardFirmware) []string {
+	var errs []string
+	if !strings.HasPrefix(firmware.UploadPath, "/") {
+		errs = append(errs, fmt.Sprintf("upload_path %q must start with /", firmware.UploadPath))
+	}
+	if firmware.FileField == "" {
+		firmware.FileField = "binary"
+	}
+	return errs
+}
+
+// formatVerbs 返回AT命令中的格式化参数，如 ["%d", "%d", "%s"]
+func formatVerbs(atCommand string) []string {
+	var verbs []string
+	for _, verb := range formatVerbPattern.FindAllString(atCommand, -1) {
+		if verb != "%%" {
+			verbs = append(verbs, verb)
+		}
+	}
+	return verbs
+}
+
+// boardFiles 列出目录中的单板定义文件
+func boardFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "board_*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// boardTypeFromFile board_2.0_mesh.yaml -> 2.0_mesh
+func boardTypeFromFile(path string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "board_"), ".yaml")
+}
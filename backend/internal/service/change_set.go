@@ -0,0 +1,345 @@
+package service
+
+import (
+	"backend/internal/model"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Change step states
+const (
+	StepPending        = "pending"
+	StepApplied        = "applied"
+	StepFailed         = "failed"
+	StepRolledBack     = "rolled_back"
+	StepRollbackFailed = "rollback_failed"
+	StepSkipped        = "skipped"
+)
+
+// ChangeStep is one set command of a change set, e.g. AT^DRPS=24020,2,"27".
+// Its query command (AT^DRPS?) is derived from the set command.
+type ChangeStep struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+}
+
+// ChangeStepResult reports what happened to one step.
+type ChangeStepResult struct {
+	Name          string `json:"name"`
+	Command       string `json:"command"`
+	Query         string `json:"query"`
+	Before        string `json:"before"` // value captured before the change set ran
+	Status        string `json:"status"`
+	Response      string `json:"response,omitempty"`
+	Verification  string `json:"verification,omitempty"`
+	Error         string `json:"error,omitempty"`
+	Rollback      string `json:"rollback,omitempty"` // compensating command that was sent
+	RollbackError string `json:"rollback_error,omitempty"`
+}
+
+// ChangeSetResult is the outcome of a change set.
+type ChangeSetResult struct {
+	DeviceID   uint               `json:"device_id"`
+	Success    bool               `json:"success"`
+	RolledBack bool               `json:"rolled_back"`
+	Error      string             `json:"error,omitempty"`
+	Steps      []ChangeStepResult `json:"steps"`
+}
+
+// ChangeSetExecutor 多条AT设置命令的原子下发：先读取原值，按顺序下发并验证，
+// 任一步失败则用原值发送补偿命令恢复已修改的参数
+type ChangeSetExecutor struct {
+	deviceComm *DeviceCommService
+}
+
+// NewChangeSetExecutor 创建变更集执行器
+func NewChangeSetExecutor(deviceComm *DeviceCommService) *ChangeSetExecutor {
+	return &ChangeSetExecutor{deviceComm: deviceComm}
+}
+
+// Apply runs steps in order on the device. Nothing is sent if the current
+// values cannot be captured; after a failed step every step up to and
+// including it is restored in reverse order.
+func (e *ChangeSetExecutor) Apply(deviceID uint, steps []ChangeStep) (*ChangeSetResult, error) {
+	device, err := e.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %v", err)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("change set is empty")
+	}
+
+	result := &ChangeSetResult{DeviceID: deviceID, Steps: make([]ChangeStepResult, len(steps))}
+	for i, step := range steps {
+		query, err := queryForSetCommand(step.Command)
+		if err != nil {
+			return nil, err
+		}
+		result.Steps[i] = ChangeStepResult{Name: step.Name, Command: step.Command, Query: query, Status: StepPending}
+	}
+
+	// 1. 读取每一步对应参数的当前值
+	for i := range result.Steps {
+		step := &result.Steps[i]
+		before, err := e.readValue(device, step.Query)
+		if err != nil {
+			step.Error = fmt.Sprintf("failed to capture current value: %v", err)
+			result.Error = fmt.Sprintf("step %q: %s", step.Name, step.Error)
+			markRemaining(result.Steps, StepSkipped)
+			return result, nil
+		}
+		step.Before = before
+	}
+
+	// 2. 按顺序下发并验证
+	for i := range result.Steps {
+		step := &result.Steps[i]
+		if err := e.applyStep(device, step); err != nil {
+			step.Status = StepFailed
+			step.Error = err.Error()
+			result.Error = fmt.Sprintf("step %q failed: %v", step.Name, err)
+			markRemaining(result.Steps[i+1:], StepSkipped)
+			// 3. 逆序恢复已执行（包括失败）的步骤
+			result.RolledBack = e.rollback(device, result.Steps[:i+1])
+			return result, nil
+		}
+		step.Status = StepApplied
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+func (e *ChangeSetExecutor) applyStep(device *model.Device, step *ChangeStepResult) error {
+	response, err := e.deviceComm.SendATCommand(device.ID, step.Command)
+	step.Response = response
+	if err != nil {
+		return err
+	}
+	if strings.Contains(response, "ERROR") {
+		return fmt.Errorf("device rejected command: %s", strings.TrimSpace(response))
+	}
+
+	actual, err := e.readValue(device, step.Query)
+	step.Verification = actual
+	if err != nil {
+		return fmt.Errorf("verification failed: %v", err)
+	}
+	if !fieldsMatch(setCommandArgs(step.Command), valueFields(actual)) {
+		return fmt.Errorf("verification failed: device reports %q after %s", actual, step.Command)
+	}
+	return nil
+}
+
+// Revert restores the values captured by a successful Apply, e.g. when a
+// later stage of a larger change fails. It reports whether every step was
+// restored; result.Steps carry the outcome.
+func (e *ChangeSetExecutor) Revert(deviceID uint, result *ChangeSetResult) (bool, error) {
+	device, err := e.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get device: %v", err)
+	}
+	var applied []ChangeStepResult
+	for _, step := range result.Steps {
+		if step.Status == StepApplied {
+			applied = append(applied, step)
+		}
+	}
+	ok := e.rollback(device, applied)
+	for _, step := range applied {
+		for i := range result.Steps {
+			if result.Steps[i].Command == step.Command {
+				result.Steps[i] = step
+			}
+		}
+	}
+	result.RolledBack = ok
+	return ok, nil
+}
+
+// rollback restores the captured values in reverse order and reports whether
+// every step was restored.
+func (e *ChangeSetExecutor) rollback(device *model.Device, steps []ChangeStepResult) bool {
+	ok := true
+	for i := len(steps) - 1; i >= 0; i-- {
+		step := &steps[i]
+		restore := restoreCommand(step.Command, step.Before)
+		step.Rollback = restore
+		if _, err := e.deviceComm.SendATCommand(device.ID, restore); err != nil {
+			step.Status = StepRollbackFailed
+			step.RollbackError = err.Error()
+			ok = false
+			continue
+		}
+		if actual, err := e.readValue(device, step.Query); err != nil || !fieldsMatch(valueFields(step.Before), valueFields(actual)) {
+			step.Status = StepRollbackFailed
+			step.RollbackError = fmt.Sprintf("device reports %q after restore, expected %q", actual, step.Before)
+			ok = false
+			continue
+		}
+		if step.Status != StepFailed {
+			step.Status = StepRolledBack
+		}
+	}
+	if !ok {
+		log.Printf("Change set rollback on device %d incomplete, device may be inconsistent", device.ID)
+	}
+	return ok
+}
+
+// readValue sends the query through verifySetting when the board config
+// knows it, otherwise as a raw command, and returns the reported value.
+func (e *ChangeSetExecutor) readValue(device *model.Device, query string) (string, error) {
+	var response string
+	var err error
+	if name := e.queryCommandName(device.BoardType, query); name != "" {
+		response, err = e.deviceComm.verifySetting(device.ID, device, name)
+	} else {
+		response, err = e.deviceComm.sendHTTPRequestToDevice(device, ATCommandRequest{Command: query, Timeout: 10})
+		if err == nil {
+			e.deviceComm.logCommandExecution(device.ID, query, response, "")
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return extractReportedValue(query, response)
+}
+
+// queryCommandName finds the board command whose AT string is query.
+func (e *ChangeSetExecutor) queryCommandName(boardType, query string) string {
+	commands, err := e.deviceComm.boardConfigMgr.GetAvailableCommands(boardType)
+	if err != nil {
+		return ""
+	}
+	for name, cmd := range commands {
+		if cmd.ATCommand == query {
+			return name
+		}
+	}
+	return ""
+}
+
+func markRemaining(steps []ChangeStepResult, status string) {
+	for i := range steps {
+		if steps[i].Status == StepPending {
+			steps[i].Status = status
+		}
+	}
+}
+
+// queryForSetCommand turns AT^DRPS=1,2,3 into AT^DRPS?.
+func queryForSetCommand(command string) (string, error) {
+	eq := strings.Index(command, "=")
+	if !strings.HasPrefix(command, "AT") || eq < 0 {
+		return "", fmt.Errorf("not an AT set command: %s", command)
+	}
+	return command[:eq] + "?", nil
+}
+
+// extractReportedValue returns the text after "^DRPS:" in a query response.
+func extractReportedValue(query, response string) (string, error) {
+	if strings.Contains(response, "ERROR") {
+		return "", fmt.Errorf("query %s failed: %s", query, strings.TrimSpace(response))
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(query, "AT"), "?")
+	idx := strings.Index(response, name+":")
+	if idx < 0 && strings.HasPrefix(name, "+") {
+		// 部分固件对AT+命令也以^前缀回复
+		name = "^" + name[1:]
+		idx = strings.Index(response, name+":")
+	}
+	if idx < 0 {
+		return "", fmt.Errorf("unexpected response to %s: %q", query, response)
+	}
+	value := response[idx+len(name)+1:]
+	if end := strings.IndexAny(value, "\r\n"); end >= 0 {
+		value = value[:end]
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// setCommandArgs returns the raw arguments of a set command.
+func setCommandArgs(command string) []string {
+	eq := strings.Index(command, "=")
+	if eq < 0 {
+		return nil
+	}
+	return splitFields(command[eq+1:])
+}
+
+// valueFields splits a reported value. Grouped values such as
+// "(14700,5),(14900,5)" only use the first group.
+func valueFields(value string) []string {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "(") {
+		if end := strings.Index(value, ")"); end > 0 {
+			value = value[1:end]
+		}
+	}
+	return splitFields(value)
+}
+
+func splitFields(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	fields := strings.Split(s, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+// fieldsMatch compares the fields both sides report; boards often omit
+// trailing fields (e.g. power) from the query response.
+func fieldsMatch(want, got []string) bool {
+	n := len(want)
+	if len(got) < n {
+		n = len(got)
+	}
+	if n == 0 {
+		return len(want) == len(got)
+	}
+	for i := 0; i < n; i++ {
+		if !sameConfigValue(want[i], got[i]) && !sameHexValue(want[i], got[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameHexValue(a, b string) bool {
+	x, errA := strconv.ParseUint(strings.Trim(a, "\""), 16, 64)
+	y, errB := strconv.ParseUint(strings.Trim(b, "\""), 16, 64)
+	return errA == nil && errB == nil && x == y
+}
+
+// restoreCommand builds the compensating command from the captured value,
+// keeping the quoting of the original command. Grouped values such as
+// "(14700,5),(14900,5)" omit trailing fields; those keep the value being applied.
+func restoreCommand(command, before string) string {
+	eq := strings.Index(command, "=")
+	args := setCommandArgs(command)
+	captured := valueFields(before)
+	grouped := strings.HasPrefix(strings.TrimSpace(before), "(")
+
+	restored := make([]string, 0, len(captured))
+	for i, field := range captured {
+		if i < len(args) {
+			field = strings.Trim(field, "\"")
+			if strings.HasPrefix(args[i], "\"") {
+				field = strconv.Quote(field)
+			}
+		}
+		restored = append(restored, field)
+	}
+	if grouped {
+		for i := len(captured); i < len(args); i++ {
+			restored = append(restored, args[i])
+		}
+	}
+	return command[:eq+1] + strings.Join(restored, ",")
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQueryForSetCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+		wantErr bool
+	}{
+		{command: "AT^DRPS=24100,2,23", want: "AT^DRPS?"},
+		{command: "AT+CONFIG=0,0", want: "AT+CONFIG?"},
+		{command: `AT^DAPI="00112233"`, want: "AT^DAPI?"},
+		{command: "AT^DRPS?", wantErr: true},
+		{command: "DRPS=1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			got, err := queryForSetCommand(tt.command)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("queryForSetCommand(%q) error = %v, wantErr %v", tt.command, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("queryForSetCommand(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractReportedValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		response string
+		want     string
+		wantErr  bool
+	}{
+		{name: "plain", query: "AT^DRPS?", response: "\r\n^DRPS: 24100,2,23\r\nOK\r\n", want: "24100,2,23"},
+		{name: "echoed command", query: "AT^DRPS?", response: "AT^DRPS?\r\n^DRPS:24100,2,23\r\n\r\nOK", want: "24100,2,23"},
+		{name: "plus answered with caret", query: "AT+CONFIG?", response: "^CONFIG: 0,0,0\r\nOK", want: "0,0,0"},
+		{name: "plus answered with plus", query: "AT+CONFIG?", response: "+CONFIG: 1,2\r\nOK", want: "1,2"},
+		{name: "error", query: "AT^DRPS?", response: "\r\nERROR\r\n", wantErr: true},
+		{name: "other report", query: "AT^DRPS?", response: "^DAPI: \"00\"\r\nOK", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractReportedValue(tt.query, tt.response)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractReportedValue error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("extractReportedValue = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValueFields(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{value: "24100, 2 ,23", want: []string{"24100", "2", "23"}},
+		{value: "(14700,5),(14900,5)", want: []string{"14700", "5"}},
+		{value: `"0011AABB"`, want: []string{`"0011AABB"`}},
+		{value: "  ", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := valueFields(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("valueFields(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldsMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+		got  []string
+		ok   bool
+	}{
+		{name: "equal", want: []string{"24100", "2"}, got: []string{"24100", "2"}, ok: true},
+		{name: "trailing field omitted by the board", want: []string{"24100", "2", "23"}, got: []string{"24100", "2"}, ok: true},
+		{name: "quotes and case ignored", want: []string{`"aabb"`}, got: []string{"AABB"}, ok: true},
+		{name: "numeric formatting", want: []string{"23"}, got: []string{"23.0"}, ok: true},
+		{name: "hex leading zeros", want: []string{`"00ff"`}, got: []string{"FF"}, ok: true},
+		{name: "different value", want: []string{"24100", "2"}, got: []string{"24100", "3"}, ok: false},
+		{name: "both empty", want: nil, got: nil, ok: true},
+		{name: "nothing reported", want: []string{"1"}, got: nil, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fieldsMatch(tt.want, tt.got); got != tt.ok {
+				t.Errorf("fieldsMatch(%q, %q) = %v, want %v", tt.want, tt.got, got, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRestoreCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		before  string
+		want    string
+	}{
+		{name: "plain values", command: "AT^DRPS=24100,2,23", before: "24000,1,20", want: "AT^DRPS=24000,1,20"},
+		{name: "quoting follows the command", command: `AT^DAPI="AABB"`, before: "0011", want: `AT^DAPI="0011"`},
+		{name: "captured quotes not doubled", command: `AT^DAPI="AABB"`, before: `"0011"`, want: `AT^DAPI="0011"`},
+		{name: "quotes dropped for an unquoted argument", command: "AT^DCIAC=2", before: `"1"`, want: "AT^DCIAC=1"},
+		{name: "grouped value keeps omitted fields", command: "AT^DRPC=24100,5,23", before: "(14700,5),(14900,5)", want: "AT^DRPC=14700,5,23"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := restoreCommand(tt.command, tt.before); got != tt.want {
+				t.Errorf("restoreCommand(%q, %q) = %q, want %q", tt.command, tt.before, got, tt.want)
+			}
+		})
+	}
+}
@@ -7,12 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"os"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
-	"gopkg.in/yaml.v3"
 	"gorm.io/gorm"
 )
 
@@ -32,27 +30,36 @@ type ConfigService struct {
 	db         *gorm.DB
 	deviceRepo *repository.DeviceRepository
 	deviceComm *DeviceCommService
+	audit      *AuditService
+	secrets    *SecretBox
 }
 
-// NewConfigService 创建配置服务实例
-func NewConfigService(db *gorm.DB, deviceRepo *repository.DeviceRepository) *ConfigService {
+// NewConfigService 创建配置服务实例；安全配置中的密钥由secrets加密保存
+func NewConfigService(db *gorm.DB, deviceRepo *repository.DeviceRepository, audit *AuditService, secrets *SecretBox) *ConfigService {
 	deviceComm := NewDeviceCommService(db)
 	return &ConfigService{
 		db:         db,
 		deviceRepo: deviceRepo,
 		deviceComm: deviceComm,
+		audit:      audit,
+		secrets:    secrets,
 	}
 }
 
+// notProfile 排除配置profile，只保留类别字段模板
+func notProfile(db *gorm.DB) *gorm.DB {
+	return db.Where("kind IS NULL OR kind <> ?", model.TemplateKindProfile)
+}
+
 func (s *ConfigService) GetConfigCategories() ([]string, error) {
 	var categories []string
-	err := s.db.Model(&model.ConfigTemplate{}).Distinct().Pluck("category", &categories).Error
+	err := s.db.Model(&model.ConfigTemplate{}).Scopes(notProfile).Distinct().Pluck("category", &categories).Error
 	return categories, err
 }
 
 func (s *ConfigService) GetConfigTemplate(category string) (*model.ConfigTemplate, error) {
 	var template model.ConfigTemplate
-	err := s.db.Where("category = ?", category).First(&template).Error
+	err := s.db.Scopes(notProfile).Where("category = ?", category).First(&template).Error
 	if err != nil {
 		return nil, err
 	}
@@ -395,7 +402,89 @@ func (s *ConfigService) GetDeviceConfigs(deviceID uint, category string) (interf
 	}
 }
 
-func (s *ConfigService) SaveDeviceConfigs(deviceID uint, category string, configs map[string]interface{}) error {
+// SaveDeviceConfigs 保存配置并下发对应的AT命令，变更以actor的名义记入审计
+func (s *ConfigService) SaveDeviceConfigs(actor AuditActor, deviceID uint, category string, configs map[string]interface{}) error {
+	_, err := s.saveAndRecord(actor, deviceID, category, configs, "")
+	return err
+}
+
+// saveAndRecord 保存配置、下发命令并记入审计，返回下发的命令及结果
+func (s *ConfigService) saveAndRecord(actor AuditActor, deviceID uint, category string, configs map[string]interface{}, details string) ([]model.AuditCommand, error) {
+	changes := s.changesOrNil(deviceID, category, configs)
+	var sent []model.AuditCommand
+	err := s.saveDeviceConfigs(deviceID, category, configs, &sent)
+	s.recordChange(actor, deviceID, category, changes, sent, err, details)
+	return sent, err
+}
+
+// SaveAppliedConfigs saves configs whose AT commands the caller has already
+// sent, recording them together with those commands in one audit entry.
+func (s *ConfigService) SaveAppliedConfigs(actor AuditActor, deviceID uint, category string, configs map[string]interface{}, applied []model.AuditCommand, details string) error {
+	changes := s.changesOrNil(deviceID, category, configs)
+	err := s.saveDeviceConfigs(deviceID, category, configs, nil)
+	s.recordChange(actor, deviceID, category, changes, applied, err, details)
+	return err
+}
+
+// RecordFailedChange records a change whose AT commands failed, so configs
+// were not saved.
+func (s *ConfigService) RecordFailedChange(actor AuditActor, deviceID uint, category string, configs map[string]interface{}, applied []model.AuditCommand, cause error, details string) {
+	s.recordChange(actor, deviceID, category, s.changesOrNil(deviceID, category, configs), applied, cause, details)
+}
+
+// ConfigChanges 返回values中与已保存配置不同的参数
+func (s *ConfigService) ConfigChanges(deviceID uint, category string, values map[string]interface{}) ([]model.PreviewChange, error) {
+	stored, err := s.GetDeviceConfigs(deviceID, category)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stored %s config: %v", category, err)
+	}
+	var current map[string]interface{}
+	data, _ := json.Marshal(stored)
+	json.Unmarshal(data, &current)
+
+	changes := []model.PreviewChange{}
+	for _, key := range sortedKeys(values) {
+		from := ""
+		if v, ok := current[key]; ok && v != nil {
+			from = desiredValueString(v)
+		}
+		to := desiredValueString(values[key])
+		if from != to {
+			changes = append(changes, model.PreviewChange{Key: key, From: from, To: to})
+		}
+	}
+	return changes, nil
+}
+
+// changesOrNil 审计用：读取旧值失败（如未知类别）时不记录参数变化
+func (s *ConfigService) changesOrNil(deviceID uint, category string, values map[string]interface{}) []model.PreviewChange {
+	changes, err := s.ConfigChanges(deviceID, category, values)
+	if err != nil {
+		return nil
+	}
+	return changes
+}
+
+func (s *ConfigService) recordChange(actor AuditActor, deviceID uint, category string, changes []model.PreviewChange, commands []model.AuditCommand, cause error, details string) {
+	if s.audit == nil {
+		return
+	}
+	entry := &model.ConfigAudit{
+		DeviceID: deviceID,
+		Category: category,
+		Action:   model.AuditActionConfigChange,
+		Changes:  changes,
+		Commands: commands,
+		Details:  details,
+	}
+	if cause != nil {
+		entry.Error = cause.Error()
+	}
+	s.audit.Record(actor, entry)
+}
+
+// saveDeviceConfigs 保存配置；sent非空时收集下发的AT命令及结果
+func (s *ConfigService) saveDeviceConfigs(deviceID uint, category string, configs map[string]interface{}, sent *[]model.AuditCommand) error {
 	// 根据配置类别选择对应的处理方式
 	switch category {
 	case ConfigCategoryNetState:
@@ -429,6 +518,10 @@ func (s *ConfigService) SaveDeviceConfigs(deviceID uint, category string, config
 			return fmt.Errorf("failed to map security config: %v", err)
 		}
 		securityConfig.DeviceID = deviceID
+		securityConfig.EncryptionKey = s.secrets.Seal(securityConfig.EncryptionKey)
+		if err := s.openSecurityKey(oldConfigMap); err != nil {
+			return err
+		}
 
 		tx := s.db.Begin()
 		if tx.Error != nil {
@@ -450,36 +543,7 @@ func (s *ConfigService) SaveDeviceConfigs(deviceID uint, category string, config
 		}
 
 		// 总是下发AT^DCIAC=算法编号和AT+CONFIG=...
-		getStr := func(k string, def string) string {
-			if v, ok := configs[k]; ok && v != nil {
-				return fmt.Sprintf("%v", v)
-			}
-			if v, ok := oldConfigMap[k]; ok && v != nil {
-				return fmt.Sprintf("%v", v)
-			}
-			return def
-		}
-		encryption := getStr("encryption_algorithm", "0")
-		algInt, _ := strconv.Atoi(encryption)
-		atCmdAlg := fmt.Sprintf("AT^DCIAC=%d", algInt)
-		_, err = s.deviceComm.SendATCommand(deviceID, atCmdAlg)
-		if err != nil {
-			log.Printf("Failed to send AT^DCIAC: %v", err)
-		}
-
-		params := []string{
-			"0", // frequency_band
-			"0", // bandwidth
-			"0", // center_freq
-			"0", // transmit_power
-			encryption,
-			getStr("encryption_key", ""),
-		}
-		atCmd := "AT+CONFIG=" + strings.Join(params, ",")
-		_, err = s.deviceComm.SendATCommand(deviceID, atCmd)
-		if err != nil {
-			log.Printf("Failed to send AT+CONFIG: %v", err)
-		}
+		s.sendPlannedCommands(deviceID, securityCommands(oldConfigMap), sent)
 		return nil
 
 	case ConfigCategoryWireless:
@@ -569,33 +633,27 @@ func (s *ConfigService) SaveDeviceConfigs(deviceID uint, category string, config
 			return fmt.Errorf("invalid network setting configuration: %v", err)
 		}
 		netSettingConfig.DeviceID = deviceID
+		previousIP := s.interfaceAddress(deviceID, sent)
 		if err := s.db.Save(&netSettingConfig).Error; err != nil {
 			return fmt.Errorf("failed to save network setting configuration: %v", err)
 		}
 
 		// 发送 AT 命令设置网络配置
-		if netSettingConfig.IP != "" {
-			var atCommand string
-			if netSettingConfig.SubnetMask != "" && netSettingConfig.Gateway != "" {
-				// 设置IP、子网掩码和网关
-				atCommand = fmt.Sprintf("AT^NETIFCFG=4,\"%s\",\"%s\",\"%s\"",
-					netSettingConfig.IP, netSettingConfig.SubnetMask, netSettingConfig.Gateway)
-			} else if netSettingConfig.SubnetMask != "" {
-				// 设置IP和子网掩码
-				atCommand = fmt.Sprintf("AT^NETIFCFG=3,\"%s\",\"%s\"",
-					netSettingConfig.IP, netSettingConfig.SubnetMask)
-			} else {
-				// 只设置IP地址
-				atCommand = fmt.Sprintf("AT^NETIFCFG=2,\"%s\"", netSettingConfig.IP)
-			}
-
-			_, err := s.deviceComm.SendATCommand(deviceID, atCommand)
-			if err != nil {
-				log.Printf("Error sending AT command for network setting: %v", err)
-				// 不返回错误，因为配置已经保存到数据库
+		start := 0
+		if sent != nil {
+			start = len(*sent)
+		}
+		s.sendPlannedCommands(deviceID, netSettingCommands(netSettingConfig), sent)
+		if sent != nil && netSettingConfig.IP != "" {
+			for _, cmd := range (*sent)[start:] {
+				if strings.HasPrefix(cmd.Command, "AT^NETIFCFG") && cmd.Status == StepApplied {
+					// 节点改址后同步管理地址，避免失去设备
+					if _, err := recordDeviceAddress(s.db, deviceID, previousIP, netSettingConfig.IP); err != nil {
+						log.Printf("Failed to record new address of device %d: %v", deviceID, err)
+					}
+				}
 			}
 		}
-
 		return nil
 
 	case ConfigCategoryUpDown:
@@ -611,31 +669,7 @@ func (s *ConfigService) SaveDeviceConfigs(deviceID uint, category string, config
 		}
 
 		// 发送 TDD 配置的 AT 命令
-		if upDownConfig.Setting != "" {
-			// 根据设置值映射到对应的配置索引
-			var configIndex string
-			switch upDownConfig.Setting {
-			case "2D3U":
-				configIndex = "0"
-			case "3D2U":
-				configIndex = "1"
-			case "4D1U":
-				configIndex = "2"
-			case "1D4U":
-				configIndex = "3"
-			default:
-				log.Printf("Invalid TDD setting: %s", upDownConfig.Setting)
-				return nil
-			}
-
-			atCommand := fmt.Sprintf("AT^TDDCONFIG=%s", configIndex)
-			_, err := s.deviceComm.SendATCommand(deviceID, atCommand)
-			if err != nil {
-				log.Printf("Error sending AT command for TDD config: %v", err)
-				// 不返回错误，因为配置已经保存到数据库
-			}
-		}
-
+		s.sendPlannedCommands(deviceID, upDownCommands(upDownConfig), sent)
 		return nil
 
 	case ConfigCategoryDebug:
@@ -712,22 +746,233 @@ func (s *ConfigService) SaveDeviceConfigs(deviceID uint, category string, config
 		}
 
 		// 发送AT^DDTC指令设置设备类型
-		if deviceType, ok := configs["device_type"]; ok {
-			atCommand := fmt.Sprintf("AT^DDTC=%s", toString(deviceType))
-			_, err := s.deviceComm.SendATCommand(deviceID, atCommand)
-			if err != nil {
-				log.Printf("Error sending AT command for device type: %v", err)
-				// 不返回错误，因为配置已经保存到数据库
-			} else {
-				log.Printf("Successfully sent AT^DDTC command: %s", atCommand)
+		s.sendPlannedCommands(deviceID, deviceTypeCommands(configs), sent)
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported config category: %s", category)
+	}
+}
+
+// PlanCommands returns the AT commands SaveDeviceConfigs sends for category,
+// without sending them or touching the database.
+func (s *ConfigService) PlanCommands(deviceID uint, category string, configs map[string]interface{}) ([]PlannedCommand, error) {
+	switch category {
+	case ConfigCategorySecurity:
+		oldConfigRaw, err := s.GetDeviceConfigs(deviceID, category)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get old security config: %v", err)
+		}
+		var merged map[string]interface{}
+		jsonBytes, _ := json.Marshal(oldConfigRaw)
+		json.Unmarshal(jsonBytes, &merged)
+		if merged == nil {
+			merged = make(map[string]interface{})
+		}
+		for k, v := range configs {
+			merged[k] = v
+		}
+		if err := s.openSecurityKey(merged); err != nil {
+			return nil, err
+		}
+		return securityCommands(merged), nil
+
+	case ConfigCategoryNetSetting:
+		var netSettingConfig model.NetworkConfig
+		if err := mapToStruct(configs, &netSettingConfig); err != nil {
+			return nil, fmt.Errorf("invalid network setting configuration: %v", err)
+		}
+		return netSettingCommands(netSettingConfig), nil
+
+	case ConfigCategoryUpDown:
+		var upDownConfig model.UpDownConfig
+		if err := mapToStruct(configs, &upDownConfig); err != nil {
+			return nil, fmt.Errorf("invalid up-down configuration: %v", err)
+		}
+		return upDownCommands(upDownConfig), nil
+
+	case "device_type":
+		return deviceTypeCommands(configs), nil
+
+	case ConfigCategoryNetState, ConfigCategoryWireless, ConfigCategoryDebug, ConfigCategorySystem:
+		// 只保存到数据库，不下发AT命令
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported config category: %s", category)
+	}
+}
+
+// sendPlannedCommands 渲染并下发命令；配置已经保存到数据库，所以失败只记录日志
+func (s *ConfigService) sendPlannedCommands(deviceID uint, planned []PlannedCommand, sent *[]model.AuditCommand) {
+	if len(planned) == 0 {
+		return
+	}
+	record := func(cmd model.AuditCommand) {
+		if sent != nil {
+			*sent = append(*sent, cmd)
+		}
+	}
+	device, err := s.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		log.Printf("Failed to get device %d for config commands: %v", deviceID, err)
+		record(model.AuditCommand{Status: StepFailed, Error: err.Error()})
+		return
+	}
+	commands, warnings, errs, _ := renderPlannedCommands(s.deviceComm.boardConfigMgr, device.BoardType, s.deviceComm.ValidationContext(deviceID), planned)
+	for _, w := range warnings {
+		log.Printf("Config command warning for device %d: %s", deviceID, w)
+	}
+	for _, e := range errs {
+		log.Printf("Config command rejected for device %d: %s", deviceID, e)
+		record(model.AuditCommand{Status: "rejected", Error: e})
+	}
+	for _, cmd := range commands {
+		response, err := s.deviceComm.SendATCommand(deviceID, cmd.Command)
+		if err != nil {
+			log.Printf("Failed to send %s: %v", cmd.Command, err)
+			record(model.AuditCommand{Name: cmd.Name, Command: cmd.Command, Status: StepFailed, Error: err.Error()})
+		} else {
+			log.Printf("Successfully sent %s command: %s", cmd.Name, cmd.Command)
+			record(model.AuditCommand{Name: cmd.Name, Command: cmd.Command, Status: StepApplied, Response: response})
+		}
+	}
+}
+
+// interfaceAddress 修改接口地址前读取当前地址：下发命令时读取AT^DUIP?，失败时使用已保存的配置
+func (s *ConfigService) interfaceAddress(deviceID uint, sent *[]model.AuditCommand) string {
+	if sent != nil {
+		if device, err := s.deviceComm.getDeviceByID(deviceID); err == nil {
+			if ip, err := readInterfaceAddress(s.deviceComm, device); err == nil {
+				return ip
 			}
 		}
+	}
+	var stored model.NetworkConfig
+	if err := s.db.Where("device_id = ?", deviceID).First(&stored).Error; err != nil {
+		return ""
+	}
+	return stored.IP
+}
 
+// openSecurityKey 将合并后安全配置中加密保存的encryption_key还原为下发用的明文
+func (s *ConfigService) openSecurityKey(configs map[string]interface{}) error {
+	sealed, ok := configs["encryption_key"].(string)
+	if !ok || !IsSealed(sealed) {
 		return nil
+	}
+	key, err := s.secrets.Open(sealed)
+	if err != nil {
+		return fmt.Errorf("stored encryption key: %v", err)
+	}
+	configs["encryption_key"] = key
+	return nil
+}
 
+// securityCommands 下发加密算法(AT^DCIAC)和AT+CONFIG，configs为合并后的完整安全配置
+func securityCommands(configs map[string]interface{}) []PlannedCommand {
+	getStr := func(k string, def string) string {
+		if v, ok := configs[k]; ok && v != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return def
+	}
+	encryption := getStr("encryption_algorithm", "0")
+	algInt, _ := strconv.Atoi(encryption)
+
+	params := []string{
+		"0", // frequency_band
+		"0", // bandwidth
+		"0", // center_freq
+		"0", // transmit_power
+		encryption,
+		getStr("encryption_key", ""),
+	}
+	return []PlannedCommand{
+		{
+			Step:     "encryption algorithm",
+			Name:     "set_encryption_algorithm",
+			Groups:   []map[string]interface{}{{"algorithm": algInt}},
+			Fallback: fmt.Sprintf("AT^DCIAC=%d", algInt),
+		},
+		{Step: "config", Fallback: "AT+CONFIG=" + strings.Join(params, ",")},
+	}
+}
+
+// netSettingCommands 根据提供的字段选择AT^NETIFCFG的类型
+func netSettingCommands(cfg model.NetworkConfig) []PlannedCommand {
+	if cfg.IP == "" {
+		return nil
+	}
+	var fallback string
+	params := map[string]interface{}{"master_ip": cfg.IP}
+	if cfg.SubnetMask != "" && cfg.Gateway != "" {
+		// 设置IP、子网掩码和网关
+		fallback = fmt.Sprintf("AT^NETIFCFG=4,\"%s\",\"%s\",\"%s\"", cfg.IP, cfg.SubnetMask, cfg.Gateway)
+		params["type"], params["sub_mask"], params["gateway"] = 4, cfg.SubnetMask, cfg.Gateway
+	} else if cfg.SubnetMask != "" {
+		// 设置IP和子网掩码
+		fallback = fmt.Sprintf("AT^NETIFCFG=3,\"%s\",\"%s\"", cfg.IP, cfg.SubnetMask)
+		params["type"], params["sub_mask"] = 3, cfg.SubnetMask
+	} else {
+		// 只设置IP地址
+		fallback = fmt.Sprintf("AT^NETIFCFG=2,\"%s\"", cfg.IP)
+		params["type"] = 2
+	}
+	return []PlannedCommand{{
+		Step:     "network config",
+		Name:     "set_network_config",
+		Groups:   []map[string]interface{}{params},
+		Fallback: fallback,
+	}}
+}
+
+// upDownCommands 将TDD配置映射为AT^TDDCONFIG的配置索引
+func upDownCommands(cfg model.UpDownConfig) []PlannedCommand {
+	if cfg.Setting == "" {
+		return nil
+	}
+	var configIndex int
+	switch cfg.Setting {
+	case "2D3U":
+		configIndex = 0
+	case "3D2U":
+		configIndex = 1
+	case "4D1U":
+		configIndex = 2
+	case "1D4U":
+		configIndex = 3
 	default:
-		return fmt.Errorf("unsupported config category: %s", category)
+		log.Printf("Invalid TDD setting: %s", cfg.Setting)
+		return nil
 	}
+	return []PlannedCommand{{
+		Step:     "tdd config",
+		Name:     "set_tdd_config",
+		Groups:   []map[string]interface{}{{"config": configIndex}},
+		Fallback: fmt.Sprintf("AT^TDDCONFIG=%d", configIndex),
+	}}
+}
+
+// deviceTypeCommands 下发AT^DDTC设置设备类型
+func deviceTypeCommands(configs map[string]interface{}) []PlannedCommand {
+	deviceType, ok := configs["device_type"]
+	if !ok {
+		return nil
+	}
+	pc := PlannedCommand{Step: "device type", Name: "set_device_type"}
+	switch v := deviceType.(type) {
+	case float64:
+		pc.Groups = []map[string]interface{}{{"type": int(v)}}
+		pc.Fallback = fmt.Sprintf("AT^DDTC=%d", int(v))
+	default:
+		value := toString(deviceType)
+		if n, err := strconv.Atoi(value); err == nil {
+			pc.Groups = []map[string]interface{}{{"type": n}}
+		}
+		pc.Fallback = fmt.Sprintf("AT^DDTC=%s", value)
+	}
+	return []PlannedCommand{pc}
 }
 
 // mapToStruct 将 map 转换为结构体
@@ -802,242 +1047,209 @@ func mapToStruct(m map[string]interface{}, v interface{}) error {
 	return nil
 }
 
+// configFieldRule 配置字段的类型和取值规则
+type configFieldRule struct {
+	kind     string   // string, bool, number, array, ip
+	values   []string // 允许的字符串取值
+	min, max int      // number的范围，min和max都为0时不检查
+}
+
+// configFieldRules 各配置类别的字段规则，未列出的字段不检查
+var configFieldRules = map[string]map[string]configFieldRule{
+	ConfigCategoryNetSetting: {
+		"ip": {kind: "ip"},
+	},
+	ConfigCategorySecurity: {
+		"device_id":            {kind: "number"},
+		"firewall_enabled":     {kind: "bool"},
+		"ssh_enabled":          {kind: "bool"},
+		"ssh_port":             {kind: "number", min: 1, max: 65535},
+		"ssh_key_auth":         {kind: "bool"},
+		"ssh_password_auth":    {kind: "bool"},
+		"vpn_enabled":          {kind: "bool"},
+		"vpn_type":             {kind: "string", values: []string{"openvpn", "ipsec", "l2tp", "pptp"}},
+		"vpn_config":           {kind: "string"},
+		"access_control_list":  {kind: "string"},
+		"security_log_level":   {kind: "string", values: []string{"debug", "info", "warning", "error"}},
+		"security_alerts":      {kind: "bool"},
+		"security_updates":     {kind: "bool"},
+		"security_scan_period": {kind: "number", min: 1, max: 365},
+	},
+	ConfigCategoryWireless: {
+		"frequency_band":    {kind: "array"},
+		"bandwidth":         {kind: "string", values: []string{"1.4M", "3M", "5M", "10M", "20M"}},
+		"building_chain":    {kind: "string"},
+		"frequency_hopping": {kind: "bool"},
+		"channel":           {kind: "number"},
+		"frequency":         {kind: "number"},
+		"transmit_power":    {kind: "number", min: MinRadioPower, max: MaxRadioPower},
+		"power":             {kind: "number", min: MinRadioPower, max: MaxRadioPower},
+	},
+	ConfigCategoryUpDown: {
+		"setting": {kind: "string", values: []string{"2D3U", "3D2U", "4D1U", "1D4U"}},
+	},
+	ConfigCategoryDebug: {
+		"debug_switch":            {kind: "string"},
+		"active_escalation_check": {kind: "string"},
+	},
+	ConfigCategorySystem: {
+		"timezone":    {kind: "string"},
+		"language":    {kind: "string"},
+		"auto_update": {kind: "bool"},
+		"log_level":   {kind: "string"},
+	},
+}
+
+// configRequiredFields 各配置类别的必填字段
+var configRequiredFields = map[string][]string{
+	ConfigCategorySecurity: {"device_id"},
+}
+
+// ValidateConfig 校验配置字段的类型和取值；带device_id时再按设备的单板类型和当前频段
+// 校验将要下发的命令。所有失败的字段以ValidationErrors一起返回
 func (s *ConfigService) ValidateConfig(config map[string]interface{}) error {
 	fmt.Printf("Validating config: %+v\n", config)
 
 	// 检查配置类别
 	category, ok := config["category"].(string)
 	if !ok {
-		return fmt.Errorf("missing required field: category")
+		return ValidationErrors{{Field: "category", Rule: RuleRequired, Message: "missing required field: category"}}
+	}
+	rules, ok := configFieldRules[category]
+	if !ok {
+		return ValidationErrors{{Field: "category", Value: category, Rule: RuleValues, Message: fmt.Sprintf("unsupported config category: %s", category)}}
 	}
 
-	switch category {
-	case ConfigCategoryNetSetting:
-		// 只验证 IP 字段
-		if ip, exists := config["ip"]; exists {
-			if ipStr, ok := ip.(string); ok {
-				if !isValidIP(ipStr) {
-					return fmt.Errorf("invalid IP address format: %s", ipStr)
-				}
-			} else {
-				return fmt.Errorf("invalid type for ip: expected string")
-			}
-		}
-
-	case ConfigCategorySecurity:
-		// 检查必需字段
-		requiredFields := []string{
-			"device_id",
-			// 移除其他字段作为必需字段，使其变为可选
-		}
-
-		for _, field := range requiredFields {
-			if _, exists := config[field]; !exists {
-				return fmt.Errorf("missing required field: %s", field)
-			}
-		}
-
-		// 验证字段类型（只验证存在的字段）
-		if _, ok := config["device_id"].(float64); !ok {
-			return fmt.Errorf("invalid type for device_id: expected number")
-		}
-
-		// 验证其他字段（如果存在）
-		if val, exists := config["firewall_enabled"]; exists {
-			if _, ok := val.(bool); !ok {
-				return fmt.Errorf("invalid type for firewall_enabled: expected boolean")
-			}
-		}
-
-		if val, exists := config["ssh_enabled"]; exists {
-			if _, ok := val.(bool); !ok {
-				return fmt.Errorf("invalid type for ssh_enabled: expected boolean")
-			}
-		}
-
-		if val, exists := config["ssh_port"]; exists {
-			if _, ok := val.(float64); !ok {
-				return fmt.Errorf("invalid type for ssh_port: expected number")
-			}
-			sshPort := int(val.(float64))
-			if sshPort < 1 || sshPort > 65535 {
-				return fmt.Errorf("invalid ssh_port: must be between 1 and 65535")
-			}
-		}
-
-		if val, exists := config["ssh_key_auth"]; exists {
-			if _, ok := val.(bool); !ok {
-				return fmt.Errorf("invalid type for ssh_key_auth: expected boolean")
-			}
-		}
-
-		if val, exists := config["ssh_password_auth"]; exists {
-			if _, ok := val.(bool); !ok {
-				return fmt.Errorf("invalid type for ssh_password_auth: expected boolean")
-			}
-		}
-
-		if val, exists := config["vpn_enabled"]; exists {
-			if _, ok := val.(bool); !ok {
-				return fmt.Errorf("invalid type for vpn_enabled: expected boolean")
-			}
-		}
-
-		if val, exists := config["vpn_type"]; exists {
-			if _, ok := val.(string); !ok {
-				return fmt.Errorf("invalid type for vpn_type: expected string")
-			}
-			vpnType := val.(string)
-			validVPNTypes := map[string]bool{
-				"openvpn": true,
-				"ipsec":   true,
-				"l2tp":    true,
-				"pptp":    true,
-			}
-			if !validVPNTypes[vpnType] {
-				return fmt.Errorf("invalid vpn_type: must be one of openvpn, ipsec, l2tp, pptp")
-			}
-		}
-
-		if val, exists := config["vpn_config"]; exists {
-			if _, ok := val.(string); !ok {
-				return fmt.Errorf("invalid type for vpn_config: expected string")
-			}
-		}
-
-		if val, exists := config["access_control_list"]; exists {
-			if _, ok := val.(string); !ok {
-				return fmt.Errorf("invalid type for access_control_list: expected string")
-			}
-		}
-
-		if val, exists := config["security_log_level"]; exists {
-			if _, ok := val.(string); !ok {
-				return fmt.Errorf("invalid type for security_log_level: expected string")
-			}
-			logLevel := val.(string)
-			validLogLevels := map[string]bool{
-				"debug":   true,
-				"info":    true,
-				"warning": true,
-				"error":   true,
-			}
-			if !validLogLevels[logLevel] {
-				return fmt.Errorf("invalid security_log_level: must be one of debug, info, warning, error")
-			}
-		}
-
-		if val, exists := config["security_alerts"]; exists {
-			if _, ok := val.(bool); !ok {
-				return fmt.Errorf("invalid type for security_alerts: expected boolean")
-			}
-		}
-
-		if val, exists := config["security_updates"]; exists {
-			if _, ok := val.(bool); !ok {
-				return fmt.Errorf("invalid type for security_updates: expected boolean")
-			}
-		}
-
-		if val, exists := config["security_scan_period"]; exists {
-			if _, ok := val.(float64); !ok {
-				return fmt.Errorf("invalid type for security_scan_period: expected number")
-			}
-			scanPeriod := int(val.(float64))
-			if scanPeriod < 1 || scanPeriod > 365 {
-				return fmt.Errorf("invalid security_scan_period: must be between 1 and 365")
-			}
-		}
-
-	case ConfigCategoryWireless:
-		// 验证无线配置字段
-		if val, exists := config["frequency_band"]; exists {
-			if _, ok := val.([]interface{}); !ok {
-				return fmt.Errorf("invalid type for frequency_band: expected array")
-			}
+	var errs ValidationErrors
+	for _, field := range configRequiredFields[category] {
+		if _, exists := config[field]; !exists {
+			errs = append(errs, model.FieldError{Field: field, Rule: RuleRequired, Message: fmt.Sprintf("missing required field: %s", field)})
 		}
-
-		if val, exists := config["bandwidth"]; exists {
-			if _, ok := val.(string); !ok {
-				return fmt.Errorf("invalid type for bandwidth: expected string")
-			}
+	}
+	fields := make([]string, 0, len(config))
+	for field := range config {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		rule, ok := rules[field]
+		if !ok {
+			continue
 		}
-
-		if val, exists := config["building_chain"]; exists {
-			if _, ok := val.(string); !ok {
-				return fmt.Errorf("invalid type for building_chain: expected string")
-			}
+		if fe := checkConfigField(field, config[field], rule); fe != nil {
+			errs = append(errs, *fe)
 		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
 
-		if val, exists := config["frequency_hopping"]; exists {
-			if _, ok := val.(bool); !ok {
-				return fmt.Errorf("invalid type for frequency_hopping: expected boolean")
-			}
-		}
+	if deviceID, ok := intValue(config["device_id"]); ok && deviceID > 0 {
+		return s.validateDeviceConfig(uint(deviceID), category, config)
+	}
+	return nil
+}
 
-	case ConfigCategoryUpDown:
-		// 验证 UP-DOWN 配置字段
-		if val, exists := config["setting"]; exists {
-			if settingStr, ok := val.(string); ok {
-				// 验证 TDD 设置值
-				validSettings := map[string]bool{
-					"2D3U": true,
-					"3D2U": true,
-					"4D1U": true,
-					"1D4U": true,
-				}
-				if !validSettings[settingStr] {
-					return fmt.Errorf("invalid TDD setting: must be one of 2D3U, 3D2U, 4D1U, 1D4U")
+func checkConfigField(field string, value interface{}, rule configFieldRule) *model.FieldError {
+	fail := func(r, format string, args ...interface{}) *model.FieldError {
+		return &model.FieldError{Field: field, Value: value, Rule: r, Message: fmt.Sprintf(format, args...)}
+	}
+	switch rule.kind {
+	case "bool":
+		if _, ok := value.(bool); !ok {
+			return fail(RuleType, "invalid type for %s: expected boolean", field)
+		}
+	case "array":
+		if _, ok := value.([]interface{}); !ok {
+			return fail(RuleType, "invalid type for %s: expected array", field)
+		}
+	case "number":
+		n, ok := value.(float64)
+		if !ok {
+			return fail(RuleType, "invalid type for %s: expected number", field)
+		}
+		if (rule.min != 0 || rule.max != 0) && (int(n) < rule.min || int(n) > rule.max) {
+			return fail(RuleRange, "invalid %s: must be between %d and %d", field, rule.min, rule.max)
+		}
+	case "string", "ip":
+		str, ok := value.(string)
+		if !ok {
+			return fail(RuleType, "invalid type for %s: expected string", field)
+		}
+		if rule.kind == "ip" && !isValidIP(str) {
+			return fail(RulePattern, "invalid IP address format: %s", str)
+		}
+		if len(rule.values) > 0 {
+			for _, allowed := range rule.values {
+				if str == allowed {
+					return nil
 				}
-			} else {
-				return fmt.Errorf("invalid type for setting: expected string")
 			}
+			return fail(RuleValues, "invalid %s: must be one of %s", field, strings.Join(rule.values, ", "))
 		}
+	}
+	return nil
+}
 
-	case ConfigCategoryDebug:
-		// 验证调试配置字段
-		if val, exists := config["debug_switch"]; exists {
-			if _, ok := val.(string); !ok {
-				return fmt.Errorf("invalid type for debug_switch: expected string")
-			}
+// validateDeviceConfig 用统一的校验引擎检查配置对应的AT命令：下发命令的类别按单板YAML
+// 渲染，无线类别检查频点是否在所选频段内、功率范围、带宽和建链频段
+func (s *ConfigService) validateDeviceConfig(deviceID uint, category string, config map[string]interface{}) error {
+	device, err := s.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to get device: %v", err)
+	}
+	values := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		if k != "category" {
+			values[k] = v
 		}
+	}
 
-		if val, exists := config["active_escalation_check"]; exists {
-			if _, ok := val.(string); !ok {
-				return fmt.Errorf("invalid type for active_escalation_check: expected string")
-			}
+	vctx := s.deviceComm.ValidationContext(deviceID)
+	if category != ConfigCategoryWireless {
+		planned, err := s.PlanCommands(deviceID, category, values)
+		if err != nil {
+			return err
 		}
-
-	case ConfigCategorySystem:
-		// 验证系统配置字段
-		if val, exists := config["timezone"]; exists {
-			if _, ok := val.(string); !ok {
-				return fmt.Errorf("invalid type for timezone: expected string")
-			}
+		_, _, _, fieldErrs := renderPlannedCommands(s.deviceComm.boardConfigMgr, device.BoardType, vctx, planned)
+		if len(fieldErrs) > 0 {
+			return ValidationErrors(fieldErrs)
 		}
+		return nil
+	}
 
-		if val, exists := config["language"]; exists {
-			if _, ok := val.(string); !ok {
-				return fmt.Errorf("invalid type for language: expected string")
-			}
+	var errs ValidationErrors
+	if raw, ok := values["frequency_band"].([]interface{}); ok {
+		var bands []string
+		for _, b := range raw {
+			bands = append(bands, fmt.Sprint(b))
 		}
-
-		if val, exists := config["auto_update"]; exists {
-			if _, ok := val.(bool); !ok {
-				return fmt.Errorf("invalid type for auto_update: expected boolean")
-			}
+		vctx = vctx.withBands(bands)
+	}
+	if value, ok := values["building_chain"].(string); ok && value != "" {
+		if _, err := BuildingChainCommand(value); err != nil {
+			errs = append(errs, model.FieldError{Field: "building_chain", Value: value, Rule: RuleValues, Message: err.Error()})
 		}
-
-		if val, exists := config["log_level"]; exists {
-			if _, ok := val.(string); !ok {
-				return fmt.Errorf("invalid type for log_level: expected string")
+	}
+	// 请求中的字段名对应到命令参数名，错误中报告请求中的字段名
+	radio := map[string]interface{}{}
+	source := map[string]string{}
+	for _, field := range []string{"frequency", "channel", "power", "transmit_power"} {
+		if v, ok := values[field]; ok {
+			param := "freq"
+			if strings.HasSuffix(field, "power") {
+				param = "power"
 			}
+			radio[param], source[param] = v, field
 		}
-
-	default:
-		return fmt.Errorf("unsupported config category: %s", category)
 	}
-
+	for _, fe := range crossFieldErrors("", radio, vctx) {
+		fe.Field = source[fe.Field]
+		errs = append(errs, fe)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
@@ -1113,6 +1325,16 @@ func (s *ConfigService) GetDeviceConfigOverview(deviceID uint) (map[string]inter
 	return overview, nil
 }
 
+// sortedKeys 返回排序后的键，保证输出顺序稳定
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // Helper function to convert interface{} to string
 func toString(value interface{}) string {
 	switch v := value.(type) {
@@ -1132,121 +1354,32 @@ func toString(value interface{}) string {
 	}
 }
 
-// IsValidCommand 检查命令是否有效
-func (s *ConfigService) IsValidCommand(command string) bool {
-	// 从 board_1.0_star.yaml 中读取命令列表
-	commands, err := s.loadBoardCommands("1.0_star")
+// IsValidCommand 检查命令是否在设备单板类型的配置中定义
+func (s *ConfigService) IsValidCommand(deviceID uint, command string) bool {
+	device, err := s.deviceComm.getDeviceByID(deviceID)
 	if err != nil {
 		return false
 	}
-
-	// 检查命令是否存在
-	_, exists := commands[command]
-	return exists
+	_, err = s.deviceComm.boardConfigMgr.GetCommand(device.BoardType, command)
+	return err == nil
 }
 
-// ValidateCommandParameters 验证命令参数
-func (s *ConfigService) ValidateCommandParameters(command string, parameters map[string]interface{}) error {
-	// 从 board_1.0_star.yaml 中读取命令定义
-	commands, err := s.loadBoardCommands("1.0_star")
-	if err != nil {
-		return err
-	}
-
-	cmd, exists := commands[command]
-	if !exists {
-		return fmt.Errorf("command %s not found", command)
-	}
-
-	// 验证必需参数
-	for _, param := range cmd.Parameters {
-		value, exists := parameters[param.Name]
-		if !exists {
-			return fmt.Errorf("missing required parameter: %s", param.Name)
-		}
-
-		// 验证参数类型
-		switch param.Type {
-		case "int":
-			// 处理整数类型
-			var intValue int
-			switch v := value.(type) {
-			case float64:
-				intValue = int(v)
-			case int:
-				intValue = v
-			case int64:
-				intValue = int(v)
-			default:
-				return fmt.Errorf("parameter %s must be an integer", param.Name)
-			}
-
-			// 验证值范围
-			if param.Values != nil {
-				found := false
-				for _, v := range param.Values {
-					if intValue == v.(int) {
-						found = true
-						break
-					}
-				}
-				if !found {
-					return fmt.Errorf("invalid value for parameter %s", param.Name)
-				}
-			}
-		case "string":
-			if _, ok := value.(string); !ok {
-				return fmt.Errorf("parameter %s must be a string", param.Name)
-			}
-			// 验证字符串格式
-			if param.Pattern != "" {
-				matched, err := regexp.MatchString(param.Pattern, value.(string))
-				if err != nil || !matched {
-					return fmt.Errorf("invalid format for parameter %s", param.Name)
-				}
-			}
-		}
-	}
-
-	return nil
+// ValidateCommandParameters 按设备的单板类型校验命令参数，失败时返回ValidationErrors
+func (s *ConfigService) ValidateCommandParameters(deviceID uint, command string, parameters map[string]interface{}) error {
+	return s.deviceComm.ValidateCommand(deviceID, command, parameters)
 }
 
-// ExecuteCommand 执行命令
+// ExecuteCommand 按设备的单板类型校验并执行命令
 func (s *ConfigService) ExecuteCommand(deviceID uint, command string, parameters map[string]interface{}) error {
-	// 从 board_1.0_star.yaml 中读取命令定义
-	commands, err := s.loadBoardCommands("1.0_star")
+	device, err := s.deviceComm.getDeviceByID(deviceID)
 	if err != nil {
-		return err
-	}
-
-	cmd, exists := commands[command]
-	if !exists {
-		return fmt.Errorf("command %s not found", command)
+		return fmt.Errorf("failed to get device: %v", err)
 	}
 
 	// 构建 AT 命令
-	atCommand := cmd.ATCommand
-	for _, param := range cmd.Parameters {
-		value := parameters[param.Name]
-		// 根据参数类型格式化值
-		switch param.Type {
-		case "int":
-			// 处理整数类型
-			var intValue int
-			switch v := value.(type) {
-			case float64:
-				intValue = int(v)
-			case int:
-				intValue = v
-			case int64:
-				intValue = int(v)
-			default:
-				return fmt.Errorf("parameter %s must be an integer", param.Name)
-			}
-			atCommand = strings.Replace(atCommand, "%d", fmt.Sprintf("%d", intValue), 1)
-		case "string":
-			atCommand = strings.Replace(atCommand, "%s", value.(string), 1)
-		}
+	atCommand, err := s.deviceComm.boardConfigMgr.FormatATCommandWithContext(device.BoardType, command, parameters, s.deviceComm.ValidationContext(deviceID))
+	if err != nil {
+		return err
 	}
 
 	// 发送 AT 命令到设备
@@ -1263,39 +1396,3 @@ func (s *ConfigService) ExecuteCommand(deviceID uint, command string, parameters
 
 	return nil
 }
-
-// loadBoardCommands 从 YAML 文件加载命令定义
-func (s *ConfigService) loadBoardCommands(boardType string) (map[string]Command, error) {
-	// 读取 YAML 文件
-	data, err := os.ReadFile(fmt.Sprintf("config/boards/board_%s.yaml", boardType))
-	if err != nil {
-		return nil, err
-	}
-
-	var boardConfig struct {
-		Commands map[string]Command `yaml:"commands"`
-	}
-	if err := yaml.Unmarshal(data, &boardConfig); err != nil {
-		return nil, err
-	}
-
-	return boardConfig.Commands, nil
-}
-
-// Command 表示 AT 命令定义
-type Command struct {
-	ATCommand      string      `yaml:"at_command"`
-	Description    string      `yaml:"description"`
-	Parameters     []Parameter `yaml:"parameters"`
-	ResponseFormat string      `yaml:"response_format,omitempty"`
-}
-
-// Parameter 表示命令参数定义
-type Parameter struct {
-	Name        string        `yaml:"name"`
-	Type        string        `yaml:"type"`
-	Values      []interface{} `yaml:"values,omitempty"`
-	Range       []int         `yaml:"range,omitempty"`
-	Pattern     string        `yaml:"pattern,omitempty"`
-	Description string        `yaml:"description"`
-}
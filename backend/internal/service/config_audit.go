@@ -0,0 +1,298 @@
+package service
+
+import (
+	"backend/internal/model"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+	redactedValue     = "******"
+)
+
+// secretCommands 参数为密钥的AT命令，审计记录中不保存参数和响应
+var secretCommands = map[string]bool{
+	"AT^KEY":  true,
+	"AT^DAPI": true,
+}
+
+// secretArgsPattern matches the arguments of a secret command quoted in a
+// message, e.g. the rollback command in a step error; quotedPattern matches
+// reported values such as `device reports "..." after restore`.
+var (
+	secretArgsPattern = regexp.MustCompile(`(?i)(AT\^(?:KEY|DAPI)=)[^;\s]*`)
+	quotedPattern     = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+)
+
+// AuditActor is who made a change and from where.
+type AuditActor struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	SourceIP string `json:"source_ip"`
+}
+
+// SystemActor attributes a change to a background worker.
+func SystemActor(name string) AuditActor {
+	return AuditActor{Username: "system:" + name}
+}
+
+// AuditFilter selects audit records; zero values match everything.
+type AuditFilter struct {
+	DeviceID uint
+	UserID   uint
+	Username string
+	Category string
+	Action   string
+	Outcome  string
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Offset   int
+}
+
+// HistoryFilter selects per-parameter history records.
+type HistoryFilter struct {
+	DeviceID uint
+	Category string
+	Key      string
+	UserID   uint
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Offset   int
+}
+
+// AuditService 配置变更审计：记录谁在何时从哪里修改了哪个设备的什么参数，
+// 以及下发的AT命令和结果
+type AuditService struct {
+	db *gorm.DB
+}
+
+// NewAuditService 创建审计服务
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Record stores entry attributed to actor together with one history row per
+// changed parameter. Secrets are redacted. Audit failures are logged and
+// never fail the change itself.
+func (s *AuditService) Record(actor AuditActor, entry *model.ConfigAudit) {
+	entry.UserID = actor.UserID
+	entry.Username = actor.Username
+	entry.SourceIP = actor.SourceIP
+	if entry.Outcome == "" {
+		entry.Outcome = auditOutcome(entry)
+	}
+	redactAudit(entry)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+		if entry.Outcome == model.AuditOutcomeFailed || len(entry.Changes) == 0 {
+			return nil
+		}
+		history := make([]model.ConfigHistory, 0, len(entry.Changes))
+		for _, change := range entry.Changes {
+			history = append(history, model.ConfigHistory{
+				AuditID:  entry.ID,
+				DeviceID: entry.DeviceID,
+				Category: entry.Category,
+				Key:      change.Key,
+				OldValue: change.From,
+				Value:    change.To,
+				UserID:   entry.UserID,
+				Username: entry.Username,
+			})
+		}
+		return tx.Create(&history).Error
+	})
+	if err != nil {
+		log.Printf("Failed to record %s audit for device %d: %v", entry.Action, entry.DeviceID, err)
+	}
+}
+
+// RecordCommand records a single AT command sent directly by actor.
+func (s *AuditService) RecordCommand(actor AuditActor, deviceID uint, name, command, response string, sendErr error) {
+	cmd := model.AuditCommand{Name: name, Command: command, Status: StepApplied, Response: response}
+	entry := &model.ConfigAudit{
+		DeviceID: deviceID,
+		Category: "at_command",
+		Action:   model.AuditActionATCommand,
+		Commands: []model.AuditCommand{cmd},
+	}
+	if sendErr != nil {
+		entry.Commands[0].Status = StepFailed
+		entry.Commands[0].Error = sendErr.Error()
+		entry.Error = sendErr.Error()
+	}
+	s.Record(actor, entry)
+}
+
+// List 按条件查询审计记录，按时间倒序
+func (s *AuditService) List(filter AuditFilter) ([]model.ConfigAudit, int64, error) {
+	query := s.db.Model(&model.ConfigAudit{})
+	if filter.DeviceID != 0 {
+		query = query.Where("device_id = ?", filter.DeviceID)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Username != "" {
+		query = query.Where("username = ?", filter.Username)
+	}
+	if filter.Category != "" {
+		query = query.Where("category = ?", filter.Category)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	query = timeRange(query, filter.From, filter.To)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit records: %v", err)
+	}
+	var entries []model.ConfigAudit
+	err := query.Order("created_at DESC, id DESC").
+		Limit(auditLimit(filter.Limit)).Offset(filter.Offset).
+		Find(&entries).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit records: %v", err)
+	}
+	return entries, total, nil
+}
+
+// History 按条件查询参数变更历史，按时间倒序
+func (s *AuditService) History(filter HistoryFilter) ([]model.ConfigHistory, int64, error) {
+	query := s.db.Model(&model.ConfigHistory{})
+	if filter.DeviceID != 0 {
+		query = query.Where("device_id = ?", filter.DeviceID)
+	}
+	if filter.Category != "" {
+		query = query.Where("category = ?", filter.Category)
+	}
+	if filter.Key != "" {
+		query = query.Where("key = ?", filter.Key)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	query = timeRange(query, filter.From, filter.To)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count config history: %v", err)
+	}
+	var history []model.ConfigHistory
+	err := query.Order("created_at DESC, id DESC").
+		Limit(auditLimit(filter.Limit)).Offset(filter.Offset).
+		Find(&history).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list config history: %v", err)
+	}
+	return history, total, nil
+}
+
+// ChangeSetCommands converts change set steps to audit commands.
+func ChangeSetCommands(result *ChangeSetResult) []model.AuditCommand {
+	if result == nil {
+		return nil
+	}
+	commands := make([]model.AuditCommand, 0, len(result.Steps))
+	for _, step := range result.Steps {
+		cmd := model.AuditCommand{
+			Name:     step.Name,
+			Command:  step.Command,
+			Status:   step.Status,
+			Response: step.Response,
+			Error:    step.Error,
+		}
+		if step.Rollback != "" {
+			cmd.Error = strings.TrimPrefix(fmt.Sprintf("%s; rollback: %s", cmd.Error, step.Rollback), "; ")
+		}
+		if step.RollbackError != "" {
+			cmd.Error = fmt.Sprintf("%s; rollback failed: %s", cmd.Error, step.RollbackError)
+		}
+		commands = append(commands, cmd)
+	}
+	return commands
+}
+
+func timeRange(query *gorm.DB, from, to time.Time) *gorm.DB {
+	if !from.IsZero() {
+		query = query.Where("created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("created_at <= ?", to)
+	}
+	return query
+}
+
+func auditLimit(limit int) int {
+	if limit <= 0 {
+		return defaultAuditLimit
+	}
+	if limit > maxAuditLimit {
+		return maxAuditLimit
+	}
+	return limit
+}
+
+// auditOutcome derives the outcome from the error and command statuses.
+func auditOutcome(entry *model.ConfigAudit) string {
+	if entry.Error != "" {
+		return model.AuditOutcomeFailed
+	}
+	for _, cmd := range entry.Commands {
+		if cmd.Status != StepApplied && cmd.Status != StepSkipped {
+			return model.AuditOutcomePartial
+		}
+	}
+	return model.AuditOutcomeSuccess
+}
+
+// redactAudit 去掉密钥参数的值和密钥命令的参数
+func redactAudit(entry *model.ConfigAudit) {
+	for i := range entry.Changes {
+		if isSecretKey(entry.Changes[i].Key) {
+			if entry.Changes[i].From != "" {
+				entry.Changes[i].From = redactedValue
+			}
+			if entry.Changes[i].To != "" {
+				entry.Changes[i].To = redactedValue
+			}
+		}
+	}
+	redactCommands(entry.Commands)
+}
+
+// redactCommands 隐藏密钥命令的参数、响应以及错误信息中的补偿命令
+func redactCommands(commands []model.AuditCommand) {
+	for i := range commands {
+		cmd := &commands[i]
+		if secretCommands[strings.ToUpper(atCommandName(cmd.Command))] {
+			if eq := strings.Index(cmd.Command, "="); eq >= 0 {
+				cmd.Command = cmd.Command[:eq+1] + redactedValue
+			}
+			cmd.Response = ""
+			cmd.Error = secretArgsPattern.ReplaceAllString(cmd.Error, "${1}"+redactedValue)
+			cmd.Error = quotedPattern.ReplaceAllString(cmd.Error, `"`+redactedValue+`"`)
+		}
+	}
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasSuffix(key, "key") || strings.Contains(key, "password") || strings.Contains(key, "secret")
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"backend/internal/model"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// previewTTL 预览的有效期，过期后必须重新预览
+const previewTTL = 30 * time.Minute
+
+// ErrPreviewUnavailable is returned when a preview can no longer be applied:
+// it expired, was already applied, failed validation or went stale.
+var ErrPreviewUnavailable = errors.New("preview cannot be applied")
+
+// PlannedCommand is a set command rendered through the board config.
+type PlannedCommand struct {
+	Step     string                   // step name shown in previews and change-set results
+	Name     string                   // board command name, e.g. set_radio_params_store
+	Groups   []map[string]interface{} // parameter sets; several groups are joined into one command (AT^DSONSBR)
+	Fallback string                   // command sent when the board config cannot render Name
+}
+
+// ConfigPlan is a configuration change rendered without contacting the device.
+type ConfigPlan struct {
+	DeviceID    uint
+	BoardType   string
+	Kind        string
+	Target      string
+	Values      map[string]interface{} // stored after the commands succeed
+	Commands    []model.PreviewCommand
+	Changes     []model.PreviewChange
+	Warnings    []string
+	Errors      []string
+	FieldErrors []model.FieldError
+}
+
+// Valid reports whether every command passed board validation.
+func (p *ConfigPlan) Valid() bool {
+	return len(p.Errors) == 0
+}
+
+// Steps returns the rendered commands as change-set steps.
+func (p *ConfigPlan) Steps() []ChangeStep {
+	return previewSteps(p.Commands)
+}
+
+// PreviewApplyResult is the outcome of applying a preview.
+type PreviewApplyResult struct {
+	Preview   *model.ConfigPreview `json:"preview"`
+	Success   bool                 `json:"success"`
+	Error     string               `json:"error,omitempty"`
+	ChangeSet *ChangeSetResult     `json:"change_set,omitempty"`
+}
+
+// ConfigPreviewService 配置变更预览：渲染将要下发的AT命令、与已存配置的差异和校验结果，
+// 预览保存后可以按ID执行，保证执行的就是审核过的命令
+type ConfigPreviewService struct {
+	db            *gorm.DB
+	deviceComm    *DeviceCommService
+	configService *ConfigService
+	changeSet     *ChangeSetExecutor
+}
+
+// NewConfigPreviewService 创建配置预览服务
+func NewConfigPreviewService(db *gorm.DB, deviceComm *DeviceCommService, configService *ConfigService, changeSet *ChangeSetExecutor) *ConfigPreviewService {
+	return &ConfigPreviewService{
+		db:            db,
+		deviceComm:    deviceComm,
+		configService: configService,
+		changeSet:     changeSet,
+	}
+}
+
+// PlanWireless renders a wireless setter. values are the wireless config
+// fields stored once the commands succeed.
+func (s *ConfigPreviewService) PlanWireless(deviceID uint, target string, planned []PlannedCommand, values map[string]interface{}) (*ConfigPlan, error) {
+	return s.plan(deviceID, model.PreviewKindWireless, target, ConfigCategoryWireless, planned, values)
+}
+
+// PlanConfig renders PUT /devices/:id/configs/:category.
+func (s *ConfigPreviewService) PlanConfig(deviceID uint, category string, values map[string]interface{}) (*ConfigPlan, error) {
+	planned, err := s.configService.PlanCommands(deviceID, category, values)
+	if err != nil {
+		return nil, err
+	}
+	return s.plan(deviceID, model.PreviewKindConfig, category, category, planned, values)
+}
+
+func (s *ConfigPreviewService) plan(deviceID uint, kind, target, category string, planned []PlannedCommand, values map[string]interface{}) (*ConfigPlan, error) {
+	device, err := s.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	changes, err := s.changes(deviceID, category, values)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ConfigPlan{
+		DeviceID:  deviceID,
+		BoardType: device.BoardType,
+		Kind:      kind,
+		Target:    target,
+		Values:    values,
+		Changes:   changes,
+	}
+	plan.Commands, plan.Warnings, plan.Errors, plan.FieldErrors = renderPlannedCommands(s.deviceComm.boardConfigMgr, device.BoardType, s.deviceComm.ValidationContext(deviceID), planned)
+	return plan, nil
+}
+
+// changes lists the submitted values that differ from the stored configuration.
+func (s *ConfigPreviewService) changes(deviceID uint, category string, values map[string]interface{}) ([]model.PreviewChange, error) {
+	return s.configService.ConfigChanges(deviceID, category, values)
+}
+
+// CreatePreview stores plan so it can be applied by ID.
+func (s *ConfigPreviewService) CreatePreview(plan *ConfigPlan, createdBy string) (*model.ConfigPreview, error) {
+	preview := &model.ConfigPreview{
+		DeviceID:    plan.DeviceID,
+		BoardType:   plan.BoardType,
+		Kind:        plan.Kind,
+		Target:      plan.Target,
+		Values:      plan.Values,
+		Commands:    plan.Commands,
+		Changes:     plan.Changes,
+		Warnings:    plan.Warnings,
+		Errors:      plan.Errors,
+		FieldErrors: plan.FieldErrors,
+		Valid:       plan.Valid(),
+		CreatedBy:   createdBy,
+		ExpiresAt:   time.Now().Add(previewTTL),
+	}
+	if err := s.db.Create(preview).Error; err != nil {
+		return nil, fmt.Errorf("failed to save preview: %v", err)
+	}
+	return preview, nil
+}
+
+// GetPreview 获取预览
+func (s *ConfigPreviewService) GetPreview(id uint) (*model.ConfigPreview, error) {
+	var preview model.ConfigPreview
+	if err := s.db.First(&preview, id).Error; err != nil {
+		return nil, err
+	}
+	return &preview, nil
+}
+
+// ApplyPreview executes the commands recorded in the preview. The preview is
+// refused if the stored configuration changed since it was rendered.
+func (s *ConfigPreviewService) ApplyPreview(id uint, actor AuditActor) (*PreviewApplyResult, error) {
+	appliedBy := actor.Username
+	preview, err := s.GetPreview(id)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case preview.AppliedAt != nil:
+		return nil, fmt.Errorf("%w: already applied at %s", ErrPreviewUnavailable, preview.AppliedAt.Format(time.RFC3339))
+	case time.Now().After(preview.ExpiresAt):
+		return nil, fmt.Errorf("%w: expired at %s", ErrPreviewUnavailable, preview.ExpiresAt.Format(time.RFC3339))
+	case !preview.Valid:
+		return nil, fmt.Errorf("%w: validation failed: %s", ErrPreviewUnavailable, strings.Join(preview.Errors, "; "))
+	}
+	if err := s.checkCurrent(preview); err != nil {
+		return nil, err
+	}
+
+	// 先占用预览，防止并发重复执行
+	now := time.Now()
+	res := s.db.Model(&model.ConfigPreview{}).
+		Where("id = ? AND applied_at IS NULL", preview.ID).
+		Updates(map[string]interface{}{"applied_at": now, "applied_by": appliedBy})
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to claim preview: %v", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: already applied", ErrPreviewUnavailable)
+	}
+	preview.AppliedAt = &now
+	preview.AppliedBy = appliedBy
+
+	result := &PreviewApplyResult{Preview: preview}
+	switch preview.Kind {
+	case model.PreviewKindWireless:
+		details := fmt.Sprintf("preview %d: %s", preview.ID, preview.Target)
+		changeSet, err := s.changeSet.Apply(preview.DeviceID, previewSteps(preview.Commands))
+		if err != nil {
+			s.configService.RecordFailedChange(actor, preview.DeviceID, ConfigCategoryWireless, preview.Values, nil, err, details)
+			result.Error = err.Error()
+			return result, nil
+		}
+		result.ChangeSet = changeSet
+		if !changeSet.Success {
+			s.configService.RecordFailedChange(actor, preview.DeviceID, ConfigCategoryWireless, preview.Values, ChangeSetCommands(changeSet), errors.New(changeSet.Error), details)
+			result.Error = changeSet.Error
+			return result, nil
+		}
+		if err := s.configService.SaveAppliedConfigs(actor, preview.DeviceID, ConfigCategoryWireless, preview.Values, ChangeSetCommands(changeSet), details); err != nil {
+			result.Error = err.Error()
+			return result, nil
+		}
+	case model.PreviewKindConfig:
+		if err := s.configService.SaveDeviceConfigs(actor, preview.DeviceID, preview.Target, preview.Values); err != nil {
+			result.Error = err.Error()
+			return result, nil
+		}
+	default:
+		result.Error = fmt.Sprintf("unknown preview kind: %s", preview.Kind)
+		return result, nil
+	}
+	result.Success = true
+	return result, nil
+}
+
+// checkCurrent re-renders the preview against the current stored state and
+// fails if anything the reviewer saw would be different now.
+func (s *ConfigPreviewService) checkCurrent(preview *model.ConfigPreview) error {
+	var plan *ConfigPlan
+	var err error
+	if preview.Kind == model.PreviewKindConfig {
+		plan, err = s.PlanConfig(preview.DeviceID, preview.Target, preview.Values)
+	} else {
+		// 无线设置命令依赖预览时读取的频点和功率，直接执行审核过的命令，只检查差异
+		plan = &ConfigPlan{Commands: preview.Commands}
+		plan.Changes, err = s.changes(preview.DeviceID, ConfigCategoryWireless, preview.Values)
+	}
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(plan.Commands, preview.Commands) || !reflect.DeepEqual(plan.Changes, preview.Changes) {
+		return fmt.Errorf("%w: stored configuration changed since the preview, preview again", ErrPreviewUnavailable)
+	}
+	return nil
+}
+
+func previewSteps(commands []model.PreviewCommand) []ChangeStep {
+	steps := make([]ChangeStep, len(commands))
+	for i, cmd := range commands {
+		steps[i] = ChangeStep{Name: cmd.Name, Command: cmd.Command}
+	}
+	return steps
+}
+
+// renderPlannedCommands renders each command through the board config. Commands
+// the board does not describe fall back to their raw form with a warning and
+// only get the cross-field checks; parameters that fail validation are
+// returned as errors, and as field errors for the UI.
+func renderPlannedCommands(mgr *BoardConfigManager, boardType string, vctx *ValidationContext, planned []PlannedCommand) ([]model.PreviewCommand, []string, []string, []model.FieldError) {
+	commands := []model.PreviewCommand{}
+	warnings := []string{}
+	errs := []string{}
+	var fieldErrs []model.FieldError
+	for _, pc := range planned {
+		command, warning, err := renderPlannedCommand(mgr, boardType, vctx, pc)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", pc.Step, err))
+			if verrs, ok := AsValidationErrors(err); ok {
+				fieldErrs = append(fieldErrs, verrs...)
+			}
+			continue
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+		commands = append(commands, model.PreviewCommand{Name: pc.Step, Command: command})
+		// 同一批命令中设置了频段时，后面的频点按新频段校验
+		if bands, ok := plannedBands(pc); ok {
+			vctx = vctx.withBands(bands)
+		}
+	}
+	return commands, warnings, errs, fieldErrs
+}
+
+func renderPlannedCommand(mgr *BoardConfigManager, boardType string, vctx *ValidationContext, pc PlannedCommand) (string, string, error) {
+	atName := atCommandName(pc.Fallback)
+	fallback := func(warning string) (string, string, error) {
+		for _, group := range pc.Groups {
+			if errs := crossFieldErrors(pc.Name, group, vctx); len(errs) > 0 {
+				return "", "", errs
+			}
+		}
+		return pc.Fallback, warning, nil
+	}
+	if pc.Name == "" {
+		return fallback(fmt.Sprintf("%s is not described by the board config and was not validated", atName))
+	}
+	def, err := mgr.GetCommand(boardType, pc.Name)
+	if err != nil {
+		return fallback(fmt.Sprintf("%s is not defined for board %s; %s was not validated", pc.Name, boardType, atName))
+	}
+	if atCommandName(def.ATCommand) != atName {
+		return fallback(fmt.Sprintf("board %s defines %s as %s; %s was not validated", boardType, pc.Name, atCommandName(def.ATCommand), atName))
+	}
+
+	var head string
+	var args []string
+	for _, group := range pc.Groups {
+		for _, param := range def.Parameters {
+			if _, ok := group[param.Name]; !ok {
+				return fallback(fmt.Sprintf("%s on board %s also takes %s; %s was not validated", pc.Name, boardType, param.Name, atName))
+			}
+		}
+		formatted, err := mgr.FormatATCommandWithContext(boardType, pc.Name, group, vctx)
+		if err != nil {
+			return "", "", err
+		}
+		eq := strings.Index(formatted, "=")
+		if eq < 0 {
+			return formatted, "", nil
+		}
+		head = formatted[:eq+1]
+		args = append(args, formatted[eq+1:])
+	}
+	if head == "" {
+		return pc.Fallback, "", nil
+	}
+	return head + strings.Join(args, ","), "", nil
+}
+
+// plannedBands returns the bands selected by a planned AT^DAOCNDI command.
+func plannedBands(pc PlannedCommand) ([]string, bool) {
+	if pc.Name != "set_band_config" || len(pc.Groups) == 0 {
+		return nil, false
+	}
+	for _, key := range []string{"band_bitmap", "pcell_band_bitmap"} {
+		if bitmap, ok := pc.Groups[0][key]; ok {
+			return BandsFromBitmap(fmt.Sprint(bitmap)), true
+		}
+	}
+	return nil, false
+}
+
+// atCommandName returns AT^DRPS for AT^DRPS=%d,%d or AT^DRPS?.
+func atCommandName(command string) string {
+	if eq := strings.Index(command, "="); eq >= 0 {
+		command = command[:eq]
+	}
+	return strings.TrimSuffix(command, "?")
+}
@@ -0,0 +1,873 @@
+package service
+
+import (
+	"backend/internal/model"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrProfileInvalid wraps validation failures of a profile or an apply request.
+var ErrProfileInvalid = errors.New("invalid profile")
+
+// profileCategories 下发顺序：先改加密和TDD等不影响连接的参数，无线参数和IP最后改，
+// 避免设备失联后剩余的类别无法下发
+var profileCategories = []string{
+	ConfigCategorySecurity,
+	ConfigCategoryUpDown,
+	ConfigCategoryDebug,
+	ConfigCategorySystem,
+	"device_type",
+	ConfigCategoryWireless,
+	ConfigCategoryNetSetting,
+}
+
+// profileWirelessKeys 无线类别支持的参数，与无线设置接口一致
+var profileWirelessKeys = map[string]bool{
+	"frequency_band":    true,
+	"bandwidth":         true,
+	"frequency":         true,
+	"power":             true,
+	"building_chain":    true,
+	"frequency_hopping": true,
+}
+
+// profileBuiltinVariables 每台设备自动提供的变量
+var profileBuiltinVariables = map[string]bool{
+	"device.id":      true,
+	"device.name":    true,
+	"device.node_id": true,
+	"device.ip":      true,
+}
+
+var (
+	profileVariablePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_.]*)\}`)
+	profileVariableName    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ProfileDefinition is the writable content of a profile version.
+type ProfileDefinition struct {
+	Name        string                            `json:"name"`
+	Description string                            `json:"description"`
+	Note        string                            `json:"note"`
+	Values      map[string]map[string]interface{} `json:"values"`
+	Variables   []model.ProfileVariable           `json:"variables"`
+}
+
+// ProfileApplyRequest selects the version and devices of an apply. Variables
+// apply to every device; DeviceVariables override them per device ID.
+type ProfileApplyRequest struct {
+	Version         int                        `json:"version"` // 0 means the latest version
+	DeviceIDs       []uint                     `json:"device_ids"`
+	Variables       map[string]string          `json:"variables"`
+	DeviceVariables map[uint]map[string]string `json:"device_variables"`
+	DryRun          bool                       `json:"dry_run"`
+}
+
+// ProfileCategoryResult is the outcome of one category on one device.
+type ProfileCategoryResult struct {
+	Category    string                 `json:"category"`
+	Values      map[string]interface{} `json:"values"`
+	Changes     []model.PreviewChange  `json:"changes,omitempty"`
+	Commands    []model.PreviewCommand `json:"commands,omitempty"` // dry run only
+	Applied     []model.AuditCommand   `json:"applied,omitempty"`
+	Warnings    []string               `json:"warnings,omitempty"`
+	Errors      []string               `json:"errors,omitempty"`
+	FieldErrors []model.FieldError     `json:"field_errors,omitempty"`
+	Status      string                 `json:"status"`
+}
+
+// ProfileDeviceResult is the outcome of applying a profile to one device.
+type ProfileDeviceResult struct {
+	DeviceID   uint                    `json:"device_id"`
+	DeviceName string                  `json:"device_name"`
+	Success    bool                    `json:"success"`
+	Error      string                  `json:"error,omitempty"`
+	Variables  map[string]string       `json:"variables,omitempty"`
+	Categories []ProfileCategoryResult `json:"categories"`
+}
+
+// ProfileApplyResult is the outcome of applying a profile to a device list.
+type ProfileApplyResult struct {
+	ProfileID uint                  `json:"profile_id"`
+	Version   int                   `json:"version"`
+	DryRun    bool                  `json:"dry_run"`
+	Success   bool                  `json:"success"`
+	Applied   int                   `json:"applied"`
+	Failed    int                   `json:"failed"`
+	Devices   []ProfileDeviceResult `json:"devices"`
+}
+
+// ProfileDeviceStatus reports which profile version a device runs.
+type ProfileDeviceStatus struct {
+	DeviceID      uint              `json:"device_id"`
+	DeviceName    string            `json:"device_name"`
+	ProfileID     uint              `json:"profile_id"`
+	ProfileName   string            `json:"profile_name"`
+	Version       int               `json:"version"`
+	LatestVersion int               `json:"latest_version"`
+	Lagging       bool              `json:"lagging"`
+	AppliedAt     time.Time         `json:"applied_at"`
+	AppliedBy     string            `json:"applied_by"`
+	Variables     map[string]string `json:"variables,omitempty"`
+	LastError     string            `json:"last_error,omitempty"` // a later failed apply of this profile
+}
+
+// ConfigProfileService 配置profile：按类别保存的一组命名、带版本的配置值，
+// 可以包含每台设备不同的变量，批量下发到设备并记录每台设备运行的版本
+type ConfigProfileService struct {
+	db            *gorm.DB
+	deviceComm    *DeviceCommService
+	configService *ConfigService
+	preview       *ConfigPreviewService
+	changeSet     *ChangeSetExecutor
+}
+
+// NewConfigProfileService 创建配置profile服务
+func NewConfigProfileService(db *gorm.DB, deviceComm *DeviceCommService, configService *ConfigService, preview *ConfigPreviewService, changeSet *ChangeSetExecutor) *ConfigProfileService {
+	return &ConfigProfileService{
+		db:            db,
+		deviceComm:    deviceComm,
+		configService: configService,
+		preview:       preview,
+		changeSet:     changeSet,
+	}
+}
+
+// CreateProfile 创建profile及其第1版
+func (s *ConfigProfileService) CreateProfile(def ProfileDefinition, createdBy string) (*model.ConfigTemplate, error) {
+	if strings.TrimSpace(def.Name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrProfileInvalid)
+	}
+	if err := validateProfile(def); err != nil {
+		return nil, err
+	}
+	var existing int64
+	if err := s.db.Model(&model.ConfigTemplate{}).Where("kind = ? AND name = ?", model.TemplateKindProfile, def.Name).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("%w: profile %q already exists", ErrProfileInvalid, def.Name)
+	}
+
+	profile := &model.ConfigTemplate{
+		Kind:          model.TemplateKindProfile,
+		Category:      model.TemplateKindProfile,
+		Name:          def.Name,
+		Description:   def.Description,
+		LatestVersion: 1,
+		CreatedBy:     createdBy,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(profile).Error; err != nil {
+			return err
+		}
+		return tx.Create(profileVersion(profile.ID, 1, def, createdBy)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// CreateVersion 保存profile的新版本，已下发旧版本的设备随即成为落后设备
+func (s *ConfigProfileService) CreateVersion(profileID uint, def ProfileDefinition, createdBy string) (*model.ConfigTemplateVersion, error) {
+	if err := validateProfile(def); err != nil {
+		return nil, err
+	}
+	var version *model.ConfigTemplateVersion
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		profile, err := getProfile(tx, profileID)
+		if err != nil {
+			return err
+		}
+		version = profileVersion(profile.ID, profile.LatestVersion+1, def, createdBy)
+		if err := tx.Create(version).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"latest_version": version.Version}
+		if def.Description != "" {
+			updates["description"] = def.Description
+		}
+		return tx.Model(profile).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+func profileVersion(profileID uint, version int, def ProfileDefinition, createdBy string) *model.ConfigTemplateVersion {
+	return &model.ConfigTemplateVersion{
+		TemplateID: profileID,
+		Version:    version,
+		Content:    def.Note,
+		Values:     def.Values,
+		Variables:  def.Variables,
+		CreatedBy:  createdBy,
+	}
+}
+
+// ListProfiles 列出所有profile
+func (s *ConfigProfileService) ListProfiles() ([]model.ConfigTemplate, error) {
+	var profiles []model.ConfigTemplate
+	err := s.db.Where("kind = ?", model.TemplateKindProfile).Order("name").Find(&profiles).Error
+	return profiles, err
+}
+
+// GetProfile 返回profile及其所有版本，新版本在前
+func (s *ConfigProfileService) GetProfile(profileID uint) (*model.ConfigTemplate, []model.ConfigTemplateVersion, error) {
+	profile, err := getProfile(s.db, profileID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var versions []model.ConfigTemplateVersion
+	if err := s.db.Where("template_id = ?", profileID).Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, nil, err
+	}
+	return profile, versions, nil
+}
+
+// GetVersion 返回指定版本，version为0时返回最新版本
+func (s *ConfigProfileService) GetVersion(profileID uint, version int) (*model.ConfigTemplateVersion, error) {
+	profile, err := getProfile(s.db, profileID)
+	if err != nil {
+		return nil, err
+	}
+	return getProfileVersion(s.db, profile, version)
+}
+
+// DeleteProfile 删除profile及其版本；下发记录保留用于追溯
+func (s *ConfigProfileService) DeleteProfile(profileID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		profile, err := getProfile(tx, profileID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("template_id = ?", profile.ID).Delete(&model.ConfigTemplateVersion{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(profile).Error
+	})
+}
+
+func getProfile(db *gorm.DB, profileID uint) (*model.ConfigTemplate, error) {
+	var profile model.ConfigTemplate
+	if err := db.Where("kind = ?", model.TemplateKindProfile).First(&profile, profileID).Error; err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func getProfileVersion(db *gorm.DB, profile *model.ConfigTemplate, version int) (*model.ConfigTemplateVersion, error) {
+	if version == 0 {
+		version = profile.LatestVersion
+	}
+	var v model.ConfigTemplateVersion
+	if err := db.Where("template_id = ? AND version = ?", profile.ID, version).First(&v).Error; err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// validateProfile 检查类别、无线参数名、变量声明以及不含变量的值
+func validateProfile(def ProfileDefinition) error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrProfileInvalid, fmt.Sprintf(format, args...))
+	}
+	if len(def.Values) == 0 {
+		return invalid("values is required")
+	}
+
+	declared := make(map[string]bool)
+	for i, v := range def.Variables {
+		if !profileVariableName.MatchString(v.Name) {
+			return invalid("variables[%d]: invalid name %q", i, v.Name)
+		}
+		if declared[v.Name] {
+			return invalid("variable %q is declared twice", v.Name)
+		}
+		declared[v.Name] = true
+	}
+
+	known := make(map[string]bool, len(profileCategories))
+	for _, category := range profileCategories {
+		known[category] = true
+	}
+	for category, values := range def.Values {
+		if !known[category] {
+			return invalid("unsupported category %q", category)
+		}
+		if len(values) == 0 {
+			return invalid("category %q has no values", category)
+		}
+		for key, value := range values {
+			if category == ConfigCategoryWireless && !profileWirelessKeys[key] {
+				return invalid("unsupported wireless parameter %q", key)
+			}
+			for _, name := range profileValueVariables(value) {
+				if !declared[name] && !profileBuiltinVariables[name] {
+					return invalid("%s.%s uses undeclared variable ${%s}", category, key, name)
+				}
+			}
+		}
+	}
+
+	// 不含变量的无线参数现在就能检查
+	if wireless, ok := def.Values[ConfigCategoryWireless]; ok {
+		static := make(map[string]interface{})
+		for key, value := range wireless {
+			if len(profileValueVariables(value)) == 0 {
+				static[key] = value
+			}
+		}
+		if _, err := profileWirelessCommands(static, "1", "0", "1"); err != nil {
+			return invalid("wireless: %v", err)
+		}
+	}
+	return nil
+}
+
+// profileValueVariables 返回值中引用的变量名
+func profileValueVariables(value interface{}) []string {
+	var names []string
+	switch v := value.(type) {
+	case string:
+		for _, m := range profileVariablePattern.FindAllStringSubmatch(v, -1) {
+			names = append(names, m[1])
+		}
+	case []interface{}:
+		for _, item := range v {
+			names = append(names, profileValueVariables(item)...)
+		}
+	}
+	return names
+}
+
+// Apply 将profile的某个版本下发到设备列表。每台设备按profileCategories的顺序下发，
+// 某个类别失败后该设备剩余的类别不再下发；其他设备不受影响
+func (s *ConfigProfileService) Apply(profileID uint, req ProfileApplyRequest, actor AuditActor) (*ProfileApplyResult, error) {
+	profile, err := getProfile(s.db, profileID)
+	if err != nil {
+		return nil, err
+	}
+	version, err := getProfileVersion(s.db, profile, req.Version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: version %d does not exist", ErrProfileInvalid, req.Version)
+		}
+		return nil, err
+	}
+	if len(req.DeviceIDs) == 0 {
+		return nil, fmt.Errorf("%w: device_ids is required", ErrProfileInvalid)
+	}
+	var devices []model.Device
+	if err := s.db.Where("id IN ?", req.DeviceIDs).Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]model.Device, len(devices))
+	for _, d := range devices {
+		byID[d.ID] = d
+	}
+	for _, id := range req.DeviceIDs {
+		if _, ok := byID[id]; !ok {
+			return nil, fmt.Errorf("%w: device %d not found", ErrProfileInvalid, id)
+		}
+	}
+
+	result := &ProfileApplyResult{
+		ProfileID: profile.ID,
+		Version:   version.Version,
+		DryRun:    req.DryRun,
+		Success:   true,
+	}
+	details := fmt.Sprintf("profile %q v%d", profile.Name, version.Version)
+	seen := make(map[uint]bool)
+	for _, id := range req.DeviceIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		device := byID[id]
+		deviceResult := s.applyToDevice(device, version, req, actor, details)
+		if deviceResult.Success {
+			result.Applied++
+		} else {
+			result.Failed++
+			result.Success = false
+		}
+		if !req.DryRun {
+			s.recordUsage(profile.ID, version.Version, actor, &deviceResult)
+		}
+		result.Devices = append(result.Devices, deviceResult)
+	}
+	return result, nil
+}
+
+func (s *ConfigProfileService) applyToDevice(device model.Device, version *model.ConfigTemplateVersion, req ProfileApplyRequest, actor AuditActor, details string) ProfileDeviceResult {
+	result := ProfileDeviceResult{DeviceID: device.ID, DeviceName: device.Name, Success: true}
+	fail := func(err string) ProfileDeviceResult {
+		result.Success = false
+		result.Error = err
+		return result
+	}
+
+	variables, err := resolveProfileVariables(device, version.Variables, req.Variables, req.DeviceVariables[device.ID])
+	if err != nil {
+		return fail(err.Error())
+	}
+	result.Variables = variables
+
+	for _, category := range profileCategories {
+		raw, ok := version.Values[category]
+		if !ok {
+			continue
+		}
+		values := make(map[string]interface{}, len(raw))
+		for key, value := range raw {
+			values[key] = substituteProfileValue(value, variables)
+		}
+
+		var categoryResult ProfileCategoryResult
+		if category == ConfigCategoryWireless {
+			categoryResult = s.applyWireless(device.ID, values, req.DryRun, actor, details)
+		} else {
+			categoryResult = s.applyCategory(device.ID, category, values, req.DryRun, actor, details)
+		}
+		result.Categories = append(result.Categories, categoryResult)
+		if categoryResult.Status == StepFailed {
+			return fail(fmt.Sprintf("%s: %s", category, strings.Join(categoryResult.Errors, "; ")))
+		}
+	}
+	return result
+}
+
+// applyCategory 非无线类别走与PUT /devices/:id/configs/:category相同的保存和下发流程
+func (s *ConfigProfileService) applyCategory(deviceID uint, category string, values map[string]interface{}, dryRun bool, actor AuditActor, details string) ProfileCategoryResult {
+	result := ProfileCategoryResult{Category: category, Values: values, Status: StepApplied}
+	if dryRun {
+		plan, err := s.preview.PlanConfig(deviceID, category, values)
+		if err != nil {
+			result.Status, result.Errors = StepFailed, []string{err.Error()}
+			return result
+		}
+		result.Changes, result.Commands, result.Warnings, result.Errors = plan.Changes, plan.Commands, plan.Warnings, plan.Errors
+		result.FieldErrors = plan.FieldErrors
+		if !plan.Valid() {
+			result.Status = StepFailed
+		} else {
+			result.Status = StepPending
+		}
+		return result
+	}
+
+	result.Changes = s.configService.changesOrNil(deviceID, category, values)
+	applied, err := s.configService.saveAndRecord(actor, deviceID, category, values, details)
+	result.Applied = applied
+	if err != nil {
+		result.Status, result.Errors = StepFailed, []string{err.Error()}
+		return result
+	}
+	for _, cmd := range applied {
+		if cmd.Status != StepApplied {
+			result.Status = StepFailed
+			msg := cmd.Error
+			if cmd.Command != "" {
+				msg = cmd.Command + ": " + msg
+			}
+			result.Errors = append(result.Errors, msg)
+		}
+	}
+	return result
+}
+
+// applyWireless 无线类别以变更集方式下发，失败时恢复原值且不保存配置
+func (s *ConfigProfileService) applyWireless(deviceID uint, values map[string]interface{}, dryRun bool, actor AuditActor, details string) ProfileCategoryResult {
+	result := ProfileCategoryResult{Category: ConfigCategoryWireless, Values: values, Status: StepApplied}
+	failed := func(err string) ProfileCategoryResult {
+		result.Status = StepFailed
+		result.Errors = append(result.Errors, err)
+		return result
+	}
+
+	// 只修改部分射频参数时，其余参数沿用设备当前值；预览时不访问设备
+	var freq, bandwidth, power string
+	if dryRun {
+		var storedBandwidth string
+		freq, power = s.configService.StoredRadioParams(deviceID)
+		if cfg, err := s.configService.GetDeviceConfigs(deviceID, ConfigCategoryWireless); err == nil {
+			if wc, ok := cfg.(model.WirelessConfig); ok {
+				storedBandwidth = wc.Bandwidth
+			}
+		}
+		if v, err := BandwidthValue(storedBandwidth); err == nil {
+			bandwidth = strconv.Itoa(v)
+		}
+		if profileNeedsRadioParams(values) {
+			result.Warnings = append(result.Warnings, "unchanged radio parameters are taken from the stored configuration, the device was not queried")
+		}
+	} else if profileNeedsRadioParams(values) {
+		freq, bandwidth, power = s.deviceComm.ReadRadioParams(deviceID)
+	}
+	if freq == "" {
+		freq = DefaultRadioFrequency
+	}
+	if power == "" {
+		power = DefaultRadioPower
+	}
+
+	planned, err := profileWirelessCommands(values, freq, bandwidth, power)
+	if err != nil {
+		return failed(err.Error())
+	}
+	stored := profileStoredWireless(values)
+	plan, err := s.preview.PlanWireless(deviceID, "profile", planned, stored)
+	if err != nil {
+		return failed(err.Error())
+	}
+	result.Changes, result.Warnings = plan.Changes, append(result.Warnings, plan.Warnings...)
+	if dryRun {
+		result.Commands, result.Errors, result.FieldErrors = plan.Commands, plan.Errors, plan.FieldErrors
+		if !plan.Valid() {
+			result.Status = StepFailed
+		} else {
+			result.Status = StepPending
+		}
+		return result
+	}
+	if !plan.Valid() {
+		result.Errors, result.FieldErrors = plan.Errors, plan.FieldErrors
+		result.Status = StepFailed
+		return result
+	}
+
+	changeSet, err := s.changeSet.Apply(deviceID, plan.Steps())
+	if err != nil {
+		s.configService.RecordFailedChange(actor, deviceID, ConfigCategoryWireless, stored, nil, err, details)
+		return failed(err.Error())
+	}
+	result.Applied = ChangeSetCommands(changeSet)
+	if !changeSet.Success {
+		s.configService.RecordFailedChange(actor, deviceID, ConfigCategoryWireless, stored, result.Applied, errors.New(changeSet.Error), details)
+		return failed(changeSet.Error)
+	}
+	if err := s.configService.SaveAppliedConfigs(actor, deviceID, ConfigCategoryWireless, stored, result.Applied, details); err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("commands applied but the configuration was not saved: %v", err))
+	}
+	return result
+}
+
+func profileNeedsRadioParams(values map[string]interface{}) bool {
+	_, freq := values["frequency"]
+	_, bw := values["bandwidth"]
+	_, power := values["power"]
+	return freq || bw || power
+}
+
+// profileWirelessCommands 按频段、建链频点、射频参数、跳频的顺序生成无线设置命令。
+// freq、bandwidth（AT指令中的数值）和power是profile未指定时使用的当前值
+func profileWirelessCommands(values map[string]interface{}, freq, bandwidth, power string) ([]PlannedCommand, error) {
+	var planned []PlannedCommand
+	if v, ok := values["frequency_band"]; ok {
+		bands, err := profileStrings(v)
+		if err != nil {
+			return nil, fmt.Errorf("frequency_band: %v", err)
+		}
+		cmd, err := FrequencyBandCommand(bands)
+		if err != nil {
+			return nil, err
+		}
+		planned = append(planned, cmd)
+	}
+	if v, ok := values["building_chain"]; ok {
+		cmd, err := BuildingChainCommand(profileScalar(v))
+		if err != nil {
+			return nil, err
+		}
+		planned = append(planned, cmd)
+	}
+	if profileNeedsRadioParams(values) {
+		if v, ok := values["frequency"]; ok {
+			freq = profileScalar(v)
+		}
+		if v, ok := values["power"]; ok {
+			power = profileScalar(v)
+		}
+		if v, ok := values["bandwidth"]; ok {
+			n, err := BandwidthValue(profileScalar(v))
+			if err != nil {
+				return nil, err
+			}
+			bandwidth = strconv.Itoa(n)
+		}
+		freqValue, err := strconv.Atoi(freq)
+		if err != nil {
+			return nil, fmt.Errorf("invalid frequency %q", freq)
+		}
+		if _, err := strconv.Atoi(power); err != nil {
+			return nil, fmt.Errorf("invalid power %q", power)
+		}
+		if bandwidth == "" {
+			return nil, errors.New("bandwidth is unknown: set it in the profile")
+		}
+		bwValue, err := strconv.Atoi(bandwidth)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bandwidth %q", bandwidth)
+		}
+		planned = append(planned, RadioParamsCommands(freqValue, bwValue, power)...)
+	}
+	if v, ok := values["frequency_hopping"]; ok {
+		enabled, err := profileBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("frequency_hopping: %v", err)
+		}
+		planned = append(planned, FrequencyHoppingCommand(enabled))
+	}
+	return planned, nil
+}
+
+// profileStoredWireless 将profile的无线参数转换为WirelessConfig中保存的字段
+func profileStoredWireless(values map[string]interface{}) map[string]interface{} {
+	stored := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		switch key {
+		case "frequency":
+			n, _ := strconv.Atoi(profileScalar(value))
+			stored["channel"] = n
+		case "power":
+			n, _ := strconv.Atoi(profileScalar(value))
+			stored["transmit_power"] = n
+		case "frequency_hopping":
+			enabled, _ := profileBool(value)
+			stored[key] = enabled
+		default:
+			stored[key] = value
+		}
+	}
+	return stored
+}
+
+func profileStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			out = append(out, profileScalar(item))
+		}
+		return out, nil
+	case []string:
+		return v, nil
+	case string:
+		var out []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("expected a list, got %v", value)
+	}
+}
+
+func profileBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case float64:
+		return v != 0, nil
+	default:
+		return strconv.ParseBool(toString(value))
+	}
+}
+
+// profileScalar JSON数字按整数格式输出，如24100而不是24100.000000
+func profileScalar(value interface{}) string {
+	if f, ok := value.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return toString(value)
+}
+
+// resolveProfileVariables 变量取值优先级：设备变量 > 公共变量 > 默认值；
+// device.*变量总是由设备信息提供
+func resolveProfileVariables(device model.Device, declared []model.ProfileVariable, common, perDevice map[string]string) (map[string]string, error) {
+	resolved := map[string]string{
+		"device.id":      strconv.FormatUint(uint64(device.ID), 10),
+		"device.name":    device.Name,
+		"device.node_id": device.NodeID,
+		"device.ip":      device.IP,
+	}
+	var missing []string
+	for _, v := range declared {
+		value, ok := perDevice[v.Name]
+		if !ok {
+			value, ok = common[v.Name]
+		}
+		if !ok && v.Default != "" {
+			value, ok = v.Default, true
+		}
+		if !ok || (value == "" && v.Required) {
+			if v.Required {
+				missing = append(missing, v.Name)
+			}
+			continue
+		}
+		resolved[v.Name] = value
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required variables: %s", strings.Join(missing, ", "))
+	}
+	return resolved, nil
+}
+
+// substituteProfileValue 替换${name}；整个值就是一个变量时结果为字符串，未赋值的可选变量替换为空
+func substituteProfileValue(value interface{}, variables map[string]string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return profileVariablePattern.ReplaceAllStringFunc(v, func(m string) string {
+			return variables[m[2:len(m)-1]]
+		})
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = substituteProfileValue(item, variables)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+func (s *ConfigProfileService) recordUsage(profileID uint, version int, actor AuditActor, result *ProfileDeviceResult) {
+	usage := &model.ConfigTemplateUsage{
+		TemplateID: profileID,
+		DeviceID:   result.DeviceID,
+		UserID:     actor.UserID,
+		Username:   actor.Username,
+		Version:    version,
+		Variables:  result.Variables,
+		Status:     model.ProfileApplySuccess,
+		Error:      result.Error,
+	}
+	if !result.Success {
+		usage.Status = model.ProfileApplyFailed
+	}
+	if err := s.db.Create(usage).Error; err != nil {
+		result.Error = strings.TrimPrefix(result.Error+"; failed to record profile usage: "+err.Error(), "; ")
+	}
+}
+
+// currentUsages 每台设备最近一次成功下发的profile记录，即设备当前运行的profile版本
+func (s *ConfigProfileService) currentUsages(deviceIDs []uint) (map[uint]model.ConfigTemplateUsage, error) {
+	query := s.db.Where("status = ?", model.ProfileApplySuccess).Order("id DESC")
+	if deviceIDs != nil {
+		query = query.Where("device_id IN ?", deviceIDs)
+	}
+	var usages []model.ConfigTemplateUsage
+	if err := query.Find(&usages).Error; err != nil {
+		return nil, err
+	}
+	current := make(map[uint]model.ConfigTemplateUsage)
+	for _, u := range usages {
+		if _, ok := current[u.DeviceID]; !ok {
+			current[u.DeviceID] = u
+		}
+	}
+	return current, nil
+}
+
+// DeviceStatus 列出当前运行该profile的设备及其版本；laggingOnly时只返回落后于最新版本的设备
+func (s *ConfigProfileService) DeviceStatus(profileID uint, laggingOnly bool) ([]ProfileDeviceStatus, error) {
+	profile, err := getProfile(s.db, profileID)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.currentUsages(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var deviceIDs []uint
+	for id, usage := range current {
+		if usage.TemplateID == profile.ID {
+			deviceIDs = append(deviceIDs, id)
+		}
+	}
+	statuses := []ProfileDeviceStatus{}
+	if len(deviceIDs) == 0 {
+		return statuses, nil
+	}
+	var devices []model.Device
+	if err := s.db.Where("id IN ?", deviceIDs).Order("id").Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		status := s.deviceStatus(device, profile, current[device.ID])
+		if laggingOnly && !status.Lagging {
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// DeviceProfile 返回设备当前运行的profile版本，没有下发过profile时返回gorm.ErrRecordNotFound
+func (s *ConfigProfileService) DeviceProfile(deviceID uint) (*ProfileDeviceStatus, error) {
+	var device model.Device
+	if err := s.db.First(&device, deviceID).Error; err != nil {
+		return nil, err
+	}
+	current, err := s.currentUsages([]uint{deviceID})
+	if err != nil {
+		return nil, err
+	}
+	usage, ok := current[deviceID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	// profile删除后仍然显示设备运行的是哪个profile
+	var profile model.ConfigTemplate
+	if err := s.db.Unscoped().First(&profile, usage.TemplateID).Error; err != nil {
+		return nil, err
+	}
+	status := s.deviceStatus(device, &profile, usage)
+	return &status, nil
+}
+
+func (s *ConfigProfileService) deviceStatus(device model.Device, profile *model.ConfigTemplate, usage model.ConfigTemplateUsage) ProfileDeviceStatus {
+	status := ProfileDeviceStatus{
+		DeviceID:      device.ID,
+		DeviceName:    device.Name,
+		ProfileID:     profile.ID,
+		ProfileName:   profile.Name,
+		Version:       usage.Version,
+		LatestVersion: profile.LatestVersion,
+		Lagging:       usage.Version < profile.LatestVersion,
+		AppliedAt:     usage.CreatedAt,
+		AppliedBy:     usage.Username,
+		Variables:     usage.Variables,
+	}
+	var failed model.ConfigTemplateUsage
+	err := s.db.Where("template_id = ? AND device_id = ? AND status = ? AND id > ?", profile.ID, device.ID, model.ProfileApplyFailed, usage.ID).
+		Order("id DESC").First(&failed).Error
+	if err == nil {
+		status.LastError = fmt.Sprintf("v%d: %s", failed.Version, failed.Error)
+	}
+	return status
+}
+
+// ListUsages 返回profile的下发记录，新的在前
+func (s *ConfigProfileService) ListUsages(profileID uint, limit int) ([]model.ConfigTemplateUsage, error) {
+	if _, err := getProfile(s.db, profileID); err != nil {
+		return nil, err
+	}
+	var usages []model.ConfigTemplateUsage
+	err := s.db.Where("template_id = ?", profileID).Order("id DESC").Limit(auditLimit(limit)).Find(&usages).Error
+	return usages, err
+}
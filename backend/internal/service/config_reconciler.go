@@ -0,0 +1,678 @@
+package service
+
+import (
+	"backend/internal/model"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const configReconcilerWorker = "config_reconciler"
+
+// driftFingerprintPrefix marks a secret drift value replaced by its fingerprint.
+const driftFingerprintPrefix = "fingerprint:"
+
+// DriftCategories 可以设置期望配置的类别（与同步写入 DeviceConfig 的类别一致）
+var DriftCategories = []string{
+	ConfigCategoryWireless,
+	ConfigCategorySecurity,
+	ConfigCategoryNetSetting,
+	ConfigCategoryUpDown,
+	ConfigCategoryDebug,
+	ConfigCategorySystem,
+	"device_type",
+}
+
+// driftSetter maps reported config keys to the board command that sets them
+// and the query command that reads them back.
+type driftSetter struct {
+	command string
+	query   string
+	params  map[string]string // command parameter -> config key
+}
+
+var driftSetters = []driftSetter{
+	{command: "set_radio_params", query: "get_radio_params", params: map[string]string{"freq": "frequency", "bandwidth": "bandwidth", "power": "power"}},
+	{command: "set_encryption_algorithm", query: "get_encryption_algorithm", params: map[string]string{"algorithm": "encryption_algorithm"}},
+	{command: "set_encryption_key", query: "get_access_password", params: map[string]string{"key": "encryption_key"}},
+	{command: "set_tdd_config", query: "get_tdd_config", params: map[string]string{"config": "tdd_config"}},
+	{command: "set_device_type", query: "get_device_type", params: map[string]string{"type": "device_type"}},
+	{command: "set_frequency_hopping", query: "get_frequency_hopping", params: map[string]string{"n": "frequency_hopping"}},
+	{command: "set_slave_max_tx_power", query: "get_slave_max_tx_power", params: map[string]string{"power": "slave_max_tx_power"}},
+	{command: "set_radio_param_report", query: "get_radio_param_report", params: map[string]string{"n": "radio_param_report"}},
+	{command: "set_all_radio_param_report", query: "get_all_radio_param_report", params: map[string]string{"n": "all_radio_param_report"}},
+	{command: "set_access_state", query: "get_access_state", params: map[string]string{"n": "access_state_enabled"}},
+	{command: "set_uart_baud_rate", query: "get_uart_baud_rate", params: map[string]string{"rate": "uart_baud_rate"}},
+}
+
+// setterForKey returns the setter that writes key, or nil if the key cannot be pushed.
+func setterForKey(key string) *driftSetter {
+	for i := range driftSetters {
+		for _, k := range driftSetters[i].params {
+			if k == key {
+				return &driftSetters[i]
+			}
+		}
+	}
+	return nil
+}
+
+// ReconcileResult summarises one reconcile run for a device.
+type ReconcileResult struct {
+	DeviceID     uint                `json:"device_id"`
+	CheckedAt    time.Time           `json:"checked_at"`
+	Drifts       []model.ConfigDrift `json:"drifts"`
+	DriftedCount int                 `json:"drifted_count"`
+	Remediated   []string            `json:"remediated,omitempty"`
+	Errors       []string            `json:"errors,omitempty"`
+}
+
+// ConfigReconciler 定期比较设备期望配置与设备上报配置，按类别策略告警或自动修复
+type ConfigReconciler struct {
+	db           *gorm.DB
+	deviceComm   *DeviceCommService
+	audit        *AuditService
+	supervisor   *Supervisor
+	secrets      *SecretBox
+	interval     time.Duration
+	intervalChan chan time.Duration
+	runMu        sync.Mutex // one reconcile pass at a time
+	mu           sync.Mutex
+}
+
+// NewConfigReconciler 创建配置漂移检测服务；密钥参数的漂移只以secrets的指纹记录
+func NewConfigReconciler(db *gorm.DB, deviceComm *DeviceCommService, audit *AuditService, supervisor *Supervisor, secrets *SecretBox, interval time.Duration) *ConfigReconciler {
+	return &ConfigReconciler{
+		db:           db,
+		deviceComm:   deviceComm,
+		audit:        audit,
+		supervisor:   supervisor,
+		secrets:      secrets,
+		interval:     interval,
+		intervalChan: make(chan time.Duration, 1),
+	}
+}
+
+// Start 在supervisor下启动周期性检测
+func (r *ConfigReconciler) Start() {
+	r.supervisor.Go(configReconcilerWorker, r.loop)
+}
+
+// SetInterval 修改检测间隔
+func (r *ConfigReconciler) SetInterval(interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if interval <= 0 || interval == r.interval {
+		return
+	}
+	r.interval = interval
+	select {
+	case <-r.intervalChan:
+	default:
+	}
+	r.intervalChan <- interval
+	log.Printf("Config reconciler interval set to %v", interval)
+}
+
+func (r *ConfigReconciler) loop(ctx context.Context) error {
+	r.mu.Lock()
+	ticker := time.NewTicker(r.interval)
+	r.mu.Unlock()
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.supervisor.Track(configReconcilerWorker, r.ReconcileAll)
+		case interval := <-r.intervalChan:
+			ticker.Reset(interval)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// GetDesiredConfig 返回设备的期望配置文档（类别 -> 键 -> 值）
+func (r *ConfigReconciler) GetDesiredConfig(deviceID uint) (map[string]map[string]string, error) {
+	var rows []model.DesiredConfig
+	if err := r.db.Where("device_id = ?", deviceID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	doc := make(map[string]map[string]string)
+	for _, row := range rows {
+		if doc[row.Category] == nil {
+			doc[row.Category] = make(map[string]string)
+		}
+		doc[row.Category][row.Key] = row.Value
+	}
+	return doc, nil
+}
+
+// SetDesiredConfig replaces the desired values of one category.
+func (r *ConfigReconciler) SetDesiredConfig(deviceID uint, category string, values map[string]interface{}, updatedBy string) error {
+	if !isDriftCategory(category) {
+		return fmt.Errorf("unsupported config category: %s", category)
+	}
+	if err := r.db.First(&model.Device{}, deviceID).Error; err != nil {
+		return fmt.Errorf("failed to get device: %v", err)
+	}
+	for key, value := range values {
+		if value == nil {
+			return fmt.Errorf("desired value for %s must not be null", key)
+		}
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("device_id = ? AND category = ?", deviceID, category).Delete(&model.DesiredConfig{}).Error; err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(values))
+		for key, value := range values {
+			keys = append(keys, key)
+			row := model.DesiredConfig{
+				DeviceID:  deviceID,
+				Category:  category,
+				Key:       key,
+				Value:     desiredValueString(value),
+				UpdatedBy: updatedBy,
+			}
+			if err := tx.Create(&row).Error; err != nil {
+				return fmt.Errorf("failed to save desired %s: %v", key, err)
+			}
+		}
+		// Drop drift records for keys that are no longer desired
+		stale := tx.Where("device_id = ? AND category = ?", deviceID, category)
+		if len(keys) > 0 {
+			stale = stale.Where("key NOT IN ?", keys)
+		}
+		return stale.Delete(&model.ConfigDrift{}).Error
+	})
+}
+
+// DeleteDesiredConfig 删除一个类别的期望配置
+func (r *ConfigReconciler) DeleteDesiredConfig(deviceID uint, category string) error {
+	return r.SetDesiredConfig(deviceID, category, nil, "")
+}
+
+// GetDrift 返回设备每个期望键的漂移记录，status 为空时返回全部
+func (r *ConfigReconciler) GetDrift(deviceID uint, status string) ([]model.ConfigDrift, error) {
+	query := r.db.Where("device_id = ?", deviceID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var drifts []model.ConfigDrift
+	err := query.Order("category, key").Find(&drifts).Error
+	r.redactDrifts(drifts)
+	return drifts, err
+}
+
+// ListDrift 返回全部设备中不一致的配置项
+func (r *ConfigReconciler) ListDrift() ([]model.ConfigDrift, error) {
+	var drifts []model.ConfigDrift
+	err := r.db.Where("status <> ?", model.DriftStatusInSync).Order("device_id, category, key").Find(&drifts).Error
+	r.redactDrifts(drifts)
+	return drifts, err
+}
+
+// GetPolicies returns the drift mode of every category.
+func (r *ConfigReconciler) GetPolicies() ([]model.DriftPolicy, error) {
+	modes, err := r.policyModes()
+	if err != nil {
+		return nil, err
+	}
+	policies := make([]model.DriftPolicy, 0, len(DriftCategories))
+	for _, category := range DriftCategories {
+		policies = append(policies, model.DriftPolicy{Category: category, Mode: modeFor(modes, category)})
+	}
+	return policies, nil
+}
+
+// SetPolicy 设置类别的漂移处理方式（alert 或 remediate）
+func (r *ConfigReconciler) SetPolicy(category, mode string) error {
+	if !isDriftCategory(category) {
+		return fmt.Errorf("unsupported config category: %s", category)
+	}
+	if mode != model.DriftModeAlert && mode != model.DriftModeRemediate {
+		return fmt.Errorf("invalid drift mode %q, expected %q or %q", mode, model.DriftModeAlert, model.DriftModeRemediate)
+	}
+	var policy model.DriftPolicy
+	err := r.db.Where("category = ?", category).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return r.db.Create(&model.DriftPolicy{Category: category, Mode: mode}).Error
+	}
+	if err != nil {
+		return err
+	}
+	return r.db.Model(&policy).Update("mode", mode).Error
+}
+
+// ReconcileAll 检测所有存在期望配置的设备
+func (r *ConfigReconciler) ReconcileAll() error {
+	var deviceIDs []uint
+	if err := r.db.Model(&model.DesiredConfig{}).Distinct().Pluck("device_id", &deviceIDs).Error; err != nil {
+		return err
+	}
+	failed := 0
+	for _, id := range deviceIDs {
+		result, err := r.ReconcileDevice(id)
+		if err != nil {
+			log.Printf("Reconcile device %d failed: %v", id, err)
+			failed++
+			continue
+		}
+		if result.DriftedCount > 0 {
+			log.Printf("Reconcile device %d: %d drifted keys", id, result.DriftedCount)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("reconcile failed for %d of %d devices", failed, len(deviceIDs))
+	}
+	return nil
+}
+
+// ReconcileDevice compares a device's desired document with its reported
+// state, refreshing the reported state first, and applies the category policy.
+func (r *ConfigReconciler) ReconcileDevice(deviceID uint) (*ReconcileResult, error) {
+	r.runMu.Lock()
+	defer r.runMu.Unlock()
+
+	device, err := r.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %v", err)
+	}
+	var desired []model.DesiredConfig
+	if err := r.db.Where("device_id = ?", deviceID).Find(&desired).Error; err != nil {
+		return nil, err
+	}
+	result := &ReconcileResult{DeviceID: deviceID, CheckedAt: time.Now()}
+	if len(desired) == 0 {
+		return result, nil
+	}
+	modes, err := r.policyModes()
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. 先从设备读取最新上报值
+	result.Errors = append(result.Errors, r.refreshReported(device, desired)...)
+	actual, err := r.reportedValues(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 对设置为 remediate 的类别下发期望值，再读回确认
+	pushed := make(map[string]string) // category/key -> remediation error ("" on success)
+	toFix := make(map[string][]model.DesiredConfig)
+	for _, d := range desired {
+		if modeFor(modes, d.Category) != model.DriftModeRemediate {
+			continue
+		}
+		if value, ok := actual[driftKey(d.Category, d.Key)]; !ok || !sameConfigValue(d.Value, value) {
+			toFix[d.Category] = append(toFix[d.Category], d)
+		}
+	}
+	if len(toFix) > 0 {
+		var fixed []model.DesiredConfig
+		for category, keys := range toFix {
+			for key, err := range r.remediate(device, category, keys, desired, actual) {
+				pushed[driftKey(category, key)] = err
+			}
+			fixed = append(fixed, keys...)
+		}
+		result.Errors = append(result.Errors, r.refreshReported(device, fixed)...)
+		if actual, err = r.reportedValues(deviceID); err != nil {
+			return nil, err
+		}
+	}
+
+	// 3. 记录每个键的比较结果，新出现的漂移产生告警
+	var existing []model.ConfigDrift
+	if err := r.db.Where("device_id = ?", deviceID).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	previous := make(map[string]model.ConfigDrift, len(existing))
+	for _, e := range existing {
+		previous[driftKey(e.Category, e.Key)] = e
+	}
+
+	now := result.CheckedAt
+	for _, d := range desired {
+		k := driftKey(d.Category, d.Key)
+		drift := previous[k]
+		drift.DeviceID, drift.Category, drift.Key = deviceID, d.Category, d.Key
+		drift.Desired = d.Value
+		drift.LastCheckedAt = now
+		drift.Error = ""
+		prevStatus := drift.Status
+
+		value, reported := actual[k]
+		drift.Actual = value
+		switch {
+		case !reported:
+			drift.Status = model.DriftStatusUnreported
+		case sameConfigValue(d.Value, value):
+			drift.Status = model.DriftStatusInSync
+		default:
+			drift.Status = model.DriftStatusDrifted
+		}
+
+		if pushErr, attempted := pushed[k]; attempted {
+			drift.LastRemediatedAt = &now
+			if drift.Status == model.DriftStatusInSync {
+				result.Remediated = append(result.Remediated, k)
+			} else {
+				drift.Status = model.DriftStatusRemediationFailed
+				drift.Error = pushErr
+				if drift.Error == "" {
+					drift.Error = "device did not report the desired value after remediation"
+				}
+			}
+		}
+
+		r.redactDrift(&drift)
+
+		if drift.Status == model.DriftStatusInSync {
+			drift.DriftedSince = nil
+		} else {
+			result.DriftedCount++
+			if drift.DriftedSince == nil {
+				drift.DriftedSince = &now
+			}
+			if prevStatus != drift.Status {
+				r.raiseDriftAlert(drift)
+			}
+		}
+
+		if err := r.db.Save(&drift).Error; err != nil {
+			return nil, fmt.Errorf("failed to save drift for %s: %v", k, err)
+		}
+		result.Drifts = append(result.Drifts, drift)
+	}
+
+	if result.DriftedCount == 0 {
+		r.resolveDriftAlerts(deviceID, now)
+	}
+	sort.Slice(result.Drifts, func(i, j int) bool {
+		return driftKey(result.Drifts[i].Category, result.Drifts[i].Key) < driftKey(result.Drifts[j].Category, result.Drifts[j].Key)
+	})
+	return result, nil
+}
+
+// refreshReported re-reads the desired keys from the device and stores them
+// as the last reported state. Keys without a known query keep their last value.
+func (r *ConfigReconciler) refreshReported(device *model.Device, desired []model.DesiredConfig) []string {
+	queries := make(map[string]bool)
+	for _, d := range desired {
+		if setter := setterForKey(d.Key); setter != nil {
+			queries[setter.query] = true
+		}
+	}
+
+	var errs []string
+	for query := range queries {
+		if _, err := r.deviceComm.boardConfigMgr.GetCommand(device.BoardType, query); err != nil {
+			continue
+		}
+		response, err := r.deviceComm.SendATCommandByName(device.ID, query, nil)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", query, err))
+			continue
+		}
+		parsed, err := r.deviceComm.parseATResponseToConfig(query, response, device.BoardType)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", query, err))
+			continue
+		}
+		if _, raw := parsed["raw_response"]; raw && len(parsed) == 1 {
+			errs = append(errs, fmt.Sprintf("%s: unrecognised response", query))
+			continue
+		}
+		if err := r.deviceComm.saveConfigToDatabase(device.ID, query, parsed); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", query, err))
+		}
+	}
+	return errs
+}
+
+// remediate pushes the desired values of the drifted keys of one category.
+// It returns the keys it attempted, mapped to an error message ("" on success).
+func (r *ConfigReconciler) remediate(device *model.Device, category string, drifted, desired []model.DesiredConfig, actual map[string]string) map[string]string {
+	outcome := make(map[string]string)
+	desiredValues := make(map[string]string)
+	for _, d := range desired {
+		if d.Category == category {
+			desiredValues[d.Key] = d.Value
+		}
+	}
+
+	bySetter := make(map[*driftSetter][]string)
+	for _, d := range drifted {
+		setter := setterForKey(d.Key)
+		if setter == nil {
+			outcome[d.Key] = fmt.Sprintf("no set command known for %s", d.Key)
+			continue
+		}
+		bySetter[setter] = append(bySetter[setter], d.Key)
+	}
+
+	for setter, keys := range bySetter {
+		sent, err := r.pushSetter(device, category, setter, desiredValues, actual)
+		msg := ""
+		if err != nil {
+			msg = err.Error()
+			log.Printf("Remediation %s on device %d failed: %v", setter.command, device.ID, err)
+		} else {
+			log.Printf("Remediation %s on device %d applied for %v", setter.command, device.ID, keys)
+		}
+		r.auditRemediation(device.ID, category, keys, desiredValues, actual, sent, err)
+		for _, key := range keys {
+			outcome[key] = msg
+		}
+	}
+	return outcome
+}
+
+// pushSetter builds the command parameters from the desired values, falling
+// back to the reported ones for parameters that are not part of the document.
+func (r *ConfigReconciler) pushSetter(device *model.Device, category string, setter *driftSetter, desired map[string]string, actual map[string]string) (*model.AuditCommand, error) {
+	cmd, err := r.deviceComm.boardConfigMgr.GetCommand(device.BoardType, setter.command)
+	if err != nil {
+		return nil, err
+	}
+	params := make(map[string]interface{}, len(cmd.Parameters))
+	for _, p := range cmd.Parameters {
+		key, ok := setter.params[p.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s needs parameter %s which has no config key", setter.command, p.Name)
+		}
+		value, ok := desired[key]
+		if !ok {
+			if value, ok = actual[driftKey(category, key)]; !ok {
+				return nil, fmt.Errorf("%s needs %s, which is neither desired nor reported", setter.command, key)
+			}
+		}
+		value = strings.Trim(strings.TrimSpace(value), "\"")
+		if p.Type == "int" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an integer, got %q", key, value)
+			}
+			params[p.Name] = n
+		} else {
+			params[p.Name] = value
+		}
+	}
+	sent := &model.AuditCommand{Name: setter.command, Status: StepApplied}
+	sent.Command, _ = r.deviceComm.FormatCommandByName(device.ID, setter.command, params)
+	sent.Response, err = r.deviceComm.SendATCommandByName(device.ID, setter.command, params)
+	if err != nil {
+		sent.Status, sent.Error = StepFailed, err.Error()
+	}
+	return sent, err
+}
+
+// auditRemediation records one pushed setter; sent is nil when no command
+// could be built.
+func (r *ConfigReconciler) auditRemediation(deviceID uint, category string, keys []string, desired, actual map[string]string, sent *model.AuditCommand, cause error) {
+	entry := &model.ConfigAudit{
+		DeviceID: deviceID,
+		Category: category,
+		Action:   model.AuditActionRemediate,
+		Details:  "drift remediation",
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		entry.Changes = append(entry.Changes, model.PreviewChange{Key: key, From: actual[driftKey(category, key)], To: desired[key]})
+	}
+	if sent != nil {
+		entry.Commands = []model.AuditCommand{*sent}
+	}
+	if cause != nil {
+		entry.Error = cause.Error()
+	}
+	r.audit.Record(SystemActor(configReconcilerWorker), entry)
+}
+
+// reportedValues returns the last reported state keyed by category/key.
+func (r *ConfigReconciler) reportedValues(deviceID uint) (map[string]string, error) {
+	var rows []model.DeviceConfig
+	if err := r.db.Where("device_id = ?", deviceID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(rows))
+	for _, row := range rows {
+		values[driftKey(row.Category, row.Key)] = row.Value
+	}
+	return values, nil
+}
+
+func (r *ConfigReconciler) policyModes() (map[string]string, error) {
+	var policies []model.DriftPolicy
+	if err := r.db.Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	modes := make(map[string]string, len(policies))
+	for _, p := range policies {
+		modes[p.Category] = p.Mode
+	}
+	return modes, nil
+}
+
+// redactDrift 将密钥参数（如encryption_key）的期望值和实际值换成指纹，并去掉错误信息中的密钥，
+// 保存的漂移记录、告警和接口都不含明文；相同的值指纹相同，仍能看出是否一致
+func (r *ConfigReconciler) redactDrift(drift *model.ConfigDrift) {
+	if !isSecretKey(drift.Key) {
+		return
+	}
+	drift.Desired = r.fingerprint(drift.Desired)
+	drift.Actual = r.fingerprint(drift.Actual)
+	drift.Error = secretArgsPattern.ReplaceAllString(drift.Error, "${1}"+redactedValue)
+	drift.Error = quotedPattern.ReplaceAllString(drift.Error, `"`+redactedValue+`"`)
+}
+
+// redactDrifts 处理之前以明文保存的记录
+func (r *ConfigReconciler) redactDrifts(drifts []model.ConfigDrift) {
+	for i := range drifts {
+		r.redactDrift(&drifts[i])
+	}
+}
+
+func (r *ConfigReconciler) fingerprint(value string) string {
+	value = strings.Trim(strings.TrimSpace(value), "\"")
+	if value == "" || strings.HasPrefix(value, driftFingerprintPrefix) {
+		return value
+	}
+	return driftFingerprintPrefix + r.secrets.Fingerprint(value)
+}
+
+func (r *ConfigReconciler) raiseDriftAlert(drift model.ConfigDrift) {
+	level := "warning"
+	message := fmt.Sprintf("Config drift on %s.%s: desired %q, actual %q", drift.Category, drift.Key, drift.Desired, drift.Actual)
+	switch drift.Status {
+	case model.DriftStatusUnreported:
+		message = fmt.Sprintf("Config %s.%s has a desired value %q but the device has not reported it", drift.Category, drift.Key, drift.Desired)
+	case model.DriftStatusRemediationFailed:
+		level = "error"
+		message = fmt.Sprintf("Remediation of %s.%s failed: %s", drift.Category, drift.Key, drift.Error)
+	}
+	alert := model.MonitorAlert{
+		DeviceID: drift.DeviceID,
+		Type:     "config_drift",
+		Level:    level,
+		Message:  message,
+		Status:   "active",
+	}
+	if err := r.db.Create(&alert).Error; err != nil {
+		log.Printf("Failed to create drift alert for device %d: %v", drift.DeviceID, err)
+	}
+}
+
+func (r *ConfigReconciler) resolveDriftAlerts(deviceID uint, now time.Time) {
+	err := r.db.Model(&model.MonitorAlert{}).
+		Where("device_id = ? AND type = ? AND status = ?", deviceID, "config_drift", "active").
+		Updates(map[string]interface{}{"status": "resolved", "resolved_at": now}).Error
+	if err != nil {
+		log.Printf("Failed to resolve drift alerts for device %d: %v", deviceID, err)
+	}
+}
+
+// desiredValueString stores JSON numbers without trailing zeros so they can be
+// passed to integer command parameters; lists are kept as JSON like DeviceConfig.
+func desiredValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(data)
+	}
+}
+
+func isDriftCategory(category string) bool {
+	for _, c := range DriftCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+func modeFor(modes map[string]string, category string) string {
+	if mode, ok := modes[category]; ok {
+		return mode
+	}
+	return model.DriftModeAlert
+}
+
+func driftKey(category, key string) string {
+	return category + "/" + key
+}
+
+// sameConfigValue compares a desired and a reported value, ignoring quoting,
+// surrounding whitespace and numeric formatting ("23" == "23.0").
+func sameConfigValue(desired, actual string) bool {
+	a := strings.Trim(strings.TrimSpace(desired), "\"")
+	b := strings.Trim(strings.TrimSpace(actual), "\"")
+	if a == b || strings.EqualFold(a, b) {
+		return true
+	}
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	return errA == nil && errB == nil && fa == fb
+}
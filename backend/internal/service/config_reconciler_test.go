@@ -0,0 +1,50 @@
+package service
+
+import (
+	"backend/internal/model"
+	"strings"
+	"testing"
+)
+
+func TestRedactDrift(t *testing.T) {
+	r := &ConfigReconciler{secrets: NewSecretBox("test-secret")}
+	fp := driftFingerprintPrefix + r.secrets.Fingerprint("AABB")
+	tests := []struct {
+		name  string
+		drift model.ConfigDrift
+		want  model.ConfigDrift
+	}{
+		{
+			name:  "secret values become fingerprints",
+			drift: model.ConfigDrift{Key: "encryption_key", Desired: "aabb", Actual: `"AABB"`},
+			want:  model.ConfigDrift{Key: "encryption_key", Desired: fp, Actual: fp},
+		},
+		{
+			name:  "already redacted",
+			drift: model.ConfigDrift{Key: "encryption_key", Desired: fp, Actual: ""},
+			want:  model.ConfigDrift{Key: "encryption_key", Desired: fp, Actual: ""},
+		},
+		{
+			name:  "secret in the remediation error",
+			drift: model.ConfigDrift{Key: "access_password", Desired: "aabb", Error: `AT^DAPI="AABB" failed: ERROR`},
+			want:  model.ConfigDrift{Key: "access_password", Desired: fp, Error: "AT^DAPI=" + redactedValue + " failed: ERROR"},
+		},
+		{
+			name:  "other keys unchanged",
+			drift: model.ConfigDrift{Key: "frequency", Desired: "24100", Actual: "24000", Error: `AT^DRPS="1"`},
+			want:  model.ConfigDrift{Key: "frequency", Desired: "24100", Actual: "24000", Error: `AT^DRPS="1"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drift := tt.drift
+			r.redactDrift(&drift)
+			if drift != tt.want {
+				t.Errorf("redactDrift = %+v, want %+v", drift, tt.want)
+			}
+			if strings.Contains(drift.Desired+drift.Actual+drift.Error, "AABB") {
+				t.Errorf("redacted drift still contains the secret: %+v", drift)
+			}
+		})
+	}
+}
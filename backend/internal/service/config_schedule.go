@@ -0,0 +1,591 @@
+package service
+
+import (
+	"backend/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	configSchedulerWorker = "config_scheduler"
+	scheduleTick          = 15 * time.Second
+	// scheduleLockTimeout 超过该时间未刷新的执行锁视为进程崩溃遗留，可以重新获取；
+	// 执行中每处理完一台设备刷新一次
+	scheduleLockTimeout  = time.Hour
+	defaultMisfireGrace  = 300 // seconds
+	maxMissedRunsCounted = 1000
+)
+
+var (
+	// ErrScheduleRunning is returned when a run is requested while the
+	// schedule is already executing.
+	ErrScheduleRunning = errors.New("schedule is already running")
+	// ErrScheduleInvalid wraps validation failures of a schedule definition.
+	ErrScheduleInvalid = errors.New("invalid schedule")
+)
+
+// ConfigScheduler 定时配置任务：按cron表达式对设备或设备组执行保存的配置变更或AT命令序列，
+// 每次执行记录到ConfigScheduleLog。定时任务无人确认，命令序列不能包含危险命令（重启、恢复出厂设置、关机）
+type ConfigScheduler struct {
+	db            *gorm.DB
+	deviceComm    *DeviceCommService
+	configService *ConfigService
+	operations    *DeviceOperationService
+	audit         *AuditService
+	supervisor    *Supervisor
+	running       sync.WaitGroup
+
+	mu     sync.Mutex
+	active map[uint]bool // schedules executing in this process
+}
+
+// NewConfigScheduler 创建定时配置任务服务
+func NewConfigScheduler(db *gorm.DB, deviceComm *DeviceCommService, configService *ConfigService, operations *DeviceOperationService, audit *AuditService, supervisor *Supervisor) *ConfigScheduler {
+	return &ConfigScheduler{
+		db:            db,
+		deviceComm:    deviceComm,
+		configService: configService,
+		operations:    operations,
+		audit:         audit,
+		supervisor:    supervisor,
+		active:        make(map[uint]bool),
+	}
+}
+
+// Start 在supervisor下启动调度循环
+func (s *ConfigScheduler) Start() {
+	s.supervisor.Go(configSchedulerWorker, s.loop)
+}
+
+func (s *ConfigScheduler) loop(ctx context.Context) error {
+	ticker := time.NewTicker(scheduleTick)
+	defer ticker.Stop()
+	// 等待已开始的任务执行完，避免关闭时中断命令序列
+	defer s.running.Wait()
+
+	s.supervisor.Track(configSchedulerWorker, s.runDue)
+	for {
+		select {
+		case <-ticker.C:
+			s.supervisor.Track(configSchedulerWorker, s.runDue)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// runDue starts every active schedule whose next run time has passed.
+func (s *ConfigScheduler) runDue() error {
+	now := time.Now()
+	var due []model.ConfigSchedule
+	err := s.db.Where("status = ? AND next_run_at IS NOT NULL AND next_run_at <= ?", model.ScheduleStatusActive, now).
+		Find(&due).Error
+	if err != nil {
+		return err
+	}
+	for i := range due {
+		schedule := due[i]
+		trigger := model.ScheduleTriggerCron
+		if late := now.Sub(*schedule.NextRunAt); late > misfireGrace(&schedule) {
+			if schedule.MisfirePolicy == model.MisfireSkip {
+				s.skipMissed(&schedule, now)
+				continue
+			}
+			trigger = model.ScheduleTriggerMisfire
+		}
+		if !s.claim(schedule.ID, now, true) {
+			continue
+		}
+		s.running.Add(1)
+		go func() {
+			defer s.running.Done()
+			s.execute(&schedule, trigger, *schedule.NextRunAt)
+		}()
+	}
+	return nil
+}
+
+// claim takes the schedule's run lock. It fails while the schedule executes
+// in this process, when another run holds a lock refreshed within
+// scheduleLockTimeout, or, for cron runs, when the schedule is no longer due
+// because another run already moved its next run time.
+func (s *ConfigScheduler) claim(id uint, now time.Time, cronRun bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active[id] {
+		return false
+	}
+	query := s.db.Model(&model.ConfigSchedule{}).
+		Where("id = ? AND (running_since IS NULL OR running_since < ?)", id, now.Add(-scheduleLockTimeout))
+	if cronRun {
+		query = query.Where("status = ? AND next_run_at <= ?", model.ScheduleStatusActive, now)
+	}
+	res := query.Update("running_since", now)
+	if res.Error != nil {
+		log.Printf("Failed to lock schedule %d: %v", id, res.Error)
+		return false
+	}
+	if res.RowsAffected != 1 {
+		return false
+	}
+	s.active[id] = true
+	return true
+}
+
+// refreshLock keeps a long run's lock from being taken over as stale.
+func (s *ConfigScheduler) refreshLock(id uint) {
+	if err := s.db.Model(&model.ConfigSchedule{}).Where("id = ?", id).Update("running_since", time.Now()).Error; err != nil {
+		log.Printf("Failed to refresh the lock of schedule %d: %v", id, err)
+	}
+}
+
+// skipMissed logs the runs missed during downtime and moves the schedule to
+// its next activation without running it.
+func (s *ConfigScheduler) skipMissed(schedule *model.ConfigSchedule, now time.Time) {
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return
+	}
+	missed := countMissed(cron, *schedule.NextRunAt, now)
+	next := nextRunAt(cron, now)
+	res := s.db.Model(&model.ConfigSchedule{}).
+		Where("id = ? AND running_since IS NULL AND next_run_at <= ?", schedule.ID, now).
+		Updates(map[string]interface{}{"next_run_at": next, "last_status": model.ScheduleRunMissed})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return
+	}
+	s.db.Create(&model.ConfigScheduleLog{
+		ScheduleID:   schedule.ID,
+		Trigger:      model.ScheduleTriggerMisfire,
+		ScheduledFor: *schedule.NextRunAt,
+		StartedAt:    now,
+		FinishedAt:   now,
+		Status:       model.ScheduleRunMissed,
+		Message:      fmt.Sprintf("skipped %d missed run(s) per misfire policy", missed),
+	})
+	log.Printf("Schedule %d (%s) skipped %d missed run(s)", schedule.ID, schedule.Name, missed)
+}
+
+// execute runs schedule against all its devices, logs the run and releases
+// the lock. The caller must hold the lock.
+func (s *ConfigScheduler) execute(schedule *model.ConfigSchedule, trigger string, scheduledFor time.Time) *model.ConfigScheduleLog {
+	runLog := &model.ConfigScheduleLog{
+		ScheduleID:   schedule.ID,
+		Trigger:      trigger,
+		ScheduledFor: scheduledFor,
+		StartedAt:    time.Now(),
+	}
+	if trigger == model.ScheduleTriggerMisfire {
+		if cron, err := ParseCron(schedule.Cron); err == nil {
+			runLog.Message = fmt.Sprintf("catching up after %d missed run(s); ", countMissed(cron, scheduledFor, runLog.StartedAt))
+		}
+	}
+
+	actor := SystemActor(fmt.Sprintf("schedule/%d", schedule.ID))
+	failed := 0
+	for _, deviceID := range scheduleTargets(schedule) {
+		result := s.runOnDevice(actor, schedule, deviceID)
+		if !result.Success {
+			failed++
+		}
+		runLog.Results = append(runLog.Results, result)
+		s.refreshLock(schedule.ID)
+	}
+	runLog.FinishedAt = time.Now()
+	switch {
+	case failed == 0:
+		runLog.Status = model.ScheduleRunSuccess
+	case failed == len(runLog.Results):
+		runLog.Status = model.ScheduleRunFailed
+	default:
+		runLog.Status = model.ScheduleRunPartial
+	}
+	runLog.Message += fmt.Sprintf("%d/%d device(s) succeeded", len(runLog.Results)-failed, len(runLog.Results))
+	if err := s.db.Create(runLog).Error; err != nil {
+		log.Printf("Failed to log run of schedule %d: %v", schedule.ID, err)
+	}
+
+	// 手动执行不影响下一次计划时间；执行期间被暂停的任务不再排期
+	if trigger != model.ScheduleTriggerManual {
+		if cron, err := ParseCron(schedule.Cron); err == nil {
+			s.db.Model(&model.ConfigSchedule{}).
+				Where("id = ? AND status = ?", schedule.ID, model.ScheduleStatusActive).
+				Update("next_run_at", nextRunAt(cron, runLog.FinishedAt))
+		}
+	}
+	err := s.db.Model(&model.ConfigSchedule{}).Where("id = ?", schedule.ID).Updates(map[string]interface{}{
+		"running_since": nil,
+		"last_run_at":   runLog.StartedAt,
+		"last_status":   runLog.Status,
+	}).Error
+	if err != nil {
+		log.Printf("Failed to release schedule %d: %v", schedule.ID, err)
+	}
+	s.mu.Lock()
+	delete(s.active, schedule.ID)
+	s.mu.Unlock()
+	log.Printf("Schedule %d (%s) %s run: %s", schedule.ID, schedule.Name, trigger, runLog.Message)
+	return runLog
+}
+
+func (s *ConfigScheduler) runOnDevice(actor AuditActor, schedule *model.ConfigSchedule, deviceID uint) model.ScheduleDeviceResult {
+	result := model.ScheduleDeviceResult{DeviceID: deviceID}
+	details := fmt.Sprintf("schedule %d: %s", schedule.ID, schedule.Name)
+
+	if schedule.Kind == model.ScheduleKindConfig {
+		sent, err := s.configService.saveAndRecord(actor, deviceID, schedule.Category, schedule.Configs, details)
+		result.Commands = sent
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		for _, cmd := range sent {
+			if cmd.Status != StepApplied {
+				result.Error = fmt.Sprintf("%s %s: %s", cmd.Command, cmd.Status, cmd.Error)
+				return result
+			}
+		}
+		result.Success = true
+		return result
+	}
+
+	// 命令序列：按顺序下发，某一步失败则停止该设备后续命令
+	entry := &model.ConfigAudit{
+		DeviceID: deviceID,
+		Category: "at_command",
+		Action:   model.AuditActionATCommand,
+		Details:  details,
+	}
+	for _, step := range schedule.Commands {
+		cmd := model.AuditCommand{Name: step.Name, Command: step.Command, Status: StepApplied}
+		var err error
+		// 单板定义可能在任务保存后被修改，下发前再次检查
+		if destructive, _ := s.destructiveStep(deviceID, step); destructive != nil {
+			cmd.Command = destructive.Command
+			err = fmt.Errorf("refused: %s is a %s command and cannot run from a schedule", destructive.Command, destructive.Kind)
+		} else if step.Command != "" {
+			cmd.Response, err = s.deviceComm.SendATCommand(deviceID, step.Command)
+		} else {
+			cmd.Command, _ = s.deviceComm.FormatCommandByName(deviceID, step.Name, step.Params)
+			cmd.Response, err = s.deviceComm.SendATCommandByName(deviceID, step.Name, step.Params)
+		}
+		// 单板以ERROR拒绝命令时请求本身是成功的，同样按失败处理
+		if err == nil && strings.Contains(cmd.Response, "ERROR") {
+			err = fmt.Errorf("device rejected command: %s", strings.TrimSpace(cmd.Response))
+		}
+		if err != nil {
+			cmd.Status, cmd.Error = StepFailed, err.Error()
+			entry.Error = err.Error()
+		}
+		entry.Commands = append(entry.Commands, cmd)
+		if err != nil {
+			break
+		}
+	}
+	s.audit.Record(actor, entry)
+	result.Commands = entry.Commands
+	result.Error = entry.Error
+	result.Success = entry.Error == ""
+	return result
+}
+
+// CreateSchedule 校验并保存定时任务，计算首次执行时间
+func (s *ConfigScheduler) CreateSchedule(schedule *model.ConfigSchedule, createdBy string) error {
+	schedule.ID = 0
+	schedule.CreatedBy = createdBy
+	if schedule.Status == "" {
+		schedule.Status = model.ScheduleStatusActive
+	}
+	if err := s.prepare(schedule); err != nil {
+		return err
+	}
+	return s.db.Create(schedule).Error
+}
+
+// UpdateSchedule 替换定时任务定义，保留执行状态
+func (s *ConfigScheduler) UpdateSchedule(id uint, update *model.ConfigSchedule) (*model.ConfigSchedule, error) {
+	schedule, err := s.GetSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	schedule.DeviceID = update.DeviceID
+	schedule.DeviceIDs = update.DeviceIDs
+	schedule.Category = update.Category
+	schedule.Name = update.Name
+	schedule.Description = update.Description
+	schedule.Cron = update.Cron
+	schedule.Kind = update.Kind
+	schedule.Configs = update.Configs
+	schedule.Commands = update.Commands
+	schedule.MisfirePolicy = update.MisfirePolicy
+	schedule.MisfireGrace = update.MisfireGrace
+	if err := s.prepare(schedule); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(schedule).Error; err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// prepare validates schedule and sets defaults and the next run time.
+func (s *ConfigScheduler) prepare(schedule *model.ConfigSchedule) error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrScheduleInvalid, fmt.Sprintf(format, args...))
+	}
+	if strings.TrimSpace(schedule.Name) == "" {
+		return invalid("name is required")
+	}
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return invalid("%v", err)
+	}
+
+	targets := scheduleTargets(schedule)
+	if len(targets) == 0 {
+		return invalid("device_id or device_ids is required")
+	}
+	var found int64
+	if err := s.db.Model(&model.Device{}).Where("id IN ?", targets).Count(&found).Error; err != nil {
+		return err
+	}
+	if int(found) != len(targets) {
+		return invalid("device_ids contains unknown devices")
+	}
+
+	if schedule.Kind == "" {
+		schedule.Kind = model.ScheduleKindConfig
+		if len(schedule.Commands) > 0 {
+			schedule.Kind = model.ScheduleKindCommands
+		}
+	}
+	switch schedule.Kind {
+	case model.ScheduleKindConfig:
+		if len(schedule.Configs) == 0 {
+			return invalid("configs is required")
+		}
+		if _, err := s.configService.PlanCommands(targets[0], schedule.Category, schedule.Configs); err != nil {
+			return invalid("%v", err)
+		}
+		schedule.Commands = nil
+	case model.ScheduleKindCommands:
+		if len(schedule.Commands) == 0 {
+			return invalid("commands is required")
+		}
+		for i, step := range schedule.Commands {
+			if step.Command == "" && step.Name == "" {
+				return invalid("commands[%d] needs command or name", i)
+			}
+			if step.Command != "" && !strings.HasPrefix(strings.ToUpper(step.Command), "AT") {
+				return invalid("commands[%d] %q is not an AT command", i, step.Command)
+			}
+			// 命名命令按每台目标设备的单板类型校验参数；危险命令需要管理员确认，只能通过设备操作或重启作业执行
+			for _, id := range targets {
+				if step.Name != "" {
+					if err := s.deviceComm.ValidateCommand(id, step.Name, step.Params); err != nil {
+						return fmt.Errorf("%w: commands[%d] on device %d: %w", ErrScheduleInvalid, i, id, err)
+					}
+				}
+				destructive, err := s.destructiveStep(id, step)
+				if err != nil {
+					return invalid("commands[%d] on device %d: %v", i, id, err)
+				}
+				if destructive != nil {
+					return invalid("commands[%d] %s is a %s command on device %d; destructive commands cannot be scheduled, use a device operation or reboot job", i, destructive.Command, destructive.Kind, id)
+				}
+			}
+		}
+		schedule.Configs = nil
+		if schedule.Category == "" {
+			schedule.Category = "at_command"
+		}
+	default:
+		return invalid("unknown kind %q", schedule.Kind)
+	}
+
+	switch schedule.MisfirePolicy {
+	case "":
+		schedule.MisfirePolicy = model.MisfireRunOnce
+	case model.MisfireRunOnce, model.MisfireSkip:
+	default:
+		return invalid("unknown misfire_policy %q", schedule.MisfirePolicy)
+	}
+	if schedule.MisfireGrace < 0 {
+		return invalid("misfire_grace must be >= 0")
+	}
+	if schedule.MisfireGrace == 0 {
+		schedule.MisfireGrace = defaultMisfireGrace
+	}
+	switch schedule.Status {
+	case model.ScheduleStatusActive:
+		next := nextRunAt(cron, time.Now())
+		if next == nil {
+			return invalid("cron expression %q never fires", schedule.Cron)
+		}
+		schedule.NextRunAt = next
+	case model.ScheduleStatusPaused:
+		schedule.NextRunAt = nil
+	default:
+		return invalid("unknown status %q", schedule.Status)
+	}
+	return nil
+}
+
+// ListSchedules 列出定时任务，deviceID非0时只返回以该设备为目标的任务
+func (s *ConfigScheduler) ListSchedules(deviceID uint) ([]model.ConfigSchedule, error) {
+	var schedules []model.ConfigSchedule
+	if err := s.db.Order("id").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	if deviceID == 0 {
+		return schedules, nil
+	}
+	filtered := []model.ConfigSchedule{}
+	for _, schedule := range schedules {
+		for _, id := range scheduleTargets(&schedule) {
+			if id == deviceID {
+				filtered = append(filtered, schedule)
+				break
+			}
+		}
+	}
+	return filtered, nil
+}
+
+// GetSchedule 获取定时任务
+func (s *ConfigScheduler) GetSchedule(id uint) (*model.ConfigSchedule, error) {
+	var schedule model.ConfigSchedule
+	if err := s.db.First(&schedule, id).Error; err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// DeleteSchedule 删除定时任务；正在执行的任务会执行完本次
+func (s *ConfigScheduler) DeleteSchedule(id uint) error {
+	res := s.db.Delete(&model.ConfigSchedule{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// PauseSchedule 暂停定时任务
+func (s *ConfigScheduler) PauseSchedule(id uint) (*model.ConfigSchedule, error) {
+	schedule, err := s.GetSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Model(schedule).Updates(map[string]interface{}{
+		"status":      model.ScheduleStatusPaused,
+		"next_run_at": nil,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSchedule(id)
+}
+
+// ResumeSchedule 恢复定时任务，从当前时间计算下一次执行，暂停期间的执行不补跑
+func (s *ConfigScheduler) ResumeSchedule(id uint) (*model.ConfigSchedule, error) {
+	schedule, err := s.GetSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScheduleInvalid, err)
+	}
+	err = s.db.Model(schedule).Updates(map[string]interface{}{
+		"status":      model.ScheduleStatusActive,
+		"next_run_at": nextRunAt(cron, time.Now()),
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSchedule(id)
+}
+
+// RunNow 立即执行一次（同步），不改变下一次计划时间
+func (s *ConfigScheduler) RunNow(id uint) (*model.ConfigScheduleLog, error) {
+	schedule, err := s.GetSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !s.claim(schedule.ID, now, false) {
+		return nil, ErrScheduleRunning
+	}
+	s.running.Add(1)
+	defer s.running.Done()
+	return s.execute(schedule, model.ScheduleTriggerManual, now), nil
+}
+
+// ListLogs 获取定时任务的执行记录，按时间倒序
+func (s *ConfigScheduler) ListLogs(id uint, limit int) ([]model.ConfigScheduleLog, error) {
+	var logs []model.ConfigScheduleLog
+	err := s.db.Where("schedule_id = ?", id).Order("id DESC").Limit(auditLimit(limit)).Find(&logs).Error
+	return logs, err
+}
+
+// destructiveStep 返回命令步骤在设备上对应的危险命令，不是危险命令时返回nil
+func (s *ConfigScheduler) destructiveStep(deviceID uint, step model.ScheduleCommand) (*DestructiveCommand, error) {
+	command := step.Command
+	if command == "" {
+		var err error
+		if command, err = s.deviceComm.FormatCommandByName(deviceID, step.Name, step.Params); err != nil {
+			return nil, err
+		}
+	}
+	return s.operations.Classify(deviceID, step.Name, command)
+}
+
+func scheduleTargets(schedule *model.ConfigSchedule) []uint {
+	if schedule.DeviceID != 0 {
+		return []uint{schedule.DeviceID}
+	}
+	seen := make(map[uint]bool, len(schedule.DeviceIDs))
+	var targets []uint
+	for _, id := range schedule.DeviceIDs {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			targets = append(targets, id)
+		}
+	}
+	return targets
+}
+
+func misfireGrace(schedule *model.ConfigSchedule) time.Duration {
+	grace := schedule.MisfireGrace
+	if grace <= 0 {
+		grace = defaultMisfireGrace
+	}
+	return time.Duration(grace) * time.Second
+}
+
+func nextRunAt(cron *CronSchedule, after time.Time) *time.Time {
+	next := cron.Next(after)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
+
+// countMissed counts activations from first up to now, capped.
+func countMissed(cron *CronSchedule, first, now time.Time) int {
+	missed := 0
+	for t := first; !t.IsZero() && !t.After(now) && missed < maxMissedRunsCounted; t = cron.Next(t) {
+		missed++
+	}
+	return missed
+}
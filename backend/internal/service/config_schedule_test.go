@@ -0,0 +1,53 @@
+package service
+
+import (
+	"backend/internal/model"
+	"testing"
+	"time"
+)
+
+func TestConfigSchedulerClaim(t *testing.T) {
+	now := time.Now()
+	stale := now.Add(-2 * scheduleLockTimeout)
+	fresh := now.Add(-time.Minute)
+	tests := []struct {
+		name          string
+		runningSince  *time.Time
+		activeHere    bool
+		want          bool
+		wantRunningAt bool // running_since moved to now
+	}{
+		{name: "free", want: true, wantRunningAt: true},
+		{name: "held by another process", runningSince: &fresh, want: false},
+		{name: "stale lock from a crashed process", runningSince: &stale, want: true, wantRunningAt: true},
+		// A run that outlives scheduleLockTimeout is still running in this process.
+		{name: "long run in this process", runningSince: &stale, activeHere: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, &model.ConfigSchedule{})
+			schedule := model.ConfigSchedule{Name: "s", Cron: "* * * * *", Status: model.ScheduleStatusActive, RunningSince: tt.runningSince}
+			if err := db.Create(&schedule).Error; err != nil {
+				t.Fatalf("create schedule: %v", err)
+			}
+			s := NewConfigScheduler(db, nil, nil, nil, nil, nil)
+			if tt.activeHere {
+				s.active[schedule.ID] = true
+			}
+			if got := s.claim(schedule.ID, now, false); got != tt.want {
+				t.Fatalf("claim = %v, want %v", got, tt.want)
+			}
+			if tt.want && !s.active[schedule.ID] {
+				t.Errorf("claimed schedule not marked active")
+			}
+			var stored model.ConfigSchedule
+			db.First(&stored, schedule.ID)
+			if moved := stored.RunningSince != nil && stored.RunningSince.Equal(now); moved != tt.wantRunningAt {
+				t.Errorf("running_since = %v, want moved to now: %v", stored.RunningSince, tt.wantRunningAt)
+			}
+			if tt.want && s.claim(schedule.ID, now, false) {
+				t.Errorf("second claim succeeded while the first run holds the lock")
+			}
+		})
+	}
+}
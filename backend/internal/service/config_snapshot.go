@@ -0,0 +1,522 @@
+package service
+
+import (
+	"backend/internal/model"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	configSnapshotWorker = "config_snapshots"
+	snapshotCategoryAll  = "all"
+)
+
+// restoreOrder 恢复时的下发顺序：先存储参数(DRPS)再生效参数(DRPC)，频段相关其次，
+// 加密和设备类型靠后，网络接口最后（修改IP后可能无法再访问设备）
+var restoreOrder = map[string]int{
+	"AT^DRPS":     10,
+	"AT^DRPC":     11,
+	"AT^DAOCNDI":  20,
+	"AT^DSONSBR":  21,
+	"AT^DLF":      22,
+	"AT^DFHC":     23,
+	"AT^DCIAC":    40,
+	"AT^DAPI":     41,
+	"AT^DDTC":     50,
+	"AT^NETIFCFG": 60,
+}
+
+// restoreExcluded are never replayed from a snapshot.
+var restoreExcluded = map[string]string{
+	"AT+CFUN": "changing phone functionality can take the radio offline",
+}
+
+const restoreOrderDefault = 30
+
+// SnapshotChange is one difference between two snapshots.
+type SnapshotChange struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	Status  string `json:"status"` // added, removed or changed
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+}
+
+// SnapshotDiff compares two snapshots.
+type SnapshotDiff struct {
+	FromID          uint             `json:"from_id"`
+	ToID            uint             `json:"to_id"`
+	FromFirmware    string           `json:"from_firmware"`
+	ToFirmware      string           `json:"to_firmware"`
+	FirmwareChanged bool             `json:"firmware_changed"`
+	Changes         []SnapshotChange `json:"changes"`
+}
+
+// RestoreSkip is a snapshot entry that restore does not replay.
+type RestoreSkip struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// RestorePlan is the ordered list of set commands that restores a snapshot.
+type RestorePlan struct {
+	SnapshotID uint          `json:"snapshot_id"`
+	DeviceID   uint          `json:"device_id"`
+	Steps      []ChangeStep  `json:"steps"`
+	Skipped    []RestoreSkip `json:"skipped"`
+}
+
+// RestoreResult is the outcome of a restore.
+type RestoreResult struct {
+	*RestorePlan
+	PreRestoreSnapshotID uint             `json:"pre_restore_snapshot_id"`
+	Unchanged            []string         `json:"unchanged"`
+	ChangeSet            *ChangeSetResult `json:"change_set,omitempty"`
+	Success              bool             `json:"success"`
+	Error                string           `json:"error,omitempty"`
+}
+
+// ConfigSnapshotService 设备配置快照：执行单板YAML中所有查询命令保存完整配置，
+// 支持定时快照、快照比较和按安全顺序恢复
+type ConfigSnapshotService struct {
+	db           *gorm.DB
+	deviceComm   *DeviceCommService
+	changeSet    *ChangeSetExecutor
+	audit        *AuditService
+	supervisor   *Supervisor
+	interval     time.Duration // 0 disables scheduled snapshots
+	retention    int           // scheduled snapshots kept per device
+	intervalChan chan time.Duration
+	mu           sync.Mutex
+}
+
+// NewConfigSnapshotService 创建配置快照服务
+func NewConfigSnapshotService(db *gorm.DB, deviceComm *DeviceCommService, changeSet *ChangeSetExecutor, audit *AuditService, supervisor *Supervisor, interval time.Duration, retention int) *ConfigSnapshotService {
+	return &ConfigSnapshotService{
+		db:           db,
+		deviceComm:   deviceComm,
+		changeSet:    changeSet,
+		audit:        audit,
+		supervisor:   supervisor,
+		interval:     interval,
+		retention:    retention,
+		intervalChan: make(chan time.Duration, 1),
+	}
+}
+
+// Start 在supervisor下启动定时快照
+func (s *ConfigSnapshotService) Start() {
+	s.supervisor.Go(configSnapshotWorker, s.loop)
+}
+
+// SetSchedule 修改定时快照间隔和保留数量，间隔为0时停止定时快照
+func (s *ConfigSnapshotService) SetSchedule(interval time.Duration, retention int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if retention > 0 {
+		s.retention = retention
+	}
+	if interval < 0 || interval == s.interval {
+		return
+	}
+	s.interval = interval
+	select {
+	case <-s.intervalChan:
+	default:
+	}
+	s.intervalChan <- interval
+	log.Printf("Config snapshot interval set to %v", interval)
+}
+
+func (s *ConfigSnapshotService) loop(ctx context.Context) error {
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	reset := func(interval time.Duration) {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, tick = nil, nil
+		}
+		if interval > 0 {
+			ticker = time.NewTicker(interval)
+			tick = ticker.C
+		}
+	}
+	s.mu.Lock()
+	reset(s.interval)
+	s.mu.Unlock()
+	defer func() { reset(0) }()
+
+	for {
+		select {
+		case <-tick:
+			s.supervisor.Track(configSnapshotWorker, s.SnapshotAll)
+		case interval := <-s.intervalChan:
+			reset(interval)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// SnapshotAll takes a scheduled snapshot of every online device and prunes
+// scheduled snapshots beyond the retention count.
+func (s *ConfigSnapshotService) SnapshotAll() error {
+	var devices []model.Device
+	if err := s.db.Where("status = ?", "Online").Find(&devices).Error; err != nil {
+		return err
+	}
+	failed := 0
+	for _, device := range devices {
+		if _, err := s.TakeSnapshot(device.ID, "scheduled snapshot", model.SnapshotSourceScheduled, ""); err != nil {
+			log.Printf("Scheduled snapshot of device %d failed: %v", device.ID, err)
+			failed++
+			continue
+		}
+		s.prune(device.ID)
+	}
+	if failed > 0 {
+		return fmt.Errorf("snapshot failed for %d of %d devices", failed, len(devices))
+	}
+	return nil
+}
+
+func (s *ConfigSnapshotService) prune(deviceID uint) {
+	s.mu.Lock()
+	retention := s.retention
+	s.mu.Unlock()
+
+	var stale []uint
+	s.db.Model(&model.ConfigBackup{}).
+		Where("device_id = ? AND source = ?", deviceID, model.SnapshotSourceScheduled).
+		Order("created_at DESC, id DESC").Offset(retention).Pluck("id", &stale)
+	if len(stale) > 0 {
+		s.db.Unscoped().Delete(&model.ConfigBackup{}, stale)
+	}
+}
+
+// TakeSnapshot runs every query command of the device's board and stores the
+// reported values. It fails if the device answered none of them.
+func (s *ConfigSnapshotService) TakeSnapshot(deviceID uint, description, source, createdBy string) (*model.ConfigBackup, error) {
+	device, err := s.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	commands, err := s.deviceComm.boardConfigMgr.GetAvailableCommands(device.BoardType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load board config: %v", err)
+	}
+
+	snapshot := &model.ConfigBackup{
+		DeviceID:    deviceID,
+		Category:    snapshotCategoryAll,
+		Configs:     make(map[string]model.SnapshotEntry),
+		Description: description,
+		BoardType:   device.BoardType,
+		Source:      source,
+		CreatedBy:   createdBy,
+	}
+	for _, name := range snapshotQueries(commands) {
+		query := commands[name].ATCommand
+		entry := model.SnapshotEntry{Command: query}
+		response, err := s.deviceComm.sendHTTPRequestToDevice(device, ATCommandRequest{Command: query, Timeout: 10})
+		if err == nil {
+			s.deviceComm.logCommandExecution(deviceID, query, response, "")
+			entry.Value, err = extractReportedValue(query, response)
+		}
+		if err != nil {
+			entry.Error = err.Error()
+			snapshot.FailedCount++
+		}
+		snapshot.Configs[name] = entry
+	}
+	if len(snapshot.Configs) == 0 {
+		return nil, fmt.Errorf("board %s has no query commands", device.BoardType)
+	}
+	if snapshot.FailedCount == len(snapshot.Configs) {
+		return nil, fmt.Errorf("device did not answer any query command")
+	}
+	if info, ok := snapshot.Configs["get_device_info"]; ok && info.Error == "" {
+		snapshot.FirmwareVersion = strings.Trim(info.Value, "\"")
+	}
+
+	if err := s.db.Create(snapshot).Error; err != nil {
+		return nil, fmt.Errorf("failed to save snapshot: %v", err)
+	}
+	return snapshot, nil
+}
+
+// ImportSnapshot stores an uploaded backup as a snapshot of deviceID.
+func (s *ConfigSnapshotService) ImportSnapshot(deviceID uint, backup *model.ConfigBackup, createdBy string) (*model.ConfigBackup, error) {
+	device, err := s.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	if len(backup.Configs) == 0 {
+		return nil, fmt.Errorf("backup contains no configuration")
+	}
+	if backup.BoardType != "" && backup.BoardType != device.BoardType {
+		return nil, fmt.Errorf("backup was taken on board %s, device is %s", backup.BoardType, device.BoardType)
+	}
+	snapshot := &model.ConfigBackup{
+		DeviceID:        deviceID,
+		Category:        snapshotCategoryAll,
+		Configs:         backup.Configs,
+		Description:     backup.Description,
+		BoardType:       device.BoardType,
+		FirmwareVersion: backup.FirmwareVersion,
+		Source:          model.SnapshotSourceImport,
+		CreatedBy:       createdBy,
+		FailedCount:     backup.FailedCount,
+	}
+	if err := s.db.Create(snapshot).Error; err != nil {
+		return nil, fmt.Errorf("failed to save snapshot: %v", err)
+	}
+	return snapshot, nil
+}
+
+// ListSnapshots 获取设备的快照列表，最新的在前
+func (s *ConfigSnapshotService) ListSnapshots(deviceID uint) ([]model.ConfigBackup, error) {
+	var snapshots []model.ConfigBackup
+	err := s.db.Where("device_id = ? AND category = ?", deviceID, snapshotCategoryAll).
+		Order("created_at DESC, id DESC").Find(&snapshots).Error
+	return snapshots, err
+}
+
+// GetSnapshot 获取快照
+func (s *ConfigSnapshotService) GetSnapshot(id uint) (*model.ConfigBackup, error) {
+	var snapshot model.ConfigBackup
+	if err := s.db.Where("category = ?", snapshotCategoryAll).First(&snapshot, id).Error; err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// DeleteSnapshot 删除快照
+func (s *ConfigSnapshotService) DeleteSnapshot(id uint) error {
+	if _, err := s.GetSnapshot(id); err != nil {
+		return err
+	}
+	return s.db.Delete(&model.ConfigBackup{}, id).Error
+}
+
+// DiffSnapshots compares two snapshots, which may belong to different devices.
+func (s *ConfigSnapshotService) DiffSnapshots(fromID, toID uint) (*SnapshotDiff, error) {
+	from, err := s.GetSnapshot(fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.GetSnapshot(toID)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &SnapshotDiff{
+		FromID:          from.ID,
+		ToID:            to.ID,
+		FromFirmware:    from.FirmwareVersion,
+		ToFirmware:      to.FirmwareVersion,
+		FirmwareChanged: from.FirmwareVersion != to.FirmwareVersion,
+		Changes:         []SnapshotChange{},
+	}
+	names := make(map[string]bool)
+	for name := range from.Configs {
+		names[name] = true
+	}
+	for name := range to.Configs {
+		names[name] = true
+	}
+	for _, name := range sortedNames(names) {
+		a, inFrom := from.Configs[name]
+		b, inTo := to.Configs[name]
+		change := SnapshotChange{Name: name, Command: a.Command, From: snapshotValue(a), To: snapshotValue(b)}
+		switch {
+		case !inFrom:
+			change.Command, change.Status = b.Command, "added"
+		case !inTo:
+			change.Status = "removed"
+		case change.From != change.To:
+			change.Status = "changed"
+		default:
+			continue
+		}
+		diff.Changes = append(diff.Changes, change)
+	}
+	return diff, nil
+}
+
+// PlanRestore builds the ordered set commands that bring the device back to
+// the snapshot. Nothing is sent.
+func (s *ConfigSnapshotService) PlanRestore(id uint) (*RestorePlan, error) {
+	snapshot, err := s.GetSnapshot(id)
+	if err != nil {
+		return nil, err
+	}
+	device, err := s.deviceComm.getDeviceByID(snapshot.DeviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+	if snapshot.BoardType != device.BoardType {
+		return nil, fmt.Errorf("snapshot was taken on board %s, device is now %s", snapshot.BoardType, device.BoardType)
+	}
+	commands, err := s.deviceComm.boardConfigMgr.GetAvailableCommands(device.BoardType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load board config: %v", err)
+	}
+
+	plan := &RestorePlan{SnapshotID: snapshot.ID, DeviceID: device.ID, Steps: []ChangeStep{}, Skipped: []RestoreSkip{}}
+	names := make([]string, 0, len(snapshot.Configs))
+	for name := range snapshot.Configs {
+		names = append(names, name)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		oi := restorePriority(snapshot.Configs[names[i]].Command)
+		oj := restorePriority(snapshot.Configs[names[j]].Command)
+		if oi != oj {
+			return oi < oj
+		}
+		return names[i] < names[j]
+	})
+
+	replayed := make(map[string]bool)
+	for _, name := range names {
+		entry := snapshot.Configs[name]
+		atName := atCommandName(entry.Command)
+		skip := func(reason string) {
+			plan.Skipped = append(plan.Skipped, RestoreSkip{Name: name, Reason: reason})
+		}
+		setter, ok := commands["set_"+strings.TrimPrefix(name, "get_")]
+		switch {
+		case entry.Error != "":
+			skip("query failed when the snapshot was taken")
+		case restoreExcluded[atName] != "":
+			skip(restoreExcluded[atName])
+		case !ok || atCommandName(setter.ATCommand) != atName:
+			skip("read-only, the board has no matching set command")
+		case !matchesParameters(entry.Value, setter.Parameters):
+			if atName == "AT^DRPC" && replayed["AT^DRPS"] {
+				// 生效参数无法回放时，存储参数(DRPS)在重启后生效
+				skip("active value cannot be replayed; the restored DRPS values take effect after reboot")
+			} else {
+				skip("reported value cannot be replayed as a set command")
+			}
+		default:
+			plan.Steps = append(plan.Steps, ChangeStep{Name: name, Command: atName + "=" + entry.Value})
+			replayed[atName] = true
+		}
+	}
+	return plan, nil
+}
+
+// Restore replays the snapshot. A pre-restore snapshot is taken first, only
+// values that differ are sent, and a failed step rolls the others back.
+func (s *ConfigSnapshotService) Restore(id uint, actor AuditActor) (*RestoreResult, error) {
+	plan, err := s.PlanRestore(id)
+	if err != nil {
+		return nil, err
+	}
+	pre, err := s.TakeSnapshot(plan.DeviceID, fmt.Sprintf("before restoring snapshot %d", id), model.SnapshotSourcePreRestore, actor.Username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to take pre-restore snapshot: %v", err)
+	}
+
+	result := &RestoreResult{RestorePlan: plan, PreRestoreSnapshotID: pre.ID, Unchanged: []string{}}
+	var steps []ChangeStep
+	var changes []model.PreviewChange
+	for _, step := range plan.Steps {
+		current, ok := pre.Configs[step.Name]
+		if ok && current.Error == "" && fieldsMatch(setCommandArgs(step.Command), valueFields(current.Value)) &&
+			len(setCommandArgs(step.Command)) == len(valueFields(current.Value)) {
+			result.Unchanged = append(result.Unchanged, step.Name)
+			continue
+		}
+		steps = append(steps, step)
+		changes = append(changes, model.PreviewChange{
+			Key:  step.Name,
+			From: current.Value,
+			To:   strings.Join(setCommandArgs(step.Command), ","),
+		})
+	}
+	if len(steps) == 0 {
+		result.Success = true
+		return result, nil
+	}
+
+	entry := &model.ConfigAudit{
+		DeviceID: plan.DeviceID,
+		Category: "all",
+		Action:   model.AuditActionRestore,
+		Changes:  changes,
+		Details:  fmt.Sprintf("snapshot %d, pre-restore snapshot %d", id, pre.ID),
+	}
+	changeSet, err := s.changeSet.Apply(plan.DeviceID, steps)
+	if err != nil {
+		entry.Error = err.Error()
+		s.audit.Record(actor, entry)
+		return nil, err
+	}
+	entry.Commands = ChangeSetCommands(changeSet)
+	entry.Error = changeSet.Error
+	s.audit.Record(actor, entry)
+
+	result.ChangeSet = changeSet
+	result.Success = changeSet.Success
+	result.Error = changeSet.Error
+	return result, nil
+}
+
+// snapshotQueries returns the board's query commands (get_* ending in "?"), sorted.
+func snapshotQueries(commands map[string]CommandDef) []string {
+	var names []string
+	for name, cmd := range commands {
+		if strings.HasPrefix(name, "get_") && strings.HasSuffix(cmd.ATCommand, "?") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// matchesParameters reports whether value can be replayed as the set
+// command's arguments: the leading parameters, or whole parameter groups for
+// repeated commands such as AT^DSONSBR. Grouped "(..),(..)" reports and
+// multi-field reports of single-parameter commands are rejected.
+func matchesParameters(value string, params []BoardParameter) bool {
+	if value == "" || strings.HasPrefix(value, "(") || len(params) == 0 {
+		return false
+	}
+	n := len(splitFields(value))
+	if n <= len(params) {
+		return true
+	}
+	return len(params) > 1 && n%len(params) == 0
+}
+
+func restorePriority(query string) int {
+	if order, ok := restoreOrder[atCommandName(query)]; ok {
+		return order
+	}
+	return restoreOrderDefault
+}
+
+func snapshotValue(entry model.SnapshotEntry) string {
+	if entry.Error != "" {
+		return "error: " + entry.Error
+	}
+	return entry.Value
+}
+
+func sortedNames(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
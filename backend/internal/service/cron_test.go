@@ -0,0 +1,84 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronRejectsInvalidFields(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"too few fields", "0 3 * *"},
+		{"too many fields", "0 3 * * * *"},
+		{"minute above range", "60 * * * *"},
+		{"hour above range", "0 24 * * *"},
+		{"day of month zero", "0 0 0 * *"},
+		{"month above range", "0 0 1 13 *"},
+		{"day of week above range", "0 0 * * 8"},
+		{"reversed range", "0 5-3 * * *"},
+		{"range past max", "0 20-24 * * *"},
+		{"zero step", "*/0 * * * *"},
+		{"negative step", "*/-5 * * * *"},
+		{"bad step", "*/x * * * *"},
+		{"unknown name", "0 0 * FOO *"},
+		{"empty list entry", "0,,5 * * * *"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCron(tt.expr); err == nil {
+				t.Errorf("ParseCron(%q) succeeded, want an error", tt.expr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2026-01-01 is a Thursday.
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute is strictly after", "* * * * *", at(1, 1, 10, 0), at(1, 1, 10, 1)},
+		{"seconds are truncated", "* * * * *", at(1, 1, 10, 0).Add(30 * time.Second), at(1, 1, 10, 1)},
+		{"daily later today", "30 3 * * *", at(1, 1, 2, 0), at(1, 1, 3, 30)},
+		{"daily rolls to tomorrow", "30 3 * * *", at(1, 1, 3, 30), at(1, 2, 3, 30)},
+		{"alias", "@daily", at(1, 1, 10, 0), at(1, 2, 0, 0)},
+		{"step from star", "*/15 * * * *", at(1, 1, 10, 16), at(1, 1, 10, 30)},
+		{"step from value", "5/20 * * * *", at(1, 1, 10, 26), at(1, 1, 10, 45)},
+		{"stepped range stops at upper bound", "0 8-12/3 * * *", at(1, 1, 11, 0), at(1, 2, 8, 0)},
+		{"range upper bound included", "0 8-12 * * *", at(1, 1, 11, 30), at(1, 1, 12, 0)},
+		{"list", "0 1,13 * * *", at(1, 1, 2, 0), at(1, 1, 13, 0)},
+		{"month name", "0 0 1 MAR *", at(1, 1, 0, 0), at(3, 1, 0, 0)},
+		{"sunday as 0", "0 0 * * 0", at(1, 1, 0, 0), at(1, 4, 0, 0)},
+		{"sunday as 7", "0 0 * * 7", at(1, 1, 0, 0), at(1, 4, 0, 0)},
+		{"sunday by name", "0 0 * * SUN", at(1, 1, 0, 0), at(1, 4, 0, 0)},
+		{"weekday range wraps to monday", "0 9 * * MON-FRI", at(1, 2, 10, 0), at(1, 5, 9, 0)},
+		{"day of month only", "0 0 15 * *", at(1, 1, 0, 0), at(1, 15, 0, 0)},
+		{"day of week only", "0 0 * * 1", at(1, 1, 0, 0), at(1, 5, 0, 0)},
+		// Both day fields restricted: either one matching is enough.
+		{"dom or dow, dow first", "0 0 15 * 1", at(1, 1, 0, 0), at(1, 5, 0, 0)},
+		{"dom or dow, dom first", "0 0 3 * 1", at(1, 1, 0, 0), at(1, 3, 0, 0)},
+		{"question mark is any", "0 0 ? * 1", at(1, 1, 0, 0), at(1, 5, 0, 0)},
+		{"skips short months", "0 0 31 * *", at(2, 1, 0, 0), at(3, 31, 0, 0)},
+		{"leap day", "0 0 29 2 *", at(1, 1, 0, 0), time.Date(2028, 2, 29, 0, 0, 0, 0, time.Local)},
+		{"never", "0 0 31 2 *", at(1, 1, 0, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+			}
+			if got := schedule.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from.Format(time.RFC3339), got.Format(time.RFC3339), tt.want.Format(time.RFC3339))
+			}
+		})
+	}
+}
@@ -33,11 +33,16 @@ func NewDeviceCommService(db *gorm.DB) *DeviceCommService {
 
 	return &DeviceCommService{
 		db:             db,
-		boardConfigMgr: NewBoardConfigManager(configDir),
+		boardConfigMgr: SharedBoardConfigManager(configDir),
 		cookieManager:  NewCookieManager(),
 	}
 }
 
+// BoardConfigs 返回单板定义管理器，用于查看加载报告和重新加载
+func (s *DeviceCommService) BoardConfigs() *BoardConfigManager {
+	return s.boardConfigMgr
+}
+
 // ATCommandRequest AT指令请求结构
 type ATCommandRequest struct {
 	Command string                 `json:"command"`
@@ -140,21 +145,25 @@ func (s *DeviceCommService) SendATCommandByName(deviceID uint, commandName strin
 		return "", fmt.Errorf("failed to get device: %v", err)
 	}
 
-	// 检查设备可达性，但不作为主要错误判断
-	deviceReachable := isDeviceReachable(device.IP, "80", 3*time.Second)
-	if !deviceReachable {
-		return "", fmt.Errorf("Device is unreachable, cannot send AT command")
+	// 格式化AT命令，参数不合法时不必再连接设备
+	var vctx *ValidationContext
+	if len(params) > 0 {
+		vctx = s.ValidationContext(deviceID)
 	}
-
-	// 格式化AT命令
 	fmt.Printf("FormatATCommand: boardType=%s, commandName=%s, params=%+v\n", device.BoardType, commandName, params)
-	formattedCommand, err := s.boardConfigMgr.FormatATCommand(device.BoardType, commandName, params)
+	formattedCommand, err := s.boardConfigMgr.FormatATCommandWithContext(device.BoardType, commandName, params, vctx)
 	if err != nil {
 		fmt.Printf("FormatATCommand error: %v\n", err)
-		return "", fmt.Errorf("failed to format AT command: %v", err)
+		return "", fmt.Errorf("failed to format AT command: %w", err)
 	}
 	fmt.Printf("Formatted command: %s\n", formattedCommand)
 
+	// 检查设备可达性，但不作为主要错误判断
+	deviceReachable := isDeviceReachable(device.IP, "80", 3*time.Second)
+	if !deviceReachable {
+		return "", fmt.Errorf("Device is unreachable, cannot send AT command")
+	}
+
 	// 构建AT指令请求
 	atRequest := ATCommandRequest{
 		Command: formattedCommand,
@@ -195,6 +204,15 @@ func (s *DeviceCommService) SendATCommandByName(deviceID uint, commandName strin
 	return response, nil
 }
 
+// FormatCommandByName 返回SendATCommandByName将要下发的AT命令文本
+func (s *DeviceCommService) FormatCommandByName(deviceID uint, commandName string, params map[string]interface{}) (string, error) {
+	device, err := s.getDeviceByID(deviceID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get device: %v", err)
+	}
+	return s.boardConfigMgr.FormatATCommand(device.BoardType, commandName, params)
+}
+
 // verifySetting 验证设置是否生效
 func (s *DeviceCommService) verifySetting(deviceID uint, device *model.Device, queryCommandName string) (string, error) {
 	// 格式化查询命令
@@ -223,6 +241,12 @@ func (s *DeviceCommService) verifySetting(deviceID uint, device *model.Device, q
 
 // sendHTTPRequestToDevice 发送HTTP请求到设备，自动降级兼容脏HTTP响应
 func (s *DeviceCommService) sendHTTPRequestToDevice(device *model.Device, request ATCommandRequest) (string, error) {
+	// 登记为进行中的设备命令，关闭服务时等待其完成
+	if err := inflightCommands.begin(); err != nil {
+		return "", err
+	}
+	defer inflightCommands.done()
+
 	// 1.0 star设备必须严格用老协议（兼容所有包含1.0和star的写法）
 	if (strings.Contains(device.BoardType, "1.0") && strings.Contains(strings.ToLower(device.BoardType), "star")) || device.BoardType == "1.0" {
 		deviceURL := fmt.Sprintf("http://%s/boafrm/formAtcmdProcess", device.IP)
@@ -582,6 +606,7 @@ func (s *DeviceCommService) GetDeviceConfig(deviceID uint) (map[string]interface
 			"description":     cmd.Description,
 			"response_format": cmd.ResponseFormat,
 			"parameters":      cmd.Parameters,
+			"destructive":     cmd.Destructive,
 		}
 	}
 
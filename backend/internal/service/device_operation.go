@@ -0,0 +1,325 @@
+package service
+
+import (
+	"backend/internal/model"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// ConfirmationHeader carries the token that confirms a destructive command.
+	ConfirmationHeader = "X-Confirmation-Token"
+
+	confirmationTokenTTL    = 2 * time.Minute
+	deviceOperationDownWait = 30 * time.Second // how long to wait for the device to go down
+	deviceOperationDownPoll = 2 * time.Second
+)
+
+var (
+	// ErrDestructiveForbidden is returned when a non-admin sends a destructive command.
+	ErrDestructiveForbidden = errors.New("destructive commands require the admin role")
+	// ErrConfirmationRequired is returned when a destructive command has no valid confirmation token.
+	ErrConfirmationRequired = errors.New("destructive command requires confirmation")
+	// ErrDeviceOperationFailed is returned when the pre-reset snapshot or the command itself failed.
+	ErrDeviceOperationFailed = errors.New("device operation failed")
+)
+
+// DestructiveCommand is a destructive command waiting for confirmation.
+type DestructiveCommand struct {
+	DeviceID          uint      `json:"device_id"`
+	CommandName       string    `json:"command_name,omitempty"`
+	Command           string    `json:"command"`
+	Kind              string    `json:"kind"` // reboot, factory_reset or shutdown
+	ConfirmationToken string    `json:"confirmation_token,omitempty"`
+	ExpiresAt         time.Time `json:"expires_at,omitempty"`
+}
+
+type pendingConfirmation struct {
+	userID   uint
+	deviceID uint
+	command  string
+	expires  time.Time
+}
+
+// DeviceOperationService 危险命令（重启、恢复出厂设置、关机）的安全流程：只有管理员可以下发，
+// 第一次请求只返回一次性确认令牌，带令牌再次请求才会执行。恢复出厂设置前自动拍摄配置快照，
+// 重启或恢复出厂设置后跟踪设备直到重新可达，恢复出厂设置的设备随后回放该快照
+type DeviceOperationService struct {
+	db         *gorm.DB
+	deviceComm *DeviceCommService
+	snapshots  *ConfigSnapshotService
+	audit      *AuditService
+	supervisor *Supervisor
+
+	mu      sync.Mutex
+	pending map[string]pendingConfirmation
+}
+
+// NewDeviceOperationService 创建危险命令服务
+func NewDeviceOperationService(db *gorm.DB, deviceComm *DeviceCommService, snapshots *ConfigSnapshotService, audit *AuditService, supervisor *Supervisor) *DeviceOperationService {
+	return &DeviceOperationService{
+		db:         db,
+		deviceComm: deviceComm,
+		snapshots:  snapshots,
+		audit:      audit,
+		supervisor: supervisor,
+		pending:    make(map[string]pendingConfirmation),
+	}
+}
+
+// Start 将上次运行中被中断跟踪的操作标记为interrupted
+func (s *DeviceOperationService) Start() {
+	res := s.db.Model(&model.DeviceOperation{}).
+		Where("status IN ?", []string{model.DeviceOperationSent, model.DeviceOperationWaiting, model.DeviceOperationRestoring}).
+		Updates(map[string]interface{}{
+			"status": model.DeviceOperationInterrupted,
+			"error":  "the backend stopped while tracking the device; check the device and restore the snapshot if needed",
+		})
+	if res.Error != nil {
+		log.Printf("Failed to mark interrupted device operations: %v", res.Error)
+	} else if res.RowsAffected > 0 {
+		log.Printf("Marked %d device operation(s) as interrupted", res.RowsAffected)
+	}
+}
+
+// Classify 判断命令是否为单板定义中的危险命令，不是时返回nil
+func (s *DeviceOperationService) Classify(deviceID uint, commandName, command string) (*DestructiveCommand, error) {
+	device, err := s.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	name, kind := s.deviceComm.boardConfigMgr.DestructiveCommand(device.BoardType, command)
+	if kind == "" {
+		return nil, nil
+	}
+	if commandName == "" {
+		commandName = name
+	}
+	return &DestructiveCommand{DeviceID: deviceID, CommandName: commandName, Command: strings.TrimSpace(command), Kind: kind}, nil
+}
+
+// Authorize 校验危险命令的角色和确认令牌。非管理员返回ErrDestructiveForbidden；令牌缺失、
+// 过期或不匹配时签发新的确认令牌（写入cmd）并返回ErrConfirmationRequired
+func (s *DeviceOperationService) Authorize(actor AuditActor, role string, cmd *DestructiveCommand, token string) error {
+	if role != model.RoleAdmin {
+		return ErrDestructiveForbidden
+	}
+	if !s.consume(token, actor.UserID, cmd) {
+		s.issue(actor.UserID, cmd)
+		if token != "" {
+			return fmt.Errorf("%w: the confirmation token is invalid or expired", ErrConfirmationRequired)
+		}
+		return ErrConfirmationRequired
+	}
+	return nil
+}
+
+// Run 校验并执行危险命令，timeout为等待设备重新可达的秒数
+func (s *DeviceOperationService) Run(actor AuditActor, role string, cmd *DestructiveCommand, token string, timeout int) (*model.DeviceOperation, error) {
+	if err := s.Authorize(actor, role, cmd, token); err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = defaultRolloutRejoinTimeout
+	}
+
+	op := &model.DeviceOperation{
+		DeviceID:    cmd.DeviceID,
+		Kind:        cmd.Kind,
+		CommandName: cmd.CommandName,
+		Command:     cmd.Command,
+		Status:      model.DeviceOperationSent,
+		Timeout:     timeout,
+		RequestedBy: actor.Username,
+	}
+	if cmd.Kind == DestructiveFactoryReset {
+		snapshot, err := s.snapshots.TakeSnapshot(cmd.DeviceID, "before factory reset", model.SnapshotSourcePreReset, actor.Username)
+		if err != nil {
+			return s.fail(op, fmt.Sprintf("pre-reset snapshot failed, the reset was not sent: %v", err))
+		}
+		op.SnapshotID = snapshot.ID
+	}
+
+	response, err := s.deviceComm.SendATCommand(cmd.DeviceID, cmd.Command)
+	s.audit.RecordCommand(actor, cmd.DeviceID, cmd.CommandName, cmd.Command, response, err)
+	sent := model.AuditCommand{Name: cmd.CommandName, Command: cmd.Command, Status: StepApplied, Response: response}
+	if err != nil {
+		sent.Status, sent.Error = StepFailed, err.Error()
+		op.Commands = append(op.Commands, sent)
+		return s.fail(op, err.Error())
+	}
+	op.Commands = append(op.Commands, sent)
+	s.db.Create(&model.DeviceLog{
+		DeviceID:  cmd.DeviceID,
+		Type:      cmd.Kind,
+		Message:   fmt.Sprintf("%s confirmed by %s: %s", cmd.Kind, actor.Username, cmd.Command),
+		CreatedAt: time.Now(),
+	})
+
+	if cmd.Kind == DestructiveShutdown {
+		// 射频关闭后不会自行恢复，无需跟踪
+		now := time.Now()
+		op.Status, op.FinishedAt = model.DeviceOperationCompleted, &now
+		if err := s.db.Create(op).Error; err != nil {
+			return nil, err
+		}
+		return op, nil
+	}
+	if err := s.db.Create(op).Error; err != nil {
+		return nil, err
+	}
+	worker := *op
+	s.supervisor.Go(fmt.Sprintf("device_operation_%d", op.ID), func(ctx context.Context) error {
+		s.track(ctx, &worker, actor)
+		return nil
+	})
+	return op, nil
+}
+
+// List 返回设备的危险命令操作记录，最新的在前
+func (s *DeviceOperationService) List(deviceID uint) ([]model.DeviceOperation, error) {
+	var ops []model.DeviceOperation
+	err := s.db.Where("device_id = ?", deviceID).Order("id desc").Find(&ops).Error
+	return ops, err
+}
+
+// Get 返回一条操作记录
+func (s *DeviceOperationService) Get(id uint) (*model.DeviceOperation, error) {
+	var op model.DeviceOperation
+	if err := s.db.First(&op, id).Error; err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+func (s *DeviceOperationService) fail(op *model.DeviceOperation, message string) (*model.DeviceOperation, error) {
+	now := time.Now()
+	op.Status, op.Error, op.FinishedAt = model.DeviceOperationFailed, message, &now
+	if err := s.db.Create(op).Error; err != nil {
+		log.Printf("Failed to save device operation for device %d: %v", op.DeviceID, err)
+	}
+	return op, fmt.Errorf("%w: %s", ErrDeviceOperationFailed, message)
+}
+
+// track 等待设备下线后重新可达；恢复出厂设置的设备随后回放重置前的快照
+func (s *DeviceOperationService) track(ctx context.Context, op *model.DeviceOperation, actor AuditActor) {
+	// 设备重启很快时可能错过下线，超时后直接等待上线
+	down := time.Now().Add(deviceOperationDownWait)
+	for time.Now().Before(down) {
+		if status, _ := s.deviceComm.GetDeviceStatus(op.DeviceID); status != "Online" {
+			break
+		}
+		if sleepContext(ctx, deviceOperationDownPoll) != nil {
+			s.finish(op, model.DeviceOperationInterrupted, "the backend stopped while tracking the device")
+			return
+		}
+	}
+	s.update(op, map[string]interface{}{"status": model.DeviceOperationWaiting})
+
+	deadline := time.Now().Add(time.Duration(op.Timeout) * time.Second)
+	for {
+		if status, _ := s.deviceComm.GetDeviceStatus(op.DeviceID); status == "Online" {
+			break
+		}
+		if time.Now().After(deadline) {
+			s.finish(op, model.DeviceOperationUnreachable, fmt.Sprintf("device did not come back within %ds", op.Timeout))
+			return
+		}
+		if sleepContext(ctx, rolloutPollInterval) != nil {
+			s.finish(op, model.DeviceOperationInterrupted, "the backend stopped while tracking the device")
+			return
+		}
+	}
+	now := time.Now()
+	s.update(op, map[string]interface{}{"reachable_at": &now})
+
+	if op.Kind != DestructiveFactoryReset || op.SnapshotID == 0 {
+		s.finish(op, model.DeviceOperationCompleted, "")
+		return
+	}
+	s.update(op, map[string]interface{}{"status": model.DeviceOperationRestoring})
+	if sleepContext(ctx, defaultRolloutSettleTime*time.Second) != nil {
+		s.finish(op, model.DeviceOperationInterrupted, "the backend stopped before the snapshot was restored")
+		return
+	}
+	result, err := s.snapshots.Restore(op.SnapshotID, actor)
+	if err != nil {
+		s.finish(op, model.DeviceOperationRestoreFailed, fmt.Sprintf("restoring snapshot %d failed: %v", op.SnapshotID, err))
+		return
+	}
+	applied := 0
+	if result.ChangeSet != nil {
+		applied = len(result.ChangeSet.Steps)
+	}
+	s.update(op, map[string]interface{}{
+		"restore_result": fmt.Sprintf("snapshot %d: %d setting(s) re-applied, %d unchanged", op.SnapshotID, applied, len(result.Unchanged)),
+	})
+	if !result.Success {
+		s.finish(op, model.DeviceOperationRestoreFailed, result.Error)
+		return
+	}
+	s.finish(op, model.DeviceOperationCompleted, "")
+}
+
+func (s *DeviceOperationService) update(op *model.DeviceOperation, values map[string]interface{}) {
+	if err := s.db.Model(&model.DeviceOperation{}).Where("id = ?", op.ID).Updates(values).Error; err != nil {
+		log.Printf("Failed to update device operation %d: %v", op.ID, err)
+	}
+}
+
+func (s *DeviceOperationService) finish(op *model.DeviceOperation, status, message string) {
+	now := time.Now()
+	s.update(op, map[string]interface{}{"status": status, "error": message, "finished_at": &now})
+	if message != "" {
+		log.Printf("Device operation %d (%s on device %d): %s: %s", op.ID, op.Kind, op.DeviceID, status, message)
+	}
+}
+
+// issue 签发绑定用户、设备和命令的一次性确认令牌
+func (s *DeviceOperationService) issue(userID uint, cmd *DestructiveCommand) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("Failed to generate confirmation token: %v", err)
+		return
+	}
+	token := hex.EncodeToString(buf)
+	expires := time.Now().Add(confirmationTokenTTL)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for t, p := range s.pending {
+		if time.Now().After(p.expires) {
+			delete(s.pending, t)
+		}
+	}
+	s.pending[token] = pendingConfirmation{userID: userID, deviceID: cmd.DeviceID, command: confirmationKey(cmd.Command), expires: expires}
+	cmd.ConfirmationToken, cmd.ExpiresAt = token, expires
+}
+
+// consume 校验并作废确认令牌
+func (s *DeviceOperationService) consume(token string, userID uint, cmd *DestructiveCommand) bool {
+	if token == "" {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pending[token]
+	if !ok {
+		return false
+	}
+	delete(s.pending, token)
+	return p.userID == userID && p.deviceID == cmd.DeviceID && p.command == confirmationKey(cmd.Command) && time.Now().Before(p.expires)
+}
+
+func confirmationKey(command string) string {
+	return strings.ToUpper(strings.TrimSpace(command))
+}
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -13,17 +15,21 @@ type DeviceStatusMonitor struct {
 	db              *gorm.DB
 	deviceCommSvc   *DeviceCommService
 	monitorInterval time.Duration
+	supervisor      *Supervisor
+	intervalChan    chan time.Duration
 	stopChan        chan bool
 	isRunning       bool
 	mu              sync.Mutex
 }
 
 // NewDeviceStatusMonitor 创建设备状态监控服务
-func NewDeviceStatusMonitor(db *gorm.DB, interval time.Duration) *DeviceStatusMonitor {
+func NewDeviceStatusMonitor(db *gorm.DB, interval time.Duration, supervisor *Supervisor) *DeviceStatusMonitor {
 	return &DeviceStatusMonitor{
 		db:              db,
 		deviceCommSvc:   NewDeviceCommService(db),
 		monitorInterval: interval,
+		supervisor:      supervisor,
+		intervalChan:    make(chan time.Duration, 1),
 		stopChan:        make(chan bool),
 		isRunning:       false,
 	}
@@ -42,9 +48,11 @@ func (m *DeviceStatusMonitor) Start() {
 	m.isRunning = true
 	log.Printf("Starting device status monitor with interval: %v", m.monitorInterval)
 
-	go m.monitorLoop()
+	m.supervisor.Go(deviceStatusWorker, m.monitorLoop)
 }
 
+const deviceStatusWorker = "device_status_monitor"
+
 // Stop 停止设备状态监控
 func (m *DeviceStatusMonitor) Stop() {
 	m.mu.Lock()
@@ -59,6 +67,26 @@ func (m *DeviceStatusMonitor) Stop() {
 	log.Println("Device status monitor stopped")
 }
 
+// SetInterval 修改检测间隔，运行中的监控在下一个周期生效
+func (m *DeviceStatusMonitor) SetInterval(interval time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if interval <= 0 || interval == m.monitorInterval {
+		return
+	}
+	m.monitorInterval = interval
+	if m.isRunning {
+		// Drop a pending, not yet applied value so the latest one wins.
+		select {
+		case <-m.intervalChan:
+		default:
+		}
+		m.intervalChan <- interval
+	}
+	log.Printf("Device status monitor interval set to %v", interval)
+}
+
 // IsRunning 检查监控是否正在运行
 func (m *DeviceStatusMonitor) IsRunning() bool {
 	m.mu.Lock()
@@ -67,25 +95,36 @@ func (m *DeviceStatusMonitor) IsRunning() bool {
 }
 
 // monitorLoop 监控循环
-func (m *DeviceStatusMonitor) monitorLoop() {
+func (m *DeviceStatusMonitor) monitorLoop(ctx context.Context) error {
+	m.mu.Lock()
 	ticker := time.NewTicker(m.monitorInterval)
+	m.mu.Unlock()
 	defer ticker.Stop()
+	defer func() {
+		m.mu.Lock()
+		m.isRunning = false
+		m.mu.Unlock()
+	}()
 
 	// 立即执行一次状态检测
-	m.checkAllDevicesStatus()
+	m.supervisor.Track(deviceStatusWorker, m.checkAllDevicesStatus)
 
 	for {
 		select {
 		case <-ticker.C:
-			m.checkAllDevicesStatus()
+			m.supervisor.Track(deviceStatusWorker, m.checkAllDevicesStatus)
+		case interval := <-m.intervalChan:
+			ticker.Reset(interval)
 		case <-m.stopChan:
-			return
+			return nil
+		case <-ctx.Done():
+			return nil
 		}
 	}
 }
 
 // checkAllDevicesStatus 检测所有设备状态
-func (m *DeviceStatusMonitor) checkAllDevicesStatus() {
+func (m *DeviceStatusMonitor) checkAllDevicesStatus() error {
 	log.Println("Starting periodic device status check...")
 
 	// 获取所有设备
@@ -97,18 +136,20 @@ func (m *DeviceStatusMonitor) checkAllDevicesStatus() {
 
 	if err := m.db.Model(&struct{}{}).Table("devices").Select("id, name, ip").Find(&devices).Error; err != nil {
 		log.Printf("Failed to fetch devices: %v", err)
-		return
+		return err
 	}
 
 	if len(devices) == 0 {
 		log.Println("No devices found for status check")
-		return
+		return nil
 	}
 
 	log.Printf("Checking status for %d devices", len(devices))
 
 	// 并发检测设备状态
 	var wg sync.WaitGroup
+	var failMu sync.Mutex
+	failed := 0
 	semaphore := make(chan struct{}, 10) // 限制并发数
 
 	for _, device := range devices {
@@ -125,6 +166,9 @@ func (m *DeviceStatusMonitor) checkAllDevicesStatus() {
 			status, err := m.deviceCommSvc.GetDeviceStatus(d.ID)
 			if err != nil {
 				log.Printf("Failed to check status for device %s (ID: %d): %v", d.Name, d.ID, err)
+				failMu.Lock()
+				failed++
+				failMu.Unlock()
 				return
 			}
 
@@ -134,4 +178,8 @@ func (m *DeviceStatusMonitor) checkAllDevicesStatus() {
 
 	wg.Wait()
 	log.Println("Periodic device status check completed")
+	if failed > 0 {
+		return fmt.Errorf("status check failed for %d of %d devices", failed, len(devices))
+	}
+	return nil
 }
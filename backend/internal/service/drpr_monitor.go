@@ -2,6 +2,7 @@ package service
 
 import (
 	"backend/internal/model"
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -21,10 +22,22 @@ type DRPRMonitorService struct {
 	deviceService     *DeviceService
 	deviceCommService *DeviceCommService
 	clients           map[uint][]chan DRPRMessage
-	activeDevices     map[uint]*time.Ticker // 设备ID -> 定时器映射
+	activeDevices     map[uint]*drprPoller // 设备ID -> 轮询任务
+	pollInterval      time.Duration
+	supervisor        *Supervisor
 	mu                sync.RWMutex
 }
 
+// drprPoller is one per-device polling loop; closing stop ends its goroutine.
+type drprPoller struct {
+	ticker *time.Ticker
+	stop   chan struct{}
+}
+
+func drprWorkerName(deviceID uint) string {
+	return fmt.Sprintf("drpr_monitor:%d", deviceID)
+}
+
 // DRPRMessage DRPR消息结构
 type DRPRMessage struct {
 	DeviceID        uint      `json:"device_id"`
@@ -55,17 +68,32 @@ type DRPRMessage struct {
 }
 
 // NewDRPRMonitorService 创建DRPR监控服务
-func NewDRPRMonitorService(db *gorm.DB, deviceService *DeviceService, deviceCommService *DeviceCommService) *DRPRMonitorService {
+func NewDRPRMonitorService(db *gorm.DB, deviceService *DeviceService, deviceCommService *DeviceCommService, supervisor *Supervisor) *DRPRMonitorService {
 	return &DRPRMonitorService{
 		db:                db,
 		deviceService:     deviceService,
 		deviceCommService: deviceCommService,
 		clients:           make(map[uint][]chan DRPRMessage),
-		activeDevices:     make(map[uint]*time.Ticker),
+		activeDevices:     make(map[uint]*drprPoller),
+		pollInterval:      5 * time.Second,
+		supervisor:        supervisor,
 	}
 }
 
-// StartDRPRMonitoring 开始DRPR监控（每5秒发送一次请求）
+// SetPollInterval 设置DRPR轮询间隔，对之后启动的监控以及正在运行的定时器生效
+func (s *DRPRMonitorService) SetPollInterval(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pollInterval = interval
+	for _, poller := range s.activeDevices {
+		poller.ticker.Reset(interval)
+	}
+}
+
+// StartDRPRMonitoring 开始DRPR监控（按 pollInterval 发送请求，默认5秒）
 func (s *DRPRMonitorService) StartDRPRMonitoring(deviceID uint) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -81,23 +109,34 @@ func (s *DRPRMonitorService) StartDRPRMonitoring(deviceID uint) error {
 		return fmt.Errorf("failed to get device: %v", err)
 	}
 
-	// 创建定时器，每5秒执行一次
-	ticker := time.NewTicker(5 * time.Second)
-	s.activeDevices[deviceID] = ticker
+	// 创建定时器，按配置的间隔执行
+	poller := &drprPoller{
+		ticker: time.NewTicker(s.pollInterval),
+		stop:   make(chan struct{}),
+	}
+	s.activeDevices[deviceID] = poller
 
 	log.Printf("Starting DRPR monitoring for device %d (%s)", deviceID, device.IP)
 
-	// 启动goroutine处理定时任务
-	go func() {
-		defer ticker.Stop()
+	// 由supervisor管理的goroutine：Stop或服务关闭时退出
+	name := drprWorkerName(deviceID)
+	s.supervisor.Go(name, func(ctx context.Context) error {
+		defer poller.ticker.Stop()
 
 		// 立即执行一次
-		s.fetchDRPRData(deviceID, device.IP)
+		s.supervisor.Track(name, func() error { return s.fetchDRPRData(deviceID, device.IP) })
 
-		for range ticker.C {
-			s.fetchDRPRData(deviceID, device.IP)
+		for {
+			select {
+			case <-poller.ticker.C:
+				s.supervisor.Track(name, func() error { return s.fetchDRPRData(deviceID, device.IP) })
+			case <-poller.stop:
+				return nil
+			case <-ctx.Done():
+				return nil
+			}
 		}
-	}()
+	})
 
 	return nil
 }
@@ -107,8 +146,8 @@ func (s *DRPRMonitorService) StopDRPRMonitoring(deviceID uint) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if ticker, exists := s.activeDevices[deviceID]; exists {
-		ticker.Stop()
+	if poller, exists := s.activeDevices[deviceID]; exists {
+		close(poller.stop)
 		delete(s.activeDevices, deviceID)
 		log.Printf("Stopped DRPR monitoring for device %d", deviceID)
 		return nil
@@ -127,16 +166,17 @@ func (s *DRPRMonitorService) IsDRPRMonitoringActive(deviceID uint) bool {
 }
 
 // fetchDRPRData 获取DRPR数据
-func (s *DRPRMonitorService) fetchDRPRData(deviceID uint, deviceIP string) {
+func (s *DRPRMonitorService) fetchDRPRData(deviceID uint, deviceIP string) error {
 	log.Printf("Fetching DRPR data for device %d (%s)", deviceID, deviceIP)
 
 	// 只周期性通过HTTP接口获取DRPR数据
 	err := s.fetchDRPRViaHTTP(deviceID, deviceIP)
 	if err != nil {
 		log.Printf("Failed to fetch DRPR via HTTP: %v", err)
-	} else {
-		log.Printf("Successfully sent DRPR request via HTTP for device %d", deviceID)
+		return err
 	}
+	log.Printf("Successfully sent DRPR request via HTTP for device %d", deviceID)
+	return nil
 }
 
 // fetchDRPRViaAT 通过AT命令获取DRPR数据
@@ -269,6 +309,9 @@ func (s *DRPRMonitorService) parseDRPRMessage(rawMessage string) (DRPRMessage, e
 
 	// 去除前缀和换行符
 	msg := strings.TrimSpace(rawMessage)
+	if strings.HasPrefix(msg, "^DRPRI:") {
+		return parseDRPRIReport(strings.TrimSpace(strings.TrimPrefix(msg, "^DRPRI:")))
+	}
 	if strings.HasPrefix(msg, "^DAPRI:") {
 		msg = strings.TrimPrefix(msg, "^DAPRI:")
 		msg = strings.TrimSpace(msg)
@@ -279,8 +322,8 @@ func (s *DRPRMonitorService) parseDRPRMessage(rawMessage string) (DRPRMessage, e
 
 	// 分割字段
 	fields := strings.Split(msg, ",")
-	if len(fields) < 19 {
-		return message, fmt.Errorf("invalid DRPR message format: expected at least 19 fields, got %d", len(fields))
+	if len(fields) < 20 {
+		return message, fmt.Errorf("invalid DRPR message format: expected at least 20 fields, got %d", len(fields))
 	}
 
 	// 清理字段中的引号和空格
@@ -290,8 +333,8 @@ func (s *DRPRMonitorService) parseDRPRMessage(rawMessage string) (DRPRMessage, e
 
 	var err error
 
-	// 根据实际^DRPR格式映射字段
-	// 格式: <device_id>,<index>,<rssi>,<pathloss>,<rsrp>,<rsrq>,<snr>,<distance>,<tx_power>,<dl_throughput>,<ul_throughput>,<dlsch_error_per>,<mcs>,<rb_num>,<wide_cqi>,<dlsch_error_per_total>,<max_snr>,<min_snr>,<dl_total_tbs_g_rnti>
+	// 监控接口的^DRPR格式，第一个字段为邻居节点ID，不含earfcn/cell_id
+	// 格式: <device_id>,<index>,<rssi>,<pathloss>,<保留>,<rsrp>,<rsrq>,<snr>,<distance>,<tx_power>,<dl_throughput>,<ul_throughput>,<dlsch_error_per>,<mcs>,<rb_num>,<wide_cqi>,<dlsch_error_per_total>,<max_snr>,<min_snr>,<dl_total_tbs_g_rnti>
 
 	// 字段0: DeviceID - 跳过，不解析
 	// 字段1: Index
@@ -309,17 +352,7 @@ func (s *DRPRMonitorService) parseDRPRMessage(rawMessage string) (DRPRMessage, e
 		return message, fmt.Errorf("failed to parse pathloss: %v", err)
 	}
 
-	// 根据AT文档的^DRPRI格式，正确的字段映射：
-	// 字段0: Index
-	// 字段1: Earfcn
-	// 字段2: CellID
-	// 字段3: RSSI
-	// 字段4: Pathloss
-	// 字段5: RSRP
-	// 字段6: RSRQ
-	// 字段7: SNR
-	// 字段8: Distance
-	// 字段9: TxPower
+	// 字段4: 保留，不解析
 
 	// 字段5: RSRP
 	message.Rsrp = fields[5]
@@ -400,6 +433,58 @@ func (s *DRPRMonitorService) parseDRPRMessage(rawMessage string) (DRPRMessage, e
 	return message, nil
 }
 
+// parseDRPRIReport 按AT文档的^DRPRI格式解析无线参数上报：
+// <index>,<cell_index>,<earfcn>,<cell_id>,<rssi>,<pathloss>,<rsrp>,<ul_earfcn>,<snr>,<distance>,<tx_power>,
+// <dl_throughput_total_tbs>,<ul_thrpughput_total_tbs>,<dlsch_tb_error_per>,<mcs>,<rb_num>,<wide_cqi>,
+// <dlsch_tb_error_per_total>,<max_snr>,<min_snr>,<dl_total_tbs_g_rnti>[,<ri_relative_value>]
+func parseDRPRIReport(msg string) (DRPRMessage, error) {
+	message := DRPRMessage{}
+	fields := strings.Split(msg, ",")
+	if len(fields) < 21 {
+		return message, fmt.Errorf("invalid DRPRI message format: expected at least 21 fields, got %d", len(fields))
+	}
+	for i := range fields {
+		fields[i] = strings.Trim(fields[i], "\" ")
+	}
+
+	ints := []struct {
+		name  string
+		index int
+		dst   *int
+	}{
+		{"index", 0, &message.Index},
+		{"cell_index", 1, &message.CellIndex},
+		{"earfcn", 2, &message.Earfcn},
+		{"cell_id", 3, &message.CellID},
+		{"pathloss", 5, &message.Pathloss},
+		{"distance", 9, &message.Distance},
+		{"dl_throughput_total_tbs", 11, &message.DlThroughput},
+		{"ul_throughput_total_tbs", 12, &message.UlThroughput},
+		{"dlsch_tb_error_per", 13, &message.DlschError},
+		{"mcs", 14, &message.Mcs},
+		{"rb_num", 15, &message.RbNum},
+		{"wide_cqi", 16, &message.WideCqi},
+		{"dlsch_tb_error_per_total", 17, &message.DlschErrorPer},
+		{"dl_total_tbs_g_rnti", 20, &message.DlTotalTbsGrnti},
+	}
+	for _, f := range ints {
+		v, err := strconv.Atoi(fields[f.index])
+		if err != nil {
+			return message, fmt.Errorf("failed to parse %s: %v", f.name, err)
+		}
+		*f.dst = v
+	}
+
+	message.Rssi = fields[4]
+	message.Rsrp = fields[6]
+	message.UlEarfcn = fields[7]
+	message.Snr = fields[8]
+	message.TxPower = fields[10]
+	message.MaxSnr = fields[18]
+	message.MinSnr = fields[19]
+	return message, nil
+}
+
 // SaveDRPRMessage 保存DRPR消息到数据库（公开方法，用于测试）
 func (s *DRPRMonitorService) SaveDRPRMessage(message DRPRMessage) error {
 	return s.saveDRPRMessage(message)
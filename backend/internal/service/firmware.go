@@ -0,0 +1,210 @@
+package service
+
+import (
+	"backend/internal/model"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrFirmwareInvalid wraps validation failures of an uploaded image.
+	ErrFirmwareInvalid = errors.New("invalid firmware image")
+	// ErrFirmwareExists is returned when the board type already has an image of the version.
+	ErrFirmwareExists = errors.New("firmware image already exists")
+	// ErrFirmwareInUse is returned when deleting an image a running upgrade pushes.
+	ErrFirmwareInUse = errors.New("firmware image is used by a running upgrade")
+)
+
+// FirmwareUpload describes an uploaded image; Checksum is the SHA-256 the
+// uploader expects, the stored file must match it.
+type FirmwareUpload struct {
+	BoardType string
+	Version   string
+	Checksum  string
+	Notes     string
+	FileName  string
+}
+
+// FirmwareService 固件仓库：按单板类型和版本保存固件镜像，上传时校验SHA-256
+type FirmwareService struct {
+	db           *gorm.DB
+	boardConfigs *BoardConfigManager
+	dir          string
+	maxSize      int64
+}
+
+// NewFirmwareService 创建固件仓库服务，镜像保存在dir目录下
+func NewFirmwareService(db *gorm.DB, boardConfigs *BoardConfigManager, dir string, maxSize int64) *FirmwareService {
+	return &FirmwareService{
+		db:           db,
+		boardConfigs: boardConfigs,
+		dir:          dir,
+		maxSize:      maxSize,
+	}
+}
+
+// MaxSize 返回允许的最大镜像大小（字节）
+func (s *FirmwareService) MaxSize() int64 {
+	return s.maxSize
+}
+
+// Upload 保存固件镜像：先写入临时文件并计算SHA-256，与声明的校验和一致后才登记到仓库
+func (s *FirmwareService) Upload(upload FirmwareUpload, r io.Reader, uploadedBy string) (*model.FirmwareImage, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrFirmwareInvalid, fmt.Sprintf(format, args...))
+	}
+	upload.BoardType = strings.TrimSpace(upload.BoardType)
+	upload.Version = strings.TrimSpace(upload.Version)
+	upload.Checksum = strings.ToLower(strings.TrimSpace(upload.Checksum))
+	if upload.BoardType == "" || upload.Version == "" || upload.Checksum == "" {
+		return nil, invalid("board_type, version and checksum are required")
+	}
+	if _, err := s.boardConfigs.FirmwareUpload(upload.BoardType); err != nil {
+		return nil, invalid("%v", err)
+	}
+	if _, err := hex.DecodeString(upload.Checksum); err != nil || len(upload.Checksum) != sha256.Size*2 {
+		return nil, invalid("checksum must be a hex SHA-256")
+	}
+	var count int64
+	if err := s.db.Model(&model.FirmwareImage{}).Where("board_type IN ? AND version = ?", boardTypeNames(upload.BoardType), upload.Version).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrFirmwareExists, upload.BoardType, upload.Version)
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(s.dir, "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, s.maxSize+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case size == 0:
+		return nil, invalid("the image is empty")
+	case size > s.maxSize:
+		return nil, invalid("the image is larger than %d MB", s.maxSize>>20)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != upload.Checksum {
+		return nil, invalid("checksum mismatch: the uploaded file has SHA-256 %s", sum)
+	}
+
+	image := &model.FirmwareImage{
+		BoardType:  upload.BoardType,
+		Version:    upload.Version,
+		FileName:   filepath.Base(upload.FileName),
+		Size:       size,
+		Checksum:   upload.Checksum,
+		Path:       filepath.Join(s.dir, upload.Checksum+".bin"),
+		Notes:      upload.Notes,
+		UploadedBy: uploadedBy,
+	}
+	if err := os.Rename(tmp.Name(), image.Path); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(image).Error; err != nil {
+		s.removeFile(image)
+		return nil, err
+	}
+	return image, nil
+}
+
+// List 返回仓库中的镜像，新的在前；boardType不为空时只返回该单板类型的镜像
+func (s *FirmwareService) List(boardType string) ([]model.FirmwareImage, error) {
+	var images []model.FirmwareImage
+	query := s.db.Order("id DESC")
+	if boardType != "" {
+		query = query.Where("board_type IN ?", boardTypeNames(boardType))
+	}
+	err := query.Find(&images).Error
+	return images, err
+}
+
+// Get 返回镜像信息
+func (s *FirmwareService) Get(id uint) (*model.FirmwareImage, error) {
+	var image model.FirmwareImage
+	if err := s.db.First(&image, id).Error; err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+// Open 打开镜像文件并确认其内容仍与登记的校验和一致
+func (s *FirmwareService) Open(image *model.FirmwareImage) (*os.File, error) {
+	f, err := os.Open(image.Path)
+	if err != nil {
+		return nil, fmt.Errorf("firmware image %d: %v", image.ID, err)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != image.Checksum {
+		f.Close()
+		return nil, fmt.Errorf("firmware image %d is corrupted: SHA-256 %s, expected %s", image.ID, sum, image.Checksum)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Delete 删除镜像；运行中的升级正在使用的镜像不能删除
+func (s *FirmwareService) Delete(id uint) error {
+	image, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	var running int64
+	if err := s.db.Model(&model.FirmwareUpgrade{}).Where("image_id = ? AND status = ?", id, model.FirmwareUpgradeRunning).Count(&running).Error; err != nil {
+		return err
+	}
+	if running > 0 {
+		return ErrFirmwareInUse
+	}
+	if err := s.db.Delete(image).Error; err != nil {
+		return err
+	}
+	s.removeFile(image)
+	return nil
+}
+
+// removeFile 删除镜像文件；相同内容的文件被其他镜像引用时保留
+func (s *FirmwareService) removeFile(image *model.FirmwareImage) {
+	var count int64
+	s.db.Model(&model.FirmwareImage{}).Where("checksum = ?", image.Checksum).Count(&count)
+	if count == 0 {
+		os.Remove(image.Path)
+	}
+}
+
+// sameBoardType 比较单板类型，忽略"board_"前缀
+func sameBoardType(a, b string) bool {
+	return strings.TrimPrefix(a, "board_") == strings.TrimPrefix(b, "board_")
+}
+
+// boardTypeNames 返回单板类型带和不带"board_"前缀的两种写法
+func boardTypeNames(boardType string) []string {
+	clean := strings.TrimPrefix(boardType, "board_")
+	return []string{clean, "board_" + clean}
+}
@@ -0,0 +1,667 @@
+package service
+
+import (
+	"backend/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultFirmwareUploadTimeout = 600 // seconds
+	// firmwareSaveInterval 上传进度写入数据库的最小间隔
+	firmwareSaveInterval = time.Second
+)
+
+var (
+	// ErrFirmwareUpgradeInvalid wraps validation failures of an upgrade request.
+	ErrFirmwareUpgradeInvalid = errors.New("invalid firmware upgrade")
+	// ErrFirmwareUpgradeNotRunning is returned when aborting a finished upgrade.
+	ErrFirmwareUpgradeNotRunning = errors.New("firmware upgrade is not running")
+)
+
+func firmwareUpgradeWorkerName(id uint) string {
+	return fmt.Sprintf("firmware_upgrade_%d", id)
+}
+
+// FirmwareUpgradeRequest describes an upgrade of one or more devices to an image.
+// Groups are upgraded one after the other, e.g. [[canary], [the rest]]; without
+// groups device_ids is split into groups of group_size (default one group).
+type FirmwareUpgradeRequest struct {
+	Name             string   `json:"name"`
+	ImageID          uint     `json:"image_id"`
+	DeviceIDs        []uint   `json:"device_ids"`
+	Groups           [][]uint `json:"groups"`
+	GroupSize        int      `json:"group_size"`
+	FailureThreshold int      `json:"failure_threshold"` // failed devices tolerated before the rollout halts, default 0
+	UploadTimeout    int      `json:"upload_timeout"`
+	Timeout          int      `json:"timeout"`
+	DryRun           bool     `json:"dry_run"`
+}
+
+// FirmwareUpdateInfo tells whether a newer image is available for a device:
+// the baseline version of its board type if the repository has it, else the
+// latest uploaded image.
+type FirmwareUpdateInfo struct {
+	DeviceID       uint   `json:"device_id"`
+	BoardType      string `json:"board_type"`
+	CurrentVersion string `json:"current_version"`
+	Available      bool   `json:"available"`
+	Version        string `json:"version,omitempty"`
+	ImageID        uint   `json:"image_id,omitempty"`
+	Baseline       bool   `json:"baseline"` // the offered version is the approved baseline
+}
+
+type firmwareUpgradeRun struct {
+	actor   AuditActor
+	cancel  context.CancelFunc
+	aborted bool
+	mu      sync.Mutex // guards the job while the devices of a group run concurrently
+}
+
+// FirmwareUpgradeService 固件升级编排：通过单板的HTTP升级接口推送镜像并跟踪上传进度，然后重启设备，
+// 等待其重新应答AT后用AT^DGMR?确认新版本。设备按组分阶段升级，同组设备并行，失败的设备超过
+// failure_threshold后停止，后续组不再升级
+type FirmwareUpgradeService struct {
+	db         *gorm.DB
+	deviceComm *DeviceCommService
+	firmware   *FirmwareService
+	reboots    *RebootJobService
+	inventory  *InventoryService
+	audit      *AuditService
+	supervisor *Supervisor
+
+	mu   sync.Mutex
+	runs map[uint]*firmwareUpgradeRun
+}
+
+// NewFirmwareUpgradeService 创建固件升级服务
+func NewFirmwareUpgradeService(db *gorm.DB, deviceComm *DeviceCommService, firmware *FirmwareService, reboots *RebootJobService, inventory *InventoryService, audit *AuditService, supervisor *Supervisor) *FirmwareUpgradeService {
+	return &FirmwareUpgradeService{
+		db:         db,
+		deviceComm: deviceComm,
+		firmware:   firmware,
+		reboots:    reboots,
+		inventory:  inventory,
+		audit:      audit,
+		supervisor: supervisor,
+		runs:       make(map[uint]*firmwareUpgradeRun),
+	}
+}
+
+// Start 将上次运行中断的升级标记为interrupted
+func (s *FirmwareUpgradeService) Start() {
+	err := s.db.Model(&model.FirmwareUpgrade{}).Where("status = ?", model.FirmwareUpgradeRunning).Updates(map[string]interface{}{
+		"status":      model.FirmwareUpgradeInterrupted,
+		"error":       "the backend stopped during the upgrade; check the version of the devices of the current group",
+		"finished_at": time.Now(),
+	}).Error
+	if err != nil {
+		log.Printf("Failed to mark interrupted firmware upgrades: %v", err)
+	}
+}
+
+// Plan 校验请求并划分升级组，不修改任何设备
+func (s *FirmwareUpgradeService) Plan(req FirmwareUpgradeRequest) (*model.FirmwareUpgrade, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrFirmwareUpgradeInvalid, fmt.Sprintf(format, args...))
+	}
+	if req.FailureThreshold < 0 || req.GroupSize < 0 || req.UploadTimeout < 0 || req.Timeout < 0 {
+		return nil, invalid("failure_threshold, group_size, upload_timeout and timeout must not be negative")
+	}
+	image, err := s.firmware.Get(req.ImageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, invalid("firmware image %d not found", req.ImageID)
+		}
+		return nil, err
+	}
+
+	groups := req.Groups
+	if len(groups) > 0 && len(req.DeviceIDs) > 0 {
+		return nil, invalid("use either groups or device_ids")
+	}
+	if len(groups) == 0 {
+		if len(req.DeviceIDs) == 0 {
+			return nil, invalid("device_ids or groups is required")
+		}
+		size := req.GroupSize
+		if size == 0 {
+			size = len(req.DeviceIDs)
+		}
+		for start := 0; start < len(req.DeviceIDs); start += size {
+			end := start + size
+			if end > len(req.DeviceIDs) {
+				end = len(req.DeviceIDs)
+			}
+			groups = append(groups, req.DeviceIDs[start:end])
+		}
+	}
+
+	job := &model.FirmwareUpgrade{
+		Name:             req.Name,
+		ImageID:          image.ID,
+		BoardType:        image.BoardType,
+		Version:          image.Version,
+		FailureThreshold: req.FailureThreshold,
+		UploadTimeout:    req.UploadTimeout,
+		Timeout:          req.Timeout,
+	}
+	if job.UploadTimeout == 0 {
+		job.UploadTimeout = defaultFirmwareUploadTimeout
+	}
+	if job.Timeout == 0 {
+		job.Timeout = defaultRebootTimeout
+	}
+
+	seen := make(map[uint]bool)
+	var problems []string
+	for _, ids := range groups {
+		if len(ids) == 0 {
+			return nil, invalid("groups must not be empty")
+		}
+		group := model.FirmwareUpgradeGroup{Index: len(job.Groups) + 1, Status: model.FirmwareDevicePending}
+		for _, id := range ids {
+			if seen[id] {
+				return nil, invalid("device %d is listed more than once", id)
+			}
+			seen[id] = true
+			device, err := s.deviceComm.getDeviceByID(id)
+			if err != nil {
+				return nil, invalid("device %d not found", id)
+			}
+			if problem := s.checkDevice(device, image); problem != "" {
+				problems = append(problems, fmt.Sprintf("%s %s", device.Name, problem))
+				continue
+			}
+			target := model.FirmwareUpgradeDevice{DeviceID: device.ID, Name: device.Name, NodeID: device.NodeID, Status: model.FirmwareDevicePending}
+			if inv, err := s.inventory.Get(device.ID); err == nil {
+				target.FromVersion = inv.FirmwareVersion
+			}
+			group.Devices = append(group.Devices, target)
+			job.DeviceIDs = append(job.DeviceIDs, device.ID)
+		}
+		job.Groups = append(job.Groups, group)
+	}
+	if len(problems) > 0 {
+		return nil, invalid("%s", strings.Join(problems, "; "))
+	}
+	if job.Name == "" {
+		job.Name = fmt.Sprintf("upgrade of %s to %s", job.Groups[0].Devices[0].Name, image.Version)
+		if len(job.DeviceIDs) > 1 {
+			job.Name = fmt.Sprintf("upgrade of %d devices to %s in %d groups", len(job.DeviceIDs), image.Version, len(job.Groups))
+		}
+	}
+	return job, nil
+}
+
+// checkDevice 设备必须与镜像的单板类型一致，并且单板声明了升级接口、重启和版本查询命令
+func (s *FirmwareUpgradeService) checkDevice(device *model.Device, image *model.FirmwareImage) string {
+	if !sameBoardType(device.BoardType, image.BoardType) {
+		return fmt.Sprintf("is a %s, the image is for %s", device.BoardType, image.BoardType)
+	}
+	if _, err := s.deviceComm.boardConfigMgr.FirmwareUpload(device.BoardType); err != nil {
+		return fmt.Sprintf("cannot be upgraded: %v", err)
+	}
+	for _, name := range []string{"reboot_device", "get_device_info"} {
+		if _, err := s.deviceComm.boardConfigMgr.FormatATCommand(device.BoardType, name, nil); err != nil {
+			return fmt.Sprintf("has no %s command", name)
+		}
+	}
+	return ""
+}
+
+// Confirmation 升级会重启设备，需要确认：单台设备按设备确认，多台设备按镜像和排序后的设备列表确认
+func (s *FirmwareUpgradeService) Confirmation(job *model.FirmwareUpgrade) *DestructiveCommand {
+	ids := sortedIDs(uniqueIDs(job.DeviceIDs))
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	cmd := &DestructiveCommand{
+		CommandName: "firmware_upgrade",
+		Command:     fmt.Sprintf("UPGRADE %s %s %s", job.BoardType, job.Version, strings.Join(parts, ",")),
+		Kind:        DestructiveReboot,
+	}
+	if len(ids) == 1 {
+		cmd.DeviceID = ids[0]
+	}
+	return cmd
+}
+
+// Run 保存并在后台执行已规划的升级
+func (s *FirmwareUpgradeService) Run(job *model.FirmwareUpgrade, actor AuditActor) (*model.FirmwareUpgrade, error) {
+	now := time.Now()
+	job.Status = model.FirmwareUpgradeRunning
+	job.CreatedBy = actor.Username
+	job.StartedAt = &now
+	if err := s.db.Create(job).Error; err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(s.supervisor.Context())
+	run := &firmwareUpgradeRun{actor: actor, cancel: cancel}
+	s.mu.Lock()
+	s.runs[job.ID] = run
+	s.mu.Unlock()
+
+	// 工作协程修改自己的副本，返回给调用方的记录不受影响
+	worker := *job
+	worker.Groups = make([]model.FirmwareUpgradeGroup, len(job.Groups))
+	for i, group := range job.Groups {
+		group.Devices = append([]model.FirmwareUpgradeDevice(nil), group.Devices...)
+		worker.Groups[i] = group
+	}
+	s.supervisor.Go(firmwareUpgradeWorkerName(job.ID), func(context.Context) error {
+		defer cancel()
+		return s.execute(ctx, &worker, run)
+	})
+	return job, nil
+}
+
+// List 返回升级作业，新的在前；deviceID不为0时只返回包含该设备的作业
+func (s *FirmwareUpgradeService) List(deviceID uint) ([]model.FirmwareUpgrade, error) {
+	var jobs []model.FirmwareUpgrade
+	if err := s.db.Order("id DESC").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	if deviceID == 0 {
+		return jobs, nil
+	}
+	filtered := []model.FirmwareUpgrade{}
+	for _, job := range jobs {
+		if containsID(job.DeviceIDs, deviceID) {
+			filtered = append(filtered, job)
+		}
+	}
+	return filtered, nil
+}
+
+// Get 返回升级作业及其进度
+func (s *FirmwareUpgradeService) Get(id uint) (*model.FirmwareUpgrade, error) {
+	var job model.FirmwareUpgrade
+	if err := s.db.First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Abort 停止升级：进行中的上传和等待立即结束，后续组不再升级
+func (s *FirmwareUpgradeService) Abort(id uint) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	run, ok := s.runs[id]
+	if ok {
+		run.aborted = true
+	}
+	s.mu.Unlock()
+	if !ok {
+		return ErrFirmwareUpgradeNotRunning
+	}
+	run.cancel()
+	return nil
+}
+
+// aborted 读取运行的中止标记；Abort在s.mu下设置该标记
+func (s *FirmwareUpgradeService) aborted(run *firmwareUpgradeRun) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return run.aborted
+}
+
+// CheckUpdate 返回设备可升级的版本：优先使用单板类型的基线版本，仓库中没有基线镜像时使用最新上传的镜像
+func (s *FirmwareUpgradeService) CheckUpdate(deviceID uint) (*FirmwareUpdateInfo, error) {
+	device, err := s.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	info := &FirmwareUpdateInfo{DeviceID: device.ID, BoardType: device.BoardType}
+	inv, err := s.inventory.Get(device.ID)
+	if err != nil {
+		if inv, err = s.inventory.Collect(device.ID, model.InventorySourceCollect); err != nil {
+			return nil, fmt.Errorf("reading the current version failed: %v", err)
+		}
+	}
+	info.CurrentVersion = inv.FirmwareVersion
+
+	images, err := s.firmware.List(device.BoardType)
+	if err != nil || len(images) == 0 {
+		return info, err
+	}
+	offer := &images[0]
+	var baseline model.FirmwareBaseline
+	if s.db.Where("board_type IN ?", boardTypeNames(device.BoardType)).First(&baseline).Error == nil {
+		for i := range images {
+			if images[i].Version == baseline.FirmwareVersion {
+				offer, info.Baseline = &images[i], true
+				break
+			}
+		}
+	}
+	info.Version, info.ImageID = offer.Version, offer.ID
+	info.Available = offer.Version != info.CurrentVersion
+	return info, nil
+}
+
+// execute 逐组升级；失败的设备超过阈值时停止，后续组不再升级
+func (s *FirmwareUpgradeService) execute(ctx context.Context, job *model.FirmwareUpgrade, run *firmwareUpgradeRun) error {
+	defer func() {
+		s.mu.Lock()
+		delete(s.runs, job.ID)
+		s.mu.Unlock()
+	}()
+
+	var failure error
+	image, err := s.firmware.Get(job.ImageID)
+	if err != nil {
+		failure = fmt.Errorf("firmware image %d: %v", job.ImageID, err)
+	}
+	for i := range job.Groups {
+		if failure != nil || ctx.Err() != nil {
+			break
+		}
+		job.CurrentGroup = i + 1
+		s.runGroup(ctx, job, i, image, run)
+		if job.Failed > job.FailureThreshold {
+			failure = fmt.Errorf("%d devices failed, more than the failure threshold %d", job.Failed, job.FailureThreshold)
+		}
+	}
+	for i := range job.Groups {
+		group := &job.Groups[i]
+		for j := range group.Devices {
+			if d := &group.Devices[j]; d.Status == model.FirmwareDevicePending {
+				d.Status = model.FirmwareDeviceSkipped
+			}
+		}
+		if group.Status == model.FirmwareDevicePending {
+			group.Status = model.FirmwareDeviceSkipped
+		}
+	}
+
+	switch {
+	case s.aborted(run):
+		s.finish(job, model.FirmwareUpgradeAborted, "aborted by user")
+	case ctx.Err() != nil:
+		s.finish(job, model.FirmwareUpgradeInterrupted, "the backend stopped during the upgrade; check the version of the devices of the current group")
+	case failure != nil:
+		s.finish(job, model.FirmwareUpgradeHalted, failure.Error())
+	default:
+		message := ""
+		if job.Failed > 0 {
+			message = fmt.Sprintf("%d devices failed, within the failure threshold %d", job.Failed, job.FailureThreshold)
+		}
+		s.finish(job, model.FirmwareUpgradeCompleted, message)
+	}
+	return failure
+}
+
+// runGroup 并行升级组内的设备，全部结束后返回
+func (s *FirmwareUpgradeService) runGroup(ctx context.Context, job *model.FirmwareUpgrade, index int, image *model.FirmwareImage, run *firmwareUpgradeRun) {
+	group := &job.Groups[index]
+	s.update(job, run, func() {
+		now := time.Now()
+		group.StartedAt = &now
+		group.Status = model.FirmwareUpgradeRunning
+	})
+
+	var wg sync.WaitGroup
+	for i := range group.Devices {
+		wg.Add(1)
+		go func(d *model.FirmwareUpgradeDevice) {
+			defer wg.Done()
+			err := s.upgradeDevice(ctx, job, d, image, run)
+			s.update(job, run, func() {
+				now := time.Now()
+				d.FinishedAt = &now
+				if err != nil {
+					d.Status, d.Error = model.FirmwareDeviceFailed, err.Error()
+					job.Failed++
+				}
+			})
+			if err != nil {
+				s.db.Create(&model.DeviceLog{DeviceID: d.DeviceID, Type: "firmware", Message: fmt.Sprintf("firmware upgrade %d to %s failed: %v", job.ID, job.Version, err), CreatedAt: time.Now()})
+			}
+		}(&group.Devices[i])
+	}
+	wg.Wait()
+
+	s.update(job, run, func() {
+		now := time.Now()
+		group.FinishedAt = &now
+		group.Status = model.FirmwareDeviceSucceeded
+		for _, d := range group.Devices {
+			if d.Status == model.FirmwareDeviceFailed {
+				group.Status = model.FirmwareDeviceFailed
+			}
+		}
+	})
+}
+
+// upgradeDevice 确认设备在线并读取当前版本，推送镜像，重启并等待设备恢复，最后核对AT^DGMR?上报的版本
+func (s *FirmwareUpgradeService) upgradeDevice(ctx context.Context, job *model.FirmwareUpgrade, d *model.FirmwareUpgradeDevice, image *model.FirmwareImage, run *firmwareUpgradeRun) error {
+	device, err := s.deviceComm.getDeviceByID(d.DeviceID)
+	if err != nil {
+		return err
+	}
+	if status, _ := s.deviceComm.GetDeviceStatus(d.DeviceID); status != "Online" {
+		return errors.New("device is offline before the upgrade")
+	}
+	current, err := s.version(d.DeviceID)
+	if err != nil {
+		return fmt.Errorf("reading the version before the upgrade failed: %v", err)
+	}
+	s.update(job, run, func() {
+		now := time.Now()
+		d.StartedAt, d.FromVersion = &now, current
+	})
+	if current == image.Version {
+		s.update(job, run, func() { d.Status, d.ToVersion, d.Progress = model.FirmwareDeviceCurrent, current, 100 })
+		return nil
+	}
+
+	// 1. 推送镜像
+	s.update(job, run, func() { d.Status = model.FirmwareDeviceUploading })
+	if err := s.push(ctx, device, image, job, d, run); err != nil {
+		return fmt.Errorf("upload failed: %v", err)
+	}
+	details := fmt.Sprintf("firmware upgrade %d: %s pushed by %s", job.ID, image.Version, run.actor.Username)
+	s.db.Create(&model.DeviceLog{DeviceID: d.DeviceID, Type: "firmware", Message: details, CreatedAt: time.Now()})
+
+	// 2. 重启并等待设备重新应答AT
+	command, err := s.deviceComm.FormatCommandByName(d.DeviceID, "reboot_device", nil)
+	if err != nil {
+		return err
+	}
+	response, err := s.deviceComm.SendATCommand(d.DeviceID, command)
+	s.audit.RecordCommand(run.actor, d.DeviceID, "reboot_device", command, response, err)
+	if err != nil {
+		return fmt.Errorf("reboot command failed: %v", err)
+	}
+	sentAt := time.Now()
+	s.update(job, run, func() {
+		now := time.Now()
+		d.Status, d.UploadedAt = model.FirmwareDeviceRebooting, &now
+	})
+	if err := s.waitBack(ctx, d.DeviceID, sentAt, time.Duration(job.Timeout)*time.Second); err != nil {
+		return err
+	}
+	s.update(job, run, func() {
+		now := time.Now()
+		d.Status, d.UpAt = model.FirmwareDeviceVerifying, &now
+		d.DowntimeSeconds = roundSeconds(now.Sub(sentAt))
+	})
+
+	// 3. 核对新版本，并记入设备清单
+	after, err := s.version(d.DeviceID)
+	if err != nil {
+		return fmt.Errorf("reading the version after the reboot failed: %v", err)
+	}
+	s.update(job, run, func() { d.ToVersion = after })
+	if after != image.Version {
+		return fmt.Errorf("device reports %s after the reboot, expected %s; the image was not activated", after, image.Version)
+	}
+	if _, err := s.inventory.Collect(d.DeviceID, model.InventorySourceUpgrade); err != nil {
+		log.Printf("Firmware inventory of device %d after the upgrade failed: %v", d.DeviceID, err)
+	}
+	s.update(job, run, func() { d.Status = model.FirmwareDeviceSucceeded })
+	return nil
+}
+
+// version 查询AT^DGMR?并返回其中的固件版本
+func (s *FirmwareUpgradeService) version(deviceID uint) (string, error) {
+	value, _, err := s.reboots.queryValue(deviceID, "get_device_info")
+	if err != nil {
+		return "", err
+	}
+	info := ParseVersionInfo(value)
+	if info.FirmwareVersion == "" {
+		return "", fmt.Errorf("no firmware version in %q", value)
+	}
+	return info.FirmwareVersion, nil
+}
+
+// push 以multipart表单把镜像推送到单板的升级接口，随上传记录进度
+func (s *FirmwareUpgradeService) push(ctx context.Context, device *model.Device, image *model.FirmwareImage, job *model.FirmwareUpgrade, d *model.FirmwareUpgradeDevice, run *firmwareUpgradeRun) error {
+	upload, err := s.deviceComm.boardConfigMgr.FirmwareUpload(device.BoardType)
+	if err != nil {
+		return err
+	}
+	f, err := s.firmware.Open(image)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		err := func() error {
+			for name, value := range map[string]string{"version": image.Version, "checksum": image.Checksum} {
+				if err := form.WriteField(name, value); err != nil {
+					return err
+				}
+			}
+			part, err := form.CreateFormFile(upload.FileField, image.FileName)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(part, &progressReader{r: f, report: func(sent int64) { s.progress(job, d, run, sent, image.Size) }}); err != nil {
+				return err
+			}
+			return form.Close()
+		}()
+		writer.CloseWithError(err)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(job.UploadTimeout)*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s%s", device.IP, upload.UploadPath), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		body.CloseWithError(err)
+		return err
+	}
+	defer resp.Body.Close()
+	reply, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	message := strings.TrimSpace(string(reply))
+	if resp.StatusCode != http.StatusOK || strings.Contains(strings.ToUpper(message), "ERROR") {
+		return fmt.Errorf("device answered %d: %s", resp.StatusCode, message)
+	}
+	s.update(job, run, func() { d.BytesSent, d.Progress = image.Size, 100 })
+	return nil
+}
+
+// progress 记录上传进度，按firmwareSaveInterval节流写库
+func (s *FirmwareUpgradeService) progress(job *model.FirmwareUpgrade, d *model.FirmwareUpgradeDevice, run *firmwareUpgradeRun, sent, total int64) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	d.BytesSent = sent
+	if total > 0 {
+		d.Progress = int(sent * 100 / total)
+	}
+	if sent < total && time.Since(job.UpdatedAt) < firmwareSaveInterval {
+		return
+	}
+	s.save(job)
+}
+
+// waitBack 按退避间隔探测设备：先观察到设备不可达，再等待其重新应答AT
+func (s *FirmwareUpgradeService) waitBack(ctx context.Context, deviceID uint, sentAt time.Time, timeout time.Duration) error {
+	interval := rebootPollMin
+	down := false
+	for {
+		now := time.Now()
+		if !s.reboots.answersAT(deviceID) {
+			if !down {
+				// 设备刚下线，重新从最短间隔开始探测
+				down, interval = true, rebootPollMin
+			}
+		} else if down || now.Sub(sentAt) >= rebootDownWait {
+			return nil
+		}
+		if now.Sub(sentAt) > timeout {
+			return fmt.Errorf("did not answer AT within %ds after the reboot", int(timeout.Seconds()))
+		}
+		if err := sleepContext(ctx, interval); err != nil {
+			return errors.New("stopped while waiting for the device to come back")
+		}
+		if interval *= 2; interval > rebootPollMax {
+			interval = rebootPollMax
+		}
+	}
+}
+
+// update 在作业锁内修改进度并保存
+func (s *FirmwareUpgradeService) update(job *model.FirmwareUpgrade, run *firmwareUpgradeRun, fn func()) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	fn()
+	s.save(job)
+}
+
+func (s *FirmwareUpgradeService) finish(job *model.FirmwareUpgrade, status, message string) {
+	now := time.Now()
+	job.Status = status
+	job.Error = message
+	job.FinishedAt = &now
+	s.save(job)
+	log.Printf("Firmware upgrade %d finished: %s %s", job.ID, status, message)
+}
+
+func (s *FirmwareUpgradeService) save(job *model.FirmwareUpgrade) {
+	if err := s.db.Save(job).Error; err != nil {
+		log.Printf("Failed to save firmware upgrade %d: %v", job.ID, err)
+	}
+}
+
+// progressReader 在读取时回报已读取的字节数
+type progressReader struct {
+	r      io.Reader
+	read   int64
+	report func(int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.read += int64(n)
+		p.report(p.read)
+	}
+	return n, err
+}
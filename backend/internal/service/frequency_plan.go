@@ -0,0 +1,832 @@
+package service
+
+import (
+	"backend/internal/model"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Frequency conflict kinds
+const (
+	ConflictOverlap   = "overlap"     // two networks share spectrum
+	ConflictGuard     = "guard"       // closer than the guard band
+	ConflictExclusion = "exclusion"   // inside an excluded range
+	ConflictOutOfBand = "out_of_band" // outside the bands the devices can use
+)
+
+var (
+	// ErrFrequencyPlanInvalid is returned for a planning request that cannot be served.
+	ErrFrequencyPlanInvalid = errors.New("invalid frequency plan request")
+	// ErrFrequencyPlanInfeasible is returned when applying a plan that could not place every network.
+	ErrFrequencyPlanInfeasible = errors.New("frequency plan is not feasible")
+)
+
+// FrequencyRange is an inclusive EARFCN range in 100KHz units.
+type FrequencyRange struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Label string `json:"label,omitempty"`
+}
+
+func (r FrequencyRange) overlaps(o FrequencyRange) bool {
+	return r.Start <= o.End && o.Start <= r.End
+}
+
+func (r FrequencyRange) contains(o FrequencyRange) bool {
+	return r.Start <= o.Start && o.End <= r.End
+}
+
+// PlanChannel is a center frequency with its bandwidth and occupied range.
+type PlanChannel struct {
+	Frequency int    `json:"frequency"`
+	Bandwidth string `json:"bandwidth"`
+	Start     int    `json:"start"`
+	End       int    `json:"end"`
+}
+
+func newPlanChannel(freq int, bandwidth string) *PlanChannel {
+	h := bandwidthHalfWidth[bandwidth]
+	return &PlanChannel{Frequency: freq, Bandwidth: bandwidth, Start: freq - h, End: freq + h}
+}
+
+func (c *PlanChannel) span() FrequencyRange {
+	return FrequencyRange{Start: c.Start, End: c.End}
+}
+
+// PlanNetworkRequest is one co-located network to plan.
+type PlanNetworkRequest struct {
+	Name         string `json:"name"`
+	DeviceIDs    []uint `json:"device_ids"`
+	RootDeviceID uint   `json:"root_device_id"` // 应用时分批变更的根节点，默认第一个设备
+	Bandwidth    string `json:"bandwidth"`      // 固定带宽；默认保持当前带宽，放不下时依次尝试更窄的
+	Fixed        bool   `json:"fixed"`          // 保持当前信道，只参与冲突检查
+}
+
+// FrequencyPlanRequest describes the co-located networks and the spectrum to avoid.
+type FrequencyPlanRequest struct {
+	Networks    []PlanNetworkRequest `json:"networks"`
+	Exclusions  []FrequencyRange     `json:"exclusions"`    // 不受管理的相邻网络或禁用的频点范围
+	Guard       int                  `json:"guard"`         // 相邻信道之间的保护间隔(100KHz)
+	SetSubBands bool                 `json:"set_sub_bands"` // 同时将建链子频段(AT^DSONSBR)设置为各网络的信道范围
+
+	RefreshTopology bool `json:"refresh_topology"` // 应用时先执行邻居发现再安排分批顺序
+
+	AvoidInterference bool `json:"avoid_interference"` // 将频谱勘测发现的持续干扰频点加入避让范围
+	SurveyHours       int  `json:"survey_hours"`       // 频谱勘测的统计窗口，默认24小时
+}
+
+// PlanDevice is what the planner read from one device and the commands it would receive.
+type PlanDevice struct {
+	DeviceID        uint                   `json:"device_id"`
+	DeviceName      string                 `json:"device_name"`
+	BoardType       string                 `json:"board_type"`
+	Bands           []string               `json:"bands"`      // board bands selected by AT^DAOCNDI
+	Bandwidths      []string               `json:"bandwidths"` // bandwidths the board supports
+	SubBands        []FrequencyRange       `json:"sub_bands"`  // AT^DSONSBR (or AT^DSBR) windows
+	LockedFrequency int                    `json:"locked_frequency,omitempty"`
+	Current         *PlanChannel           `json:"current,omitempty"` // AT^DRPC
+	Commands        []model.PreviewCommand `json:"commands,omitempty"`
+	Issues          []string               `json:"issues"`
+
+	power string
+}
+
+// NetworkPlan is the proposal for one network.
+type NetworkPlan struct {
+	Name          string           `json:"name"`
+	RootDeviceID  uint             `json:"root_device_id"`
+	DeviceIDs     []uint           `json:"device_ids"`
+	Allowed       []FrequencyRange `json:"allowed"` // spectrum every device of the network can use
+	Current       *PlanChannel     `json:"current,omitempty"`
+	Proposed      *PlanChannel     `json:"proposed,omitempty"`
+	Changed       bool             `json:"changed"`
+	BuildingChain string           `json:"building_chain,omitempty"` // frequency_point for the sub-band range
+	Devices       []PlanDevice     `json:"devices"`
+	Issues        []string         `json:"issues"`
+	Error         string           `json:"error,omitempty"` // no channel could be found
+
+	request    PlanNetworkRequest
+	bandwidths []string
+	locked     int
+}
+
+// FrequencyConflict is a problem with the current assignments.
+type FrequencyConflict struct {
+	Kind     string   `json:"kind"`
+	Networks []string `json:"networks"` // network names; exclusions are named by their label
+	Start    int      `json:"start"`
+	End      int      `json:"end"`
+}
+
+// FrequencyPlan is the proposal for all networks.
+type FrequencyPlan struct {
+	Feasible  bool                `json:"feasible"`
+	Changes   int                 `json:"changes"` // networks that move
+	Guard     int                 `json:"guard"`
+	Networks  []NetworkPlan       `json:"networks"`
+	Conflicts []FrequencyConflict `json:"conflicts"` // in the current assignments
+
+	Interference []Interferer `json:"interference,omitempty"` // persistent interferers avoided with avoid_interference
+}
+
+// PlanRollout is the staged rollout started for one network.
+type PlanRollout struct {
+	Network   string `json:"network"`
+	RolloutID uint   `json:"rollout_id,omitempty"`
+	Status    string `json:"status"` // started, deferred or failed
+	Error     string `json:"error,omitempty"`
+}
+
+// FrequencyPlanApplyResult is the outcome of applying a plan.
+type FrequencyPlanApplyResult struct {
+	Plan     *FrequencyPlan `json:"plan"`
+	Rollouts []PlanRollout  `json:"rollouts"`
+}
+
+// FrequencyPlanService 频率规划：根据单板支持的频段和带宽、设备选择的频段(AT^DAOCNDI)、
+// 建链子频段(AT^DSONSBR)和锁频(AT^DLF)，为同一区域内的多个网络分配互不重叠的信道，
+// 并通过分批变更应用规划
+type FrequencyPlanService struct {
+	db         *gorm.DB
+	deviceComm *DeviceCommService
+	changeSet  *ChangeSetExecutor
+	rollout    *RolloutService
+	survey     *SpectrumSurveyService
+}
+
+// NewFrequencyPlanService 创建频率规划服务
+func NewFrequencyPlanService(db *gorm.DB, deviceComm *DeviceCommService, changeSet *ChangeSetExecutor, rollout *RolloutService, survey *SpectrumSurveyService) *FrequencyPlanService {
+	return &FrequencyPlanService{
+		db:         db,
+		deviceComm: deviceComm,
+		changeSet:  changeSet,
+		rollout:    rollout,
+		survey:     survey,
+	}
+}
+
+// Plan 读取设备当前状态，报告现有分配的冲突并给出新的分配。
+// 固定和锁频的网络先放置，其余网络按可用频谱从少到多依次放置；当前信道有效时保持不变，
+// 否则选择离当前频点最近的空闲位置，放不下时依次尝试更窄的带宽。
+// avoid_interference时，这些设备上报中持续受扰的信道与exclusions一样处理
+func (s *FrequencyPlanService) Plan(req FrequencyPlanRequest) (*FrequencyPlan, error) {
+	var interference []Interferer
+	if req.AvoidInterference {
+		var deviceIDs []uint
+		for _, n := range req.Networks {
+			deviceIDs = append(deviceIDs, n.DeviceIDs...)
+		}
+		survey, err := s.survey.Survey(SpectrumSurveyRequest{DeviceIDs: deviceIDs, Hours: req.SurveyHours})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrFrequencyPlanInvalid, err)
+		}
+		interference = survey.Interferers
+		req.Exclusions = append(append([]FrequencyRange(nil), req.Exclusions...), survey.Exclusions...)
+	}
+	networks, err := s.networks(req)
+	if err != nil {
+		return nil, err
+	}
+	plan := &FrequencyPlan{Guard: req.Guard, Networks: networks, Conflicts: currentConflicts(networks, req), Interference: interference}
+
+	blocked := make([]FrequencyRange, 0, len(req.Exclusions)+len(networks))
+	for _, e := range req.Exclusions {
+		blocked = append(blocked, FrequencyRange{Start: e.Start - req.Guard, End: e.End + req.Guard, Label: e.Label})
+	}
+	order := make([]int, len(networks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		na, nb := &networks[order[a]], &networks[order[b]]
+		if pa, pb := na.pinned(), nb.pinned(); pa != pb {
+			return pa
+		}
+		return rangesWidth(na.Allowed) < rangesWidth(nb.Allowed)
+	})
+	for _, i := range order {
+		n := &networks[i]
+		if n.Error == "" {
+			n.place(blocked, req)
+		}
+		if n.Proposed != nil {
+			span := n.Proposed.span()
+			blocked = append(blocked, FrequencyRange{Start: span.Start - req.Guard, End: span.End + req.Guard, Label: n.Name})
+		}
+	}
+
+	plan.Feasible = true
+	for i := range networks {
+		n := &networks[i]
+		if n.Error != "" {
+			plan.Feasible = false
+			continue
+		}
+		n.Changed = n.Current == nil || *n.Current != *n.Proposed
+		if req.SetSubBands {
+			n.BuildingChain = fmt.Sprintf("%d-%d", n.Proposed.Start, n.Proposed.End)
+		}
+		if n.Changed || req.SetSubBands {
+			s.renderChangeSets(n)
+		}
+		if n.Changed {
+			plan.Changes++
+		}
+	}
+	return plan, nil
+}
+
+// Apply 为每个需要修改的网络启动一次分批变更。新信道与其他网络当前信道重叠的网络暂缓，
+// 待占用该信道的网络修改完成后再次应用规划即可
+func (s *FrequencyPlanService) Apply(req FrequencyPlanRequest, actor AuditActor) (*FrequencyPlanApplyResult, error) {
+	plan, err := s.Plan(req)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.Feasible {
+		var failed []string
+		for _, n := range plan.Networks {
+			if n.Error != "" {
+				failed = append(failed, fmt.Sprintf("%s: %s", n.Name, n.Error))
+			}
+		}
+		return &FrequencyPlanApplyResult{Plan: plan, Rollouts: []PlanRollout{}}, fmt.Errorf("%w: %s", ErrFrequencyPlanInfeasible, strings.Join(failed, "; "))
+	}
+
+	result := &FrequencyPlanApplyResult{Plan: plan, Rollouts: []PlanRollout{}}
+	var deferred []NetworkPlan
+	started := 0
+	for _, n := range plan.Networks {
+		if !n.Changed && n.BuildingChain == "" {
+			continue
+		}
+		if blocker := occupiedBy(plan, n); blocker != "" {
+			deferred = append(deferred, n)
+			continue
+		}
+		result.Rollouts = append(result.Rollouts, s.startRollout(req, n, actor, ""))
+		started++
+	}
+	for i, n := range deferred {
+		blocker := occupiedBy(plan, n)
+		// 网络之间互相占用对方的新信道时，先移动第一个，其间与对方短暂重叠
+		if started == 0 && i == 0 {
+			result.Rollouts = append(result.Rollouts, s.startRollout(req, n, actor,
+				fmt.Sprintf("overlaps the current channel of %s until it has moved", blocker)))
+			continue
+		}
+		result.Rollouts = append(result.Rollouts, PlanRollout{
+			Network: n.Name,
+			Status:  "deferred",
+			Error:   fmt.Sprintf("new channel overlaps the current channel of %s; apply the plan again after it has moved", blocker),
+		})
+	}
+	return result, nil
+}
+
+func (s *FrequencyPlanService) startRollout(req FrequencyPlanRequest, n NetworkPlan, actor AuditActor, warning string) PlanRollout {
+	change := model.RolloutChange{BuildingChain: n.BuildingChain}
+	if n.Changed {
+		freq := n.Proposed.Frequency
+		change.Frequency = &freq
+		change.Bandwidth = n.Proposed.Bandwidth
+	}
+	rollout, err := s.rollout.Create(RolloutRequest{
+		Name:            fmt.Sprintf("frequency plan: %s", n.Name),
+		RootDeviceID:    n.RootDeviceID,
+		DeviceIDs:       n.DeviceIDs,
+		Change:          change,
+		RefreshTopology: req.RefreshTopology,
+	}, actor)
+	if err != nil {
+		return PlanRollout{Network: n.Name, Status: "failed", Error: err.Error()}
+	}
+	return PlanRollout{Network: n.Name, RolloutID: rollout.ID, Status: "started", Error: warning}
+}
+
+// occupiedBy 返回当前信道与n的新信道重叠、且自身还要修改的其他网络
+func occupiedBy(plan *FrequencyPlan, n NetworkPlan) string {
+	if !n.Changed {
+		return ""
+	}
+	for _, other := range plan.Networks {
+		if other.Name == n.Name || other.Current == nil || !other.Changed {
+			continue
+		}
+		if other.Current.span().overlaps(n.Proposed.span()) {
+			return other.Name
+		}
+	}
+	return ""
+}
+
+// networks 校验请求并读取每个网络中设备的状态
+func (s *FrequencyPlanService) networks(req FrequencyPlanRequest) ([]NetworkPlan, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrFrequencyPlanInvalid, fmt.Sprintf(format, args...))
+	}
+	if len(req.Networks) == 0 {
+		return nil, invalid("networks is required")
+	}
+	if req.Guard < 0 {
+		return nil, invalid("guard must not be negative")
+	}
+	for _, e := range req.Exclusions {
+		if e.Start > e.End {
+			return nil, invalid("exclusion %d-%d: start is greater than end", e.Start, e.End)
+		}
+	}
+
+	names := make(map[string]bool)
+	owner := make(map[uint]string)
+	var ids []uint
+	for i, n := range req.Networks {
+		if n.Name == "" {
+			req.Networks[i].Name = fmt.Sprintf("network-%d", i+1)
+			n.Name = req.Networks[i].Name
+		}
+		if names[n.Name] {
+			return nil, invalid("duplicate network name %q", n.Name)
+		}
+		names[n.Name] = true
+		if len(n.DeviceIDs) == 0 {
+			return nil, invalid("network %s has no devices", n.Name)
+		}
+		if n.Bandwidth != "" {
+			if _, ok := bandwidthHalfWidth[n.Bandwidth]; !ok {
+				return nil, invalid("network %s: unsupported bandwidth %q", n.Name, n.Bandwidth)
+			}
+		}
+		for _, id := range n.DeviceIDs {
+			if other, ok := owner[id]; ok {
+				return nil, invalid("device %d is in both %s and %s", id, other, n.Name)
+			}
+			owner[id] = n.Name
+			ids = append(ids, id)
+		}
+		if n.RootDeviceID != 0 && !containsID(n.DeviceIDs, n.RootDeviceID) {
+			return nil, invalid("network %s: root device %d is not one of its devices", n.Name, n.RootDeviceID)
+		}
+	}
+
+	var devices []model.Device
+	if err := s.db.Where("id IN ?", ids).Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	if len(devices) != len(ids) {
+		return nil, invalid("device_ids contains unknown devices")
+	}
+	states := s.readDevices(devices, req.SetSubBands)
+
+	networks := make([]NetworkPlan, 0, len(req.Networks))
+	for _, n := range req.Networks {
+		plan := NetworkPlan{
+			Name:         n.Name,
+			RootDeviceID: n.RootDeviceID,
+			DeviceIDs:    n.DeviceIDs,
+			Devices:      []PlanDevice{},
+			Issues:       []string{},
+			request:      n,
+		}
+		if plan.RootDeviceID == 0 {
+			plan.RootDeviceID = n.DeviceIDs[0]
+		}
+		for _, id := range n.DeviceIDs {
+			plan.Devices = append(plan.Devices, states[id])
+		}
+		plan.combine(req.SetSubBands)
+		networks = append(networks, plan)
+	}
+	return networks, nil
+}
+
+// readDevices 并发读取设备的频段、子频段、锁频和当前信道
+func (s *FrequencyPlanService) readDevices(devices []model.Device, setSubBands bool) map[uint]PlanDevice {
+	states := make(map[uint]PlanDevice, len(devices))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	semaphore := make(chan struct{}, 10)
+	for _, device := range devices {
+		wg.Add(1)
+		go func(device model.Device) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			state := s.readDevice(device, setSubBands)
+			mu.Lock()
+			states[device.ID] = state
+			mu.Unlock()
+		}(device)
+	}
+	wg.Wait()
+	return states
+}
+
+func (s *FrequencyPlanService) readDevice(device model.Device, setSubBands bool) PlanDevice {
+	radio := s.deviceComm.BoardConfigs().RadioCapabilities(device.BoardType)
+	pd := PlanDevice{
+		DeviceID:   device.ID,
+		DeviceName: device.Name,
+		BoardType:  device.BoardType,
+		Bands:      radio.Bands,
+		Bandwidths: radio.Bandwidths,
+		SubBands:   []FrequencyRange{},
+		Issues:     []string{},
+	}
+
+	if value, err := s.changeSet.readValue(&device, "AT^DAOCNDI?"); err != nil {
+		pd.Issues = append(pd.Issues, fmt.Sprintf("band selection unreadable, assuming every band of the board: %v", err))
+	} else if fields := splitFields(value); len(fields) > 0 {
+		pd.Bands = intersectStrings(radio.Bands, BandsFromBitmap(fields[0]))
+		if len(pd.Bands) == 0 {
+			pd.Issues = append(pd.Issues, fmt.Sprintf("selected bands %s are not supported by board %s", fields[0], device.BoardType))
+		}
+	}
+
+	if value, err := s.changeSet.readValue(&device, "AT^DSONSBR?"); err == nil {
+		pd.SubBands = parseSubBandWindows(value)
+	} else if value, dsbrErr := s.changeSet.readValue(&device, "AT^DSBR?"); dsbrErr == nil {
+		// 旧固件只有一个子频段范围
+		if fields := splitFields(value); len(fields) >= 2 {
+			start, _ := strconv.Atoi(fields[0])
+			end, _ := strconv.Atoi(fields[1])
+			pd.SubBands = append(pd.SubBands, FrequencyRange{Start: start, End: end})
+		}
+	} else if !setSubBands {
+		pd.Issues = append(pd.Issues, fmt.Sprintf("sub-band range unreadable: %v", err))
+	}
+
+	if value, err := s.changeSet.readValue(&device, "AT^DLF?"); err == nil {
+		fields := splitFields(value)
+		if len(fields) >= 2 && fields[0] == "1" {
+			pd.LockedFrequency, _ = strconv.Atoi(fields[1])
+		}
+	}
+
+	freq, bandwidth, power := s.deviceComm.ReadRadioParams(device.ID)
+	pd.power = power
+	f, freqErr := strconv.Atoi(freq)
+	bw, bwErr := strconv.Atoi(bandwidth)
+	name, known := BandwidthName(bw)
+	switch {
+	case freq == "":
+		pd.Issues = append(pd.Issues, "current radio parameters (AT^DRPC?) unreadable")
+	case freqErr != nil || bwErr != nil || !known:
+		pd.Issues = append(pd.Issues, fmt.Sprintf("unexpected radio parameters %s,%s", freq, bandwidth))
+	default:
+		pd.Current = newPlanChannel(f, name)
+		if !rangesContain(pd.usable(false), pd.Current.span()) {
+			pd.Issues = append(pd.Issues, fmt.Sprintf("current channel %d-%d is outside the selected bands", pd.Current.Start, pd.Current.End))
+		} else if len(pd.SubBands) > 0 && !rangesContain(pd.SubBands, pd.Current.span()) {
+			pd.Issues = append(pd.Issues, fmt.Sprintf("current channel %d-%d is outside the sub-band range", pd.Current.Start, pd.Current.End))
+		}
+	}
+	return pd
+}
+
+// usable 设备可以使用的频谱：所选频段；不重新设置子频段时，频段内有子频段范围的只能使用子频段范围
+func (pd *PlanDevice) usable(setSubBands bool) []FrequencyRange {
+	var ranges []FrequencyRange
+	for _, band := range bandSpans(pd.Bands) {
+		var windows []FrequencyRange
+		if !setSubBands {
+			for _, w := range pd.SubBands {
+				if w.overlaps(band) {
+					windows = append(windows, FrequencyRange{Start: max(w.Start, band.Start), End: min(w.End, band.End), Label: band.Label})
+				}
+			}
+		}
+		if len(windows) == 0 {
+			windows = []FrequencyRange{band}
+		}
+		ranges = append(ranges, windows...)
+	}
+	return ranges
+}
+
+// combine 合并网络中各设备的约束：可用频谱取交集，带宽取共同支持的，锁频必须一致
+func (n *NetworkPlan) combine(setSubBands bool) {
+	var allowed []FrequencyRange
+	var bandwidths []string
+	counts := make(map[PlanChannel]int)
+	for i, d := range n.Devices {
+		if i == 0 {
+			allowed = d.usable(setSubBands)
+			bandwidths = d.Bandwidths
+		} else {
+			allowed = intersectRanges(allowed, d.usable(setSubBands))
+			bandwidths = intersectStrings(bandwidths, d.Bandwidths)
+		}
+		if d.LockedFrequency != 0 {
+			if n.locked != 0 && n.locked != d.LockedFrequency {
+				n.Error = fmt.Sprintf("devices are locked to different frequencies (%d and %d)", n.locked, d.LockedFrequency)
+			}
+			n.locked = d.LockedFrequency
+		}
+		if d.Current != nil {
+			counts[*d.Current]++
+		}
+		for _, issue := range d.Issues {
+			n.Issues = append(n.Issues, fmt.Sprintf("%s: %s", d.DeviceName, issue))
+		}
+	}
+	n.Allowed = allowed
+	if n.Allowed == nil {
+		n.Allowed = []FrequencyRange{}
+	}
+	n.bandwidths = bandwidths
+	if n.request.Bandwidth != "" {
+		n.bandwidths = intersectStrings(bandwidths, []string{n.request.Bandwidth})
+	}
+
+	// 当前信道取多数设备使用的信道
+	best := 0
+	for channel, count := range counts {
+		if count > best || (count == best && channel.Frequency < n.Current.Frequency) {
+			c := channel
+			n.Current, best = &c, count
+		}
+	}
+	if len(counts) > 1 {
+		n.Issues = append(n.Issues, fmt.Sprintf("devices use %d different channels", len(counts)))
+	}
+	if n.locked != 0 && n.Current != nil && n.Current.Frequency != n.locked {
+		n.Issues = append(n.Issues, fmt.Sprintf("devices are locked to %d but operate at %d", n.locked, n.Current.Frequency))
+	}
+
+	switch {
+	case n.Error != "":
+	case len(n.Allowed) == 0:
+		n.Error = "the devices have no usable spectrum in common"
+	case len(n.bandwidths) == 0:
+		n.Error = "the devices have no supported bandwidth in common"
+	case n.request.Fixed && n.Current == nil:
+		n.Error = "fixed network has no readable current channel"
+	}
+}
+
+// pinned 固定或锁频的网络先放置
+func (n *NetworkPlan) pinned() bool {
+	return n.request.Fixed || n.locked != 0
+}
+
+// place 为网络选择信道，blocked为已占用的范围（含保护间隔）
+func (n *NetworkPlan) place(blocked []FrequencyRange, req FrequencyPlanRequest) {
+	if n.request.Fixed {
+		n.Proposed = n.Current
+		return
+	}
+	if n.Current != nil && n.fits(n.Current, blocked) && (n.locked == 0 || n.Current.Frequency == n.locked) &&
+		(n.request.Bandwidth == "" || n.request.Bandwidth == n.Current.Bandwidth) {
+		n.Proposed = n.Current
+		return
+	}
+
+	for _, bw := range n.candidateBandwidths() {
+		h := bandwidthHalfWidth[bw]
+		if n.locked != 0 {
+			if c := newPlanChannel(n.locked, bw); n.fits(c, blocked) {
+				n.Proposed = c
+				return
+			}
+			continue
+		}
+		target := 0
+		if n.Current != nil {
+			target = n.Current.Frequency
+		}
+		if freq, ok := nearestCenter(n.Allowed, blocked, h, target); ok {
+			n.Proposed = newPlanChannel(freq, bw)
+			return
+		}
+	}
+	if n.locked != 0 {
+		n.Error = fmt.Sprintf("no free channel at the locked frequency %d", n.locked)
+	} else {
+		n.Error = "no free channel in the usable spectrum"
+	}
+}
+
+// candidateBandwidths 当前带宽及更窄的带宽；没有当前带宽时从宽到窄
+func (n *NetworkPlan) candidateBandwidths() []string {
+	var candidates []string
+	started := n.Current == nil || n.request.Bandwidth != ""
+	for _, bw := range bandwidthOrder {
+		if !started && bw == n.Current.Bandwidth {
+			started = true
+		}
+		if started && containsString(n.bandwidths, bw) {
+			candidates = append(candidates, bw)
+		}
+	}
+	return candidates
+}
+
+func (n *NetworkPlan) fits(c *PlanChannel, blocked []FrequencyRange) bool {
+	if !containsString(n.bandwidths, c.Bandwidth) || !rangesContain(n.Allowed, c.span()) {
+		return false
+	}
+	for _, b := range blocked {
+		if b.overlaps(c.span()) {
+			return false
+		}
+	}
+	return true
+}
+
+// nearestCenter 在可用频谱的空闲部分中找离target最近的中心频点；target为0时取最低的
+func nearestCenter(allowed, blocked []FrequencyRange, half, target int) (int, bool) {
+	best, found := 0, false
+	for _, free := range freeRanges(allowed, blocked) {
+		lo, hi := free.Start+half, free.End-half
+		if lo > hi {
+			continue
+		}
+		center := lo
+		if target > lo {
+			center = min(target, hi)
+		}
+		if !found || abs(center-target) < abs(best-target) {
+			best, found = center, true
+		}
+	}
+	return best, found
+}
+
+// freeRanges 可用频谱减去已占用的范围
+func freeRanges(allowed, blocked []FrequencyRange) []FrequencyRange {
+	sorted := append([]FrequencyRange(nil), blocked...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	var free []FrequencyRange
+	for _, r := range allowed {
+		start := r.Start
+		for _, b := range sorted {
+			if b.End < start || b.Start > r.End {
+				continue
+			}
+			if b.Start > start {
+				free = append(free, FrequencyRange{Start: start, End: b.Start - 1})
+			}
+			start = max(start, b.End+1)
+		}
+		if start <= r.End {
+			free = append(free, FrequencyRange{Start: start, End: r.End})
+		}
+	}
+	return free
+}
+
+// currentConflicts 检查当前分配：网络之间重叠或小于保护间隔、落在排除范围内或超出可用频谱
+func currentConflicts(networks []NetworkPlan, req FrequencyPlanRequest) []FrequencyConflict {
+	conflicts := []FrequencyConflict{}
+	for i := range networks {
+		a := &networks[i]
+		if a.Current == nil {
+			continue
+		}
+		if len(a.Allowed) > 0 && !rangesContain(a.Allowed, a.Current.span()) {
+			conflicts = append(conflicts, FrequencyConflict{Kind: ConflictOutOfBand, Networks: []string{a.Name}, Start: a.Current.Start, End: a.Current.End})
+		}
+		for _, e := range req.Exclusions {
+			if e.overlaps(a.Current.span()) {
+				label := e.Label
+				if label == "" {
+					label = fmt.Sprintf("exclusion %d-%d", e.Start, e.End)
+				}
+				conflicts = append(conflicts, FrequencyConflict{Kind: ConflictExclusion, Networks: []string{a.Name, label},
+					Start: max(e.Start, a.Current.Start), End: min(e.End, a.Current.End)})
+			}
+		}
+		for j := i + 1; j < len(networks); j++ {
+			b := &networks[j]
+			if b.Current == nil {
+				continue
+			}
+			sa, sb := a.Current.span(), b.Current.span()
+			switch {
+			case sa.overlaps(sb):
+				conflicts = append(conflicts, FrequencyConflict{Kind: ConflictOverlap, Networks: []string{a.Name, b.Name},
+					Start: max(sa.Start, sb.Start), End: min(sa.End, sb.End)})
+			case req.Guard > 0 && (FrequencyRange{Start: sa.Start - req.Guard, End: sa.End + req.Guard}).overlaps(sb):
+				gap := FrequencyRange{Start: min(sa.End, sb.End) + 1, End: max(sa.Start, sb.Start) - 1}
+				conflicts = append(conflicts, FrequencyConflict{Kind: ConflictGuard, Networks: []string{a.Name, b.Name}, Start: gap.Start, End: gap.End})
+			}
+		}
+	}
+	return conflicts
+}
+
+// renderChangeSets 生成每台设备应用规划时下发的命令，与分批变更下发的相同
+func (s *FrequencyPlanService) renderChangeSets(n *NetworkPlan) {
+	for i := range n.Devices {
+		d := &n.Devices[i]
+		var planned []PlannedCommand
+		if n.BuildingChain != "" {
+			cmd, err := BuildingChainCommand(n.BuildingChain)
+			if err != nil {
+				d.Issues = append(d.Issues, err.Error())
+				continue
+			}
+			planned = append(planned, cmd)
+		}
+		if n.Changed {
+			power := d.power
+			if power == "" {
+				power = DefaultRadioPower
+			}
+			bw, _ := BandwidthValue(n.Proposed.Bandwidth)
+			planned = append(planned, RadioParamsCommands(n.Proposed.Frequency, bw, power)...)
+		}
+		vctx := &ValidationContext{Bands: d.Bands}
+		commands, _, errs, _ := renderPlannedCommands(s.deviceComm.BoardConfigs(), d.BoardType, vctx, planned)
+		d.Commands = commands
+		d.Issues = append(d.Issues, errs...)
+	}
+}
+
+// parseSubBandWindows 解析AT^DSONSBR?的 band,start,end 三元组
+func parseSubBandWindows(value string) []FrequencyRange {
+	fields := splitFields(strings.NewReplacer("(", "", ")", "").Replace(value))
+	windows := []FrequencyRange{}
+	for i := 0; i+2 < len(fields); i += 3 {
+		start, err1 := strconv.Atoi(fields[i+1])
+		end, err2 := strconv.Atoi(fields[i+2])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		windows = append(windows, FrequencyRange{Start: start, End: end, Label: "band" + fields[i]})
+	}
+	return windows
+}
+
+// bandSpans 频段名称对应的频点范围
+func bandSpans(bands []string) []FrequencyRange {
+	var spans []FrequencyRange
+	for _, fb := range frequencyBands {
+		if containsString(bands, fb.name) {
+			spans = append(spans, FrequencyRange{Start: fb.start, End: fb.end, Label: fb.name})
+		}
+	}
+	return spans
+}
+
+func intersectRanges(a, b []FrequencyRange) []FrequencyRange {
+	var result []FrequencyRange
+	for _, x := range a {
+		for _, y := range b {
+			if x.overlaps(y) {
+				result = append(result, FrequencyRange{Start: max(x.Start, y.Start), End: min(x.End, y.End), Label: x.Label})
+			}
+		}
+	}
+	return result
+}
+
+func rangesContain(ranges []FrequencyRange, r FrequencyRange) bool {
+	for _, x := range ranges {
+		if x.contains(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func rangesWidth(ranges []FrequencyRange) int {
+	width := 0
+	for _, r := range ranges {
+		width += r.End - r.Start + 1
+	}
+	return width
+}
+
+func intersectStrings(a, b []string) []string {
+	result := []string{}
+	for _, x := range a {
+		if containsString(b, x) {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
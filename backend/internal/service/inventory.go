@@ -0,0 +1,578 @@
+package service
+
+import (
+	"backend/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const inventoryWorker = "firmware_inventory"
+
+// ErrInventoryInvalid wraps validation failures of inventory requests.
+var ErrInventoryInvalid = errors.New("invalid inventory request")
+
+// versionPattern splits single-string versions such as "CX660X_1.20.00.R11"
+// or "SK-MESH-V2.0.3" into hardware model and firmware version.
+var versionPattern = regexp.MustCompile(`^(.*?[A-Za-z].*?)[-_ ]+[Vv]?(\d[\w.\-]*)$`)
+
+// VersionInfo is the parsed AT^DGMR? / AT^DUIP? information of a device.
+type VersionInfo struct {
+	HardwareModel   string `json:"hardware_model"`
+	FirmwareVersion string `json:"firmware_version"`
+	SoftwareVersion string `json:"software_version,omitempty"`
+	SerialNumber    string `json:"serial_number,omitempty"`
+	MACAddress      string `json:"mac_address,omitempty"`
+	RawVersion      string `json:"raw_version"`
+}
+
+// InventoryFilter selects devices in fleet queries; empty fields match everything.
+type InventoryFilter struct {
+	BoardType       string
+	HardwareModel   string
+	FirmwareVersion string
+	SerialNumber    string
+}
+
+// InventoryEntry is one device in a fleet query.
+type InventoryEntry struct {
+	model.DeviceInventory
+	DeviceName       string `json:"device_name"`
+	NodeID           string `json:"node_id"`
+	BaselineVersion  string `json:"baseline_version,omitempty"`
+	BaselineMismatch bool   `json:"baseline_mismatch"`
+}
+
+// VersionCount is one row of the version distribution.
+type VersionCount struct {
+	BoardType       string `json:"board_type"`
+	FirmwareVersion string `json:"firmware_version"`
+	Count           int    `json:"count"`
+	DeviceIDs       []uint `json:"device_ids"`
+	Baseline        bool   `json:"baseline"` // this is the approved version of the board type
+}
+
+// VersionDistribution summarises the firmware versions of the fleet.
+type VersionDistribution struct {
+	Versions      []VersionCount `json:"versions"`
+	Total         int            `json:"total"`         // devices with an inventory record
+	Uninventoried []uint         `json:"uninventoried"` // devices never collected
+	Mismatched    int            `json:"mismatched"`    // devices differing from their baseline
+}
+
+// BaselineRequest sets the approved firmware of a board type.
+type BaselineRequest struct {
+	FirmwareVersion string `json:"firmware_version" binding:"required"`
+	Notes           string `json:"notes"`
+}
+
+// InventoryService 设备清单：通过AT^DGMR?和AT^DUIP?记录每台设备的硬件型号、固件和软件版本、序列号，
+// 保留变化历史，提供按版本查询和版本分布统计；固件在两次采集之间发生变化或与单板类型的基线版本
+// 不一致时产生告警
+type InventoryService struct {
+	db           *gorm.DB
+	deviceComm   *DeviceCommService
+	supervisor   *Supervisor
+	interval     time.Duration // 0 disables scheduled scans
+	intervalChan chan time.Duration
+	mu           sync.Mutex
+}
+
+// NewInventoryService 创建设备清单服务
+func NewInventoryService(db *gorm.DB, deviceComm *DeviceCommService, supervisor *Supervisor, interval time.Duration) *InventoryService {
+	return &InventoryService{
+		db:           db,
+		deviceComm:   deviceComm,
+		supervisor:   supervisor,
+		interval:     interval,
+		intervalChan: make(chan time.Duration, 1),
+	}
+}
+
+// Start 在supervisor下启动定时清点
+func (s *InventoryService) Start() {
+	s.supervisor.Go(inventoryWorker, s.loop)
+}
+
+// SetInterval 修改定时清点间隔，为0时停止定时清点
+func (s *InventoryService) SetInterval(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if interval < 0 || interval == s.interval {
+		return
+	}
+	s.interval = interval
+	select {
+	case <-s.intervalChan:
+	default:
+	}
+	s.intervalChan <- interval
+	log.Printf("Firmware inventory interval set to %v", interval)
+}
+
+func (s *InventoryService) loop(ctx context.Context) error {
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	reset := func(interval time.Duration) {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, tick = nil, nil
+		}
+		if interval > 0 {
+			ticker = time.NewTicker(interval)
+			tick = ticker.C
+		}
+	}
+	s.mu.Lock()
+	reset(s.interval)
+	s.mu.Unlock()
+	defer func() { reset(0) }()
+
+	for {
+		select {
+		case <-tick:
+			s.supervisor.Track(inventoryWorker, func() error {
+				_, err := s.Scan(model.InventorySourceScan)
+				return err
+			})
+		case interval := <-s.intervalChan:
+			reset(interval)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Scan 采集所有在线设备，返回成功采集的数量
+func (s *InventoryService) Scan(source string) (int, error) {
+	var devices []model.Device
+	if err := s.db.Where("status = ?", "Online").Order("id").Find(&devices).Error; err != nil {
+		return 0, err
+	}
+	failed := 0
+	for _, device := range devices {
+		if _, err := s.Collect(device.ID, source); err != nil {
+			log.Printf("Firmware inventory of device %d failed: %v", device.ID, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return len(devices) - failed, fmt.Errorf("inventory failed for %d of %d devices", failed, len(devices))
+	}
+	return len(devices), nil
+}
+
+// Collect 读取设备的版本信息并记录；与上次不同的采集写入历史
+func (s *InventoryService) Collect(deviceID uint, source string) (*model.DeviceInventory, error) {
+	device, err := s.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.read(device)
+	if err != nil {
+		now := time.Now()
+		s.db.Model(&model.DeviceInventory{}).Where("device_id = ?", deviceID).
+			Updates(map[string]interface{}{"last_error": err.Error(), "last_error_at": &now})
+		return nil, err
+	}
+	return s.Record(device, info, source)
+}
+
+// read 查询AT^DGMR?；AT^DUIP?只用于补充MAC地址和序列号，失败时忽略
+func (s *InventoryService) read(device *model.Device) (VersionInfo, error) {
+	var info VersionInfo
+	query, err := s.deviceComm.boardConfigMgr.FormatATCommand(device.BoardType, "get_device_info", nil)
+	if err != nil {
+		return info, fmt.Errorf("board %s has no get_device_info command", device.BoardType)
+	}
+	response, err := s.deviceComm.SendATCommand(device.ID, query)
+	if err != nil {
+		return info, err
+	}
+	value, err := extractReportedValue(query, response)
+	if err != nil {
+		return info, err
+	}
+	info = ParseVersionInfo(value)
+
+	if query, err := s.deviceComm.boardConfigMgr.FormatATCommand(device.BoardType, "get_ip_address", nil); err == nil {
+		if response, err := s.deviceComm.SendATCommand(device.ID, query); err == nil {
+			if value, err := extractReportedValue(query, response); err == nil {
+				mac, serial := parseInterfaceIdentity(value)
+				info.MACAddress = mac
+				if info.SerialNumber == "" {
+					info.SerialNumber = serial
+				}
+			}
+		}
+	}
+	return info, nil
+}
+
+// ParseVersionInfo 解析AT^DGMR?的上报值。多字段上报依次为硬件型号、固件版本、软件版本、序列号；
+// 单个版本号（如 CX660X_1.20.00.R11）拆分为型号和固件版本，无法拆分时整体作为固件版本
+func ParseVersionInfo(value string) VersionInfo {
+	value = strings.TrimSpace(value)
+	info := VersionInfo{RawVersion: value}
+	fields := splitFields(value)
+	for i := range fields {
+		fields[i] = strings.Trim(fields[i], `"`)
+	}
+	if len(fields) > 1 {
+		info.HardwareModel, info.FirmwareVersion = fields[0], fields[1]
+		if len(fields) > 2 {
+			info.SoftwareVersion = fields[2]
+		}
+		if len(fields) > 3 {
+			info.SerialNumber = fields[3]
+		}
+		return info
+	}
+	version := strings.Trim(value, `"`)
+	if m := versionPattern.FindStringSubmatch(version); m != nil {
+		info.HardwareModel, info.FirmwareVersion = m[1], m[2]
+	} else {
+		info.FirmwareVersion = version
+	}
+	return info
+}
+
+// parseInterfaceIdentity 从AT^DUIP?上报（如 0,"192.168.1.27",FB880200,"00:01:00:02:88:fb",B140411）
+// 取MAC地址和其后的单板序列号
+func parseInterfaceIdentity(value string) (mac, serial string) {
+	fields := splitFields(value)
+	for i, field := range fields {
+		field = strings.Trim(field, `"`)
+		if hw, err := net.ParseMAC(field); err == nil {
+			mac = hw.String()
+			if i+1 < len(fields) {
+				serial = strings.Trim(fields[i+1], `"`)
+			}
+			return mac, serial
+		}
+	}
+	return "", ""
+}
+
+// Record 保存版本信息：首次记录和有变化的记录写入历史，固件变化和基线不一致时告警
+func (s *InventoryService) Record(device *model.Device, info VersionInfo, source string) (*model.DeviceInventory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var inv model.DeviceInventory
+	err := s.db.Where("device_id = ?", device.ID).First(&inv).Error
+	found := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var changes []string
+	previous := inv.FirmwareVersion
+	if found {
+		for _, f := range []struct{ name, old, new string }{
+			{"hardware_model", inv.HardwareModel, info.HardwareModel},
+			{"firmware_version", inv.FirmwareVersion, info.FirmwareVersion},
+			{"software_version", inv.SoftwareVersion, info.SoftwareVersion},
+			{"serial_number", inv.SerialNumber, info.SerialNumber},
+			{"mac_address", inv.MACAddress, info.MACAddress},
+		} {
+			if f.old != f.new {
+				changes = append(changes, f.name)
+			}
+		}
+	}
+
+	inv.DeviceID = device.ID
+	inv.BoardType = device.BoardType
+	inv.HardwareModel = info.HardwareModel
+	inv.FirmwareVersion = info.FirmwareVersion
+	inv.SoftwareVersion = info.SoftwareVersion
+	inv.SerialNumber = info.SerialNumber
+	inv.MACAddress = info.MACAddress
+	inv.RawVersion = info.RawVersion
+	inv.Source = source
+	inv.CollectedAt = time.Now()
+	inv.LastError = ""
+	inv.LastErrorAt = nil
+	if err := s.db.Save(&inv).Error; err != nil {
+		return nil, err
+	}
+
+	if !found || len(changes) > 0 {
+		history := &model.DeviceInventoryHistory{
+			DeviceID:        device.ID,
+			BoardType:       device.BoardType,
+			HardwareModel:   info.HardwareModel,
+			FirmwareVersion: info.FirmwareVersion,
+			SoftwareVersion: info.SoftwareVersion,
+			SerialNumber:    info.SerialNumber,
+			MACAddress:      info.MACAddress,
+			RawVersion:      info.RawVersion,
+			Changes:         changes,
+			Source:          source,
+		}
+		if found && previous != info.FirmwareVersion {
+			history.PreviousFirmware = previous
+		}
+		if err := s.db.Create(history).Error; err != nil {
+			log.Printf("Failed to record inventory history of device %d: %v", device.ID, err)
+		}
+	}
+
+	if found && previous != info.FirmwareVersion {
+		// 固件升级引起的变化是预期的，只记录日志不告警
+		message := fmt.Sprintf("Firmware of %s upgraded from %s to %s", device.Name, previous, info.FirmwareVersion)
+		if source != model.InventorySourceUpgrade {
+			message = fmt.Sprintf("Firmware of %s changed from %s to %s", device.Name, previous, info.FirmwareVersion)
+			s.raise(device.ID, model.AlertFirmwareChanged, "warning", message)
+		}
+		s.db.Create(&model.DeviceLog{DeviceID: device.ID, Type: "firmware", Message: message, CreatedAt: time.Now()})
+	}
+	s.checkBaseline(device.ID, device.Name, &inv)
+	return &inv, nil
+}
+
+// checkBaseline 固件与单板类型的基线版本不一致时告警，一致或没有基线时关闭告警
+func (s *InventoryService) checkBaseline(deviceID uint, name string, inv *model.DeviceInventory) {
+	var baseline model.FirmwareBaseline
+	if err := s.db.Where("board_type IN ?", boardTypeNames(inv.BoardType)).First(&baseline).Error; err != nil || baseline.FirmwareVersion == inv.FirmwareVersion {
+		s.resolve(deviceID, model.AlertFirmwareBaselineMismatch)
+		return
+	}
+	message := fmt.Sprintf("Firmware of %s is %s, approved baseline for %s is %s", name, inv.FirmwareVersion, inv.BoardType, baseline.FirmwareVersion)
+	s.raise(deviceID, model.AlertFirmwareBaselineMismatch, "critical", message)
+}
+
+// raise 产生告警；同一设备已有相同内容的活动告警时不重复产生，内容不同的旧告警被关闭
+func (s *InventoryService) raise(deviceID uint, alertType, level, message string) {
+	var active []model.MonitorAlert
+	s.db.Where("device_id = ? AND type = ? AND status = ?", deviceID, alertType, "active").Find(&active)
+	for _, a := range active {
+		if a.Message == message {
+			return
+		}
+	}
+	s.resolve(deviceID, alertType)
+	alert := &model.MonitorAlert{DeviceID: deviceID, Type: alertType, Level: level, Message: message, Status: "active"}
+	if err := s.db.Create(alert).Error; err != nil {
+		log.Printf("Failed to raise %s alert for device %d: %v", alertType, deviceID, err)
+	}
+}
+
+func (s *InventoryService) resolve(deviceID uint, alertType string) {
+	now := time.Now()
+	s.db.Model(&model.MonitorAlert{}).
+		Where("device_id = ? AND type = ? AND status = ?", deviceID, alertType, "active").
+		Updates(map[string]interface{}{"status": "resolved", "resolved_at": &now})
+}
+
+// Get 返回设备当前的清单记录
+func (s *InventoryService) Get(deviceID uint) (*model.DeviceInventory, error) {
+	var inv model.DeviceInventory
+	if err := s.db.Where("device_id = ?", deviceID).First(&inv).Error; err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// History 返回设备的清单历史，新的在前
+func (s *InventoryService) History(deviceID uint) ([]model.DeviceInventoryHistory, error) {
+	var history []model.DeviceInventoryHistory
+	err := s.db.Where("device_id = ?", deviceID).Order("id DESC").Find(&history).Error
+	return history, err
+}
+
+// List 按条件查询设备清单，如运行某个版本的所有设备
+func (s *InventoryService) List(filter InventoryFilter) ([]InventoryEntry, error) {
+	query := s.db.Order("device_id")
+	if filter.BoardType != "" {
+		query = query.Where("board_type IN ?", boardTypeNames(filter.BoardType))
+	}
+	if filter.HardwareModel != "" {
+		query = query.Where("hardware_model = ?", filter.HardwareModel)
+	}
+	if filter.FirmwareVersion != "" {
+		query = query.Where("firmware_version = ?", filter.FirmwareVersion)
+	}
+	if filter.SerialNumber != "" {
+		query = query.Where("serial_number = ?", filter.SerialNumber)
+	}
+	var rows []model.DeviceInventory
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	baselines, err := s.baselineVersions()
+	if err != nil {
+		return nil, err
+	}
+	var devices []model.Device
+	if err := s.db.Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]model.Device, len(devices))
+	for _, d := range devices {
+		byID[d.ID] = d
+	}
+
+	entries := make([]InventoryEntry, 0, len(rows))
+	for _, row := range rows {
+		d, ok := byID[row.DeviceID]
+		if !ok {
+			continue // device deleted
+		}
+		entry := InventoryEntry{DeviceInventory: row, DeviceName: d.Name, NodeID: d.NodeID}
+		if version, ok := baselines[strings.TrimPrefix(row.BoardType, "board_")]; ok {
+			entry.BaselineVersion = version
+			entry.BaselineMismatch = version != row.FirmwareVersion
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Distribution 统计每种单板类型下各固件版本的设备数量
+func (s *InventoryService) Distribution(boardType string) (*VersionDistribution, error) {
+	entries, err := s.List(InventoryFilter{BoardType: boardType})
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[[2]string]*VersionCount)
+	dist := &VersionDistribution{Versions: []VersionCount{}, Uninventoried: []uint{}}
+	inventoried := make(map[uint]bool)
+	for _, e := range entries {
+		key := [2]string{e.BoardType, e.FirmwareVersion}
+		c, ok := counts[key]
+		if !ok {
+			c = &VersionCount{BoardType: e.BoardType, FirmwareVersion: e.FirmwareVersion, Baseline: e.BaselineVersion != "" && !e.BaselineMismatch}
+			counts[key] = c
+		}
+		c.Count++
+		c.DeviceIDs = append(c.DeviceIDs, e.DeviceID)
+		inventoried[e.DeviceID] = true
+		if e.BaselineMismatch {
+			dist.Mismatched++
+		}
+	}
+	for _, c := range counts {
+		dist.Versions = append(dist.Versions, *c)
+	}
+	sort.Slice(dist.Versions, func(i, j int) bool {
+		a, b := dist.Versions[i], dist.Versions[j]
+		if a.BoardType != b.BoardType {
+			return a.BoardType < b.BoardType
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.FirmwareVersion < b.FirmwareVersion
+	})
+	dist.Total = len(entries)
+
+	var devices []model.Device
+	query := s.db.Order("id")
+	if boardType != "" {
+		query = query.Where("board_type IN ?", boardTypeNames(boardType))
+	}
+	if err := query.Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	for _, d := range devices {
+		if !inventoried[d.ID] {
+			dist.Uninventoried = append(dist.Uninventoried, d.ID)
+		}
+	}
+	return dist, nil
+}
+
+// Alerts 返回固件相关的告警，status为空时返回全部
+func (s *InventoryService) Alerts(status string) ([]model.MonitorAlert, error) {
+	var alerts []model.MonitorAlert
+	query := s.db.Where("type IN ?", []string{model.AlertFirmwareChanged, model.AlertFirmwareBaselineMismatch})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("created_at DESC").Find(&alerts).Error
+	return alerts, err
+}
+
+// ListBaselines 返回所有单板类型的基线版本
+func (s *InventoryService) ListBaselines() ([]model.FirmwareBaseline, error) {
+	var baselines []model.FirmwareBaseline
+	err := s.db.Order("board_type").Find(&baselines).Error
+	return baselines, err
+}
+
+// SetBaseline 设置单板类型的基线版本，并按已记录的清单重新检查该类型的设备
+func (s *InventoryService) SetBaseline(boardType string, req BaselineRequest, approvedBy string) (*model.FirmwareBaseline, error) {
+	req.FirmwareVersion = strings.TrimSpace(req.FirmwareVersion)
+	if req.FirmwareVersion == "" {
+		return nil, fmt.Errorf("%w: firmware_version is required", ErrInventoryInvalid)
+	}
+	if _, err := s.deviceComm.boardConfigMgr.GetBoardConfig(boardType); err != nil {
+		return nil, fmt.Errorf("%w: unknown board type %s", ErrInventoryInvalid, boardType)
+	}
+
+	// 设备的单板类型可能带或不带"board_"前缀，基线统一保存为不带前缀的写法
+	var baseline model.FirmwareBaseline
+	err := s.db.Where("board_type IN ?", boardTypeNames(boardType)).First(&baseline).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	baseline.BoardType = strings.TrimPrefix(boardType, "board_")
+	baseline.FirmwareVersion = req.FirmwareVersion
+	baseline.Notes = req.Notes
+	baseline.ApprovedBy = approvedBy
+	if err := s.db.Save(&baseline).Error; err != nil {
+		return nil, err
+	}
+	s.recheck(boardType)
+	return &baseline, nil
+}
+
+// DeleteBaseline 删除单板类型的基线版本并关闭相关告警
+func (s *InventoryService) DeleteBaseline(boardType string) error {
+	res := s.db.Where("board_type IN ?", boardTypeNames(boardType)).Delete(&model.FirmwareBaseline{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	s.recheck(boardType)
+	return nil
+}
+
+func (s *InventoryService) recheck(boardType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows []model.DeviceInventory
+	s.db.Where("board_type IN ?", boardTypeNames(boardType)).Find(&rows)
+	for i := range rows {
+		var device model.Device
+		if err := s.db.First(&device, rows[i].DeviceID).Error; err != nil {
+			continue
+		}
+		s.checkBaseline(device.ID, device.Name, &rows[i])
+	}
+}
+
+func (s *InventoryService) baselineVersions() (map[string]string, error) {
+	baselines, err := s.ListBaselines()
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[string]string, len(baselines))
+	for _, b := range baselines {
+		versions[strings.TrimPrefix(b.BoardType, "board_")] = b.FirmwareVersion
+	}
+	return versions, nil
+}
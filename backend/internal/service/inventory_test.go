@@ -0,0 +1,81 @@
+package service
+
+import "testing"
+
+func TestParseVersionInfo(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  VersionInfo
+	}{
+		{
+			name:  "model and version joined by underscore",
+			value: "CX660X_1.20.00.R11",
+			want:  VersionInfo{HardwareModel: "CX660X", FirmwareVersion: "1.20.00.R11"},
+		},
+		{
+			name:  "dashed model with v prefix",
+			value: "SK-MESH-V2.0.3",
+			want:  VersionInfo{HardwareModel: "SK-MESH", FirmwareVersion: "2.0.3"},
+		},
+		{
+			name:  "quoted with spaces",
+			value: ` "CX6600 v1.2.3" `,
+			want:  VersionInfo{HardwareModel: "CX6600", FirmwareVersion: "1.2.3"},
+		},
+		{
+			name:  "bare version has no model",
+			value: `"1.20.00"`,
+			want:  VersionInfo{FirmwareVersion: "1.20.00"},
+		},
+		{
+			name:  "unsplittable version kept whole",
+			value: "RELEASE",
+			want:  VersionInfo{FirmwareVersion: "RELEASE"},
+		},
+		{
+			name:  "model and firmware fields",
+			value: `"CX6600","1.20.00"`,
+			want:  VersionInfo{HardwareModel: "CX6600", FirmwareVersion: "1.20.00"},
+		},
+		{
+			name:  "all four fields",
+			value: `"CX6600", "1.20.00", "SW2.1", "B140411"`,
+			want:  VersionInfo{HardwareModel: "CX6600", FirmwareVersion: "1.20.00", SoftwareVersion: "SW2.1", SerialNumber: "B140411"},
+		},
+		{
+			name:  "empty",
+			value: "",
+			want:  VersionInfo{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseVersionInfo(tt.value)
+			got.RawVersion = ""
+			if got != tt.want {
+				t.Errorf("ParseVersionInfo(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInterfaceIdentity(t *testing.T) {
+	tests := []struct {
+		value      string
+		wantMAC    string
+		wantSerial string
+	}{
+		{value: `0,"192.168.1.27",FB880200,"00:01:00:02:88:fb",B140411`, wantMAC: "00:01:00:02:88:fb", wantSerial: "B140411"},
+		{value: `0,"192.168.1.27",FB880200,"00-01-00-02-88-FB"`, wantMAC: "00:01:00:02:88:fb"},
+		{value: `0,"192.168.1.27",FB880200`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			mac, serial := parseInterfaceIdentity(tt.value)
+			if mac != tt.wantMAC || serial != tt.wantSerial {
+				t.Errorf("parseInterfaceIdentity = (%q, %q), want (%q, %q)", mac, serial, tt.wantMAC, tt.wantSerial)
+			}
+		})
+	}
+}
@@ -0,0 +1,1007 @@
+package service
+
+import (
+	"backend/internal/model"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Address conflict kinds
+const (
+	AddressDuplicate   = "duplicate"     // two devices use the same address
+	AddressOutOfSubnet = "out_of_subnet" // outside the subnet of the device's network
+	AddressReserved    = "reserved"      // network, broadcast, gateway or reserved address
+	AddressMismatch    = "mismatch"      // the device reports another address than the DB
+	AddressUnreadable  = "unreadable"    // AT^DUIP? failed
+)
+
+const (
+	ipamVerifyTimeout  = 30 * time.Second
+	ipamVerifyInterval = 2 * time.Second
+)
+
+var (
+	// ErrIPAMInvalid is returned for a subnet or address request that cannot be served.
+	ErrIPAMInvalid = errors.New("invalid address request")
+	// ErrIPAMConflict is returned when an address is already used or not allowed.
+	ErrIPAMConflict = errors.New("address conflict")
+	// ErrIPAMExhausted is returned when a subnet has no free address left.
+	ErrIPAMExhausted = errors.New("no free address in subnet")
+)
+
+// IPSubnetRequest creates or updates a subnet.
+type IPSubnetRequest struct {
+	Name        string   `json:"name"`
+	CIDR        string   `json:"cidr"`
+	Gateway     string   `json:"gateway"`
+	RangeStart  string   `json:"range_start"`
+	RangeEnd    string   `json:"range_end"`
+	Reserved    []string `json:"reserved"`
+	DeviceIDs   []uint   `json:"device_ids"`
+	Description string   `json:"description"`
+}
+
+// IPSubnetUsage is a subnet together with its allocations.
+type IPSubnetUsage struct {
+	model.IPSubnet
+	Mask        string               `json:"mask"`
+	Size        int                  `json:"size"` // addresses in the allocation range
+	Free        int                  `json:"free"`
+	Allocations []model.IPAllocation `json:"allocations"`
+}
+
+// IPAssignRequest assigns an address of a subnet to a device.
+type IPAssignRequest struct {
+	SubnetID uint   `json:"subnet_id"` // 默认为设备所属的子网
+	IP       string `json:"ip"`        // 默认为已分配的地址或下一个空闲地址
+	DryRun   bool   `json:"dry_run"`
+}
+
+// IPAssignResult reports the re-addressing of one device.
+type IPAssignResult struct {
+	DeviceID             uint                   `json:"device_id"`
+	SubnetID             uint                   `json:"subnet_id"`
+	Subnet               string                 `json:"subnet"`
+	PreviousIP           string                 `json:"previous_ip,omitempty"` // interface address before the change
+	IP                   string                 `json:"ip"`
+	Mask                 string                 `json:"mask"`
+	Gateway              string                 `json:"gateway,omitempty"`
+	PreviousManagementIP string                 `json:"previous_management_ip"`
+	ManagementIP         string                 `json:"management_ip"` // model.Device.IP after the change
+	Commands             []model.PreviewCommand `json:"commands,omitempty"`
+	Sent                 []model.AuditCommand   `json:"sent,omitempty"`
+	Verified             bool                   `json:"verified"`
+	Allocation           *model.IPAllocation    `json:"allocation,omitempty"`
+	DryRun               bool                   `json:"dry_run,omitempty"`
+	Error                string                 `json:"error,omitempty"`
+}
+
+// DeviceAddress is what the DB and the device say about one device's address.
+type DeviceAddress struct {
+	DeviceID     uint   `json:"device_id"`
+	Name         string `json:"name"`
+	NodeID       string `json:"node_id"`
+	SubnetID     uint   `json:"subnet_id,omitempty"`
+	Subnet       string `json:"subnet,omitempty"`
+	ManagementIP string `json:"management_ip"`           // model.Device.IP, may carry a port
+	ConfiguredIP string `json:"configured_ip,omitempty"` // saved net_setting address
+	AllocatedIP  string `json:"allocated_ip,omitempty"`
+	LiveIP       string `json:"live_ip,omitempty"` // AT^DUIP?
+	Error        string `json:"error,omitempty"`
+}
+
+// AddressConflict is one problem found by the address scan.
+type AddressConflict struct {
+	Kind      string `json:"kind"`
+	Address   string `json:"address"`
+	Source    string `json:"source"` // management, db or live
+	DeviceIDs []uint `json:"device_ids"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// AddressReport is the result of a fleet address scan.
+type AddressReport struct {
+	Live      bool              `json:"live"`
+	Devices   []DeviceAddress   `json:"devices"`
+	Conflicts []AddressConflict `json:"conflicts"`
+}
+
+// IPAMService 自组网IP地址管理：按网络划分子网，设备入网时自动分配节点地址并通过
+// AT^NETIFCFG下发，结合数据库与AT^DUIP?的实时上报检查地址冲突；节点改址后同步
+// model.Device.IP，避免管理端失去设备
+type IPAMService struct {
+	db         *gorm.DB
+	deviceComm *DeviceCommService
+	audit      *AuditService
+
+	mu sync.Mutex // serializes allocations
+}
+
+// NewIPAMService 创建IP地址管理服务
+func NewIPAMService(db *gorm.DB, deviceComm *DeviceCommService, audit *AuditService) *IPAMService {
+	return &IPAMService{
+		db:         db,
+		deviceComm: deviceComm,
+		audit:      audit,
+	}
+}
+
+// ListSubnets 返回所有子网及其地址使用情况
+func (s *IPAMService) ListSubnets() ([]IPSubnetUsage, error) {
+	var subnets []model.IPSubnet
+	if err := s.db.Order("id").Find(&subnets).Error; err != nil {
+		return nil, err
+	}
+	result := make([]IPSubnetUsage, 0, len(subnets))
+	for _, subnet := range subnets {
+		usage, err := s.usage(subnet)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *usage)
+	}
+	return result, nil
+}
+
+// GetSubnet 返回一个子网及其地址使用情况
+func (s *IPAMService) GetSubnet(id uint) (*IPSubnetUsage, error) {
+	var subnet model.IPSubnet
+	if err := s.db.First(&subnet, id).Error; err != nil {
+		return nil, err
+	}
+	return s.usage(subnet)
+}
+
+// CreateSubnet 创建子网。子网不能与已有子网重叠，设备只能属于一个子网
+func (s *IPAMService) CreateSubnet(req IPSubnetRequest) (*IPSubnetUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subnet := model.IPSubnet{}
+	if err := s.applySubnetRequest(&subnet, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(&subnet).Error; err != nil {
+		return nil, err
+	}
+	return s.usage(subnet)
+}
+
+// UpdateSubnet 修改子网；已分配的地址必须仍在新的分配范围内
+func (s *IPAMService) UpdateSubnet(id uint, req IPSubnetRequest) (*IPSubnetUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var subnet model.IPSubnet
+	if err := s.db.First(&subnet, id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.applySubnetRequest(&subnet, req); err != nil {
+		return nil, err
+	}
+	plan, _ := parseSubnet(subnet)
+	var allocations []model.IPAllocation
+	if err := s.db.Where("subnet_id = ?", id).Find(&allocations).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range allocations {
+		if reason := plan.reject(a.IP); reason != "" {
+			return nil, fmt.Errorf("%w: device %d keeps %s, which would be %s", ErrIPAMConflict, a.DeviceID, a.IP, reason)
+		}
+		if !containsID(subnet.DeviceIDs, a.DeviceID) {
+			subnet.DeviceIDs = append(subnet.DeviceIDs, a.DeviceID)
+		}
+	}
+	if err := s.db.Save(&subnet).Error; err != nil {
+		return nil, err
+	}
+	return s.usage(subnet)
+}
+
+// DeleteSubnet 删除子网及其地址分配；设备上已配置的地址不变
+func (s *IPAMService) DeleteSubnet(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&model.IPSubnet{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("subnet_id = ?", id).Delete(&model.IPAllocation{}).Error
+	})
+}
+
+// applySubnetRequest 校验请求并写入subnet（不保存）
+func (s *IPAMService) applySubnetRequest(subnet *model.IPSubnet, req IPSubnetRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrIPAMInvalid)
+	}
+	_, ipnet, err := net.ParseCIDR(strings.TrimSpace(req.CIDR))
+	if err != nil || ipnet.IP.To4() == nil {
+		return fmt.Errorf("%w: %q is not an IPv4 CIDR", ErrIPAMInvalid, req.CIDR)
+	}
+	if ones, _ := ipnet.Mask.Size(); ones > 30 {
+		return fmt.Errorf("%w: %s leaves no room for node addresses", ErrIPAMInvalid, ipnet)
+	}
+	next := model.IPSubnet{
+		ID:          subnet.ID,
+		Name:        req.Name,
+		CIDR:        ipnet.String(),
+		Gateway:     strings.TrimSpace(req.Gateway),
+		RangeStart:  strings.TrimSpace(req.RangeStart),
+		RangeEnd:    strings.TrimSpace(req.RangeEnd),
+		DeviceIDs:   sortedIDs(uniqueIDs(req.DeviceIDs)),
+		Description: req.Description,
+		CreatedAt:   subnet.CreatedAt,
+	}
+	for _, r := range req.Reserved {
+		if r = strings.TrimSpace(r); r != "" {
+			next.Reserved = append(next.Reserved, r)
+		}
+	}
+	if _, err := parseSubnet(next); err != nil {
+		return err
+	}
+
+	var others []model.IPSubnet
+	if err := s.db.Where("id <> ?", subnet.ID).Find(&others).Error; err != nil {
+		return err
+	}
+	for _, o := range others {
+		if o.Name == next.Name {
+			return fmt.Errorf("%w: subnet %q already exists", ErrIPAMConflict, o.Name)
+		}
+		if _, onet, err := net.ParseCIDR(o.CIDR); err == nil && (onet.Contains(ipnet.IP) || ipnet.Contains(onet.IP)) {
+			return fmt.Errorf("%w: %s overlaps subnet %q (%s)", ErrIPAMConflict, next.CIDR, o.Name, o.CIDR)
+		}
+		for _, id := range next.DeviceIDs {
+			if containsID(o.DeviceIDs, id) {
+				return fmt.Errorf("%w: device %d already belongs to subnet %q", ErrIPAMConflict, id, o.Name)
+			}
+		}
+	}
+	if len(next.DeviceIDs) > 0 {
+		var count int64
+		if err := s.db.Model(&model.Device{}).Where("id IN ?", next.DeviceIDs).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(next.DeviceIDs) {
+			return fmt.Errorf("%w: unknown device in device_ids", ErrIPAMInvalid)
+		}
+	}
+	*subnet = next
+	return nil
+}
+
+func (s *IPAMService) usage(subnet model.IPSubnet) (*IPSubnetUsage, error) {
+	plan, err := parseSubnet(subnet)
+	if err != nil {
+		return nil, err
+	}
+	var allocations []model.IPAllocation
+	if err := s.db.Where("subnet_id = ?", subnet.ID).Order("device_id").Find(&allocations).Error; err != nil {
+		return nil, err
+	}
+	used, err := s.usedAddresses(0)
+	if err != nil {
+		return nil, err
+	}
+	usage := &IPSubnetUsage{IPSubnet: subnet, Mask: plan.mask(), Size: int(plan.end - plan.start + 1), Allocations: allocations}
+	for a := plan.start; a <= plan.end; a++ {
+		if plan.reject(uint32ToIP(a).String()) == "" && used[uint32ToIP(a).String()] == 0 {
+			usage.Free++
+		}
+	}
+	return usage, nil
+}
+
+// SubnetOf 返回设备所属的子网：有分配记录时以分配为准，否则查找device_ids包含该设备的子网
+func (s *IPAMService) SubnetOf(deviceID uint) (*model.IPSubnet, error) {
+	var allocation model.IPAllocation
+	err := s.db.Where("device_id = ?", deviceID).First(&allocation).Error
+	if err == nil {
+		var subnet model.IPSubnet
+		if err := s.db.First(&subnet, allocation.SubnetID).Error; err == nil {
+			return &subnet, nil
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	var subnets []model.IPSubnet
+	if err := s.db.Find(&subnets).Error; err != nil {
+		return nil, err
+	}
+	for i := range subnets {
+		if containsID(subnets[i].DeviceIDs, deviceID) {
+			return &subnets[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// NextAddress 返回子网中下一个空闲地址，不做分配
+func (s *IPAMService) NextAddress(subnetID uint) (string, error) {
+	var subnet model.IPSubnet
+	if err := s.db.First(&subnet, subnetID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fmt.Errorf("%w: subnet %d not found", ErrIPAMInvalid, subnetID)
+		}
+		return "", err
+	}
+	return s.nextFree(subnet, 0)
+}
+
+func (s *IPAMService) nextFree(subnet model.IPSubnet, deviceID uint) (string, error) {
+	plan, err := parseSubnet(subnet)
+	if err != nil {
+		return "", err
+	}
+	used, err := s.usedAddresses(deviceID)
+	if err != nil {
+		return "", err
+	}
+	for a := plan.start; a <= plan.end; a++ {
+		ip := uint32ToIP(a).String()
+		if plan.reject(ip) == "" && used[ip] == 0 {
+			return ip, nil
+		}
+	}
+	return "", fmt.Errorf("%w %q", ErrIPAMExhausted, subnet.Name)
+}
+
+// usedAddresses 返回除exclude外各设备占用的地址：分配记录、已保存的接口地址和管理地址
+func (s *IPAMService) usedAddresses(exclude uint) (map[string]uint, error) {
+	used := map[string]uint{}
+	var allocations []model.IPAllocation
+	if err := s.db.Find(&allocations).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range allocations {
+		if a.DeviceID != exclude {
+			used[a.IP] = a.DeviceID
+		}
+	}
+	var configs []model.NetworkConfig
+	if err := s.db.Find(&configs).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range configs {
+		if c.DeviceID != exclude && c.IP != "" {
+			used[c.IP] = c.DeviceID
+		}
+	}
+	var devices []model.Device
+	if err := s.db.Select("id", "ip").Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	for _, d := range devices {
+		if host := addressHost(d.IP); d.ID != exclude && host != "" {
+			used[host] = d.ID
+		}
+	}
+	return used, nil
+}
+
+// ValidateAddress 检查手工为设备设置的接口地址：不能与其他设备的地址重复；
+// 设备属于某个子网时，地址须在子网内且不是网络、广播、网关或保留地址，掩码须与子网一致
+func (s *IPAMService) ValidateAddress(deviceID uint, ip, mask string) error {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil || parsed.To4() == nil {
+		return fmt.Errorf("%w: %q is not an IPv4 address", ErrIPAMInvalid, ip)
+	}
+	ip = parsed.To4().String()
+	used, err := s.usedAddresses(deviceID)
+	if err != nil {
+		return err
+	}
+	if owner, ok := used[ip]; ok {
+		return fmt.Errorf("%w: %s is already used by device %d", ErrIPAMConflict, ip, owner)
+	}
+	subnet, err := s.SubnetOf(deviceID)
+	if err != nil || subnet == nil {
+		return err
+	}
+	plan, err := parseSubnet(*subnet)
+	if err != nil {
+		return err
+	}
+	if !plan.network.Contains(parsed) {
+		return fmt.Errorf("%w: %s is outside subnet %q (%s)", ErrIPAMConflict, ip, subnet.Name, subnet.CIDR)
+	}
+	if reason := plan.hostReason(ip); reason != "" {
+		return fmt.Errorf("%w: %s is the %s of subnet %q", ErrIPAMConflict, ip, reason, subnet.Name)
+	}
+	if mask != "" && mask != plan.mask() {
+		return fmt.Errorf("%w: subnet mask %s does not match subnet %q (%s)", ErrIPAMConflict, mask, subnet.Name, plan.mask())
+	}
+	return nil
+}
+
+// Onboard 为新入网的设备从子网分配地址。未提供管理地址时以分配的地址作为管理地址，
+// 设备可达时立即通过AT^NETIFCFG下发，否则分配保持pending，设备上线后再调用Assign下发
+func (s *IPAMService) Onboard(actor AuditActor, deviceID, subnetID uint) (*IPAssignResult, error) {
+	allocation, subnet, err := s.allocate(deviceID, subnetID, "")
+	if err != nil {
+		return nil, err
+	}
+	device, err := s.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device.IP == "" {
+		if err := s.db.Model(&model.Device{}).Where("id = ?", deviceID).Update("ip", allocation.IP).Error; err != nil {
+			return nil, err
+		}
+		device.IP = allocation.IP
+	}
+	if !isDeviceReachable(device.IP, "80", 3*time.Second) {
+		plan, _ := parseSubnet(*subnet)
+		return &IPAssignResult{
+			DeviceID:             deviceID,
+			SubnetID:             subnet.ID,
+			Subnet:               subnet.Name,
+			IP:                   allocation.IP,
+			Mask:                 plan.mask(),
+			Gateway:              subnet.Gateway,
+			PreviousManagementIP: device.IP,
+			ManagementIP:         device.IP,
+			Allocation:           allocation,
+			Error:                "device is unreachable; the address stays pending until it is assigned",
+		}, nil
+	}
+	return s.Assign(actor, deviceID, IPAssignRequest{SubnetID: subnet.ID, IP: allocation.IP})
+}
+
+// Assign 将子网地址下发到设备：AT^NETIFCFG设置地址、掩码和网关后，若设备经该接口管理
+// （Device.IP的主机部分为原接口地址）则同步更新Device.IP，再以AT^DUIP?确认新地址。
+// 新地址无法确认而原地址仍可访问时恢复原管理地址
+func (s *IPAMService) Assign(actor AuditActor, deviceID uint, req IPAssignRequest) (*IPAssignResult, error) {
+	device, err := s.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	subnetID := req.SubnetID
+	if subnetID == 0 {
+		subnet, err := s.SubnetOf(deviceID)
+		if err != nil {
+			return nil, err
+		}
+		if subnet == nil {
+			return nil, fmt.Errorf("%w: device %d belongs to no subnet, subnet_id is required", ErrIPAMInvalid, deviceID)
+		}
+		subnetID = subnet.ID
+	}
+
+	var subnet *model.IPSubnet
+	var allocation *model.IPAllocation
+	if req.DryRun {
+		var ip string
+		if subnet, ip, err = s.pick(deviceID, subnetID, req.IP); err != nil {
+			return nil, err
+		}
+		allocation = &model.IPAllocation{SubnetID: subnet.ID, DeviceID: deviceID, IP: ip, Status: model.IPAllocationPending}
+	} else if allocation, subnet, err = s.allocate(deviceID, subnetID, req.IP); err != nil {
+		return nil, err
+	}
+	plan, _ := parseSubnet(*subnet)
+	result := &IPAssignResult{
+		DeviceID:             deviceID,
+		SubnetID:             subnet.ID,
+		Subnet:               subnet.Name,
+		IP:                   allocation.IP,
+		Mask:                 plan.mask(),
+		Gateway:              subnet.Gateway,
+		PreviousManagementIP: device.IP,
+		ManagementIP:         device.IP,
+		Allocation:           allocation,
+		DryRun:               req.DryRun,
+	}
+
+	cfg := model.NetworkConfig{DeviceID: deviceID, IP: allocation.IP, SubnetMask: result.Mask, Gateway: subnet.Gateway}
+	commands, _, errs, _ := renderPlannedCommands(s.deviceComm.boardConfigMgr, device.BoardType, s.deviceComm.ValidationContext(deviceID), netSettingCommands(cfg))
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrIPAMInvalid, strings.Join(errs, "; "))
+	}
+	result.Commands = commands
+	if previous, err := readInterfaceAddress(s.deviceComm, device); err == nil {
+		result.PreviousIP = previous
+	} else {
+		var stored model.NetworkConfig
+		if s.db.Where("device_id = ?", deviceID).First(&stored).Error == nil {
+			result.PreviousIP = stored.IP
+		}
+	}
+	if req.DryRun {
+		return result, nil
+	}
+
+	entry := &model.ConfigAudit{
+		DeviceID: deviceID,
+		Category: ConfigCategoryNetSetting,
+		Action:   model.AuditActionReaddress,
+		Changes:  []model.PreviewChange{{Key: "ip", From: result.PreviousIP, To: allocation.IP}},
+		Details:  fmt.Sprintf("subnet %s (%s)", subnet.Name, subnet.CIDR),
+	}
+	defer func() {
+		entry.Commands = result.Sent
+		entry.Error = result.Error
+		if result.ManagementIP != result.PreviousManagementIP {
+			entry.Changes = append(entry.Changes, model.PreviewChange{Key: "management_ip", From: result.PreviousManagementIP, To: result.ManagementIP})
+		}
+		s.audit.Record(actor, entry)
+	}()
+
+	for _, cmd := range commands {
+		response, err := s.deviceComm.SendATCommand(deviceID, cmd.Command)
+		if err != nil {
+			result.Sent = append(result.Sent, model.AuditCommand{Name: cmd.Name, Command: cmd.Command, Status: StepFailed, Error: err.Error()})
+			result.Error = fmt.Sprintf("%s failed: %v", cmd.Name, err)
+			s.markAllocation(allocation, model.IPAllocationPending, result.Error)
+			return result, nil
+		}
+		result.Sent = append(result.Sent, model.AuditCommand{Name: cmd.Name, Command: cmd.Command, Status: StepApplied, Response: response})
+	}
+
+	managementIP, err := recordDeviceAddress(s.db, deviceID, result.PreviousIP, allocation.IP)
+	if err != nil {
+		log.Printf("IPAM: failed to record new address of device %d: %v", deviceID, err)
+	}
+	result.ManagementIP = managementIP
+	device.IP = managementIP
+
+	deadline := time.Now().Add(ipamVerifyTimeout)
+	for {
+		live, err := readInterfaceAddress(s.deviceComm, device)
+		if err == nil && live == allocation.IP {
+			result.Verified = true
+			break
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				result.Error = fmt.Sprintf("new address not confirmed: %v", err)
+			} else {
+				result.Error = fmt.Sprintf("device still reports %s", live)
+			}
+			break
+		}
+		time.Sleep(ipamVerifyInterval)
+	}
+
+	if !result.Verified {
+		if managementIP != result.PreviousManagementIP {
+			old := *device
+			old.IP = result.PreviousManagementIP
+			if _, err := readInterfaceAddress(s.deviceComm, &old); err == nil {
+				// 设备仍在原地址上应答：新地址未生效，恢复原管理地址
+				s.db.Model(&model.Device{}).Where("id = ?", deviceID).Update("ip", result.PreviousManagementIP)
+				result.ManagementIP = result.PreviousManagementIP
+				result.Error += "; device still answers at its previous address, management address restored"
+			}
+		}
+		s.markAllocation(allocation, model.IPAllocationPending, result.Error)
+		return result, nil
+	}
+
+	s.markAllocation(allocation, model.IPAllocationAssigned, "")
+	if err := s.db.Save(&cfg).Error; err != nil {
+		log.Printf("IPAM: failed to save net_setting of device %d: %v", deviceID, err)
+	}
+	return result, nil
+}
+
+func (s *IPAMService) markAllocation(allocation *model.IPAllocation, status, errText string) {
+	allocation.Status = status
+	allocation.Error = errText
+	if err := s.db.Model(allocation).Updates(map[string]interface{}{"status": status, "error": errText}).Error; err != nil {
+		log.Printf("IPAM: failed to update allocation of device %d: %v", allocation.DeviceID, err)
+	}
+}
+
+// pick 选择设备在子网中的地址：指定的地址、已有的分配或下一个空闲地址
+func (s *IPAMService) pick(deviceID, subnetID uint, requested string) (*model.IPSubnet, string, error) {
+	var subnet model.IPSubnet
+	if err := s.db.First(&subnet, subnetID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", fmt.Errorf("%w: subnet %d not found", ErrIPAMInvalid, subnetID)
+		}
+		return nil, "", err
+	}
+	var others []model.IPSubnet
+	if err := s.db.Where("id <> ?", subnet.ID).Find(&others).Error; err != nil {
+		return nil, "", err
+	}
+	for _, o := range others {
+		if containsID(o.DeviceIDs, deviceID) {
+			return nil, "", fmt.Errorf("%w: device %d belongs to subnet %q", ErrIPAMConflict, deviceID, o.Name)
+		}
+	}
+	plan, err := parseSubnet(subnet)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if requested = strings.TrimSpace(requested); requested != "" {
+		parsed := net.ParseIP(requested)
+		if parsed == nil || parsed.To4() == nil {
+			return nil, "", fmt.Errorf("%w: %q is not an IPv4 address", ErrIPAMInvalid, requested)
+		}
+		requested = parsed.To4().String()
+		if reason := plan.reject(requested); reason != "" {
+			return nil, "", fmt.Errorf("%w: %s is %s", ErrIPAMConflict, requested, reason)
+		}
+		used, err := s.usedAddresses(deviceID)
+		if err != nil {
+			return nil, "", err
+		}
+		if owner, ok := used[requested]; ok {
+			return nil, "", fmt.Errorf("%w: %s is already used by device %d", ErrIPAMConflict, requested, owner)
+		}
+		return &subnet, requested, nil
+	}
+
+	var existing model.IPAllocation
+	if err := s.db.Where("device_id = ? AND subnet_id = ?", deviceID, subnet.ID).First(&existing).Error; err == nil {
+		return &subnet, existing.IP, nil
+	}
+	ip, err := s.nextFree(subnet, deviceID)
+	return &subnet, ip, err
+}
+
+// allocate 选择地址并保存分配记录，同时将设备加入子网
+func (s *IPAMService) allocate(deviceID, subnetID uint, requested string) (*model.IPAllocation, *model.IPSubnet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subnet, ip, err := s.pick(deviceID, subnetID, requested)
+	if err != nil {
+		return nil, nil, err
+	}
+	allocation := model.IPAllocation{}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("device_id = ?", deviceID).First(&allocation).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if allocation.ID == 0 || allocation.SubnetID != subnet.ID || allocation.IP != ip {
+			allocation.Status = model.IPAllocationPending
+			allocation.Error = ""
+		}
+		allocation.SubnetID, allocation.DeviceID, allocation.IP = subnet.ID, deviceID, ip
+		if err := tx.Save(&allocation).Error; err != nil {
+			return err
+		}
+		if !containsID(subnet.DeviceIDs, deviceID) {
+			subnet.DeviceIDs = append(subnet.DeviceIDs, deviceID)
+			return tx.Save(subnet).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &allocation, subnet, nil
+}
+
+// Scan 检查所有设备的地址：管理地址重复、接口地址重复、不在所属子网内或占用网络/广播/网关/保留地址。
+// live为true时并行读取AT^DUIP?，以设备上报的地址参与检查，并报告与数据库不一致和无法读取的设备
+func (s *IPAMService) Scan(live bool) (*AddressReport, error) {
+	var devices []model.Device
+	if err := s.db.Order("id").Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	var subnets []model.IPSubnet
+	if err := s.db.Find(&subnets).Error; err != nil {
+		return nil, err
+	}
+	var allocations []model.IPAllocation
+	if err := s.db.Find(&allocations).Error; err != nil {
+		return nil, err
+	}
+	var configs []model.NetworkConfig
+	if err := s.db.Find(&configs).Error; err != nil {
+		return nil, err
+	}
+	subnetByID := map[uint]model.IPSubnet{}
+	deviceSubnet := map[uint]uint{}
+	for _, subnet := range subnets {
+		subnetByID[subnet.ID] = subnet
+		for _, id := range subnet.DeviceIDs {
+			deviceSubnet[id] = subnet.ID
+		}
+	}
+	allocated := map[uint]string{}
+	for _, a := range allocations {
+		allocated[a.DeviceID] = a.IP
+		deviceSubnet[a.DeviceID] = a.SubnetID
+	}
+	configured := map[uint]string{}
+	for _, c := range configs {
+		configured[c.DeviceID] = c.IP
+	}
+
+	report := &AddressReport{Live: live, Devices: make([]DeviceAddress, len(devices)), Conflicts: []AddressConflict{}}
+	for i, d := range devices {
+		entry := DeviceAddress{
+			DeviceID:     d.ID,
+			Name:         d.Name,
+			NodeID:       d.NodeID,
+			ManagementIP: d.IP,
+			ConfiguredIP: configured[d.ID],
+			AllocatedIP:  allocated[d.ID],
+		}
+		if subnet, ok := subnetByID[deviceSubnet[d.ID]]; ok {
+			entry.SubnetID, entry.Subnet = subnet.ID, subnet.Name
+		}
+		report.Devices[i] = entry
+	}
+	if live {
+		var wg sync.WaitGroup
+		for i := range devices {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				ip, err := readInterfaceAddress(s.deviceComm, &devices[i])
+				if err != nil {
+					report.Devices[i].Error = err.Error()
+					return
+				}
+				report.Devices[i].LiveIP = ip
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	management := map[string][]uint{}
+	iface := map[string][]uint{}
+	for _, d := range report.Devices {
+		if d.ManagementIP != "" {
+			management[d.ManagementIP] = append(management[d.ManagementIP], d.DeviceID)
+		}
+		source, address := "db", d.interfaceAddress()
+		if live {
+			if d.Error != "" {
+				report.Conflicts = append(report.Conflicts, AddressConflict{Kind: AddressUnreadable, Source: "live", DeviceIDs: []uint{d.DeviceID}, Detail: d.Error})
+			} else {
+				source, address = "live", d.LiveIP
+				if stored := d.storedAddress(); stored != "" && stored != d.LiveIP {
+					report.Conflicts = append(report.Conflicts, AddressConflict{
+						Kind: AddressMismatch, Address: d.LiveIP, Source: "live", DeviceIDs: []uint{d.DeviceID},
+						Detail: fmt.Sprintf("DB has %s", stored),
+					})
+				}
+			}
+		}
+		if address == "" {
+			continue
+		}
+		iface[address] = append(iface[address], d.DeviceID)
+		subnet, ok := subnetByID[d.SubnetID]
+		if !ok {
+			continue
+		}
+		plan, err := parseSubnet(subnet)
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(address); ip == nil || !plan.network.Contains(ip) {
+			report.Conflicts = append(report.Conflicts, AddressConflict{
+				Kind: AddressOutOfSubnet, Address: address, Source: source, DeviceIDs: []uint{d.DeviceID},
+				Detail: fmt.Sprintf("subnet %s is %s", subnet.Name, subnet.CIDR),
+			})
+		} else if reason := plan.hostReason(address); reason != "" {
+			report.Conflicts = append(report.Conflicts, AddressConflict{
+				Kind: AddressReserved, Address: address, Source: source, DeviceIDs: []uint{d.DeviceID},
+				Detail: fmt.Sprintf("%s of subnet %s", reason, subnet.Name),
+			})
+		}
+	}
+	report.Conflicts = append(report.Conflicts, duplicates(management, "management")...)
+	source := "db"
+	if live {
+		source = "live"
+	}
+	report.Conflicts = append(report.Conflicts, duplicates(iface, source)...)
+	return report, nil
+}
+
+// interfaceAddress 数据库中记录的接口地址：已保存的net_setting、分配的地址，最后是管理地址的主机部分
+func (d DeviceAddress) interfaceAddress() string {
+	if stored := d.storedAddress(); stored != "" {
+		return stored
+	}
+	return addressHost(d.ManagementIP)
+}
+
+func (d DeviceAddress) storedAddress() string {
+	if d.ConfiguredIP != "" {
+		return d.ConfiguredIP
+	}
+	return d.AllocatedIP
+}
+
+func duplicates(byAddress map[string][]uint, source string) []AddressConflict {
+	var conflicts []AddressConflict
+	for address, ids := range byAddress {
+		if len(ids) > 1 {
+			conflicts = append(conflicts, AddressConflict{Kind: AddressDuplicate, Address: address, Source: source, DeviceIDs: ids})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Address < conflicts[j].Address })
+	return conflicts
+}
+
+// recordDeviceAddress 节点接口地址从oldIP改为newIP后更新分配记录；若设备经该接口管理
+// （Device.IP的主机部分为oldIP）则同步更新Device.IP，保留其中的端口。返回当前的管理地址
+func recordDeviceAddress(db *gorm.DB, deviceID uint, oldIP, newIP string) (string, error) {
+	var device model.Device
+	if err := db.Select("id", "ip").First(&device, deviceID).Error; err != nil {
+		return "", err
+	}
+	if err := db.Model(&model.IPAllocation{}).Where("device_id = ?", deviceID).Update("ip", newIP).Error; err != nil {
+		return device.IP, err
+	}
+	if oldIP == "" || oldIP == newIP || addressHost(device.IP) != oldIP {
+		return device.IP, nil
+	}
+	managementIP := newIP
+	if _, port, err := net.SplitHostPort(device.IP); err == nil {
+		managementIP = net.JoinHostPort(newIP, port)
+	}
+	if err := db.Model(&model.Device{}).Where("id = ?", deviceID).Update("ip", managementIP).Error; err != nil {
+		return device.IP, err
+	}
+	log.Printf("Device %d re-addressed from %s to %s, management address is now %s", deviceID, oldIP, newIP, managementIP)
+	return managementIP, nil
+}
+
+// readInterfaceAddress 读取AT^DUIP?上报的接口地址
+// 示例响应：^DUIP: 0,"192.168.1.27",FB880200,"00:01:00:02:88:fb",B140411
+func readInterfaceAddress(comm *DeviceCommService, device *model.Device) (string, error) {
+	const query = "AT^DUIP?"
+	response, err := comm.sendHTTPRequestToDevice(device, ATCommandRequest{Command: query, Timeout: 10})
+	if err != nil {
+		return "", err
+	}
+	comm.logCommandExecution(device.ID, query, response, "")
+	value, err := extractReportedValue(query, response)
+	if err != nil {
+		return "", err
+	}
+	for _, field := range splitFields(value) {
+		if ip := net.ParseIP(strings.Trim(field, `"`)); ip != nil && ip.To4() != nil {
+			return ip.To4().String(), nil
+		}
+	}
+	return "", fmt.Errorf("no IPv4 address in %s response: %q", query, value)
+}
+
+// addressHost 返回管理地址（可能带端口）的主机部分
+func addressHost(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+// subnetPlan is a parsed IPSubnet.
+type subnetPlan struct {
+	network    *net.IPNet
+	first      uint32 // network address
+	last       uint32 // broadcast address
+	start, end uint32 // allocation range
+	gateway    string
+	reserved   map[string]bool
+}
+
+func parseSubnet(subnet model.IPSubnet) (*subnetPlan, error) {
+	_, ipnet, err := net.ParseCIDR(subnet.CIDR)
+	if err != nil || ipnet.IP.To4() == nil {
+		return nil, fmt.Errorf("%w: %q is not an IPv4 CIDR", ErrIPAMInvalid, subnet.CIDR)
+	}
+	ones, bits := ipnet.Mask.Size()
+	first := ipToUint32(ipnet.IP)
+	plan := &subnetPlan{
+		network:  ipnet,
+		first:    first,
+		last:     first | (1<<uint(bits-ones) - 1),
+		gateway:  subnet.Gateway,
+		reserved: map[string]bool{},
+	}
+	plan.start, plan.end = plan.first+1, plan.last-1
+
+	inside := func(field, value string) (uint32, error) {
+		ip := net.ParseIP(value)
+		if ip == nil || ip.To4() == nil {
+			return 0, fmt.Errorf("%w: %s %q is not an IPv4 address", ErrIPAMInvalid, field, value)
+		}
+		a := ipToUint32(ip)
+		if a <= plan.first || a >= plan.last {
+			return 0, fmt.Errorf("%w: %s %s is not a host address of %s", ErrIPAMInvalid, field, value, ipnet)
+		}
+		return a, nil
+	}
+	if subnet.Gateway != "" {
+		if _, err := inside("gateway", subnet.Gateway); err != nil {
+			return nil, err
+		}
+	}
+	if subnet.RangeStart != "" {
+		if plan.start, err = inside("range_start", subnet.RangeStart); err != nil {
+			return nil, err
+		}
+	}
+	if subnet.RangeEnd != "" {
+		if plan.end, err = inside("range_end", subnet.RangeEnd); err != nil {
+			return nil, err
+		}
+	}
+	if plan.start > plan.end {
+		return nil, fmt.Errorf("%w: range_start is after range_end", ErrIPAMInvalid)
+	}
+	for _, r := range subnet.Reserved {
+		ip := net.ParseIP(r)
+		if ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("%w: reserved %q is not an IPv4 address", ErrIPAMInvalid, r)
+		}
+		plan.reserved[ip.To4().String()] = true
+	}
+	return plan, nil
+}
+
+func (p *subnetPlan) mask() string {
+	return net.IP(p.network.Mask).String()
+}
+
+// hostReason 说明地址为何不能分配给节点；可以使用时返回空
+func (p *subnetPlan) hostReason(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.To4() == nil {
+		return "not an IPv4 address"
+	}
+	switch a := ipToUint32(parsed); {
+	case a == p.first:
+		return "network address"
+	case a == p.last:
+		return "broadcast address"
+	case ip == p.gateway:
+		return "gateway"
+	case p.reserved[ip]:
+		return "reserved address"
+	}
+	return ""
+}
+
+// reject 说明地址为何不能从该子网分配；可以分配时返回空
+func (p *subnetPlan) reject(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || !p.network.Contains(parsed) {
+		return fmt.Sprintf("outside %s", p.network)
+	}
+	if reason := p.hostReason(ip); reason != "" {
+		return "the " + reason
+	}
+	if a := ipToUint32(parsed); a < p.start || a > p.end {
+		return fmt.Sprintf("outside the allocation range %s-%s", uint32ToIP(p.start), uint32ToIP(p.end))
+	}
+	return ""
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uint32ToIP(a uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, a)
+	return ip
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"backend/internal/model"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestParseSubnet(t *testing.T) {
+	tests := []struct {
+		name      string
+		subnet    model.IPSubnet
+		wantStart string
+		wantEnd   string
+		wantMask  string
+		wantErr   bool
+	}{
+		{name: "/24 excludes network and broadcast", subnet: model.IPSubnet{CIDR: "192.168.10.0/24"}, wantStart: "192.168.10.1", wantEnd: "192.168.10.254", wantMask: "255.255.255.0"},
+		{name: "host bits in the cidr are masked off", subnet: model.IPSubnet{CIDR: "10.0.0.77/30"}, wantStart: "10.0.0.77", wantEnd: "10.0.0.78", wantMask: "255.255.255.252"},
+		{name: "explicit range", subnet: model.IPSubnet{CIDR: "10.1.0.0/16", RangeStart: "10.1.2.0", RangeEnd: "10.1.2.255"}, wantStart: "10.1.2.0", wantEnd: "10.1.2.255", wantMask: "255.255.0.0"},
+		{name: "ipv6", subnet: model.IPSubnet{CIDR: "fd00::/64"}, wantErr: true},
+		{name: "not a cidr", subnet: model.IPSubnet{CIDR: "192.168.10.0"}, wantErr: true},
+		{name: "gateway is the network address", subnet: model.IPSubnet{CIDR: "192.168.10.0/24", Gateway: "192.168.10.0"}, wantErr: true},
+		{name: "gateway is the broadcast address", subnet: model.IPSubnet{CIDR: "192.168.10.0/24", Gateway: "192.168.10.255"}, wantErr: true},
+		{name: "gateway outside", subnet: model.IPSubnet{CIDR: "192.168.10.0/24", Gateway: "192.168.11.1"}, wantErr: true},
+		{name: "range starts at the network address", subnet: model.IPSubnet{CIDR: "192.168.10.0/24", RangeStart: "192.168.10.0"}, wantErr: true},
+		{name: "range ends at the broadcast address", subnet: model.IPSubnet{CIDR: "192.168.10.0/24", RangeEnd: "192.168.10.255"}, wantErr: true},
+		{name: "reversed range", subnet: model.IPSubnet{CIDR: "192.168.10.0/24", RangeStart: "192.168.10.200", RangeEnd: "192.168.10.100"}, wantErr: true},
+		{name: "bad reserved address", subnet: model.IPSubnet{CIDR: "192.168.10.0/24", Reserved: []string{"x"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := parseSubnet(tt.subnet)
+			if tt.wantErr {
+				if !errors.Is(err, ErrIPAMInvalid) {
+					t.Fatalf("parseSubnet error = %v, want ErrIPAMInvalid", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSubnet: %v", err)
+			}
+			if got := uint32ToIP(plan.start).String(); got != tt.wantStart {
+				t.Errorf("start = %s, want %s", got, tt.wantStart)
+			}
+			if got := uint32ToIP(plan.end).String(); got != tt.wantEnd {
+				t.Errorf("end = %s, want %s", got, tt.wantEnd)
+			}
+			if got := plan.mask(); got != tt.wantMask {
+				t.Errorf("mask = %s, want %s", got, tt.wantMask)
+			}
+		})
+	}
+}
+
+func TestSubnetPlanReject(t *testing.T) {
+	plan, err := parseSubnet(model.IPSubnet{
+		CIDR:       "192.168.10.0/24",
+		Gateway:    "192.168.10.1",
+		RangeStart: "192.168.10.1",
+		RangeEnd:   "192.168.10.200",
+		Reserved:   []string{"192.168.10.50"},
+	})
+	if err != nil {
+		t.Fatalf("parseSubnet: %v", err)
+	}
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "192.168.10.2", want: ""},
+		{ip: "192.168.10.200", want: ""},
+		{ip: "192.168.10.0", want: "the network address"},
+		{ip: "192.168.10.255", want: "the broadcast address"},
+		{ip: "192.168.10.1", want: "the gateway"},
+		{ip: "192.168.10.50", want: "the reserved address"},
+		{ip: "192.168.10.201", want: "outside the allocation range 192.168.10.1-192.168.10.200"},
+		{ip: "192.168.11.2", want: "outside 192.168.10.0/24"},
+		{ip: "not-an-ip", want: "outside 192.168.10.0/24"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := plan.reject(tt.ip); got != tt.want {
+				t.Errorf("reject(%s) = %q, want %q", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func newIPAMTestService(t *testing.T) (*IPAMService, *gorm.DB) {
+	db := newTestDB(t, &model.Device{}, &model.NetworkConfig{}, &model.IPAllocation{})
+	return NewIPAMService(db, nil, nil), db
+}
+
+func TestIPAMNextFree(t *testing.T) {
+	tests := []struct {
+		name    string
+		subnet  model.IPSubnet
+		used    []string // allocated to device 1
+		device  uint     // the device asking; its own addresses stay available
+		want    string
+		wantErr error
+	}{
+		{name: "skips the network address", subnet: model.IPSubnet{CIDR: "10.0.0.0/29"}, want: "10.0.0.1"},
+		{name: "skips the gateway", subnet: model.IPSubnet{CIDR: "10.0.0.0/29", Gateway: "10.0.0.1"}, want: "10.0.0.2"},
+		{name: "skips reserved and used addresses", subnet: model.IPSubnet{CIDR: "10.0.0.0/29", Gateway: "10.0.0.1", Reserved: []string{"10.0.0.2"}}, used: []string{"10.0.0.3"}, want: "10.0.0.4"},
+		{name: "own address is free for the device", subnet: model.IPSubnet{CIDR: "10.0.0.0/29"}, used: []string{"10.0.0.1"}, device: 1, want: "10.0.0.1"},
+		{name: "starts at range_start", subnet: model.IPSubnet{CIDR: "10.0.0.0/24", RangeStart: "10.0.0.100"}, want: "10.0.0.100"},
+		{name: "never hands out the broadcast address", subnet: model.IPSubnet{CIDR: "10.0.0.0/30", Gateway: "10.0.0.1"}, used: []string{"10.0.0.2"}, wantErr: ErrIPAMExhausted},
+		{name: "/31 has no host addresses", subnet: model.IPSubnet{CIDR: "10.0.0.0/31"}, wantErr: ErrIPAMInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newIPAMTestService(t)
+			for _, ip := range tt.used {
+				if err := db.Create(&model.IPAllocation{DeviceID: 1, IP: ip}).Error; err != nil {
+					t.Fatalf("create allocation: %v", err)
+				}
+			}
+			got, err := s.nextFree(tt.subnet, tt.device)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("nextFree error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("nextFree: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("nextFree = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,782 @@
+package service
+
+import (
+	"backend/internal/model"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultRotationKeyBytes     = 16
+	minRotationKeyBytes         = 4
+	maxRotationKeyBytes         = 32 // AT^DAPI takes at most 64 hex characters
+	defaultRotationWindow       = 60 // minutes
+	rotationCategory            = ConfigCategorySecurity
+	rotationFingerprintKey      = "encryption_key_fingerprint"
+	rotationKeyConfig           = "encryption_key"
+	rotationAlgorithmConfig     = "encryption_algorithm"
+	rotationAccessPasswordQuery = "AT^DAPI?"
+	rotationAlgorithmQuery      = "AT^DCIAC?"
+)
+
+var (
+	// ErrKeyRotationInvalid wraps validation failures of a rotation request.
+	ErrKeyRotationInvalid = errors.New("invalid key rotation")
+	// ErrKeyRotationState is returned when a rotation is not in the state an action needs.
+	ErrKeyRotationState = errors.New("key rotation is not in the required state")
+)
+
+func keyRotationWorkerName(id uint) string {
+	return fmt.Sprintf("key_rotation_%d", id)
+}
+
+// KeyRotationRequest describes a mesh-wide access password rotation.
+type KeyRotationRequest struct {
+	Name            string     `json:"name"`
+	RootDeviceID    uint       `json:"root_device_id"` // the node nearest to the backend, rebooted last
+	DeviceIDs       []uint     `json:"device_ids"`     // empty = every device connected to the root
+	Value           string     `json:"value"`          // new access password (hex); generated when empty
+	KeyBytes        int        `json:"key_bytes"`      // length of the generated password, default 16 bytes
+	Algorithm       *int       `json:"algorithm"`      // AT^DCIAC to switch together with the password
+	SwitchAt        *time.Time `json:"switch_at"`      // start of the switchover window; empty = right after staging
+	WindowMinutes   int        `json:"window_minutes"`
+	RejoinTimeout   int        `json:"rejoin_timeout"`
+	SettleTime      int        `json:"settle_time"`
+	RefreshTopology bool       `json:"refresh_topology"`
+	DryRun          bool       `json:"dry_run"`
+}
+
+// KeyRotationCreated is returned once when a rotation starts: the generated
+// password is only ever shown here.
+type KeyRotationCreated struct {
+	Rotation *model.KeyRotation `json:"rotation"`
+	Value    string             `json:"value,omitempty"`
+}
+
+// keyRotationRun is the in-memory control of a rotation's worker.
+type keyRotationRun struct {
+	actor     AuditActor
+	cancel    context.CancelFunc
+	switchNow chan struct{}
+	cancelled bool
+}
+
+// KeyRotationService 自组网接入密码(AT^DAPI)和加密算法(AT^DCIAC)的协调轮换。两者都在重启后生效，
+// 因此先在所有节点写入新值（暂存），在切换窗口内从最远跳数开始依次重启、根节点最后，
+// 再确认每个节点都以新值重新入网；失败时恢复原值。新旧密码只以密文保存，记录中只有指纹。
+// 安全配置中AT+CONFIG的encryption_key不在轮换范围内，仍通过安全配置下发修改
+type KeyRotationService struct {
+	db         *gorm.DB
+	deviceComm *DeviceCommService
+	changeSet  *ChangeSetExecutor
+	rollout    *RolloutService
+	audit      *AuditService
+	secrets    *SecretBox
+	supervisor *Supervisor
+
+	mu   sync.Mutex
+	runs map[uint]*keyRotationRun
+}
+
+// NewKeyRotationService 创建密钥轮换服务
+func NewKeyRotationService(db *gorm.DB, deviceComm *DeviceCommService, changeSet *ChangeSetExecutor, rollout *RolloutService, audit *AuditService, secrets *SecretBox, supervisor *Supervisor) *KeyRotationService {
+	return &KeyRotationService{
+		db:         db,
+		deviceComm: deviceComm,
+		changeSet:  changeSet,
+		rollout:    rollout,
+		audit:      audit,
+		secrets:    secrets,
+		supervisor: supervisor,
+		runs:       make(map[uint]*keyRotationRun),
+	}
+}
+
+// Start 恢复上次运行时的轮换：已暂存的继续等待切换窗口；暂存中途停止的恢复原值；
+// 切换中途停止的标记为interrupted，可通过回滚恢复原值
+func (s *KeyRotationService) Start() {
+	var rotations []model.KeyRotation
+	if err := s.db.Where("status IN ?", []string{model.KeyRotationStaging, model.KeyRotationStaged, model.KeyRotationSwitching}).Find(&rotations).Error; err != nil {
+		log.Printf("Failed to load unfinished key rotations: %v", err)
+		return
+	}
+	for i := range rotations {
+		rotation := rotations[i]
+		actor := AuditActor{Username: rotation.CreatedBy}
+		switch rotation.Status {
+		case model.KeyRotationStaged:
+			log.Printf("Key rotation %d: resuming the wait for the switchover window", rotation.ID)
+			s.launch(&rotation, actor, func(ctx context.Context, r *model.KeyRotation, run *keyRotationRun) error {
+				return s.awaitSwitch(ctx, r, run)
+			})
+		case model.KeyRotationStaging:
+			log.Printf("Key rotation %d: the backend stopped during staging, restoring the previous value", rotation.ID)
+			s.launch(&rotation, actor, func(ctx context.Context, r *model.KeyRotation, run *keyRotationRun) error {
+				s.unstage(r, actor, model.KeyRotationFailed, "the backend stopped during staging; the previous value was restored")
+				return nil
+			})
+		case model.KeyRotationSwitching:
+			s.finish(&rotation, model.KeyRotationInterrupted, "the backend stopped during the switchover; roll back to restore the previous value")
+		}
+	}
+}
+
+// Create 校验并启动轮换；DryRun时只返回重启顺序和当前密码指纹
+func (s *KeyRotationService) Create(req KeyRotationRequest, actor AuditActor) (*KeyRotationCreated, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrKeyRotationInvalid, fmt.Sprintf(format, args...))
+	}
+	switch {
+	case req.WindowMinutes < 0 || req.RejoinTimeout < 0 || req.SettleTime < 0:
+		return nil, invalid("window_minutes, rejoin_timeout and settle_time must not be negative")
+	case req.KeyBytes != 0 && (req.KeyBytes < minRotationKeyBytes || req.KeyBytes > maxRotationKeyBytes):
+		return nil, invalid("key_bytes must be within %d..%d", minRotationKeyBytes, maxRotationKeyBytes)
+	case req.Algorithm != nil && (*req.Algorithm < 0 || *req.Algorithm > 3):
+		return nil, invalid("algorithm must be 0 (none), 1 (SNOW), 2 (AES) or 3 (ZUC)")
+	case !req.DryRun && !s.secrets.Keyed():
+		return nil, ErrSecretKeyUnset
+	}
+	value := req.Value
+	if value != "" {
+		if _, err := AccessPasswordCommand(value); err != nil {
+			return nil, invalid("%v", err)
+		}
+	}
+
+	// 分批顺序与分批变更相同：按当前拓扑从远到近，根节点最后
+	plan, err := s.rollout.plan(RolloutRequest{
+		Name:            req.Name,
+		RootDeviceID:    req.RootDeviceID,
+		DeviceIDs:       req.DeviceIDs,
+		RefreshTopology: req.RefreshTopology,
+	})
+	if err != nil {
+		if errors.Is(err, ErrRolloutInvalid) {
+			return nil, invalid("%s", strings.TrimPrefix(err.Error(), ErrRolloutInvalid.Error()+": "))
+		}
+		return nil, err
+	}
+	rotation := &model.KeyRotation{
+		Name:          req.Name,
+		RootDeviceID:  plan.RootDeviceID,
+		DeviceIDs:     plan.DeviceIDs,
+		Algorithm:     req.Algorithm,
+		SwitchAt:      req.SwitchAt,
+		WindowMinutes: req.WindowMinutes,
+		RejoinTimeout: plan.RejoinTimeout,
+		SettleTime:    plan.SettleTime,
+		CreatedBy:     actor.Username,
+		Status:        model.KeyRotationStaging,
+	}
+	if rotation.Name == "" {
+		rotation.Name = strings.Replace(plan.Name, "rollout", "key rotation", 1)
+	}
+	if rotation.WindowMinutes == 0 {
+		rotation.WindowMinutes = defaultRotationWindow
+	}
+	for _, wave := range plan.Waves {
+		for _, d := range wave.Devices {
+			rotation.Devices = append(rotation.Devices, model.KeyRotationDevice{
+				DeviceID: d.DeviceID, Name: d.Name, NodeID: d.NodeID, Hop: d.Hop, Status: model.KeyRotationDevicePending,
+			})
+		}
+	}
+	if req.SwitchAt != nil && time.Now().After(req.SwitchAt.Add(time.Duration(rotation.WindowMinutes)*time.Minute)) {
+		return nil, invalid("the switchover window ending %s has already passed", req.SwitchAt.Add(time.Duration(rotation.WindowMinutes)*time.Minute).Format(time.RFC3339))
+	}
+
+	// 所有节点当前的接入密码（以及加密算法）必须一致，否则网络已经分裂
+	previous, previousAlgorithm, err := s.currentValues(rotation, req.Algorithm != nil)
+	if err != nil {
+		return nil, invalid("%v", err)
+	}
+	rotation.PreviousFingerprint = s.secrets.Fingerprint(previous)
+	rotation.PreviousAlgorithm = previousAlgorithm
+	if req.DryRun {
+		return &KeyRotationCreated{Rotation: rotation}, nil
+	}
+
+	if value == "" {
+		if value, err = generateAccessPassword(req.KeyBytes); err != nil {
+			return nil, err
+		}
+	}
+	rotation.Fingerprint = s.secrets.Fingerprint(value)
+	if rotation.Fingerprint == rotation.PreviousFingerprint {
+		return nil, invalid("the new access password is the current one")
+	}
+	rotation.SealedValue = s.secrets.Seal(value)
+	rotation.SealedPrevious = s.secrets.Seal(previous)
+	if err := s.db.Create(rotation).Error; err != nil {
+		return nil, err
+	}
+	s.launch(rotation, actor, s.execute)
+	return &KeyRotationCreated{Rotation: rotation, Value: value}, nil
+}
+
+// List 返回所有轮换记录，新的在前
+func (s *KeyRotationService) List() ([]model.KeyRotation, error) {
+	var rotations []model.KeyRotation
+	err := s.db.Order("id DESC").Find(&rotations).Error
+	return rotations, err
+}
+
+// Get 返回轮换记录及每个节点的进度
+func (s *KeyRotationService) Get(id uint) (*model.KeyRotation, error) {
+	var rotation model.KeyRotation
+	if err := s.db.First(&rotation, id).Error; err != nil {
+		return nil, err
+	}
+	return &rotation, nil
+}
+
+// SwitchNow 不等待switch_at，立即开始已暂存轮换的切换
+func (s *KeyRotationService) SwitchNow(id uint) error {
+	run, err := s.stagedRun(id)
+	if err != nil {
+		return err
+	}
+	select {
+	case run.switchNow <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Cancel 在切换前取消轮换，所有节点恢复原值
+func (s *KeyRotationService) Cancel(id uint) error {
+	run, err := s.stagedRun(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	run.cancelled = true
+	s.mu.Unlock()
+	run.cancel()
+	return nil
+}
+
+// Rollback 将已完成、中断或回滚失败的轮换恢复为原密码；只能回滚这些设备上最近的一次轮换
+func (s *KeyRotationService) Rollback(id uint, actor AuditActor) (*model.KeyRotation, error) {
+	rotation, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	switch rotation.Status {
+	case model.KeyRotationCompleted, model.KeyRotationInterrupted, model.KeyRotationRollbackFailed:
+	default:
+		return nil, fmt.Errorf("%w: a %s rotation cannot be rolled back", ErrKeyRotationState, rotation.Status)
+	}
+	var newer []model.KeyRotation
+	if err := s.db.Where("id > ? AND status NOT IN ?", id, []string{model.KeyRotationFailed, model.KeyRotationCancelled, model.KeyRotationRolledBack}).Find(&newer).Error; err != nil {
+		return nil, err
+	}
+	for _, n := range newer {
+		for _, deviceID := range n.DeviceIDs {
+			if containsID(rotation.DeviceIDs, deviceID) {
+				return nil, fmt.Errorf("%w: rotation %d changed device %d afterwards; roll that one back first", ErrKeyRotationState, n.ID, deviceID)
+			}
+		}
+	}
+	s.mu.Lock()
+	_, running := s.runs[id]
+	s.mu.Unlock()
+	if running {
+		return nil, fmt.Errorf("%w: rotation %d is still running", ErrKeyRotationState, id)
+	}
+
+	rotation.Status = model.KeyRotationSwitching
+	rotation.Error = ""
+	s.save(rotation)
+	s.launch(rotation, actor, func(ctx context.Context, r *model.KeyRotation, run *keyRotationRun) error {
+		s.rollbackAll(ctx, r, run, "rolled back on request")
+		return nil
+	})
+	return rotation, nil
+}
+
+func (s *KeyRotationService) stagedRun(id uint) (*keyRotationRun, error) {
+	rotation, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	run, ok := s.runs[id]
+	s.mu.Unlock()
+	if !ok || rotation.Status != model.KeyRotationStaged {
+		return nil, fmt.Errorf("%w: rotation %d is %s, not staged", ErrKeyRotationState, id, rotation.Status)
+	}
+	return run, nil
+}
+
+// launch 在supervisor下运行轮换的工作协程
+func (s *KeyRotationService) launch(rotation *model.KeyRotation, actor AuditActor, work func(context.Context, *model.KeyRotation, *keyRotationRun) error) {
+	ctx, cancel := context.WithCancel(s.supervisor.Context())
+	run := &keyRotationRun{actor: actor, cancel: cancel, switchNow: make(chan struct{}, 1)}
+	s.mu.Lock()
+	s.runs[rotation.ID] = run
+	s.mu.Unlock()
+
+	// 工作协程修改自己的副本，返回给调用方的记录不受影响
+	worker := *rotation
+	worker.Devices = append([]model.KeyRotationDevice(nil), rotation.Devices...)
+	s.supervisor.Go(keyRotationWorkerName(rotation.ID), func(context.Context) error {
+		defer func() {
+			cancel()
+			s.mu.Lock()
+			delete(s.runs, worker.ID)
+			s.mu.Unlock()
+		}()
+		return work(ctx, &worker, run)
+	})
+}
+
+// execute 暂存新值，然后等待切换窗口
+func (s *KeyRotationService) execute(ctx context.Context, rotation *model.KeyRotation, run *keyRotationRun) error {
+	s.clearDesiredKeys(rotation)
+	if err := s.stage(ctx, rotation, run); err != nil {
+		s.unstage(rotation, run.actor, model.KeyRotationFailed, fmt.Sprintf("staging failed: %v; the previous value was restored", err))
+		return err
+	}
+	now := time.Now()
+	rotation.StagedAt = &now
+	rotation.Status = model.KeyRotationStaged
+	s.save(rotation)
+	return s.awaitSwitch(ctx, rotation, run)
+}
+
+// clearDesiredKeys 删除这些设备期望配置中的接入密码和加密算法，避免漂移修复把暂存的新值改回去
+func (s *KeyRotationService) clearDesiredKeys(rotation *model.KeyRotation) {
+	keys := []string{rotationKeyConfig}
+	if rotation.Algorithm != nil {
+		keys = append(keys, rotationAlgorithmConfig)
+	}
+	res := s.db.Where("device_id IN ? AND key IN ?", rotation.DeviceIDs, keys).Delete(&model.DesiredConfig{})
+	if res.Error != nil {
+		log.Printf("Key rotation %d: failed to clear desired keys: %v", rotation.ID, res.Error)
+		return
+	}
+	if res.RowsAffected > 0 {
+		rotation.Notes = append(rotation.Notes, fmt.Sprintf("removed %d desired %s value(s) so drift remediation does not revert the rotation", res.RowsAffected, strings.Join(keys, "/")))
+	}
+}
+
+// stage 按顺序在每个节点写入新值并回读确认；新值在重启前不生效
+func (s *KeyRotationService) stage(ctx context.Context, rotation *model.KeyRotation, run *keyRotationRun) error {
+	value, err := s.secrets.Open(rotation.SealedValue)
+	if err != nil {
+		return err
+	}
+	details := fmt.Sprintf("key rotation %d: stage", rotation.ID)
+	for i := range rotation.Devices {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		d := &rotation.Devices[i]
+		neighbors, err := s.rollout.discoverNeighbors(d.DeviceID)
+		if err != nil {
+			d.Status, d.Error = model.KeyRotationDeviceFailed, fmt.Sprintf("neighbor discovery failed: %v", err)
+			s.save(rotation)
+			return fmt.Errorf("device %s: %s", d.Name, d.Error)
+		}
+		d.NeighborsBefore = neighbors
+		commands, err := s.apply(d.DeviceID, value, rotation.Algorithm, rotation.PreviousFingerprint, rotation.Fingerprint, run.actor, details)
+		d.Commands = commands
+		if err != nil {
+			d.Status, d.Error = model.KeyRotationDeviceFailed, err.Error()
+			s.save(rotation)
+			return fmt.Errorf("device %s: %v", d.Name, err)
+		}
+		d.Status, d.Error = model.KeyRotationDeviceStaged, ""
+		s.save(rotation)
+	}
+	return nil
+}
+
+// awaitSwitch 等到switch_at（或立即切换的请求），错过窗口或被取消时恢复原值
+func (s *KeyRotationService) awaitSwitch(ctx context.Context, rotation *model.KeyRotation, run *keyRotationRun) error {
+	if rotation.SwitchAt != nil {
+		if wait := time.Until(*rotation.SwitchAt); wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-run.switchNow:
+			case <-ctx.Done():
+				s.mu.Lock()
+				cancelled := run.cancelled
+				s.mu.Unlock()
+				if cancelled {
+					s.unstage(rotation, run.actor, model.KeyRotationCancelled, "cancelled before the switchover; the previous value was restored")
+				}
+				// 后端停止时保持暂存，重启后继续等待
+				return ctx.Err()
+			}
+		}
+		windowEnd := rotation.SwitchAt.Add(time.Duration(rotation.WindowMinutes) * time.Minute)
+		if time.Now().After(windowEnd) {
+			s.unstage(rotation, run.actor, model.KeyRotationCancelled, fmt.Sprintf("the switchover window ended at %s before the switchover started; the previous value was restored", windowEnd.Format(time.RFC3339)))
+			return nil
+		}
+	}
+	return s.switchover(ctx, rotation, run)
+}
+
+// switchover 确认所有节点都暂存了新值，从远到近依次重启，然后等待全部以新值重新入网
+func (s *KeyRotationService) switchover(ctx context.Context, rotation *model.KeyRotation, run *keyRotationRun) error {
+	for i := range rotation.Devices {
+		d := &rotation.Devices[i]
+		if status, _ := s.deviceComm.GetDeviceStatus(d.DeviceID); status != "Online" {
+			s.unstage(rotation, run.actor, model.KeyRotationFailed, fmt.Sprintf("device %s is offline before the switchover; the previous value was restored", d.Name))
+			return nil
+		}
+		if fp, err := s.readFingerprint(d.DeviceID); err != nil || fp != rotation.Fingerprint {
+			reason := "no longer holds the staged value"
+			if err != nil {
+				reason = fmt.Sprintf("could not be read: %v", err)
+			}
+			s.unstage(rotation, run.actor, model.KeyRotationFailed, fmt.Sprintf("device %s %s; the previous value was restored", d.Name, reason))
+			return nil
+		}
+	}
+
+	now := time.Now()
+	rotation.SwitchedAt = &now
+	rotation.Status = model.KeyRotationSwitching
+	s.save(rotation)
+	details := fmt.Sprintf("key rotation %d: switchover", rotation.ID)
+	for i := range rotation.Devices {
+		d := &rotation.Devices[i]
+		if err := s.reboot(run.actor, d.DeviceID, details); err != nil {
+			d.Status, d.Error = model.KeyRotationDeviceFailed, fmt.Sprintf("reboot failed: %v", err)
+			s.save(rotation)
+			s.rollbackAll(ctx, rotation, run, fmt.Sprintf("device %s: %s", d.Name, d.Error))
+			return nil
+		}
+		d.Status = model.KeyRotationDeviceSwitched
+		s.save(rotation)
+	}
+
+	if err := s.verify(ctx, rotation, rotation.Fingerprint, model.KeyRotationDeviceRejoined); err != nil {
+		if ctx.Err() != nil {
+			s.finish(rotation, model.KeyRotationInterrupted, "the backend stopped during the switchover; roll back to restore the previous value")
+			return err
+		}
+		s.rollbackAll(ctx, rotation, run, err.Error())
+		return nil
+	}
+	s.storeKeys(rotation, rotation.SealedValue, rotation.Algorithm)
+	s.finish(rotation, model.KeyRotationCompleted, "")
+	return nil
+}
+
+// verify 等待每个节点在线、接入密码指纹为fingerprint，并重新看到修改前的邻居之一
+func (s *KeyRotationService) verify(ctx context.Context, rotation *model.KeyRotation, fingerprint, status string) error {
+	if err := sleepContext(ctx, time.Duration(rotation.SettleTime)*time.Second); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(time.Duration(rotation.RejoinTimeout) * time.Second)
+	for {
+		var pending []string
+		for i := range rotation.Devices {
+			d := &rotation.Devices[i]
+			if d.Status == status {
+				continue
+			}
+			if s.rejoined(d, fingerprint) {
+				d.Status, d.Error = status, ""
+			} else {
+				pending = append(pending, fmt.Sprintf("%s (%s)", d.Name, d.Error))
+			}
+		}
+		s.save(rotation)
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d device(s) did not re-join within %ds: %s", len(pending), rotation.RejoinTimeout, strings.Join(pending, ", "))
+		}
+		if err := sleepContext(ctx, rolloutPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *KeyRotationService) rejoined(d *model.KeyRotationDevice, fingerprint string) bool {
+	if status, _ := s.deviceComm.GetDeviceStatus(d.DeviceID); status != "Online" {
+		d.Error = "device is offline"
+		return false
+	}
+	fp, err := s.readFingerprint(d.DeviceID)
+	if err != nil {
+		d.Error = fmt.Sprintf("access password could not be read: %v", err)
+		return false
+	}
+	if fp != fingerprint {
+		d.Error = "device reports a different access password"
+		return false
+	}
+	neighbors, err := s.rollout.discoverNeighbors(d.DeviceID)
+	if err != nil {
+		d.Error = fmt.Sprintf("neighbor discovery failed: %v", err)
+		return false
+	}
+	d.NeighborsAfter = neighbors
+	if len(d.NeighborsBefore) == 0 || len(intersectStrings(d.NeighborsBefore, neighbors)) > 0 {
+		return true
+	}
+	d.Error = fmt.Sprintf("none of the previous neighbors %s is visible", strings.Join(d.NeighborsBefore, ", "))
+	return false
+}
+
+// unstage 切换前恢复原值：新值尚未生效，不需要重启
+func (s *KeyRotationService) unstage(rotation *model.KeyRotation, actor AuditActor, status, message string) {
+	previous, err := s.secrets.Open(rotation.SealedPrevious)
+	if err != nil {
+		s.finish(rotation, model.KeyRotationRollbackFailed, fmt.Sprintf("%s; previous value: %v", message, err))
+		return
+	}
+	details := fmt.Sprintf("key rotation %d: unstage", rotation.ID)
+	failed := false
+	for i := len(rotation.Devices) - 1; i >= 0; i-- {
+		d := &rotation.Devices[i]
+		if d.Status != model.KeyRotationDeviceStaged && d.Status != model.KeyRotationDeviceFailed {
+			continue
+		}
+		commands, err := s.apply(d.DeviceID, previous, rotation.PreviousAlgorithm, rotation.Fingerprint, rotation.PreviousFingerprint, actor, details)
+		d.Rollback = commands
+		if err != nil {
+			// 暂存失败的节点变更集已自行恢复
+			if d.Status == model.KeyRotationDeviceStaged {
+				d.Status, d.Error = model.KeyRotationDeviceRollbackFailed, err.Error()
+				failed = true
+			}
+			continue
+		}
+		d.Status = model.KeyRotationDeviceUnstaged
+	}
+	if failed {
+		status = model.KeyRotationRollbackFailed
+		message += "; some devices still hold the new value and switch to it on their next reboot"
+	}
+	s.finish(rotation, status, message)
+}
+
+// rollbackAll 切换后恢复原值：从远到近写回原密码并重启，再确认以原值重新入网
+func (s *KeyRotationService) rollbackAll(ctx context.Context, rotation *model.KeyRotation, run *keyRotationRun, cause string) {
+	previous, err := s.secrets.Open(rotation.SealedPrevious)
+	if err != nil {
+		s.finish(rotation, model.KeyRotationRollbackFailed, fmt.Sprintf("%s; previous value: %v", cause, err))
+		return
+	}
+	details := fmt.Sprintf("key rotation %d: rollback", rotation.ID)
+	timeout := time.Duration(rotation.RejoinTimeout) * time.Second
+	for i := range rotation.Devices {
+		d := &rotation.Devices[i]
+		if d.Status == model.KeyRotationDeviceRolledBack || d.Status == model.KeyRotationDevicePending || d.Status == model.KeyRotationDeviceUnstaged {
+			continue
+		}
+		s.rollout.waitOnline(d.DeviceID, timeout)
+		commands, err := s.apply(d.DeviceID, previous, rotation.PreviousAlgorithm, rotation.Fingerprint, rotation.PreviousFingerprint, run.actor, details)
+		d.Rollback = commands
+		if err == nil {
+			err = s.reboot(run.actor, d.DeviceID, details)
+		}
+		if err != nil {
+			d.Status, d.Error = model.KeyRotationDeviceRollbackFailed, err.Error()
+		} else {
+			d.Status, d.Error = model.KeyRotationDeviceSwitched, ""
+		}
+		s.save(rotation)
+	}
+
+	verifyErr := s.verify(ctx, rotation, rotation.PreviousFingerprint, model.KeyRotationDeviceRolledBack)
+	status, message := model.KeyRotationRolledBack, cause
+	if verifyErr != nil {
+		status, message = model.KeyRotationRollbackFailed, fmt.Sprintf("%s; rollback: %v", cause, verifyErr)
+		for i := range rotation.Devices {
+			if d := &rotation.Devices[i]; d.Status != model.KeyRotationDeviceRolledBack && d.Status != model.KeyRotationDevicePending && d.Status != model.KeyRotationDeviceUnstaged {
+				d.Status = model.KeyRotationDeviceRollbackFailed
+			}
+		}
+	} else {
+		s.storeKeys(rotation, rotation.SealedPrevious, rotation.PreviousAlgorithm)
+	}
+	s.finish(rotation, status, message)
+}
+
+// apply 以变更集方式下发接入密码（以及加密算法），审计记录中只有指纹
+func (s *KeyRotationService) apply(deviceID uint, value string, algorithm *int, fromFingerprint, toFingerprint string, actor AuditActor, details string) ([]model.AuditCommand, error) {
+	device, err := s.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	password, err := AccessPasswordCommand(value)
+	if err != nil {
+		return nil, err
+	}
+	planned := []PlannedCommand{password}
+	if algorithm != nil {
+		planned = append(planned, PlannedCommand{
+			Step:     "encryption algorithm",
+			Name:     "set_encryption_algorithm",
+			Groups:   []map[string]interface{}{{"algorithm": *algorithm}},
+			Fallback: fmt.Sprintf("AT^DCIAC=%d", *algorithm),
+		})
+	}
+	commands, _, errs, _ := renderPlannedCommands(s.deviceComm.boardConfigMgr, device.BoardType, nil, planned)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("board validation failed: %s", strings.Join(errs, "; "))
+	}
+
+	entry := &model.ConfigAudit{
+		DeviceID: deviceID,
+		Category: rotationCategory,
+		Action:   model.AuditActionRotate,
+		Changes:  []model.PreviewChange{{Key: rotationFingerprintKey, From: fromFingerprint, To: toFingerprint}},
+		Details:  details,
+	}
+	result, err := s.changeSet.Apply(deviceID, previewSteps(commands))
+	if err != nil {
+		entry.Error = err.Error()
+		s.audit.Record(actor, entry)
+		return nil, err
+	}
+	entry.Commands = ChangeSetCommands(result)
+	entry.Error = result.Error
+	s.audit.Record(actor, entry)
+
+	applied := ChangeSetCommands(result)
+	redactCommands(applied)
+	if !result.Success {
+		return applied, errors.New(result.Error)
+	}
+	return applied, nil
+}
+
+// currentValues 读取所有节点当前的接入密码（和加密算法），要求全部一致
+func (s *KeyRotationService) currentValues(rotation *model.KeyRotation, withAlgorithm bool) (string, *int, error) {
+	var value string
+	var algorithm *int
+	groups := make(map[string][]string)
+	algorithms := make(map[string][]string)
+	for _, d := range rotation.Devices {
+		device, err := s.deviceComm.getDeviceByID(d.DeviceID)
+		if err != nil {
+			return "", nil, err
+		}
+		raw, err := s.changeSet.readValue(device, rotationAccessPasswordQuery)
+		if err != nil {
+			return "", nil, fmt.Errorf("device %s: access password could not be read: %v", d.Name, err)
+		}
+		value = strings.Trim(strings.TrimSpace(raw), "\"")
+		fp := s.secrets.Fingerprint(value)
+		groups[fp] = append(groups[fp], d.Name)
+		if withAlgorithm {
+			raw, err := s.changeSet.readValue(device, rotationAlgorithmQuery)
+			if err != nil {
+				return "", nil, fmt.Errorf("device %s: ciphering algorithm could not be read: %v", d.Name, err)
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(raw))
+			if err != nil {
+				return "", nil, fmt.Errorf("device %s: invalid ciphering algorithm %q", d.Name, raw)
+			}
+			algorithm = &n
+			algorithms[strconv.Itoa(n)] = append(algorithms[strconv.Itoa(n)], d.Name)
+		}
+	}
+	if len(groups) > 1 || len(algorithms) > 1 {
+		var parts []string
+		for fp, names := range groups {
+			parts = append(parts, fmt.Sprintf("password %s: %s", fp, strings.Join(names, ", ")))
+		}
+		for alg, names := range algorithms {
+			parts = append(parts, fmt.Sprintf("algorithm %s: %s", alg, strings.Join(names, ", ")))
+		}
+		sort.Strings(parts)
+		return "", nil, fmt.Errorf("the devices do not share one access password/algorithm (%s); align them first", strings.Join(parts, "; "))
+	}
+	return value, algorithm, nil
+}
+
+func (s *KeyRotationService) readFingerprint(deviceID uint) (string, error) {
+	device, err := s.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		return "", err
+	}
+	raw, err := s.changeSet.readValue(device, rotationAccessPasswordQuery)
+	if err != nil {
+		return "", err
+	}
+	return s.secrets.Fingerprint(strings.Trim(strings.TrimSpace(raw), "\"")), nil
+}
+
+func (s *KeyRotationService) reboot(actor AuditActor, deviceID uint, details string) error {
+	command, _ := s.deviceComm.FormatCommandByName(deviceID, "reboot_device", nil)
+	response, err := s.deviceComm.SendATCommandByName(deviceID, "reboot_device", nil)
+	if err != nil {
+		log.Printf("%s: failed to reboot device %d: %v", details, deviceID, err)
+	}
+	s.audit.RecordCommand(actor, deviceID, "reboot_device", command, response, err)
+	return err
+}
+
+// storeKeys 将生效的接入密码（密文）保存到安全配置的access_password，加密算法保存到encryption_algorithm；
+// AT+CONFIG使用的encryption_key不受轮换影响
+func (s *KeyRotationService) storeKeys(rotation *model.KeyRotation, sealed string, algorithm *int) {
+	for _, id := range rotation.DeviceIDs {
+		updates := map[string]interface{}{"access_password": sealed}
+		if algorithm != nil {
+			updates["encryption_algorithm"] = *algorithm
+		}
+		res := s.db.Model(&model.SecurityConfig{}).Where("device_id = ?", id).Updates(updates)
+		if res.Error == nil && res.RowsAffected == 0 {
+			config := model.SecurityConfig{DeviceID: id, AccessPassword: sealed}
+			if algorithm != nil {
+				config.EncryptionAlgorithm = *algorithm
+			}
+			res = s.db.Create(&config)
+		}
+		if res.Error != nil {
+			log.Printf("Key rotation %d: failed to store the key of device %d: %v", rotation.ID, id, res.Error)
+		}
+	}
+}
+
+func (s *KeyRotationService) finish(rotation *model.KeyRotation, status, message string) {
+	now := time.Now()
+	rotation.Status = status
+	rotation.Error = message
+	rotation.FinishedAt = &now
+	s.save(rotation)
+	log.Printf("Key rotation %d finished: %s %s", rotation.ID, status, message)
+}
+
+func (s *KeyRotationService) save(rotation *model.KeyRotation) {
+	if err := s.db.Save(rotation).Error; err != nil {
+		log.Printf("Failed to save key rotation %d: %v", rotation.ID, err)
+	}
+}
+
+// generateAccessPassword 生成随机的HEX接入密码
+func generateAccessPassword(size int) (string, error) {
+	if size == 0 {
+		size = defaultRotationKeyBytes
+	}
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate access password: %v", err)
+	}
+	return strings.ToUpper(hex.EncodeToString(buf)), nil
+}
@@ -0,0 +1,595 @@
+package service
+
+import (
+	"backend/internal/model"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const meshComplianceCategory = "mesh"
+
+// 参数修改后的生效方式
+const (
+	ActivationReboot   = "reboot"   // 下电重新开机生效
+	ActivationAirplane = "airplane" // 进出飞行模式生效
+)
+
+// Align statuses of a device
+const (
+	AlignPlanned   = "planned"
+	AlignAligned   = "aligned"
+	AlignUnchanged = "unchanged"
+	AlignFailed    = "failed"
+	AlignSkipped   = "skipped"
+)
+
+// ErrComplianceInvalid is returned for a check or alignment request that cannot be served.
+var ErrComplianceInvalid = errors.New("invalid compliance request")
+
+// meshParam 自组网节点之间必须一致的参数
+type meshParam struct {
+	Key        string
+	Query      string
+	Secret     bool // 报告中不显示取值
+	Hex        bool // 十六进制位图，04与4相同
+	Quoted     bool // 设置命令中参数带引号
+	Activation string
+}
+
+// meshParams 接入密码、加密算法、TDD配置、频段和子频段范围任一不同的节点无法入网。
+// 顺序即对齐时的下发顺序：频段相关在前，需要重启生效的在后
+var meshParams = []meshParam{
+	{Key: "band_config", Query: "AT^DAOCNDI?", Hex: true, Activation: ActivationAirplane},
+	{Key: "sub_band_range", Query: "AT^DSONSBR?", Activation: ActivationAirplane},
+	{Key: "tdd_config", Query: "AT^DSTC?", Activation: ActivationReboot},
+	{Key: "ciphering", Query: "AT^DCIAC?", Activation: ActivationReboot},
+	{Key: "access_password", Query: "AT^DAPI?", Secret: true, Quoted: true, Activation: ActivationReboot},
+}
+
+// ComplianceGroup is a set of devices reporting the same value.
+type ComplianceGroup struct {
+	Variant   int    `json:"variant"` // 1 is the largest group
+	Value     string `json:"value"`   // ****** for secrets
+	Count     int    `json:"count"`
+	DeviceIDs []uint `json:"device_ids"`
+}
+
+// ComplianceOutlier is a device whose value differs from the majority.
+type ComplianceOutlier struct {
+	DeviceID   uint   `json:"device_id"`
+	DeviceName string `json:"device_name"`
+	Variant    int    `json:"variant"`
+	Value      string `json:"value"`
+}
+
+// ComplianceParam is the fleet view of one parameter.
+type ComplianceParam struct {
+	Key             string              `json:"key"`
+	Command         string              `json:"command"`
+	Activation      string              `json:"activation"`
+	Consistent      bool                `json:"consistent"`
+	MajorityVariant int                 `json:"majority_variant"` // 0 when the largest groups are tied
+	Majority        string              `json:"majority,omitempty"`
+	Groups          []ComplianceGroup   `json:"groups"`
+	Outliers        []ComplianceOutlier `json:"outliers"`
+}
+
+// ComplianceDevice summarizes one device.
+type ComplianceDevice struct {
+	DeviceID   uint     `json:"device_id"`
+	DeviceName string   `json:"device_name"`
+	Compliant  bool     `json:"compliant"`
+	Mismatched []string `json:"mismatched,omitempty"` // parameters that differ from the majority
+	Unreadable []string `json:"unreadable,omitempty"`
+}
+
+// ComplianceReadError is a parameter that could not be read from a device.
+type ComplianceReadError struct {
+	DeviceID   uint   `json:"device_id"`
+	DeviceName string `json:"device_name"`
+	Key        string `json:"key"`
+	Error      string `json:"error"`
+}
+
+// ComplianceReport is the result of a fleet consistency check. Compliant means
+// every parameter was read from every device and all values match.
+type ComplianceReport struct {
+	Compliant bool                  `json:"compliant"`
+	CheckedAt time.Time             `json:"checked_at"`
+	Devices   []ComplianceDevice    `json:"devices"`
+	Params    []ComplianceParam     `json:"params"`
+	Errors    []ComplianceReadError `json:"errors"`
+
+	values map[uint]map[string]string // normalized values including secrets
+}
+
+// AlignRequest aligns devices to the majority value or to a reference device.
+type AlignRequest struct {
+	DeviceIDs         []uint   `json:"device_ids"`          // 默认所有mesh单板
+	Params            []string `json:"params"`              // 默认所有不一致的参数
+	ReferenceDeviceID uint     `json:"reference_device_id"` // 0: 对齐到多数值
+	Reboot            bool     `json:"reboot"`              // 修改成功后重启设备使参数生效
+	DryRun            bool     `json:"dry_run"`
+}
+
+// AlignTarget is the value a parameter is aligned to.
+type AlignTarget struct {
+	Key        string `json:"key"`
+	Value      string `json:"value"`
+	Activation string `json:"activation"`
+}
+
+// AlignDeviceResult is the outcome of aligning one device.
+type AlignDeviceResult struct {
+	DeviceID   uint                 `json:"device_id"`
+	DeviceName string               `json:"device_name"`
+	Status     string               `json:"status"`
+	Commands   []model.AuditCommand `json:"commands,omitempty"`
+	RolledBack bool                 `json:"rolled_back,omitempty"`
+	Rebooted   bool                 `json:"rebooted,omitempty"`
+	Error      string               `json:"error,omitempty"`
+}
+
+// AlignResult is the outcome of an alignment.
+type AlignResult struct {
+	DryRun            bool                `json:"dry_run"`
+	ReferenceDeviceID uint                `json:"reference_device_id,omitempty"`
+	Targets           []AlignTarget       `json:"targets"`
+	ActivationNeeded  []string            `json:"activation_needed,omitempty"` // reboot / airplane when reboot was not requested
+	Devices           []AlignDeviceResult `json:"devices"`
+	Aligned           int                 `json:"aligned"`
+	Failed            int                 `json:"failed"`
+	Success           bool                `json:"success"`
+}
+
+// MeshComplianceService 自组网参数一致性检查：读取一组设备的接入密码、加密算法、TDD配置、
+// 频段和子频段范围，按取值分组并找出无法入网的设备，可一键对齐到多数值或参考节点
+type MeshComplianceService struct {
+	db         *gorm.DB
+	deviceComm *DeviceCommService
+	changeSet  *ChangeSetExecutor
+	audit      *AuditService
+}
+
+// NewMeshComplianceService 创建一致性检查服务
+func NewMeshComplianceService(db *gorm.DB, deviceComm *DeviceCommService, changeSet *ChangeSetExecutor, audit *AuditService) *MeshComplianceService {
+	return &MeshComplianceService{
+		db:         db,
+		deviceComm: deviceComm,
+		changeSet:  changeSet,
+		audit:      audit,
+	}
+}
+
+// Check 读取设备的参数并生成一致性报告；deviceIDs为空时检查所有mesh单板
+func (s *MeshComplianceService) Check(deviceIDs []uint) (*ComplianceReport, error) {
+	devices, err := s.devices(deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+	return s.check(devices), nil
+}
+
+// devices 按ID加载设备，保持请求中的顺序
+func (s *MeshComplianceService) devices(deviceIDs []uint) ([]model.Device, error) {
+	var devices []model.Device
+	if len(deviceIDs) == 0 {
+		if err := s.db.Where("board_type LIKE ?", "%mesh%").Order("id").Find(&devices).Error; err != nil {
+			return nil, err
+		}
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("%w: no mesh devices found", ErrComplianceInvalid)
+		}
+		return devices, nil
+	}
+
+	if err := s.db.Where("id IN ?", deviceIDs).Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]model.Device, len(devices))
+	for _, d := range devices {
+		byID[d.ID] = d
+	}
+	ordered := make([]model.Device, 0, len(deviceIDs))
+	seen := make(map[uint]bool)
+	for _, id := range deviceIDs {
+		d, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: device %d not found", ErrComplianceInvalid, id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ordered = append(ordered, d)
+		}
+	}
+	return ordered, nil
+}
+
+func (s *MeshComplianceService) check(devices []model.Device) *ComplianceReport {
+	report := &ComplianceReport{
+		CheckedAt: time.Now(),
+		Devices:   []ComplianceDevice{},
+		Params:    []ComplianceParam{},
+		Errors:    []ComplianceReadError{},
+		values:    make(map[uint]map[string]string, len(devices)),
+	}
+
+	// 并发读取，限制同时访问的设备数
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	semaphore := make(chan struct{}, 10)
+	for _, device := range devices {
+		wg.Add(1)
+		go func(device model.Device) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			values := make(map[string]string, len(meshParams))
+			var errs []ComplianceReadError
+			for _, param := range meshParams {
+				raw, err := s.changeSet.readValue(&device, param.Query)
+				if err != nil {
+					errs = append(errs, ComplianceReadError{DeviceID: device.ID, DeviceName: device.Name, Key: param.Key, Error: err.Error()})
+					continue
+				}
+				values[param.Key] = param.normalize(raw)
+			}
+			mu.Lock()
+			report.values[device.ID] = values
+			report.Errors = append(report.Errors, errs...)
+			mu.Unlock()
+		}(device)
+	}
+	wg.Wait()
+	sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].DeviceID < report.Errors[j].DeviceID })
+
+	mismatched := make(map[uint][]string)
+	report.Compliant = len(report.Errors) == 0
+	for _, param := range meshParams {
+		result := groupParam(param, devices, report.values)
+		for _, o := range result.Outliers {
+			mismatched[o.DeviceID] = append(mismatched[o.DeviceID], param.Key)
+		}
+		if !result.Consistent {
+			report.Compliant = false
+		}
+		report.Params = append(report.Params, result)
+	}
+
+	unreadable := make(map[uint][]string)
+	for _, e := range report.Errors {
+		unreadable[e.DeviceID] = append(unreadable[e.DeviceID], e.Key)
+	}
+	for _, d := range devices {
+		report.Devices = append(report.Devices, ComplianceDevice{
+			DeviceID:   d.ID,
+			DeviceName: d.Name,
+			Compliant:  len(mismatched[d.ID]) == 0 && len(unreadable[d.ID]) == 0,
+			Mismatched: mismatched[d.ID],
+			Unreadable: unreadable[d.ID],
+		})
+	}
+	return report
+}
+
+// groupParam 按取值分组，最大的组为多数值，其余组中的设备为离群设备。
+// 最大的两组设备数相同时没有多数值，也不标记离群设备
+func groupParam(param meshParam, devices []model.Device, values map[uint]map[string]string) ComplianceParam {
+	result := ComplianceParam{
+		Key:        param.Key,
+		Command:    strings.TrimSuffix(param.Query, "?"),
+		Activation: param.Activation,
+		Groups:     []ComplianceGroup{},
+		Outliers:   []ComplianceOutlier{},
+	}
+	byValue := make(map[string]*ComplianceGroup)
+	var groups []*ComplianceGroup
+	for _, d := range devices {
+		value, ok := values[d.ID][param.Key]
+		if !ok {
+			continue
+		}
+		g, exists := byValue[value]
+		if !exists {
+			g = &ComplianceGroup{Value: value}
+			byValue[value] = g
+			groups = append(groups, g)
+		}
+		g.DeviceIDs = append(g.DeviceIDs, d.ID)
+		g.Count++
+	}
+	// 设备数多的在前，相同时按首个设备的顺序
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Count > groups[j].Count })
+
+	variants := make(map[string]int, len(groups))
+	for i, g := range groups {
+		g.Variant = i + 1
+		variants[g.Value] = g.Variant
+		display := *g
+		display.Value = param.display(g.Value)
+		result.Groups = append(result.Groups, display)
+	}
+	result.Consistent = len(groups) <= 1
+	if len(groups) == 0 || (len(groups) > 1 && groups[0].Count == groups[1].Count) {
+		return result
+	}
+	result.MajorityVariant = 1
+	result.Majority = param.display(groups[0].Value)
+	for _, d := range devices {
+		value, ok := values[d.ID][param.Key]
+		if !ok || value == groups[0].Value {
+			continue
+		}
+		result.Outliers = append(result.Outliers, ComplianceOutlier{
+			DeviceID:   d.ID,
+			DeviceName: d.Name,
+			Variant:    variants[value],
+			Value:      param.display(value),
+		})
+	}
+	return result
+}
+
+// normalize 统一取值的格式以便比较：去掉分组括号、引号和空白，数字去掉前导零，
+// 十六进制位图转换为两位大写。接入密码保持原样
+func (p meshParam) normalize(raw string) string {
+	raw = strings.NewReplacer("(", "", ")", "").Replace(raw)
+	fields := splitFields(raw)
+	for i, field := range fields {
+		field = strings.Trim(field, "\"")
+		switch {
+		case p.Hex:
+			if n, err := strconv.ParseUint(field, 16, 64); err == nil {
+				field = fmt.Sprintf("%02X", n)
+			}
+		default:
+			if n, err := strconv.Atoi(field); err == nil {
+				field = strconv.Itoa(n)
+			}
+		}
+		fields[i] = field
+	}
+	return strings.Join(fields, ",")
+}
+
+func (p meshParam) display(value string) string {
+	if p.Secret {
+		return redactedValue
+	}
+	return value
+}
+
+// setCommand 由规范化的取值生成设置命令，如 AT^DAPI="12345678"
+func (p meshParam) setCommand(value string) string {
+	fields := splitFields(value)
+	if p.Quoted {
+		for i := range fields {
+			fields[i] = strconv.Quote(fields[i])
+		}
+	}
+	return strings.TrimSuffix(p.Query, "?") + "=" + strings.Join(fields, ",")
+}
+
+func meshParamByKey(key string) (meshParam, bool) {
+	for _, p := range meshParams {
+		if p.Key == key {
+			return p, true
+		}
+	}
+	return meshParam{}, false
+}
+
+// Align 将设备的参数对齐到多数值或参考设备的取值。每台设备的修改作为一个变更集下发，
+// 失败时恢复该设备已修改的参数；读不到当前值的设备跳过
+func (s *MeshComplianceService) Align(req AlignRequest, actor AuditActor) (*AlignResult, error) {
+	for _, key := range req.Params {
+		if _, ok := meshParamByKey(key); !ok {
+			return nil, fmt.Errorf("%w: unknown parameter %q", ErrComplianceInvalid, key)
+		}
+	}
+	deviceIDs := req.DeviceIDs
+	if req.ReferenceDeviceID != 0 && len(deviceIDs) > 0 && !containsID(deviceIDs, req.ReferenceDeviceID) {
+		deviceIDs = append(append([]uint{}, deviceIDs...), req.ReferenceDeviceID)
+	}
+	devices, err := s.devices(deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+	var reference *model.Device
+	if req.ReferenceDeviceID != 0 {
+		for i := range devices {
+			if devices[i].ID == req.ReferenceDeviceID {
+				reference = &devices[i]
+			}
+		}
+		if reference == nil {
+			return nil, fmt.Errorf("%w: reference device %d is not a mesh device", ErrComplianceInvalid, req.ReferenceDeviceID)
+		}
+	}
+
+	report := s.check(devices)
+	targets, err := alignTargets(req, report, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AlignResult{DryRun: req.DryRun, ReferenceDeviceID: req.ReferenceDeviceID, Targets: []AlignTarget{}, Devices: []AlignDeviceResult{}, Success: true}
+	activations := make(map[string]bool)
+	for _, param := range meshParams {
+		if value, ok := targets[param.Key]; ok {
+			result.Targets = append(result.Targets, AlignTarget{Key: param.Key, Value: param.display(value), Activation: param.Activation})
+		}
+	}
+
+	for _, device := range devices {
+		deviceResult := s.alignDevice(device, report, targets, req, actor, activations)
+		switch deviceResult.Status {
+		case AlignAligned:
+			result.Aligned++
+		case AlignFailed, AlignSkipped:
+			result.Failed++
+			result.Success = false
+		}
+		result.Devices = append(result.Devices, deviceResult)
+	}
+	if !req.Reboot || req.DryRun {
+		for _, a := range []string{ActivationReboot, ActivationAirplane} {
+			if activations[a] {
+				result.ActivationNeeded = append(result.ActivationNeeded, a)
+			}
+		}
+	}
+	return result, nil
+}
+
+// alignTargets 确定每个参数的目标值：参考设备的取值，或多数值
+func alignTargets(req AlignRequest, report *ComplianceReport, reference *model.Device) (map[string]string, error) {
+	keys := req.Params
+	if len(keys) == 0 {
+		for _, p := range report.Params {
+			if !p.Consistent {
+				keys = append(keys, p.Key)
+			}
+		}
+	}
+	targets := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if reference != nil {
+			value, ok := report.values[reference.ID][key]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s could not be read from reference device %d", ErrComplianceInvalid, key, reference.ID)
+			}
+			targets[key] = value
+			continue
+		}
+		for _, p := range report.Params {
+			if p.Key != key {
+				continue
+			}
+			if len(p.Groups) == 0 {
+				return nil, fmt.Errorf("%w: %s could not be read from any device", ErrComplianceInvalid, key)
+			}
+			if p.MajorityVariant == 0 {
+				return nil, fmt.Errorf("%w: %s has no majority value (%d groups of %d devices); choose a reference_device_id",
+					ErrComplianceInvalid, key, countTied(p.Groups), p.Groups[0].Count)
+			}
+			targets[key] = report.values[p.Groups[0].DeviceIDs[0]][key]
+		}
+	}
+	return targets, nil
+}
+
+func countTied(groups []ComplianceGroup) int {
+	n := 0
+	for _, g := range groups {
+		if g.Count == groups[0].Count {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *MeshComplianceService) alignDevice(device model.Device, report *ComplianceReport, targets map[string]string, req AlignRequest, actor AuditActor, activations map[string]bool) AlignDeviceResult {
+	result := AlignDeviceResult{DeviceID: device.ID, DeviceName: device.Name, Status: AlignUnchanged}
+	current := report.values[device.ID]
+
+	var steps []ChangeStep
+	var changes []model.PreviewChange
+	var unreadable []string
+	for _, param := range meshParams {
+		target, ok := targets[param.Key]
+		if !ok {
+			continue
+		}
+		value, readable := current[param.Key]
+		if !readable {
+			unreadable = append(unreadable, param.Key)
+			continue
+		}
+		if value == target {
+			continue
+		}
+		steps = append(steps, ChangeStep{Name: param.Key, Command: param.setCommand(target)})
+		changes = append(changes, model.PreviewChange{Key: param.Key, From: param.display(value), To: param.display(target)})
+		activations[param.Activation] = true
+	}
+	if len(unreadable) > 0 {
+		result.Status = AlignSkipped
+		result.Error = fmt.Sprintf("current value of %s could not be read", strings.Join(unreadable, ", "))
+		return result
+	}
+	if len(steps) == 0 {
+		return result
+	}
+
+	if req.DryRun {
+		result.Status = AlignPlanned
+		for _, step := range steps {
+			result.Commands = append(result.Commands, model.AuditCommand{Name: step.Name, Command: step.Command, Status: StepPending})
+		}
+		redactCommands(result.Commands)
+		return result
+	}
+
+	details := "align to majority"
+	if req.ReferenceDeviceID != 0 {
+		details = fmt.Sprintf("align to reference device %d", req.ReferenceDeviceID)
+	}
+	entry := &model.ConfigAudit{
+		DeviceID: device.ID,
+		Category: meshComplianceCategory,
+		Action:   model.AuditActionAlign,
+		Changes:  changes,
+		Details:  details,
+	}
+	changeSet, err := s.changeSet.Apply(device.ID, steps)
+	if err != nil {
+		entry.Error = err.Error()
+		s.audit.Record(actor, entry)
+		result.Status, result.Error = AlignFailed, err.Error()
+		return result
+	}
+	entry.Commands = ChangeSetCommands(changeSet)
+	entry.Error = changeSet.Error
+	s.audit.Record(actor, entry)
+
+	result.Commands = ChangeSetCommands(changeSet)
+	redactCommands(result.Commands)
+	result.RolledBack = changeSet.RolledBack
+	if !changeSet.Success {
+		result.Status, result.Error = AlignFailed, changeSet.Error
+		return result
+	}
+	result.Status = AlignAligned
+
+	if req.Reboot {
+		command, _ := s.deviceComm.FormatCommandByName(device.ID, "reboot_device", nil)
+		response, err := s.deviceComm.SendATCommandByName(device.ID, "reboot_device", nil)
+		s.audit.RecordCommand(actor, device.ID, "reboot_device", command, response, err)
+		if err != nil {
+			log.Printf("Mesh alignment: failed to reboot device %d: %v", device.ID, err)
+			result.Error = fmt.Sprintf("aligned, but reboot failed: %v", err)
+		} else {
+			result.Rebooted = true
+		}
+	}
+	return result
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"backend/internal/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 参数校验规则，对应model.FieldError.Rule
+const (
+	RuleRequired = "required"
+	RuleType     = "type"
+	RuleValues   = "values"
+	RuleRange    = "range"
+	RulePattern  = "pattern"
+	RuleBand     = "band"
+	RuleUnknown  = "unknown"
+)
+
+// 发射功率(dBm)的取值范围，适用于所有单板上名为power的参数
+const (
+	MinRadioPower = -40
+	MaxRadioPower = 40
+)
+
+// ValidationErrors 参数校验失败的字段列表，所有入口返回同一种结构
+type ValidationErrors []model.FieldError
+
+func (e ValidationErrors) Error() string {
+	return strings.Join(e.Messages(), "; ")
+}
+
+// Messages 每个字段一条 "field: message" 形式的描述
+func (e ValidationErrors) Messages() []string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Field + ": " + fe.Message
+	}
+	return messages
+}
+
+// AsValidationErrors 从错误链中取出字段错误
+func AsValidationErrors(err error) (ValidationErrors, bool) {
+	var verrs ValidationErrors
+	if errors.As(err, &verrs) {
+		return verrs, true
+	}
+	return nil, false
+}
+
+// ValidationContext 与设备当前配置相关的交叉校验数据
+type ValidationContext struct {
+	Bands []string // 设备选择的频段(AT^DAOCNDI)，为空时不检查频点所属频段
+}
+
+// withBands 返回使用新频段选择的上下文，用于同一批命令中先改频段再改频点的情况
+func (c *ValidationContext) withBands(bands []string) *ValidationContext {
+	next := ValidationContext{}
+	if c != nil {
+		next = *c
+	}
+	next.Bands = bands
+	return &next
+}
+
+// patternCache 已编译的单板YAML正则
+var patternCache sync.Map
+
+// ValidateCommand 按单板YAML中声明的values、range和pattern校验命令参数，再执行与单板无关的
+// 交叉规则（功率范围、频点所属频段），返回转换为声明类型的参数。参数错误以ValidationErrors返回
+func (m *BoardConfigManager) ValidateCommand(boardType, commandName string, params map[string]interface{}, vctx *ValidationContext) (map[string]interface{}, error) {
+	config, err := m.LoadBoardConfig(boardType)
+	if err != nil {
+		return nil, err
+	}
+	command, ok := config.Commands[commandName]
+	if !ok {
+		return nil, ValidationErrors{{
+			Command: commandName,
+			Field:   "command",
+			Value:   commandName,
+			Rule:    RuleUnknown,
+			Message: fmt.Sprintf("%s is not defined for board type %s", commandName, boardType),
+		}}
+	}
+
+	normalized := make(map[string]interface{}, len(command.Parameters))
+	var errs ValidationErrors
+	for _, param := range command.Parameters {
+		value, exists := params[param.Name]
+		if !exists || value == nil {
+			errs = append(errs, model.FieldError{Command: commandName, Field: param.Name, Rule: RuleRequired, Message: "missing required parameter"})
+			continue
+		}
+		converted, fe := checkParameter(param, value)
+		if fe != nil {
+			fe.Command = commandName
+			errs = append(errs, *fe)
+			continue
+		}
+		normalized[param.Name] = converted
+	}
+	errs = append(errs, crossFieldErrors(commandName, normalized, vctx)...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return normalized, nil
+}
+
+// checkParameter 校验单个参数，整数参数接受JSON数字和数字字符串
+func checkParameter(param BoardParameter, value interface{}) (interface{}, *model.FieldError) {
+	fail := func(rule, format string, args ...interface{}) (interface{}, *model.FieldError) {
+		return nil, &model.FieldError{Field: param.Name, Value: value, Rule: rule, Message: fmt.Sprintf(format, args...)}
+	}
+
+	switch param.Type {
+	case "int":
+		n, ok := intValue(value)
+		if !ok {
+			return fail(RuleType, "must be an integer")
+		}
+		if len(param.Range) == 2 && (n < param.Range[0] || n > param.Range[1]) {
+			return fail(RuleRange, "value %d out of range [%d, %d]", n, param.Range[0], param.Range[1])
+		}
+		if len(param.Values) > 0 {
+			found := false
+			for _, allowed := range param.Values {
+				if a, ok := intValue(allowed); ok && a == n {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fail(RuleValues, "value %d not in allowed values %v", n, param.Values)
+			}
+		}
+		return n, nil
+
+	case "string":
+		str, ok := stringValue(value)
+		if !ok {
+			return fail(RuleType, "must be a string")
+		}
+		if param.Pattern != "" {
+			re, err := compilePattern(param.Pattern)
+			if err != nil {
+				return fail(RulePattern, "board config pattern %q is invalid: %v", param.Pattern, err)
+			}
+			if !re.MatchString(str) {
+				return fail(RulePattern, "value %q does not match pattern %s", str, param.Pattern)
+			}
+		}
+		if len(param.Values) > 0 {
+			found := false
+			for _, allowed := range param.Values {
+				if fmt.Sprint(allowed) == str {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fail(RuleValues, "value %q not in allowed values %v", str, param.Values)
+			}
+		}
+		return str, nil
+	}
+	return value, nil
+}
+
+// crossFieldErrors 与单板YAML无关的规则：发射功率必须在-40..40 dBm之间；
+// 已知设备选择的频段时，频点必须落在其中之一
+func crossFieldErrors(commandName string, params map[string]interface{}, vctx *ValidationContext) ValidationErrors {
+	var errs ValidationErrors
+	if value, ok := params["power"]; ok {
+		power, isInt := intValue(value)
+		switch {
+		case !isInt:
+			errs = append(errs, model.FieldError{Command: commandName, Field: "power", Value: value, Rule: RuleType, Message: "must be an integer dBm value"})
+		case power < MinRadioPower || power > MaxRadioPower:
+			errs = append(errs, model.FieldError{Command: commandName, Field: "power", Value: value, Rule: RuleRange,
+				Message: fmt.Sprintf("value %d out of range [%d, %d] dBm", power, MinRadioPower, MaxRadioPower)})
+		}
+	}
+	if value, ok := params["freq"]; ok && vctx != nil && len(vctx.Bands) > 0 {
+		if freq, isInt := intValue(value); isInt && !FrequencyInBands(freq, vctx.Bands) {
+			errs = append(errs, model.FieldError{Command: commandName, Field: "freq", Value: value, Rule: RuleBand,
+				Message: fmt.Sprintf("frequency %d is outside the selected bands (%s)", freq, bandRanges(vctx.Bands))})
+		}
+	}
+	return errs
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patternCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(pattern, re)
+	return re, nil
+}
+
+// intValue 将JSON数字、YAML整数和数字字符串转换为int
+func intValue(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case int32:
+		return int(v), true
+	case uint:
+		return int(v), true
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, false
+		}
+		return int(v), true
+	case json.Number:
+		n, err := strconv.Atoi(v.String())
+		return n, err == nil
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// stringValue 字符串参数也接受整数，例如功率27
+func stringValue(value interface{}) (string, bool) {
+	if s, ok := value.(string); ok {
+		return s, true
+	}
+	if n, ok := intValue(value); ok {
+		return strconv.Itoa(n), true
+	}
+	return "", false
+}
+
+// ValidationContext 读取设备已保存的频段选择，用于频点的交叉校验
+func (s *DeviceCommService) ValidationContext(deviceID uint) *ValidationContext {
+	var wireless model.WirelessConfig
+	if err := s.db.Where("device_id = ?", deviceID).First(&wireless).Error; err != nil {
+		return &ValidationContext{}
+	}
+	return &ValidationContext{Bands: wireless.GetFrequencyBandArray()}
+}
+
+// ValidateCommand 按设备的单板类型和当前频段选择校验命名命令的参数
+func (s *DeviceCommService) ValidateCommand(deviceID uint, commandName string, params map[string]interface{}) error {
+	device, err := s.getDeviceByID(deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to get device: %v", err)
+	}
+	_, err = s.boardConfigMgr.ValidateCommand(device.BoardType, commandName, params, s.ValidationContext(deviceID))
+	return err
+}
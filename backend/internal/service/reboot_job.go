@@ -0,0 +1,728 @@
+package service
+
+import (
+	"backend/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultRebootTimeout      = 300 // seconds
+	defaultRebootCheckTimeout = 120 // seconds
+	// rebootDownWait is how long a device may keep answering after the reboot
+	// command; one still answering after that is assumed to have rebooted
+	// between two probes.
+	rebootDownWait = 30 * time.Second
+	rebootPollMin  = time.Second
+	rebootPollMax  = 15 * time.Second
+)
+
+var (
+	// ErrRebootJobInvalid wraps validation failures of a reboot job request.
+	ErrRebootJobInvalid = errors.New("invalid reboot job")
+	// ErrRebootJobNotRunning is returned when aborting a finished reboot job.
+	ErrRebootJobNotRunning = errors.New("reboot job is not running")
+)
+
+// rebootCheckQueries 各项检查使用的单板查询命令
+var rebootCheckQueries = map[string]string{
+	model.RebootCheckFirmware: "get_device_info",
+	model.RebootCheckAccess:   "get_access_state",
+	model.RebootCheckRadio:    "get_radio_params",
+}
+
+var defaultRebootChecks = []string{
+	model.RebootCheckFirmware,
+	model.RebootCheckAccess,
+	model.RebootCheckNeighbors,
+	model.RebootCheckRadio,
+}
+
+func rebootJobWorkerName(id uint) string {
+	return fmt.Sprintf("reboot_job_%d", id)
+}
+
+// RebootJobRequest describes a reboot of one device or a rolling reboot of a group.
+type RebootJobRequest struct {
+	Name            string   `json:"name"`
+	RootDeviceID    uint     `json:"root_device_id"` // the node nearest to the backend; required for more than one device
+	DeviceIDs       []uint   `json:"device_ids"`
+	MaxDown         int      `json:"max_down"`    // max nodes the network may lose at once, default 1
+	PostChecks      []string `json:"post_checks"` // omitted = all checks, [] = none
+	Timeout         int      `json:"timeout"`
+	CheckTimeout    int      `json:"check_timeout"`
+	RefreshTopology bool     `json:"refresh_topology"` // run neighbor discovery before planning the waves
+	DryRun          bool     `json:"dry_run"`
+}
+
+type rebootJobRun struct {
+	actor   AuditActor
+	cancel  context.CancelFunc
+	aborted bool
+}
+
+// RebootJobService 重启作业：发送重启命令后观察设备下线，按退避间隔探测直到设备重新应答AT，
+// 再检查固件版本、接入状态、邻居和无线参数与重启前一致，并统计停机时间。多台设备按拓扑分批
+// 重启，每批（连同其下游被断开的节点）最多使网络失去max_down个节点
+type RebootJobService struct {
+	db         *gorm.DB
+	deviceComm *DeviceCommService
+	rollout    *RolloutService
+	audit      *AuditService
+	supervisor *Supervisor
+
+	mu   sync.Mutex
+	runs map[uint]*rebootJobRun
+}
+
+// NewRebootJobService 创建重启作业服务
+func NewRebootJobService(db *gorm.DB, deviceComm *DeviceCommService, rollout *RolloutService, audit *AuditService, supervisor *Supervisor) *RebootJobService {
+	return &RebootJobService{
+		db:         db,
+		deviceComm: deviceComm,
+		rollout:    rollout,
+		audit:      audit,
+		supervisor: supervisor,
+		runs:       make(map[uint]*rebootJobRun),
+	}
+}
+
+// Start 将上次运行中断的重启作业标记为interrupted
+func (s *RebootJobService) Start() {
+	err := s.db.Model(&model.RebootJob{}).Where("status = ?", model.RebootJobRunning).Updates(map[string]interface{}{
+		"status":      model.RebootJobInterrupted,
+		"error":       "the backend stopped during the reboot job; check the devices of the current wave",
+		"finished_at": time.Now(),
+	}).Error
+	if err != nil {
+		log.Printf("Failed to mark interrupted reboot jobs: %v", err)
+	}
+}
+
+// Plan 校验请求并规划重启批次，不修改任何设备
+func (s *RebootJobService) Plan(req RebootJobRequest) (*model.RebootJob, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrRebootJobInvalid, fmt.Sprintf(format, args...))
+	}
+	if len(req.DeviceIDs) == 0 {
+		return nil, invalid("device_ids is required")
+	}
+	if req.MaxDown < 0 || req.Timeout < 0 || req.CheckTimeout < 0 {
+		return nil, invalid("max_down, timeout and check_timeout must not be negative")
+	}
+	checks, err := rebootChecks(req.PostChecks)
+	if err != nil {
+		return nil, invalid("%v", err)
+	}
+
+	var devices []model.Device
+	if err := s.db.Where("id IN ?", req.DeviceIDs).Order("id").Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	if len(devices) != len(uniqueIDs(req.DeviceIDs)) {
+		return nil, invalid("device_ids contains unknown devices")
+	}
+	targets := make([]model.RebootDevice, 0, len(devices))
+	for _, d := range devices {
+		command, err := s.deviceComm.FormatCommandByName(d.ID, "reboot_device", nil)
+		if err != nil {
+			return nil, invalid("device %s has no reboot_device command: %v", d.Name, err)
+		}
+		targets = append(targets, model.RebootDevice{DeviceID: d.ID, Name: d.Name, NodeID: d.NodeID, Command: command, Status: model.RebootDevicePending})
+	}
+
+	job := &model.RebootJob{
+		Name:         req.Name,
+		RootDeviceID: req.RootDeviceID,
+		MaxDown:      req.MaxDown,
+		PostChecks:   checks,
+		Timeout:      req.Timeout,
+		CheckTimeout: req.CheckTimeout,
+	}
+	if job.MaxDown == 0 {
+		job.MaxDown = 1
+	}
+	if job.Timeout == 0 {
+		job.Timeout = defaultRebootTimeout
+	}
+	if job.CheckTimeout == 0 {
+		job.CheckTimeout = defaultRebootCheckTimeout
+	}
+
+	if req.RootDeviceID == 0 {
+		if len(targets) > 1 {
+			return nil, invalid("root_device_id is required to plan a reboot of more than one device")
+		}
+		job.Waves = []model.RebootWave{{Index: 1, Status: model.RebootDevicePending, Lost: []string{targets[0].Name}, Devices: targets}}
+	} else {
+		waves, err := s.planWaves(req, targets, job.MaxDown)
+		if err != nil {
+			return nil, err
+		}
+		job.Waves = waves
+	}
+
+	for _, wave := range job.Waves {
+		for _, d := range wave.Devices {
+			job.DeviceIDs = append(job.DeviceIDs, d.DeviceID)
+		}
+	}
+	if job.Name == "" {
+		job.Name = fmt.Sprintf("reboot of %s", targets[0].Name)
+		if len(targets) > 1 {
+			job.Name = fmt.Sprintf("rolling reboot of %d devices in %d waves", len(targets), len(job.Waves))
+		}
+	}
+	return job, nil
+}
+
+// planWaves 从最远跳数的节点开始分批：重启的节点不转发，根节点因此无法到达的节点都计为失去的节点，
+// 每批失去的节点数不超过maxDown
+func (s *RebootJobService) planWaves(req RebootJobRequest, targets []model.RebootDevice, maxDown int) ([]model.RebootWave, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrRebootJobInvalid, fmt.Sprintf(format, args...))
+	}
+	var root model.Device
+	if err := s.db.First(&root, req.RootDeviceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, invalid("root device %d not found", req.RootDeviceID)
+		}
+		return nil, err
+	}
+	var all []model.Device
+	if err := s.db.Order("id").Find(&all).Error; err != nil {
+		return nil, err
+	}
+	if req.RefreshTopology {
+		s.rollout.refreshTopology(all)
+	}
+	names := make(map[uint]string, len(all))
+	for _, d := range all {
+		names[d.ID] = d.Name
+	}
+	var links []model.DeviceLink
+	if err := s.db.Find(&links).Error; err != nil {
+		return nil, err
+	}
+
+	hops := reachableHops(links, root.ID, nil)
+	var unreachable []string
+	for i := range targets {
+		hop, ok := hops[targets[i].DeviceID]
+		if !ok {
+			unreachable = append(unreachable, targets[i].Name)
+			continue
+		}
+		targets[i].Hop = hop
+	}
+	if len(unreachable) > 0 {
+		return nil, invalid("devices %s are not connected to the root in the current topology; run neighbor discovery (refresh_topology) first", strings.Join(unreachable, ", "))
+	}
+	sort.SliceStable(targets, func(i, j int) bool {
+		if targets[i].Hop != targets[j].Hop {
+			return targets[i].Hop > targets[j].Hop
+		}
+		return targets[i].DeviceID < targets[j].DeviceID
+	})
+
+	lost := func(ids []uint) []uint {
+		after := reachableHops(links, root.ID, uniqueIDs(ids))
+		set := make(map[uint]bool)
+		for id := range hops {
+			if _, ok := after[id]; !ok {
+				set[id] = true
+			}
+		}
+		return sortedIDs(set)
+	}
+	var tooMany []string
+	for _, t := range targets {
+		if n := len(lost([]uint{t.DeviceID})); n > maxDown {
+			tooMany = append(tooMany, fmt.Sprintf("%s takes down %d nodes", t.Name, n))
+		}
+	}
+	if len(tooMany) > 0 {
+		return nil, invalid("max_down %d is too small: %s", maxDown, strings.Join(tooMany, ", "))
+	}
+
+	var waves []model.RebootWave
+	for remaining := targets; len(remaining) > 0; {
+		wave := model.RebootWave{Index: len(waves) + 1, Status: model.RebootDevicePending}
+		var ids []uint
+		var rest []model.RebootDevice
+		for _, t := range remaining {
+			if len(lost(append(append([]uint(nil), ids...), t.DeviceID))) <= maxDown {
+				ids = append(ids, t.DeviceID)
+				wave.Devices = append(wave.Devices, t)
+			} else {
+				rest = append(rest, t)
+			}
+		}
+		for _, id := range lost(ids) {
+			wave.Lost = append(wave.Lost, names[id])
+		}
+		waves = append(waves, wave)
+		remaining = rest
+	}
+	return waves, nil
+}
+
+func rebootChecks(requested []string) ([]string, error) {
+	if requested == nil {
+		return append([]string(nil), defaultRebootChecks...), nil
+	}
+	seen := make(map[string]bool)
+	checks := []string{}
+	for _, name := range requested {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case model.RebootCheckFirmware, model.RebootCheckAccess, model.RebootCheckNeighbors, model.RebootCheckRadio:
+		default:
+			return nil, fmt.Errorf("unknown post-check %q (supported: %s)", name, strings.Join(defaultRebootChecks, ", "))
+		}
+		if !seen[name] {
+			seen[name] = true
+			checks = append(checks, name)
+		}
+	}
+	return checks, nil
+}
+
+// Confirmation 重启作业需要确认的危险命令：单台设备为其重启命令，多台设备为排序后的设备列表
+func (s *RebootJobService) Confirmation(job *model.RebootJob) *DestructiveCommand {
+	if len(job.DeviceIDs) == 1 {
+		d := job.Waves[0].Devices[0]
+		return &DestructiveCommand{DeviceID: d.DeviceID, CommandName: "reboot_device", Command: d.Command, Kind: DestructiveReboot}
+	}
+	ids := sortedIDs(uniqueIDs(job.DeviceIDs))
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return &DestructiveCommand{CommandName: "reboot_job", Command: "REBOOT " + strings.Join(parts, ","), Kind: DestructiveReboot}
+}
+
+// Run 保存并在后台执行已规划的重启作业
+func (s *RebootJobService) Run(job *model.RebootJob, actor AuditActor) (*model.RebootJob, error) {
+	now := time.Now()
+	job.Status = model.RebootJobRunning
+	job.CreatedBy = actor.Username
+	job.StartedAt = &now
+	if err := s.db.Create(job).Error; err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(s.supervisor.Context())
+	run := &rebootJobRun{actor: actor, cancel: cancel}
+	s.mu.Lock()
+	s.runs[job.ID] = run
+	s.mu.Unlock()
+
+	// 工作协程修改自己的副本，返回给调用方的记录不受影响
+	worker := *job
+	worker.Waves = make([]model.RebootWave, len(job.Waves))
+	for i, wave := range job.Waves {
+		wave.Devices = append([]model.RebootDevice(nil), wave.Devices...)
+		worker.Waves[i] = wave
+	}
+	s.supervisor.Go(rebootJobWorkerName(job.ID), func(context.Context) error {
+		defer cancel()
+		return s.execute(ctx, &worker, run)
+	})
+	return job, nil
+}
+
+// List 返回重启作业，新的在前；deviceID不为0时只返回包含该设备的作业
+func (s *RebootJobService) List(deviceID uint) ([]model.RebootJob, error) {
+	var jobs []model.RebootJob
+	if err := s.db.Order("id DESC").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	if deviceID == 0 {
+		return jobs, nil
+	}
+	filtered := []model.RebootJob{}
+	for _, job := range jobs {
+		if containsID(job.DeviceIDs, deviceID) {
+			filtered = append(filtered, job)
+		}
+	}
+	return filtered, nil
+}
+
+// Get 返回重启作业及其进度
+func (s *RebootJobService) Get(id uint) (*model.RebootJob, error) {
+	var job model.RebootJob
+	if err := s.db.First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Abort 停止重启作业：当前批次不再等待，后续批次不再重启
+func (s *RebootJobService) Abort(id uint) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	run, ok := s.runs[id]
+	if ok {
+		run.aborted = true
+	}
+	s.mu.Unlock()
+	if !ok {
+		return ErrRebootJobNotRunning
+	}
+	run.cancel()
+	return nil
+}
+
+// aborted 读取运行的中止标记；Abort在s.mu下设置该标记
+func (s *RebootJobService) aborted(run *rebootJobRun) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return run.aborted
+}
+
+// execute 逐批重启；任一设备未恢复或检查失败时停止，后续批次不再重启
+func (s *RebootJobService) execute(ctx context.Context, job *model.RebootJob, run *rebootJobRun) error {
+	defer func() {
+		s.mu.Lock()
+		delete(s.runs, job.ID)
+		s.mu.Unlock()
+	}()
+
+	var failure error
+	for i := range job.Waves {
+		job.CurrentWave = i + 1
+		if failure = s.runWave(ctx, job, i, run); failure != nil {
+			break
+		}
+	}
+	for i := range job.Waves {
+		for j := range job.Waves[i].Devices {
+			if d := &job.Waves[i].Devices[j]; d.Status == model.RebootDevicePending {
+				d.Status = model.RebootDeviceSkipped
+			}
+		}
+	}
+
+	aborted := s.aborted(run)
+	switch {
+	case failure == nil:
+		s.finish(job, model.RebootJobCompleted, "")
+	case aborted:
+		s.finish(job, model.RebootJobAborted, "aborted by user")
+	case ctx.Err() != nil:
+		s.finish(job, model.RebootJobInterrupted, "the backend stopped during the reboot job; check the devices of the current wave")
+	default:
+		s.finish(job, model.RebootJobFailed, failure.Error())
+	}
+	return failure
+}
+
+func (s *RebootJobService) runWave(ctx context.Context, job *model.RebootJob, index int, run *rebootJobRun) error {
+	wave := &job.Waves[index]
+	now := time.Now()
+	wave.StartedAt = &now
+	wave.Status = model.RebootJobRunning
+	s.save(job)
+	fail := func(err error) error {
+		finished := time.Now()
+		wave.FinishedAt = &finished
+		wave.Status = model.RebootDeviceFailed
+		s.save(job)
+		return fmt.Errorf("wave %d: %v", wave.Index, err)
+	}
+
+	// 1. 重启前确认设备在线，并记录各项检查的原值
+	for i := range wave.Devices {
+		d := &wave.Devices[i]
+		if status, _ := s.deviceComm.GetDeviceStatus(d.DeviceID); status != "Online" {
+			d.Status, d.Error = model.RebootDeviceFailed, "device is offline before the reboot"
+			return fail(fmt.Errorf("device %s is offline before the reboot", d.Name))
+		}
+		if err := s.baseline(d, job.PostChecks); err != nil {
+			d.Status, d.Error = model.RebootDeviceFailed, err.Error()
+			return fail(fmt.Errorf("device %s: %v", d.Name, err))
+		}
+	}
+	s.save(job)
+
+	// 2. 逐台发送重启命令
+	details := fmt.Sprintf("reboot job %d wave %d", job.ID, wave.Index)
+	for i := range wave.Devices {
+		if ctx.Err() != nil {
+			return fail(ctx.Err())
+		}
+		s.send(&wave.Devices[i], run.actor, details)
+	}
+	s.save(job)
+
+	// 3. 等待设备重新应答AT，再逐台检查
+	waitErr := s.waitBack(ctx, job, wave)
+	if waitErr == nil {
+		for i := range wave.Devices {
+			if d := &wave.Devices[i]; d.Status == model.RebootDeviceChecking {
+				s.postCheck(ctx, job, d)
+				s.save(job)
+			}
+		}
+	}
+
+	first, last := time.Time{}, time.Time{}
+	for _, d := range wave.Devices {
+		if d.SentAt != nil && (first.IsZero() || d.SentAt.Before(first)) {
+			first = *d.SentAt
+		}
+		up := time.Now()
+		if d.UpAt != nil {
+			up = *d.UpAt
+		}
+		if d.SentAt != nil && up.After(last) {
+			last = up
+		}
+	}
+	if !first.IsZero() {
+		wave.DowntimeSeconds = roundSeconds(last.Sub(first))
+		job.DowntimeSeconds = math.Round((job.DowntimeSeconds+wave.DowntimeSeconds)*10) / 10
+	}
+	if waitErr != nil {
+		return fail(waitErr)
+	}
+
+	var failed []string
+	for _, d := range wave.Devices {
+		if d.Status != model.RebootDevicePassed {
+			failed = append(failed, fmt.Sprintf("%s (%s)", d.Name, d.Error))
+		}
+	}
+	if len(failed) > 0 {
+		return fail(errors.New(strings.Join(failed, ", ")))
+	}
+	finished := time.Now()
+	wave.FinishedAt = &finished
+	wave.Status = model.RebootDevicePassed
+	s.save(job)
+	return nil
+}
+
+// baseline 记录重启前的版本、接入状态、无线参数和邻居；单板没有对应查询命令的检查跳过
+func (s *RebootJobService) baseline(d *model.RebootDevice, checks []string) error {
+	d.Checks = nil
+	for _, name := range checks {
+		check := model.RebootCheck{Name: name}
+		if name == model.RebootCheckNeighbors {
+			neighbors, err := s.rollout.discoverNeighbors(d.DeviceID)
+			if err != nil {
+				return fmt.Errorf("neighbor discovery failed: %v", err)
+			}
+			d.NeighborsBefore = neighbors
+			check.Before = strings.Join(neighbors, ",")
+			if len(neighbors) == 0 {
+				check.Status, check.Message = model.RebootCheckSkipped, "no neighbors before the reboot"
+			}
+		} else {
+			value, supported, err := s.queryValue(d.DeviceID, rebootCheckQueries[name])
+			switch {
+			case !supported:
+				check.Status, check.Message = model.RebootCheckSkipped, fmt.Sprintf("board has no %s command", rebootCheckQueries[name])
+			case err != nil:
+				return fmt.Errorf("reading %s before the reboot failed: %v", name, err)
+			default:
+				check.Before = value
+			}
+		}
+		d.Checks = append(d.Checks, check)
+	}
+	return nil
+}
+
+func (s *RebootJobService) send(d *model.RebootDevice, actor AuditActor, details string) {
+	response, err := s.deviceComm.SendATCommand(d.DeviceID, d.Command)
+	s.audit.RecordCommand(actor, d.DeviceID, "reboot_device", d.Command, response, err)
+	d.Response = response
+	if err != nil {
+		d.Status, d.Error = model.RebootDeviceFailed, fmt.Sprintf("reboot command failed: %v", err)
+		return
+	}
+	now := time.Now()
+	d.SentAt = &now
+	d.Status = model.RebootDeviceRebooting
+	s.db.Create(&model.DeviceLog{
+		DeviceID:  d.DeviceID,
+		Type:      "reboot",
+		Message:   fmt.Sprintf("%s: reboot sent by %s", details, actor.Username),
+		CreatedAt: now,
+	})
+}
+
+// waitBack 按退避间隔探测本批设备：先观察到设备不可达，再等待其重新应答AT
+func (s *RebootJobService) waitBack(ctx context.Context, job *model.RebootJob, wave *model.RebootWave) error {
+	timeout := time.Duration(job.Timeout) * time.Second
+	interval := rebootPollMin
+	for {
+		pending := 0
+		for i := range wave.Devices {
+			d := &wave.Devices[i]
+			if d.Status != model.RebootDeviceRebooting && d.Status != model.RebootDeviceDown {
+				continue
+			}
+			d.Polls++
+			now := time.Now()
+			if !s.answersAT(d.DeviceID) {
+				if d.DownAt == nil {
+					// 设备刚下线，重新从最短间隔开始探测
+					d.DownAt, d.Status = &now, model.RebootDeviceDown
+					interval = rebootPollMin
+				}
+			} else if d.DownAt != nil || now.Sub(*d.SentAt) >= rebootDownWait {
+				d.UpAt, d.Status = &now, model.RebootDeviceChecking
+				d.DowntimeSeconds = roundSeconds(now.Sub(*d.SentAt))
+				continue
+			}
+			if now.Sub(*d.SentAt) > timeout {
+				d.Status, d.Error = model.RebootDeviceUnreachable, fmt.Sprintf("did not answer AT within %ds", job.Timeout)
+				continue
+			}
+			pending++
+		}
+		s.save(job)
+		if pending == 0 {
+			return nil
+		}
+		if err := sleepContext(ctx, interval); err != nil {
+			return err
+		}
+		if interval *= 2; interval > rebootPollMax {
+			interval = rebootPollMax
+		}
+	}
+}
+
+func (s *RebootJobService) answersAT(deviceID uint) bool {
+	response, err := s.deviceComm.SendATCommand(deviceID, "AT")
+	return err == nil && strings.Contains(response, "OK")
+}
+
+// postCheck 比较重启前后的版本、接入状态和无线参数，再等待原有邻居全部重新发现
+func (s *RebootJobService) postCheck(ctx context.Context, job *model.RebootJob, d *model.RebootDevice) {
+	for i := range d.Checks {
+		check := &d.Checks[i]
+		if check.Status == model.RebootCheckSkipped || check.Name == model.RebootCheckNeighbors {
+			continue
+		}
+		check.Attempts++
+		value, _, err := s.queryValue(d.DeviceID, rebootCheckQueries[check.Name])
+		check.After = value
+		switch {
+		case err != nil:
+			check.Status, check.Message = model.RebootCheckFailed, err.Error()
+		case strings.Join(splitFields(check.Before), ",") != strings.Join(splitFields(value), ","):
+			check.Status, check.Message = model.RebootCheckFailed, fmt.Sprintf("changed from %s to %s", check.Before, value)
+		default:
+			check.Status = model.RebootCheckPassed
+		}
+	}
+	for i := range d.Checks {
+		if check := &d.Checks[i]; check.Name == model.RebootCheckNeighbors && check.Status != model.RebootCheckSkipped {
+			s.checkNeighbors(ctx, job, d, check)
+		}
+	}
+
+	var failed []string
+	for _, check := range d.Checks {
+		if check.Status == model.RebootCheckFailed {
+			failed = append(failed, fmt.Sprintf("%s: %s", check.Name, check.Message))
+		}
+	}
+	if len(failed) > 0 {
+		d.Status, d.Error = model.RebootDeviceFailed, "post-check failed: "+strings.Join(failed, "; ")
+		return
+	}
+	d.Status, d.Error = model.RebootDevicePassed, ""
+}
+
+func (s *RebootJobService) checkNeighbors(ctx context.Context, job *model.RebootJob, d *model.RebootDevice, check *model.RebootCheck) {
+	deadline := time.Now().Add(time.Duration(job.CheckTimeout) * time.Second)
+	for {
+		check.Attempts++
+		neighbors, err := s.rollout.discoverNeighbors(d.DeviceID)
+		var missing []string
+		if err != nil {
+			check.Message = fmt.Sprintf("neighbor discovery failed: %v", err)
+		} else {
+			d.NeighborsAfter = neighbors
+			check.After = strings.Join(neighbors, ",")
+			seen := make(map[string]bool, len(neighbors))
+			for _, n := range neighbors {
+				seen[n] = true
+			}
+			for _, n := range d.NeighborsBefore {
+				if !seen[n] {
+					missing = append(missing, n)
+				}
+			}
+			if len(missing) == 0 {
+				if err := s.rollout.topology.UpdateDeviceLinks(d.DeviceID, neighbors); err != nil {
+					log.Printf("Failed to update links of device %d: %v", d.DeviceID, err)
+				}
+				check.Status, check.Message = model.RebootCheckPassed, ""
+				return
+			}
+			check.Message = "not re-discovered: " + strings.Join(missing, ", ")
+		}
+		if time.Now().After(deadline) {
+			check.Status = model.RebootCheckFailed
+			check.Message += fmt.Sprintf(" after %ds", job.CheckTimeout)
+			return
+		}
+		if err := sleepContext(ctx, rolloutPollInterval); err != nil {
+			check.Status, check.Message = model.RebootCheckFailed, "stopped before the neighbors were re-discovered"
+			return
+		}
+	}
+}
+
+// queryValue 按命令名查询设备上报的值；单板没有该命令时supported为false
+func (s *RebootJobService) queryValue(deviceID uint, commandName string) (value string, supported bool, err error) {
+	query, err := s.deviceComm.FormatCommandByName(deviceID, commandName, nil)
+	if err != nil {
+		return "", false, nil
+	}
+	response, err := s.deviceComm.SendATCommand(deviceID, query)
+	if err != nil {
+		return "", true, err
+	}
+	value, err = extractReportedValue(query, response)
+	return value, true, err
+}
+
+func roundSeconds(d time.Duration) float64 {
+	return math.Round(d.Seconds()*10) / 10
+}
+
+func (s *RebootJobService) finish(job *model.RebootJob, status, message string) {
+	now := time.Now()
+	job.Status = status
+	job.Error = message
+	job.FinishedAt = &now
+	s.save(job)
+	log.Printf("Reboot job %d finished: %s %s", job.ID, status, message)
+}
+
+func (s *RebootJobService) save(job *model.RebootJob) {
+	if err := s.db.Save(job).Error; err != nil {
+		log.Printf("Failed to save reboot job %d: %v", job.ID, err)
+	}
+}
@@ -0,0 +1,857 @@
+package service
+
+import (
+	"backend/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultRolloutRejoinTimeout = 180 // seconds
+	defaultRolloutSettleTime    = 10  // seconds
+	rolloutPollInterval         = 5 * time.Second
+)
+
+var (
+	// ErrRolloutInvalid wraps validation failures of a rollout request.
+	ErrRolloutInvalid = errors.New("invalid rollout")
+	// ErrRolloutNotRunning is returned when aborting a finished rollout.
+	ErrRolloutNotRunning = errors.New("rollout is not running")
+)
+
+func rolloutWorkerName(id uint) string {
+	return fmt.Sprintf("rollout_%d", id)
+}
+
+// RolloutRequest describes a mesh-wide radio change.
+type RolloutRequest struct {
+	Name            string              `json:"name"`
+	RootDeviceID    uint                `json:"root_device_id"` // the node nearest to the backend, changed last
+	DeviceIDs       []uint              `json:"device_ids"`     // empty = every device connected to the root
+	Change          model.RolloutChange `json:"change"`
+	Reboot          bool                `json:"reboot"`
+	WaveSize        int                 `json:"wave_size"`
+	RejoinTimeout   int                 `json:"rejoin_timeout"`
+	SettleTime      int                 `json:"settle_time"`
+	RefreshTopology bool                `json:"refresh_topology"` // run neighbor discovery before ordering the devices
+	DryRun          bool                `json:"dry_run"`
+}
+
+// rolloutRun is the in-memory state of a running rollout: the change with
+// its secret and the change sets needed to roll devices back.
+type rolloutRun struct {
+	change  model.RolloutChange
+	actor   AuditActor
+	cancel  context.CancelFunc
+	aborted bool
+	applied map[uint]*ChangeSetResult
+	order   []uint // devices in the order they were changed
+}
+
+// RolloutService 拓扑感知的分批变更：按当前拓扑从最远跳数的节点开始向根节点逐批修改
+// 频点、带宽、建链频段或接入密码，每批等待节点重新入网并通过状态检查和邻居发现验证，
+// 超时未恢复则停止并自动回滚已修改的节点
+type RolloutService struct {
+	db            *gorm.DB
+	deviceComm    *DeviceCommService
+	changeSet     *ChangeSetExecutor
+	topology      *TopologyService
+	configService *ConfigService
+	audit         *AuditService
+	supervisor    *Supervisor
+
+	mu   sync.Mutex
+	runs map[uint]*rolloutRun
+}
+
+// NewRolloutService 创建分批变更服务
+func NewRolloutService(db *gorm.DB, deviceComm *DeviceCommService, changeSet *ChangeSetExecutor, topology *TopologyService, configService *ConfigService, audit *AuditService, supervisor *Supervisor) *RolloutService {
+	return &RolloutService{
+		db:            db,
+		deviceComm:    deviceComm,
+		changeSet:     changeSet,
+		topology:      topology,
+		configService: configService,
+		audit:         audit,
+		supervisor:    supervisor,
+		runs:          make(map[uint]*rolloutRun),
+	}
+}
+
+// Start 将上次运行中断的变更标记为interrupted：回滚所需的原值只保存在内存中
+func (s *RolloutService) Start() {
+	err := s.db.Model(&model.Rollout{}).Where("status = ?", model.RolloutRunning).Updates(map[string]interface{}{
+		"status":      model.RolloutInterrupted,
+		"error":       "the backend stopped during the rollout; changed devices were not rolled back",
+		"finished_at": time.Now(),
+	}).Error
+	if err != nil {
+		log.Printf("Failed to mark interrupted rollouts: %v", err)
+	}
+}
+
+// Create 规划并启动分批变更；DryRun时只返回分批计划
+func (s *RolloutService) Create(req RolloutRequest, actor AuditActor) (*model.Rollout, error) {
+	if err := validateRolloutChange(req.Change); err != nil {
+		return nil, err
+	}
+	rollout, err := s.plan(req)
+	if err != nil {
+		return nil, err
+	}
+	rollout.CreatedBy = actor.Username
+	if req.DryRun {
+		return rollout, nil
+	}
+
+	now := time.Now()
+	rollout.Status = model.RolloutRunning
+	rollout.StartedAt = &now
+	if err := s.db.Create(rollout).Error; err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(s.supervisor.Context())
+	run := &rolloutRun{change: req.Change, actor: actor, cancel: cancel, applied: make(map[uint]*ChangeSetResult)}
+	s.mu.Lock()
+	s.runs[rollout.ID] = run
+	s.mu.Unlock()
+
+	// 工作协程修改自己的副本，返回给调用方的记录不受影响
+	worker := *rollout
+	worker.Waves = make([]model.RolloutWave, len(rollout.Waves))
+	for i, wave := range rollout.Waves {
+		wave.Devices = append([]model.RolloutDevice(nil), wave.Devices...)
+		worker.Waves[i] = wave
+	}
+	s.supervisor.Go(rolloutWorkerName(rollout.ID), func(context.Context) error {
+		defer cancel()
+		return s.execute(ctx, &worker, run)
+	})
+	return rollout, nil
+}
+
+// List 返回所有分批变更，新的在前
+func (s *RolloutService) List() ([]model.Rollout, error) {
+	var rollouts []model.Rollout
+	err := s.db.Order("id DESC").Find(&rollouts).Error
+	return rollouts, err
+}
+
+// Get 返回分批变更及其进度
+func (s *RolloutService) Get(id uint) (*model.Rollout, error) {
+	var rollout model.Rollout
+	if err := s.db.First(&rollout, id).Error; err != nil {
+		return nil, err
+	}
+	return &rollout, nil
+}
+
+// Abort 停止正在进行的分批变更并回滚已修改的节点
+func (s *RolloutService) Abort(id uint) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	run, ok := s.runs[id]
+	if ok {
+		run.aborted = true
+	}
+	s.mu.Unlock()
+	if !ok {
+		return ErrRolloutNotRunning
+	}
+	run.cancel()
+	return nil
+}
+
+// aborted 读取运行的中止标记；Abort在s.mu下设置该标记
+func (s *RolloutService) aborted(run *rolloutRun) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return run.aborted
+}
+
+func validateRolloutChange(change model.RolloutChange) error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrRolloutInvalid, fmt.Sprintf(format, args...))
+	}
+	if change.Frequency == nil && change.Bandwidth == "" && change.Power == nil && change.BuildingChain == "" && change.AccessPassword == "" {
+		return invalid("change must set frequency, bandwidth, power, building_chain or access_password")
+	}
+	if change.Bandwidth != "" {
+		if _, err := BandwidthValue(change.Bandwidth); err != nil {
+			return invalid("%v", err)
+		}
+	}
+	if change.Power != nil && (*change.Power < -40 || *change.Power > 40) {
+		return invalid("power must be within -40..40")
+	}
+	if change.BuildingChain != "" {
+		if _, err := BuildingChainCommand(change.BuildingChain); err != nil {
+			return invalid("%v", err)
+		}
+	}
+	if change.AccessPassword != "" {
+		if _, err := AccessPasswordCommand(change.AccessPassword); err != nil {
+			return invalid("%v", err)
+		}
+	}
+	return nil
+}
+
+// plan 按跳数从远到近分批，同一跳数内按wave_size拆分，根节点总在最后一批
+func (s *RolloutService) plan(req RolloutRequest) (*model.Rollout, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrRolloutInvalid, fmt.Sprintf(format, args...))
+	}
+	if req.RootDeviceID == 0 {
+		return nil, invalid("root_device_id is required")
+	}
+	if req.WaveSize < 0 || req.RejoinTimeout < 0 || req.SettleTime < 0 {
+		return nil, invalid("wave_size, rejoin_timeout and settle_time must not be negative")
+	}
+	var root model.Device
+	if err := s.db.First(&root, req.RootDeviceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, invalid("root device %d not found", req.RootDeviceID)
+		}
+		return nil, err
+	}
+
+	var devices []model.Device
+	query := s.db.Order("id")
+	if len(req.DeviceIDs) > 0 {
+		query = query.Where("id IN ?", req.DeviceIDs)
+	}
+	if err := query.Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	if len(req.DeviceIDs) > 0 && len(devices) != len(uniqueIDs(req.DeviceIDs)) {
+		return nil, invalid("device_ids contains unknown devices")
+	}
+	if req.RefreshTopology {
+		s.refreshTopology(devices)
+	}
+
+	hops, err := s.hopDistances(root.ID)
+	if err != nil {
+		return nil, err
+	}
+	var targets []model.RolloutDevice
+	var unreachable []string
+	for _, d := range devices {
+		hop, ok := hops[d.ID]
+		if !ok {
+			if len(req.DeviceIDs) > 0 {
+				unreachable = append(unreachable, strconv.FormatUint(uint64(d.ID), 10))
+			}
+			continue
+		}
+		targets = append(targets, model.RolloutDevice{DeviceID: d.ID, Name: d.Name, NodeID: d.NodeID, Hop: hop, Status: model.RolloutDevicePending})
+	}
+	if len(unreachable) > 0 {
+		return nil, invalid("devices %s are not connected to the root in the current topology; run neighbor discovery (refresh_topology) first", strings.Join(unreachable, ", "))
+	}
+	if len(targets) == 0 {
+		return nil, invalid("no devices to change")
+	}
+	waves := planWaves(targets, req.WaveSize)
+
+	deviceIDs := make([]uint, 0, len(targets))
+	for _, t := range targets {
+		deviceIDs = append(deviceIDs, t.DeviceID)
+	}
+	rollout := &model.Rollout{
+		Name:          req.Name,
+		RootDeviceID:  root.ID,
+		DeviceIDs:     deviceIDs,
+		Change:        req.Change,
+		Reboot:        req.Reboot,
+		WaveSize:      req.WaveSize,
+		RejoinTimeout: req.RejoinTimeout,
+		SettleTime:    req.SettleTime,
+		Waves:         waves,
+	}
+	if rollout.RejoinTimeout == 0 {
+		rollout.RejoinTimeout = defaultRolloutRejoinTimeout
+	}
+	if rollout.SettleTime == 0 {
+		rollout.SettleTime = defaultRolloutSettleTime
+	}
+	if rollout.Name == "" {
+		rollout.Name = fmt.Sprintf("rollout of %d devices from %s", len(targets), root.Name)
+	}
+	if rollout.Change.AccessPassword != "" {
+		rollout.Change.AccessPassword = redactedValue
+	}
+	return rollout, nil
+}
+
+// planWaves 将目标设备按跳数从远到近排序（同跳数按设备ID），每个跳数拆成最多waveSize台的批次；
+// waveSize为0时同一跳数为一批。targets按批次顺序重新排列
+func planWaves(targets []model.RolloutDevice, waveSize int) []model.RolloutWave {
+	sort.SliceStable(targets, func(i, j int) bool {
+		if targets[i].Hop != targets[j].Hop {
+			return targets[i].Hop > targets[j].Hop
+		}
+		return targets[i].DeviceID < targets[j].DeviceID
+	})
+
+	var waves []model.RolloutWave
+	for i := 0; i < len(targets); {
+		hop := targets[i].Hop
+		wave := model.RolloutWave{Index: len(waves) + 1, Hop: hop, Status: model.RolloutDevicePending}
+		for i < len(targets) && targets[i].Hop == hop && (waveSize == 0 || len(wave.Devices) < waveSize) {
+			wave.Devices = append(wave.Devices, targets[i])
+			i++
+		}
+		waves = append(waves, wave)
+	}
+	return waves
+}
+
+func uniqueIDs(ids []uint) map[uint]bool {
+	set := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// hopDistances 以设备邻居链路为无向图，从根节点做广度优先搜索
+func (s *RolloutService) hopDistances(rootID uint) (map[uint]int, error) {
+	var links []model.DeviceLink
+	if err := s.db.Find(&links).Error; err != nil {
+		return nil, err
+	}
+	return reachableHops(links, rootID, nil), nil
+}
+
+// reachableHops 根节点到各节点的跳数，removed中的节点（如正在重启的节点）不参与转发；
+// 根节点本身被移除时返回空
+func reachableHops(links []model.DeviceLink, rootID uint, removed map[uint]bool) map[uint]int {
+	hops := make(map[uint]int)
+	if removed[rootID] {
+		return hops
+	}
+	adjacent := make(map[uint][]uint)
+	for _, l := range links {
+		adjacent[l.SourceDeviceID] = append(adjacent[l.SourceDeviceID], l.TargetDeviceID)
+		adjacent[l.TargetDeviceID] = append(adjacent[l.TargetDeviceID], l.SourceDeviceID)
+	}
+	hops[rootID] = 0
+	queue := []uint{rootID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, next := range adjacent[id] {
+			if _, seen := hops[next]; !seen && !removed[next] {
+				hops[next] = hops[id] + 1
+				queue = append(queue, next)
+			}
+		}
+	}
+	return hops
+}
+
+// refreshTopology 通过邻居发现更新设备链路；查询失败的设备保留原有链路
+func (s *RolloutService) refreshTopology(devices []model.Device) {
+	for _, d := range devices {
+		neighbors, err := s.discoverNeighbors(d.ID)
+		if err != nil {
+			log.Printf("Rollout neighbor discovery failed for device %d: %v", d.ID, err)
+			continue
+		}
+		if err := s.topology.UpdateDeviceLinks(d.ID, neighbors); err != nil {
+			log.Printf("Failed to update links of device %d: %v", d.ID, err)
+		}
+	}
+}
+
+// discoverNeighbors 通过AT^DRPR?读取邻居上报，每行第一个字段为邻居节点ID
+func (s *RolloutService) discoverNeighbors(deviceID uint) ([]string, error) {
+	response, err := s.deviceComm.SendATCommand(deviceID, "AT^DRPR?")
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	neighbors := []string{}
+	for _, line := range strings.Split(response, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "^DRPR:") {
+			continue
+		}
+		fields := strings.Split(strings.TrimPrefix(line, "^DRPR:"), ",")
+		// 只有开关状态（如 ^DRPR: 1）的行不是邻居上报
+		if len(fields) < 19 {
+			continue
+		}
+		nodeID := strings.Trim(strings.TrimSpace(fields[0]), "\"")
+		if nodeID != "" && !seen[nodeID] {
+			seen[nodeID] = true
+			neighbors = append(neighbors, nodeID)
+		}
+	}
+	return neighbors, nil
+}
+
+// execute 逐批下发；任一批失败、超时或被中止时逆序回滚所有已修改的节点
+func (s *RolloutService) execute(ctx context.Context, rollout *model.Rollout, run *rolloutRun) error {
+	defer func() {
+		s.mu.Lock()
+		delete(s.runs, rollout.ID)
+		s.mu.Unlock()
+	}()
+
+	var failure error
+	for i := range rollout.Waves {
+		rollout.CurrentWave = i + 1
+		if failure = s.runWave(ctx, rollout, i, run); failure != nil {
+			break
+		}
+	}
+	// 根节点修改后整个网络才重新统一，最后确认所有节点都能看到邻居
+	if failure == nil {
+		failure = s.verifyAll(ctx, rollout)
+	}
+
+	aborted := s.aborted(run)
+	if failure != nil && ctx.Err() != nil && !aborted {
+		s.finish(rollout, model.RolloutInterrupted, "the backend stopped during the rollout; changed devices were not rolled back")
+		return failure
+	}
+	if failure != nil {
+		if aborted {
+			failure = errors.New("aborted by user")
+		}
+		status := model.RolloutRolledBack
+		if !s.rollback(rollout, run) {
+			status = model.RolloutRollbackFailed
+		}
+		s.finish(rollout, status, failure.Error())
+		return failure
+	}
+
+	for _, id := range run.order {
+		if stored := rolloutStoredWireless(run.change); len(stored) > 0 {
+			if err := s.configService.saveDeviceConfigs(id, ConfigCategoryWireless, stored, nil); err != nil {
+				log.Printf("Rollout %d: failed to save wireless config of device %d: %v", rollout.ID, id, err)
+			}
+		}
+	}
+	s.finish(rollout, model.RolloutCompleted, "")
+	return nil
+}
+
+func (s *RolloutService) runWave(ctx context.Context, rollout *model.Rollout, index int, run *rolloutRun) error {
+	wave := &rollout.Waves[index]
+	now := time.Now()
+	wave.StartedAt = &now
+	wave.Status = model.RolloutRunning
+	s.save(rollout)
+	fail := func(err error) error {
+		finished := time.Now()
+		wave.FinishedAt = &finished
+		wave.Status = model.RolloutDeviceFailed
+		s.save(rollout)
+		return fmt.Errorf("wave %d (hop %d): %v", wave.Index, wave.Hop, err)
+	}
+
+	// 1. 修改前确认本批节点在线，并记录其邻居
+	for i := range wave.Devices {
+		d := &wave.Devices[i]
+		if status, _ := s.deviceComm.GetDeviceStatus(d.DeviceID); status != "Online" {
+			d.Status, d.Error = model.RolloutDeviceFailed, "device is offline before the change"
+			return fail(fmt.Errorf("device %s is offline before the change", d.Name))
+		}
+		neighbors, err := s.discoverNeighbors(d.DeviceID)
+		if err != nil {
+			d.Status, d.Error = model.RolloutDeviceFailed, fmt.Sprintf("neighbor discovery failed: %v", err)
+			return fail(fmt.Errorf("device %s: %s", d.Name, d.Error))
+		}
+		d.NeighborsBefore = neighbors
+	}
+
+	// 2. 逐台下发
+	details := fmt.Sprintf("rollout %d wave %d", rollout.ID, wave.Index)
+	for i := range wave.Devices {
+		if ctx.Err() != nil {
+			return fail(ctx.Err())
+		}
+		d := &wave.Devices[i]
+		if err := s.applyDevice(rollout, d, run, details); err != nil {
+			d.Status, d.Error = model.RolloutDeviceFailed, err.Error()
+			return fail(fmt.Errorf("device %s: %v", d.Name, err))
+		}
+		d.Status = model.RolloutDeviceApplied
+		s.save(rollout)
+	}
+
+	// 3. 等待重新入网
+	if err := s.waitRejoin(ctx, rollout, wave.Devices); err != nil {
+		return fail(err)
+	}
+	finished := time.Now()
+	wave.FinishedAt = &finished
+	wave.Status = model.RolloutCompleted
+	s.save(rollout)
+	return nil
+}
+
+// applyDevice 以变更集方式下发，失败时变更集已恢复该设备
+func (s *RolloutService) applyDevice(rollout *model.Rollout, d *model.RolloutDevice, run *rolloutRun, details string) error {
+	device, err := s.deviceComm.getDeviceByID(d.DeviceID)
+	if err != nil {
+		return err
+	}
+	planned, err := s.plannedCommands(d.DeviceID, run.change)
+	if err != nil {
+		return err
+	}
+	commands, _, errs, _ := renderPlannedCommands(s.deviceComm.boardConfigMgr, device.BoardType, s.deviceComm.ValidationContext(d.DeviceID), planned)
+	if len(errs) > 0 {
+		return fmt.Errorf("board validation failed: %s", strings.Join(errs, "; "))
+	}
+
+	result, err := s.changeSet.Apply(d.DeviceID, previewSteps(commands))
+	if err != nil {
+		return err
+	}
+	d.Commands = ChangeSetCommands(result)
+	redactCommands(d.Commands)
+	s.recordAudit(run.actor, d.DeviceID, model.AuditActionConfigChange, ChangeSetCommands(result), result.Error, details)
+	if !result.Success {
+		return errors.New(result.Error)
+	}
+	run.applied[d.DeviceID] = result
+	run.order = append(run.order, d.DeviceID)
+
+	if rollout.Reboot {
+		s.reboot(run.actor, d.DeviceID, details)
+	}
+	return nil
+}
+
+// plannedCommands 依次为建链频段、射频参数和接入密码；未指定的射频参数沿用设备当前值
+func (s *RolloutService) plannedCommands(deviceID uint, change model.RolloutChange) ([]PlannedCommand, error) {
+	var planned []PlannedCommand
+	if change.BuildingChain != "" {
+		cmd, err := BuildingChainCommand(change.BuildingChain)
+		if err != nil {
+			return nil, err
+		}
+		planned = append(planned, cmd)
+	}
+	if change.Frequency != nil || change.Bandwidth != "" || change.Power != nil {
+		freq, bandwidth, power := s.deviceComm.ReadRadioParams(deviceID)
+		if freq == "" || bandwidth == "" {
+			return nil, errors.New("failed to read current radio parameters (AT^DRPC?)")
+		}
+		if power == "" {
+			power = DefaultRadioPower
+		}
+		if change.Frequency != nil {
+			freq = strconv.Itoa(*change.Frequency)
+		}
+		if change.Power != nil {
+			power = strconv.Itoa(*change.Power)
+		}
+		bw, err := strconv.Atoi(bandwidth)
+		if err != nil {
+			return nil, fmt.Errorf("invalid current bandwidth %q", bandwidth)
+		}
+		if change.Bandwidth != "" {
+			bw, _ = BandwidthValue(change.Bandwidth)
+		}
+		f, err := strconv.Atoi(freq)
+		if err != nil {
+			return nil, fmt.Errorf("invalid current frequency %q", freq)
+		}
+		planned = append(planned, RadioParamsCommands(f, bw, power)...)
+	}
+	if change.AccessPassword != "" {
+		cmd, err := AccessPasswordCommand(change.AccessPassword)
+		if err != nil {
+			return nil, err
+		}
+		planned = append(planned, cmd)
+	}
+	return planned, nil
+}
+
+// waitRejoin 等待节点在线。节点修改前的邻居中已经修改过的（包括本批），修改后应能再次看到
+// 至少一个；邻居都还未修改的节点（如第一批的叶子节点）只检查在线
+func (s *RolloutService) waitRejoin(ctx context.Context, rollout *model.Rollout, devices []model.RolloutDevice) error {
+	if err := sleepContext(ctx, time.Duration(rollout.SettleTime)*time.Second); err != nil {
+		return err
+	}
+	changed := rolloutChangedNodes(rollout)
+	deadline := time.Now().Add(time.Duration(rollout.RejoinTimeout) * time.Second)
+	for {
+		pending := 0
+		for i := range devices {
+			d := &devices[i]
+			if d.Status == model.RolloutDeviceRejoined {
+				continue
+			}
+			if s.rejoined(d, changed) {
+				d.Status, d.Error = model.RolloutDeviceRejoined, ""
+			} else {
+				pending++
+			}
+		}
+		s.save(rollout)
+		if pending == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d device(s) did not re-join within %ds: %s", pending, rollout.RejoinTimeout, pendingNames(devices))
+		}
+		if err := sleepContext(ctx, rolloutPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// verifyAll 全部修改后每个节点都应重新看到至少一个同在本次变更中的原有邻居
+func (s *RolloutService) verifyAll(ctx context.Context, rollout *model.Rollout) error {
+	changed := rolloutChangedNodes(rollout)
+	var all []*model.RolloutDevice
+	for i := range rollout.Waves {
+		for j := range rollout.Waves[i].Devices {
+			all = append(all, &rollout.Waves[i].Devices[j])
+		}
+	}
+	deadline := time.Now().Add(time.Duration(rollout.RejoinTimeout) * time.Second)
+	for {
+		var missing []string
+		for _, d := range all {
+			if !s.rejoined(d, changed) {
+				missing = append(missing, d.Name)
+			}
+		}
+		s.save(rollout)
+		if len(missing) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("final verification: %s did not see their neighbors again within %ds", strings.Join(missing, ", "), rollout.RejoinTimeout)
+		}
+		if err := sleepContext(ctx, rolloutPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// rejoined 检查节点在线，并且能看到原有邻居中已修改的节点之一
+func (s *RolloutService) rejoined(d *model.RolloutDevice, changed map[string]bool) bool {
+	if status, _ := s.deviceComm.GetDeviceStatus(d.DeviceID); status != "Online" {
+		d.Error = "device is offline"
+		return false
+	}
+	neighbors, err := s.discoverNeighbors(d.DeviceID)
+	if err != nil {
+		d.Error = fmt.Sprintf("neighbor discovery failed: %v", err)
+		return false
+	}
+	d.NeighborsAfter = neighbors
+	if err := s.topology.UpdateDeviceLinks(d.DeviceID, neighbors); err != nil {
+		log.Printf("Failed to update links of device %d: %v", d.DeviceID, err)
+	}
+
+	var expected []string
+	for _, n := range d.NeighborsBefore {
+		if changed[n] {
+			expected = append(expected, n)
+		}
+	}
+	if len(expected) == 0 {
+		return true
+	}
+	seen := make(map[string]bool, len(neighbors))
+	for _, n := range neighbors {
+		seen[n] = true
+	}
+	for _, n := range expected {
+		if seen[n] {
+			return true
+		}
+	}
+	d.Error = fmt.Sprintf("none of the changed neighbors %s is visible", strings.Join(expected, ", "))
+	return false
+}
+
+// rolloutChangedNodes 已修改（已下发或已重新入网）节点的节点ID
+func rolloutChangedNodes(rollout *model.Rollout) map[string]bool {
+	changed := make(map[string]bool)
+	for _, wave := range rollout.Waves {
+		for _, d := range wave.Devices {
+			if d.Status == model.RolloutDeviceApplied || d.Status == model.RolloutDeviceRejoined {
+				changed[d.NodeID] = true
+			}
+		}
+	}
+	return changed
+}
+
+func pendingNames(devices []model.RolloutDevice) string {
+	var names []string
+	for _, d := range devices {
+		if d.Status != model.RolloutDeviceRejoined {
+			names = append(names, fmt.Sprintf("%s (%s)", d.Name, d.Error))
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// rollback 按修改的逆序恢复原值，即先恢复离根节点近的节点；
+// 离线（如正在重启）的节点最多等待rejoin_timeout后再恢复
+func (s *RolloutService) rollback(rollout *model.Rollout, run *rolloutRun) bool {
+	ok := true
+	details := fmt.Sprintf("rollout %d rollback", rollout.ID)
+	for i := len(run.order) - 1; i >= 0; i-- {
+		id := run.order[i]
+		d := rolloutDevice(rollout, id)
+		result := run.applied[id]
+		s.waitOnline(id, time.Duration(rollout.RejoinTimeout)*time.Second)
+		restored, err := s.changeSet.Revert(id, result)
+		if d != nil {
+			d.Rollback = rollbackCommands(result)
+			redactCommands(d.Rollback)
+			d.Status = model.RolloutDeviceRolledBack
+			if err != nil || !restored {
+				d.Status = model.RolloutDeviceRollbackFailed
+				if err != nil {
+					d.Error = err.Error()
+				}
+			}
+		}
+		cause := ""
+		if err != nil || !restored {
+			ok = false
+			cause = "rollback incomplete"
+			if err != nil {
+				cause = err.Error()
+			}
+		}
+		s.recordAudit(run.actor, id, model.AuditActionRestore, rollbackCommands(result), cause, details)
+		if rollout.Reboot && err == nil {
+			s.reboot(run.actor, id, details)
+		}
+		s.save(rollout)
+	}
+	return ok
+}
+
+func (s *RolloutService) waitOnline(deviceID uint, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if status, _ := s.deviceComm.GetDeviceStatus(deviceID); status == "Online" || time.Now().After(deadline) {
+			return
+		}
+		if sleepContext(s.supervisor.Context(), rolloutPollInterval) != nil {
+			return
+		}
+	}
+}
+
+// rollbackCommands 变更集中已发送的补偿命令
+func rollbackCommands(result *ChangeSetResult) []model.AuditCommand {
+	var commands []model.AuditCommand
+	for _, step := range result.Steps {
+		if step.Rollback == "" {
+			continue
+		}
+		cmd := model.AuditCommand{Name: step.Name, Command: step.Rollback, Status: StepApplied}
+		if step.Status == StepRollbackFailed {
+			cmd.Status, cmd.Error = StepFailed, step.RollbackError
+		}
+		commands = append(commands, cmd)
+	}
+	return commands
+}
+
+func rolloutDevice(rollout *model.Rollout, deviceID uint) *model.RolloutDevice {
+	for i := range rollout.Waves {
+		for j := range rollout.Waves[i].Devices {
+			if rollout.Waves[i].Devices[j].DeviceID == deviceID {
+				return &rollout.Waves[i].Devices[j]
+			}
+		}
+	}
+	return nil
+}
+
+func (s *RolloutService) reboot(actor AuditActor, deviceID uint, details string) {
+	command, _ := s.deviceComm.FormatCommandByName(deviceID, "reboot_device", nil)
+	response, err := s.deviceComm.SendATCommandByName(deviceID, "reboot_device", nil)
+	if err != nil {
+		log.Printf("%s: failed to reboot device %d: %v", details, deviceID, err)
+	}
+	s.audit.RecordCommand(actor, deviceID, "reboot_device", command, response, err)
+}
+
+func (s *RolloutService) recordAudit(actor AuditActor, deviceID uint, action string, commands []model.AuditCommand, cause, details string) {
+	s.audit.Record(actor, &model.ConfigAudit{
+		DeviceID: deviceID,
+		Category: ConfigCategoryWireless,
+		Action:   action,
+		Commands: commands,
+		Error:    cause,
+		Details:  details,
+	})
+}
+
+// rolloutStoredWireless 变更完成后保存到WirelessConfig的字段；接入密码不保存
+func rolloutStoredWireless(change model.RolloutChange) map[string]interface{} {
+	stored := make(map[string]interface{})
+	if change.Frequency != nil {
+		stored["channel"] = *change.Frequency
+	}
+	if change.Bandwidth != "" {
+		stored["bandwidth"] = change.Bandwidth
+	}
+	if change.Power != nil {
+		stored["transmit_power"] = *change.Power
+	}
+	if change.BuildingChain != "" {
+		stored["building_chain"] = change.BuildingChain
+	}
+	return stored
+}
+
+func (s *RolloutService) finish(rollout *model.Rollout, status, message string) {
+	now := time.Now()
+	rollout.Status = status
+	rollout.Error = message
+	rollout.FinishedAt = &now
+	s.save(rollout)
+	log.Printf("Rollout %d finished: %s %s", rollout.ID, status, message)
+}
+
+func (s *RolloutService) save(rollout *model.Rollout) {
+	if err := s.db.Save(rollout).Error; err != nil {
+		log.Printf("Failed to save rollout %d: %v", rollout.ID, err)
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
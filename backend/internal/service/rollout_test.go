@@ -0,0 +1,88 @@
+package service
+
+import (
+	"backend/internal/model"
+	"reflect"
+	"testing"
+)
+
+func meshLinks(pairs ...[2]uint) []model.DeviceLink {
+	out := make([]model.DeviceLink, 0, len(pairs))
+	for _, p := range pairs {
+		out = append(out, model.DeviceLink{SourceDeviceID: p[0], TargetDeviceID: p[1]})
+	}
+	return out
+}
+
+func TestReachableHops(t *testing.T) {
+	// 1 - 2 - 3 - 4, with 1 - 5 - 4 as a second path and 6 - 7 disconnected.
+	mesh := meshLinks([2]uint{1, 2}, [2]uint{3, 2}, [2]uint{3, 4}, [2]uint{1, 5}, [2]uint{5, 4}, [2]uint{6, 7})
+	tests := []struct {
+		name    string
+		root    uint
+		removed map[uint]bool
+		want    map[uint]int
+	}{
+		{name: "shortest path over undirected links", root: 1, want: map[uint]int{1: 0, 2: 1, 5: 1, 3: 2, 4: 2}},
+		{name: "other root", root: 3, want: map[uint]int{3: 0, 2: 1, 4: 1, 1: 2, 5: 2}},
+		{name: "removed node does not forward", root: 1, removed: map[uint]bool{5: true}, want: map[uint]int{1: 0, 2: 1, 3: 2, 4: 3}},
+		{name: "cut off by removed nodes", root: 1, removed: map[uint]bool{2: true, 5: true}, want: map[uint]int{1: 0}},
+		{name: "removed root", root: 1, removed: map[uint]bool{1: true}, want: map[uint]int{}},
+		{name: "isolated root", root: 9, want: map[uint]int{9: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reachableHops(mesh, tt.root, tt.removed); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reachableHops(root %d) = %v, want %v", tt.root, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanWaves(t *testing.T) {
+	// Root 1; hops 2: devices 3, 4, 8; hop 1: devices 2, 5; hop 0: the root.
+	hops := map[uint]int{1: 0, 2: 1, 5: 1, 3: 2, 4: 2, 8: 2}
+	tests := []struct {
+		name     string
+		waveSize int
+		want     [][]uint
+		wantHops []int
+	}{
+		{name: "one wave per hop", waveSize: 0, want: [][]uint{{3, 4, 8}, {2, 5}, {1}}, wantHops: []int{2, 1, 0}},
+		{name: "hops split by wave size", waveSize: 2, want: [][]uint{{3, 4}, {8}, {2, 5}, {1}}, wantHops: []int{2, 2, 1, 0}},
+		{name: "one device per wave", waveSize: 1, want: [][]uint{{3}, {4}, {8}, {2}, {5}, {1}}, wantHops: []int{2, 2, 2, 1, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Deliberately out of order: ordering must come from the hop and device id.
+			var targets []model.RolloutDevice
+			for _, id := range []uint{1, 5, 8, 2, 4, 3} {
+				targets = append(targets, model.RolloutDevice{DeviceID: id, Hop: hops[id]})
+			}
+			waves := planWaves(targets, tt.waveSize)
+
+			var got [][]uint
+			var gotHops []int
+			for i, w := range waves {
+				if w.Index != i+1 {
+					t.Errorf("wave %d has index %d", i+1, w.Index)
+				}
+				if w.Status != model.RolloutDevicePending {
+					t.Errorf("wave %d status = %q, want pending", w.Index, w.Status)
+				}
+				var ids []uint
+				for _, d := range w.Devices {
+					ids = append(ids, d.DeviceID)
+				}
+				got = append(got, ids)
+				gotHops = append(gotHops, w.Hop)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("waves = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(gotHops, tt.wantHops) {
+				t.Errorf("wave hops = %v, want %v", gotHops, tt.wantHops)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"backend/internal/config"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// sealedPrefix marks a value sealed by SecretBox
+const sealedPrefix = "sealed:v1:"
+
+// ErrSecretKeyUnset is returned when sealing new secrets needs a dedicated security.secret_key.
+var ErrSecretKeyUnset = errors.New("security.secret_key is empty or the default; set a dedicated key first")
+
+// SecretBox 用security.secret_key加密保存接入密码等密钥，并生成可用于比较的指纹
+type SecretBox struct {
+	aead    cipher.AEAD
+	hmacKey []byte
+	legacy  []cipher.AEAD
+	keyed   bool
+}
+
+// NewSecretBox 由服务端密钥派生加密和指纹用的密钥；legacy中的旧密钥只用于解开之前保存的密文
+func NewSecretBox(secret string, legacy ...string) *SecretBox {
+	box := &SecretBox{
+		aead:  sealKey(secret),
+		keyed: secret != "" && secret != config.DefaultSecretKey,
+	}
+	for _, old := range legacy {
+		if old != "" && old != secret {
+			box.legacy = append(box.legacy, sealKey(old))
+		}
+	}
+	macKey := sha256.Sum256([]byte("netmanager fingerprint:" + secret))
+	box.hmacKey = macKey[:]
+	return box
+}
+
+func sealKey(secret string) cipher.AEAD {
+	encKey := sha256.Sum256([]byte("netmanager secret box:" + secret))
+	block, err := aes.NewCipher(encKey[:])
+	if err != nil {
+		panic(err) // 32字节密钥不会失败
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return aead
+}
+
+// Keyed 是否配置了专用的security.secret_key（非空且不是默认值）
+func (b *SecretBox) Keyed() bool {
+	return b.keyed
+}
+
+// Seal 加密明文；空值和已加密的值原样返回
+func (b *SecretBox) Seal(plain string) string {
+	if plain == "" || IsSealed(plain) {
+		return plain
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		panic(err)
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// Open 解密Seal的结果；未加密的旧数据原样返回
+func (b *SecretBox) Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid sealed value: %v", err)
+	}
+	n := b.aead.NonceSize()
+	if len(data) < n {
+		return "", errors.New("invalid sealed value: too short")
+	}
+	for _, aead := range append([]cipher.AEAD{b.aead}, b.legacy...) {
+		if plain, err := aead.Open(nil, data[:n], data[n:], nil); err == nil {
+			return string(plain), nil
+		}
+	}
+	return "", errors.New("sealed value cannot be opened with the current security.secret_key")
+}
+
+// Fingerprint 密钥的HMAC指纹，不区分HEX大小写；只用于比较，不能还原密钥
+func (b *SecretBox) Fingerprint(plain string) string {
+	mac := hmac.New(sha256.New, b.hmacKey)
+	mac.Write([]byte(strings.ToUpper(plain)))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// IsSealed 判断值是否为SecretBox加密的密文
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
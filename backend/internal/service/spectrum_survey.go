@@ -0,0 +1,713 @@
+package service
+
+import (
+	"backend/internal/model"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 频谱勘测的默认参数
+const (
+	DefaultSurveyHours       = 24
+	DefaultSurveyMargin      = 6.0    // 噪声高于基线多少dB视为受扰
+	DefaultSurveyNoiseFloor  = -100.0 // 参考底噪(dBm)，基线不高于此值
+	DefaultSurveyPersistence = 0.5    // 受扰小时占比达到多少视为持续干扰
+
+	// 至少在这么多个小时内受扰才算持续干扰，单个小时的突发不算
+	minInterfererHours = 2
+	// 无效的测量值，见AT^DRPR的<rssi>和<snr>
+	invalidMeasurement = 32767
+	// 跳频间隔建议：持续干扰时快跳，间歇干扰时慢跳
+	persistentHopInterval   = 10
+	intermittentHopInterval = 30
+)
+
+// ErrSurveyInvalid is returned for a survey or hopping request that cannot be served.
+var ErrSurveyInvalid = errors.New("invalid spectrum survey request")
+
+// SpectrumSurveyRequest selects the DRPR/DAPR reports to aggregate.
+type SpectrumSurveyRequest struct {
+	DeviceIDs   []uint  `json:"device_ids"` // 为空时统计窗口内所有上报过的设备
+	Hours       int     `json:"hours"`
+	Margin      float64 `json:"margin"`
+	NoiseFloor  float64 `json:"noise_floor"`
+	Persistence float64 `json:"persistence"`
+}
+
+// SpectrumStats aggregates rssi, snr and the noise estimated from them (rssi - snr), all in dB/dBm.
+type SpectrumStats struct {
+	Samples  int     `json:"samples"`
+	RssiAvg  float64 `json:"rssi_avg"`
+	RssiMax  float64 `json:"rssi_max"`
+	SnrAvg   float64 `json:"snr_avg"`
+	SnrMin   float64 `json:"snr_min"`
+	NoiseAvg float64 `json:"noise_avg"`
+	NoiseMax float64 `json:"noise_max"`
+}
+
+// FrequencyNoise is the noise observed on one EARFCN. Rank 1 is the quietest.
+type FrequencyNoise struct {
+	Earfcn int `json:"earfcn"`
+	Rank   int `json:"rank"`
+	SpectrumStats
+	Devices       []uint  `json:"devices"`
+	Hours         int     `json:"hours"`          // clock hours with samples
+	ElevatedHours int     `json:"elevated_hours"` // clock hours whose average noise is above the threshold
+	Persistence   float64 `json:"persistence"`
+	Interferer    bool    `json:"interferer"`
+}
+
+// HourNoise is the noise by hour of day (local time).
+type HourNoise struct {
+	Hour int `json:"hour"`
+	SpectrumStats
+	ElevatedFrequencies []int `json:"elevated_frequencies"`
+}
+
+// DeviceNoise is what one device reported.
+type DeviceNoise struct {
+	DeviceID   uint   `json:"device_id"`
+	DeviceName string `json:"device_name"`
+	SpectrumStats
+	Frequencies []int     `json:"frequencies"`
+	Current     int       `json:"current"` // EARFCN of the latest report
+	LastSample  time.Time `json:"last_sample"`
+}
+
+// Interferer is a frequency with persistently elevated noise.
+type Interferer struct {
+	Earfcn      int            `json:"earfcn"`
+	ExcessDB    float64        `json:"excess_db"` // average noise of the elevated hours above the baseline
+	Persistence float64        `json:"persistence"`
+	PeakHours   []int          `json:"peak_hours"` // hours of day with elevated noise
+	Devices     []uint         `json:"devices"`
+	Exclusion   FrequencyRange `json:"exclusion"` // channel to avoid in frequency planning
+}
+
+// HoppingDevice is the AT^DFHC command one device would receive.
+type HoppingDevice struct {
+	DeviceID   uint                   `json:"device_id"`
+	DeviceName string                 `json:"device_name"`
+	BoardType  string                 `json:"board_type"`
+	Commands   []model.PreviewCommand `json:"commands"`
+	Warnings   []string               `json:"warnings,omitempty"`
+	Errors     []string               `json:"errors,omitempty"`
+}
+
+// HoppingRecommendation is the suggested AT^DFHC setting for the surveyed devices.
+type HoppingRecommendation struct {
+	Enabled  bool            `json:"enabled"`
+	Interval int             `json:"interval"` // seconds between hops, 0 for the board default
+	Reason   string          `json:"reason"`
+	Devices  []HoppingDevice `json:"devices"`
+}
+
+// SpectrumSurvey is the aggregated view of the collected radio reports.
+type SpectrumSurvey struct {
+	From         time.Time             `json:"from"`
+	To           time.Time             `json:"to"`
+	Samples      int                   `json:"samples"`
+	Unattributed int                   `json:"unattributed"` // reports without a frequency
+	Invalid      int                   `json:"invalid"`      // reports without a valid rssi or snr
+	Baseline     float64               `json:"baseline"`     // dBm
+	Threshold    float64               `json:"threshold"`    // dBm
+	Frequencies  []FrequencyNoise      `json:"frequencies"`
+	Hours        []HourNoise           `json:"hours"`
+	Devices      []DeviceNoise         `json:"devices"`
+	Interferers  []Interferer          `json:"interferers"`
+	Exclusions   []FrequencyRange      `json:"exclusions"` // feed for FrequencyPlanRequest.Exclusions
+	Hopping      HoppingRecommendation `json:"hopping"`
+}
+
+// HoppingApplyRequest applies an AT^DFHC setting; unset fields take the survey's recommendation.
+type HoppingApplyRequest struct {
+	SpectrumSurveyRequest
+	Enabled  *bool `json:"enabled"`
+	Interval *int  `json:"interval"`
+	DryRun   bool  `json:"dry_run"`
+}
+
+// HoppingApplyDevice is the outcome for one device.
+type HoppingApplyDevice struct {
+	DeviceID   uint                 `json:"device_id"`
+	DeviceName string               `json:"device_name"`
+	Status     string               `json:"status"` // planned, applied, failed or skipped
+	Commands   []model.AuditCommand `json:"commands,omitempty"`
+	Warnings   []string             `json:"warnings,omitempty"`
+	Error      string               `json:"error,omitempty"`
+}
+
+// HoppingApplyResult is the outcome of applying a hopping setting.
+type HoppingApplyResult struct {
+	Enabled  bool                 `json:"enabled"`
+	Interval int                  `json:"interval"`
+	Reason   string               `json:"reason"`
+	DryRun   bool                 `json:"dry_run"`
+	Devices  []HoppingApplyDevice `json:"devices"`
+}
+
+// surveySample 一条有效的测量，noise为rssi - snr
+type surveySample struct {
+	deviceID uint
+	earfcn   int
+	at       time.Time
+	rssi     float64
+	snr      float64
+	noise    float64
+}
+
+// surveyAcc 累加rssi、snr和噪声
+type surveyAcc struct {
+	n                         int
+	rssiSum, snrSum, noiseSum float64
+	rssiMax, snrMin, noiseMax float64
+}
+
+func (a *surveyAcc) add(s surveySample) {
+	if a.n == 0 || s.rssi > a.rssiMax {
+		a.rssiMax = s.rssi
+	}
+	if a.n == 0 || s.snr < a.snrMin {
+		a.snrMin = s.snr
+	}
+	if a.n == 0 || s.noise > a.noiseMax {
+		a.noiseMax = s.noise
+	}
+	a.n++
+	a.rssiSum += s.rssi
+	a.snrSum += s.snr
+	a.noiseSum += s.noise
+}
+
+func (a *surveyAcc) noiseAvg() float64 {
+	return a.noiseSum / float64(a.n)
+}
+
+func (a *surveyAcc) stats() SpectrumStats {
+	if a.n == 0 {
+		return SpectrumStats{}
+	}
+	n := float64(a.n)
+	return SpectrumStats{
+		Samples:  a.n,
+		RssiAvg:  round1(a.rssiSum / n),
+		RssiMax:  round1(a.rssiMax),
+		SnrAvg:   round1(a.snrSum / n),
+		SnrMin:   round1(a.snrMin),
+		NoiseAvg: round1(a.noiseSum / n),
+		NoiseMax: round1(a.noiseMax),
+	}
+}
+
+// SpectrumSurveyService 频谱勘测：汇总DRPR/DAPR上报的各频点rssi和snr，按频点、时段和设备统计噪声，
+// 找出持续干扰的频点，给出跳频(AT^DFHC)建议和频率规划需要避开的频段
+type SpectrumSurveyService struct {
+	db            *gorm.DB
+	deviceComm    *DeviceCommService
+	changeSet     *ChangeSetExecutor
+	configService *ConfigService
+	preview       *ConfigPreviewService
+}
+
+// NewSpectrumSurveyService 创建频谱勘测服务
+func NewSpectrumSurveyService(db *gorm.DB, deviceComm *DeviceCommService, changeSet *ChangeSetExecutor, configService *ConfigService, preview *ConfigPreviewService) *SpectrumSurveyService {
+	return &SpectrumSurveyService{
+		db:            db,
+		deviceComm:    deviceComm,
+		changeSet:     changeSet,
+		configService: configService,
+		preview:       preview,
+	}
+}
+
+// Survey 汇总窗口内的上报。基线取各频点每小时平均噪声的中位数（不高于参考底噪），
+// 某小时平均噪声超过基线+margin即为受扰，受扰小时占比达到persistence的频点视为持续干扰
+func (s *SpectrumSurveyService) Survey(req SpectrumSurveyRequest) (*SpectrumSurvey, error) {
+	req, err := normalizeSurveyRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	to := time.Now()
+	survey := &SpectrumSurvey{
+		From:        to.Add(-time.Duration(req.Hours) * time.Hour),
+		To:          to,
+		Frequencies: []FrequencyNoise{},
+		Hours:       []HourNoise{},
+		Devices:     []DeviceNoise{},
+		Interferers: []Interferer{},
+		Exclusions:  []FrequencyRange{},
+	}
+
+	samples, err := s.samples(req, survey)
+	if err != nil {
+		return nil, err
+	}
+	survey.Samples = len(samples)
+	if len(samples) == 0 {
+		survey.Baseline = req.NoiseFloor
+		survey.Threshold = req.NoiseFloor + req.Margin
+		survey.Hopping = HoppingRecommendation{Reason: "no radio reports in the survey window", Devices: []HoppingDevice{}}
+		return survey, nil
+	}
+
+	// 每个频点每个整点小时的平均噪声
+	type bucketKey struct {
+		earfcn int
+		hour   time.Time
+	}
+	buckets := make(map[bucketKey]*surveyAcc)
+	for _, sample := range samples {
+		key := bucketKey{sample.earfcn, sample.at.Truncate(time.Hour)}
+		if buckets[key] == nil {
+			buckets[key] = &surveyAcc{}
+		}
+		buckets[key].add(sample)
+	}
+	levels := make([]float64, 0, len(buckets))
+	for _, acc := range buckets {
+		levels = append(levels, acc.noiseAvg())
+	}
+	survey.Baseline = round1(math.Min(median(levels), req.NoiseFloor))
+	survey.Threshold = round1(survey.Baseline + req.Margin)
+
+	type freqState struct {
+		acc           surveyAcc
+		devices       map[uint]bool
+		hours         int
+		elevated      int
+		elevatedNoise float64
+		peakHours     map[int]bool
+	}
+	freqs := make(map[int]*freqState)
+	for _, sample := range samples {
+		f := freqs[sample.earfcn]
+		if f == nil {
+			f = &freqState{devices: make(map[uint]bool), peakHours: make(map[int]bool)}
+			freqs[sample.earfcn] = f
+		}
+		f.acc.add(sample)
+		f.devices[sample.deviceID] = true
+	}
+	elevatedByHour := make(map[int]map[int]bool)
+	for key, acc := range buckets {
+		f := freqs[key.earfcn]
+		f.hours++
+		if noise := acc.noiseAvg(); noise > survey.Threshold {
+			f.elevated++
+			f.elevatedNoise += noise
+			hour := key.hour.Local().Hour()
+			f.peakHours[hour] = true
+			if elevatedByHour[hour] == nil {
+				elevatedByHour[hour] = make(map[int]bool)
+			}
+			elevatedByHour[hour][key.earfcn] = true
+		}
+	}
+
+	halfWidths := s.channelHalfWidths(samples)
+	for earfcn, f := range freqs {
+		entry := FrequencyNoise{
+			Earfcn:        earfcn,
+			SpectrumStats: f.acc.stats(),
+			Devices:       sortedIDs(f.devices),
+			Hours:         f.hours,
+			ElevatedHours: f.elevated,
+			Persistence:   round2(float64(f.elevated) / float64(f.hours)),
+		}
+		entry.Interferer = f.elevated >= minInterfererHours && entry.Persistence >= req.Persistence
+		survey.Frequencies = append(survey.Frequencies, entry)
+		if !entry.Interferer {
+			continue
+		}
+		half := 0
+		for id := range f.devices {
+			half = max(half, halfWidths[id])
+		}
+		exclusion := FrequencyRange{Start: earfcn - half, End: earfcn + half, Label: fmt.Sprintf("interference %d", earfcn)}
+		survey.Interferers = append(survey.Interferers, Interferer{
+			Earfcn:      earfcn,
+			ExcessDB:    round1(f.elevatedNoise/float64(f.elevated) - survey.Baseline),
+			Persistence: entry.Persistence,
+			PeakHours:   sortedInts(f.peakHours),
+			Devices:     entry.Devices,
+			Exclusion:   exclusion,
+		})
+		survey.Exclusions = append(survey.Exclusions, exclusion)
+	}
+	// 按平均噪声从低到高排名
+	sort.Slice(survey.Frequencies, func(i, j int) bool {
+		a, b := survey.Frequencies[i], survey.Frequencies[j]
+		if a.NoiseAvg != b.NoiseAvg {
+			return a.NoiseAvg < b.NoiseAvg
+		}
+		return a.Earfcn < b.Earfcn
+	})
+	for i := range survey.Frequencies {
+		survey.Frequencies[i].Rank = i + 1
+	}
+	sort.Slice(survey.Interferers, func(i, j int) bool { return survey.Interferers[i].Earfcn < survey.Interferers[j].Earfcn })
+	sort.Slice(survey.Exclusions, func(i, j int) bool { return survey.Exclusions[i].Start < survey.Exclusions[j].Start })
+
+	var byHour [24]surveyAcc
+	for _, sample := range samples {
+		byHour[sample.at.Local().Hour()].add(sample)
+	}
+	for hour := range byHour {
+		if byHour[hour].n == 0 {
+			continue
+		}
+		survey.Hours = append(survey.Hours, HourNoise{
+			Hour:                hour,
+			SpectrumStats:       byHour[hour].stats(),
+			ElevatedFrequencies: sortedInts(elevatedByHour[hour]),
+		})
+	}
+
+	s.deviceStats(survey, samples)
+	survey.Hopping = s.recommendHopping(survey, frequenciesByEarfcn(survey.Frequencies))
+	return survey, nil
+}
+
+// ApplyHopping 按勘测建议（或请求中指定的值）通过变更集下发AT^DFHC，并保存跳频开关
+func (s *SpectrumSurveyService) ApplyHopping(req HoppingApplyRequest, actor AuditActor) (*HoppingApplyResult, error) {
+	survey, err := s.Survey(req.SpectrumSurveyRequest)
+	if err != nil {
+		return nil, err
+	}
+	result := &HoppingApplyResult{
+		Enabled:  survey.Hopping.Enabled,
+		Interval: survey.Hopping.Interval,
+		Reason:   survey.Hopping.Reason,
+		DryRun:   req.DryRun,
+		Devices:  []HoppingApplyDevice{},
+	}
+	if req.Enabled != nil || req.Interval != nil {
+		result.Reason = "requested"
+	}
+	if req.Enabled != nil {
+		result.Enabled = *req.Enabled
+	}
+	if req.Interval != nil {
+		result.Interval = *req.Interval
+	}
+	planned, err := FrequencyHoppingIntervalCommand(result.Enabled, result.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSurveyInvalid, err)
+	}
+
+	deviceIDs := req.DeviceIDs
+	if len(deviceIDs) == 0 {
+		for _, d := range survey.Devices {
+			deviceIDs = append(deviceIDs, d.DeviceID)
+		}
+	}
+	if len(deviceIDs) == 0 {
+		return nil, fmt.Errorf("%w: no devices reported in the survey window", ErrSurveyInvalid)
+	}
+
+	values := map[string]interface{}{"frequency_hopping": result.Enabled}
+	details := fmt.Sprintf("spectrum survey: frequency hopping %s, interval %ds", onOff(result.Enabled), result.Interval)
+	for _, id := range deviceIDs {
+		entry := HoppingApplyDevice{DeviceID: id}
+		plan, err := s.preview.PlanWireless(id, "frequency_hopping", []PlannedCommand{planned}, values)
+		if err != nil {
+			entry.Status, entry.Error = "skipped", err.Error()
+			result.Devices = append(result.Devices, entry)
+			continue
+		}
+		if device, err := s.deviceComm.getDeviceByID(id); err == nil {
+			entry.DeviceName = device.Name
+		}
+		entry.Warnings = plan.Warnings
+		if !plan.Valid() {
+			entry.Status, entry.Error = "skipped", strings.Join(plan.Errors, "; ")
+			result.Devices = append(result.Devices, entry)
+			continue
+		}
+		if req.DryRun {
+			entry.Status = "planned"
+			for _, cmd := range plan.Commands {
+				entry.Commands = append(entry.Commands, model.AuditCommand{Name: cmd.Name, Command: cmd.Command, Status: StepPending})
+			}
+			result.Devices = append(result.Devices, entry)
+			continue
+		}
+
+		changeSet, err := s.changeSet.Apply(id, plan.Steps())
+		if err != nil {
+			s.configService.RecordFailedChange(actor, id, ConfigCategoryWireless, values, nil, err, details)
+			entry.Status, entry.Error = "failed", err.Error()
+			result.Devices = append(result.Devices, entry)
+			continue
+		}
+		entry.Commands = ChangeSetCommands(changeSet)
+		if !changeSet.Success {
+			s.configService.RecordFailedChange(actor, id, ConfigCategoryWireless, values, entry.Commands, errors.New(changeSet.Error), details)
+			entry.Status, entry.Error = "failed", changeSet.Error
+			result.Devices = append(result.Devices, entry)
+			continue
+		}
+		if err := s.configService.SaveAppliedConfigs(actor, id, ConfigCategoryWireless, values, entry.Commands, details); err != nil {
+			entry.Warnings = append(entry.Warnings, fmt.Sprintf("applied, but saving the configuration failed: %v", err))
+		}
+		entry.Status = "applied"
+		result.Devices = append(result.Devices, entry)
+	}
+	return result, nil
+}
+
+func normalizeSurveyRequest(req SpectrumSurveyRequest) (SpectrumSurveyRequest, error) {
+	if req.Hours == 0 {
+		req.Hours = DefaultSurveyHours
+	}
+	if req.Margin == 0 {
+		req.Margin = DefaultSurveyMargin
+	}
+	if req.NoiseFloor == 0 {
+		req.NoiseFloor = DefaultSurveyNoiseFloor
+	}
+	if req.Persistence == 0 {
+		req.Persistence = DefaultSurveyPersistence
+	}
+	switch {
+	case req.Hours < 0:
+		return req, fmt.Errorf("%w: hours must be positive", ErrSurveyInvalid)
+	case req.Margin < 0:
+		return req, fmt.Errorf("%w: margin must be positive", ErrSurveyInvalid)
+	case req.Persistence < 0 || req.Persistence > 1:
+		return req, fmt.Errorf("%w: persistence must be between 0 and 1", ErrSurveyInvalid)
+	}
+	return req, nil
+}
+
+// samples 读取窗口内的上报，跳频时按ul_earfcn（实际所在频点）归类，否则按earfcn
+func (s *SpectrumSurveyService) samples(req SpectrumSurveyRequest, survey *SpectrumSurvey) ([]surveySample, error) {
+	var rows []model.DRPRMessage
+	query := s.db.Select("device_id", "timestamp", "earfcn", "ul_earfcn", "rssi", "snr").
+		Where("timestamp >= ?", survey.From)
+	if len(req.DeviceIDs) > 0 {
+		query = query.Where("device_id IN ?", req.DeviceIDs)
+	}
+	if err := query.Order("timestamp").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	samples := make([]surveySample, 0, len(rows))
+	for _, row := range rows {
+		earfcn := row.Earfcn
+		if ul, err := strconv.Atoi(strings.TrimSpace(row.UlEarfcn)); err == nil && ul > 0 {
+			earfcn = ul
+		}
+		if earfcn <= 0 {
+			survey.Unattributed++
+			continue
+		}
+		rssi, okRssi := measurement(row.Rssi)
+		snr, okSnr := measurement(row.Snr)
+		if !okRssi || !okSnr {
+			survey.Invalid++
+			continue
+		}
+		samples = append(samples, surveySample{
+			deviceID: row.DeviceID,
+			earfcn:   earfcn,
+			at:       row.Timestamp,
+			rssi:     rssi,
+			snr:      snr,
+			noise:    rssi - snr,
+		})
+	}
+	return samples, nil
+}
+
+// channelHalfWidths 设备已保存带宽对应的信道半宽(100KHz)，未知时按1.4M
+func (s *SpectrumSurveyService) channelHalfWidths(samples []surveySample) map[uint]int {
+	ids := make(map[uint]bool)
+	for _, sample := range samples {
+		ids[sample.deviceID] = true
+	}
+	var configs []model.WirelessConfig
+	s.db.Where("device_id IN ?", sortedIDs(ids)).Find(&configs)
+
+	half := make(map[uint]int, len(ids))
+	for id := range ids {
+		half[id] = bandwidthHalfWidth["1.4M"]
+	}
+	for _, c := range configs {
+		name := c.Bandwidth
+		if n, err := strconv.Atoi(name); err == nil {
+			name, _ = BandwidthName(n)
+		}
+		if h, ok := bandwidthHalfWidth[name]; ok {
+			half[c.DeviceID] = h
+		}
+	}
+	return half
+}
+
+func (s *SpectrumSurveyService) deviceStats(survey *SpectrumSurvey, samples []surveySample) {
+	type deviceState struct {
+		acc   surveyAcc
+		freqs map[int]bool
+		last  surveySample
+	}
+	devices := make(map[uint]*deviceState)
+	for _, sample := range samples {
+		d := devices[sample.deviceID]
+		if d == nil {
+			d = &deviceState{freqs: make(map[int]bool)}
+			devices[sample.deviceID] = d
+		}
+		d.acc.add(sample)
+		d.freqs[sample.earfcn] = true
+		if !sample.at.Before(d.last.at) {
+			d.last = sample
+		}
+	}
+	ids := make(map[uint]bool, len(devices))
+	for id := range devices {
+		ids[id] = true
+	}
+	names := make(map[uint]string)
+	var rows []model.Device
+	s.db.Select("id", "name").Where("id IN ?", sortedIDs(ids)).Find(&rows)
+	for _, d := range rows {
+		names[d.ID] = d.Name
+	}
+	for _, id := range sortedIDs(ids) {
+		d := devices[id]
+		survey.Devices = append(survey.Devices, DeviceNoise{
+			DeviceID:      id,
+			DeviceName:    names[id],
+			SpectrumStats: d.acc.stats(),
+			Frequencies:   sortedInts(d.freqs),
+			Current:       d.last.earfcn,
+			LastSample:    d.last.at,
+		})
+	}
+}
+
+// recommendHopping 设备当前所在频点持续受扰时建议快跳，间歇受扰时建议慢跳，未受扰时建议关闭跳频
+func (s *SpectrumSurveyService) recommendHopping(survey *SpectrumSurvey, byFreq map[int]FrequencyNoise) HoppingRecommendation {
+	rec := HoppingRecommendation{Devices: []HoppingDevice{}}
+	var persistent, intermittent []string
+	seen := make(map[int]bool)
+	for _, d := range survey.Devices {
+		if seen[d.Current] {
+			continue
+		}
+		seen[d.Current] = true
+		f := byFreq[d.Current]
+		switch {
+		case f.Interferer:
+			persistent = append(persistent, strconv.Itoa(d.Current))
+		case f.ElevatedHours > 0:
+			intermittent = append(intermittent, strconv.Itoa(d.Current))
+		}
+	}
+	switch {
+	case len(persistent) > 0:
+		rec.Enabled, rec.Interval = true, persistentHopInterval
+		rec.Reason = fmt.Sprintf("persistent interference on the operating frequency %s", strings.Join(persistent, ", "))
+	case len(intermittent) > 0:
+		rec.Enabled, rec.Interval = true, intermittentHopInterval
+		rec.Reason = fmt.Sprintf("intermittent interference on the operating frequency %s", strings.Join(intermittent, ", "))
+	default:
+		rec.Reason = "no interference on the operating frequencies"
+	}
+
+	planned, _ := FrequencyHoppingIntervalCommand(rec.Enabled, rec.Interval)
+	for _, d := range survey.Devices {
+		device, err := s.deviceComm.getDeviceByID(d.DeviceID)
+		if err != nil {
+			continue
+		}
+		entry := HoppingDevice{DeviceID: device.ID, DeviceName: device.Name, BoardType: device.BoardType}
+		entry.Commands, entry.Warnings, entry.Errors, _ = renderPlannedCommands(s.deviceComm.boardConfigMgr, device.BoardType, nil, []PlannedCommand{planned})
+		if rec.Interval != 0 && !boardTakesHopInterval(s.deviceComm.boardConfigMgr, device.BoardType) {
+			entry.Warnings = append(entry.Warnings, fmt.Sprintf("board %s does not take a hop interval; the board default is used", device.BoardType))
+		}
+		rec.Devices = append(rec.Devices, entry)
+	}
+	return rec
+}
+
+func boardTakesHopInterval(mgr *BoardConfigManager, boardType string) bool {
+	def, err := mgr.GetCommand(boardType, "set_frequency_hopping")
+	if err != nil {
+		return false
+	}
+	for _, param := range def.Parameters {
+		if param.Name == "HopInterval" {
+			return true
+		}
+	}
+	return false
+}
+
+func frequenciesByEarfcn(list []FrequencyNoise) map[int]FrequencyNoise {
+	byFreq := make(map[int]FrequencyNoise, len(list))
+	for _, f := range list {
+		byFreq[f.Earfcn] = f
+	}
+	return byFreq
+}
+
+// measurement 解析"±value"形式的测量值，"+32767"为无效值
+func measurement(value string) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.Trim(value, "\" +"), 64)
+	if err != nil || math.Abs(v) >= invalidMeasurement {
+		return 0, false
+	}
+	return v, true
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+func sortedIDs(set map[uint]bool) []uint {
+	ids := make([]uint, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func sortedInts(set map[int]bool) []int {
+	list := make([]int, 0, len(set))
+	for v := range set {
+		list = append(list, v)
+	}
+	sort.Ints(list)
+	return list
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,792 @@
+package service
+
+import (
+	"backend/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	starDeviceTypeQuery      = "AT^DDTC?"
+	starSlaveMaxTxPowerQuery = "AT^DSSMTP?"
+	minSlaveMaxTxPower       = -40
+	maxSlaveMaxTxPower       = 50
+)
+
+var (
+	// ErrStarRoleInvalid wraps validation failures of role queries and handovers.
+	ErrStarRoleInvalid = errors.New("invalid star role request")
+	// ErrStarHandoverRunning is returned while another handover is in progress.
+	ErrStarHandoverRunning = errors.New("a master handover is already running")
+)
+
+func starHandoverWorkerName(id uint) string {
+	return fmt.Sprintf("star_handover_%d", id)
+}
+
+// StarDeviceRole is the configured and active AT^DDTC role of one star device.
+type StarDeviceRole struct {
+	DeviceID        uint   `json:"device_id"`
+	Name            string `json:"name"`
+	NodeID          string `json:"node_id"`
+	BoardType       string `json:"board_type"`
+	ConfiguredType  string `json:"configured_type"` // 1 = master (center), 2 = slave (terminal)
+	ActiveType      string `json:"active_type"`
+	ConfiguredRole  string `json:"configured_role"`
+	ActiveRole      string `json:"active_role"`
+	SlaveMaxTxPower string `json:"slave_max_tx_power,omitempty"` // AT^DSSMTP of masters
+	PendingReboot   bool   `json:"pending_reboot,omitempty"`     // configured role differs from the active one
+	Cached          bool   `json:"cached,omitempty"`             // device could not be read, last known role
+	Error           string `json:"error,omitempty"`
+}
+
+// StarNetwork is a group of star devices connected by neighbor links.
+type StarNetwork struct {
+	Index     int              `json:"index"`
+	DeviceIDs []uint           `json:"device_ids"`
+	Masters   []uint           `json:"masters"` // devices actively running as master
+	Devices   []StarDeviceRole `json:"devices"`
+	Issues    []string         `json:"issues"`
+}
+
+// StarRoleReport lists the star networks and their role issues.
+type StarRoleReport struct {
+	Networks  []StarNetwork `json:"networks"`
+	Issues    int           `json:"issues"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+// StarHandoverRequest moves the master role of a star network to ToDeviceID.
+type StarHandoverRequest struct {
+	ToDeviceID      uint   `json:"to_device_id"`
+	SlaveMaxTxPower string `json:"slave_max_tx_power"` // "23" or "23,20" (PCell,SCell); default: the current master's limits
+	RejoinTimeout   int    `json:"rejoin_timeout"`
+	SettleTime      int    `json:"settle_time"`
+	RefreshTopology bool   `json:"refresh_topology"`
+	DryRun          bool   `json:"dry_run"`
+}
+
+// StarRoleService 星型网络主从角色管理：读取每台设备配置的和当前生效的AT^DDTC角色，
+// 按邻居链路划分网络并检查主节点数量；主节点切换时旧主节点改为从节点、新主节点改为主节点
+// 并重新下发从节点最大发射功率(AT^DSSMTP)，重启后确认所有从节点重新接入新的主节点
+type StarRoleService struct {
+	db         *gorm.DB
+	deviceComm *DeviceCommService
+	changeSet  *ChangeSetExecutor
+	rollout    *RolloutService
+	audit      *AuditService
+	supervisor *Supervisor
+
+	mu      sync.Mutex
+	running uint // id of the running handover
+}
+
+// NewStarRoleService 创建星型网络角色服务
+func NewStarRoleService(db *gorm.DB, deviceComm *DeviceCommService, changeSet *ChangeSetExecutor, rollout *RolloutService, audit *AuditService, supervisor *Supervisor) *StarRoleService {
+	return &StarRoleService{
+		db:         db,
+		deviceComm: deviceComm,
+		changeSet:  changeSet,
+		rollout:    rollout,
+		audit:      audit,
+		supervisor: supervisor,
+	}
+}
+
+// Start 将上次运行时未完成的切换标记为interrupted
+func (s *StarRoleService) Start() {
+	res := s.db.Model(&model.StarHandover{}).Where("status = ?", model.StarHandoverRunning).Updates(map[string]interface{}{
+		"status": model.StarHandoverInterrupted,
+		"error":  "the backend stopped during the handover; check the roles and hand over again",
+	})
+	if res.Error != nil {
+		log.Printf("Failed to mark interrupted star handovers: %v", res.Error)
+	} else if res.RowsAffected > 0 {
+		log.Printf("Marked %d star handover(s) as interrupted", res.RowsAffected)
+	}
+}
+
+// Roles 读取星型设备的角色并检查每个网络是否恰好有一个主节点；deviceIDs为空时检查所有星型设备
+func (s *StarRoleService) Roles(deviceIDs []uint, refresh bool) (*StarRoleReport, error) {
+	devices, err := s.starDevices(deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+	if refresh {
+		s.rollout.refreshTopology(devices)
+	}
+	roles := make(map[uint]StarDeviceRole, len(devices))
+	for i := range devices {
+		roles[devices[i].ID] = s.readRole(&devices[i])
+	}
+	networks, err := s.networks(devices, roles)
+	if err != nil {
+		return nil, err
+	}
+	report := &StarRoleReport{Networks: networks, CheckedAt: time.Now()}
+	for _, n := range networks {
+		report.Issues += len(n.Issues)
+	}
+	return report, nil
+}
+
+// List 返回所有主节点切换记录，新的在前
+func (s *StarRoleService) List() ([]model.StarHandover, error) {
+	var handovers []model.StarHandover
+	err := s.db.Order("id DESC").Find(&handovers).Error
+	return handovers, err
+}
+
+// Get 返回主节点切换记录及每台设备的进度
+func (s *StarRoleService) Get(id uint) (*model.StarHandover, error) {
+	var handover model.StarHandover
+	if err := s.db.First(&handover, id).Error; err != nil {
+		return nil, err
+	}
+	return &handover, nil
+}
+
+// Handover 将主节点角色移到ToDeviceID：网络中其他主节点（包括配置为主节点尚未重启的）改为从节点。
+// DryRun时只返回计划下发的命令
+func (s *StarRoleService) Handover(req StarHandoverRequest, actor AuditActor) (*model.StarHandover, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrStarRoleInvalid, fmt.Sprintf(format, args...))
+	}
+	if req.ToDeviceID == 0 {
+		return nil, invalid("to_device_id is required")
+	}
+	if req.RejoinTimeout < 0 || req.SettleTime < 0 {
+		return nil, invalid("rejoin_timeout and settle_time must not be negative")
+	}
+	if req.SlaveMaxTxPower != "" {
+		if err := validateSlaveMaxTxPower(req.SlaveMaxTxPower); err != nil {
+			return nil, invalid("%v", err)
+		}
+	}
+	s.mu.Lock()
+	running := s.running
+	s.mu.Unlock()
+	if running != 0 {
+		return nil, fmt.Errorf("%w: handover %d", ErrStarHandoverRunning, running)
+	}
+
+	report, err := s.Roles(nil, req.RefreshTopology)
+	if err != nil {
+		return nil, err
+	}
+	var network *StarNetwork
+	for i := range report.Networks {
+		if containsID(report.Networks[i].DeviceIDs, req.ToDeviceID) {
+			network = &report.Networks[i]
+		}
+	}
+	if network == nil {
+		return nil, invalid("device %d is not a star board", req.ToDeviceID)
+	}
+
+	handover := &model.StarHandover{
+		ToDeviceID:      req.ToDeviceID,
+		DeviceIDs:       network.DeviceIDs,
+		SlaveMaxTxPower: req.SlaveMaxTxPower,
+		RejoinTimeout:   req.RejoinTimeout,
+		SettleTime:      req.SettleTime,
+		Status:          model.StarHandoverRunning,
+		CreatedBy:       actor.Username,
+	}
+	if handover.RejoinTimeout == 0 {
+		handover.RejoinTimeout = defaultRolloutRejoinTimeout
+	}
+	if handover.SettleTime == 0 {
+		handover.SettleTime = defaultRolloutSettleTime
+	}
+
+	// 旧主节点在前，新主节点其次，其余从节点在后
+	var demoted, terminals []model.StarHandoverDevice
+	var target *model.StarHandoverDevice
+	for _, role := range network.Devices {
+		if role.Cached || role.ConfiguredType == "" {
+			return nil, invalid("the role of %s could not be read: %s", role.Name, role.Error)
+		}
+		d := model.StarHandoverDevice{
+			DeviceID: role.DeviceID, Name: role.Name, NodeID: role.NodeID,
+			Role: model.StarDeviceTypeSlave, PreviousRole: role.ConfiguredType, Status: model.StarHandoverDevicePending,
+		}
+		switch {
+		case role.DeviceID == req.ToDeviceID:
+			d.Role = model.StarDeviceTypeMaster
+			target = &d
+		case role.ActiveType == model.StarDeviceTypeMaster || role.ConfiguredType == model.StarDeviceTypeMaster:
+			demoted = append(demoted, d)
+			if handover.FromDeviceID == 0 && role.ActiveType == model.StarDeviceTypeMaster {
+				handover.FromDeviceID = role.DeviceID
+				if handover.SlaveMaxTxPower == "" {
+					handover.SlaveMaxTxPower = role.SlaveMaxTxPower
+				}
+			}
+		default:
+			terminals = append(terminals, d)
+		}
+	}
+	if len(demoted) == 0 && len(network.Masters) == 1 && network.Masters[0] == req.ToDeviceID {
+		return nil, invalid("device %d is already the only master of its network", req.ToDeviceID)
+	}
+	if handover.FromDeviceID == 0 {
+		handover.Notes = append(handover.Notes, "the network has no active master")
+	}
+	if handover.SlaveMaxTxPower == "" {
+		handover.Notes = append(handover.Notes, "no slave max tx power limits known; AT^DSSMTP is left unchanged on the new master")
+	} else if err := validateSlaveMaxTxPower(handover.SlaveMaxTxPower); err != nil {
+		return nil, invalid("slave max tx power of the current master: %v; set slave_max_tx_power", err)
+	}
+	handover.Devices = append(append(demoted, *target), terminals...)
+
+	// 渲染每台设备的命令，板卡不支持时在创建前拒绝
+	for i := range handover.Devices {
+		d := &handover.Devices[i]
+		if !starDeviceChanges(handover, d) {
+			continue
+		}
+		if d.DeviceID == req.ToDeviceID && handover.SlaveMaxTxPower != "" {
+			device, err := s.deviceComm.getDeviceByID(d.DeviceID)
+			if err != nil {
+				return nil, err
+			}
+			if previous, err := s.changeSet.readValue(device, starSlaveMaxTxPowerQuery); err == nil {
+				handover.PreviousSlaveMaxTxPower = strings.Join(trimmedFields(previous), ",")
+			}
+		}
+		steps, err := s.roleSteps(d.DeviceID, d.Role, s.powerFor(handover, d, false))
+		if err != nil {
+			return nil, invalid("device %s: %v", d.Name, err)
+		}
+		// 新角色重启后才生效
+		if _, err := s.deviceComm.FormatCommandByName(d.DeviceID, "reboot_device", nil); err != nil {
+			return nil, invalid("device %s cannot be rebooted remotely: %v", d.Name, err)
+		}
+		for _, step := range steps {
+			d.Commands = append(d.Commands, model.AuditCommand{Name: step.Name, Command: step.Command, Status: StepPending})
+		}
+	}
+	if req.DryRun {
+		return handover, nil
+	}
+
+	s.mu.Lock()
+	if s.running != 0 {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%w: handover %d", ErrStarHandoverRunning, s.running)
+	}
+	if err := s.db.Create(handover).Error; err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	s.running = handover.ID
+	s.mu.Unlock()
+
+	worker := *handover
+	worker.Devices = append([]model.StarHandoverDevice(nil), handover.Devices...)
+	s.supervisor.Go(starHandoverWorkerName(handover.ID), func(ctx context.Context) error {
+		defer func() {
+			s.mu.Lock()
+			s.running = 0
+			s.mu.Unlock()
+		}()
+		return s.execute(ctx, &worker, actor)
+	})
+	return handover, nil
+}
+
+// starDeviceChanges 设备是否需要修改：角色变化，或新主节点需要重新下发发射功率限制
+func starDeviceChanges(handover *model.StarHandover, d *model.StarHandoverDevice) bool {
+	return d.Role != d.PreviousRole || (d.DeviceID == handover.ToDeviceID && handover.SlaveMaxTxPower != "")
+}
+
+// powerFor 新主节点下发的AT^DSSMTP值；回滚时恢复其原值
+func (s *StarRoleService) powerFor(handover *model.StarHandover, d *model.StarHandoverDevice, rollback bool) string {
+	if d.DeviceID != handover.ToDeviceID || handover.SlaveMaxTxPower == "" {
+		return ""
+	}
+	if rollback {
+		return handover.PreviousSlaveMaxTxPower
+	}
+	return handover.SlaveMaxTxPower
+}
+
+// execute 写入新角色，依次重启，然后确认每台设备以预期角色运行、从节点都能看到新主节点
+func (s *StarRoleService) execute(ctx context.Context, handover *model.StarHandover, actor AuditActor) error {
+	details := fmt.Sprintf("star handover %d", handover.ID)
+	var changed []int
+	fail := func(cause string) error {
+		if ctx.Err() != nil {
+			s.finish(handover, model.StarHandoverInterrupted, "the backend stopped during the handover; check the roles and hand over again")
+			return ctx.Err()
+		}
+		status := model.StarHandoverRolledBack
+		if !s.rollback(ctx, handover, changed, actor) {
+			status = model.StarHandoverRollbackFailed
+		}
+		s.finish(handover, status, cause)
+		return errors.New(cause)
+	}
+
+	for i := range handover.Devices {
+		d := &handover.Devices[i]
+		neighbors, err := s.rollout.discoverNeighbors(d.DeviceID)
+		if err != nil {
+			d.Status, d.Error = model.StarHandoverDeviceFailed, fmt.Sprintf("neighbor discovery failed: %v", err)
+			return fail(fmt.Sprintf("device %s: %s", d.Name, d.Error))
+		}
+		d.NeighborsBefore = neighbors
+	}
+
+	// 1. 写入新角色（重启后生效）
+	for i := range handover.Devices {
+		d := &handover.Devices[i]
+		if !starDeviceChanges(handover, d) {
+			continue
+		}
+		commands, err := s.apply(actor, d.DeviceID, d.Role, s.powerFor(handover, d, false), details)
+		d.Commands = commands
+		if err != nil {
+			d.Status, d.Error = model.StarHandoverDeviceFailed, err.Error()
+			s.save(handover)
+			return fail(fmt.Sprintf("device %s: %v", d.Name, err))
+		}
+		changed = append(changed, i)
+		d.Status = model.StarHandoverDeviceChanged
+		s.save(handover)
+	}
+
+	// 2. 旧主节点先重启，新主节点最后，避免同时存在两个主节点
+	for _, i := range changed {
+		d := &handover.Devices[i]
+		s.rollout.reboot(actor, d.DeviceID, details)
+		d.Status = model.StarHandoverDeviceRebooted
+		s.save(handover)
+	}
+
+	// 3. 确认所有设备重新接入
+	if err := s.verify(ctx, handover, false); err != nil {
+		return fail(err.Error())
+	}
+	for _, d := range handover.Devices {
+		s.storeRole(handover, d.DeviceID, d.Role, s.powerFor(handover, &d, false))
+	}
+	s.finish(handover, model.StarHandoverCompleted, "")
+	return nil
+}
+
+// verify 等待每台设备以预期角色运行，从节点的邻居中出现预期的主节点
+func (s *StarRoleService) verify(ctx context.Context, handover *model.StarHandover, rollback bool) error {
+	if err := sleepContext(ctx, time.Duration(handover.SettleTime)*time.Second); err != nil {
+		return err
+	}
+	master := ""
+	for _, d := range handover.Devices {
+		role := d.Role
+		if rollback {
+			role = d.PreviousRole
+		}
+		if role == model.StarDeviceTypeMaster && master == "" {
+			master = d.NodeID
+		}
+	}
+	done := model.StarHandoverDeviceAttached
+	if rollback {
+		done = model.StarHandoverDeviceRolledBack
+	}
+	deadline := time.Now().Add(time.Duration(handover.RejoinTimeout) * time.Second)
+	for {
+		var pending []string
+		for i := range handover.Devices {
+			d := &handover.Devices[i]
+			if d.Status == done {
+				continue
+			}
+			role := d.Role
+			if rollback {
+				role = d.PreviousRole
+			}
+			if s.attached(d, role, master) {
+				d.Status, d.Error = done, ""
+			} else {
+				pending = append(pending, fmt.Sprintf("%s (%s)", d.Name, d.Error))
+			}
+		}
+		s.save(handover)
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d device(s) did not re-attach within %ds: %s", len(pending), handover.RejoinTimeout, strings.Join(pending, ", "))
+		}
+		if err := sleepContext(ctx, rolloutPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *StarRoleService) attached(d *model.StarHandoverDevice, role, master string) bool {
+	if status, _ := s.deviceComm.GetDeviceStatus(d.DeviceID); status != "Online" {
+		d.Error = "device is offline"
+		return false
+	}
+	device, err := s.deviceComm.getDeviceByID(d.DeviceID)
+	if err != nil {
+		d.Error = err.Error()
+		return false
+	}
+	value, err := s.changeSet.readValue(device, starDeviceTypeQuery)
+	if err != nil {
+		d.Error = fmt.Sprintf("role could not be read: %v", err)
+		return false
+	}
+	if _, active := parseDeviceType(value); active != role {
+		d.Error = fmt.Sprintf("runs as %s, expected %s", starRoleName(active), starRoleName(role))
+		return false
+	}
+	if role == model.StarDeviceTypeMaster || master == "" {
+		return true
+	}
+	neighbors, err := s.rollout.discoverNeighbors(d.DeviceID)
+	if err != nil {
+		d.Error = fmt.Sprintf("neighbor discovery failed: %v", err)
+		return false
+	}
+	d.NeighborsAfter = neighbors
+	for _, n := range neighbors {
+		if n == master {
+			return true
+		}
+	}
+	d.Error = fmt.Sprintf("not attached to master %s", master)
+	return false
+}
+
+// rollback 恢复已修改设备的原角色和发射功率限制并重启
+func (s *StarRoleService) rollback(ctx context.Context, handover *model.StarHandover, changed []int, actor AuditActor) bool {
+	if len(changed) == 0 {
+		return true
+	}
+	details := fmt.Sprintf("star handover %d: rollback", handover.ID)
+	timeout := time.Duration(handover.RejoinTimeout) * time.Second
+	ok := true
+	for _, i := range changed {
+		d := &handover.Devices[i]
+		s.rollout.waitOnline(d.DeviceID, timeout)
+		commands, err := s.apply(actor, d.DeviceID, d.PreviousRole, s.powerFor(handover, d, true), details)
+		d.Rollback = commands
+		if err != nil {
+			d.Status, d.Error = model.StarHandoverDeviceRollbackFailed, err.Error()
+			ok = false
+			continue
+		}
+		s.rollout.reboot(actor, d.DeviceID, details)
+		d.Status = model.StarHandoverDeviceRebooted
+		s.save(handover)
+	}
+	// 未修改的从节点也要重新接入原主节点
+	for i := range handover.Devices {
+		if d := &handover.Devices[i]; d.Status != model.StarHandoverDeviceRollbackFailed {
+			d.Status = model.StarHandoverDeviceRebooted
+		}
+	}
+	if err := s.verify(ctx, handover, true); err != nil {
+		handover.Notes = append(handover.Notes, fmt.Sprintf("rollback: %v", err))
+		for i := range handover.Devices {
+			if d := &handover.Devices[i]; d.Status != model.StarHandoverDeviceRolledBack {
+				d.Status = model.StarHandoverDeviceRollbackFailed
+			}
+		}
+		ok = false
+	}
+	if ok {
+		for _, i := range changed {
+			d := &handover.Devices[i]
+			s.storeRole(handover, d.DeviceID, d.PreviousRole, s.powerFor(handover, d, true))
+		}
+	}
+	return ok
+}
+
+// apply 以变更集方式下发AT^DDTC（以及AT^DSSMTP）
+func (s *StarRoleService) apply(actor AuditActor, deviceID uint, role, power, details string) ([]model.AuditCommand, error) {
+	steps, err := s.roleSteps(deviceID, role, power)
+	if err != nil {
+		return nil, err
+	}
+	entry := &model.ConfigAudit{
+		DeviceID: deviceID,
+		Category: "device_type",
+		Action:   model.AuditActionHandover,
+		Changes:  []model.PreviewChange{{Key: "device_type", To: role}},
+		Details:  details,
+	}
+	if power != "" {
+		entry.Changes = append(entry.Changes, model.PreviewChange{Key: "slave_max_tx_power", To: power})
+	}
+	result, err := s.changeSet.Apply(deviceID, steps)
+	if err != nil {
+		entry.Error = err.Error()
+		s.audit.Record(actor, entry)
+		return nil, err
+	}
+	entry.Commands = ChangeSetCommands(result)
+	entry.Error = result.Error
+	s.audit.Record(actor, entry)
+	if !result.Success {
+		return entry.Commands, errors.New(result.Error)
+	}
+	return entry.Commands, nil
+}
+
+// roleSteps 按板卡配置渲染设置角色和从节点最大发射功率的命令
+func (s *StarRoleService) roleSteps(deviceID uint, role, power string) ([]ChangeStep, error) {
+	device, err := s.deviceComm.getDeviceByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	deviceType, _ := strconv.Atoi(role)
+	planned := []PlannedCommand{{
+		Step:     "device type",
+		Name:     "set_device_type",
+		Groups:   []map[string]interface{}{{"type": deviceType}},
+		Fallback: fmt.Sprintf("AT^DDTC=%d", deviceType),
+	}}
+	if power != "" {
+		fields := trimmedFields(power)
+		scell := fields[len(fields)-1]
+		planned = append(planned, PlannedCommand{
+			Step:     "slave max tx power",
+			Name:     "set_slave_max_tx_power",
+			Groups:   []map[string]interface{}{{"power": fields[0], "scell_power": scell}},
+			Fallback: "AT^DSSMTP=" + strings.Join(fields, ","),
+		})
+	}
+	commands, _, errs, _ := renderPlannedCommands(s.deviceComm.boardConfigMgr, device.BoardType, nil, planned)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("board validation failed: %s", strings.Join(errs, "; "))
+	}
+	return previewSteps(commands), nil
+}
+
+// readRole 读取AT^DDTC（主节点还读取AT^DSSMTP）并更新缓存；设备不可达时返回上次读到的角色
+func (s *StarRoleService) readRole(device *model.Device) StarDeviceRole {
+	role := StarDeviceRole{DeviceID: device.ID, Name: device.Name, NodeID: device.NodeID, BoardType: device.BoardType}
+	var cached model.MasterSlaveConfig
+	hasCache := s.db.Where("device_id = ?", device.ID).First(&cached).Error == nil
+
+	value, err := s.changeSet.readValue(device, starDeviceTypeQuery)
+	if err != nil {
+		role.Error = err.Error()
+		if hasCache {
+			role.Cached = true
+			role.ConfiguredType, role.ActiveType, role.SlaveMaxTxPower = cached.NowType, cached.ActiveType, cached.Configuration
+		}
+	} else {
+		role.ConfiguredType, role.ActiveType = parseDeviceType(value)
+		if role.ActiveType == model.StarDeviceTypeMaster {
+			if power, err := s.changeSet.readValue(device, starSlaveMaxTxPowerQuery); err == nil {
+				role.SlaveMaxTxPower = strings.Join(trimmedFields(power), ",")
+			}
+		}
+		cached.DeviceID = device.ID
+		cached.NowType, cached.ActiveType, cached.Configuration = role.ConfiguredType, role.ActiveType, role.SlaveMaxTxPower
+		if err := s.db.Save(&cached).Error; err != nil {
+			log.Printf("Failed to cache the role of device %d: %v", device.ID, err)
+		}
+	}
+	role.ConfiguredRole = starRoleName(role.ConfiguredType)
+	role.ActiveRole = starRoleName(role.ActiveType)
+	role.PendingReboot = role.ConfiguredType != "" && role.ConfiguredType != role.ActiveType
+	return role
+}
+
+// networks 按设备链路把星型设备划分为网络，并检查主节点数量
+func (s *StarRoleService) networks(devices []model.Device, roles map[uint]StarDeviceRole) ([]StarNetwork, error) {
+	ids := make([]uint, 0, len(devices))
+	for _, d := range devices {
+		ids = append(ids, d.ID)
+	}
+	var links []model.DeviceLink
+	if err := s.db.Where("source_device_id IN ? AND target_device_id IN ?", ids, ids).Find(&links).Error; err != nil {
+		return nil, err
+	}
+	parent := make(map[uint]uint, len(ids))
+	for _, id := range ids {
+		parent[id] = id
+	}
+	var find func(uint) uint
+	find = func(id uint) uint {
+		if parent[id] != id {
+			parent[id] = find(parent[id])
+		}
+		return parent[id]
+	}
+	for _, l := range links {
+		a, b := find(l.SourceDeviceID), find(l.TargetDeviceID)
+		if a > b {
+			a, b = b, a
+		}
+		parent[b] = a
+	}
+	groups := make(map[uint][]uint)
+	roots := make(map[uint]bool)
+	for _, id := range ids {
+		root := find(id)
+		groups[root] = append(groups[root], id)
+		roots[root] = true
+	}
+
+	var networks []StarNetwork
+	for _, root := range sortedIDs(roots) {
+		n := StarNetwork{Index: len(networks) + 1, DeviceIDs: groups[root], Masters: []uint{}, Issues: []string{}}
+		var masters, pending, unread []string
+		for _, id := range groups[root] {
+			role := roles[id]
+			n.Devices = append(n.Devices, role)
+			if role.ActiveType == model.StarDeviceTypeMaster {
+				n.Masters = append(n.Masters, id)
+				masters = append(masters, role.Name)
+			}
+			if role.PendingReboot {
+				pending = append(pending, fmt.Sprintf("%s (%s until reboot, configured %s)", role.Name, role.ActiveRole, role.ConfiguredRole))
+			}
+			if role.Cached {
+				unread = append(unread, role.Name+" (last known role shown)")
+			} else if role.Error != "" {
+				unread = append(unread, role.Name)
+			}
+		}
+		switch {
+		case len(masters) == 0:
+			n.Issues = append(n.Issues, "no master: the slaves have no center node to attach to")
+		case len(masters) > 1:
+			n.Issues = append(n.Issues, fmt.Sprintf("multiple masters: %s", strings.Join(masters, ", ")))
+		}
+		if len(pending) > 0 {
+			n.Issues = append(n.Issues, fmt.Sprintf("role changes pending a reboot: %s", strings.Join(pending, ", ")))
+		}
+		if len(unread) > 0 {
+			n.Issues = append(n.Issues, fmt.Sprintf("role could not be read: %s", strings.Join(unread, ", ")))
+		}
+		networks = append(networks, n)
+	}
+	return networks, nil
+}
+
+// starDevices 星型板卡设备；指定deviceIDs时必须全部是星型板卡
+func (s *StarRoleService) starDevices(deviceIDs []uint) ([]model.Device, error) {
+	var devices []model.Device
+	query := s.db.Order("id").Where("board_type LIKE ?", "%star%")
+	if len(deviceIDs) > 0 {
+		query = query.Where("id IN ?", deviceIDs)
+	}
+	if err := query.Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	if len(deviceIDs) > 0 && len(devices) != len(uniqueIDs(deviceIDs)) {
+		return nil, fmt.Errorf("%w: device_ids contains unknown devices or devices that are not star boards", ErrStarRoleInvalid)
+	}
+	return devices, nil
+}
+
+// storeRole 保存切换后的角色：角色缓存、同步的device_type配置，以及已有的期望配置
+func (s *StarRoleService) storeRole(handover *model.StarHandover, deviceID uint, role, power string) {
+	updates := map[string]interface{}{"now_type": role, "active_type": role}
+	if power != "" || role != model.StarDeviceTypeMaster {
+		updates["configuration"] = power
+	}
+	if err := s.db.Model(&model.MasterSlaveConfig{}).Where("device_id = ?", deviceID).Updates(updates).Error; err != nil {
+		log.Printf("Star handover %d: failed to cache the role of device %d: %v", handover.ID, deviceID, err)
+	}
+	for _, key := range []string{"device_type", "working_type"} {
+		res := s.db.Model(&model.DeviceConfig{}).Where("device_id = ? AND category = ? AND key = ?", deviceID, "device_type", key).Update("value", role)
+		if res.Error == nil && res.RowsAffected == 0 {
+			res = s.db.Create(&model.DeviceConfig{DeviceID: deviceID, Category: "device_type", Key: key, Value: role, Type: "string"})
+		}
+		if res.Error != nil {
+			log.Printf("Star handover %d: failed to save %s of device %d: %v", handover.ID, key, deviceID, res.Error)
+		}
+	}
+
+	// 期望配置中的旧角色会被漂移修复改回去
+	desired := map[string]string{"device_type": role}
+	if power != "" {
+		desired["slave_max_tx_power"] = trimmedFields(power)[0]
+	}
+	for key, value := range desired {
+		res := s.db.Model(&model.DesiredConfig{}).Where("device_id = ? AND key = ? AND value <> ?", deviceID, key, value).Update("value", value)
+		if res.Error != nil {
+			log.Printf("Star handover %d: failed to update desired %s of device %d: %v", handover.ID, key, deviceID, res.Error)
+		} else if res.RowsAffected > 0 {
+			handover.Notes = append(handover.Notes, fmt.Sprintf("updated the desired %s of device %d to %s", key, deviceID, value))
+		}
+	}
+}
+
+func (s *StarRoleService) finish(handover *model.StarHandover, status, message string) {
+	now := time.Now()
+	handover.Status = status
+	handover.Error = message
+	handover.FinishedAt = &now
+	s.save(handover)
+	log.Printf("Star handover %d finished: %s %s", handover.ID, status, message)
+}
+
+func (s *StarRoleService) save(handover *model.StarHandover) {
+	if err := s.db.Save(handover).Error; err != nil {
+		log.Printf("Failed to save star handover %d: %v", handover.ID, err)
+	}
+}
+
+// parseDeviceType 解析AT^DDTC?的"配置类型,生效类型"；只有一个字段时两者相同
+func parseDeviceType(value string) (configured, active string) {
+	fields := trimmedFields(value)
+	configured, active = fields[0], fields[0]
+	if len(fields) > 1 {
+		active = fields[1]
+	}
+	return configured, active
+}
+
+func starRoleName(deviceType string) string {
+	switch deviceType {
+	case model.StarDeviceTypeMaster:
+		return "master"
+	case model.StarDeviceTypeSlave:
+		return "slave"
+	}
+	return "unknown"
+}
+
+func trimmedFields(value string) []string {
+	fields := strings.Split(value, ",")
+	for i, f := range fields {
+		fields[i] = strings.Trim(strings.TrimSpace(f), "\"")
+	}
+	return fields
+}
+
+// validateSlaveMaxTxPower 校验"主小区[,辅小区]"最大发射功率
+func validateSlaveMaxTxPower(value string) error {
+	fields := trimmedFields(value)
+	if len(fields) > 2 {
+		return fmt.Errorf("slave_max_tx_power takes at most two values (PCell,SCell), got %q", value)
+	}
+	for _, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < minSlaveMaxTxPower || n > maxSlaveMaxTxPower {
+			return fmt.Errorf("slave max tx power %q must be within %d..%d dBm", f, minSlaveMaxTxPower, maxSlaveMaxTxPower)
+		}
+	}
+	return nil
+}
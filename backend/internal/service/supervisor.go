@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Worker states reported by the supervisor.
+const (
+	WorkerRunning = "running"
+	WorkerStopped = "stopped"
+	WorkerFailed  = "failed"
+)
+
+// WorkerStatus is the externally visible state of one background worker.
+type WorkerStatus struct {
+	Name         string     `json:"name"`
+	State        string     `json:"state"`
+	StartedAt    time.Time  `json:"started_at"`
+	StoppedAt    *time.Time `json:"stopped_at,omitempty"`
+	LastRun      *time.Time `json:"last_run,omitempty"`
+	LastDuration int64      `json:"last_duration_ms"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastErrorAt  *time.Time `json:"last_error_at,omitempty"`
+	Runs         int64      `json:"runs"`
+	Failures     int64      `json:"failures"`
+
+	generation uint64 // 每次 Go 启动递增，finish 只更新同一次启动的状态
+}
+
+// maxFinishedWorkers caps how many stopped or failed workers are kept for the
+// status endpoint. Per-job workers (reboot jobs, rollouts, key rotations,
+// firmware upgrades...) each get their own name, so without a cap the map
+// would grow with every job ever run.
+const maxFinishedWorkers = 100
+
+// Supervisor 管理后台任务的生命周期：统一启动、记录运行状态、优雅停止
+type Supervisor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu         sync.RWMutex
+	workers    map[string]*WorkerStatus
+	generation uint64
+}
+
+// NewSupervisor 创建后台任务管理器
+func NewSupervisor() *Supervisor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Supervisor{
+		ctx:     ctx,
+		cancel:  cancel,
+		workers: make(map[string]*WorkerStatus),
+	}
+}
+
+// Context is cancelled when shutdown begins.
+func (s *Supervisor) Context() context.Context {
+	return s.ctx
+}
+
+// Go runs fn in a tracked goroutine until it returns or the supervisor stops.
+func (s *Supervisor) Go(name string, fn func(ctx context.Context) error) {
+	generation := s.register(name)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		err := fn(s.ctx)
+		if errors.Is(err, context.Canceled) {
+			err = nil
+		}
+		s.finish(name, generation, err)
+	}()
+}
+
+// Track runs fn once and records its outcome against the named worker.
+func (s *Supervisor) Track(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	s.Report(name, start, err)
+	return err
+}
+
+// Report records one run of a worker that manages its own loop.
+func (s *Supervisor) Report(name string, start time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.workerLocked(name)
+	now := time.Now()
+	w.LastRun = &start
+	w.LastDuration = now.Sub(start).Milliseconds()
+	w.Runs++
+	if err != nil {
+		w.Failures++
+		w.LastError = err.Error()
+		w.LastErrorAt = &now
+	}
+}
+
+// Statuses returns a snapshot of all workers sorted by name.
+func (s *Supervisor) Statuses() []WorkerStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]WorkerStatus, 0, len(s.workers))
+	for _, w := range s.workers {
+		list = append(list, *w)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Shutdown cancels every worker and waits for them until ctx expires.
+func (s *Supervisor) Shutdown(ctx context.Context) error {
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Println("All background workers stopped")
+		return nil
+	case <-ctx.Done():
+		var running []string
+		for _, w := range s.Statuses() {
+			if w.State == WorkerRunning {
+				running = append(running, w.Name)
+			}
+		}
+		return fmt.Errorf("timed out waiting for workers: %v", running)
+	}
+}
+
+// register marks the worker as running and returns the generation of this start.
+func (s *Supervisor) register(name string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	w := s.workerLocked(name)
+	w.State = WorkerRunning
+	w.StartedAt = time.Now()
+	w.StoppedAt = nil
+	w.generation = s.generation
+	return s.generation
+}
+
+// finish records the exit of one start of a worker. A goroutine that has been
+// replaced by a newer start under the same name leaves the status alone.
+func (s *Supervisor) finish(name string, generation uint64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.workers[name]
+	if !ok || w.generation != generation {
+		if err != nil {
+			log.Printf("Superseded worker %s exited with error: %v", name, err)
+		}
+		return
+	}
+	now := time.Now()
+	w.StoppedAt = &now
+	w.State = WorkerStopped
+	if err != nil {
+		w.State = WorkerFailed
+		w.LastError = err.Error()
+		w.LastErrorAt = &now
+		log.Printf("Worker %s exited with error: %v", name, err)
+	}
+	s.pruneLocked()
+}
+
+// pruneLocked drops the oldest finished workers beyond maxFinishedWorkers.
+// Running workers are always kept.
+func (s *Supervisor) pruneLocked() {
+	var finished []*WorkerStatus
+	for _, w := range s.workers {
+		if w.State != WorkerRunning && w.StoppedAt != nil {
+			finished = append(finished, w)
+		}
+	}
+	if len(finished) <= maxFinishedWorkers {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		if !finished[i].StoppedAt.Equal(*finished[j].StoppedAt) {
+			return finished[i].StoppedAt.Before(*finished[j].StoppedAt)
+		}
+		return finished[i].generation < finished[j].generation
+	})
+	for _, w := range finished[:len(finished)-maxFinishedWorkers] {
+		delete(s.workers, w.Name)
+	}
+}
+
+func (s *Supervisor) workerLocked(name string) *WorkerStatus {
+	w, ok := s.workers[name]
+	if !ok {
+		w = &WorkerStatus{Name: name}
+		s.workers[name] = w
+	}
+	return w
+}
+
+// inflightCommands tracks AT commands currently being sent to devices so that
+// shutdown can wait for them instead of cutting a set command in half.
+var inflightCommands = &commandTracker{}
+
+type commandTracker struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	draining bool
+	count    int
+}
+
+// begin registers a command; it fails once shutdown has started.
+func (t *commandTracker) begin() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return fmt.Errorf("server is shutting down, device command rejected")
+	}
+	t.count++
+	t.wg.Add(1)
+	return nil
+}
+
+func (t *commandTracker) done() {
+	t.mu.Lock()
+	t.count--
+	t.mu.Unlock()
+	t.wg.Done()
+}
+
+// DrainDeviceCommands stops accepting new device commands and waits for the
+// in-flight ones until ctx expires.
+func DrainDeviceCommands(ctx context.Context) error {
+	t := inflightCommands
+	t.mu.Lock()
+	t.draining = true
+	pending := t.count
+	t.mu.Unlock()
+	if pending > 0 {
+		log.Printf("Waiting for %d in-flight device commands", pending)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		t.mu.Lock()
+		pending = t.count
+		t.mu.Unlock()
+		return fmt.Errorf("%d device commands still in flight at deadline", pending)
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSupervisorFinishIgnoresSupersededStart(t *testing.T) {
+	s := NewSupervisor()
+	first := s.register("reboot_job_1")
+	second := s.register("reboot_job_1")
+
+	s.finish("reboot_job_1", first, errors.New("old run failed"))
+	w := s.workers["reboot_job_1"]
+	if w.State != WorkerRunning || w.LastError != "" {
+		t.Fatalf("superseded finish changed the replacement: state=%s error=%q", w.State, w.LastError)
+	}
+
+	s.finish("reboot_job_1", second, nil)
+	if w := s.workers["reboot_job_1"]; w.State != WorkerStopped {
+		t.Fatalf("state = %s, want %s", w.State, WorkerStopped)
+	}
+}
+
+func TestSupervisorPrunesFinishedWorkers(t *testing.T) {
+	s := NewSupervisor()
+	s.register("inventory")
+	total := maxFinishedWorkers + 10
+	for i := 0; i < total; i++ {
+		name := fmt.Sprintf("rollout_%d", i)
+		s.finish(name, s.register(name), nil)
+	}
+
+	if got, want := len(s.Statuses()), maxFinishedWorkers+1; got != want {
+		t.Fatalf("workers = %d, want %d", got, want)
+	}
+	if w, ok := s.workers["inventory"]; !ok || w.State != WorkerRunning {
+		t.Errorf("running worker was pruned")
+	}
+	if _, ok := s.workers["rollout_0"]; ok {
+		t.Errorf("oldest finished worker was kept")
+	}
+	if _, ok := s.workers[fmt.Sprintf("rollout_%d", total-1)]; !ok {
+		t.Errorf("newest finished worker was pruned")
+	}
+}
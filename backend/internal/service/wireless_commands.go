@@ -0,0 +1,315 @@
+package service
+
+import (
+	"backend/internal/model"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 读不到设备和数据库中的频点、功率时使用的默认值
+const (
+	DefaultRadioFrequency = "24020"
+	DefaultRadioPower     = "27"
+)
+
+// bandwidthValues 带宽字符串与AT^DRPC/AT^DRPS中数值的对应关系
+var bandwidthValues = map[string]int{
+	"1.4M": 0,
+	"3M":   1,
+	"5M":   2,
+	"10M":  3,
+	"20M":  5,
+}
+
+// bandwidthOrder 从宽到窄的带宽，以及各带宽的信道半宽(100KHz)
+var (
+	bandwidthOrder     = []string{"20M", "10M", "5M", "3M", "1.4M"}
+	bandwidthHalfWidth = map[string]int{
+		"1.4M": 7,
+		"3M":   15,
+		"5M":   25,
+		"10M":  50,
+		"20M":  100,
+	}
+)
+
+// subBands 建链频点范围所属的band编号（AT^DSONSBR）
+var subBands = []struct {
+	band       int
+	start, end int
+}{
+	{64, 24015, 24814},
+	{65, 8060, 8259},
+	{66, 14279, 14478},
+	{67, 17850, 18049},
+	{69, 51500, 58499},
+	{71, 5000, 6999},
+}
+
+// frequencyBands AT^DAOCNDI频段位图中各频段的bit位及其频点范围(100KHz)
+var frequencyBands = []struct {
+	name       string
+	bit        uint
+	start, end int
+}{
+	{"800M", 0, 8060, 8259},
+	{"1.4G", 2, 14279, 14478},
+	{"2.4G", 3, 24015, 24814},
+}
+
+// FrequencyBandCommand 根据AT^DAOCNDI指令文档，将频段转换为十六进制位图
+// Bit0: 800M频段, Bit2: 1.4G频段, Bit3: 2.4G频段
+func FrequencyBandCommand(bands []string) (PlannedCommand, error) {
+	bandBitmap := 0
+	for _, band := range bands {
+		for _, fb := range frequencyBands {
+			if fb.name == band {
+				bandBitmap |= 1 << fb.bit
+			}
+		}
+	}
+
+	// 验证位图值是否在合理范围内 (0-15，因为只有4个bit位)
+	if bandBitmap < 0 || bandBitmap > 15 {
+		return PlannedCommand{}, fmt.Errorf("Invalid band bitmap value: %d (0x%X). Must be between 0-15.", bandBitmap, bandBitmap)
+	}
+
+	// 使用十六进制字符串格式（不带引号），符合AT指令文档要求
+	bitmap := fmt.Sprintf("%02X", bandBitmap)
+	return PlannedCommand{
+		Step:     "band config",
+		Name:     "set_band_config",
+		Groups:   []map[string]interface{}{{"band_bitmap": bitmap}},
+		Fallback: "AT^DAOCNDI=" + bitmap,
+	}, nil
+}
+
+// BandsFromBitmap 将AT^DAOCNDI的十六进制位图还原为频段名称
+func BandsFromBitmap(bitmap string) []string {
+	value, err := strconv.ParseUint(strings.Trim(strings.TrimSpace(bitmap), "\""), 16, 32)
+	if err != nil {
+		return nil
+	}
+	var bands []string
+	for _, fb := range frequencyBands {
+		if value&(1<<fb.bit) != 0 {
+			bands = append(bands, fb.name)
+		}
+	}
+	return bands
+}
+
+// FrequencyInBands 检查频点是否落在所选频段之一内；未知的频段名称不限制频点
+func FrequencyInBands(freq int, bands []string) bool {
+	known := false
+	for _, band := range bands {
+		for _, fb := range frequencyBands {
+			if fb.name != band {
+				continue
+			}
+			known = true
+			if freq >= fb.start && freq <= fb.end {
+				return true
+			}
+		}
+	}
+	return !known
+}
+
+// bandRanges 描述所选频段的频点范围，用于错误信息
+func bandRanges(bands []string) string {
+	var ranges []string
+	for _, band := range bands {
+		for _, fb := range frequencyBands {
+			if fb.name == band {
+				ranges = append(ranges, fmt.Sprintf("%s %d-%d", fb.name, fb.start, fb.end))
+			}
+		}
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// BandwidthName 将AT指令中的带宽数值转换为带宽字符串
+func BandwidthName(value int) (string, bool) {
+	for name, v := range bandwidthValues {
+		if v == value {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// BandwidthValue 将带宽字符串转换为AT指令中的数值
+func BandwidthValue(bandwidth string) (int, error) {
+	value, ok := bandwidthValues[bandwidth]
+	if !ok {
+		return 0, errors.New("Invalid bandwidth value")
+	}
+	return value, nil
+}
+
+// RadioParamsCommands 先用AT^DRPS存储到NVRAM，再用AT^DRPC实时生效
+func RadioParamsCommands(freq, bandwidth int, power string) []PlannedCommand {
+	radioParams := map[string]interface{}{"freq": freq, "bandwidth": bandwidth, "power": power}
+	return []PlannedCommand{
+		{
+			Step:     "store radio params",
+			Name:     "set_radio_params_store",
+			Groups:   []map[string]interface{}{radioParams},
+			Fallback: fmt.Sprintf("AT^DRPS=%d,%d,\"%s\"", freq, bandwidth, power),
+		},
+		{
+			Step:     "apply radio params",
+			Name:     "set_radio_params",
+			Groups:   []map[string]interface{}{radioParams},
+			Fallback: fmt.Sprintf("AT^DRPC=%d,%d,\"%s\"", freq, bandwidth, power),
+		},
+	}
+}
+
+// BuildingChainCommand 解析频点范围，格式如 "24015-24814,8060-8259,14279-14478"，
+// 根据AT^DSONSBR指令文档为每个频段设置对应的band编号，多个频段的参数依次拼接
+func BuildingChainCommand(frequencyPoint string) (PlannedCommand, error) {
+	if frequencyPoint == "" {
+		return PlannedCommand{}, errors.New("Frequency point cannot be empty")
+	}
+
+	var atCmdParts []string
+	var groups []map[string]interface{}
+	for _, rangeStr := range strings.Split(frequencyPoint, ",") {
+		rangeStr = strings.TrimSpace(rangeStr)
+		if rangeStr == "" {
+			continue
+		}
+
+		parts := strings.Split(rangeStr, "-")
+		if len(parts) != 2 {
+			return PlannedCommand{}, errors.New("Invalid frequency range format. Expected format: start-end")
+		}
+		startFreq, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return PlannedCommand{}, errors.New("Invalid start frequency")
+		}
+		endFreq, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return PlannedCommand{}, errors.New("Invalid end frequency")
+		}
+
+		band := 0
+		for _, sb := range subBands {
+			if startFreq >= sb.start && endFreq <= sb.end {
+				band = sb.band
+				break
+			}
+		}
+		if band == 0 {
+			return PlannedCommand{}, errors.New("Frequency range not supported")
+		}
+
+		atCmdParts = append(atCmdParts, fmt.Sprintf("%d,%d,%d", band, startFreq, endFreq))
+		groups = append(groups, map[string]interface{}{"band": band, "earfcn_start": startFreq, "earfcn_end": endFreq})
+	}
+	if len(atCmdParts) == 0 {
+		return PlannedCommand{}, errors.New("No valid frequency ranges provided")
+	}
+
+	return PlannedCommand{
+		Step:     "sub band range",
+		Name:     "set_sub_band_range",
+		Groups:   groups,
+		Fallback: fmt.Sprintf("AT^DSONSBR=%s", strings.Join(atCmdParts, ",")),
+	}, nil
+}
+
+// FrequencyHoppingCommand 设置跳频 (AT^DFHC)
+func FrequencyHoppingCommand(enabled bool) PlannedCommand {
+	n := 0
+	if enabled {
+		n = 1
+	}
+	return PlannedCommand{
+		Step:     "frequency hopping",
+		Name:     "set_frequency_hopping",
+		Groups:   []map[string]interface{}{{"n": n}},
+		Fallback: fmt.Sprintf("AT^DFHC=%d", n),
+	}
+}
+
+// 跳频间隔(秒)的取值范围，0表示使用单板默认的20秒
+const (
+	MinHopInterval = 0
+	MaxHopInterval = 60
+)
+
+// FrequencyHoppingIntervalCommand 设置跳频及每轮跳频之间的间隔 (AT^DFHC=<n>,<HopInterval>)；
+// 单板YAML不带间隔参数时只下发开关
+func FrequencyHoppingIntervalCommand(enabled bool, interval int) (PlannedCommand, error) {
+	if interval < MinHopInterval || interval > MaxHopInterval {
+		return PlannedCommand{}, fmt.Errorf("hop interval %d out of range [%d, %d] seconds", interval, MinHopInterval, MaxHopInterval)
+	}
+	pc := FrequencyHoppingCommand(enabled)
+	pc.Groups[0]["HopInterval"] = interval
+	pc.Fallback = fmt.Sprintf("%s,%d", pc.Fallback, interval)
+	return pc, nil
+}
+
+// AccessPasswordCommand 设置自组网接入密码 (AT^DAPI)，HEX字符串，最长64个字符，重新上电后生效
+func AccessPasswordCommand(password string) (PlannedCommand, error) {
+	if password == "" || len(password) > 64 || len(password)%2 != 0 {
+		return PlannedCommand{}, errors.New("access password must be an even number of hex characters, at most 64")
+	}
+	for _, ch := range password {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", ch) {
+			return PlannedCommand{}, errors.New("access password must be hex (0-9, a-f, A-F)")
+		}
+	}
+	return PlannedCommand{
+		Step:     "access password",
+		Name:     "set_encryption_key",
+		Groups:   []map[string]interface{}{{"key": password}},
+		Fallback: fmt.Sprintf("AT^DAPI=\"%s\"", password),
+	}, nil
+}
+
+// ReadRadioParams 通过AT^DRPC?读取设备当前的频点、带宽和功率，读取失败时返回空字符串
+func (s *DeviceCommService) ReadRadioParams(deviceID uint) (freq, bandwidth, power string) {
+	response, err := s.SendATCommand(deviceID, "AT^DRPC?")
+	if err != nil || !strings.Contains(response, "^DRPC:") {
+		return "", "", ""
+	}
+	value := strings.TrimSpace(strings.SplitN(response, "^DRPC:", 2)[1])
+	value = strings.Split(value, "\r")[0]
+	value = strings.Split(value, "\n")[0]
+	values := strings.Split(value, ",")
+	if len(values) < 3 {
+		return "", "", ""
+	}
+	return strings.TrimSpace(values[0]), strings.TrimSpace(values[1]), strings.Trim(strings.TrimSpace(values[2]), "\"")
+}
+
+// StoredRadioParams 从数据库读取当前频点和功率，未保存时返回空字符串
+func (s *ConfigService) StoredRadioParams(deviceID uint) (freq, power string) {
+	configRaw, err := s.GetDeviceConfigs(deviceID, ConfigCategoryWireless)
+	if err != nil {
+		return "", ""
+	}
+	switch cfg := configRaw.(type) {
+	case model.WirelessConfig:
+		if cfg.Channel > 0 {
+			freq = strconv.Itoa(cfg.Channel)
+		}
+		if cfg.TransmitPower != 0 {
+			power = strconv.Itoa(cfg.TransmitPower)
+		}
+	case map[string]interface{}:
+		if v, ok := cfg["frequency"]; ok && v != nil {
+			freq = fmt.Sprintf("%v", v)
+		}
+		if v, ok := cfg["power"]; ok && v != nil {
+			power = fmt.Sprintf("%v", v)
+		}
+	}
+	return freq, power
+}
@@ -0,0 +1,388 @@
+package simulator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBoardParams seeds the emulated AT registers with plausible values in
+// the same shape real boards return for the matching query command.
+var defaultBoardParams = map[string]string{
+	"DGMR":     `"SK-MESH-V2.0.3"`,
+	"DUIP":     `"192.168.1.1"`,
+	"DACS":     "1,1",
+	"DRPC":     `14200,3,"23"`,
+	"DRPS":     `14200,3,"23"`,
+	"DSSMTP":   `"23"`,
+	"DAOCNDI":  "04",
+	"DDTC":     "1,1", // configured type, active type
+	"DCIAC":    "1",
+	"DSTC":     "2",
+	"DFHC":     "0",
+	"DAPI":     `"12345678"`,
+	"DSONSBR":  "66,14200,14400",
+	"DLF":      "0,0,0",
+	"NETIFCFG": "1,192.168.1.1,255.255.255.0,192.168.1.254",
+	"CFUN":     "1",
+	"DRPR":     "0",
+	"DAPR":     "0",
+}
+
+// VirtualBoard emulates one radio board: the legacy boa form endpoint, the
+// atservice.fcgi JSON endpoint, the DRPR monitor form and the firmware upload
+// form, all on its own port.
+type VirtualBoard struct {
+	NodeID    string
+	BoardType string
+	Addr      string // host:port the board listens on
+
+	// RebootTime is how long the board stays unreachable after a reboot.
+	RebootTime time.Duration
+	// Neighbors returns the DRPR lines to report, if set.
+	Neighbors func() []string
+
+	mu       sync.Mutex
+	params   map[string]string
+	server   *http.Server
+	rebooted int
+	requests int
+	firmware string // uploaded firmware version, activated by the next reboot
+}
+
+// NewVirtualBoard 创建虚拟板卡
+func NewVirtualBoard(nodeID, boardType, addr string) *VirtualBoard {
+	params := make(map[string]string, len(defaultBoardParams))
+	for k, v := range defaultBoardParams {
+		params[k] = v
+	}
+	b := &VirtualBoard{
+		NodeID:     nodeID,
+		BoardType:  boardType,
+		Addr:       addr,
+		RebootTime: 10 * time.Second,
+		params:     params,
+	}
+	params["DUIP"] = b.interfaceReport("192.168.1.1")
+	return b
+}
+
+// interfaceReport builds the AT^DUIP? value in the real board format:
+// index, IP, node address, MAC and serial number. The hardware identity is
+// derived from the node ID so every board keeps its own across resets.
+func (b *VirtualBoard) interfaceReport(ip string) string {
+	h := fnv.New32a()
+	h.Write([]byte(b.NodeID))
+	id := h.Sum32()
+	return fmt.Sprintf(`0,"%s",%08X,"02:00:%02x:%02x:%02x:%02x",SN%08X`,
+		ip, id, byte(id>>24), byte(id>>16), byte(id>>8), byte(id), id)
+}
+
+// Start begins listening; it returns once the port is bound.
+func (b *VirtualBoard) Start() error {
+	ln, err := net.Listen("tcp", b.Addr)
+	if err != nil {
+		return fmt.Errorf("board %s: %v", b.NodeID, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", b.handleRoot)
+	mux.HandleFunc("/boafrm/formAtcmdProcess", b.handleFormAT)
+	mux.HandleFunc("/atservice.fcgi", b.handleATService)
+	mux.HandleFunc("/boafrm/formDRPRMonitor", b.handleDRPRMonitor)
+	mux.HandleFunc("/boafrm/formUpload", b.handleFirmwareUpload)
+
+	srv := &http.Server{Handler: mux}
+	b.mu.Lock()
+	b.server = srv
+	b.mu.Unlock()
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("[Board %s] server error: %v", b.NodeID, err)
+		}
+	}()
+	return nil
+}
+
+// Stop shuts the board's HTTP server down.
+func (b *VirtualBoard) Stop() {
+	b.mu.Lock()
+	srv := b.server
+	b.server = nil
+	b.mu.Unlock()
+	if srv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}
+}
+
+// Reboot takes the board offline for RebootTime and brings it back.
+func (b *VirtualBoard) Reboot() {
+	b.mu.Lock()
+	b.rebooted++
+	b.mu.Unlock()
+
+	go func() {
+		// Give the HTTP response a moment to flush before dropping the port.
+		time.Sleep(200 * time.Millisecond)
+		b.Stop()
+		time.Sleep(b.RebootTime)
+		b.applyPending()
+		if err := b.Start(); err != nil {
+			log.Printf("[Board %s] failed to come back after reboot: %v", b.NodeID, err)
+		}
+	}()
+}
+
+// Param returns the current value of an emulated AT register.
+func (b *VirtualBoard) Param(name string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.params[name]
+}
+
+// SetParam overrides an emulated AT register.
+func (b *VirtualBoard) SetParam(name, value string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.params[name] = value
+}
+
+// Reboots returns how many times the board has been rebooted.
+func (b *VirtualBoard) Reboots() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rebooted
+}
+
+// Requests returns how many AT commands the board has served.
+func (b *VirtualBoard) Requests() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.requests
+}
+
+// Execute runs one AT command against the emulated registers and returns the
+// raw board response text.
+func (b *VirtualBoard) Execute(command string) string {
+	command = strings.TrimSpace(command)
+	b.mu.Lock()
+	b.requests++
+	b.mu.Unlock()
+
+	upper := strings.ToUpper(command)
+	if upper == "AT" {
+		return "OK"
+	}
+
+	var body string
+	switch {
+	case strings.HasPrefix(upper, "AT^"):
+		body = command[3:]
+	case strings.HasPrefix(upper, "AT+"):
+		body = command[3:]
+	default:
+		return "ERROR"
+	}
+
+	// Query: AT^NAME?
+	if strings.HasSuffix(body, "?") {
+		name := strings.ToUpper(strings.TrimSuffix(body, "?"))
+		if name == "DRPR" || name == "DAPR" {
+			return b.radioReport(name)
+		}
+		value, ok := b.lookup(name)
+		if !ok {
+			return "+CME ERROR: 4"
+		}
+		return fmt.Sprintf("^%s: %s\r\n\r\nOK", name, value)
+	}
+
+	// Set: AT^NAME=value, or action: AT^NAME
+	name, value := body, ""
+	if i := strings.Index(body, "="); i >= 0 {
+		name, value = body[:i], body[i+1:]
+	}
+	name = strings.ToUpper(name)
+
+	switch {
+	case name == "POWERCTL" && value == "1", name == "REBOOT":
+		b.Reboot()
+		return "OK"
+	case name == "RECOVSET" && value == "1":
+		b.mu.Lock()
+		// 恢复出厂设置不改变已安装的固件
+		firmware := b.params["DGMR"]
+		for k, v := range defaultBoardParams {
+			b.params[k] = v
+		}
+		b.params["DGMR"] = firmware
+		b.params["DUIP"] = b.interfaceReport("192.168.1.1")
+		b.mu.Unlock()
+		b.Reboot()
+		return "OK"
+	case value == "":
+		return "OK"
+	}
+
+	if name == "DDTC" {
+		// 设备类型重启后才生效：只修改配置值，当前生效值保持不变
+		configured := strings.TrimSpace(strings.Split(value, ",")[0])
+		value = configured + "," + b.ActiveType()
+	}
+	if name == "NETIFCFG" {
+		// 接口地址立即生效，AT^DUIP?随之上报新地址
+		if fields := strings.Split(value, ","); len(fields) > 1 {
+			b.SetParam("DUIP", b.interfaceReport(strings.Trim(strings.TrimSpace(fields[1]), `"`)))
+		}
+	}
+	b.SetParam(name, value)
+	return "OK"
+}
+
+// ActiveType returns the device type (AT^DDTC) the board currently runs as:
+// 1 = center, 2 = terminal.
+func (b *VirtualBoard) ActiveType() string {
+	fields := strings.Split(b.Param("DDTC"), ",")
+	return strings.TrimSpace(fields[len(fields)-1])
+}
+
+// applyPending activates settings that only take effect after a reboot:
+// the configured device type and an uploaded firmware image.
+func (b *VirtualBoard) applyPending() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	configured := strings.TrimSpace(strings.Split(b.params["DDTC"], ",")[0])
+	b.params["DDTC"] = configured + "," + configured
+	if b.firmware != "" {
+		// AT^DGMR? keeps the model prefix, e.g. "SK-MESH-V2.0.3" -> "SK-MESH-V2.0.4"
+		current := strings.Trim(b.params["DGMR"], `"`)
+		model := current
+		if i := strings.LastIndex(strings.ToUpper(current), "-V"); i >= 0 {
+			model = current[:i]
+		}
+		b.params["DGMR"] = fmt.Sprintf(`"%s-V%s"`, model, b.firmware)
+		b.firmware = ""
+	}
+}
+
+func (b *VirtualBoard) lookup(name string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	v, ok := b.params[name]
+	return v, ok
+}
+
+func (b *VirtualBoard) radioReport(name string) string {
+	var lines []string
+	if b.Neighbors != nil {
+		lines = b.Neighbors()
+	}
+	if name == "DAPR" {
+		for i, l := range lines {
+			lines[i] = strings.Replace(l, "^DRPR:", "^DAPR:", 1)
+		}
+	}
+	if len(lines) == 0 {
+		return fmt.Sprintf("^%s: %s\r\n\r\nOK", name, b.Param(name))
+	}
+	return strings.Join(lines, "\r\n") + "\r\n\r\nOK"
+}
+
+func (b *VirtualBoard) handleRoot(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "<html><body>%s %s</body></html>", b.BoardType, b.NodeID)
+}
+
+// handleFormAT serves the legacy 1.0 boa form: FormAtcmd_Param_Atcmd=<cmd>.
+func (b *VirtualBoard) handleFormAT(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	command := r.FormValue("FormAtcmd_Param_Atcmd")
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, b.Execute(command))
+}
+
+// handleATService serves the 2.0 endpoint: {"action":"sendcmd","AT":"..."}.
+// Like the real firmware, msg carries the raw AT response unquoted.
+func (b *VirtualBoard) handleATService(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Action string `json:"action"`
+		AT     string `json:"AT"`
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Action != "sendcmd" {
+		io.WriteString(w, "{\"retcode\":0,\"msg\":\r\nERROR\r\n}")
+		return
+	}
+	fmt.Fprintf(w, "{\"retcode\":1,\"msg\":\r\n%s\r\n}", b.Execute(req.AT))
+}
+
+// handleFirmwareUpload serves the firmware upgrade form: the multipart field
+// "binary" holds the image, "version" and "checksum" (SHA-256) describe it.
+// The image is checked and activated by the next reboot.
+func (b *VirtualBoard) handleFirmwareUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	file, _, err := r.FormFile("binary")
+	if err != nil {
+		http.Error(w, "ERROR: no firmware image", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil || size == 0 {
+		http.Error(w, "ERROR: empty firmware image", http.StatusBadRequest)
+		return
+	}
+	if sum := r.FormValue("checksum"); sum != "" && !strings.EqualFold(sum, hex.EncodeToString(hash.Sum(nil))) {
+		http.Error(w, "ERROR: checksum mismatch", http.StatusBadRequest)
+		return
+	}
+	version := strings.TrimSpace(r.FormValue("version"))
+	if version == "" {
+		http.Error(w, "ERROR: missing firmware version", http.StatusBadRequest)
+		return
+	}
+	b.mu.Lock()
+	b.firmware = version
+	b.mu.Unlock()
+	log.Printf("[Board %s] firmware %s uploaded (%d bytes), active after reboot", b.NodeID, version, size)
+	io.WriteString(w, "OK")
+}
+
+// handleDRPRMonitor serves formDRPRMonitor; DdtcType=1 returns current DRPR lines.
+func (b *VirtualBoard) handleDRPRMonitor(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	if r.FormValue("DdtcType") != "1" {
+		io.WriteString(w, "OK")
+		return
+	}
+	b.SetParam("DRPR", "1")
+	io.WriteString(w, b.radioReport("DRPR"))
+}
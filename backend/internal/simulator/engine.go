@@ -0,0 +1,256 @@
+package simulator
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// NeighborLink holds the simulated radio metrics of one directed link.
+type NeighborLink struct {
+	NodeID      string
+	Index       int
+	DistanceM   float64
+	PathLossDB  float64
+	RxPowerDBm  float64
+	RSRPDBm     float64
+	RSSIDBm     float64
+	RSRQDB      float64
+	SNRDB       float64
+	TxPowerDBm  float64
+	EARFCN      int
+	MCS         int
+	CQI         int
+	RB          int
+	DLKbps      int
+	ULKbps      int
+	DLSCHErrors int
+	DLSCHTotal  int
+}
+
+// NodeState is the simulated state of one node at a point on the timeline.
+type NodeState struct {
+	NodeID    string
+	Online    bool
+	Position  Position
+	Neighbors []NeighborLink
+}
+
+// resourceBlocks is the RB count used to convert received power into
+// per-resource-element RSRP (10MHz carrier).
+const resourceBlocks = 50
+
+// Engine evaluates a scenario deterministically for a given time offset.
+type Engine struct {
+	scenario *Scenario
+	nodes    map[string]NodeSpec
+	walkers  map[string]*randomWalker
+}
+
+// NewEngine 创建场景计算引擎
+func NewEngine(scenario *Scenario) *Engine {
+	nodes := make(map[string]NodeSpec, len(scenario.Nodes))
+	walkers := make(map[string]*randomWalker)
+	for i, n := range scenario.Nodes {
+		nodes[n.NodeID] = n
+		if n.Mobility != nil && n.Mobility.Type == MobilityRandomWalk {
+			walkers[n.NodeID] = newRandomWalker(n.Position, n.Mobility, scenario.Seed+int64(i)+1)
+		}
+	}
+	return &Engine{scenario: scenario, nodes: nodes, walkers: walkers}
+}
+
+// PositionAt returns where a node is at offset t.
+func (e *Engine) PositionAt(nodeID string, t time.Duration) Position {
+	n := e.nodes[nodeID]
+	if n.Mobility == nil {
+		return n.Position
+	}
+	switch n.Mobility.Type {
+	case MobilityWaypoint:
+		return waypointPosition(n.Position, n.Mobility, t)
+	case MobilityRandomWalk:
+		return e.walkers[nodeID].positionAt(t)
+	}
+	return n.Position
+}
+
+// Step computes every node's state at offset t from the scenario start.
+func (e *Engine) Step(t time.Duration) map[string]*NodeState {
+	states := make(map[string]*NodeState, len(e.scenario.Nodes))
+	for _, n := range e.scenario.Nodes {
+		states[n.NodeID] = &NodeState{
+			NodeID:   n.NodeID,
+			Online:   !e.rebooting(n.NodeID, t),
+			Position: e.PositionAt(n.NodeID, t),
+		}
+	}
+
+	for _, rx := range e.scenario.Nodes {
+		rxState := states[rx.NodeID]
+		if !rxState.Online {
+			continue
+		}
+		for _, tx := range e.scenario.Nodes {
+			if tx.NodeID == rx.NodeID || !states[tx.NodeID].Online {
+				continue
+			}
+			if e.linkFailed(tx.NodeID, rx.NodeID, t) {
+				continue
+			}
+			link, ok := e.evaluateLink(tx, states[tx.NodeID].Position, rx, rxState.Position, t)
+			if !ok {
+				continue
+			}
+			link.Index = len(rxState.Neighbors)
+			rxState.Neighbors = append(rxState.Neighbors, link)
+		}
+	}
+	return states
+}
+
+// evaluateLink derives the metrics seen at rx for transmissions from tx.
+// It reports false when the link does not close.
+func (e *Engine) evaluateLink(tx NodeSpec, txPos Position, rx NodeSpec, rxPos Position, t time.Duration) (NeighborLink, bool) {
+	p := e.scenario.Propagation
+
+	dist := distance(txPos, rxPos)
+	pathLoss := p.meanPathLoss(dist) +
+		p.shadowing(e.scenario.Seed, tx.NodeID, rx.NodeID, t) +
+		e.fadeAttenuation(tx.NodeID, rx.NodeID, t)
+
+	txPower := p.TxPowerDBm
+	if tx.TxPowerDBm != nil {
+		txPower = *tx.TxPowerDBm
+	}
+	rxPower := txPower - pathLoss
+	noise := addPowerDB(p.NoiseFloorDBm, e.interference(rx.NodeID, t))
+	snr := rxPower - noise
+
+	if rxPower < p.RxThresholdDBm || snr < p.MinSNRDB {
+		return NeighborLink{}, false
+	}
+
+	rsrp := rxPower - 10*math.Log10(12*resourceBlocks)
+	rssi := addPowerDB(rxPower, noise)
+	rsrq := 10*math.Log10(resourceBlocks) + rsrp - rssi
+
+	mcs := clampInt(int(math.Round((snr+5)*28/35)), 0, 28)
+	cqi := clampInt(int(math.Round((snr+6)/2)), 1, 15)
+	dlsch := 1000
+	dlschErr := clampInt(int(float64(dlsch)*math.Pow(10, -(snr-p.MinSNRDB)/10)), 0, dlsch)
+
+	return NeighborLink{
+		NodeID:      tx.NodeID,
+		DistanceM:   dist,
+		PathLossDB:  pathLoss,
+		RxPowerDBm:  rxPower,
+		RSRPDBm:     rsrp,
+		RSSIDBm:     rssi,
+		RSRQDB:      rsrq,
+		SNRDB:       snr,
+		TxPowerDBm:  txPower,
+		EARFCN:      p.EARFCN,
+		MCS:         mcs,
+		CQI:         cqi,
+		RB:          resourceBlocks,
+		DLKbps:      resourceBlocks * (mcs + 1) * 12,
+		ULKbps:      resourceBlocks * (mcs + 1) * 6,
+		DLSCHErrors: dlschErr,
+		DLSCHTotal:  dlsch,
+	}, true
+}
+
+func (e *Engine) rebooting(nodeID string, t time.Duration) bool {
+	for _, ev := range e.scenario.Events {
+		if ev.Type == EventNodeReboot && ev.activeAt(t) && ev.Nodes[0] == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) linkFailed(a, b string, t time.Duration) bool {
+	for _, ev := range e.scenario.Events {
+		if ev.Type == EventLinkFailure && ev.activeAt(t) && matchesLink(ev.Nodes, a, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// fadeAttenuation sums active fades on the link or on either endpoint.
+func (e *Engine) fadeAttenuation(a, b string, t time.Duration) float64 {
+	var total float64
+	for _, ev := range e.scenario.Events {
+		if ev.Type != EventFade || !ev.activeAt(t) {
+			continue
+		}
+		if len(ev.Nodes) == 2 && matchesLink(ev.Nodes, a, b) {
+			total += ev.AttenuationDB
+		} else if len(ev.Nodes) == 1 && (ev.Nodes[0] == a || ev.Nodes[0] == b) {
+			total += ev.AttenuationDB
+		}
+	}
+	return total
+}
+
+// interference returns the extra noise power (dBm above floor, summed in the
+// linear domain) received at nodeID. Bursts without nodes hit every node.
+func (e *Engine) interference(nodeID string, t time.Duration) float64 {
+	total := math.Inf(-1)
+	for _, ev := range e.scenario.Events {
+		if ev.Type != EventInterference || !ev.activeAt(t) {
+			continue
+		}
+		if len(ev.Nodes) > 0 && !containsString(ev.Nodes, nodeID) {
+			continue
+		}
+		total = addPowerDB(total, e.scenario.Propagation.NoiseFloorDBm+ev.InterferenceDB)
+	}
+	return total
+}
+
+// SortedNodeIDs returns node ids in a stable order for reporting.
+func (e *Engine) SortedNodeIDs() []string {
+	ids := make([]string, 0, len(e.nodes))
+	for id := range e.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func matchesLink(nodes []string, a, b string) bool {
+	return (nodes[0] == a && nodes[1] == b) || (nodes[0] == b && nodes[1] == a)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// addPowerDB sums two powers given in dBm.
+func addPowerDB(a, b float64) float64 {
+	if math.IsInf(a, -1) {
+		return b
+	}
+	if math.IsInf(b, -1) {
+		return a
+	}
+	return 10 * math.Log10(math.Pow(10, a/10)+math.Pow(10, b/10))
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
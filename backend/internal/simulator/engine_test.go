@@ -0,0 +1,106 @@
+package simulator
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+// neighborsOf returns the sorted neighbor ids each node sees at offset t.
+func neighborsOf(states map[string]*NodeState) map[string][]string {
+	out := make(map[string][]string, len(states))
+	for id, st := range states {
+		ids := []string{}
+		for _, n := range st.Neighbors {
+			ids = append(ids, n.NodeID)
+		}
+		sort.Strings(ids)
+		out[id] = ids
+	}
+	return out
+}
+
+func TestEngineStep(t *testing.T) {
+	// Two nodes 1km apart at 1420MHz: free-space loss 95.5dB, so the link
+	// closes at -72.5dBm with 31.5dB SNR over the -104dBm floor.
+	const events = `
+events:
+  - { type: link_failure, at: 10s, duration: 10s, nodes: ["1", "2"] }
+  - { type: node_reboot, at: 30s, duration: 10s, nodes: ["2"] }
+  - { type: fade, at: 50s, duration: 10s, nodes: ["1"], attenuation_db: 30 }
+  - { type: interference, at: 70s, duration: 10s, nodes: ["2"], interference_db: 33 }
+`
+	tests := []struct {
+		name     string
+		header   string
+		at       time.Duration
+		want1    []string // neighbors seen by node 1
+		want2    []string // neighbors seen by node 2
+		offline2 bool
+	}{
+		{name: "link up", at: 0, want1: []string{"2"}, want2: []string{"1"}},
+		{name: "link failure", at: 15 * time.Second, want1: []string{}, want2: []string{}},
+		{name: "after link failure", at: 20 * time.Second, want1: []string{"2"}, want2: []string{"1"}},
+		{name: "node reboot", at: 35 * time.Second, want1: []string{}, want2: []string{}, offline2: true},
+		{name: "fade below the rx threshold", at: 55 * time.Second, want1: []string{}, want2: []string{}},
+		// Interference lifts node 2's noise to -71dBm: SNR -1.5dB is above
+		// the default -5dB minimum but below an explicit 0dB one.
+		{name: "interference above default min snr", at: 75 * time.Second, want1: []string{"2"}, want2: []string{"1"}},
+		{name: "interference below explicit zero min snr", header: "propagation: { min_snr_db: 0 }\n", at: 75 * time.Second, want1: []string{"2"}, want2: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := LoadScenario(writeScenario(t, tt.header+twoNodes+events))
+			if err != nil {
+				t.Fatalf("LoadScenario: %v", err)
+			}
+			states := NewEngine(s).Step(tt.at)
+			if states["2"].Online == tt.offline2 {
+				t.Errorf("node 2 online = %v, want %v", states["2"].Online, !tt.offline2)
+			}
+			got := neighborsOf(states)
+			if !equalStrings(got["1"], tt.want1) || !equalStrings(got["2"], tt.want2) {
+				t.Errorf("neighbors = %v, want 1:%v 2:%v", got, tt.want1, tt.want2)
+			}
+		})
+	}
+}
+
+func TestEngineDeterministic(t *testing.T) {
+	s, err := LoadScenario("../../config/scenarios/mobile_log_distance.yaml")
+	if err != nil {
+		t.Fatalf("LoadScenario: %v", err)
+	}
+	a, b := NewEngine(s), NewEngine(s)
+	// b jumps straight to the offset; a walks there tick by tick.
+	for offset := time.Duration(0); offset <= 5*time.Minute; offset += s.TickInterval {
+		a.Step(offset)
+	}
+	at := 5 * time.Minute
+	sa, sb := a.Step(at), b.Step(at)
+	for _, id := range a.SortedNodeIDs() {
+		if sa[id].Position != sb[id].Position {
+			t.Errorf("node %s position %v != %v", id, sa[id].Position, sb[id].Position)
+		}
+		if len(sa[id].Neighbors) != len(sb[id].Neighbors) {
+			t.Fatalf("node %s neighbors %d != %d", id, len(sa[id].Neighbors), len(sb[id].Neighbors))
+		}
+		for i := range sa[id].Neighbors {
+			if sa[id].Neighbors[i] != sb[id].Neighbors[i] {
+				t.Errorf("node %s neighbor %d = %+v, want %+v", id, i, sa[id].Neighbors[i], sb[id].Neighbors[i])
+			}
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,589 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Load test operation kinds.
+const (
+	OpRegister = "register"
+	OpMonitor  = "monitor"
+	OpLinks    = "links"
+	OpDRPR     = "drpr"
+	OpATQuery  = "at_query"
+)
+
+// FleetConfig configures a fleet of virtual boards and the traffic they drive.
+type FleetConfig struct {
+	BackendURL  string
+	AuthToken   string
+	Host        string // address of the first board; board i listens on Host+i
+	Port        int    // port every board listens on; the backend always dials port 80
+	Count       int
+	BoardType   string
+	NodePrefix  string
+	Register    bool
+	Rate        float64       // total requests per second across the fleet
+	Duration    time.Duration // 0 runs until Stop
+	Concurrency int           // max in-flight backend requests
+	ATRatio     float64       // share of traffic sent as AT queries through the backend
+	RebootTime  time.Duration
+}
+
+// Fleet runs N virtual boards and a traffic generator against the backend.
+type Fleet struct {
+	cfg    FleetConfig
+	boards []*VirtualBoard
+	ids    []uint // backend device id per board, 0 if not registered
+	client *http.Client
+	stats  *LoadStats
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// NewFleet 创建虚拟板卡集群
+func NewFleet(cfg FleetConfig) *Fleet {
+	if cfg.Host == "" {
+		cfg.Host = "127.0.1.1"
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 80
+	}
+	if cfg.BoardType == "" {
+		cfg.BoardType = "board_2.0_mesh"
+	}
+	if cfg.NodePrefix == "" {
+		cfg.NodePrefix = "sim"
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 64
+	}
+	if cfg.Rate <= 0 {
+		cfg.Rate = 100
+	}
+	return &Fleet{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				MaxIdleConns:        cfg.Concurrency,
+				MaxIdleConnsPerHost: cfg.Concurrency,
+				IdleConnTimeout:     30 * time.Second,
+			},
+		},
+		stats: NewLoadStats(),
+		stop:  make(chan struct{}),
+	}
+}
+
+// Boards returns the running boards.
+func (f *Fleet) Boards() []*VirtualBoard {
+	return f.boards
+}
+
+// Stats returns the collected request statistics.
+func (f *Fleet) Stats() *LoadStats {
+	return f.stats
+}
+
+// Start binds every board to its own address and registers it with the
+// backend. The backend reaches boards by IP on port 80, so each board gets
+// its own loopback address rather than its own port.
+func (f *Fleet) Start() error {
+	first := net.ParseIP(f.cfg.Host).To4()
+	if first == nil {
+		return fmt.Errorf("host %q is not an IPv4 address", f.cfg.Host)
+	}
+	f.boards = make([]*VirtualBoard, f.cfg.Count)
+	f.ids = make([]uint, f.cfg.Count)
+	for i := 0; i < f.cfg.Count; i++ {
+		nodeID := fmt.Sprintf("%s-%04d", f.cfg.NodePrefix, i+1)
+		addr := net.JoinHostPort(nthIP(first, i).String(), strconv.Itoa(f.cfg.Port))
+		board := NewVirtualBoard(nodeID, f.cfg.BoardType, addr)
+		if f.cfg.RebootTime > 0 {
+			board.RebootTime = f.cfg.RebootTime
+		}
+		if i > 0 && strings.Contains(f.cfg.BoardType, "star") {
+			board.SetParam("DDTC", "2,2") // 第一块板为中心节点，其余为接入节点
+		}
+		idx := i
+		board.Neighbors = func() []string { return f.neighborReport(idx) }
+		if err := board.Start(); err != nil {
+			f.Stop()
+			return err
+		}
+		f.boards[i] = board
+	}
+	log.Printf("[Fleet] %d virtual boards listening on %s-%s port %d", f.cfg.Count, f.cfg.Host, nthIP(first, f.cfg.Count-1), f.cfg.Port)
+
+	if f.cfg.Register {
+		if err := f.registerAll(); err != nil {
+			f.Stop()
+			return err
+		}
+	}
+	return nil
+}
+
+// nthIP returns the IPv4 address n after ip.
+func nthIP(ip net.IP, n int) net.IP {
+	v := binary.BigEndian.Uint32(ip.To4()) + uint32(n)
+	out := make(net.IP, 4)
+	binary.BigEndian.PutUint32(out, v)
+	return out
+}
+
+// boardIP is the address the backend stores for a board: its IP without the port.
+func boardIP(b *VirtualBoard) string {
+	host, _, err := net.SplitHostPort(b.Addr)
+	if err != nil {
+		return b.Addr
+	}
+	return host
+}
+
+// Stop shuts down traffic and all boards.
+func (f *Fleet) Stop() {
+	f.once.Do(func() { close(f.stop) })
+	for _, b := range f.boards {
+		if b != nil {
+			b.Stop()
+		}
+	}
+}
+
+// registerAll creates backend devices for the boards, reusing existing ones.
+// Any board that fails to register fails the whole run: it would otherwise
+// sit idle with id 0 and silently shrink the fleet.
+func (f *Fleet) registerAll() error {
+	existing, err := f.listDevices()
+	if err != nil {
+		return fmt.Errorf("failed to list backend devices: %v", err)
+	}
+
+	sem := make(chan struct{}, f.cfg.Concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed int
+	var lastErr error
+	for i, b := range f.boards {
+		if id, ok := existing[b.NodeID]; ok {
+			f.ids[i] = id
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, b *VirtualBoard) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			payload := map[string]string{
+				"node_id":     b.NodeID,
+				"name":        b.NodeID,
+				"type":        "virtual",
+				"board_type":  b.BoardType,
+				"ip":          boardIP(b),
+				"description": "virtual board",
+			}
+			var resp struct {
+				Device struct {
+					ID uint `json:"id"`
+				} `json:"device"`
+			}
+			err := f.request(OpRegister, "POST", "/api/devices", payload, &resp)
+			if err == nil && resp.Device.ID == 0 {
+				err = fmt.Errorf("backend returned no device id")
+			}
+			if err != nil {
+				mu.Lock()
+				failed++
+				lastErr = err
+				mu.Unlock()
+				log.Printf("[Fleet] Failed to register %s: %v", b.NodeID, err)
+				return
+			}
+			f.ids[i] = resp.Device.ID
+		}(i, b)
+	}
+	wg.Wait()
+
+	log.Printf("[Fleet] %d/%d boards registered with %s, %d failed", len(f.boards)-failed, len(f.boards), f.cfg.BackendURL, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d/%d boards failed to register, last error: %v", failed, len(f.boards), lastErr)
+	}
+	return nil
+}
+
+func (f *Fleet) listDevices() (map[string]uint, error) {
+	var resp struct {
+		Devices []struct {
+			ID     uint   `json:"id"`
+			NodeID string `json:"node_id"`
+		} `json:"devices"`
+	}
+	if err := f.request("", "GET", "/api/devices", nil, &resp); err != nil {
+		return nil, err
+	}
+	ids := make(map[string]uint, len(resp.Devices))
+	for _, d := range resp.Devices {
+		ids[d.NodeID] = d.ID
+	}
+	return ids, nil
+}
+
+// Run generates traffic at the configured rate until Duration elapses or Stop.
+func (f *Fleet) Run() {
+	interval := time.Duration(float64(time.Second) / f.cfg.Rate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var deadline <-chan time.Time
+	if f.cfg.Duration > 0 {
+		timer := time.NewTimer(f.cfg.Duration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	progress := time.NewTicker(10 * time.Second)
+	defer progress.Stop()
+
+	sem := make(chan struct{}, f.cfg.Concurrency)
+	var wg sync.WaitGroup
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	next := 0
+
+	f.stats.Begin()
+	for {
+		select {
+		case <-f.stop:
+			wg.Wait()
+			f.stats.End()
+			return
+		case <-deadline:
+			wg.Wait()
+			f.stats.End()
+			return
+		case <-progress.C:
+			log.Printf("[Fleet] %s", f.stats.Summary())
+		case <-ticker.C:
+			idx := next % len(f.boards)
+			next++
+			if f.ids[idx] == 0 {
+				continue
+			}
+			select {
+			case sem <- struct{}{}:
+			default:
+				// Saturated: count as a client-side drop rather than queueing.
+				f.stats.Record("dropped", 0, fmt.Errorf("concurrency limit reached"))
+				continue
+			}
+			op := f.pickOp(rng.Float64())
+			wg.Add(1)
+			go func(idx int, op string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				f.send(idx, op)
+			}(idx, op)
+		}
+	}
+}
+
+func (f *Fleet) pickOp(r float64) string {
+	if r < f.cfg.ATRatio {
+		return OpATQuery
+	}
+	r = (r - f.cfg.ATRatio) / (1 - f.cfg.ATRatio)
+	switch {
+	case r < 0.5:
+		return OpMonitor
+	case r < 0.8:
+		return OpDRPR
+	default:
+		return OpLinks
+	}
+}
+
+func (f *Fleet) send(idx int, op string) {
+	id := f.ids[idx]
+	board := f.boards[idx]
+	switch op {
+	case OpMonitor:
+		payload := map[string]interface{}{
+			"type":           "radio",
+			"ip":             boardIP(board),
+			"earfcn":         14200,
+			"rsrp":           -90 - rand.Intn(20),
+			"snr":            5 + rand.Intn(20),
+			"signal_quality": 40 + rand.Intn(60),
+			"cpu_usage":      10 + rand.Intn(50),
+			"memory_usage":   20 + rand.Intn(50),
+			"timestamp":      time.Now(),
+		}
+		f.request(op, "POST", fmt.Sprintf("/api/devices/%d/monitor", id), payload, nil)
+	case OpLinks:
+		payload := map[string][]string{"neighbors": f.neighborIDs(idx)}
+		f.request(op, "POST", fmt.Sprintf("/api/devices/%d/links", id), payload, nil)
+	case OpDRPR:
+		body := strings.Join(f.neighborReport(idx), "\r\n")
+		f.requestRaw(op, "POST", fmt.Sprintf("/api/devices/%d/debug/drpr/report", id), "text/plain", []byte(body), nil)
+	case OpATQuery:
+		payload := map[string]string{"command": "AT^DGMR?"}
+		f.request(op, "POST", fmt.Sprintf("/api/devices/%d/at", id), payload, nil)
+	}
+}
+
+// neighborIDs arranges a mesh fleet as a ring: each board sees its two
+// neighbours. In a star fleet terminals see the active center nodes and the
+// centers see every terminal.
+func (f *Fleet) neighborIDs(idx int) []string {
+	n := len(f.boards)
+	if n < 2 {
+		return nil
+	}
+	if strings.Contains(f.cfg.BoardType, "star") {
+		if f.boards[idx] == nil {
+			return nil
+		}
+		center := f.boards[idx].ActiveType() == "1"
+		var ids []string
+		for i, b := range f.boards {
+			if i != idx && b != nil && (b.ActiveType() == "1") != center {
+				ids = append(ids, b.NodeID)
+			}
+		}
+		return ids
+	}
+	prev := f.boards[(idx-1+n)%n].NodeID
+	next := f.boards[(idx+1)%n].NodeID
+	if prev == next {
+		return []string{prev}
+	}
+	return []string{prev, next}
+}
+
+func (f *Fleet) neighborReport(idx int) []string {
+	var lines []string
+	for i, nodeID := range f.neighborIDs(idx) {
+		snr := 10 + rand.Float64()*15
+		lines = append(lines, FormatDRPR(NeighborLink{
+			NodeID:     nodeID,
+			Index:      i,
+			DistanceM:  500,
+			PathLossDB: 100,
+			RSSIDBm:    -70,
+			RSRPDBm:    -95,
+			RSRQDB:     -11,
+			SNRDB:      snr,
+			TxPowerDBm: 23,
+			EARFCN:     14200,
+			MCS:        20,
+			CQI:        12,
+			RB:         resourceBlocks,
+			DLKbps:     12000,
+			ULKbps:     6000,
+			DLSCHTotal: 1000,
+		}))
+	}
+	return lines
+}
+
+func (f *Fleet) request(op, method, path string, payload interface{}, out interface{}) error {
+	var body []byte
+	if payload != nil {
+		body, _ = json.Marshal(payload)
+	}
+	return f.requestRaw(op, method, path, "application/json", body, out)
+}
+
+func (f *Fleet) requestRaw(op, method, path, contentType string, body []byte, out interface{}) error {
+	req, err := http.NewRequest(method, f.cfg.BackendURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if f.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+f.cfg.AuthToken)
+	}
+
+	start := time.Now()
+	resp, err := f.client.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			err = fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+		} else if out != nil {
+			err = json.Unmarshal(data, out)
+		}
+	}
+	if op != "" {
+		f.stats.Record(op, time.Since(start), err)
+	}
+	return err
+}
+
+// LoadStats aggregates latency and error counts per operation.
+type LoadStats struct {
+	mu      sync.Mutex
+	ops     map[string]*opStats
+	started time.Time
+	ended   time.Time
+}
+
+type opStats struct {
+	count     int
+	errors    int
+	latencies []time.Duration
+	lastError string
+}
+
+// OpReport is the summary of one operation kind.
+type OpReport struct {
+	Op        string        `json:"op"`
+	Count     int           `json:"count"`
+	Errors    int           `json:"errors"`
+	ErrorRate float64       `json:"error_rate"`
+	P50       time.Duration `json:"p50"`
+	P95       time.Duration `json:"p95"`
+	P99       time.Duration `json:"p99"`
+	Max       time.Duration `json:"max"`
+	LastError string        `json:"last_error,omitempty"`
+}
+
+// NewLoadStats 创建负载统计
+func NewLoadStats() *LoadStats {
+	return &LoadStats{ops: make(map[string]*opStats)}
+}
+
+// Begin marks the start of the measured window.
+func (s *LoadStats) Begin() {
+	s.mu.Lock()
+	s.started = time.Now()
+	s.mu.Unlock()
+}
+
+// End marks the end of the measured window.
+func (s *LoadStats) End() {
+	s.mu.Lock()
+	s.ended = time.Now()
+	s.mu.Unlock()
+}
+
+// Record adds one request outcome.
+func (s *LoadStats) Record(op string, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.ops[op]
+	if !ok {
+		st = &opStats{}
+		s.ops[op] = st
+	}
+	st.count++
+	if err != nil {
+		st.errors++
+		st.lastError = err.Error()
+		return
+	}
+	st.latencies = append(st.latencies, latency)
+}
+
+// Report returns per-operation summaries sorted by name.
+func (s *LoadStats) Report() []OpReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reports := make([]OpReport, 0, len(s.ops))
+	for op, st := range s.ops {
+		lat := append([]time.Duration(nil), st.latencies...)
+		sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+		r := OpReport{
+			Op:        op,
+			Count:     st.count,
+			Errors:    st.errors,
+			P50:       percentile(lat, 0.50),
+			P95:       percentile(lat, 0.95),
+			P99:       percentile(lat, 0.99),
+			LastError: st.lastError,
+		}
+		if len(lat) > 0 {
+			r.Max = lat[len(lat)-1]
+		}
+		if st.count > 0 {
+			r.ErrorRate = float64(st.errors) / float64(st.count)
+		}
+		reports = append(reports, r)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Op < reports[j].Op })
+	return reports
+}
+
+// Summary is a one-line progress string.
+func (s *LoadStats) Summary() string {
+	var count, errs int
+	for _, r := range s.Report() {
+		count += r.Count
+		errs += r.Errors
+	}
+	s.mu.Lock()
+	elapsed := time.Since(s.started)
+	if !s.ended.IsZero() {
+		elapsed = s.ended.Sub(s.started)
+	}
+	s.mu.Unlock()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(count) / elapsed.Seconds()
+	}
+	errRate := 0.0
+	if count > 0 {
+		errRate = float64(errs) / float64(count) * 100
+	}
+	return fmt.Sprintf("requests=%d errors=%d (%.2f%%) throughput=%.1f req/s", count, errs, errRate, rate)
+}
+
+// Table renders the report as a fixed-width text table.
+func (s *LoadStats) Table() string {
+	var b strings.Builder
+	s.mu.Lock()
+	elapsed := s.ended.Sub(s.started)
+	s.mu.Unlock()
+	if elapsed <= 0 {
+		elapsed = time.Since(s.started)
+	}
+	fmt.Fprintf(&b, "Duration: %s\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(&b, "%-10s %8s %8s %8s %10s %10s %10s %10s\n", "op", "count", "errors", "err%", "p50", "p95", "p99", "max")
+	for _, r := range s.Report() {
+		fmt.Fprintf(&b, "%-10s %8d %8d %7.2f%% %10s %10s %10s %10s\n",
+			r.Op, r.Count, r.Errors, r.ErrorRate*100,
+			r.P50.Round(time.Microsecond), r.P95.Round(time.Microsecond),
+			r.P99.Round(time.Microsecond), r.Max.Round(time.Microsecond))
+	}
+	for _, r := range s.Report() {
+		if r.LastError != "" {
+			fmt.Fprintf(&b, "last %s error: %s\n", r.Op, r.LastError)
+		}
+	}
+	fmt.Fprintf(&b, "%s\n", s.Summary())
+	return b.String()
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i]
+}
@@ -0,0 +1,194 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Mobility model types.
+const (
+	MobilityWaypoint   = "waypoint"
+	MobilityRandomWalk = "random_walk"
+)
+
+// Mobility describes how a node moves over the scenario timeline.
+type Mobility struct {
+	Type      string        `yaml:"type"`
+	SpeedMPS  float64       `yaml:"speed_mps"`
+	Waypoints []Position    `yaml:"waypoints"` // waypoint: visited in order after the start position
+	Loop      bool          `yaml:"loop"`      // waypoint: return to the start and repeat
+	Pause     time.Duration `yaml:"pause"`     // waypoint: dwell time at each waypoint
+	Step      time.Duration `yaml:"step"`      // random_walk: heading change interval
+	Bounds    *Bounds       `yaml:"bounds"`    // random_walk: area the node is kept inside
+}
+
+// Bounds is a rectangular area in meters.
+type Bounds struct {
+	MinX float64 `yaml:"min_x"`
+	MinY float64 `yaml:"min_y"`
+	MaxX float64 `yaml:"max_x"`
+	MaxY float64 `yaml:"max_y"`
+}
+
+// defaultMobility returns the values used for mobility keys a node omits.
+func defaultMobility() Mobility {
+	return Mobility{Step: 10 * time.Second}
+}
+
+// UnmarshalYAML decodes a mobility block over the defaults, so omitted keys
+// are defaulted while explicit values, zero included, are kept.
+func (m *Mobility) UnmarshalYAML(value *yaml.Node) error {
+	type plain Mobility
+	decoded := plain(defaultMobility())
+	if err := value.Decode(&decoded); err != nil {
+		return err
+	}
+	*m = Mobility(decoded)
+	return nil
+}
+
+// validate checks the mobility parameters without changing them.
+func (m *Mobility) validate() error {
+	if m.SpeedMPS <= 0 {
+		return fmt.Errorf("%s mobility needs a positive speed_mps", m.Type)
+	}
+	switch m.Type {
+	case MobilityWaypoint:
+		if len(m.Waypoints) == 0 {
+			return fmt.Errorf("waypoint mobility needs at least one waypoint")
+		}
+	case MobilityRandomWalk:
+		if m.Step <= 0 {
+			return fmt.Errorf("random_walk mobility needs a positive step")
+		}
+		if b := m.Bounds; b != nil && (b.MaxX <= b.MinX || b.MaxY <= b.MinY) {
+			return fmt.Errorf("random_walk bounds are empty")
+		}
+	default:
+		return fmt.Errorf("unknown mobility type %q", m.Type)
+	}
+	return nil
+}
+
+// waypointPosition returns the position at t along the start -> waypoints path.
+func waypointPosition(start Position, m *Mobility, t time.Duration) Position {
+	path := append([]Position{start}, m.Waypoints...)
+	if m.Loop {
+		path = append(path, start)
+	}
+
+	// Total time of one pass over the path, including pauses.
+	var legs []time.Duration
+	var total time.Duration
+	for i := 1; i < len(path); i++ {
+		d := distance(path[i-1], path[i])
+		leg := time.Duration(d / m.SpeedMPS * float64(time.Second))
+		legs = append(legs, leg)
+		total += leg + m.Pause
+	}
+	if total <= 0 {
+		return start
+	}
+
+	if m.Loop {
+		t = t % total
+	} else if t >= total {
+		return path[len(path)-1]
+	}
+
+	for i, leg := range legs {
+		if t < leg {
+			frac := float64(t) / float64(leg)
+			a, b := path[i], path[i+1]
+			return Position{X: a.X + (b.X-a.X)*frac, Y: a.Y + (b.Y-a.Y)*frac}
+		}
+		t -= leg
+		if t < m.Pause {
+			return path[i+1]
+		}
+		t -= m.Pause
+	}
+	return path[len(path)-1]
+}
+
+// randomWalker advances a seeded random walk incrementally so that the same
+// seed always yields the same trajectory.
+type randomWalker struct {
+	start   Position
+	m       *Mobility
+	rng     *rand.Rand
+	seed    int64
+	pos     Position
+	heading float64
+	elapsed time.Duration
+}
+
+func newRandomWalker(start Position, m *Mobility, seed int64) *randomWalker {
+	w := &randomWalker{start: start, m: m, seed: seed}
+	w.reset()
+	return w
+}
+
+func (w *randomWalker) reset() {
+	w.rng = rand.New(rand.NewSource(w.seed))
+	w.pos = w.start
+	w.heading = w.rng.Float64() * 2 * math.Pi
+	w.elapsed = 0
+}
+
+// positionAt moves the walker forward to t; going backwards restarts the walk.
+func (w *randomWalker) positionAt(t time.Duration) Position {
+	if t < w.elapsed {
+		w.reset()
+	}
+	for w.elapsed+w.m.Step <= t {
+		w.move(w.m.Step)
+		w.elapsed += w.m.Step
+		w.heading = w.rng.Float64() * 2 * math.Pi
+	}
+
+	// Interpolate inside the current step without consuming randomness.
+	partial := *w
+	partial.move(t - w.elapsed)
+	return partial.pos
+}
+
+func (w *randomWalker) move(dt time.Duration) {
+	d := w.m.SpeedMPS * dt.Seconds()
+	w.pos.X += d * math.Cos(w.heading)
+	w.pos.Y += d * math.Sin(w.heading)
+
+	b := w.m.Bounds
+	if b == nil {
+		return
+	}
+	// Reflect at the edges of the area.
+	if w.pos.X < b.MinX || w.pos.X > b.MaxX {
+		w.pos.X = reflect(w.pos.X, b.MinX, b.MaxX)
+		w.heading = math.Pi - w.heading
+	}
+	if w.pos.Y < b.MinY || w.pos.Y > b.MaxY {
+		w.pos.Y = reflect(w.pos.Y, b.MinY, b.MaxY)
+		w.heading = -w.heading
+	}
+}
+
+func reflect(v, lo, hi float64) float64 {
+	span := hi - lo
+	v = math.Mod(v-lo, 2*span)
+	if v < 0 {
+		v += 2 * span
+	}
+	if v > span {
+		v = 2*span - v
+	}
+	return lo + v
+}
+
+func distance(a, b Position) float64 {
+	return math.Hypot(a.X-b.X, a.Y-b.Y)
+}
@@ -0,0 +1,93 @@
+package simulator
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestWaypointPosition(t *testing.T) {
+	start := Position{}
+	// 10m/s over two 100m legs with a 5s pause at each waypoint.
+	line := &Mobility{Type: MobilityWaypoint, SpeedMPS: 10, Pause: 5 * time.Second, Waypoints: []Position{{X: 100}, {X: 100, Y: 100}}}
+	// A 100m square walked in a loop without pauses: 40s per lap.
+	square := &Mobility{Type: MobilityWaypoint, SpeedMPS: 10, Loop: true, Waypoints: []Position{{X: 100}, {X: 100, Y: 100}, {Y: 100}}}
+	tests := []struct {
+		name string
+		m    *Mobility
+		at   time.Duration
+		want Position
+	}{
+		{name: "start", m: line, at: 0, want: Position{}},
+		{name: "halfway along the first leg", m: line, at: 5 * time.Second, want: Position{X: 50}},
+		{name: "arrives at the first waypoint", m: line, at: 10 * time.Second, want: Position{X: 100}},
+		{name: "pauses at the waypoint", m: line, at: 13 * time.Second, want: Position{X: 100}},
+		{name: "halfway along the second leg", m: line, at: 20 * time.Second, want: Position{X: 100, Y: 50}},
+		{name: "stays at the last waypoint", m: line, at: time.Hour, want: Position{X: 100, Y: 100}},
+		{name: "loop leg back to the start", m: square, at: 35 * time.Second, want: Position{Y: 50}},
+		{name: "loop wraps around", m: square, at: 45 * time.Second, want: Position{X: 50}},
+		{name: "loop after many laps", m: square, at: 100*40*time.Second + 25*time.Second, want: Position{X: 50, Y: 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := waypointPosition(start, tt.m, tt.at)
+			if math.Abs(got.X-tt.want.X) > 1e-6 || math.Abs(got.Y-tt.want.Y) > 1e-6 {
+				t.Errorf("waypointPosition(%s) = %+v, want %+v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRandomWalkStaysInBounds(t *testing.T) {
+	m := &Mobility{Type: MobilityRandomWalk, SpeedMPS: 30, Step: 10 * time.Second, Bounds: &Bounds{MinX: -100, MinY: -100, MaxX: 100, MaxY: 100}}
+	w := newRandomWalker(Position{}, m, 7)
+	for at := time.Duration(0); at < time.Hour; at += 7 * time.Second {
+		p := w.positionAt(at)
+		if p.X < -100 || p.X > 100 || p.Y < -100 || p.Y > 100 {
+			t.Fatalf("position at %s = %+v, outside the bounds", at, p)
+		}
+	}
+}
+
+func TestMobilityDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantStep time.Duration
+		wantErr  string
+	}{
+		{name: "omitted step is defaulted", body: "{ type: random_walk, speed_mps: 2 }", wantStep: 10 * time.Second},
+		{name: "explicit step", body: "{ type: random_walk, speed_mps: 2, step: 20s }", wantStep: 20 * time.Second},
+		{name: "explicit zero step is rejected", body: "{ type: random_walk, speed_mps: 2, step: 0s }", wantErr: "positive step"},
+		{name: "zero speed", body: "{ type: waypoint, waypoints: [{ x: 1 }] }", wantErr: "positive speed_mps"},
+		{name: "no waypoints", body: "{ type: waypoint, speed_mps: 1 }", wantErr: "at least one waypoint"},
+		{name: "empty bounds", body: "{ type: random_walk, speed_mps: 1, bounds: { max_x: 10 } }", wantErr: "bounds are empty"},
+		{name: "unknown type", body: "{ type: teleport, speed_mps: 1 }", wantErr: "unknown mobility type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Mobility
+			if err := yaml.Unmarshal([]byte(tt.body), &m); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			before := m
+			err := m.validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("validate error = %v, want it to mention %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			if m.Step != before.Step || m.Type != before.Type || m.SpeedMPS != before.SpeedMPS {
+				t.Errorf("validate changed the mobility: %+v -> %+v", before, m)
+			}
+			if tt.wantErr == "" && m.Step != tt.wantStep {
+				t.Errorf("step = %s, want %s", m.Step, tt.wantStep)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package simulator
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Propagation model types.
+const (
+	PropagationFreeSpace   = "free_space"
+	PropagationLogDistance = "log_distance"
+)
+
+// freeSpacePathLoss returns the Friis loss in dB for distance in meters.
+func freeSpacePathLoss(distanceM, frequencyMHz float64) float64 {
+	if distanceM < 1 {
+		distanceM = 1
+	}
+	return 20*math.Log10(distanceM/1000) + 20*math.Log10(frequencyMHz) + 32.44
+}
+
+// meanPathLoss returns the distance-dependent loss without shadowing.
+//
+//	free_space:   Friis
+//	log_distance: PL(d0) + 10·n·log10(d/d0), PL(d0) taken from free space
+func (p Propagation) meanPathLoss(distanceM float64) float64 {
+	if p.Model != PropagationLogDistance {
+		return freeSpacePathLoss(distanceM, p.FrequencyMHz)
+	}
+	d0 := p.ReferenceDistanceM
+	if distanceM < d0 {
+		distanceM = d0
+	}
+	return freeSpacePathLoss(d0, p.FrequencyMHz) + 10*p.PathLossExponent*math.Log10(distanceM/d0)
+}
+
+// shadowing returns a zero-mean log-normal shadowing term for the link a-b.
+// The value is symmetric, depends only on the seed, the link and the current
+// shadowing slot, so repeated evaluations at the same time agree.
+func (p Propagation) shadowing(seed int64, a, b string, t time.Duration) float64 {
+	if p.ShadowingStdDB <= 0 {
+		return 0
+	}
+	if a > b {
+		a, b = b, a
+	}
+	var slot int64
+	if p.ShadowingInterval > 0 {
+		slot = int64(t / p.ShadowingInterval)
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(a))
+	h.Write([]byte{0})
+	h.Write([]byte(b))
+	rng := rand.New(rand.NewSource(seed ^ int64(h.Sum64()) ^ slot*0x5bd1e995))
+	return rng.NormFloat64() * p.ShadowingStdDB
+}
@@ -0,0 +1,96 @@
+package simulator
+
+import (
+	"math"
+	"testing"
+)
+
+const pathLossTolerance = 0.01
+
+func TestFreeSpacePathLoss(t *testing.T) {
+	tests := []struct {
+		name      string
+		distanceM float64
+		want      float64
+	}{
+		{name: "1km", distanceM: 1000, want: 95.486},
+		{name: "doubling adds 6dB", distanceM: 2000, want: 101.506},
+		{name: "20km", distanceM: 20000, want: 121.506},
+		{name: "below 1m is clamped", distanceM: 0.5, want: 35.486},
+		{name: "zero distance is clamped", distanceM: 0, want: 35.486},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := freeSpacePathLoss(tt.distanceM, 1420); math.Abs(got-tt.want) > pathLossTolerance {
+				t.Errorf("freeSpacePathLoss(%v, 1420) = %.3f, want %.3f", tt.distanceM, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogDistancePathLoss(t *testing.T) {
+	tests := []struct {
+		name      string
+		exponent  float64
+		d0        float64
+		distanceM float64
+		want      float64
+	}{
+		{name: "at the reference distance", exponent: 3, d0: 1, distanceM: 1, want: 35.486},
+		{name: "n=3 over three decades", exponent: 3, d0: 1, distanceM: 1000, want: 125.486},
+		{name: "n=2 matches free space", exponent: 2, d0: 1, distanceM: 1000, want: 95.486},
+		{name: "n=2.8 from 10m", exponent: 2.8, d0: 10, distanceM: 1000, want: 111.486},
+		{name: "inside the reference distance", exponent: 2.8, d0: 10, distanceM: 3, want: 55.486},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Propagation{Model: PropagationLogDistance, FrequencyMHz: 1420, PathLossExponent: tt.exponent, ReferenceDistanceM: tt.d0}
+			if got := p.meanPathLoss(tt.distanceM); math.Abs(got-tt.want) > pathLossTolerance {
+				t.Errorf("meanPathLoss(%v) = %.3f, want %.3f", tt.distanceM, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkThreshold(t *testing.T) {
+	// 23dBm over free space at 1420MHz against a -100dBm threshold and a
+	// -104dBm noise floor; RSRP is rx power spread over 600 subcarriers.
+	tests := []struct {
+		name      string
+		distanceM float64
+		wantLink  bool
+		wantPL    float64
+		wantRSRP  float64
+		wantSNR   float64
+	}{
+		{name: "1km", distanceM: 1000, wantLink: true, wantPL: 95.486, wantRSRP: -100.267, wantSNR: 31.514},
+		{name: "20km just above the threshold", distanceM: 20000, wantLink: true, wantPL: 121.506, wantRSRP: -126.288, wantSNR: 5.494},
+		{name: "30km below the threshold", distanceM: 30000, wantLink: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := defaultScenario()
+			s.Nodes = []NodeSpec{{NodeID: "1"}, {NodeID: "2", Position: Position{X: tt.distanceM}}}
+			e := NewEngine(&s)
+			link, ok := e.evaluateLink(s.Nodes[0], s.Nodes[0].Position, s.Nodes[1], s.Nodes[1].Position, 0)
+			if ok != tt.wantLink {
+				t.Fatalf("link = %v, want %v (rx %.3fdBm)", ok, tt.wantLink, link.RxPowerDBm)
+			}
+			if !ok {
+				return
+			}
+			for _, v := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"path loss", link.PathLossDB, tt.wantPL},
+				{"rsrp", link.RSRPDBm, tt.wantRSRP},
+				{"snr", link.SNRDB, tt.wantSNR},
+			} {
+				if math.Abs(v.got-v.want) > pathLossTolerance {
+					t.Errorf("%s = %.3f, want %.3f", v.name, v.got, v.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package simulator
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Event types supported by scenario files.
+const (
+	EventLinkFailure  = "link_failure"
+	EventNodeReboot   = "node_reboot"
+	EventFade         = "fade"
+	EventInterference = "interference"
+)
+
+// Scenario describes a reproducible simulation run loaded from YAML.
+type Scenario struct {
+	Name         string        `yaml:"name"`
+	Description  string        `yaml:"description"`
+	Seed         int64         `yaml:"seed"`          // drives shadowing and random walks
+	Duration     time.Duration `yaml:"duration"`      // 0 means run until stopped
+	TickInterval time.Duration `yaml:"tick_interval"` // how often reports are sent
+	Repeat       bool          `yaml:"repeat"`        // restart the timeline after Duration
+	Propagation  Propagation   `yaml:"propagation"`
+	Nodes        []NodeSpec    `yaml:"nodes"`
+	Events       []Event       `yaml:"events"`
+}
+
+// Propagation configures how received power and link existence are derived.
+type Propagation struct {
+	Model              string        `yaml:"model"` // free_space or log_distance
+	FrequencyMHz       float64       `yaml:"frequency_mhz"`
+	TxPowerDBm         float64       `yaml:"tx_power_dbm"`
+	RxThresholdDBm     float64       `yaml:"rx_threshold_dbm"`
+	NoiseFloorDBm      float64       `yaml:"noise_floor_dbm"`
+	MinSNRDB           float64       `yaml:"min_snr_db"`
+	EARFCN             int           `yaml:"earfcn"`
+	PathLossExponent   float64       `yaml:"path_loss_exponent"`   // log_distance
+	ReferenceDistanceM float64       `yaml:"reference_distance_m"` // log_distance
+	ShadowingStdDB     float64       `yaml:"shadowing_std_db"`
+	ShadowingInterval  time.Duration `yaml:"shadowing_interval"` // 0 keeps shadowing fixed per link
+}
+
+// Position is a planar coordinate in meters.
+type Position struct {
+	X float64 `yaml:"x"`
+	Y float64 `yaml:"y"`
+}
+
+// NodeSpec places a device (matched by node_id) in the scenario.
+type NodeSpec struct {
+	NodeID     string    `yaml:"node_id"`
+	Position   Position  `yaml:"position"` // start position when mobile
+	TxPowerDBm *float64  `yaml:"tx_power_dbm,omitempty"`
+	Mobility   *Mobility `yaml:"mobility,omitempty"`
+}
+
+// Event is a scheduled disturbance on the timeline.
+type Event struct {
+	Type           string        `yaml:"type"`
+	At             time.Duration `yaml:"at"`
+	Duration       time.Duration `yaml:"duration"`
+	Nodes          []string      `yaml:"nodes"`
+	AttenuationDB  float64       `yaml:"attenuation_db"`
+	InterferenceDB float64       `yaml:"interference_db"`
+}
+
+// activeAt reports whether the event covers the given scenario offset.
+func (e Event) activeAt(t time.Duration) bool {
+	return t >= e.At && t < e.At+e.Duration
+}
+
+// LoadScenario 从YAML文件加载仿真场景
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario file %s: %v", path, err)
+	}
+
+	// Decode over the defaults: keys missing from the file keep their
+	// default, while keys that are present win even when they are zero
+	// (min_snr_db: 0, tx_power_dbm: 0 ...).
+	scenario := defaultScenario()
+	if err := yaml.Unmarshal(data, &scenario); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario file %s: %v", path, err)
+	}
+
+	if err := scenario.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario %s: %v", path, err)
+	}
+	return &scenario, nil
+}
+
+// defaultScenario returns the values used for keys a scenario file omits.
+func defaultScenario() Scenario {
+	return Scenario{
+		TickInterval: 5 * time.Second,
+		Propagation: Propagation{
+			Model:              PropagationFreeSpace,
+			FrequencyMHz:       1420,
+			TxPowerDBm:         23,
+			RxThresholdDBm:     -100,
+			NoiseFloorDBm:      -104,
+			MinSNRDB:           -5,
+			EARFCN:             14200,
+			PathLossExponent:   3,
+			ReferenceDistanceM: 1,
+		},
+	}
+}
+
+// Validate checks node references and event parameters.
+func (s *Scenario) Validate() error {
+	if len(s.Nodes) == 0 {
+		return fmt.Errorf("scenario defines no nodes")
+	}
+	if s.TickInterval <= 0 {
+		return fmt.Errorf("tick_interval must be positive")
+	}
+	if s.Duration < 0 {
+		return fmt.Errorf("duration must not be negative")
+	}
+	p := s.Propagation
+	switch p.Model {
+	case PropagationFreeSpace:
+	case PropagationLogDistance:
+		if p.ReferenceDistanceM <= 0 {
+			return fmt.Errorf("reference_distance_m must be positive")
+		}
+		if p.PathLossExponent <= 0 {
+			return fmt.Errorf("path_loss_exponent must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown propagation model %q", p.Model)
+	}
+	if p.FrequencyMHz <= 0 {
+		return fmt.Errorf("frequency_mhz must be positive")
+	}
+	if p.ShadowingStdDB < 0 {
+		return fmt.Errorf("shadowing_std_db must not be negative")
+	}
+
+	known := make(map[string]bool, len(s.Nodes))
+	for _, n := range s.Nodes {
+		if n.NodeID == "" {
+			return fmt.Errorf("node without node_id")
+		}
+		if known[n.NodeID] {
+			return fmt.Errorf("duplicate node %s", n.NodeID)
+		}
+		known[n.NodeID] = true
+		if n.Mobility != nil {
+			if err := n.Mobility.validate(); err != nil {
+				return fmt.Errorf("node %s: %v", n.NodeID, err)
+			}
+		}
+	}
+
+	for i, e := range s.Events {
+		if e.Duration <= 0 {
+			return fmt.Errorf("event %d (%s): duration must be positive", i, e.Type)
+		}
+		for _, id := range e.Nodes {
+			if !known[id] {
+				return fmt.Errorf("event %d (%s): unknown node %s", i, e.Type, id)
+			}
+		}
+		switch e.Type {
+		case EventLinkFailure:
+			if len(e.Nodes) != 2 {
+				return fmt.Errorf("event %d: link_failure needs exactly two nodes", i)
+			}
+		case EventNodeReboot:
+			if len(e.Nodes) != 1 {
+				return fmt.Errorf("event %d: node_reboot needs exactly one node", i)
+			}
+		case EventFade:
+			if len(e.Nodes) == 0 || len(e.Nodes) > 2 {
+				return fmt.Errorf("event %d: fade needs one node or one link", i)
+			}
+			if e.AttenuationDB <= 0 {
+				return fmt.Errorf("event %d: fade needs a positive attenuation_db", i)
+			}
+		case EventInterference:
+			if e.InterferenceDB <= 0 {
+				return fmt.Errorf("event %d: interference needs a positive interference_db", i)
+			}
+		default:
+			return fmt.Errorf("event %d: unknown type %q", i, e.Type)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ScenarioRunner replays a scenario against the backend, reporting through the
+// same HTTP endpoints that real devices and agents use.
+type ScenarioRunner struct {
+	db         *gorm.DB
+	engine     *Engine
+	scenario   *Scenario
+	backendURL string
+	authToken  TokenSource
+	client     *http.Client
+
+	devices  map[string]Device // node_id -> device row
+	lastSeen map[string]bool   // node_id -> last reported online state
+}
+
+// NewScenarioRunner 创建场景运行器
+func NewScenarioRunner(db *gorm.DB, scenario *Scenario, backendURL string, authToken TokenSource) *ScenarioRunner {
+	return &ScenarioRunner{
+		db:         db,
+		engine:     NewEngine(scenario),
+		scenario:   scenario,
+		backendURL: backendURL,
+		authToken:  authToken,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		lastSeen:   make(map[string]bool),
+	}
+}
+
+// LoadScenarioRunner loads a scenario file and prepares a runner for it;
+// the caller starts Run in a background worker.
+func LoadScenarioRunner(db *gorm.DB, backendURL string, authToken TokenSource, scenarioPath string) (*ScenarioRunner, error) {
+	scenario, err := LoadScenario(scenarioPath)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Starting scenario simulator %q with %d nodes and %d events", scenario.Name, len(scenario.Nodes), len(scenario.Events))
+	return NewScenarioRunner(db, scenario, backendURL, authToken), nil
+}
+
+// Run drives the scenario timeline until it ends (or forever when repeating)
+// or ctx is cancelled.
+func (r *ScenarioRunner) Run(ctx context.Context) error {
+	// Wait a moment for the main server to be ready.
+	if !sleepCtx(ctx, 5*time.Second) {
+		return nil
+	}
+
+	ticker := time.NewTicker(r.scenario.TickInterval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		offset := time.Since(start)
+		if r.scenario.Duration > 0 && offset >= r.scenario.Duration {
+			if !r.scenario.Repeat {
+				log.Printf("[Simulator] Scenario %q finished after %s", r.scenario.Name, r.scenario.Duration)
+				return nil
+			}
+			start = time.Now()
+			offset = 0
+		}
+
+		r.Tick(offset)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Printf("[Simulator] Scenario %q stopped", r.scenario.Name)
+			return nil
+		}
+	}
+}
+
+// Tick evaluates the scenario at offset and reports every node's state.
+func (r *ScenarioRunner) Tick(offset time.Duration) {
+	if err := r.refreshDevices(); err != nil {
+		log.Printf("[Simulator] ERROR: Failed to fetch devices: %v", err)
+		return
+	}
+
+	states := r.engine.Step(offset)
+
+	var wg sync.WaitGroup
+	for _, nodeID := range r.engine.SortedNodeIDs() {
+		device, ok := r.devices[nodeID]
+		if !ok {
+			continue
+		}
+		state := states[nodeID]
+
+		if prev, seen := r.lastSeen[nodeID]; !seen || prev != state.Online {
+			r.reportStatus(device, state.Online)
+			r.lastSeen[nodeID] = state.Online
+		}
+		if !state.Online {
+			continue
+		}
+
+		wg.Add(1)
+		go func(d Device, s *NodeState) {
+			defer wg.Done()
+			neighbors := make([]string, 0, len(s.Neighbors))
+			for _, n := range s.Neighbors {
+				neighbors = append(neighbors, n.NodeID)
+			}
+			reportLinks(d, neighbors, r.backendURL, r.authToken())
+			r.reportDRPR(d, s)
+			r.reportMonitorData(d, s)
+		}(device, state)
+	}
+	wg.Wait()
+}
+
+// refreshDevices maps scenario node ids onto registered devices.
+func (r *ScenarioRunner) refreshDevices() error {
+	ids := make([]string, 0, len(r.scenario.Nodes))
+	for _, n := range r.scenario.Nodes {
+		ids = append(ids, n.NodeID)
+	}
+
+	var devices []Device
+	if err := r.db.Where("node_id IN ?", ids).Find(&devices).Error; err != nil {
+		return err
+	}
+
+	r.devices = make(map[string]Device, len(devices))
+	for _, d := range devices {
+		r.devices[d.NodeID] = d
+	}
+	return nil
+}
+
+// FormatDRPR renders a neighbor link as a ^DRPR line in the board's field order.
+func FormatDRPR(link NeighborLink) string {
+	return fmt.Sprintf("^DRPR: %s,%d,%.0f,%.0f,%d,%.0f,%.0f,%.0f,%.0f,%.0f,%d,%d,%d,%d,%d,%d,%d,%.0f,%.0f,%d",
+		link.NodeID,
+		link.Index,
+		link.RSSIDBm,
+		link.PathLossDB,
+		link.EARFCN,
+		link.RSRPDBm,
+		link.RSRQDB,
+		link.SNRDB,
+		link.DistanceM,
+		link.TxPowerDBm,
+		link.DLKbps,
+		link.ULKbps,
+		link.DLSCHErrors,
+		link.MCS,
+		link.RB,
+		link.CQI,
+		link.DLSCHTotal,
+		link.SNRDB+2,
+		link.SNRDB-2,
+		link.DLKbps*8,
+	)
+}
+
+// FormatDRPRI renders a neighbor link as an unsolicited ^DRPRI report in the
+// field order of AT.md; unlike ^DRPR it carries the earfcn of the link.
+func FormatDRPRI(link NeighborLink) string {
+	return fmt.Sprintf("^DRPRI: %d,0,%d,0,\"%.0f\",%.0f,\"%.0f\",\"0\",\"%.0f\",%.0f,\"%.0f\",%d,%d,%d,%d,%d,%d,%d,\"%.0f\",\"%.0f\",%d,0",
+		link.Index,
+		link.EARFCN,
+		link.RSSIDBm,
+		link.PathLossDB,
+		link.RSRPDBm,
+		link.SNRDB,
+		link.DistanceM,
+		link.TxPowerDBm,
+		link.DLKbps,
+		link.ULKbps,
+		link.DLSCHErrors,
+		link.MCS,
+		link.RB,
+		link.CQI,
+		link.DLSCHTotal,
+		link.SNRDB+2,
+		link.SNRDB-2,
+		link.DLKbps*8,
+	)
+}
+
+func (r *ScenarioRunner) reportDRPR(device Device, state *NodeState) {
+	if len(state.Neighbors) == 0 {
+		return
+	}
+	lines := make([]string, 0, len(state.Neighbors))
+	for _, n := range state.Neighbors {
+		lines = append(lines, FormatDRPRI(n))
+	}
+	url := fmt.Sprintf("%s/api/devices/%d/debug/drpr/report", r.backendURL, device.ID)
+	r.post(device, url, "text/plain", []byte(strings.Join(lines, "\r\n")))
+}
+
+func (r *ScenarioRunner) reportMonitorData(device Device, state *NodeState) {
+	payload := map[string]interface{}{
+		"type":      "radio",
+		"ip":        device.IP,
+		"timestamp": time.Now(),
+	}
+
+	// Report the strongest neighbor, as the board's own status page does.
+	if len(state.Neighbors) > 0 {
+		best := state.Neighbors[0]
+		for _, n := range state.Neighbors[1:] {
+			if n.RSRPDBm > best.RSRPDBm {
+				best = n
+			}
+		}
+		payload["earfcn"] = best.EARFCN
+		payload["rsrp"] = math.Round(best.RSRPDBm)
+		payload["snr"] = math.Round(best.SNRDB)
+		payload["distance"] = math.Round(best.DistanceM)
+		payload["signal_quality"] = signalQuality(best.SNRDB)
+	}
+
+	body, _ := json.Marshal(payload)
+	url := fmt.Sprintf("%s/api/devices/%d/monitor", r.backendURL, device.ID)
+	r.post(device, url, "application/json", body)
+}
+
+func (r *ScenarioRunner) reportStatus(device Device, online bool) {
+	status := "Offline"
+	if online {
+		status = "Online"
+	}
+	body, _ := json.Marshal(map[string]string{"status": status})
+	url := fmt.Sprintf("%s/api/devices/%d/status", r.backendURL, device.ID)
+	req, _ := http.NewRequest("PUT", url, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.do(device, req)
+}
+
+func (r *ScenarioRunner) post(device Device, url, contentType string, body []byte) {
+	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", contentType)
+	r.do(device, req)
+}
+
+func (r *ScenarioRunner) do(device Device, req *http.Request) {
+	if token := r.authToken(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		log.Printf("[Simulator Agent for %s] ERROR: %s %s failed: %v", device.NodeID, req.Method, req.URL.Path, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("[Simulator Agent for %s] FAILED %s %s. Status: %s", device.NodeID, req.Method, req.URL.Path, resp.Status)
+	}
+}
+
+// signalQuality maps SNR (-5..25 dB) onto a 0..100 percentage.
+func signalQuality(snr float64) float64 {
+	q := (snr + 5) / 30 * 100
+	return math.Max(0, math.Min(100, math.Round(q)))
+}
@@ -0,0 +1,117 @@
+package simulator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScenario stores a scenario body in a temporary file and returns its path.
+func writeScenario(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatalf("write scenario: %v", err)
+	}
+	return path
+}
+
+const twoNodes = `
+nodes:
+  - node_id: "1"
+  - node_id: "2"
+    position: { x: 1000, y: 0 }
+`
+
+func TestLoadScenarioDefaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		check func(*Scenario) bool
+	}{
+		{
+			name: "omitted keys take defaults",
+			body: twoNodes,
+			check: func(s *Scenario) bool {
+				return s.TickInterval == 5*time.Second && s.Propagation == defaultScenario().Propagation
+			},
+		},
+		{
+			name:  "explicit zero min_snr_db",
+			body:  "propagation: { min_snr_db: 0 }\n" + twoNodes,
+			check: func(s *Scenario) bool { return s.Propagation.MinSNRDB == 0 && s.Propagation.TxPowerDBm == 23 },
+		},
+		{
+			name:  "explicit zero tx power and threshold",
+			body:  "propagation: { tx_power_dbm: 0, rx_threshold_dbm: 0 }\n" + twoNodes,
+			check: func(s *Scenario) bool { return s.Propagation.TxPowerDBm == 0 && s.Propagation.RxThresholdDBm == 0 },
+		},
+		{
+			name:  "explicit zero earfcn and noise floor",
+			body:  "propagation: { earfcn: 0, noise_floor_dbm: 0 }\n" + twoNodes,
+			check: func(s *Scenario) bool { return s.Propagation.EARFCN == 0 && s.Propagation.NoiseFloorDBm == 0 },
+		},
+		{
+			name: "other keys keep their defaults",
+			body: "propagation: { model: log_distance, path_loss_exponent: 2.5 }\n" + twoNodes,
+			check: func(s *Scenario) bool {
+				p := s.Propagation
+				return p.PathLossExponent == 2.5 && p.ReferenceDistanceM == 1 && p.FrequencyMHz == 1420 && p.MinSNRDB == -5
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := LoadScenario(writeScenario(t, tt.body))
+			if err != nil {
+				t.Fatalf("LoadScenario: %v", err)
+			}
+			if !tt.check(s) {
+				t.Errorf("unexpected scenario: tick=%s propagation=%+v", s.TickInterval, s.Propagation)
+			}
+		})
+	}
+}
+
+func TestLoadScenarioInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{name: "no nodes", body: "name: empty\n", wantErr: "no nodes"},
+		{name: "zero tick interval", body: "tick_interval: 0s\n" + twoNodes, wantErr: "tick_interval"},
+		{name: "zero frequency", body: "propagation: { frequency_mhz: 0 }\n" + twoNodes, wantErr: "frequency_mhz"},
+		{name: "zero reference distance", body: "propagation: { model: log_distance, reference_distance_m: 0 }\n" + twoNodes, wantErr: "reference_distance_m"},
+		{name: "unknown model", body: "propagation: { model: two_ray }\n" + twoNodes, wantErr: "unknown propagation model"},
+		{name: "duplicate node", body: "nodes: [{ node_id: a }, { node_id: a }]\n", wantErr: "duplicate node"},
+		{name: "event on unknown node", body: twoNodes + "events: [{ type: node_reboot, at: 1s, duration: 1s, nodes: [\"9\"] }]\n", wantErr: "unknown node 9"},
+		{name: "link failure needs two nodes", body: twoNodes + "events: [{ type: link_failure, at: 1s, duration: 1s, nodes: [\"1\"] }]\n", wantErr: "exactly two nodes"},
+		{name: "event without duration", body: twoNodes + "events: [{ type: fade, at: 1s, nodes: [\"1\"], attenuation_db: 3 }]\n", wantErr: "duration must be positive"},
+		{name: "not yaml", body: "nodes: [", wantErr: "failed to parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadScenario(writeScenario(t, tt.body))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadScenario error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadShippedScenarios(t *testing.T) {
+	paths, err := filepath.Glob("../../config/scenarios/*.yaml")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no scenarios found: %v", err)
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			if _, err := LoadScenario(path); err != nil {
+				t.Errorf("LoadScenario: %v", err)
+			}
+		})
+	}
+}
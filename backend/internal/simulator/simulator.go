@@ -2,6 +2,7 @@ package simulator
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -18,6 +19,7 @@ import (
 type Device struct {
 	ID        uint   `gorm:"primaryKey"`
 	NodeID    string `gorm:"uniqueIndex;not null"`
+	IP        string
 	BoardType string `gorm:"not null"`
 }
 
@@ -27,19 +29,24 @@ func (Device) TableName() string {
 
 // --- Public Functions ---
 
-// Start initializes and runs the network simulator as a background service.
-func Start(db *gorm.DB, backendURL, authToken string) {
-	log.Println("Starting Integrated Network Simulator...")
+// TokenSource returns the bearer token for the next request to the backend;
+// the integrated simulator is given short-lived tokens that are renewed.
+type TokenSource func() string
 
-	// Run the main simulation logic in a separate goroutine.
-	go runSimulationLoop(db, backendURL, authToken)
+// Start runs the network simulator until ctx is cancelled. Callers run it
+// in a background worker.
+func Start(ctx context.Context, db *gorm.DB, backendURL string, authToken TokenSource) error {
+	log.Println("Starting Integrated Network Simulator...")
+	return runSimulationLoop(ctx, db, backendURL, authToken)
 }
 
 // --- Internal Simulation Logic ---
 
-func runSimulationLoop(db *gorm.DB, backendURL, authToken string) {
+func runSimulationLoop(ctx context.Context, db *gorm.DB, backendURL string, authToken TokenSource) error {
 	// Wait a moment for the main server to be ready.
-	time.Sleep(5 * time.Second)
+	if !sleepCtx(ctx, 5*time.Second) {
+		return nil
+	}
 
 	// 定期更新拓扑的定时器
 	ticker := time.NewTicker(30 * time.Second) // 每30秒更新一次
@@ -49,13 +56,31 @@ func runSimulationLoop(db *gorm.DB, backendURL, authToken string) {
 	reportTopology(db, backendURL, authToken)
 
 	// 定期更新拓扑
-	for range ticker.C {
-		reportTopology(db, backendURL, authToken)
+	for {
+		select {
+		case <-ticker.C:
+			reportTopology(db, backendURL, authToken)
+		case <-ctx.Done():
+			log.Println("[Simulator] Stopped")
+			return nil
+		}
+	}
+}
+
+// sleepCtx waits for d and reports false if ctx was cancelled first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
 
 // reportTopology 报告拓扑信息
-func reportTopology(db *gorm.DB, backendURL, authToken string) {
+func reportTopology(db *gorm.DB, backendURL string, authToken TokenSource) {
 	var allDevices []Device
 	if err := db.Find(&allDevices).Error; err != nil {
 		log.Printf("[Simulator] ERROR: Failed to fetch devices: %v", err)
@@ -65,14 +90,20 @@ func reportTopology(db *gorm.DB, backendURL, authToken string) {
 	rules := map[string]string{"mesh": "mesh", "star": "star"}
 	groups := groupDevices(allDevices, rules)
 
-	neighborMap := calculateAllNeighbors(groups)
+	// 星型网络以当前生效的中心节点为hub（设备角色由角色查询写入master_slave_configs）
+	var masters []uint
+	if err := db.Table("master_slave_configs").Where("active_type = ?", "1").Pluck("device_id", &masters).Error; err != nil {
+		log.Printf("[Simulator] WARNING: Failed to fetch star roles: %v", err)
+	}
+
+	neighborMap := calculateAllNeighbors(groups, masters)
 
 	var wg sync.WaitGroup
 	for _, device := range allDevices {
 		wg.Add(1)
 		go func(d Device) {
 			defer wg.Done()
-			reportLinks(d, neighborMap[d.ID], backendURL, authToken)
+			reportLinks(d, neighborMap[d.ID], backendURL, authToken())
 		}(device)
 	}
 	wg.Wait()
@@ -94,7 +125,7 @@ func groupDevices(devices []Device, rules map[string]string) map[string][]Device
 	return groups
 }
 
-func calculateAllNeighbors(groups map[string][]Device) map[uint][]string {
+func calculateAllNeighbors(groups map[string][]Device, masters []uint) map[uint][]string {
 	// ... (logic is the same as the standalone simulator)
 	neighborMap := make(map[uint][]string)
 	for groupName, devices := range groups {
@@ -112,9 +143,11 @@ func calculateAllNeighbors(groups map[string][]Device) map[uint][]string {
 			if len(devices) < 2 {
 				continue
 			}
-			hub := devices[0]
-			for i := 1; i < len(devices); i++ {
-				spoke := devices[i]
+			hub := starHub(devices, masters)
+			for _, spoke := range devices {
+				if spoke.ID == hub.ID {
+					continue
+				}
 				neighborMap[hub.ID] = append(neighborMap[hub.ID], spoke.NodeID)
 				neighborMap[spoke.ID] = append(neighborMap[spoke.ID], hub.NodeID)
 			}
@@ -123,6 +156,19 @@ func calculateAllNeighbors(groups map[string][]Device) map[uint][]string {
 	return neighborMap
 }
 
+// starHub returns the first device known to run as center node, or the first
+// device when no role has been read yet.
+func starHub(devices []Device, masters []uint) Device {
+	for _, d := range devices {
+		for _, id := range masters {
+			if d.ID == id {
+				return d
+			}
+		}
+	}
+	return devices[0]
+}
+
 func reportLinks(device Device, neighbors []string, backendURL, authToken string) {
 	payload := map[string][]string{"neighbors": neighbors}
 	payloadBytes, _ := json.Marshal(payload)
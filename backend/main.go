@@ -1,44 +1,130 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"backend/internal/config"
 	"backend/internal/db"
 	"backend/internal/router"
 	"backend/internal/service"
 	"backend/internal/simulator" // Import the new simulator package
+
+	"gorm.io/gorm"
 )
 
 func main() {
+	// 0. Load configuration (config/config.yaml, environment, command line)
+	cfgMgr, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	cfg := cfgMgr.Get()
+	log.Printf("Configuration loaded: %s", cfg)
+
 	// 1. Explicitly initialize the database
-	database, err := db.Init()
+	database, err := db.Init(cfg.Database.Path)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	log.Println("Database initialized successfully.")
 
 	// 2. Setup services that depend on the database
-	authSvc := service.NewAuthService(database)
+	authSvc := service.NewAuthService(database, cfg.JWT)
 
-	// 3. Generate a token for the internal simulator
-	internalToken, err := authSvc.GenerateToken(0, "internal_simulator", time.Hour*24*365*10)
-	if err != nil {
-		log.Fatalf("Failed to generate internal token for simulator: %v", err)
-	}
+	// 3. The supervisor owns every background worker and stops them on shutdown
+	supervisor := service.NewSupervisor()
 
-	// 4. Start the integrated simulator in a background goroutine
-	go simulator.Start(database, "http://localhost:8080", internalToken)
+	// 4. Start the integrated simulator as a background worker.
+	// simulator.scenario selects a YAML scenario instead of the static topology.
+	// Its token is only issued when the simulator runs and is renewed hourly.
+	if cfg.Simulator.Enabled {
+		internalToken := authSvc.NewServiceToken("internal_simulator", time.Hour).Token
+		if cfg.Simulator.Scenario != "" {
+			runner, err := simulator.LoadScenarioRunner(database, cfg.BaseURL(), internalToken, cfg.Simulator.Scenario)
+			if err != nil {
+				log.Fatalf("Failed to start scenario simulator: %v", err)
+			}
+			supervisor.Go("simulator", runner.Run)
+		} else {
+			supervisor.Go("simulator", func(ctx context.Context) error {
+				return simulator.Start(ctx, database, cfg.BaseURL(), internalToken)
+			})
+		}
+	}
 
 	// 5. Start device status monitor service
-	deviceStatusMonitor := service.NewDeviceStatusMonitor(database, 30*time.Second) // 每30秒检测一次
+	deviceStatusMonitor := service.NewDeviceStatusMonitor(database, cfg.MonitorInterval(), supervisor)
 	deviceStatusMonitor.Start()
 	log.Println("Device status monitor started")
+	cfgMgr.OnReload(func(c *config.Config) {
+		deviceStatusMonitor.SetInterval(c.MonitorInterval())
+	})
+
+	// 6. Reload runtime-safe settings on SIGHUP
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+	go func() {
+		for range reloadCh {
+			log.Println("SIGHUP received, reloading configuration")
+			if err := cfgMgr.Reload(); err != nil {
+				log.Printf("Config reload failed, keeping current settings: %v", err)
+			}
+		}
+	}()
 
-	// 6. Setup and run the Gin router, passing the DB instance to it
-	r := router.SetupRouter(database)
-	log.Println("Starting server on :8080")
-	if err := r.Run(":8080"); err != nil {
+	// 7. Setup and run the Gin router, passing the DB instance to it
+	r := router.SetupRouter(database, cfgMgr, supervisor)
+	srv := &http.Server{Addr: cfg.Addr(), Handler: r}
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Starting server on %s", cfg.Addr())
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	// 8. Shut down gracefully on SIGTERM/SIGINT
+	stopCh := make(chan os.Signal, 1)
+	signal.Notify(stopCh, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case err := <-serverErr:
 		log.Fatalf("Failed to start server: %v", err)
+	case sig := <-stopCh:
+		log.Printf("%s received, shutting down (timeout %v)", sig, cfg.Server.ShutdownTimeout)
+	}
+	shutdown(srv, supervisor, database, cfg.Server.ShutdownTimeout)
+}
+
+// shutdown drains HTTP requests, stops background workers, waits for
+// in-flight device commands and closes the database, all within timeout.
+func shutdown(srv *http.Server, supervisor *service.Supervisor, database *gorm.DB, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
+	} else {
+		log.Println("HTTP server stopped")
+	}
+	if err := supervisor.Shutdown(ctx); err != nil {
+		log.Printf("Background workers shutdown: %v", err)
+	}
+	if err := service.DrainDeviceCommands(ctx); err != nil {
+		log.Printf("Device commands shutdown: %v", err)
+	}
+	if sqlDB, err := database.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			log.Printf("Failed to close database: %v", err)
+		} else {
+			log.Println("Database closed")
+		}
 	}
+	log.Println("Shutdown complete")
 }
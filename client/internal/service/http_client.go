@@ -177,6 +177,71 @@ func (c *HTTPClient) UpdateNetworkTopology(nodes []model.NetworkTopologyNode, li
 	return err
 }
 
+// FirmwareUpdate 设备可升级的固件版本
+type FirmwareUpdate struct {
+	DeviceID       uint   `json:"device_id"`
+	CurrentVersion string `json:"current_version"`
+	Available      bool   `json:"available"`
+	Version        string `json:"version"`
+	ImageID        uint   `json:"image_id"`
+}
+
+// CheckFirmwareUpdate 检查设备是否有可升级的固件
+func (c *HTTPClient) CheckFirmwareUpdate(deviceID uint) (*FirmwareUpdate, error) {
+	resp, err := c.get(fmt.Sprintf("/api/devices/%d/firmware/update", deviceID))
+	if err != nil {
+		return nil, err
+	}
+
+	var update FirmwareUpdate
+	if err := json.Unmarshal(resp, &update); err != nil {
+		return nil, err
+	}
+
+	return &update, nil
+}
+
+// UpdateFirmware 升级设备固件。升级会重启设备，后端先返回428和确认令牌，
+// 调用方已在界面上确认，这里带令牌重发请求
+func (c *HTTPClient) UpdateFirmware(deviceID uint) error {
+	path := fmt.Sprintf("/api/devices/%d/firmware/upgrade", deviceID)
+	req, err := http.NewRequest("POST", c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusPreconditionRequired {
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(body))
+		}
+		return nil
+	}
+
+	var pending struct {
+		Confirmation struct {
+			ConfirmationToken string `json:"confirmation_token"`
+		} `json:"confirmation"`
+	}
+	if err := json.Unmarshal(body, &pending); err != nil {
+		return err
+	}
+	req, err = http.NewRequest("POST", c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Confirmation-Token", pending.Confirmation.ConfirmationToken)
+	_, err = c.do(req)
+	return err
+}
+
 // get 发送GET请求
 func (c *HTTPClient) get(path string) ([]byte, error) {
 	req, err := http.NewRequest("GET", c.baseURL+path, nil)
@@ -1,5 +1,5 @@
 import axios from 'axios';
-import { LoginRequest, RegisterRequest, User, Device, NetState, Security, Wireless, NetSetting, UpDownSetting, Debug, SystemManager, NetworkConfig, SecurityConfig, WirelessConfig, SystemConfig, TDDConfig, DebugConfig } from '../types';
+import { FieldError, LoginRequest, RegisterRequest, User, Device, NetState, Security, Wireless, NetSetting, UpDownSetting, Debug, SystemManager, NetworkConfig, SecurityConfig, WirelessConfig, SystemConfig, TDDConfig, DebugConfig } from '../types';
 import type { SecurityConfig as SecurityConfigType } from '../types';
 
 const API_BASE_URL = 'http://localhost:8080/api';
@@ -48,6 +48,14 @@ api.interceptors.response.use(
   }
 );
 
+// 从400响应中取出逐字段的校验错误，便于表单标记对应的输入项
+export const getFieldErrors = (error: unknown): FieldError[] => {
+  if (axios.isAxiosError(error) && error.response?.status === 400) {
+    return error.response.data?.field_errors ?? [];
+  }
+  return [];
+};
+
 // Auth API
 export const authAPI = {
   login: async (data: LoginRequest) => {
@@ -198,6 +198,15 @@ export interface ApiResponse<T> {
   status: number;
 }
 
+// 后端参数校验失败时返回的逐字段错误 (field_errors)
+export interface FieldError {
+  command?: string;
+  field: string;
+  value?: unknown;
+  rule: 'required' | 'type' | 'values' | 'range' | 'pattern' | 'band' | 'unknown';
+  message: string;
+}
+
 export interface MonitorData {
   id: number;
   device_id: number;